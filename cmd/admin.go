@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// serverURL returns the base URL of the running server, reaching a wildcard listen address
+// through loopback
+func serverURL(cfg *config.Config) string {
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// managementURL returns the base URL of the running server's management endpoints: the
+// admin listener when one is configured, otherwise the API's
+func managementURL(cfg *config.Config) string {
+	if cfg.Admin.Listen == "" {
+		return serverURL(cfg)
+	}
+	host, port, _ := net.SplitHostPort(cfg.Admin.Listen)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// callAdmin sends a request to the running server's admin API and decodes the JSON response
+// into out, if given. It authenticates with admin.token; a management listener without one
+// needs no credentials.
+func callAdmin(cfg *config.Config, method, path string, in, out any) error {
+	if cfg.Admin.Token == "" && cfg.Admin.Listen == "" {
+		return errors.New("management endpoints disabled: configure admin.token or admin.listen")
+	}
+
+	url := managementURL(cfg) + path
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Admin.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Admin.Token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var canaryCmd = &cobra.Command{
+	Use:   "canary",
+	Short: "Show model rollouts on the running server",
+	Long: `Show the canary rollouts of the running server: the share of requests for a
+model that is served by another model. Requests under a rollout are tagged
+"canary" or "control" in the usage ledger for comparison.`,
+	Args: cobra.NoArgs,
+	Run:  runCanaryList,
+}
+
+var canarySetCmd = &cobra.Command{
+	Use:   "set [model] [percent]",
+	Short: "Adjust a rollout on the running server",
+	Long: `Start or adjust the rollout of a model on the running server. --target names
+the model serving the canary share; it is only required for a new rollout.
+A percent of 0 without --target ends the rollout. Changes apply at once but are
+not saved; edit the canary section of the config file to keep them. The running
+server only accepts changes from the admin: with admin.token, or on admin.listen.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runCanarySet,
+}
+
+var canaryTarget string
+
+func init() {
+	canarySetCmd.Flags().StringVar(&canaryTarget, "target", "", "Model serving the canary share")
+
+	rootCmd.AddCommand(canaryCmd)
+	canaryCmd.AddCommand(canarySetCmd)
+}
+
+// canaryList is the admin API's rollout listing
+type canaryList struct {
+	Canaries []struct {
+		Model   string  `json:"model"`
+		Target  string  `json:"target"`
+		Percent float64 `json:"percent"`
+	} `json:"canaries"`
+}
+
+func runCanaryList(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	var list canaryList
+	if err := callAdmin(cfg, "GET", "/admin/canary", nil, &list); err != nil {
+		log.Fatalf("Failed to read canaries: %v", err)
+	}
+	printCanaries(list)
+}
+
+func runCanarySet(cmd *cobra.Command, args []string) {
+	percent, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		log.Fatalf("Invalid percent: %s", args[1])
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	body := map[string]any{"model": args[0], "target": canaryTarget, "percent": percent}
+	var list canaryList
+	if err := callAdmin(cfg, "POST", "/admin/canary", body, &list); err != nil {
+		log.Fatalf("Failed to update canary: %v", err)
+	}
+	printCanaries(list)
+}
+
+func printCanaries(list canaryList) {
+	if len(list.Canaries) == 0 {
+		fmt.Println("No canaries")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tTARGET\tPERCENT")
+	for _, c := range list.Canaries {
+		fmt.Fprintf(w, "%s\t%s\t%g%%\n", c.Model, c.Target, c.Percent)
+	}
+	w.Flush()
+}
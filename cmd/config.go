@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 
 	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/i18n"
 	"github.com/spf13/cobra"
 )
 
@@ -22,7 +25,13 @@ var configSetCmd = &cobra.Command{
 - base_url: Base URL for Z.AI API (default: https://api.z.ai)
 - host: Host to bind server to (default: 127.0.0.1)
 - port: Port to listen on (default: 11434)
-- debug: Enable debug mode (true/false)`,
+- debug: Enable debug mode (true/false)
+- log_privacy: Never log message content, only hashes and sizes (true/false)
+- locale: Language of error messages and CLI output (en, de, pl)
+
+With --live, a new api_key is also sent to the running server, which uses it for
+new requests at once; streams in progress are not interrupted. The server only
+accepts this from an authenticated client, so auth.keys must be configured.`,
 	Args: cobra.ExactArgs(2),
 	Run:  runConfigSet,
 }
@@ -35,38 +44,81 @@ var configGetCmd = &cobra.Command{
 - base_url: Base URL for Z.AI API
 - host: Host to bind server to
 - port: Port to listen on
-- debug: Debug mode enabled`,
+- debug: Debug mode enabled
+- log_privacy: Log privacy mode enabled
+- locale: Language of error messages and CLI output`,
 	Args: cobra.ExactArgs(1),
 	Run:  runConfigGet,
 }
 
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current schema",
+	Long: `Upgrade the config file to the schema version of this build. Settings that were
+renamed or moved are rewritten, and config_version is set. The original file is
+kept as config.json.bak.
+
+Old files are also upgraded in memory whenever they are loaded, so this only
+makes the change permanent. With --dry-run, the changes are listed and the file
+is left as it is.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigMigrate,
+}
+
+var migrateDryRun bool
+
+var configPathsCmd = &cobra.Command{
+	Use:   "paths",
+	Short: "Show where the config, data and log files are kept",
+	Args:  cobra.NoArgs,
+	Run:   runConfigPaths,
+}
+
+var setLive bool
+
 func init() {
+	configSetCmd.Flags().BoolVar(&setLive, "live", false, "Also apply a new api_key to the running server")
+
+	configMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "List the changes without writing the file")
+
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configSetCmd)
 	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configPathsCmd)
+}
+
+// configKeys are the settings config set and get accept
+var configKeys = []string{"api_key", "base_url", "host", "port", "debug", "log_privacy", "locale"}
+
+// loadLocalizedConfig loads the configuration and switches CLI messages to its locale
+func loadLocalizedConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := i18n.SetLocale(cfg.Locale); err != nil {
+		log.Printf("Ignoring locale: %v", err)
+	}
+	return cfg
 }
 
 func runConfigSet(cmd *cobra.Command, args []string) {
 	key := args[0]
 	value := args[1]
 
+	// Load existing config
+	cfg := loadLocalizedConfig()
+
 	// Validate key
-	validKeys := map[string]bool{
-		"api_key":  true,
-		"base_url": true,
-		"host":     true,
-		"port":     true,
-		"debug":    true,
+	if !slices.Contains(configKeys, key) {
+		log.Fatal(i18n.Sprintf("Invalid key: %s. Valid keys are: %s", key, strings.Join(configKeys, ", ")))
 	}
-
-	if !validKeys[key] {
-		log.Fatalf("Invalid key: %s. Valid keys are: api_key, base_url, host, port, debug", key)
+	if setLive && key != "api_key" {
+		log.Fatal(i18n.Sprintf("--live only applies to api_key; restart the server for %s", key))
 	}
-
-	// Load existing config
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	if setLive && cfg.Admin.Token == "" {
+		log.Fatal(i18n.Sprintf("--live requires admin.token; the running server only accepts key rotation with it"))
 	}
 
 	// Update the config value
@@ -81,7 +133,7 @@ func runConfigSet(cmd *cobra.Command, args []string) {
 		// Try to parse port as integer
 		var portInt int
 		if _, err := fmt.Sscanf(value, "%d", &portInt); err != nil {
-			log.Fatalf("Invalid port value: %s. Must be an integer.", value)
+			log.Fatal(i18n.Sprintf("Invalid port value: %s. Must be an integer.", value))
 		}
 		cfg.Port = portInt
 	case "debug":
@@ -92,26 +144,50 @@ func runConfigSet(cmd *cobra.Command, args []string) {
 		case "false", "0":
 			cfg.Debug = false
 		default:
-			log.Fatalf("Invalid debug value: %s. Must be true or false.", value)
+			log.Fatal(i18n.Sprintf("Invalid %s value: %s. Must be true or false.", key, value))
 		}
+	case "log_privacy":
+		switch value {
+		case "true", "1":
+			cfg.LogPrivacy = true
+		case "false", "0":
+			cfg.LogPrivacy = false
+		default:
+			log.Fatal(i18n.Sprintf("Invalid %s value: %s. Must be true or false.", key, value))
+		}
+	case "locale":
+		if err := i18n.SetLocale(value); err != nil {
+			log.Fatal(i18n.Sprintf("Invalid locale value: %v", err))
+		}
+		cfg.Locale = value
 	}
 
 	// Save the updated config
 	if err := config.Save(cfg); err != nil {
-		log.Fatalf("Failed to save configuration: %v", err)
+		log.Fatal(i18n.Sprintf("Failed to save configuration: %v", err))
+	}
+
+	fmt.Println(i18n.Sprintf("Configuration updated: %s = %s", key, maskIfAPIKey(key, value)))
+
+	if setLive {
+		if err := pushLiveKey(cfg, value); err != nil {
+			log.Fatal(i18n.Sprintf("Failed to apply the key to the running server: %v", err))
+		}
+		fmt.Println(i18n.Sprintf("Running server now uses the new api_key"))
 	}
+}
 
-	fmt.Printf("Configuration updated: %s = %s\n", key, maskIfAPIKey(key, value))
+// pushLiveKey sends a rotated upstream API key to the running server's admin API, which
+// accepts it only with the admin token
+func pushLiveKey(cfg *config.Config, key string) error {
+	return callAdmin(cfg, "POST", "/admin/upstream-key", map[string]string{"api_key": key}, nil)
 }
 
 func runConfigGet(cmd *cobra.Command, args []string) {
 	key := args[0]
 
 	// Load config
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	}
+	cfg := loadLocalizedConfig()
 
 	// Get the value
 	var value string
@@ -130,17 +206,59 @@ func runConfigGet(cmd *cobra.Command, args []string) {
 		}
 	case "debug":
 		value = fmt.Sprintf("%t", cfg.Debug)
+	case "log_privacy":
+		value = fmt.Sprintf("%t", cfg.LogPrivacy)
+	case "locale":
+		value = cfg.Locale
 	default:
-		log.Fatalf("Invalid key: %s. Valid keys are: api_key, base_url, host, port, debug", key)
+		log.Fatal(i18n.Sprintf("Invalid key: %s. Valid keys are: %s", key, strings.Join(configKeys, ", ")))
 	}
 
 	if value == "" {
-		fmt.Printf("%s is not set\n", key)
+		fmt.Println(i18n.Sprintf("%s is not set", key))
 	} else {
 		fmt.Printf("%s = %s\n", key, value)
 	}
 }
 
+func runConfigMigrate(cmd *cobra.Command, args []string) {
+	loadLocalizedConfig()
+
+	res, err := config.MigrateFile(migrateDryRun)
+	if err != nil {
+		log.Fatal(i18n.Sprintf("Failed to migrate configuration: %v", err))
+	}
+	if res.From == config.Version {
+		fmt.Println(i18n.Sprintf("%s is up to date (config_version %d)", res.Path, config.Version))
+		return
+	}
+
+	for _, change := range res.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+	if migrateDryRun {
+		fmt.Println(i18n.Sprintf("Would upgrade %s from config_version %d to %d", res.Path, res.From, config.Version))
+		return
+	}
+	fmt.Println(i18n.Sprintf("Upgraded %s from config_version %d to %d (original kept as %s.bak)", res.Path, res.From, config.Version, res.Path))
+}
+
+func runConfigPaths(cmd *cobra.Command, args []string) {
+	loadLocalizedConfig()
+
+	configPath, err := config.ConfigPath()
+	if err != nil {
+		log.Fatal(i18n.Sprintf("Failed to locate the config directory: %v", err))
+	}
+	dataDir, err := config.DataDir()
+	if err != nil {
+		log.Fatal(i18n.Sprintf("Failed to locate the data directory: %v", err))
+	}
+	fmt.Printf("%-16s %s\n", i18n.T("Config file:"), configPath)
+	fmt.Printf("%-16s %s\n", i18n.T("Data directory:"), dataDir)
+	fmt.Printf("%-16s %s\n", i18n.T("Log file:"), config.LogPath())
+}
+
 func maskIfAPIKey(key, value string) string {
 	if key == "api_key" && value != "" {
 		return "********"
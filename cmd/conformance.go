@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/conformance"
+	"github.com/spf13/cobra"
+)
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance",
+	Short: "Check the running server's responses against an API dialect",
+	Long: `Send a battery of live requests in one API dialect to the running server and
+check each response against the dialect's published schema: status codes,
+content types, JSON shapes and stream framing. The chat checks make real
+completions with --model, so they use upstream quota.
+
+Dialects: ` + strings.Join(conformance.Dialects(), ", ") + `
+
+Prints a pass/fail report and exits with status 1 if any check fails.`,
+	Args: cobra.NoArgs,
+	Run:  runConformance,
+}
+
+var (
+	conformanceDialect   string
+	conformanceModel     string
+	conformanceURL       string
+	conformanceClientKey string
+	conformanceTimeout   time.Duration
+)
+
+func init() {
+	conformanceCmd.Flags().StringVar(&conformanceDialect, "dialect", "openai", "API dialect to check ("+strings.Join(conformance.Dialects(), ", ")+")")
+	conformanceCmd.Flags().StringVar(&conformanceModel, "model", "GLM-4.7-Flash", "Model requested by the chat checks")
+	conformanceCmd.Flags().StringVar(&conformanceURL, "url", "", "Base URL of the server (default: the configured host and port)")
+	conformanceCmd.Flags().StringVar(&conformanceClientKey, "client-key", "", "Client key to authenticate to the running server (default: the first of auth.keys)")
+	conformanceCmd.Flags().DurationVar(&conformanceTimeout, "timeout", 2*time.Minute, "Timeout of each request")
+
+	rootCmd.AddCommand(conformanceCmd)
+}
+
+func runConformance(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	runner := &conformance.Runner{
+		BaseURL: conformanceURL,
+		APIKey:  conformanceClientKey,
+		Model:   conformanceModel,
+		Client:  &http.Client{Timeout: conformanceTimeout},
+	}
+	if runner.BaseURL == "" {
+		runner.BaseURL = serverURL(cfg)
+	}
+	if runner.APIKey == "" && len(cfg.Auth.Keys) > 0 {
+		runner.APIKey = cfg.Auth.Keys[0].Key
+	}
+
+	results, err := runner.Run(context.Background(), conformanceDialect)
+	if err != nil {
+		log.Fatalf("Conformance run failed: %v", err)
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tTIME\tDETAIL")
+	for _, r := range results {
+		result := "PASS"
+		if !r.Passed {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\n", conformanceDialect, r.Check, result, r.Elapsed.Round(time.Millisecond), r.Detail)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d passed, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
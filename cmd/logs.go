@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/requestlog"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Inspect the request log",
+	Long: `Inspect the request log, a SQLite database with one row per relayed chat request
+(request_log in the config file). Rows hold the time, request ID, client, model,
+status, latency, token counts and a hash of the prompt, never its content.`,
+	Args: cobra.NoArgs,
+}
+
+var logsQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "List logged requests, newest first",
+	Long: `List logged requests, newest first, filtered by period, model, client or status.
+
+--since and --until take a date (2026-03-01), a time (2026-03-01T15:04:05Z) or an
+age such as 36h or 7d.`,
+	Args: cobra.NoArgs,
+	Run:  runLogsQuery,
+}
+
+var (
+	logsSince  string
+	logsUntil  string
+	logsModel  string
+	logsClient string
+	logsStatus int
+	logsErrors bool
+	logsLimit  int
+	logsJSON   bool
+)
+
+func init() {
+	logsQueryCmd.Flags().StringVar(&logsSince, "since", "", "Start of the period")
+	logsQueryCmd.Flags().StringVar(&logsUntil, "until", "", "End of the period")
+	logsQueryCmd.Flags().StringVar(&logsModel, "model", "", "Only this model")
+	logsQueryCmd.Flags().StringVar(&logsClient, "client", "", "Only this client")
+	logsQueryCmd.Flags().IntVar(&logsStatus, "status", 0, "Only this HTTP status")
+	logsQueryCmd.Flags().BoolVar(&logsErrors, "errors", false, "Only failed requests (status 400 and above)")
+	logsQueryCmd.Flags().IntVar(&logsLimit, "limit", 50, "Most requests to list; 0 for all")
+	logsQueryCmd.Flags().BoolVar(&logsJSON, "json", false, "Print JSON instead of a table")
+	logsCmd.AddCommand(logsQueryCmd)
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogsQuery(cmd *cobra.Command, args []string) {
+	db := openRequestLog()
+	defer db.Close()
+
+	filter := requestlog.Filter{Model: logsModel, Client: logsClient, Status: logsStatus, Errors: logsErrors, Limit: logsLimit}
+	filter.Since, filter.Until = parsePeriod(logsSince, logsUntil)
+	records, err := requestlog.Query(cmd.Context(), db, filter)
+	if err != nil {
+		log.Fatalf("Failed to read request log: %v", err)
+	}
+
+	if logsJSON {
+		printJSON(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("No matching requests")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tREQUEST ID\tCLIENT\tMODEL\tSTATUS\tLATENCY\tPROMPT\tCOMPLETION\tSTREAM\tPROMPT HASH")
+	for _, r := range records {
+		client := r.Client
+		if client == "" {
+			client = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%d\t%t\t%s\n", r.Time.Local().Format(time.DateTime), r.RequestID, client,
+			r.Model, r.Status, msDuration(float64(r.LatencyMS)), r.PromptTokens, r.CompletionTokens, r.Stream, r.PromptHash)
+	}
+	w.Flush()
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Manage the model catalog",
+}
+
+var modelsValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check a model catalog file",
+	Long: `Check a model catalog file (JSON or YAML) the way the server does when it
+loads it, reporting every problem instead of the first: invalid fields, names
+listed twice or shared by two models, new models without a usable API name,
+and unknown capabilities.
+
+Without a file, the catalog the server would load is checked: models_file, or
+models.json, models.yaml or models.yml in the config directory. Exits with
+status 1 if the file has problems.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runModelsValidate,
+}
+
+func init() {
+	modelsCmd.AddCommand(modelsValidateCmd)
+	rootCmd.AddCommand(modelsCmd)
+}
+
+func runModelsValidate(cmd *cobra.Command, args []string) {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if path = cfg.CatalogPath(); path == "" {
+			log.Fatalf("No catalog file: pass one, or set models_file")
+		}
+	}
+
+	f, err := models.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read catalog: %v", err)
+	}
+	if err := f.Validate(); err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			fmt.Printf("%s: %s\n", path, problem)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d models, valid\n", path, len(f.Models))
+}
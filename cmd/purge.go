@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/retention"
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeAll    bool
+	purgeDryRun bool
+	purgeStores []string
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete persisted data past its retention limits",
+	Long: `Apply the retention policies in the config file to datasets, traces, the usage ledger
+and the log file now, instead of waiting for the server's next sweep. With --all every file
+in the selected stores is deleted regardless of policy.`,
+	Args: cobra.NoArgs,
+	Run:  runPurge,
+}
+
+func init() {
+	purgeCmd.Flags().BoolVar(&purgeAll, "all", false, "Delete everything in the selected stores")
+	purgeCmd.Flags().BoolVar(&purgeDryRun, "dry-run", false, "Report what would be deleted without deleting it")
+	purgeCmd.Flags().StringSliceVar(&purgeStores, "store", nil, "Stores to purge: datasets, traces, usage, logs (default all)")
+	rootCmd.AddCommand(purgeCmd)
+}
+
+func runPurge(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	stores, err := retention.Stores(cfg)
+	if err != nil {
+		log.Fatalf("Failed to locate data stores: %v", err)
+	}
+	for _, name := range purgeStores {
+		if !slices.ContainsFunc(stores, func(s retention.Store) bool { return s.Name == name }) {
+			log.Fatalf("Unknown store %q (use datasets, traces, usage or logs)", name)
+		}
+	}
+
+	verb := "REMOVED"
+	if purgeDryRun {
+		verb = "WOULD REMOVE"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "STORE\tFILES %s\tMB\tPATH\t\n", verb)
+	for _, s := range stores {
+		if len(purgeStores) > 0 && !slices.Contains(purgeStores, s.Name) {
+			continue
+		}
+		res, err := retention.Sweep(s, time.Now(), purgeAll, purgeDryRun)
+		if err != nil {
+			w.Flush()
+			log.Fatalf("Failed to purge %s: %v", s.Name, err)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%s\t\n", s.Name, res.Files, float64(res.Bytes)/(1<<20), s.Path)
+	}
+	w.Flush()
+}
@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
 	"github.com/spf13/cobra"
 )
 
@@ -24,6 +28,40 @@ func Execute() {
 	}
 }
 
+// loadCatalog applies the configured model catalog file, if any, to the built-in catalog, and
+// adds the models of configured providers that it does not list
+func loadCatalog(cfg *config.Config) {
+	if path := cfg.CatalogPath(); path != "" {
+		if err := models.LoadFile(path); err != nil {
+			log.Fatalf("Failed to load model catalog: %v", err)
+		}
+	}
+
+	// A model listed by two providers is reported by validateFeatureConfig
+	var f models.File
+	added := make(map[string]bool)
+	for _, p := range cfg.Providers {
+		for _, name := range p.Models {
+			if !models.IsValidModel(name) && !added[strings.ToLower(name)] {
+				f.Models = append(f.Models, models.Entry{Model: name})
+				added[strings.ToLower(name)] = true
+			}
+		}
+	}
+	if len(f.Models) == 0 {
+		return
+	}
+	if err := models.Apply(f); err != nil {
+		log.Fatalf("Failed to add provider models to the catalog: %v", err)
+	}
+}
+
+// dataDir overrides the platform data directory for every command
+var dataDir string
+
 func init() {
-	// Add global flags here if needed
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "", "Directory for persisted data: datasets, traces, usage, metrics (default: the platform data directory)")
+	cobra.OnInitialize(func() {
+		config.SetDataDir(dataDir)
+	})
 }
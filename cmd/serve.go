@@ -1,16 +1,32 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/chew-z/copilot-proxy/internal/agent"
+	"github.com/chew-z/copilot-proxy/internal/clock"
 	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/i18n"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+	"github.com/chew-z/copilot-proxy/internal/rewrite"
+	"github.com/chew-z/copilot-proxy/internal/scheduler"
 	"github.com/chew-z/copilot-proxy/internal/server"
+	"github.com/chew-z/copilot-proxy/internal/signing"
+	"github.com/chew-z/copilot-proxy/internal/usage"
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +34,11 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the proxy server",
 	Long: `Start the proxy server that listens for incoming requests
-and forwards them to Z.AI Coding PaaS.`,
+and forwards them to Z.AI Coding PaaS.
+
+The default port, 11434, is also Ollama's. When something already listens on
+the port, serve names it and exits; with --takeover it listens on the next free
+port instead and prints the settings that point clients there.`,
 	Run: runServe,
 }
 
@@ -30,8 +50,15 @@ func init() {
 	serveCmd.Flags().IntP("port", "p", 11434, "Port to listen on")
 	serveCmd.Flags().BoolP("debug", "d", false, "Enable debug mode (verbose logging)")
 	serveCmd.Flags().BoolP("verbose", "v", false, "Enable terminal output (default: quiet, logs to file only)")
+	serveCmd.Flags().BoolVar(&takeover, "takeover", false, "If the port is in use, listen on the next free port instead of exiting")
 }
 
+// takeover moves the server to the next free port when its port is taken
+var takeover bool
+
+// takeoverPorts is how many ports after the configured one --takeover tries
+const takeoverPorts = 20
+
 func runServe(cmd *cobra.Command, args []string) {
 	// Load and validate configuration
 	cfg := loadAndValidateConfig(cmd)
@@ -41,10 +68,10 @@ func runServe(cmd *cobra.Command, args []string) {
 
 	// Create and start server
 	srv := server.NewServer(cfg, host, port)
-	startServer(srv, cfg, host, port)
+	serveErr := startServer(srv, cfg, host, port)
 
 	// Wait for shutdown signal and gracefully shutdown
-	waitForShutdown(srv)
+	waitForShutdown(srv, serveErr)
 }
 
 // loadAndValidateConfig loads configuration and validates required settings
@@ -55,12 +82,34 @@ func loadAndValidateConfig(cmd *cobra.Command) *config.Config {
 		log.Fatalf("FATAL: Failed to load configuration: %v", err)
 	}
 
+	// Error responses and the messages below use the configured language
+	if err := i18n.SetLocale(cfg.Locale); err != nil {
+		log.Fatalf("FATAL: Invalid configuration: locale: %v", err)
+	}
+
 	// Check if API key is configured
 	if cfg.APIKey == "" {
-		log.Fatal("FATAL: API key is not configured. " +
-			"Please run 'copilot-proxy config set api_key YOUR_API_KEY' " +
-			"or set ZAI_API_KEY environment variable. " +
-			"Config file location: ~/.config/copilot-proxy/config.json")
+		configPath, _ := config.ConfigPath()
+		log.Fatal("FATAL: " + i18n.Sprintf("API key is not configured. "+
+			"Please run 'copilot-proxy config set api_key YOUR_API_KEY' "+
+			"or set ZAI_API_KEY environment variable. "+
+			"Config file location: %s", configPath))
+	}
+
+	// Old settings still work, but say so, and flag settings nothing reads (usually typos)
+	for _, change := range cfg.Migrations {
+		log.Printf("WARNING: %s", i18n.Sprintf("Config file uses an old setting: %s; run 'copilot-proxy config migrate' to update it", change))
+	}
+	if len(cfg.UnknownKeys) > 0 {
+		log.Printf("WARNING: %s", i18n.Sprintf("Config file settings are not recognized and are ignored: %s", strings.Join(cfg.UnknownKeys, ", ")))
+	}
+
+	// Model names in the settings below are checked against the catalog, file models included
+	loadCatalog(cfg)
+
+	// Validate optional feature settings up front rather than failing at run time
+	if err := validateFeatureConfig(cfg); err != nil {
+		log.Fatalf("FATAL: Invalid configuration: %v", err)
 	}
 
 	// Apply CLI flag overrides
@@ -69,6 +118,380 @@ func loadAndValidateConfig(cmd *cobra.Command) *config.Config {
 	return cfg
 }
 
+// validateFeatureConfig checks the config-file-only feature sections
+func validateFeatureConfig(cfg *config.Config) error {
+	if len(cfg.Jobs) > 0 {
+		if _, err := scheduler.New(cfg.Jobs, nil); err != nil {
+			return fmt.Errorf("jobs: %w", err)
+		}
+	}
+
+	if cfg.VisionModel != "" && !models.HasCapability(cfg.VisionModel, "vision") {
+		return fmt.Errorf("vision_model: '%s' is not a vision-capable model", cfg.VisionModel)
+	}
+
+	if cfg.DefaultModel != "" && !models.IsValidModel(cfg.DefaultModel) {
+		return fmt.Errorf("default_model: model '%s' not found", cfg.DefaultModel)
+	}
+
+	switch cfg.ToolValidation {
+	case "", "off", "basic", "strict":
+	default:
+		return fmt.Errorf("tool_validation: invalid mode '%s' (use off, basic or strict)", cfg.ToolValidation)
+	}
+
+	switch cfg.Links.Mode {
+	case "", "off", "annotate", "strip":
+	default:
+		return fmt.Errorf("links: invalid mode '%s' (use off, annotate or strip)", cfg.Links.Mode)
+	}
+
+	if cfg.ToolResults.MaxChars < 0 {
+		return fmt.Errorf("tool_results: max_chars must not be negative")
+	}
+	switch cfg.ToolResults.Mode {
+	case "", "truncate":
+	case "summarize":
+		if !models.IsValidModel(cfg.ToolResults.Model) {
+			return fmt.Errorf("tool_results: model '%s' not found", cfg.ToolResults.Model)
+		}
+	default:
+		return fmt.Errorf("tool_results: invalid mode '%s' (use truncate or summarize)", cfg.ToolResults.Mode)
+	}
+
+	if cfg.Images.MaxCost < 0 {
+		return fmt.Errorf("images: max_cost must not be negative")
+	}
+
+	if cfg.Usage.Export.Schedule != "" {
+		if _, err := usage.NewExporter(cfg.Usage.Export, "", "", clock.Real{}); err != nil {
+			return fmt.Errorf("usage.export: %w", err)
+		}
+	}
+
+	switch cfg.Storage.Backend {
+	case "", "memory", "sqlite":
+	case "redis":
+		if cfg.Storage.Redis.Addr == "" {
+			return fmt.Errorf("storage: redis.addr is required")
+		}
+	default:
+		return fmt.Errorf("storage: invalid backend '%s' (use memory, sqlite or redis)", cfg.Storage.Backend)
+	}
+
+	r := cfg.Retention
+	for name, p := range map[string]config.StorePolicy{"datasets": r.Datasets, "traces": r.Traces, "usage": r.Usage, "logs": r.Logs} {
+		if p.MaxAge < 0 || p.MaxMB < 0 {
+			return fmt.Errorf("retention: %s: limits must not be negative", name)
+		}
+	}
+
+	for name, limits := range cfg.ModelLimits {
+		if !models.IsValidModel(name) {
+			return fmt.Errorf("model_limits: model '%s' not found", name)
+		}
+		if limits.MaxInputTokens < 0 || limits.MaxOutputTokens < 0 {
+			return fmt.Errorf("model_limits: %s: limits must not be negative", name)
+		}
+	}
+
+	for name, snapshot := range cfg.ModelSnapshots {
+		if !models.IsValidModel(name) {
+			return fmt.Errorf("model_snapshots: model '%s' not found", name)
+		}
+		if !models.IsSnapshotOf(snapshot, name) {
+			return fmt.Errorf("model_snapshots: '%s' is not a snapshot of model '%s'", snapshot, name)
+		}
+	}
+
+	for name, model := range cfg.Anthropic.Models {
+		if !models.IsValidModel(model) {
+			return fmt.Errorf("anthropic: models: %s: model '%s' not found", name, model)
+		}
+	}
+	for _, model := range []string{cfg.Anthropic.Model, cfg.Anthropic.SmallModel} {
+		if model != "" && !models.IsValidModel(model) {
+			return fmt.Errorf("anthropic: model '%s' not found", model)
+		}
+	}
+
+	if cfg.Embeddings.Path != "" && !strings.HasPrefix(cfg.Embeddings.Path, "/") {
+		return fmt.Errorf("embeddings: path must start with /")
+	}
+	if cfg.Embeddings.MaxInputs < 0 {
+		return fmt.Errorf("embeddings: max_inputs must not be negative")
+	}
+
+	if cfg.Duplicates.Enabled && (cfg.Duplicates.MaxRepeats < 1 || cfg.Duplicates.Window <= 0) {
+		return fmt.Errorf("duplicates: max_repeats and window must be positive")
+	}
+
+	if cfg.Anomalies.Enabled && (cfg.Anomalies.Multiplier <= 1 || cfg.Anomalies.BaselineHours < 1) {
+		return fmt.Errorf("anomalies: multiplier must be above 1 and baseline_hours positive")
+	}
+
+	if cfg.SLO.Enabled {
+		if err := cfg.SLO.Validate(); err != nil {
+			return fmt.Errorf("slo: %w", err)
+		}
+	}
+
+	if err := cfg.Auth.Validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+
+	if cfg.Admin.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Admin.Listen); err != nil {
+			return fmt.Errorf("admin: invalid listen address %q: %w", cfg.Admin.Listen, err)
+		}
+	}
+
+	if _, err := template.New("trailer").Parse(cfg.Attribution.Trailer); err != nil {
+		return fmt.Errorf("attribution: %w", err)
+	}
+
+	if _, err := postprocess.CompileAll(cfg.PostProcess); err != nil {
+		return fmt.Errorf("post_process: %w", err)
+	}
+
+	if _, err := rewrite.CompileAll(cfg.Rewrites); err != nil {
+		return fmt.Errorf("rewrites: %w", err)
+	}
+
+	if _, err := signing.New(cfg.Signing); err != nil {
+		return err
+	}
+
+	for i, p := range cfg.Plugins {
+		if p.Path == "" {
+			return fmt.Errorf("plugins: entry %d has no path", i)
+		}
+		if _, err := os.Stat(p.Path); err != nil {
+			return fmt.Errorf("plugins: %w", err)
+		}
+		if p.MaxMemoryMB < 0 || p.Instances < 0 || p.Timeout < 0 {
+			return fmt.Errorf("plugins: %s has a negative limit", p.Path)
+		}
+	}
+
+	for i, sc := range cfg.Scripts {
+		if sc.Path == "" {
+			return fmt.Errorf("scripts: entry %d has no path", i)
+		}
+		if _, err := os.Stat(sc.Path); err != nil {
+			return fmt.Errorf("scripts: %w", err)
+		}
+		if sc.States < 0 || sc.Timeout < 0 {
+			return fmt.Errorf("scripts: %s has a negative limit", sc.Path)
+		}
+	}
+
+	for i, h := range cfg.Hooks {
+		if !slices.Contains(server.HookEvents, h.Event) {
+			return fmt.Errorf("hooks: entry %d has unknown event '%s' (want one of %s)", i, h.Event, strings.Join(server.HookEvents, ", "))
+		}
+		if strings.TrimSpace(h.Command) == "" {
+			return fmt.Errorf("hooks: entry %d has no command", i)
+		}
+		if len(h.Tags) > 0 && h.Event != "request_completed" {
+			return fmt.Errorf("hooks: entry %d: tags only apply to request_completed", i)
+		}
+	}
+
+	if cfg.Assist.Model != "" && !models.IsValidModel(cfg.Assist.Model) {
+		return fmt.Errorf("assist: model '%s' not found", cfg.Assist.Model)
+	}
+	if _, err := template.New("commit").Parse(cfg.Assist.CommitPrompt); err != nil {
+		return fmt.Errorf("assist: invalid commit_prompt: %w", err)
+	}
+	if _, err := template.New("pr").Parse(cfg.Assist.PRPrompt); err != nil {
+		return fmt.Errorf("assist: invalid pr_prompt: %w", err)
+	}
+
+	for name, profile := range cfg.Profiles {
+		if err := server.ValidateEnvironment(profile.Environment); err != nil {
+			return fmt.Errorf("profiles.%s.environment: %w", name, err)
+		}
+		if err := server.ValidateReasoning(profile.Reasoning); err != nil {
+			return fmt.Errorf("profiles.%s.reasoning: %w", name, err)
+		}
+	}
+
+	if err := server.ValidateThinking(cfg.Thinking); err != nil {
+		return fmt.Errorf("thinking: %w", err)
+	}
+
+	if err := server.ValidateCatalogViews(cfg); err != nil {
+		return fmt.Errorf("catalog_views: %w", err)
+	}
+
+	if cfg.Agent.Enabled {
+		if cfg.Agent.Model != "" && !models.IsValidModel(cfg.Agent.Model) {
+			return fmt.Errorf("agent: model '%s' not found", cfg.Agent.Model)
+		}
+		if cfg.Agent.MaxSteps < 1 {
+			return fmt.Errorf("agent: max_steps must be at least 1")
+		}
+		tools, err := agent.NewToolbox(server.AgentOptions(cfg.Agent))
+		if err != nil {
+			return fmt.Errorf("agent: %w", err)
+		}
+		if tools.Len() == 0 {
+			return fmt.Errorf("agent: no tools configured (set fetch, sandbox_dir, commands or tools)")
+		}
+	}
+
+	if cfg.Failover.OllamaURL != "" {
+		if u, err := url.Parse(cfg.Failover.OllamaURL); err != nil || u.Host == "" {
+			return fmt.Errorf("failover: invalid ollama_url %q", cfg.Failover.OllamaURL)
+		}
+		if cfg.Failover.Model == "" && len(cfg.Failover.Models) == 0 {
+			return fmt.Errorf("failover: model or models is required")
+		}
+		for cloud := range cfg.Failover.Models {
+			if !models.IsValidModel(cloud) {
+				return fmt.Errorf("failover: model '%s' not found", cloud)
+			}
+		}
+	}
+
+	for model, cc := range cfg.Canary {
+		if !models.IsValidModel(model) {
+			return fmt.Errorf("canary: model '%s' not found", model)
+		}
+		if !models.IsValidModel(cc.Model) {
+			return fmt.Errorf("canary: %s: model '%s' not found", model, cc.Model)
+		}
+		if models.GetCanonicalModelName(cc.Model) == models.GetCanonicalModelName(model) {
+			return fmt.Errorf("canary: %s: model must differ from the requested model", model)
+		}
+		if cc.Percent < 0 || cc.Percent > 100 {
+			return fmt.Errorf("canary: %s: percent must be between 0 and 100", model)
+		}
+	}
+
+	t := cfg.Transport
+	if t.DialTimeout < 0 || t.TLSHandshakeTimeout < 0 || t.ResponseHeaderTimeout < 0 || t.IdleConnTimeout < 0 {
+		return fmt.Errorf("transport: timeouts must not be negative")
+	}
+	if t.MaxIdleConnsPerHost < 0 || t.MaxConnsPerHost < 0 {
+		return fmt.Errorf("transport: connection limits must not be negative")
+	}
+
+	if cfg.Streams.MaxDuration < 0 || cfg.Streams.IdleTimeout < 0 {
+		return fmt.Errorf("streams: caps must not be negative")
+	}
+	if cfg.Broadcast.MaxBuffer < 0 || cfg.Broadcast.Linger < 0 {
+		return fmt.Errorf("broadcast: max_buffer and linger must not be negative")
+	}
+	if cfg.RequestLog.MaxAge < 0 {
+		return fmt.Errorf("request_log: max_age must not be negative")
+	}
+	if cfg.Cache.MaxEntries < 0 || cfg.Cache.TTL < 0 || cfg.Cache.MaxEntryBytes < 0 {
+		return fmt.Errorf("cache: max_entries, ttl and max_entry_bytes must not be negative")
+	}
+	if cfg.Retry.MaxAttempts < 0 || cfg.Retry.BaseDelay < 0 || cfg.Retry.MaxDelay < 0 {
+		return fmt.Errorf("retry: attempts and delays must not be negative")
+	}
+	if cfg.Retry.BaseDelay > 0 && cfg.Retry.MaxDelay > 0 && cfg.Retry.BaseDelay > cfg.Retry.MaxDelay {
+		return fmt.Errorf("retry: base_delay must not exceed max_delay")
+	}
+
+	for _, backup := range cfg.BackupBaseURLs {
+		if u, err := url.Parse(backup); err != nil || u.Host == "" {
+			return fmt.Errorf("backup_base_urls: invalid URL %q", backup)
+		}
+	}
+
+	for name, up := range cfg.Upstreams {
+		if up.BaseURL != "" {
+			if u, err := url.Parse(up.BaseURL); err != nil || u.Host == "" {
+				return fmt.Errorf("upstreams: %s: invalid base_url %q", name, up.BaseURL)
+			}
+		} else if len(up.BackupBaseURLs) > 0 {
+			return fmt.Errorf("upstreams: %s: backup_base_urls needs its own base_url", name)
+		}
+		for _, backup := range up.BackupBaseURLs {
+			if u, err := url.Parse(backup); err != nil || u.Host == "" {
+				return fmt.Errorf("upstreams: %s: invalid backup_base_urls entry %q", name, backup)
+			}
+		}
+		for model := range up.Models {
+			if !models.IsValidModel(model) {
+				return fmt.Errorf("upstreams: %s: model '%s' not found", name, model)
+			}
+		}
+	}
+
+	providers := make(map[string]bool)
+	routed := make(map[string]string)
+	for i, p := range cfg.Providers {
+		if p.Name == "" {
+			return fmt.Errorf("providers: provider %d: name is required", i)
+		}
+		if providers[strings.ToLower(p.Name)] {
+			return fmt.Errorf("providers: %s: listed twice", p.Name)
+		}
+		providers[strings.ToLower(p.Name)] = true
+		if u, err := url.Parse(p.BaseURL); err != nil || u.Host == "" {
+			return fmt.Errorf("providers: %s: invalid base_url %q", p.Name, p.BaseURL)
+		}
+		for _, backup := range p.BackupBaseURLs {
+			if u, err := url.Parse(backup); err != nil || u.Host == "" {
+				return fmt.Errorf("providers: %s: invalid backup_base_urls entry %q", p.Name, backup)
+			}
+		}
+		if len(p.Models) == 0 {
+			return fmt.Errorf("providers: %s: models must list at least one model", p.Name)
+		}
+		for _, model := range p.Models {
+			canonical := models.GetCanonicalModelName(model)
+			if other, ok := routed[canonical]; ok {
+				return fmt.Errorf("providers: %s: model '%s' is already served by %s", p.Name, model, other)
+			}
+			routed[canonical] = p.Name
+		}
+	}
+
+	for model, chain := range cfg.Fallbacks {
+		if !models.IsValidModel(model) {
+			return fmt.Errorf("fallbacks: model '%s' not found", model)
+		}
+		seen := map[string]bool{models.GetCanonicalModelName(model): true}
+		for _, fallback := range chain {
+			if !models.IsValidModel(fallback) {
+				return fmt.Errorf("fallbacks: %s: model '%s' not found", model, fallback)
+			}
+			if seen[models.GetCanonicalModelName(fallback)] {
+				return fmt.Errorf("fallbacks: %s: model '%s' appears twice in the chain", model, fallback)
+			}
+			seen[models.GetCanonicalModelName(fallback)] = true
+		}
+	}
+
+	if cfg.Trace.Enabled && (cfg.Trace.SampleRate < 0 || cfg.Trace.SampleRate > 1) {
+		return fmt.Errorf("trace: sample_rate must be between 0 and 1")
+	}
+	if cfg.Trace.Enabled && cfg.Trace.Retention <= 0 {
+		return fmt.Errorf("trace: retention must be positive")
+	}
+
+	if err := cfg.ResponseHeaders.OpenAI.Validate(); err != nil {
+		return fmt.Errorf("response_headers.openai: %w", err)
+	}
+	if err := cfg.ResponseHeaders.Ollama.Validate(); err != nil {
+		return fmt.Errorf("response_headers.ollama: %w", err)
+	}
+
+	for _, root := range cfg.GitContext.Roots {
+		if !filepath.IsAbs(root) {
+			return fmt.Errorf("git_context: root %q must be an absolute path", root)
+		}
+	}
+
+	return nil
+}
+
 // applyCLIOverrides applies CLI flag values to configuration
 func applyCLIOverrides(cmd *cobra.Command, cfg *config.Config) {
 	// Get debug flag (CLI flag overrides config)
@@ -119,48 +542,78 @@ func getServerConfig(cmd *cobra.Command, cfg *config.Config) (string, int) {
 	return host, port
 }
 
-// startServer starts the server in a goroutine and handles startup errors
-func startServer(srv *server.Server, cfg *config.Config, host string, port int) {
-	// Error channel to capture startup errors from goroutine
-	errChan := make(chan error, 1)
+// startServer binds the listen address in the main goroutine, so a port conflict is reported
+// before anything starts, then serves in a goroutine. Errors while serving arrive on the
+// returned channel.
+func startServer(srv *server.Server, cfg *config.Config, host string, port int) <-chan error {
+	if cfg.Verbose {
+		log.Printf("Starting server on %s:%d", host, port)
+		log.Printf("Base URL: %s", cfg.BaseURL)
+	}
+	port = listen(srv, host, port)
 
-	// Start server in a goroutine
+	errChan := make(chan error, 1)
 	go func() {
-		if cfg.Verbose {
-			log.Printf("Starting server on %s:%d", host, port)
-			log.Printf("Base URL: %s", cfg.BaseURL)
-		}
+		// A normal shutdown returns http.ErrServerClosed, which is not an error
 		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
-			// Send error to main goroutine instead of calling log.Fatalf
-			errChan <- fmt.Errorf("server failed to start: %w", err)
+			errChan <- err
 		}
-		// Note: when server shuts down normally, it returns http.ErrServerClosed
-		// which we ignore, and this goroutine exits. The main goroutine waits on quit channel.
 	}()
+	log.Printf("Server started successfully on %s:%d", host, port)
+	return errChan
+}
 
-	// Wait for interrupt signal or startup error
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
-	// Check for immediate startup errors with a small timeout
-	select {
-	case err := <-errChan:
-		// Server failed to start
+// listen binds host:port, or with --takeover the next free port after it when the port is
+// taken, and returns the port bound. Other failures, and conflicts without --takeover, are
+// fatal with the program holding the port named.
+func listen(srv *server.Server, host string, port int) int {
+	err := srv.Listen()
+	if err == nil {
+		return port
+	}
+	if !server.IsAddrInUse(err) {
 		log.Fatalf("FATAL: Server failed to start: %v", err)
-	case <-time.After(100 * time.Millisecond):
-		// Server appears to have started successfully
-		log.Printf("Server started successfully on %s:%d", host, port)
 	}
+
+	owner := server.DescribeListener(context.Background(), host, port)
+	if !takeover {
+		msg := i18n.Sprintf("Port %d is already in use by %s. Stop it, choose another port with --port, or start with --takeover to use the next free port.", port, owner)
+		if strings.HasPrefix(owner, "Ollama") {
+			msg += " " + i18n.Sprintf("To keep Ollama, run it on another port: OLLAMA_HOST=127.0.0.1:%d ollama serve", port+1)
+		}
+		log.Fatal("FATAL: " + msg)
+	}
+
+	for next := port + 1; next <= port+takeoverPorts && next <= 65535; next++ {
+		srv.SetAddr(host, next)
+		err := srv.Listen()
+		if err == nil {
+			log.Printf("WARNING: %s", i18n.Sprintf("Port %d is in use by %s; listening on port %d instead. Point clients at it with:", port, owner, next))
+			for _, setting := range server.ClientSettings(host, next) {
+				log.Printf("  %s", setting)
+			}
+			log.Printf("%s", i18n.Sprintf("To keep this port, run 'copilot-proxy config set port %d'.", next))
+			return next
+		}
+		if !server.IsAddrInUse(err) {
+			log.Fatalf("FATAL: Server failed to start: %v", err)
+		}
+	}
+	log.Fatal("FATAL: " + i18n.Sprintf("Port %d is in use by %s, and so are the %d ports after it.", port, owner, takeoverPorts))
+	return 0
 }
 
-// waitForShutdown waits for shutdown signal and gracefully shuts down the server
-func waitForShutdown(srv *server.Server) {
-	// Wait for interrupt signal or startup error
+// waitForShutdown waits for a shutdown signal and gracefully shuts down the server. A server
+// that fails while serving ends the process instead.
+func waitForShutdown(srv *server.Server, serveErr <-chan error) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	// Now wait for shutdown signal
-	<-quit
+	select {
+	case <-quit:
+	case err := <-serveErr:
+		log.Fatalf("FATAL: Server failed: %v", err)
+	}
 	log.Printf("Shutting down server (PID: %d)...", os.Getpid())
 
 	// Create a deadline for graceful shutdown
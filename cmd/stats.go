@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/requestlog"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize logged requests by day and model",
+	Long: `Summarize the request log (request_log in the config file) by UTC day and model:
+requests, errors, tokens and latency. The log can be read while a server is
+writing to it.
+
+--since and --until take a date (2026-03-01), a time (2026-03-01T15:04:05Z) or an
+age such as 36h or 7d.`,
+	Args: cobra.NoArgs,
+	Run:  runStats,
+}
+
+var (
+	statsSince  string
+	statsUntil  string
+	statsModel  string
+	statsClient string
+	statsJSON   bool
+)
+
+func init() {
+	statsCmd.Flags().StringVar(&statsSince, "since", "7d", "Start of the period")
+	statsCmd.Flags().StringVar(&statsUntil, "until", "", "End of the period (default now)")
+	statsCmd.Flags().StringVar(&statsModel, "model", "", "Only this model")
+	statsCmd.Flags().StringVar(&statsClient, "client", "", "Only this client")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Print JSON instead of a table")
+	rootCmd.AddCommand(statsCmd)
+}
+
+func runStats(cmd *cobra.Command, args []string) {
+	db := openRequestLog()
+	defer db.Close()
+
+	filter := requestlog.Filter{Model: statsModel, Client: statsClient}
+	filter.Since, filter.Until = parsePeriod(statsSince, statsUntil)
+	summaries, err := requestlog.Stats(cmd.Context(), db, filter)
+	if err != nil {
+		log.Fatalf("Failed to read request log: %v", err)
+	}
+
+	if statsJSON {
+		printJSON(summaries)
+		return
+	}
+	if len(summaries) == 0 {
+		fmt.Println("No requests logged in this period")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "DAY\tMODEL\tREQUESTS\tERRORS\tPROMPT TOKENS\tCOMPLETION TOKENS\tAVG LATENCY\tMAX LATENCY\t")
+	var total requestlog.Summary
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t\n", s.Day, s.Model, s.Requests, s.Errors, s.PromptTokens,
+			s.CompletionTokens, msDuration(s.AvgLatencyMS), msDuration(float64(s.MaxLatencyMS)))
+		total.Requests += s.Requests
+		total.Errors += s.Errors
+		total.PromptTokens += s.PromptTokens
+		total.CompletionTokens += s.CompletionTokens
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t%d\t%d\t\t\t\n", total.Requests, total.Errors, total.PromptTokens, total.CompletionTokens)
+	w.Flush()
+}
+
+// openRequestLog opens the configured request log for reading
+func openRequestLog() *sql.DB {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	path, err := cfg.RequestLog.DBPath()
+	if err != nil {
+		log.Fatalf("Failed to locate request log: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("No request log at %s; set request_log.enabled in the config file and restart the server", path)
+	}
+	db, err := requestlog.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open request log: %v", err)
+	}
+	return db
+}
+
+// parsePeriod parses the --since and --until flags; empty values are unbounded
+func parsePeriod(since, until string) (time.Time, time.Time) {
+	var start, end time.Time
+	var err error
+	if since != "" {
+		if start, err = parseSince(since, time.Now()); err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+	}
+	if until != "" {
+		if end, err = parseSince(until, time.Now()); err != nil {
+			log.Fatalf("Invalid --until: %v", err)
+		}
+	}
+	return start, end
+}
+
+// parseSince reads a date, an RFC 3339 time, or an age before now such as 36h or 7d
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, time or age such as 7d", s)
+}
+
+// msDuration formats milliseconds for a table
+func msDuration(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
+
+// printJSON writes v as indented JSON
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Failed to write JSON: %v", err)
+	}
+}
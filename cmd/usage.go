@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show cumulative usage per model",
+	Long: `Show the requests, tokens and bytes relayed per model since usage was first recorded.
+Counters are read from the metrics state file, which a running server saves
+every metrics.flush_interval and on shutdown.`,
+	Args: cobra.NoArgs,
+	Run:  runUsage,
+}
+
+var exportMonth string
+
+var usageExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write monthly usage reports now",
+	Long: `Write the usage report of one month for every configured tenant, uploading it
+when an S3 bucket is configured, as the scheduled export does. Reports are built
+from the usage ledger (usage.ledger in the config file).`,
+	Args: cobra.NoArgs,
+	Run:  runUsageExport,
+}
+
+func init() {
+	usageExportCmd.Flags().StringVar(&exportMonth, "month", "", "Month to export as YYYY-MM (default: previous month)")
+	usageCmd.AddCommand(usageExportCmd)
+	rootCmd.AddCommand(usageCmd)
+}
+
+func runUsageExport(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	month := time.Now().UTC().AddDate(0, -1, 0)
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if exportMonth != "" {
+		if month, err = time.Parse("2006-01", exportMonth); err != nil {
+			log.Fatalf("Invalid month %q: use YYYY-MM", exportMonth)
+		}
+	}
+
+	ledgerDir, err := cfg.Usage.DirPath()
+	if err != nil {
+		log.Fatalf("Failed to locate usage ledger: %v", err)
+	}
+	outputDir, err := cfg.Usage.Export.DirPath()
+	if err != nil {
+		log.Fatalf("Failed to locate export directory: %v", err)
+	}
+
+	// The schedule is irrelevant for a manual export
+	exportCfg := cfg.Usage.Export
+	exportCfg.Schedule = "@monthly"
+	exporter, err := usage.NewExporter(exportCfg, ledgerDir, outputDir, clock.Real{})
+	if err != nil {
+		log.Fatalf("Invalid usage export configuration: %v", err)
+	}
+
+	files, err := exporter.Export(cmd.Context(), month)
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if err != nil {
+		log.Fatalf("Usage export failed: %v", err)
+	}
+}
+
+// modelUsage aggregates the persisted counters of one model
+type modelUsage struct {
+	requests   float64
+	errors     float64
+	prompt     float64
+	completion float64
+	sent       float64 // Request body bytes
+	received   float64 // Response body bytes
+}
+
+func runUsage(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	loadCatalog(cfg)
+
+	path, err := cfg.Metrics.StatePath()
+	if err != nil {
+		log.Fatalf("Failed to locate metrics state: %v", err)
+	}
+	snap, err := metrics.LoadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read metrics state: %v", err)
+	}
+
+	usage := make(map[string]*modelUsage)
+	get := func(model string) *modelUsage {
+		if usage[model] == nil {
+			usage[model] = &modelUsage{}
+		}
+		return usage[model]
+	}
+	for _, s := range snap.Counters["copilot_proxy_requests_total"] {
+		u := get(s.Labels["model"])
+		u.requests += s.Value
+		if status, _ := strconv.Atoi(s.Labels["status"]); status >= 400 {
+			u.errors += s.Value
+		}
+	}
+	for _, s := range snap.Counters["copilot_proxy_tokens_total"] {
+		u := get(s.Labels["model"])
+		switch s.Labels["type"] {
+		case "prompt":
+			u.prompt += s.Value
+		case "completion":
+			u.completion += s.Value
+		}
+	}
+
+	for _, s := range snap.Counters["copilot_proxy_bytes_total"] {
+		u := get(s.Labels["model"])
+		switch s.Labels["direction"] {
+		case "request":
+			u.sent += s.Value
+		case "response":
+			u.received += s.Value
+		}
+	}
+
+	if len(usage) == 0 {
+		fmt.Printf("No usage recorded yet (%s)\n", path)
+		return
+	}
+
+	names := make([]string, 0, len(usage))
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tREQUESTS\tERRORS\tPROMPT TOKENS\tCOMPLETION TOKENS\tREQUEST BYTES\tRESPONSE BYTES\tEST. COST (USD)\t")
+	var total modelUsage
+	var totalCost float64
+	for _, name := range names {
+		u := usage[name]
+		cost := 0.0
+		if m, ok := models.GetModel(name); ok {
+			cost = m.Cost(int(u.prompt), int(u.completion))
+		}
+		fmt.Fprintf(w, "%s\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.4f\t\n", name, u.requests, u.errors, u.prompt, u.completion, u.sent, u.received, cost)
+
+		total.requests += u.requests
+		total.errors += u.errors
+		total.prompt += u.prompt
+		total.completion += u.completion
+		total.sent += u.sent
+		total.received += u.received
+		totalCost += cost
+	}
+	fmt.Fprintf(w, "TOTAL\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.4f\t\n", total.requests, total.errors, total.prompt, total.completion, total.sent, total.received, totalCost)
+	w.Flush()
+
+	fmt.Printf("\nLast saved %s (%s)\n", snap.SavedAt.Local().Format("2006-01-02 15:04:05"), path)
+}
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Executor types of declared tools
+const (
+	ExecFetch    = "fetch"     // HTTP GET; the allowlist holds host globs
+	ExecReadFile = "read_file" // Read inside the sandbox; the allowlist holds path globs
+	ExecCommand  = "command"   // Run a program in the sandbox; the allowlist holds program names
+)
+
+// Executors lists the executor types in documentation order
+var Executors = []string{ExecFetch, ExecReadFile, ExecCommand}
+
+// toolNamePattern is the function name format chat APIs accept
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// schemaTypes are the JSON Schema type names
+var schemaTypes = []string{"string", "number", "integer", "boolean", "array", "object", "null"}
+
+// Spec declares a tool: what the model is told about it and which executor runs it
+type Spec struct {
+	Name        string
+	Description string         // Defaults to the executor's description
+	Parameters  map[string]any // JSON Schema of the arguments; defaults to the executor's
+	Executor    string         // fetch, read_file or command
+	Timeout     time.Duration  // Overrides the toolbox timeout
+	Allowlist   []string       // Hosts, paths or programs the executor may use
+	Guard       string         // Overrides the toolbox guard policy
+}
+
+// newTool validates a declaration and creates its tool
+func newTool(spec Spec, root string, dialer *net.Dialer, maxBytes int) (*Tool, error) {
+	if !toolNamePattern.MatchString(spec.Name) {
+		return nil, fmt.Errorf("name must be 1-64 letters, digits, '_' or '-'")
+	}
+	if spec.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	if spec.Guard != "" {
+		if err := checkGuardPolicy(spec.Guard); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range spec.Allowlist {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return nil, fmt.Errorf("invalid allowlist entry %q", p)
+		}
+	}
+
+	var t *Tool
+	var needs string // The argument the executor cannot run without
+	switch spec.Executor {
+	case ExecFetch:
+		t, needs = fetchTool(dialer, maxBytes, spec.Allowlist), "url"
+	case ExecReadFile:
+		if root == "" {
+			return nil, fmt.Errorf("executor %s requires sandbox_dir", spec.Executor)
+		}
+		t, needs = readFileTool(root, maxBytes, spec.Allowlist), "path"
+	case ExecCommand:
+		if root == "" {
+			return nil, fmt.Errorf("executor %s requires sandbox_dir", spec.Executor)
+		}
+		if len(spec.Allowlist) == 0 {
+			return nil, fmt.Errorf("executor %s requires an allowlist of programs", spec.Executor)
+		}
+		t = commandTool(spec.Allowlist, root)
+		if len(spec.Allowlist) > 1 {
+			needs = "command"
+		}
+	case "":
+		return nil, fmt.Errorf("executor is required (use %s)", strings.Join(Executors, ", "))
+	default:
+		return nil, fmt.Errorf("unknown executor '%s' (use %s)", spec.Executor, strings.Join(Executors, ", "))
+	}
+
+	t.Name = spec.Name
+	t.timeout = spec.Timeout
+	t.guard = spec.Guard
+	if spec.Description != "" {
+		t.Description = spec.Description
+	}
+	if spec.Parameters != nil {
+		if err := validateParameters(spec.Parameters, needs); err != nil {
+			return nil, fmt.Errorf("parameters: %w", err)
+		}
+		t.Parameters = spec.Parameters
+	}
+	return t, nil
+}
+
+// validateParameters checks that a declared schema describes an arguments object and declares
+// the string argument the executor needs
+func validateParameters(schema map[string]any, needs string) error {
+	if schema["type"] != "object" {
+		return fmt.Errorf("type must be \"object\"")
+	}
+	props, ok := schema["properties"].(map[string]any)
+	if !ok && schema["properties"] != nil {
+		return fmt.Errorf("properties must be an object")
+	}
+	for name, p := range props {
+		prop, ok := p.(map[string]any)
+		if !ok {
+			return fmt.Errorf("property '%s' must be an object", name)
+		}
+		if err := validateType(prop["type"]); err != nil {
+			return fmt.Errorf("property '%s': %w", name, err)
+		}
+		if enum, ok := prop["enum"]; ok {
+			if list, ok := enum.([]any); !ok || len(list) == 0 {
+				return fmt.Errorf("property '%s': enum must be a non-empty list", name)
+			}
+		}
+	}
+
+	required, ok := schema["required"].([]any)
+	if !ok && schema["required"] != nil {
+		return fmt.Errorf("required must be a list")
+	}
+	for _, r := range required {
+		name, ok := r.(string)
+		if !ok {
+			return fmt.Errorf("required must list property names")
+		}
+		if _, ok := props[name]; !ok {
+			return fmt.Errorf("required property '%s' is not declared", name)
+		}
+	}
+
+	if needs != "" {
+		prop, _ := props[needs].(map[string]any)
+		if prop == nil || prop["type"] != "string" || !slices.Contains(required, any(needs)) {
+			return fmt.Errorf("the executor needs a required string property '%s'", needs)
+		}
+	}
+	return nil
+}
+
+// validateType checks a schema's type keyword, which may be absent, a name or a list of names
+func validateType(t any) error {
+	if t == nil {
+		return nil
+	}
+	names := []any{t}
+	if list, ok := t.([]any); ok {
+		names = list
+	}
+	for _, n := range names {
+		if s, ok := n.(string); !ok || !slices.Contains(schemaTypes, s) {
+			return fmt.Errorf("unknown type %v (use %s)", n, strings.Join(schemaTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// checkArgs checks a call's arguments against the top level of a tool's schema: required
+// arguments are present and declared ones have the right type and value
+func checkArgs(schema map[string]any, args map[string]any) error {
+	required, _ := schema["required"].([]any)
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, ok := args[name]; !ok {
+				return fmt.Errorf("argument '%s' is required", name)
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+	for name, v := range args {
+		prop, ok := props[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		if t := prop["type"]; t != nil {
+			allowed, ok := t.([]any)
+			if !ok {
+				allowed = []any{t}
+			}
+			got := jsonType(v)
+			if !slices.Contains(allowed, any(got)) && !(got == "integer" && slices.Contains(allowed, any("number"))) {
+				return fmt.Errorf("argument '%s' must be of type %v", name, t)
+			}
+		}
+		// Lists and objects cannot be compared to enum values
+		if enum, ok := prop["enum"].([]any); ok && isScalar(v) && !slices.Contains(enum, v) {
+			return fmt.Errorf("argument '%s' must be one of %v", name, enum)
+		}
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// isScalar reports whether a decoded JSON value is comparable with ==
+func isScalar(v any) bool {
+	switch v.(type) {
+	case []any, map[string]any:
+		return false
+	}
+	return true
+}
+
+// matchAny reports whether name matches one of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecValidation(t *testing.T) {
+	root := t.TempDir()
+	urlSchema := func(required ...any) map[string]any {
+		return map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"url": map[string]any{"type": "string"}, "n": map[string]any{"type": "integer"}},
+			"required":   required,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		specs []Spec
+		want  string
+	}{
+		{"valid", []Spec{
+			{Name: "docs", Executor: ExecFetch, Allowlist: []string{"*.go.dev"}, Parameters: urlSchema("url")},
+			{Name: "notes", Executor: ExecReadFile, Allowlist: []string{"notes/*.md"}},
+			{Name: "tests", Executor: ExecCommand, Allowlist: []string{"go"}},
+		}, ""},
+		{"missing name", []Spec{{Executor: ExecFetch}}, "tool 0: name must be 1-64 letters, digits, '_' or '-'"},
+		{"bad name", []Spec{{Name: "read file", Executor: ExecFetch}}, "tool 'read file': name must be 1-64 letters, digits, '_' or '-'"},
+		{"duplicate", []Spec{{Name: "a", Executor: ExecFetch}, {Name: "a", Executor: ExecFetch}}, "tool 'a' is declared twice"},
+		{"missing executor", []Spec{{Name: "a"}}, "tool 'a': executor is required (use fetch, read_file, command)"},
+		{"unknown executor", []Spec{{Name: "a", Executor: "shell"}}, "tool 'a': unknown executor 'shell' (use fetch, read_file, command)"},
+		{"command without allowlist", []Spec{{Name: "a", Executor: ExecCommand}}, "tool 'a': executor command requires an allowlist of programs"},
+		{"bad glob", []Spec{{Name: "a", Executor: ExecFetch, Allowlist: []string{"[x"}}}, `tool 'a': invalid allowlist entry "[x"`},
+		{"negative timeout", []Spec{{Name: "a", Executor: ExecFetch, Timeout: -1}}, "tool 'a': timeout must not be negative"},
+		{"not an object", []Spec{{Name: "a", Executor: ExecFetch, Parameters: map[string]any{"type": "string"}}},
+			`tool 'a': parameters: type must be "object"`},
+		{"unknown type", []Spec{{Name: "a", Executor: ExecFetch, Parameters: map[string]any{
+			"type": "object", "properties": map[string]any{"url": map[string]any{"type": "text"}},
+		}}}, "tool 'a': parameters: property 'url': unknown type text (use string, number, integer, boolean, array, object, null)"},
+		{"undeclared required", []Spec{{Name: "a", Executor: ExecFetch, Parameters: urlSchema("url", "depth")}},
+			"tool 'a': parameters: required property 'depth' is not declared"},
+		{"executor argument optional", []Spec{{Name: "a", Executor: ExecFetch, Parameters: urlSchema()}},
+			"tool 'a': parameters: the executor needs a required string property 'url'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewToolbox(Options{SandboxDir: root, Tools: tt.specs})
+			if tt.want == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.want)
+			}
+		})
+	}
+
+	_, err := NewToolbox(Options{Tools: []Spec{{Name: "a", Executor: ExecReadFile}}})
+	assert.EqualError(t, err, "tool 'a': executor read_file requires sandbox_dir")
+}
+
+func TestDeclaredTools(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost/elsewhere", http.StatusFound)
+	}))
+	defer site.Close()
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "notes"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes", "todo.md"), []byte("ship it"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secrets.env"), []byte("KEY=1"), 0644))
+
+	tb, err := NewToolbox(Options{SandboxDir: root, AllowPrivate: true, Tools: []Spec{
+		{Name: "local", Description: "Local pages", Executor: ExecFetch, Allowlist: []string{"127.0.0.1"}},
+		{Name: "notes", Executor: ExecReadFile, Allowlist: []string{"notes", "notes/*.md"}, Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"path": map[string]any{"type": "string", "enum": []any{"notes", "notes/todo.md"}}},
+			"required":   []any{"path"},
+		}},
+	}})
+	require.NoError(t, err)
+
+	// Declaring tools replaces the implicit read_file
+	defs := tb.Definitions()
+	require.Len(t, defs, 2)
+	assert.Equal(t, "Local pages", defs[0].(map[string]any)["function"].(map[string]any)["description"])
+	ctx := context.Background()
+
+	res, err := tb.Call(ctx, "notes", `{"path": "notes/todo.md"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "ship it", res.Output)
+
+	_, err = tb.Call(ctx, "notes", `{"path": "secrets.env"}`)
+	assert.EqualError(t, err, "argument 'path' must be one of [notes notes/todo.md]")
+	_, err = tb.Call(ctx, "notes", `{"path": 3}`)
+	assert.EqualError(t, err, "argument 'path' must be of type string")
+
+	// Allowlists are enforced by the executor as well as by the schema
+	_, err = tb.Call(ctx, "local", `{"url": "http://localhost/"}`)
+	assert.EqualError(t, err, "host 'localhost' is not allowed")
+	_, err = tb.Call(ctx, "local", `{"url": "`+site.URL+`"}`)
+	assert.ErrorContains(t, err, "redirect to host 'localhost' is not allowed")
+
+	tb, err = NewToolbox(Options{SandboxDir: root, Tools: []Spec{{Name: "notes", Executor: ExecReadFile, Allowlist: []string{"notes/*.md"}}}})
+	require.NoError(t, err)
+	_, err = tb.Call(ctx, "notes", `{"path": "secrets.env"}`)
+	assert.EqualError(t, err, "secrets.env is not allowed")
+}
+
+func TestCheckArgs(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"n":     map[string]any{"type": "number"},
+			"count": map[string]any{"type": "integer"},
+			"tags":  map[string]any{"type": []any{"array", "null"}},
+		},
+		"required": []any{"n"},
+	}
+	assert.NoError(t, checkArgs(schema, map[string]any{"n": 1.5, "count": 2.0, "tags": []any{"a"}, "other": true}))
+	assert.NoError(t, checkArgs(schema, map[string]any{"n": 2.0, "tags": nil}))
+	assert.EqualError(t, checkArgs(schema, map[string]any{}), "argument 'n' is required")
+	assert.EqualError(t, checkArgs(schema, map[string]any{"n": 1.0, "count": 1.5}), "argument 'count' must be of type integer")
+	assert.EqualError(t, checkArgs(schema, map[string]any{"n": "1"}), "argument 'n' must be of type number")
+}
@@ -0,0 +1,443 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chew-z/copilot-proxy/internal/gitctx"
+	"github.com/chew-z/copilot-proxy/internal/netguard"
+)
+
+// Tool is a capability the proxy executes on the model's behalf
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON Schema of the arguments object
+	timeout     time.Duration  // Overrides the toolbox timeout
+	guard       string         // Overrides the toolbox guard policy
+	run         func(ctx context.Context, args map[string]any) (string, error)
+}
+
+// Definition returns the tool in the OpenAI function tool format
+func (t *Tool) Definition() map[string]any {
+	return map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		},
+	}
+}
+
+// Options configures a Toolbox; a zero value offers no tools
+type Options struct {
+	Fetch      bool          // Offer http_fetch
+	Commands   []string      // Programs run_command may start; empty disables it
+	SandboxDir string        // Root of read_file tools and working directory of commands
+	Timeout    time.Duration // Per tool call
+	MaxOutput  int           // Bytes of a tool result returned to the model
+	Tools      []Spec        // Declared tools; when present, SandboxDir no longer implies read_file
+
+	AllowPrivate bool // Let fetch tools reach loopback and private addresses
+
+	Guard         string   // Policy for output that looks like a prompt injection (default warn)
+	GuardPatterns []string // Extra regular expressions the guard looks for
+}
+
+// Toolbox holds the tools offered to the model and executes its calls
+type Toolbox struct {
+	tools     []*Tool
+	timeout   time.Duration
+	maxOutput int
+	guard     *guard
+}
+
+// Result is the outcome of a tool call
+type Result struct {
+	Output   string    // Raw output, cut to the output limit
+	Content  string    // The output as fed back to the model: sanitized, delimited and possibly stripped
+	Findings []Finding // Suspected prompt injections in the output
+}
+
+// NewToolbox creates the built-in and declared tools, validating the declarations; zero limits
+// take their defaults
+func NewToolbox(opts Options) (*Toolbox, error) {
+	tb := &Toolbox{timeout: opts.Timeout, maxOutput: opts.MaxOutput}
+	if tb.timeout <= 0 {
+		tb.timeout = 30 * time.Second
+	}
+	if tb.maxOutput <= 0 {
+		tb.maxOutput = 16000
+	}
+	g, err := newGuard(opts.Guard, opts.GuardPatterns)
+	if err != nil {
+		return nil, err
+	}
+	tb.guard = g
+
+	root := opts.SandboxDir
+	if root != "" {
+		if !filepath.IsAbs(root) {
+			return nil, fmt.Errorf("sandbox_dir %q must be an absolute path", root)
+		}
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox_dir: %w", err)
+		}
+		root = resolved
+	}
+
+	// The built-in tools are shorthands for declarations
+	var specs []Spec
+	if opts.Fetch {
+		specs = append(specs, Spec{Name: "http_fetch", Executor: ExecFetch})
+	}
+	if root != "" && len(opts.Tools) == 0 {
+		specs = append(specs, Spec{Name: "read_file", Executor: ExecReadFile})
+	}
+	if len(opts.Commands) > 0 {
+		specs = append(specs, Spec{Name: "run_command", Executor: ExecCommand, Allowlist: opts.Commands})
+	}
+	specs = append(specs, opts.Tools...)
+
+	dialer := &net.Dialer{Timeout: tb.timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = netguard.PublicOnly
+	}
+	for i, spec := range specs {
+		t, err := newTool(spec, root, dialer, tb.maxOutput)
+		if err != nil {
+			if spec.Name == "" {
+				return nil, fmt.Errorf("tool %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("tool '%s': %w", spec.Name, err)
+		}
+		if slices.ContainsFunc(tb.tools, func(other *Tool) bool { return other.Name == t.Name }) {
+			return nil, fmt.Errorf("tool '%s' is declared twice", t.Name)
+		}
+		tb.tools = append(tb.tools, t)
+	}
+	return tb, nil
+}
+
+// Len returns the number of tools offered
+func (tb *Toolbox) Len() int {
+	return len(tb.tools)
+}
+
+// Definitions returns the tools in the OpenAI function tool format
+func (tb *Toolbox) Definitions() []any {
+	defs := make([]any, len(tb.tools))
+	for i, t := range tb.tools {
+		defs[i] = t.Definition()
+	}
+	return defs
+}
+
+// Call executes one tool call. arguments is the JSON object the model produced. The output is
+// cut to the output limit and passed through the guard. Errors are meant to be shown to the
+// model so it can correct itself, except an InjectionError, which should end the run.
+func (tb *Toolbox) Call(ctx context.Context, name, arguments string) (Result, error) {
+	i := slices.IndexFunc(tb.tools, func(t *Tool) bool { return t.Name == name })
+	if i < 0 {
+		return Result{}, fmt.Errorf("unknown tool '%s'", name)
+	}
+	t := tb.tools[i]
+
+	args := map[string]any{}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return Result{}, fmt.Errorf("arguments are not a JSON object: %v", err)
+		}
+	}
+	if err := checkArgs(t.Parameters, args); err != nil {
+		return Result{}, err
+	}
+
+	timeout := tb.timeout
+	if t.timeout > 0 {
+		timeout = t.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := t.run(ctx, args)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	res := Result{Output: truncate(out, tb.maxOutput)}
+	if err != nil {
+		return res, err
+	}
+
+	policy := tb.guard.policy
+	if t.guard != "" {
+		policy = t.guard
+	}
+	res.Content, res.Findings, err = tb.guard.apply(policy, t.Name, res.Output)
+	return res, err
+}
+
+// truncate cuts text to max bytes and notes how much was left out
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	return fmt.Sprintf("%s\n[truncated %d bytes]", strings.ToValidUTF8(text[:max], ""), len(text)-max)
+}
+
+// stringArg returns a required string argument
+func stringArg(args map[string]any, name string) (string, error) {
+	v, ok := args[name].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("argument '%s' is required", name)
+	}
+	return v, nil
+}
+
+// fetchTool retrieves a URL on the public internet. A non-empty allowlist limits the hosts it
+// may reach, redirects included.
+func fetchTool(dialer *net.Dialer, maxBytes int, hosts []string) *Tool {
+	// No proxy: a proxy would dial the target itself, bypassing the dialer's address check
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if len(hosts) > 0 && !matchAny(hosts, req.URL.Hostname()) {
+				return fmt.Errorf("redirect to host '%s' is not allowed", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+	return &Tool{
+		Name:        "http_fetch",
+		Description: "Fetch a web page or API response with an HTTP GET request and return its status and body.",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"url": map[string]any{"type": "string", "description": "Absolute http or https URL"}},
+			"required":   []any{"url"},
+		},
+		run: func(ctx context.Context, args map[string]any) (string, error) {
+			url, err := stringArg(args, "url")
+			if err != nil {
+				return "", err
+			}
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				return "", fmt.Errorf("only http and https URLs can be fetched")
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return "", err
+			}
+			if len(hosts) > 0 && !matchAny(hosts, req.URL.Hostname()) {
+				return "", fmt.Errorf("host '%s' is not allowed", req.URL.Hostname())
+			}
+			req.Header.Set("User-Agent", "copilot-proxy agent")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			// Read one byte past the limit so truncation is reported
+			body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("HTTP %s\nContent-Type: %s\n\n%s", resp.Status, resp.Header.Get("Content-Type"), body), nil
+		},
+	}
+}
+
+// readFileTool reads a file, or lists a directory, inside the sandbox directory. A non-empty
+// allowlist holds globs the workspace-relative path must match.
+func readFileTool(root string, maxBytes int, patterns []string) *Tool {
+	return &Tool{
+		Name:        "read_file",
+		Description: "Read a text file, or list a directory, in the workspace. Paths are relative to the workspace root.",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"path": map[string]any{"type": "string", "description": "Workspace-relative path; \".\" is the root"}},
+			"required":   []any{"path"},
+		},
+		run: func(ctx context.Context, args map[string]any) (string, error) {
+			rel, err := stringArg(args, "path")
+			if err != nil {
+				return "", err
+			}
+			// Checked before and after resolving symlinks, so nothing outside is even probed
+			path := filepath.Join(root, filepath.FromSlash(rel))
+			if !gitctx.Within(root, path) {
+				return "", fmt.Errorf("%s is outside the workspace", rel)
+			}
+			if clean, _ := filepath.Rel(root, path); len(patterns) > 0 && !matchAny(patterns, filepath.ToSlash(clean)) {
+				return "", fmt.Errorf("%s is not allowed", rel)
+			}
+			path, err = filepath.EvalSymlinks(path)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return "", fmt.Errorf("%s does not exist", rel)
+				}
+				return "", err
+			}
+			if !gitctx.Within(root, path) {
+				return "", fmt.Errorf("%s is outside the workspace", rel)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			if info.IsDir() {
+				entries, err := os.ReadDir(path)
+				if err != nil {
+					return "", err
+				}
+				var list strings.Builder
+				for _, e := range entries {
+					list.WriteString(e.Name())
+					if e.IsDir() {
+						list.WriteByte('/')
+					}
+					list.WriteByte('\n')
+				}
+				return list.String(), nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			data, err := io.ReadAll(io.LimitReader(f, int64(maxBytes)+1))
+			if err != nil {
+				return "", err
+			}
+			if bytes.IndexByte(data, 0) >= 0 {
+				return "", fmt.Errorf("%s is a binary file", rel)
+			}
+			return string(data), nil
+		},
+	}
+}
+
+// commandTool runs an allowlisted program without a shell in the sandbox directory. The
+// environment is reduced to a few variables so credentials the proxy holds are not exposed,
+// and arguments naming absolute paths or leaving the directory with ".." are refused. That
+// does not contain the programs themselves: allowlisting one whose options run other commands
+// or read arbitrary files (find -exec, git -c core.pager=..., sh -c) hands the model that power.
+// With a single allowed program the command argument may be left out.
+func commandTool(allowed []string, dir string) *Tool {
+	required := []any{"command"}
+	if len(allowed) == 1 {
+		required = []any{}
+	}
+	return &Tool{
+		Name:        "run_command",
+		Description: "Run a program in the workspace and return its combined output. Allowed programs: " + strings.Join(allowed, ", ") + ".",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "enum": toAny(allowed)},
+				"args":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": required,
+		},
+		run: func(ctx context.Context, args map[string]any) (string, error) {
+			name, _ := args["command"].(string)
+			if name == "" && len(allowed) == 1 {
+				name = allowed[0]
+			}
+			if name == "" {
+				return "", fmt.Errorf("argument 'command' is required")
+			}
+			if !slices.Contains(allowed, name) {
+				return "", fmt.Errorf("command '%s' is not allowed", name)
+			}
+			var argv []string
+			if list, ok := args["args"].([]any); ok {
+				for _, a := range list {
+					s, ok := a.(string)
+					if !ok {
+						return "", fmt.Errorf("args must be strings")
+					}
+					if escapesDir(s) {
+						return "", fmt.Errorf("argument %q leaves the workspace", s)
+					}
+					argv = append(argv, s)
+				}
+			}
+
+			cmd := exec.CommandContext(ctx, name, argv...)
+			cmd.Dir = dir
+			cmd.Env = commandEnv()
+			cmd.WaitDelay = time.Second
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && ctx.Err() == nil {
+				// A failing program is a normal result the model should see
+				return fmt.Sprintf("%s\n[exit status %d]", out, exitErr.ExitCode()), nil
+			}
+			return string(out), err
+		},
+	}
+}
+
+// escapesDir reports whether a command argument is an absolute or home-relative path or has a
+// ".." element. Values attached to flags are checked too: --flag=value, and whatever follows a
+// flag's letters, as in -f/etc/passwd, -xf/etc or -o../out.
+func escapesDir(arg string) bool {
+	values := []string{arg}
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		values = append(values, arg[i+1:])
+	}
+	if strings.HasPrefix(arg, "-") {
+		values = append(values, strings.TrimLeftFunc(strings.TrimLeft(arg, "-"), unicode.IsLetter))
+	}
+	for _, v := range values {
+		if filepath.IsAbs(v) || strings.HasPrefix(v, "/") || strings.HasPrefix(v, `\`) || strings.HasPrefix(v, "~") {
+			return true
+		}
+		if slices.Contains(strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }), "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// commandEnv is the environment commands get
+func commandEnv() []string {
+	var env []string
+	for _, name := range []string{"PATH", "HOME", "LANG", "TMPDIR", "SYSTEMROOT"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// toAny converts strings for use in a JSON Schema
+func toAny(list []string) []any {
+	out := make([]any, len(list))
+	for i, s := range list {
+		out[i] = s
+	}
+	return out
+}
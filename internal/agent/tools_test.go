@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/netguard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolbox(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "notes.md"), []byte("hello agent"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "big.txt"), []byte(strings.Repeat("x", 100)), 0644))
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link.txt")))
+
+	tb, err := NewToolbox(Options{SandboxDir: root, MaxOutput: 50})
+	require.NoError(t, err)
+	require.Equal(t, 1, tb.Len())
+	ctx := context.Background()
+
+	res, err := tb.Call(ctx, "read_file", `{"path": "docs/notes.md"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "hello agent", res.Output)
+
+	res, err = tb.Call(ctx, "read_file", `{"path": "."}`)
+	require.NoError(t, err)
+	assert.Equal(t, "big.txt\ndocs/\nlink.txt\n", res.Output)
+
+	res, err = tb.Call(ctx, "read_file", `{"path": "big.txt"}`)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 50)+"\n[truncated 1 bytes]", res.Output)
+
+	// Paths may not leave the sandbox, directly or through a symlink
+	for _, path := range []string{"../secret.txt", "link.txt"} {
+		_, err = tb.Call(ctx, "read_file", `{"path": "`+path+`"}`)
+		assert.ErrorContains(t, err, "outside the workspace", path)
+	}
+	_, err = tb.Call(ctx, "read_file", `{"path": "missing.md"}`)
+	assert.EqualError(t, err, "missing.md does not exist")
+	_, err = tb.Call(ctx, "read_file", `{}`)
+	assert.EqualError(t, err, "argument 'path' is required")
+	_, err = tb.Call(ctx, "read_file", `not json`)
+	assert.ErrorContains(t, err, "arguments are not a JSON object")
+	_, err = tb.Call(ctx, "http_fetch", `{"url": "https://example.com"}`)
+	assert.EqualError(t, err, "unknown tool 'http_fetch'")
+
+	_, err = NewToolbox(Options{Commands: []string{"go"}})
+	assert.EqualError(t, err, "tool 'run_command': executor command requires sandbox_dir")
+	_, err = NewToolbox(Options{SandboxDir: "relative/dir"})
+	assert.EqualError(t, err, `sandbox_dir "relative/dir" must be an absolute path`)
+}
+
+func TestFetchTool_IgnoresProxy(t *testing.T) {
+	// A proxy would connect to the private target itself, out of reach of the address check
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+
+	tb, err := NewToolbox(Options{Fetch: true})
+	require.NoError(t, err)
+	for url, host := range map[string]string{"http://10.255.255.1/": "10.255.255.1", "https://169.254.169.254/latest/meta-data": "169.254.169.254"} {
+		_, err = tb.Call(context.Background(), "http_fetch", `{"url": "`+url+`"}`)
+		assert.ErrorIs(t, err, netguard.ErrPrivateAddress, url)
+		// Refused at the target, not at the proxy
+		assert.ErrorContains(t, err, host, url)
+	}
+}
+
+func TestFetchTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("page for " + r.URL.Path))
+	}))
+	defer site.Close()
+	ctx := context.Background()
+
+	tb, err := NewToolbox(Options{Fetch: true, AllowPrivate: true})
+	require.NoError(t, err)
+	res, err := tb.Call(ctx, "http_fetch", `{"url": "`+site.URL+`/docs"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP 200 OK\nContent-Type: text/plain\n\npage for /docs", res.Output)
+
+	_, err = tb.Call(ctx, "http_fetch", `{"url": "file:///etc/passwd"}`)
+	assert.EqualError(t, err, "only http and https URLs can be fetched")
+
+	// Private addresses are refused by default
+	tb, err = NewToolbox(Options{Fetch: true})
+	require.NoError(t, err)
+	_, err = tb.Call(ctx, "http_fetch", `{"url": "`+site.URL+`"}`)
+	assert.ErrorContains(t, err, "private address")
+}
+
+func TestCommandTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX programs")
+	}
+	for _, prog := range []string{"echo", "sh", "sleep"} {
+		if _, err := exec.LookPath(prog); err != nil {
+			t.Skip(prog + " not installed")
+		}
+	}
+	root := t.TempDir()
+	t.Setenv("ZAI_API_KEY", "must-not-leak")
+
+	tb, err := NewToolbox(Options{SandboxDir: root, Commands: []string{"echo", "sh", "sleep"}, Timeout: 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, 2, tb.Len())
+	ctx := context.Background()
+
+	// Arguments are passed as is, without a shell
+	res, err := tb.Call(ctx, "run_command", `{"command": "echo", "args": ["$HOME", "a;b"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, "$HOME a;b\n", res.Output)
+
+	// Programs run in the sandbox with a reduced environment; failures are results
+	res, err = tb.Call(ctx, "run_command", `{"command": "sh", "args": ["-c", "pwd; echo key=$ZAI_API_KEY; exit 3"]}`)
+	require.NoError(t, err)
+	resolved, _ := filepath.EvalSymlinks(root)
+	assert.Equal(t, resolved+"\nkey=\n\n[exit status 3]", res.Output)
+
+	// Arguments may not name paths outside the sandbox
+	for _, arg := range []string{"/etc/passwd", "../secret", "docs/../../secret", "--file=/etc/passwd", "~/.ssh",
+		"-f/etc/passwd", "-I/etc", "-o../x", "-xf/etc", "--out~/x", "-C.."} {
+		_, err = tb.Call(ctx, "run_command", `{"command": "echo", "args": ["`+arg+`"]}`)
+		assert.EqualError(t, err, fmt.Sprintf("argument %q leaves the workspace", arg))
+	}
+	res, err = tb.Call(ctx, "run_command", `{"command": "echo", "args": ["docs/a..b", "--n=3", "-n", "-ldocs"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, "docs/a..b --n=3 -n -ldocs\n", res.Output)
+
+	_, err = tb.Call(ctx, "run_command", `{"command": "rm", "args": ["-rf", "."]}`)
+	assert.EqualError(t, err, "argument 'command' must be one of [echo sh sleep]")
+
+	_, err = tb.Call(ctx, "run_command", `{"command": "sleep", "args": ["5"]}`)
+	assert.EqualError(t, err, "timed out after 200ms")
+}
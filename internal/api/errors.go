@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/chew-z/copilot-proxy/internal/i18n"
 )
 
 // StatusError is an error with an HTTP status code
@@ -13,43 +15,60 @@ type StatusError struct {
 
 func (e *StatusError) Error() string { return e.ErrorMessage }
 
-// ErrBadRequest creates a 400 Bad Request error
-func ErrBadRequest(msg string) *StatusError {
+// Errorf creates an error with the given status. The message is a fmt format string in English,
+// translated into the configured locale before its arguments are filled in.
+func Errorf(code int, format string, args ...any) *StatusError {
 	return &StatusError{
-		StatusCode:   http.StatusBadRequest,
-		ErrorMessage: msg,
+		StatusCode:   code,
+		ErrorMessage: i18n.Sprintf(format, args...),
 	}
 }
 
+// ErrBadRequest creates a 400 Bad Request error
+func ErrBadRequest(format string, args ...any) *StatusError {
+	return Errorf(http.StatusBadRequest, format, args...)
+}
+
+// ErrUnauthorized creates a 401 Unauthorized error
+func ErrUnauthorized(format string, args ...any) *StatusError {
+	return Errorf(http.StatusUnauthorized, format, args...)
+}
+
+// ErrForbidden creates a 403 Forbidden error
+func ErrForbidden(format string, args ...any) *StatusError {
+	return Errorf(http.StatusForbidden, format, args...)
+}
+
 // ErrNotFound creates a 404 Not Found error
-func ErrNotFound(msg string) *StatusError {
-	return &StatusError{
-		StatusCode:   http.StatusNotFound,
-		ErrorMessage: msg,
-	}
+func ErrNotFound(format string, args ...any) *StatusError {
+	return Errorf(http.StatusNotFound, format, args...)
+}
+
+// ErrConflict creates a 409 Conflict error
+func ErrConflict(format string, args ...any) *StatusError {
+	return Errorf(http.StatusConflict, format, args...)
+}
+
+// ErrTooManyRequests creates a 429 Too Many Requests error
+func ErrTooManyRequests(format string, args ...any) *StatusError {
+	return Errorf(http.StatusTooManyRequests, format, args...)
 }
 
 // ErrInternalServer creates a 500 Internal Server Error
-func ErrInternalServer(msg string) *StatusError {
-	return &StatusError{
-		StatusCode:   http.StatusInternalServerError,
-		ErrorMessage: msg,
-	}
+func ErrInternalServer(format string, args ...any) *StatusError {
+	return Errorf(http.StatusInternalServerError, format, args...)
 }
 
 // ErrBadGateway creates a 502 Bad Gateway error
-func ErrBadGateway(msg string) *StatusError {
-	return &StatusError{
-		StatusCode:   http.StatusBadGateway,
-		ErrorMessage: msg,
-	}
+func ErrBadGateway(format string, args ...any) *StatusError {
+	return Errorf(http.StatusBadGateway, format, args...)
 }
 
 // WrapError wraps an existing error into a StatusError
 func WrapError(err error, code int, msg string) *StatusError {
-	fullMsg := msg
+	fullMsg := i18n.T(msg)
 	if err != nil {
-		fullMsg = fmt.Sprintf("%s: %v", msg, err)
+		fullMsg = fmt.Sprintf("%s: %v", fullMsg, err)
 	}
 	return &StatusError{
 		StatusCode:   code,
@@ -33,9 +33,34 @@ type ShowRequest struct {
 	Model string `json:"model"`
 }
 
+// GenerateRequest for /api/generate endpoint
+type GenerateRequest struct {
+	Model    string         `json:"model"`
+	Prompt   string         `json:"prompt"`
+	Suffix   string         `json:"suffix,omitempty"`
+	System   string         `json:"system,omitempty"`
+	Images   []string       `json:"images,omitempty"` // Base64-encoded images
+	Format   any            `json:"format,omitempty"` // "json" or a JSON schema
+	Options  map[string]any `json:"options,omitempty"`
+	Stream   *bool          `json:"stream,omitempty"` // Defaults to true, as in Ollama
+	Think    any            `json:"think,omitempty"`  // Boolean or effort level
+	Metadata any            `json:"metadata,omitempty"`
+}
+
+// EmbeddingsRequest for /v1/embeddings and /api/embed. Ollama's truncate, options and
+// keep_alive fields are accepted and ignored.
+type EmbeddingsRequest struct {
+	Model          string `json:"model"`
+	Input          any    `json:"input"` // A string or an array of strings
+	Dimensions     *int   `json:"dimensions,omitempty"`
+	EncodingFormat string `json:"encoding_format,omitempty"` // "float" or "base64", OpenAI only
+	User           string `json:"user,omitempty"`
+}
+
 // ShowResponse for /api/show endpoint
 type ShowResponse struct {
 	Template     string         `json:"template"`
+	Parameters   string         `json:"parameters,omitempty"` // Ollama Modelfile parameters, e.g. "num_ctx 200000"
 	Capabilities []string       `json:"capabilities"`
 	Details      ModelDetails   `json:"details"`
 	ModelInfo    map[string]any `json:"model_info"`
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// TestGuard_ExponentialLockout tests that lockouts double up to the maximum
+func TestGuard_ExponentialLockout(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	g := NewGuard(3, time.Minute, 3*time.Minute)
+	g.clock = clk
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for round, want := range expected {
+		for i := 0; i < 2; i++ {
+			if lockout := g.Fail("1.2.3.4"); lockout != 0 {
+				t.Fatalf("Round %d: unexpected lockout after %d failures", round, i+1)
+			}
+		}
+		if lockout := g.Fail("1.2.3.4"); lockout != want {
+			t.Fatalf("Round %d: lockout = %v, want %v", round, lockout, want)
+		}
+		if locked, remaining := g.Locked("1.2.3.4"); !locked || remaining != want {
+			t.Fatalf("Round %d: Locked() = %v, %v", round, locked, remaining)
+		}
+		clk.Advance(want)
+		if locked, _ := g.Locked("1.2.3.4"); locked {
+			t.Fatalf("Round %d: still locked after lockout expired", round)
+		}
+	}
+
+	g.Succeed("1.2.3.4")
+	g.Fail("1.2.3.4")
+	g.Fail("1.2.3.4")
+	if lockout := g.Fail("1.2.3.4"); lockout != time.Minute {
+		t.Errorf("Expected backoff reset after success, got %v", lockout)
+	}
+}
+
+// TestKeys tests key lookup and extraction from requests
+func TestKeys(t *testing.T) {
+	k := NewKeys(map[string]string{"laptop": "key-1", "ci": "key-2"})
+
+	if name, ok := k.Lookup("key-2"); !ok || name != "ci" {
+		t.Errorf("Lookup(key-2) = %q, %v", name, ok)
+	}
+	if _, ok := k.Lookup("key-3"); ok {
+		t.Error("Lookup(key-3) should fail")
+	}
+	if _, ok := k.Lookup(""); ok {
+		t.Error("Lookup of empty key should fail")
+	}
+
+	tests := []struct {
+		header, value, expected string
+	}{
+		{"Authorization", "Bearer key-1", "key-1"},
+		{"Authorization", "bearer  key-1 ", "key-1"},
+		{"Authorization", "Basic a2V5", ""},
+		{"X-Api-Key", "key-1", "key-1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(tt.header, tt.value)
+		if got := FromRequest(req); got != tt.expected {
+			t.Errorf("FromRequest(%s: %s) = %q, want %q", tt.header, tt.value, got, tt.expected)
+		}
+	}
+}
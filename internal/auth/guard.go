@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// Guard tracks failed authentication attempts per source and locks sources out with
+// exponentially growing durations after repeated failures
+type Guard struct {
+	maxFailures int
+	baseLockout time.Duration
+	maxLockout  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	clock   clock.Clock
+}
+
+// entry is the failure history of one source
+type entry struct {
+	failures    int       // Consecutive failures since the last lockout
+	lockouts    int       // Lockouts served; drives the exponential backoff
+	lockedUntil time.Time // Zero when not locked out
+	lastSeen    time.Time
+}
+
+// NewGuard creates a guard that locks a source out after maxFailures consecutive failures,
+// for baseLockout doubled on every subsequent lockout up to maxLockout
+func NewGuard(maxFailures int, baseLockout, maxLockout time.Duration) *Guard {
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	if maxLockout < baseLockout {
+		maxLockout = baseLockout
+	}
+	return &Guard{
+		maxFailures: maxFailures,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		entries:     make(map[string]*entry),
+		clock:       clock.Real{},
+	}
+}
+
+// Locked reports whether source is locked out and for how much longer
+func (g *Guard) Locked(source string) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.entries[source]
+	if !ok {
+		return false, 0
+	}
+	if remaining := e.lockedUntil.Sub(g.clock.Now()); remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+// Fail records a failed attempt. It returns the lockout duration if this failure triggered one.
+func (g *Guard) Fail(source string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.clock.Now()
+	g.sweep(now)
+
+	e, ok := g.entries[source]
+	if !ok {
+		e = &entry{}
+		g.entries[source] = e
+	}
+	e.lastSeen = now
+	e.failures++
+
+	if e.failures < g.maxFailures {
+		return 0
+	}
+
+	lockout := g.baseLockout << uint(min(e.lockouts, 30))
+	if lockout > g.maxLockout || lockout <= 0 {
+		lockout = g.maxLockout
+	}
+	e.failures = 0
+	e.lockouts++
+	e.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Succeed clears the failure history of source
+func (g *Guard) Succeed(source string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.entries, source)
+}
+
+// sweep forgets sources that have been quiet for longer than the maximum lockout;
+// callers must hold g.mu
+func (g *Guard) sweep(now time.Time) {
+	for source, e := range g.entries {
+		if now.Sub(e.lastSeen) > g.maxLockout && now.After(e.lockedUntil) {
+			delete(g.entries, source)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Keys authenticates client API keys against a static list
+type Keys struct {
+	digests map[[sha256.Size]byte]string // SHA-256 of key -> client name
+}
+
+// NewKeys builds a key set from client name -> key pairs
+func NewKeys(keys map[string]string) *Keys {
+	k := &Keys{digests: make(map[[sha256.Size]byte]string, len(keys))}
+	for name, key := range keys {
+		k.digests[sha256.Sum256([]byte(key))] = name
+	}
+	return k
+}
+
+// Lookup returns the client name for key. Keys are compared by digest so the lookup time
+// does not depend on how much of a key matches.
+func (k *Keys) Lookup(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	digest := sha256.Sum256([]byte(key))
+	for d, name := range k.digests {
+		if subtle.ConstantTimeCompare(d[:], digest[:]) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// FromRequest extracts a client key from "Authorization: Bearer <key>" or "X-Api-Key: <key>"
+func FromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-Api-Key"))
+}
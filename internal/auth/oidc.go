@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// jwksTTL is how long a fetched key set is trusted before it is refreshed
+	jwksTTL = time.Hour
+	// jwksMinRefresh rate-limits refreshes triggered by unknown key IDs
+	jwksMinRefresh = time.Minute
+	// clockSkew tolerates small clock differences when checking exp and nbf
+	clockSkew = time.Minute
+)
+
+// ErrKeyFetch marks failures to obtain the provider's keys, which say nothing about the token
+var ErrKeyFetch = errors.New("signing keys unavailable")
+
+// OIDCOptions configures JWT validation against an OIDC provider
+type OIDCOptions struct {
+	Issuer   string // Expected "iss"; also used for discovery when JWKSURL is empty
+	JWKSURL  string // Key set location; discovered from the issuer when empty
+	Audience string // Expected "aud"; required, as the provider issues tokens to other clients too
+}
+
+// Verifier validates JWT bearer tokens signed with keys from a JWKS endpoint
+type Verifier struct {
+	opts    OIDCOptions
+	client  *http.Client
+	refresh singleflight.Group // one key set download at a time, shared by waiting callers
+
+	mu        sync.Mutex // guards the fields below; never held while fetching
+	jwksURL   string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	clock     clock.Clock
+}
+
+// NewVerifier creates a verifier; keys are fetched lazily on first use
+func NewVerifier(opts OIDCOptions) *Verifier {
+	return &Verifier{
+		opts:    opts,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		jwksURL: opts.JWKSURL,
+		clock:   clock.Real{},
+	}
+}
+
+// LooksLikeJWT reports whether token has the three-segment compact JWS shape
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the token's signature and standard claims and returns its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	hash, ok := signatureHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid token signature encoding")
+	}
+	if err := verifySignature(header.Alg, hash, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims validates exp, nbf, iss and aud
+func (v *Verifier) checkClaims(claims map[string]any) error {
+	now := v.clock.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+
+	if v.opts.Issuer != "" {
+		iss, _ := claims["iss"].(string)
+		if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(v.opts.Issuer, "/") {
+			return fmt.Errorf("unexpected issuer %q", iss)
+		}
+	}
+
+	if !audienceMatches(claims["aud"], v.opts.Audience) {
+		return errors.New("token audience mismatch")
+	}
+	return nil
+}
+
+// audienceMatches handles both the string and array forms of "aud"
+func audienceMatches(aud any, want string) bool {
+	switch val := aud.(type) {
+	case string:
+		return val == want
+	case []any:
+		for _, a := range val {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the verification key for kid, refreshing the key set when it is stale or kid is
+// unknown. Concurrent callers share one refresh and the lock is not held while it runs, so a
+// slow provider does not hold up tokens whose keys are cached.
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := v.clock.Now()
+	stale := v.keys == nil || now.Sub(v.fetchedAt) > jwksTTL
+	k, ok := v.lookup(kid)
+	recent := !stale && now.Sub(v.fetchedAt) < jwksMinRefresh
+	v.mu.Unlock()
+	if ok && !stale {
+		return k, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// The shared refresh must not fail because the caller that started it went away
+	_, err, _ := v.refresh.Do("jwks", func() (any, error) {
+		return nil, v.fetchKeys(context.WithoutCancel(ctx))
+	})
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Fall back to the cached key set if the provider is briefly unreachable
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyFetch, err)
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID; an empty kid matches when the set holds exactly one key.
+// Callers must hold v.mu.
+func (v *Verifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if k, ok := v.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// fetchKeys downloads the key set, discovering its URL from the issuer if needed
+func (v *Verifier) fetchKeys(ctx context.Context) error {
+	v.mu.Lock()
+	v.fetchedAt = v.clock.Now()
+	jwksURL := v.jwksURL
+	v.mu.Unlock()
+
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(v.opts.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.fetchJSON(ctx, url, &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+		v.mu.Lock()
+		v.jwksURL = jwksURL
+		v.mu.Unlock()
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.fetchJSON(ctx, jwksURL, &set); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable signing keys")
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// fetchJSON GETs url and decodes the JSON response into out
+func (v *Verifier) fetchJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a JSON Web Key (RSA or EC public key)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK into a Go public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// signatureHashes maps supported JWS algorithms to their digest
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// verifySignature checks a JWS signature over signingInput
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signingInput string, signature []byte) error {
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("signing algorithm does not match key type")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return errors.New("signing algorithm does not match key type")
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key type")
+	}
+}
+
+// decodeSegment decodes a base64url JSON token segment
+func decodeSegment(seg string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(data []byte) string { return base64.RawURLEncoding.EncodeToString(data) }
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return input + "." + b64(sig)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + b64(sig)
+}
+
+// newTestProvider serves OIDC discovery and a JWKS holding one RSA and one EC key
+func newTestProvider(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks"})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	provider := newTestProvider(t, rsaKey, ecKey)
+	v := NewVerifier(OIDCOptions{Issuer: provider.URL, Audience: "copilot-proxy"})
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	valid := map[string]any{"iss": provider.URL, "aud": "copilot-proxy", "sub": "alice", "exp": exp}
+
+	claimsWith := func(key string, value any) map[string]any {
+		c := map[string]any{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"RS256", signRS256(t, rsaKey, "rsa-1", valid), ""},
+		{"ES256", signES256(t, ecKey, "ec-1", valid), ""},
+		{"Audience Array", signRS256(t, rsaKey, "rsa-1", claimsWith("aud", []any{"other", "copilot-proxy"})), ""},
+		{"Wrong Key", signRS256(t, otherKey, "rsa-1", valid), "invalid token signature"},
+		{"Unknown Kid", signRS256(t, rsaKey, "rsa-9", valid), "unknown signing key"},
+		{"Expired", signRS256(t, rsaKey, "rsa-1", claimsWith("exp", float64(time.Now().Add(-time.Hour).Unix()))), "token expired"},
+		{"No Expiry", signRS256(t, rsaKey, "rsa-1", claimsWith("exp", nil)), "token has no expiry"},
+		{"Wrong Issuer", signRS256(t, rsaKey, "rsa-1", claimsWith("iss", "https://evil.example")), "unexpected issuer"},
+		{"Wrong Audience", signRS256(t, rsaKey, "rsa-1", claimsWith("aud", "other")), "audience mismatch"},
+		{"Alg None", b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".", "unsupported signing algorithm"},
+		{"Malformed", "not-a-jwt", "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "alice", claims["sub"])
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifier_Refresh(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	var down atomic.Bool
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fetches.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		}})
+	}))
+	defer provider.Close()
+
+	v := NewVerifier(OIDCOptions{JWKSURL: provider.URL, Audience: "copilot-proxy"})
+	token := signRS256(t, rsaKey, "rsa-1", map[string]any{"aud": "copilot-proxy", "exp": float64(time.Now().Add(time.Hour).Unix())})
+
+	// Concurrent callers share one download, and a caller giving up does not cancel it
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 5)
+	go func() {
+		_, err := v.Verify(ctx, token)
+		errs <- err
+	}()
+	for range 4 {
+		go func() {
+			_, err := v.Verify(context.Background(), token)
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool { return fetches.Load() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	close(release)
+	for range 5 {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// Provider failures are told apart from bad tokens
+	down.Store(true)
+	v = NewVerifier(OIDCOptions{JWKSURL: provider.URL, Audience: "copilot-proxy"})
+	_, err = v.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrKeyFetch)
+}
+
+func TestPrincipalFromClaims(t *testing.T) {
+	mapping := ClaimMapping{Client: "email", Models: "models", Quota: "rpm"}
+
+	p, err := PrincipalFromClaims(map[string]any{
+		"email":  "alice@example.com",
+		"models": []any{"GLM-4.7", "glm-4.7-flash"},
+		"rpm":    30.0,
+	}, mapping)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", p.Name)
+	assert.Equal(t, 30.0, p.RequestsPerMinute)
+	assert.True(t, p.AllowsModel("glm-4.7"))
+	assert.False(t, p.AllowsModel("glm-4.7-flashx"))
+
+	p, err = PrincipalFromClaims(map[string]any{"email": "bob@example.com", "models": "glm-4.7 glm-4.7-flashx"}, mapping)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"glm-4.7", "glm-4.7-flashx"}, p.Models)
+
+	_, err = PrincipalFromClaims(map[string]any{"sub": "x"}, mapping)
+	assert.True(t, err != nil && strings.Contains(err.Error(), `"email"`))
+}
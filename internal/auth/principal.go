@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Principal is the authenticated identity behind a request
+type Principal struct {
+	Name              string   // Client name (static key name or mapped token claim)
+	Models            []string // Allowed models; empty means all models
+	RequestsPerMinute float64  // Per-client quota; zero means unlimited
+}
+
+// AllowsModel reports whether the principal may use model (case-insensitive)
+func (p *Principal) AllowsModel(model string) bool {
+	if len(p.Models) == 0 {
+		return true
+	}
+	for _, m := range p.Models {
+		if strings.EqualFold(m, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimMapping names the token claims that populate a Principal
+type ClaimMapping struct {
+	Client string // Claim holding the client identity (e.g. "sub", "email")
+	Models string // Claim holding the model allowlist (array or space/comma separated string)
+	Quota  string // Claim holding the requests-per-minute quota
+}
+
+// PrincipalFromClaims maps verified token claims to a Principal
+func PrincipalFromClaims(claims map[string]any, m ClaimMapping) (*Principal, error) {
+	name, _ := claims[m.Client].(string)
+	if name == "" {
+		return nil, fmt.Errorf("token has no %q claim", m.Client)
+	}
+	p := &Principal{Name: name}
+
+	if m.Models != "" {
+		switch val := claims[m.Models].(type) {
+		case []any:
+			for _, item := range val {
+				if s, ok := item.(string); ok && s != "" {
+					p.Models = append(p.Models, s)
+				}
+			}
+		case string:
+			p.Models = strings.FieldsFunc(val, func(r rune) bool { return r == ' ' || r == ',' })
+		}
+	}
+
+	if m.Quota != "" {
+		switch val := claims[m.Quota].(type) {
+		case float64:
+			p.RequestsPerMinute = val
+		case string:
+			if n, err := strconv.ParseFloat(val, 64); err == nil {
+				p.RequestsPerMinute = n
+			}
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,234 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers. Components that measure durations, expire entries
+// or wait take a Clock so tests can drive them with a Fake instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Until(t time.Time) time.Duration
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// Timer is a single event, as time.Timer
+type Timer interface {
+	C() <-chan time.Time // Nil for timers created by AfterFunc
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks at intervals, as time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// Real is the system clock
+type Real struct{}
+
+func (Real) Now() time.Time                            { return time.Now() }
+func (Real) Since(t time.Time) time.Duration           { return time.Since(t) }
+func (Real) Until(t time.Time) time.Duration           { return time.Until(t) }
+func (Real) NewTimer(d time.Duration) Timer            { return realTimer{time.NewTimer(d)} }
+func (Real) NewTicker(d time.Duration) Ticker          { return realTicker{time.NewTicker(d)} }
+func (Real) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+func (Real) After(d time.Duration) <-chan time.Time    { return time.After(d) }
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time   { return r.t.C }
+func (r realTicker) Stop()                 { r.t.Stop() }
+func (r realTicker) Reset(d time.Duration) { r.t.Reset(d) }
+
+// Fake is a clock that only moves when told to. Timers and tickers fire, in deadline order,
+// while Advance or Set moves the time past them; AfterFunc callbacks run before Advance
+// returns.
+type Fake struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer // Pending, in no particular order
+}
+
+// NewFake creates a fake clock set to t
+func NewFake(t time.Time) *Fake {
+	f := &Fake{now: t}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since implements Clock
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+
+// Until implements Clock
+func (f *Fake) Until(t time.Time) time.Duration { return t.Sub(f.Now()) }
+
+// NewTimer implements Clock
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(&fakeTimer{clock: f, ch: make(chan time.Time, 1)}, d)
+}
+
+// NewTicker implements Clock
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(&fakeTimer{clock: f, ch: make(chan time.Time, 1), period: d}, d)}
+}
+
+// AfterFunc implements Clock
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(&fakeTimer{clock: f, fn: fn}, d)
+}
+
+// After implements Clock
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Advance moves the clock forward by d, firing the timers that come due
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the timers that come due. Moving it backwards fires nothing.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		next := f.due(t)
+		if next == nil {
+			if t.After(f.now) {
+				f.now = t
+			}
+			f.mu.Unlock()
+			return
+		}
+		// Time passes timer by timer, so a callback sees its own deadline as the time
+		f.now = next.when
+		fn := next.fire()
+		f.mu.Unlock()
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// Timers returns the number of pending timers and tickers
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, so a test can advance the
+// clock only once a goroutine under test has started waiting
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+// add schedules a timer d from now
+func (f *Fake) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.when = f.now.Add(d)
+	f.timers = append(f.timers, t)
+	f.cond.Broadcast()
+	return t
+}
+
+// due returns the earliest pending timer at or before t; f.mu is held
+func (f *Fake) due(t time.Time) *fakeTimer {
+	sort.SliceStable(f.timers, func(i, j int) bool { return f.timers[i].when.Before(f.timers[j].when) })
+	if len(f.timers) == 0 || f.timers[0].when.After(t) {
+		return nil
+	}
+	return f.timers[0]
+}
+
+// remove unschedules a timer and reports whether it was pending; f.mu is held
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, other := range f.timers {
+		if other == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a timer, ticker or AfterFunc of a Fake clock
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	period time.Duration // Non-zero for tickers
+	ch     chan time.Time
+	fn     func()
+}
+
+// fire delivers a due timer and returns its callback; clock.mu is held
+func (t *fakeTimer) fire() func() {
+	if t.period > 0 {
+		t.when = t.when.Add(t.period)
+	} else {
+		t.clock.remove(t)
+	}
+	if t.ch != nil {
+		// Like time.Timer, a tick nobody has received yet is not queued twice
+		select {
+		case t.ch <- t.clock.now:
+		default:
+		}
+	}
+	return t.fn
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	active := t.clock.remove(t)
+	if t.period > 0 {
+		t.period = d
+	}
+	t.clock.mu.Unlock()
+	t.clock.add(t, d)
+	return active
+}
+
+// fakeTicker adapts a repeating fakeTimer to the Ticker interface
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop()                 { t.fakeTimer.Stop() }
+func (t fakeTicker) Reset(d time.Duration) { t.fakeTimer.Reset(d) }
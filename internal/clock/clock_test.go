@@ -0,0 +1,113 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestFakeTimers tests that timers fire in deadline order as the clock advances
+func TestFakeTimers(t *testing.T) {
+	f := NewFake(epoch)
+	var fired []string
+
+	timer := f.NewTimer(2 * time.Second)
+	f.AfterFunc(time.Second, func() {
+		fired = append(fired, "func@"+f.Now().Sub(epoch).String())
+	})
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("Stop on a pending timer should report true")
+	}
+	if n := f.Timers(); n != 2 {
+		t.Fatalf("Timers() = %d, want 2", n)
+	}
+
+	f.Advance(1500 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != "func@1s" {
+		t.Errorf("fired = %v, want [func@1s]", fired)
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case at := <-timer.C():
+		if !at.Equal(epoch.Add(2 * time.Second)) {
+			t.Errorf("timer fired at %v, want its deadline", at)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+	if got := f.Since(epoch); got != 2500*time.Millisecond {
+		t.Errorf("Since() = %v, want 2.5s", got)
+	}
+	if timer.Stop() {
+		t.Error("Stop on a fired timer should report false")
+	}
+
+	// Reset re-arms a fired timer
+	timer.Reset(time.Second)
+	f.Advance(time.Second)
+	if len(timer.C()) != 1 {
+		t.Error("reset timer did not fire")
+	}
+}
+
+// TestFakeTicker tests that a ticker fires every period without queueing missed ticks
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	f.Advance(time.Minute)
+	if at := <-ticker.C(); !at.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("tick at %v, want 1m", at)
+	}
+
+	f.Advance(10 * time.Minute)
+	if n := len(ticker.C()); n != 1 {
+		t.Errorf("%d ticks queued, want 1", n)
+	}
+	<-ticker.C()
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	if n := len(ticker.C()); n != 0 {
+		t.Errorf("stopped ticker delivered %d ticks", n)
+	}
+}
+
+// TestBlockUntil tests that a test can wait for a goroutine to start waiting before advancing
+func TestBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-f.After(time.Hour)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	select {
+	case at := <-done:
+		if !at.Equal(epoch.Add(time.Hour)) {
+			t.Errorf("After delivered %v", at)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("goroutine was not woken")
+	}
+}
+
+// TestReal tests that the system clock satisfies the interface with working timers
+func TestReal(t *testing.T) {
+	var c Clock = Real{}
+	start := c.Now()
+	<-c.NewTimer(time.Millisecond).C()
+	if c.Since(start) <= 0 {
+		t.Error("Since() did not advance")
+	}
+}
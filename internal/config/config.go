@@ -1,10 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/chew-z/copilot-proxy/internal/paths"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 )
 
@@ -16,6 +24,825 @@ type Config struct {
 	Port    int    `mapstructure:"port"`
 	Debug   bool   `mapstructure:"debug"`
 	Verbose bool   `mapstructure:"verbose"` // Enable terminal output (default: quiet, logs to file only)
+
+	LogPrivacy bool `mapstructure:"log_privacy"` // Never log message content, only hashes and sizes
+
+	Locale string `mapstructure:"locale"` // Language of proxy-generated errors and CLI messages, e.g. "pl" (default: English)
+
+	BackupBaseURLs []string        `mapstructure:"backup_base_urls"` // Tried in order when base_url cannot be reached (config file only)
+	Endpoints      EndpointsConfig `mapstructure:"endpoints"`        // Connection failover between base URLs (config file only)
+	Transport      TransportConfig `mapstructure:"transport"`        // Upstream connection timeouts and pooling (config file only)
+
+	VisionModel string `mapstructure:"vision_model"` // Upgrade image-bearing requests for text-only models to this model (config file only)
+
+	DefaultModel      string   `mapstructure:"default_model"`      // Serves chat requests whose model is missing or a placeholder (config file only)
+	PlaceholderModels []string `mapstructure:"placeholder_models"` // Model names hard-coded by clients, replaced by default_model (config file only)
+
+	BufferedUserAgents []string `mapstructure:"buffered_user_agents"` // User-Agent substrings of clients whose streaming requests are answered in one piece (config file only)
+
+	ToolValidation string `mapstructure:"tool_validation"` // Tool definition checks: off, basic or strict (config file only)
+
+	ToolResults ToolResultsConfig `mapstructure:"tool_results"` // Size limits on role:"tool" message content (config file only)
+
+	Images ImagesConfig `mapstructure:"images"` // Image detail downgrade under token pressure (config file only)
+
+	ModelLimits map[string]ModelLimitsConfig `mapstructure:"model_limits"` // Advertised token limits per model, overriding the catalog (config file only)
+
+	ModelSnapshots map[string]string `mapstructure:"model_snapshots"` // Upstream snapshot identifier each model is pinned to (config file only)
+
+	ModelsFile string `mapstructure:"models_file"` // Model catalog additions and overrides; defaults to models.json or models.yaml beside the config file
+
+	Jobs        []JobConfig       `mapstructure:"jobs"`         // Scheduled prompt jobs (config file only)
+	Dataset     DatasetConfig     `mapstructure:"dataset"`      // Fine-tuning dataset collection (config file only)
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`   // Per-IP rate limiting (config file only)
+	Duplicates  DuplicatesConfig  `mapstructure:"duplicates"`   // Duplicate request storm detection (config file only)
+	Anomalies   AnomalyConfig     `mapstructure:"anomalies"`    // Token usage spike alerts (config file only)
+	SLO         SLOConfig         `mapstructure:"slo"`          // Per-model latency objectives and burn alerts (config file only)
+	Auth        AuthConfig        `mapstructure:"auth"`         // Inbound client authentication (config file only)
+	Admin       AdminConfig       `mapstructure:"admin"`        // Access to /metrics and /admin/* (token also via ZAI_ADMIN_TOKEN)
+	Attribution AttributionConfig `mapstructure:"attribution"`  // AI-generated content marking (config file only)
+	PostProcess []PostProcessRule `mapstructure:"post_process"` // Completion content rewrites (config file only)
+	Links       LinksConfig       `mapstructure:"links"`        // Dead link checks on completion content (config file only)
+	Rewrites    []RewriteRule     `mapstructure:"rewrites"`     // Upstream request body edits (config file only)
+	Plugins     []PluginConfig    `mapstructure:"plugins"`      // WebAssembly request/response hooks (config file only)
+	Scripts     []ScriptConfig    `mapstructure:"scripts"`      // Lua request/response hooks (config file only)
+	Hooks       []HookConfig      `mapstructure:"hooks"`        // Commands run on lifecycle events (config file only)
+	GitContext  GitContextConfig  `mapstructure:"git_context"`  // Repository context endpoint (config file only)
+	Prompts     PromptsConfig     `mapstructure:"prompts"`      // Stored prompt fragments that messages include (config file only)
+	Assist      AssistConfig      `mapstructure:"assist"`       // Commit message / PR description endpoints (config file only)
+	Embeddings  EmbeddingsConfig  `mapstructure:"embeddings"`   // Embeddings relay (config file only)
+	Anthropic   AnthropicConfig   `mapstructure:"anthropic"`    // Anthropic Messages API compatibility (config file only)
+	Agent       AgentConfig       `mapstructure:"agent"`        // Server-side tool execution loop (config file only)
+
+	Thinking    ThinkingConfig    `mapstructure:"thinking"`     // Reasoning safeguards (config file only)
+	Metrics     MetricsConfig     `mapstructure:"metrics"`      // Counter persistence across restarts (config file only)
+	Retention   RetentionConfig   `mapstructure:"retention"`    // Age and size limits on persisted data (config file only)
+	Storage     StorageConfig     `mapstructure:"storage"`      // Backend for state shared between replicas (config file only)
+	Usage       UsageConfig       `mapstructure:"usage"`        // Per-request usage ledger and reports (config file only)
+	RequestLog  RequestLogConfig  `mapstructure:"request_log"`  // SQLite log of relayed chat requests (config file only)
+	Trace       TraceConfig       `mapstructure:"trace"`        // Sampled full-payload debug traces (config file only)
+	Failover    FailoverConfig    `mapstructure:"failover"`     // Local Ollama used when the cloud is unreachable (config file only)
+	Streams     StreamsConfig     `mapstructure:"streams"`      // Caps on relayed upstream responses, enforced by a watchdog (config file only)
+	Retry       RetryConfig       `mapstructure:"retry"`        // Automatic retries of transient upstream failures (config file only)
+	OTel        OTelConfig        `mapstructure:"otel"`         // OpenTelemetry trace export; OTEL_* variables fill unset settings (config file only)
+	Broadcast   BroadcastConfig   `mapstructure:"broadcast"`    // Fan-out of X-Session-Id responses to GET subscribers (config file only)
+	Cache       CacheConfig       `mapstructure:"cache"`        // Answers to repeated temperature 0 requests served locally (config file only)
+	PromptCache PromptCacheConfig `mapstructure:"prompt_cache"` // Request layout that lets upstream prompt caches reuse prefixes (config file only)
+
+	Signing   SigningConfig             `mapstructure:"signing"`   // Signatures on upstream requests for egress gateways (config file only)
+	Upstreams map[string]UpstreamConfig `mapstructure:"upstreams"` // Alternatives authenticated clients select with X-Upstream (config file only)
+	Canary    map[string]CanaryConfig   `mapstructure:"canary"`    // Weighted rollout to a newer model, keyed by the requested model (config file only)
+	Providers []ProviderConfig          `mapstructure:"providers"` // Other APIs serving the models they list, routed by model name (config file only)
+	Fallbacks map[string][]string       `mapstructure:"fallbacks"` // Models tried in order while a model's upstream is rate limited or failing (config file only)
+
+	ResponseHeaders ResponseHeadersConfig `mapstructure:"response_headers"` // Upstream header passthrough per dialect (config file only)
+
+	Profiles     map[string]ProfileConfig     `mapstructure:"profiles"`      // Per-client behavior, keyed by client name (config file only)
+	CatalogViews map[string]CatalogViewConfig `mapstructure:"catalog_views"` // Model catalog subsets shown to groups of clients, keyed by view name (config file only)
+
+	ConfigVersion int      `mapstructure:"config_version"` // Schema version the config file was written for; files without one are version 1
+	Migrations    []string `mapstructure:"-"`              // Old settings upgraded in memory on load
+	UnknownKeys   []string `mapstructure:"-"`              // Config file settings no field reads, e.g. typos
+}
+
+// ModelLimitsConfig overrides the token limits advertised for a model; zero keeps the catalog value
+type ModelLimitsConfig struct {
+	MaxInputTokens  int `mapstructure:"max_input_tokens"`  // Context window
+	MaxOutputTokens int `mapstructure:"max_output_tokens"` // Completion cap
+}
+
+// ToolResultsConfig limits the size of tool results forwarded upstream; it is enabled when max_chars is set
+type ToolResultsConfig struct {
+	MaxChars int    `mapstructure:"max_chars"` // Longest tool result forwarded unchanged
+	Mode     string `mapstructure:"mode"`      // truncate (keep head and tail around a marker) or summarize
+	Model    string `mapstructure:"model"`     // Model that writes summaries
+}
+
+// ImagesConfig lets the proxy shrink vision requests that would not fit the context or cost budget
+type ImagesConfig struct {
+	Downgrade bool    `mapstructure:"downgrade"`  // Set image detail to "low" when the request does not fit
+	DropOlder bool    `mapstructure:"drop_older"` // Then replace older images with a placeholder, keeping the latest
+	MaxCost   float64 `mapstructure:"max_cost"`   // Prompt cost budget in USD; 0 only checks the context
+}
+
+// ThinkingConfig controls and bounds the model's reasoning phase
+type ThinkingConfig struct {
+	Mode        string            `mapstructure:"mode"`         // What thinking-capable models are sent: enabled (default), disabled or passthrough
+	Models      map[string]string `mapstructure:"models"`       // Mode per model, overriding mode
+	MaxDuration time.Duration     `mapstructure:"max_duration"` // Cut off streams still reasoning after this long; 0 disables
+	Fallback    bool              `mapstructure:"fallback"`     // Retry with thinking disabled instead of ending with an error
+}
+
+// ResponseHeadersConfig selects the upstream response headers forwarded on each API dialect
+type ResponseHeadersConfig struct {
+	OpenAI HeaderPolicyConfig `mapstructure:"openai"` // /v1 routes
+	Ollama HeaderPolicyConfig `mapstructure:"ollama"` // /api routes
+}
+
+// HeaderPolicyConfig is an allowlist and denylist of header names; a trailing "*" matches a prefix
+type HeaderPolicyConfig struct {
+	Allow []string `mapstructure:"allow"` // Replaces the dialect's default allowlist when set
+	Deny  []string `mapstructure:"deny"`  // Removed even if allowed
+}
+
+// Validate checks that wildcards only appear at the end of a pattern
+func (h HeaderPolicyConfig) Validate() error {
+	for _, p := range append(append([]string{}, h.Allow...), h.Deny...) {
+		name := strings.TrimSuffix(p, "*")
+		if name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("invalid header pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// UpstreamConfig is an alternative OpenAI-compatible upstream, selected per request by name
+type UpstreamConfig struct {
+	BaseURL        string            `mapstructure:"base_url"`         // Defaults to the main base_url and its backups
+	BackupBaseURLs []string          `mapstructure:"backup_base_urls"` // Tried in order when base_url cannot be reached
+	APIKey         string            `mapstructure:"api_key"`          // Defaults to the main api_key
+	Models         map[string]string `mapstructure:"models"`           // Catalog model -> model name sent to this upstream
+}
+
+// ProviderConfig is another OpenAI-compatible API, such as OpenRouter, OpenAI or a local Ollama.
+// Requests for the models it lists are sent to it instead of base_url.
+type ProviderConfig struct {
+	Name           string   `mapstructure:"name"`             // Reported in X-Upstream and usage, e.g. "openrouter"
+	BaseURL        string   `mapstructure:"base_url"`         // e.g. https://openrouter.ai/api/v1 or http://localhost:11435/v1
+	BackupBaseURLs []string `mapstructure:"backup_base_urls"` // Tried in order when base_url cannot be reached
+	APIKey         string   `mapstructure:"api_key"`          // Optional for local servers
+	Models         []string `mapstructure:"models"`           // Model names as the provider knows them; added to the catalog when new
+	CacheControl   bool     `mapstructure:"cache_control"`    // Mark the system prompt with cache_control, for APIs with explicit prompt caching
+}
+
+// EndpointsConfig tunes failover from a provider's base URL to its backups
+type EndpointsConfig struct {
+	ReprobeInterval time.Duration `mapstructure:"reprobe_interval"` // How often an unreachable base URL is probed (default 30s)
+}
+
+// TransportConfig tunes connections to upstreams. Zero values use the defaults.
+type TransportConfig struct {
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`            // TCP connect, after which a backup base URL is tried (default 10s)
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`   // Default 10s
+	KeepAlive             time.Duration `mapstructure:"keep_alive"`              // TCP keepalive probe interval (default 15s; negative disables)
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"` // Wait for response headers (default 30s)
+	IdleConnTimeout       time.Duration `mapstructure:"idle_conn_timeout"`       // Default 90s
+	MaxIdleConnsPerHost   int           `mapstructure:"max_idle_conns_per_host"` // Default 50
+	MaxConnsPerHost       int           `mapstructure:"max_conns_per_host"`      // Default 0, unlimited; requests beyond it wait
+}
+
+// SigningConfig signs upstream requests for egress gateways that require it; the provider's
+// bearer token is sent as well
+type SigningConfig struct {
+	Scheme     string `mapstructure:"scheme"`      // hmac or sigv4; empty disables signing
+	Secret     string `mapstructure:"secret"`      // Shared secret (hmac) or secret access key (sigv4)
+	SecretFile string `mapstructure:"secret_file"` // Read the secret from this file instead
+	KeyID      string `mapstructure:"key_id"`      // Key ID header (hmac) or access key ID (sigv4)
+	Header     string `mapstructure:"header"`      // Signature header (default X-Signature or X-Amz-Authorization)
+	Region     string `mapstructure:"region"`      // sigv4 only
+	Service    string `mapstructure:"service"`     // sigv4 only (default execute-api)
+}
+
+// CanaryConfig serves a percentage of the requests for one model with another
+type CanaryConfig struct {
+	Model   string  `mapstructure:"model"`   // Model serving the canary share
+	Percent float64 `mapstructure:"percent"` // Share of requests routed to it (0-100)
+}
+
+// FailoverConfig routes chat requests to a local Ollama instance when the cloud API is
+// unreachable; it is enabled when ollama_url is set
+type FailoverConfig struct {
+	OllamaURL string            `mapstructure:"ollama_url"` // e.g. http://127.0.0.1:11435 (Ollama moved off the proxy's port)
+	Models    map[string]string `mapstructure:"models"`     // Cloud model -> local model
+	Model     string            `mapstructure:"model"`      // Local model for cloud models not listed
+}
+
+// StreamsConfig caps how long an upstream response may stay open while it is relayed. Zero values
+// use the defaults.
+type StreamsConfig struct {
+	MaxDuration time.Duration `mapstructure:"max_duration"` // Responses still open after this long are force-closed (default 1h)
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // Responses that deliver nothing for this long are force-closed (default 10m)
+}
+
+// BroadcastConfig lets chat responses sent with an X-Session-Id header be watched by other
+// clients through GET /v1/sessions/:session/stream
+type BroadcastConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	MaxBuffer int           `mapstructure:"max_buffer"` // Bytes of a response kept for late joiners; longer responses stop broadcasting (default 4MiB)
+	Linger    time.Duration `mapstructure:"linger"`     // How long a finished response stays available (default 1m)
+}
+
+// CacheConfig controls the cache of non-streaming answers to deterministic (temperature 0) chat
+// requests
+type CacheConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxEntries    int           `mapstructure:"max_entries"`     // Least recently used answers are dropped beyond this (default 1000)
+	TTL           time.Duration `mapstructure:"ttl"`             // How long an answer is served (default 1h)
+	MaxEntryBytes int           `mapstructure:"max_entry_bytes"` // Larger answers are not cached (default 1MiB)
+}
+
+// RetryConfig controls how upstream requests that failed transiently (a broken connection, 429,
+// 502, 503 or 504) are resent
+type RetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // Attempts per request including the first; 1 turns retries off (default 3)
+	BaseDelay   time.Duration `mapstructure:"base_delay"`   // Backoff before the first retry, doubled for each one after (default 500ms)
+	MaxDelay    time.Duration `mapstructure:"max_delay"`    // Longest wait between attempts; a longer Retry-After is not waited out (default 10s)
+}
+
+// OTelConfig controls OpenTelemetry span export over OTLP/HTTP with JSON encoding. The standard
+// OTEL_* environment variables fill the settings left unset here, and setting an OTLP endpoint
+// in the environment enables export.
+type OTelConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint"`     // Full traces URL (default http://localhost:4318/v1/traces)
+	Headers     map[string]string `mapstructure:"headers"`      // Sent with every export, e.g. a backend API key
+	ServiceName string            `mapstructure:"service_name"` // service.name resource attribute (default copilot-proxy)
+	SampleRate  float64           `mapstructure:"sample_rate"`  // Fraction of new traces exported (0-1, default 1); callers' traceparent flags decide for theirs
+}
+
+// TraceConfig controls sampled capture of complete upstream exchanges for debugging
+type TraceConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	SampleRate float64       `mapstructure:"sample_rate"` // Fraction of chat requests traced (0-1)
+	Header     string        `mapstructure:"header"`      // Requests carrying this header are always traced
+	Dir        string        `mapstructure:"dir"`         // Defaults to <data dir>/traces
+	Retention  time.Duration `mapstructure:"retention"`   // Traces older than this are deleted
+}
+
+// StorageConfig selects where shared state such as client quota counters is kept
+type StorageConfig struct {
+	Backend string       `mapstructure:"backend"` // memory (this process only), sqlite (survives restarts, shared on one host) or redis (shared by replicas)
+	SQLite  SQLiteConfig `mapstructure:"sqlite"`
+	Redis   RedisConfig  `mapstructure:"redis"`
+}
+
+// SQLiteConfig locates the database file of the sqlite backend
+type SQLiteConfig struct {
+	Path string `mapstructure:"path"` // Defaults to <data dir>/storage.db
+}
+
+// DBPath returns the database file, defaulting to the data directory
+func (s SQLiteConfig) DBPath() (string, error) {
+	if s.Path != "" {
+		return s.Path, nil
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "storage.db"), nil
+}
+
+// RedisConfig locates the Redis server of the redis backend
+type RedisConfig struct {
+	Addr     string        `mapstructure:"addr"` // host:port
+	Password string        `mapstructure:"password"`
+	DB       int           `mapstructure:"db"`
+	Prefix   string        `mapstructure:"prefix"`  // Prepended to every key
+	Timeout  time.Duration `mapstructure:"timeout"` // Per command, including connecting
+}
+
+// UsageConfig controls the per-request usage ledger
+type UsageConfig struct {
+	Ledger bool              `mapstructure:"ledger"` // Append a record per chat request
+	Dir    string            `mapstructure:"dir"`    // Defaults to <data dir>/usage
+	Export UsageExportConfig `mapstructure:"export"`
+}
+
+// DirPath returns the ledger directory, defaulting to the data directory
+func (u UsageConfig) DirPath() (string, error) {
+	return dataSubdir(u.Dir, "usage")
+}
+
+// UsageExportConfig schedules monthly usage reports; it is enabled when schedule is set
+type UsageExportConfig struct {
+	Schedule string                  `mapstructure:"schedule"` // Cron expression; each run reports the previous month
+	Format   string                  `mapstructure:"format"`   // csv
+	Dir      string                  `mapstructure:"dir"`      // Defaults to <data dir>/exports
+	S3       S3Config                `mapstructure:"s3"`       // Upload reports when bucket is set
+	Tenants  map[string]TenantConfig `mapstructure:"tenants"`  // One report per tenant; a single "all" report when empty
+}
+
+// DirPath returns the report directory, defaulting to the data directory
+func (u UsageExportConfig) DirPath() (string, error) {
+	return dataSubdir(u.Dir, "exports")
+}
+
+// PromptCacheConfig arranges requests so upstream prompt caches can reuse the longest possible
+// prefix of each one
+type PromptCacheConfig struct {
+	Enabled bool `mapstructure:"enabled"` // Place injected messages that change per request after the conversation history
+}
+
+// RequestLogConfig controls the SQLite database of relayed chat requests read by the stats and
+// logs commands
+type RequestLogConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Path    string        `mapstructure:"path"`    // Defaults to <data dir>/requests.db
+	MaxAge  time.Duration `mapstructure:"max_age"` // Older records are deleted; 0 keeps them
+}
+
+// DBPath returns the database file, defaulting to the data directory
+func (r RequestLogConfig) DBPath() (string, error) {
+	if r.Path != "" {
+		return r.Path, nil
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "requests.db"), nil
+}
+
+// TenantConfig groups client keys into one usage report
+type TenantConfig struct {
+	Clients []string `mapstructure:"clients"` // Client names whose usage the report covers
+	S3      S3Config `mapstructure:"s3"`      // Overrides the shared upload settings field by field
+}
+
+// S3Config locates an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"` // e.g. https://s3.eu-central-1.amazonaws.com
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	Prefix    string `mapstructure:"prefix"` // Prepended to object keys
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+// Merge returns s with the non-empty fields of o applied
+func (s S3Config) Merge(o S3Config) S3Config {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&s.Endpoint, o.Endpoint}, {&s.Region, o.Region}, {&s.Bucket, o.Bucket},
+		{&s.Prefix, o.Prefix}, {&s.AccessKey, o.AccessKey}, {&s.SecretKey, o.SecretKey},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return s
+}
+
+// RetentionConfig bounds the disk usage of persisted data
+type RetentionConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // How often the janitor sweeps; 0 disables it
+	Datasets StorePolicy   `mapstructure:"datasets"`
+	Traces   StorePolicy   `mapstructure:"traces"` // max_age defaults to trace.retention
+	Usage    StorePolicy   `mapstructure:"usage"`  // Usage ledger files
+	Logs     StorePolicy   `mapstructure:"logs"`   // Only max_mb applies; the log file is emptied when over it
+}
+
+// StorePolicy limits one kind of persisted data; zero values disable a limit
+type StorePolicy struct {
+	MaxAge time.Duration `mapstructure:"max_age"` // Delete files not modified for this long
+	MaxMB  int           `mapstructure:"max_mb"`  // Delete the oldest files while the store is larger
+}
+
+// DirPath returns the trace directory, defaulting to the data directory
+func (t TraceConfig) DirPath() (string, error) {
+	return dataSubdir(t.Dir, "traces")
+}
+
+// DirPath returns the dataset directory, defaulting to the data directory
+func (d DatasetConfig) DirPath() (string, error) {
+	return dataSubdir(d.Dir, "datasets")
+}
+
+// dataSubdir returns dir if set, else the named directory under the data directory
+func dataSubdir(dir, name string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, name), nil
+}
+
+// LogPath returns the server's log file in the platform's log directory, or in the temp
+// directory when that is unknown
+func LogPath() string {
+	dirs, err := paths.Current().Resolve()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "copilot-proxy.log")
+	}
+	return filepath.Join(dirs.Logs, "copilot-proxy.log")
+}
+
+// MetricsConfig controls persistence of cumulative counters across restarts
+type MetricsConfig struct {
+	StateFile     string        `mapstructure:"state_file"`     // Defaults to <data dir>/metrics.json
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // How often counters are saved; 0 disables persistence
+}
+
+// StatePath returns the metrics state file, defaulting to the data directory
+func (m MetricsConfig) StatePath() (string, error) {
+	if m.StateFile != "" {
+		return m.StateFile, nil
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "metrics.json"), nil
+}
+
+// ProfileConfig holds per-client response behavior. A request uses the profile named by its
+// X-Client-Profile header, else the one named after its authenticated client, else "default".
+type ProfileConfig struct {
+	SplitStream bool   `mapstructure:"split_stream"` // Send reasoning, content and tool calls as separate SSE event types
+	Annotations bool   `mapstructure:"annotations"`  // End streams with SSE comments giving tokens, cost and timing
+	Reasoning   string `mapstructure:"reasoning"`    // What OpenAI clients get of reasoning: passthrough (default), strip or merge
+
+	Environment EnvironmentConfig `mapstructure:"environment"` // System message stating the current date, time and environment
+}
+
+// CatalogViewConfig is the part of the model catalog a group of authenticated clients sees in
+// /api/tags and /v1/models and may request
+type CatalogViewConfig struct {
+	Clients []string          `mapstructure:"clients"` // Client names (key name or OIDC client claim)
+	Tenants []string          `mapstructure:"tenants"` // usage.export tenants whose clients get the view
+	Models  []string          `mapstructure:"models"`  // Catalog models listed under their own names
+	Aliases map[string]string `mapstructure:"aliases"` // Names listed instead of catalog models, e.g. fast: glm-4.7-flash
+}
+
+// EnvironmentConfig adds a system message with the current date and time, time zone, operating
+// system and the workspace named by the X-Workspace header to each conversation
+type EnvironmentConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Timezone string `mapstructure:"timezone"` // IANA name, e.g. "Europe/Warsaw" (default: the proxy's local zone)
+	Template string `mapstructure:"template"` // Overrides the message ({{.Date}}, {{.Time}}, {{.Weekday}}, {{.Timezone}}, {{.Offset}}, {{.OS}}, {{.Workspace}})
+}
+
+// PromptsConfig locates the prompt fragments messages reference with {"$include": "<name>"}
+type PromptsConfig struct {
+	Dir      string `mapstructure:"dir"`       // Defaults to <config dir>/prompts
+	MaxBytes int    `mapstructure:"max_bytes"` // Expanded size of all includes in one request; 0 for no limit
+}
+
+// DirPath returns the fragment directory
+func (p PromptsConfig) DirPath() (string, error) {
+	if p.Dir != "" {
+		return p.Dir, nil
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "prompts"), nil
+}
+
+// AssistConfig configures the commit message and PR description endpoints
+type AssistConfig struct {
+	Model        string `mapstructure:"model"`         // Model used when the request names none
+	CommitPrompt string `mapstructure:"commit_prompt"` // Template for commit messages ({{.Diff}}, {{.Context}})
+	PRPrompt     string `mapstructure:"pr_prompt"`     // Template for PR descriptions ({{.Diff}}, {{.Context}})
+}
+
+// EmbeddingsConfig controls the embeddings endpoints, which relay to the upstream embeddings API
+type EmbeddingsConfig struct {
+	BaseURL   string   `mapstructure:"base_url"`   // Defaults to the main base_url and its backups
+	Path      string   `mapstructure:"path"`       // Appended to the base URL
+	Models    []string `mapstructure:"models"`     // Embedding models clients may request
+	MaxInputs int      `mapstructure:"max_inputs"` // Texts per request
+}
+
+// AnthropicConfig maps the Claude model names of Anthropic Messages API clients to catalog models
+type AnthropicConfig struct {
+	Models     map[string]string `mapstructure:"models"`      // Claude model -> catalog model, taking precedence
+	Model      string            `mapstructure:"model"`       // Serves other Claude models
+	SmallModel string            `mapstructure:"small_model"` // Serves other Claude Haiku models
+}
+
+// AgentConfig controls the agent endpoint, where the proxy itself executes tool calls in a loop
+// with the model until it gives a final answer
+type AgentConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Model        string        `mapstructure:"model"`         // Model used when the request names none
+	MaxSteps     int           `mapstructure:"max_steps"`     // Model turns before the loop gives up
+	Timeout      time.Duration `mapstructure:"timeout"`       // Per tool call
+	MaxOutput    int           `mapstructure:"max_output"`    // Bytes of each tool result fed back to the model
+	Fetch        bool          `mapstructure:"fetch"`         // Offer http_fetch (public addresses only)
+	AllowPrivate bool          `mapstructure:"allow_private"` // Let http_fetch reach loopback and private addresses
+	Commands     []string      `mapstructure:"commands"`      // Programs run_command may start, run without a shell; requires sandbox_dir
+	SandboxDir   string        `mapstructure:"sandbox_dir"`   // Absolute directory read_file is confined to and commands run in
+
+	Tools []AgentToolConfig `mapstructure:"tools"` // Declared tools; declaring any drops the implicit read_file
+	Guard AgentGuardConfig  `mapstructure:"guard"` // Prompt injection checks on tool output
+}
+
+// AgentGuardConfig controls how tool output is checked for prompt injections before the model
+// sees it
+type AgentGuardConfig struct {
+	Policy   string   `mapstructure:"policy"`   // off, warn, strip or abort
+	Patterns []string `mapstructure:"patterns"` // Extra regular expressions treated as injections
+}
+
+// AgentToolConfig declares a tool of the agent endpoint, validated when the server starts
+type AgentToolConfig struct {
+	Name        string         `mapstructure:"name"`        // Function name shown to the model
+	Description string         `mapstructure:"description"` // Defaults to the executor's
+	Parameters  map[string]any `mapstructure:"parameters"`  // JSON Schema of the arguments object; defaults to the executor's
+	Executor    string         `mapstructure:"executor"`    // fetch, read_file or command
+	Timeout     time.Duration  `mapstructure:"timeout"`     // Overrides agent.timeout
+	Allowlist   []string       `mapstructure:"allowlist"`   // Host globs (fetch), path globs (read_file) or programs (command)
+	Guard       string         `mapstructure:"guard"`       // Overrides agent.guard.policy for this tool
+}
+
+// GitContextConfig controls the git-aware context endpoint; it is enabled when roots are configured
+type GitContextConfig struct {
+	Roots       []string `mapstructure:"roots"`        // Directories whose repositories may be read
+	TokenBudget int      `mapstructure:"token_budget"` // Default approximate context size in tokens
+	System      string   `mapstructure:"system"`       // System prompt placed before the gathered context
+}
+
+// RewriteRule edits the upstream body of matching chat requests. Field paths are
+// dot-separated, e.g. "thinking.type".
+type RewriteRule struct {
+	Name    string            `mapstructure:"name"`
+	Model   string            `mapstructure:"model"`   // Glob on the canonical model, e.g. "glm-4.7*"; empty matches all
+	Dialect string            `mapstructure:"dialect"` // openai or ollama; empty matches both
+	Headers map[string]string `mapstructure:"headers"` // Required request header values; "*" only requires presence
+	Set     map[string]any    `mapstructure:"set"`     // Field path -> value
+	Delete  []string          `mapstructure:"delete"`  // Field paths
+	Rename  map[string]string `mapstructure:"rename"`  // Field path -> new field path
+}
+
+// PluginConfig loads a WebAssembly plugin; plugins run in the order listed
+type PluginConfig struct {
+	Name        string        `mapstructure:"name"`
+	Path        string        `mapstructure:"path"`          // .wasm module
+	MaxMemoryMB int           `mapstructure:"max_memory_mb"` // Per instance (default 64)
+	Timeout     time.Duration `mapstructure:"timeout"`       // Per hook call (default 200ms)
+	Instances   int           `mapstructure:"instances"`     // Concurrent instances (default 4)
+	FailClosed  bool          `mapstructure:"fail_closed"`   // Reject requests when the request hook fails
+}
+
+// ScriptConfig loads a Lua hook script; scripts run in the order listed, after plugins
+type ScriptConfig struct {
+	Name       string        `mapstructure:"name"`
+	Path       string        `mapstructure:"path"`        // .lua file
+	Timeout    time.Duration `mapstructure:"timeout"`     // Per hook call (default 100ms)
+	States     int           `mapstructure:"states"`      // Concurrent interpreter states (default 4)
+	FailClosed bool          `mapstructure:"fail_closed"` // Reject requests when on_request fails
+}
+
+// HookConfig runs a command when a lifecycle event occurs, with the event as JSON on stdin
+type HookConfig struct {
+	Event   string        `mapstructure:"event"`   // server_start, upstream_outage, upstream_recovered, quota_exceeded or request_completed
+	Command string        `mapstructure:"command"` // Run by sh -c (cmd /C on Windows)
+	Tags    []string      `mapstructure:"tags"`    // request_completed only: run for requests tagged with one of these
+	Timeout time.Duration `mapstructure:"timeout"` // Default 10s
+}
+
+// PostProcessRule rewrites completion content before it reaches the client
+type PostProcessRule struct {
+	Name        string `mapstructure:"name"`
+	Type        string `mapstructure:"type"` // regex, replace, strip_fences or normalize_newlines
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement"`
+	Header      string `mapstructure:"header"` // Only apply when this request header is set
+}
+
+// LinksConfig checks the URLs in completions and marks or removes the ones that do not exist
+type LinksConfig struct {
+	Mode         string        `mapstructure:"mode"`          // off, annotate or strip; X-Link-Check can lower it per request
+	Timeout      time.Duration `mapstructure:"timeout"`       // Per link check (default 3s)
+	MaxLinks     int           `mapstructure:"max_links"`     // Links checked per response; later ones are left alone
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"`     // How long a link's result is reused
+	Marker       string        `mapstructure:"marker"`        // Appended after dead links in annotate mode
+	AllowPrivate bool          `mapstructure:"allow_private"` // Also check links to loopback and private addresses
+}
+
+// AttributionConfig controls marking of completions as AI-generated
+type AttributionConfig struct {
+	Header  bool     `mapstructure:"header"`  // Add X-Generated-By: copilot-proxy/<model>
+	Trailer string   `mapstructure:"trailer"` // Template appended to completion content ({{.Model}}, {{.Client}})
+	Clients []string `mapstructure:"clients"` // Restrict to these client names; empty applies to all
+}
+
+// AuthConfig controls inbound client authentication; it is enabled when any keys or an OIDC provider are configured
+type AuthConfig struct {
+	Keys    []ClientKey   `mapstructure:"keys"`
+	OIDC    OIDCConfig    `mapstructure:"oidc"`
+	Lockout LockoutConfig `mapstructure:"lockout"`
+	Quotas  QuotasConfig  `mapstructure:"quotas"`
+}
+
+// AdminConfig gives the admin the management endpoints, /metrics and /admin/*. With only a token
+// they are served with the API; with a listener, only there. Without either they are not served.
+type AdminConfig struct {
+	Token  string `mapstructure:"token"`  // Bearer token the management endpoints require; client keys are refused
+	Listen string `mapstructure:"listen"` // Serve the management endpoints only on this address, e.g. "127.0.0.1:9090"; without a token anyone reaching it is the admin
+}
+
+// OIDCConfig configures validation of inbound JWT bearer tokens issued by an OIDC provider
+type OIDCConfig struct {
+	Issuer      string `mapstructure:"issuer"`       // Expected "iss"; discovery base when jwks_url is empty
+	JWKSURL     string `mapstructure:"jwks_url"`     // Overrides discovery
+	Audience    string `mapstructure:"audience"`     // Expected "aud"; required
+	ClientClaim string `mapstructure:"client_claim"` // Claim used as client identity (default "sub")
+	ModelsClaim string `mapstructure:"models_claim"` // Claim listing allowed models (optional)
+	QuotaClaim  string `mapstructure:"quota_claim"`  // Claim holding a requests-per-minute quota (optional)
+}
+
+// Enabled reports whether JWT validation is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != "" || o.JWKSURL != ""
+}
+
+// ClientKey is a named API key accepted from clients
+type ClientKey struct {
+	Name string `json:"name" mapstructure:"name"`
+	Key  string `json:"key"  mapstructure:"key"`
+}
+
+// QuotasConfig caps the tokens and requests each authenticated client may use per UTC day and
+// calendar month. Usage is counted in the shared store, so replicas with a shared backend
+// enforce one budget.
+type QuotasConfig struct {
+	Default QuotaLimits            `mapstructure:"default"` // Applies to clients without limits of their own
+	Clients map[string]QuotaLimits `mapstructure:"clients"` // Keyed by client name (key name or OIDC client claim)
+}
+
+// QuotaLimits are one client's budgets; 0 leaves a budget unlimited
+type QuotaLimits struct {
+	DailyTokens     int64 `json:"daily_tokens" mapstructure:"daily_tokens"`         // Prompt plus completion tokens per UTC day
+	MonthlyTokens   int64 `json:"monthly_tokens" mapstructure:"monthly_tokens"`     // Prompt plus completion tokens per calendar month (UTC)
+	DailyRequests   int64 `json:"daily_requests" mapstructure:"daily_requests"`     // Chat requests per UTC day
+	MonthlyRequests int64 `json:"monthly_requests" mapstructure:"monthly_requests"` // Chat requests per calendar month (UTC)
+}
+
+// Enabled reports whether the quotas configure any budget
+func (q QuotasConfig) Enabled() bool {
+	if q.Default != (QuotaLimits{}) {
+		return true
+	}
+	for _, l := range q.Clients {
+		if l != (QuotaLimits{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the limits that apply to client. Names match case-insensitively, as the config
+// loader lowercases map keys.
+func (q QuotasConfig) For(client string) QuotaLimits {
+	if l, ok := q.Clients[client]; ok {
+		return l
+	}
+	for name, l := range q.Clients {
+		if strings.EqualFold(name, client) {
+			return l
+		}
+	}
+	return q.Default
+}
+
+// LockoutConfig controls brute-force protection for client authentication
+type LockoutConfig struct {
+	MaxFailures int           `mapstructure:"max_failures"` // Consecutive failures before a lockout
+	Base        time.Duration `mapstructure:"base"`         // First lockout; doubles on each repeat
+	Max         time.Duration `mapstructure:"max"`          // Upper bound for a single lockout
+}
+
+// Enabled reports whether client authentication is required
+func (a AuthConfig) Enabled() bool {
+	return len(a.Keys) > 0 || a.OIDC.Enabled()
+}
+
+// Validate checks that client keys are complete and unique
+func (a AuthConfig) Validate() error {
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for i, k := range a.Keys {
+		if k.Name == "" || k.Key == "" {
+			return fmt.Errorf("auth key %d: name and key are required", i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("auth key %d: duplicate name %q", i, k.Name)
+		}
+		if keys[k.Key] {
+			return fmt.Errorf("auth key %q: key is shared with another client", k.Name)
+		}
+		names[k.Name] = true
+		keys[k.Key] = true
+	}
+	if a.OIDC.Enabled() && a.OIDC.Audience == "" {
+		return fmt.Errorf("auth.oidc.audience is required; without it tokens the provider issues to other applications are accepted")
+	}
+	if a.Enabled() && a.Lockout.Base <= 0 {
+		return fmt.Errorf("auth lockout base must be positive")
+	}
+	if a.Quotas.Enabled() && !a.Enabled() {
+		return fmt.Errorf("quotas need client keys or OIDC to identify clients")
+	}
+	for name, l := range a.Quotas.Clients {
+		if l.DailyTokens < 0 || l.MonthlyTokens < 0 || l.DailyRequests < 0 || l.MonthlyRequests < 0 {
+			return fmt.Errorf("quotas for %q must not be negative", name)
+		}
+	}
+	if d := a.Quotas.Default; d.DailyTokens < 0 || d.MonthlyTokens < 0 || d.DailyRequests < 0 || d.MonthlyRequests < 0 {
+		return fmt.Errorf("default quotas must not be negative")
+	}
+	return nil
+}
+
+// RateLimitConfig controls per-source-IP token-bucket rate limiting
+type RateLimitConfig struct {
+	Enabled           bool    `mapstructure:"enabled"`
+	RequestsPerMinute float64 `mapstructure:"requests_per_minute"` // Sustained rate
+	Burst             int     `mapstructure:"burst"`               // Requests allowed back-to-back
+}
+
+// DuplicatesConfig controls rejection of identical requests repeated by a misbehaving client
+type DuplicatesConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	MaxRepeats int           `mapstructure:"max_repeats"` // Identical requests allowed per window
+	Window     time.Duration `mapstructure:"window"`
+	WebhookURL string        `mapstructure:"webhook_url"` // Receives a JSON alert when a storm starts (optional)
+}
+
+// AnomalyConfig controls alerts on token usage spikes against a rolling hourly baseline
+type AnomalyConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	Multiplier    float64 `mapstructure:"multiplier"`     // Alert when this hour exceeds the baseline by this factor
+	BaselineHours int     `mapstructure:"baseline_hours"` // Preceding hours averaged into the baseline
+	MinTokens     int     `mapstructure:"min_tokens"`     // Hours below this many tokens never alert
+	WebhookURL    string  `mapstructure:"webhook_url"`    // Receives a JSON alert (optional)
+}
+
+// SLOConfig controls per-model latency objectives and alerts when their error budget burns fast.
+// An objective is burning when both windows spend the budget at least BurnRate times faster
+// than the objective allows.
+type SLOConfig struct {
+	Enabled     bool           `mapstructure:"enabled"`
+	Objectives  []SLOObjective `mapstructure:"objectives"`
+	LongWindow  time.Duration  `mapstructure:"long_window"`
+	ShortWindow time.Duration  `mapstructure:"short_window"`
+	BurnRate    float64        `mapstructure:"burn_rate"`    // 14.4 spends 2% of a 30-day budget in an hour
+	MinRequests int            `mapstructure:"min_requests"` // Short windows with fewer requests never alert
+	WebhookURL  string         `mapstructure:"webhook_url"`  // Receives a JSON alert when burning starts and stops (optional)
+}
+
+// SLOObjective is a latency objective, e.g. 95% of requests to glm-4.* complete within 30s.
+// Upstream errors count against the objective; client errors are left out.
+type SLOObjective struct {
+	Name      string        `mapstructure:"name"`
+	Model     string        `mapstructure:"model"`     // Model glob; empty matches every model
+	Objective float64       `mapstructure:"objective"` // Fraction of good requests, e.g. 0.95
+	Threshold time.Duration `mapstructure:"threshold"` // Good requests complete within this
+}
+
+// Validate checks that objectives are named uniquely and that windows and targets make sense
+func (s SLOConfig) Validate() error {
+	if len(s.Objectives) == 0 {
+		return fmt.Errorf("at least one objective is required")
+	}
+	if s.ShortWindow <= 0 || s.LongWindow < s.ShortWindow {
+		return fmt.Errorf("short_window must be positive and no longer than long_window")
+	}
+	if s.BurnRate <= 0 {
+		return fmt.Errorf("burn_rate must be positive")
+	}
+	names := make(map[string]bool)
+	for i, o := range s.Objectives {
+		if o.Name == "" || names[o.Name] {
+			return fmt.Errorf("objective %d: name must be set and unique", i)
+		}
+		names[o.Name] = true
+		if _, err := path.Match(o.Model, ""); err != nil {
+			return fmt.Errorf("objective %q: invalid model pattern %q", o.Name, o.Model)
+		}
+		if o.Objective <= 0 || o.Objective >= 1 || o.Threshold <= 0 {
+			return fmt.Errorf("objective %q: objective must be between 0 and 1 and threshold positive", o.Name)
+		}
+	}
+	return nil
+}
+
+// DatasetConfig controls mirroring of prompt/response pairs to JSONL files
+type DatasetConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Dir       string `mapstructure:"dir"`        // Defaults to <data dir>/datasets
+	RedactPII bool   `mapstructure:"redact_pii"` // Replace emails, phone numbers, etc. before writing
+}
+
+// JobConfig describes a named prompt template run against a model on a cron schedule
+type JobConfig struct {
+	Name       string `json:"name"                  mapstructure:"name"`
+	Schedule   string `json:"schedule"              mapstructure:"schedule"` // Cron expression, e.g. "0 9 * * 1-5" or "@daily"
+	Model      string `json:"model"                 mapstructure:"model"`
+	System     string `json:"system,omitempty"      mapstructure:"system"`
+	Prompt     string `json:"prompt"                mapstructure:"prompt"`      // Go text/template, see scheduler.TemplateData
+	OutputFile string `json:"output_file,omitempty" mapstructure:"output_file"` // Path template; output is appended
+	WebhookURL string `json:"webhook_url,omitempty" mapstructure:"webhook_url"`
+	Retries    int    `json:"retries,omitempty"     mapstructure:"retries"` // Extra attempts on transient failures
 }
 
 // DefaultConfig returns the default configuration
@@ -40,6 +867,59 @@ func Load() (*Config, error) {
 	v.SetDefault("host", defaultCfg.Host)
 	v.SetDefault("port", defaultCfg.Port)
 	v.SetDefault("debug", defaultCfg.Debug)
+	v.SetDefault("log_privacy", defaultCfg.LogPrivacy)
+	v.SetDefault("endpoints.reprobe_interval", "30s")
+	v.SetDefault("dataset.redact_pii", true)
+	v.SetDefault("rate_limit.requests_per_minute", 60)
+	v.SetDefault("rate_limit.burst", 10)
+	v.SetDefault("duplicates.max_repeats", 5)
+	v.SetDefault("duplicates.window", "1m")
+	v.SetDefault("anomalies.multiplier", 3)
+	v.SetDefault("anomalies.baseline_hours", 24)
+	v.SetDefault("anomalies.min_tokens", 100000)
+	v.SetDefault("slo.long_window", "1h")
+	v.SetDefault("slo.short_window", "5m")
+	v.SetDefault("slo.burn_rate", 14.4)
+	v.SetDefault("slo.min_requests", 10)
+	v.SetDefault("auth.lockout.max_failures", 5)
+	v.SetDefault("auth.lockout.base", "30s")
+	v.SetDefault("auth.lockout.max", "1h")
+	v.SetDefault("auth.oidc.client_claim", "sub")
+	v.SetDefault("git_context.token_budget", 8000)
+	v.SetDefault("prompts.max_bytes", 262144)
+	v.SetDefault("links.mode", "off")
+	v.SetDefault("links.timeout", "3s")
+	v.SetDefault("links.max_links", 20)
+	v.SetDefault("links.cache_ttl", "10m")
+	v.SetDefault("links.marker", " [dead link]")
+	v.SetDefault("assist.model", "GLM-4.7-Flash")
+	v.SetDefault("anthropic.model", "GLM-4.7")
+	v.SetDefault("anthropic.small_model", "GLM-4.7-Flash")
+	v.SetDefault("embeddings.path", "/embeddings")
+	v.SetDefault("embeddings.models", []string{"embedding-3", "embedding-2"})
+	v.SetDefault("embeddings.max_inputs", 64)
+	v.SetDefault("agent.model", "GLM-4.7")
+	v.SetDefault("agent.max_steps", 8)
+	v.SetDefault("agent.timeout", "30s")
+	v.SetDefault("agent.max_output", 16000)
+	v.SetDefault("agent.guard.policy", "warn")
+	v.SetDefault("metrics.flush_interval", "1m")
+	v.SetDefault("trace.header", "X-Debug-Trace")
+	v.SetDefault("trace.retention", "24h")
+	v.SetDefault("tool_validation", "basic")
+	v.SetDefault("placeholder_models", []string{"default", "gpt-3.5-turbo", "gpt-4", "gpt-4-turbo", "gpt-4o", "gpt-4o-mini"})
+	v.SetDefault("buffered_user_agents", []string{"WindowsPowerShell/"})
+	v.SetDefault("retention.interval", "1h")
+	v.SetDefault("retention.logs.max_mb", 100)
+	v.SetDefault("usage.export.format", "csv")
+	v.SetDefault("storage.backend", "memory")
+	v.SetDefault("storage.redis.addr", "127.0.0.1:6379")
+	v.SetDefault("storage.redis.prefix", "copilot-proxy:")
+	v.SetDefault("storage.redis.timeout", "2s")
+	v.SetDefault("usage.export.s3.region", "us-east-1")
+	v.SetDefault("tool_results.mode", "truncate")
+	v.SetDefault("retry.max_attempts", 3)
+	v.SetDefault("tool_results.model", "GLM-4.7-Flash")
 
 	// Set config file name and paths
 	v.SetConfigName("config")
@@ -62,6 +942,9 @@ func Load() (*Config, error) {
 	_ = v.BindEnv("host", "ZAI_HOST")
 	_ = v.BindEnv("port", "ZAI_PORT")
 	_ = v.BindEnv("debug", "ZAI_DEBUG")
+	_ = v.BindEnv("log_privacy", "ZAI_LOG_PRIVACY")
+	_ = v.BindEnv("locale", "ZAI_LOCALE")
+	_ = v.BindEnv("admin.token", "ZAI_ADMIN_TOKEN")
 
 	// Try to read config file (ignore if not found)
 	if err := v.ReadInConfig(); err != nil {
@@ -72,11 +955,36 @@ func Load() (*Config, error) {
 		// Config file not found, that's ok - we'll use defaults/env vars
 	}
 
-	// Unmarshal config
+	// Upgrade settings written for older versions in memory; `config migrate` rewrites the file
+	var migrations []string
+	if file := v.ConfigFileUsed(); file != "" {
+		raw, err := readFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		if migrations, err = Migrate(raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(migrations) > 0 {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate config: %w", err)
+			}
+			if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("failed to migrate config: %w", err)
+			}
+		}
+	}
+
+	// Unmarshal config, collecting settings that no field reads
 	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
+	var md mapstructure.Metadata
+	if err := v.Unmarshal(&cfg, func(dc *mapstructure.DecoderConfig) { dc.Metadata = &md }); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	cfg.Migrations = migrations
+	cfg.UnknownKeys = md.Unused
+	slices.Sort(cfg.UnknownKeys)
 
 	// Get API key from environment variables (highest precedence)
 	if apiKey := getAPIKeyFromEnv(); apiKey != "" {
@@ -104,12 +1012,38 @@ func Save(cfg *Config) error {
 	v.SetConfigType("json")
 	v.AddConfigPath(configDir)
 
+	// Start from the existing file so file-only settings (e.g. jobs) survive a save, upgrading
+	// them first so the file is written in the current schema
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return fmt.Errorf("error reading config file: %w", err)
+		}
+	} else {
+		raw, err := readFile(v.ConfigFileUsed())
+		if err != nil {
+			return fmt.Errorf("error reading config file: %w", err)
+		}
+		if _, err := Migrate(raw); err != nil {
+			return fmt.Errorf("%s: %w", v.ConfigFileUsed(), err)
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("failed to migrate config: %w", err)
+		}
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to migrate config: %w", err)
+		}
+	}
+	v.Set("config_version", Version)
+
 	// Set values
 	v.Set("api_key", cfg.APIKey)
 	v.Set("base_url", cfg.BaseURL)
 	v.Set("host", cfg.Host)
 	v.Set("port", cfg.Port)
 	v.Set("debug", cfg.Debug)
+	v.Set("log_privacy", cfg.LogPrivacy)
+	v.Set("locale", cfg.Locale)
 
 	// Write config file
 	configPath := filepath.Join(configDir, "config.json")
@@ -120,18 +1054,57 @@ func Save(cfg *Config) error {
 	return nil
 }
 
-// getConfigDir returns the configuration directory path (XDG-compliant)
+// getConfigDir returns the configuration directory for the platform
 func getConfigDir() (string, error) {
-	// Check XDG_CONFIG_HOME first
-	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
-		return filepath.Join(configHome, "copilot-proxy"), nil
-	}
-	// Default to ~/.config/copilot-proxy
-	homeDir, err := os.UserHomeDir()
+	dirs, err := paths.Current().Resolve()
+	return dirs.Config, err
+}
+
+// ConfigPath returns the config file, whether or not it exists
+func ConfigPath() (string, error) {
+	configDir, err := getConfigDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, ".config", "copilot-proxy"), nil
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// CatalogPath returns the model catalog file to load: models_file, or else the first of
+// models.json, models.yaml and models.yml found in the config directory. It returns "" when
+// there is none.
+func (c *Config) CatalogPath() string {
+	if c.ModelsFile != "" {
+		return c.ModelsFile
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"models.json", "models.yaml", "models.yml"} {
+		path := filepath.Join(configDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// dataDirOverride replaces the platform data directory when set
+var dataDirOverride string
+
+// SetDataDir makes dir the data directory of this process, as --data-dir does
+func SetDataDir(dir string) {
+	dataDirOverride = dir
+}
+
+// DataDir returns the directory for persisted data: the --data-dir override, or the
+// platform's data directory
+func DataDir() (string, error) {
+	if dataDirOverride != "" {
+		return dataDirOverride, nil
+	}
+	dirs, err := paths.Current().Resolve()
+	return dirs.Data, err
 }
 
 // getAPIKeyFromEnv checks multiple environment variable names for API key
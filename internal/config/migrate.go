@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Version is the schema version of the config file this build reads and writes. Files without
+// a config_version are version 1.
+const Version = 2
+
+// migration upgrades the settings of a config file from one schema version to the next
+type migration struct {
+	from  int
+	apply func(raw map[string]any) []string // Edits raw in place, describing each change
+}
+
+// migrations run in order on files older than Version
+var migrations = []migration{
+	{from: 1, apply: moveConnectTimeout},
+}
+
+// Migrate upgrades the settings of a config file to Version in place and describes each
+// setting it changed. Files written by a newer build are refused rather than guessed at.
+func Migrate(raw map[string]any) ([]string, error) {
+	version, err := fileVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version > Version {
+		return nil, fmt.Errorf("config_version %d is newer than this build supports (%d); upgrade copilot-proxy", version, Version)
+	}
+
+	var changes []string
+	for _, m := range migrations {
+		if m.from >= version {
+			changes = append(changes, m.apply(raw)...)
+		}
+	}
+	delete(raw, key(raw, "config_version"))
+	raw["config_version"] = Version
+	return changes, nil
+}
+
+// fileVersion returns the config_version of a config file
+func fileVersion(raw map[string]any) (int, error) {
+	v, ok := raw[key(raw, "config_version")]
+	if !ok {
+		return 1, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		if n == float64(int(n)) && n >= 1 {
+			return int(n), nil
+		}
+	case int:
+		if n >= 1 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("config_version must be a positive integer, got %v", v)
+}
+
+// key returns the spelling of name used in raw; settings are case-insensitive
+func key(raw map[string]any, name string) string {
+	for k := range raw {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+// section returns the nested settings under name, creating them when create is set
+func section(raw map[string]any, name string, create bool) map[string]any {
+	if m, ok := raw[key(raw, name)].(map[string]any); ok {
+		return m
+	}
+	if !create {
+		return nil
+	}
+	m := make(map[string]any)
+	raw[name] = m
+	return m
+}
+
+// moveConnectTimeout moves endpoints.connect_timeout, which transport.dial_timeout replaced
+func moveConnectTimeout(raw map[string]any) []string {
+	endpoints := section(raw, "endpoints", false)
+	old := key(endpoints, "connect_timeout")
+	timeout, ok := endpoints[old]
+	if !ok {
+		return nil
+	}
+	delete(endpoints, old)
+
+	transport := section(raw, "transport", true)
+	if _, set := transport[key(transport, "dial_timeout")]; set {
+		return []string{"removed endpoints.connect_timeout; transport.dial_timeout is already set"}
+	}
+	transport["dial_timeout"] = timeout
+	return []string{fmt.Sprintf("moved endpoints.connect_timeout (%v) to transport.dial_timeout", timeout)}
+}
+
+// readFile decodes a JSON config file, keeping the spelling of its keys
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]any)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return raw, nil
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return raw, nil
+}
+
+// MigrationResult describes the migration of a config file
+type MigrationResult struct {
+	Path    string
+	From    int      // Version of the file before migration
+	Changes []string // Settings that were moved, renamed or removed
+}
+
+// MigrateFile upgrades the config file to Version. Unless dryRun is set, an older file is
+// rewritten, keeping the original as <file>.bak.
+func MigrateFile(dryRun bool) (MigrationResult, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return MigrationResult{}, fmt.Errorf("failed to get config directory: %w", err)
+	}
+	res := MigrationResult{Path: path}
+	raw, err := readFile(res.Path)
+	if err != nil {
+		return res, err
+	}
+	if res.From, err = fileVersion(raw); err != nil {
+		return res, err
+	}
+	if res.Changes, err = Migrate(raw); err != nil || dryRun || res.From == Version {
+		return res, err
+	}
+
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return res, err
+	}
+	original, err := os.ReadFile(res.Path)
+	if err != nil {
+		return res, err
+	}
+	if err := os.WriteFile(res.Path+".bak", original, 0600); err != nil {
+		return res, fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := os.WriteFile(res.Path, append(data, '\n'), 0600); err != nil {
+		return res, fmt.Errorf("failed to write config file: %w", err)
+	}
+	return res, nil
+}
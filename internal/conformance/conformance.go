@@ -0,0 +1,442 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/sse"
+)
+
+// prompt is the chat message sent by the completion checks; it keeps answers short
+const prompt = "Reply with the single word: ok"
+
+// maxTokens caps the completions requested by the checks
+const maxTokens = 64
+
+// maxBody bounds the response bodies read by the checks
+const maxBody = 4 << 20
+
+// maxViolations is the number of schema violations reported per check
+const maxViolations = 3
+
+// unknownModel is requested by the error checks; no catalog names it
+const unknownModel = "conformance-no-such-model"
+
+// Result is the outcome of one check
+type Result struct {
+	Check   string
+	Passed  bool
+	Detail  string // Why the check failed
+	Elapsed time.Duration
+}
+
+// Runner sends a dialect's checks to a running proxy
+type Runner struct {
+	BaseURL string // Proxy address, e.g. http://127.0.0.1:11434
+	APIKey  string // Client key, sent as a Bearer token when set
+	Model   string // Model requested by the completion checks
+	Client  *http.Client
+}
+
+// check is one request against the proxy with the expectations on its response
+type check struct {
+	name string
+	run  func(ctx context.Context, r *Runner) error
+}
+
+// suites holds the checks of each dialect, in the order they run
+var suites = map[string][]check{
+	"openai": {
+		{"models.list", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "GET", "/v1/models", nil, nil, http.StatusOK, "openai.model_list")
+			return err
+		}},
+		{"models.retrieve", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "GET", "/v1/models/"+r.Model, nil, nil, http.StatusOK, "openai.model")
+			return err
+		}},
+		{"chat.completion", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "POST", "/v1/chat/completions", r.openAIChat(false), nil, http.StatusOK, "openai.chat_completion")
+			return err
+		}},
+		{"chat.completion.stream", func(ctx context.Context, r *Runner) error {
+			return r.expectOpenAIStream(ctx, "/v1/chat/completions", r.openAIChat(true))
+		}},
+		{"error.unknown_model", func(ctx context.Context, r *Runner) error {
+			body := r.openAIChat(false)
+			body["model"] = unknownModel
+			_, err := r.expectJSON(ctx, "POST", "/v1/chat/completions", body, nil, http.StatusNotFound, "openai.error")
+			return err
+		}},
+	},
+	"ollama": {
+		{"tags", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "GET", "/api/tags", nil, nil, http.StatusOK, "ollama.tags")
+			return err
+		}},
+		{"version", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "GET", "/api/version", nil, nil, http.StatusOK, "ollama.version")
+			return err
+		}},
+		{"ps", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "GET", "/api/ps", nil, nil, http.StatusOK, "ollama.ps")
+			return err
+		}},
+		{"show", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "POST", "/api/show", map[string]any{"model": r.Model}, nil, http.StatusOK, "ollama.show")
+			return err
+		}},
+		{"chat", func(ctx context.Context, r *Runner) error {
+			doc, err := r.expectJSON(ctx, "POST", "/api/chat", r.ollamaChat(false), nil, http.StatusOK, "ollama.chat")
+			if err == nil && doc.(map[string]any)["done"] != true {
+				return errors.New("non-streaming response has done=false")
+			}
+			return err
+		}},
+		{"chat.stream", func(ctx context.Context, r *Runner) error {
+			return r.expectOllamaStream(ctx, "/api/chat", r.ollamaChat(true))
+		}},
+	},
+	"anthropic": {
+		{"messages", func(ctx context.Context, r *Runner) error {
+			_, err := r.expectJSON(ctx, "POST", "/v1/messages", r.anthropicMessage(false), anthropicHeader(), http.StatusOK, "anthropic.message")
+			return err
+		}},
+		{"messages.stream", func(ctx context.Context, r *Runner) error {
+			return r.expectAnthropicStream(ctx, "/v1/messages", r.anthropicMessage(true))
+		}},
+		{"error.unknown_model", func(ctx context.Context, r *Runner) error {
+			body := r.anthropicMessage(false)
+			body["model"] = unknownModel
+			_, err := r.expectJSON(ctx, "POST", "/v1/messages", body, anthropicHeader(), http.StatusNotFound, "anthropic.error")
+			return err
+		}},
+	},
+}
+
+// Dialects lists the dialects that have checks
+func Dialects() []string {
+	return []string{"openai", "ollama", "anthropic"}
+}
+
+// Run sends the checks of a dialect in order and returns their results. It fails only for an
+// unknown dialect or when the proxy cannot be reached.
+func (r *Runner) Run(ctx context.Context, dialect string) ([]Result, error) {
+	checks, ok := suites[dialect]
+	if !ok {
+		return nil, fmt.Errorf("unknown dialect '%s' (use one of %s)", dialect, strings.Join(Dialects(), ", "))
+	}
+
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		start := time.Now()
+		err := c.run(ctx, r)
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, fmt.Errorf("cannot reach the proxy at %s: %w", r.BaseURL, err)
+		}
+
+		result := Result{Check: c.name, Passed: err == nil, Elapsed: time.Since(start)}
+		if err != nil {
+			result.Detail = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// openAIChat builds a chat completion request
+func (r *Runner) openAIChat(stream bool) map[string]any {
+	return map[string]any{
+		"model":      r.Model,
+		"messages":   []any{map[string]any{"role": "user", "content": prompt}},
+		"max_tokens": maxTokens,
+		"stream":     stream,
+	}
+}
+
+// ollamaChat builds an Ollama chat request
+func (r *Runner) ollamaChat(stream bool) map[string]any {
+	return map[string]any{
+		"model":    r.Model,
+		"messages": []any{map[string]any{"role": "user", "content": prompt}},
+		"stream":   stream,
+		"options":  map[string]any{"num_predict": maxTokens},
+	}
+}
+
+// anthropicMessage builds an Anthropic Messages request
+func (r *Runner) anthropicMessage(stream bool) map[string]any {
+	return map[string]any{
+		"model":      r.Model,
+		"max_tokens": maxTokens,
+		"messages":   []any{map[string]any{"role": "user", "content": prompt}},
+		"stream":     stream,
+	}
+}
+
+// anthropicHeader carries the API version Anthropic clients send with every request
+func anthropicHeader() http.Header {
+	return http.Header{"Anthropic-Version": {"2023-06-01"}}
+}
+
+// send makes a request to the proxy with an optional JSON body
+func (r *Runner) send(ctx context.Context, method, path string, body any, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.BaseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// expectJSON makes a request and checks the response status, content type and body schema. It
+// returns the decoded body for further checks.
+func (r *Runner) expectJSON(ctx context.Context, method, path string, body any, header http.Header, status int, schema string) (any, error) {
+	resp, err := r.send(ctx, method, path, body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != status {
+		return nil, fmt.Errorf("status %d, want %d: %.200s", resp.StatusCode, status, bytes.TrimSpace(data))
+	}
+	if err := expectMediaType(resp, "application/json"); err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return doc, validate(schema, doc)
+}
+
+// openStream makes a streaming request and checks the response status and content type
+func (r *Runner) openStream(ctx context.Context, path string, body any, header http.Header, mediaType string) (*http.Response, error) {
+	resp, err := r.send(ctx, "POST", path, body, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d, want %d: %.200s", resp.StatusCode, http.StatusOK, bytes.TrimSpace(data))
+	}
+	if err := expectMediaType(resp, mediaType); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// expectOpenAIStream checks that a streaming chat completion is a sequence of chunk events
+// ended by [DONE]
+func (r *Runner) expectOpenAIStream(ctx context.Context, path string, body any) error {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	resp, err := r.openStream(ctx, path, body, header, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	reader := sse.NewReader(io.LimitReader(resp.Body, maxBody))
+	chunks, done := 0, false
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if ev.Data == "" {
+			continue // Comments such as keep-alives
+		}
+		if done {
+			return fmt.Errorf("event after [DONE]: %.200s", ev.Data)
+		}
+		if ev.IsDone() {
+			done = true
+			continue
+		}
+
+		chunks++
+		if err := validateJSON("openai.chat_completion_chunk", ev.Data); err != nil {
+			return fmt.Errorf("chunk %d: %w", chunks, err)
+		}
+	}
+
+	switch {
+	case chunks == 0:
+		return errors.New("stream has no chunks")
+	case !done:
+		return errors.New("stream did not end with data: [DONE]")
+	}
+	return nil
+}
+
+// expectOllamaStream checks that a streaming Ollama chat is newline-delimited JSON ended by a
+// line with done=true
+func (r *Runner) expectOllamaStream(ctx context.Context, path string, body any) error {
+	resp, err := r.openStream(ctx, path, body, nil, "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxBody))
+	scanner.Buffer(make([]byte, 64*1024), maxBody)
+	lines, done := 0, false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if done {
+			return fmt.Errorf("line after done=true: %.200s", line)
+		}
+
+		lines++
+		var doc map[string]any
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			return fmt.Errorf("line %d: invalid JSON: %v", lines, err)
+		}
+		if err := validate("ollama.chat", doc); err != nil {
+			return fmt.Errorf("line %d: %w", lines, err)
+		}
+		done = doc["done"] == true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !done {
+		return errors.New("stream did not end with a done=true line")
+	}
+	return nil
+}
+
+// expectAnthropicStream checks that a streaming message is a sequence of typed events from
+// message_start to message_stop
+func (r *Runner) expectAnthropicStream(ctx context.Context, path string, body any) error {
+	header := anthropicHeader()
+	header.Set("Accept", "text/event-stream")
+	resp, err := r.openStream(ctx, path, body, header, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	reader := sse.NewReader(io.LimitReader(resp.Body, maxBody))
+	var types []string
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if ev.Data == "" {
+			continue
+		}
+
+		var doc map[string]any
+		if err := json.Unmarshal([]byte(ev.Data), &doc); err != nil {
+			return fmt.Errorf("event %d: invalid JSON: %v", len(types)+1, err)
+		}
+		typ, _ := doc["type"].(string)
+		if typ != ev.Event {
+			return fmt.Errorf("event %d: data type '%s' does not match event name '%s'", len(types)+1, typ, ev.Event)
+		}
+		if _, ok := schemas["anthropic.event."+typ]; !ok {
+			return fmt.Errorf("event %d: unknown event type '%s'", len(types)+1, typ)
+		}
+		if err := validate("anthropic.event."+typ, doc); err != nil {
+			return fmt.Errorf("event %d: %w", len(types)+1, err)
+		}
+		if typ == "error" {
+			return fmt.Errorf("stream error: %.200s", ev.Data)
+		}
+		types = append(types, typ)
+	}
+
+	switch {
+	case len(types) == 0 || types[0] != "message_start":
+		return errors.New("stream does not begin with message_start")
+	case types[len(types)-1] != "message_stop":
+		return errors.New("stream does not end with message_stop")
+	case !slices.Contains(types, "message_delta"):
+		return errors.New("stream has no message_delta")
+	}
+	return nil
+}
+
+// expectMediaType checks the media type of a response, ignoring its parameters
+func expectMediaType(resp *http.Response, want string) error {
+	got, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if got != want {
+		return fmt.Errorf("content type '%s', want '%s'", got, want)
+	}
+	return nil
+}
+
+// validateJSON decodes a JSON document and checks it against a named schema
+func validateJSON(schema, data string) error {
+	var doc any
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return validate(schema, doc)
+}
+
+// validate checks a decoded document against a named schema, reporting the first violations
+func validate(schema string, doc any) error {
+	violations := schemas[schema].Validate(doc)
+	if len(violations) == 0 {
+		return nil
+	}
+	if extra := len(violations) - maxViolations; extra > 0 {
+		violations = append(violations[:maxViolations], fmt.Sprintf("%d more", extra))
+	}
+	return fmt.Errorf("%s: %s", schema, strings.Join(violations, "; "))
+}
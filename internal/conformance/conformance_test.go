@@ -0,0 +1,198 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSchemaValidate tests types, required properties, enums, items and references
+func TestSchemaValidate(t *testing.T) {
+	decode := func(s string) any {
+		var v any
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("Invalid test JSON %s: %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		want   []string
+	}{
+		{"valid", "openai.model_list", `{"object":"list","data":[{"id":"m","object":"model","created":1,"owned_by":"z"}]}`, nil},
+		{"enum", "openai.model_list", `{"object":"lists","data":[{"id":"m","object":"model","created":1,"owned_by":"z"}]}`,
+			[]string{`$.object: "lists" is not one of ["list"]`}},
+		{"min items", "openai.model_list", `{"object":"list","data":[]}`, []string{"$.data: got 0 items, want at least 1"}},
+		{"reference", "openai.model_list", `{"object":"list","data":[{"id":"m","object":"model","created":1.5}]}`,
+			[]string{"$.data[0]: missing required property 'owned_by'", "$.data[0].created: got number, want integer"}},
+		{"type", "ollama.version", `[]`, []string{"$: got array, want object"}},
+		{"nullable", "openai.chat_completion_chunk", `{"id":"c","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"content":null},"finish_reason":null}]}`, nil},
+		{"string or object", "openai.error", `{"error":"model not found"}`, nil},
+		{"object of several types", "openai.error", `{"error":{"type":"invalid_request_error"}}`, []string{"$.error: missing required property 'message'"}},
+		{"null enum", "anthropic.event.message_start", `{"type":"message_start","message":{"id":"m","type":"message","role":"assistant","content":[],"model":"m","stop_reason":null,"usage":{"input_tokens":1,"output_tokens":0}}}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schemas[tt.schema].Validate(decode(tt.doc))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaReferences tests that every reference names a schema
+func TestSchemaReferences(t *testing.T) {
+	var walk func(name string, s *Schema)
+	walk = func(name string, s *Schema) {
+		if s.Ref != "" {
+			if _, ok := schemas[s.Ref]; !ok {
+				t.Errorf("Schema %s references unknown schema %s", name, s.Ref)
+			}
+		}
+		for _, p := range s.Properties {
+			walk(name, p)
+		}
+		if s.Items != nil {
+			walk(name, s.Items)
+		}
+	}
+	for name, s := range schemas {
+		walk(name, s)
+	}
+}
+
+// conformingProxy answers the OpenAI checks the way a conforming server does; broken names
+// paths that answer with a malformed body instead
+func conformingProxy(broken string) *httptest.Server {
+	model := `{"id":"GLM-4.7-Flash","object":"model","created":1700000000,"owned_by":"z-ai"}`
+	mux := http.NewServeMux()
+	reply := func(path string, status int, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(status)
+			if path == broken {
+				body = `{"object":"something"}`
+			}
+			fmt.Fprint(w, body)
+		})
+	}
+
+	reply("GET /v1/models", http.StatusOK, `{"object":"list","data":[`+model+`]}`)
+	reply("GET /v1/models/GLM-4.7-Flash", http.StatusOK, model)
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case req["model"] == unknownModel:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model not found"}`)
+		case req["stream"] == true:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\n")
+			fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","created":1,"model":"glm-4.7-flash","choices":[{"index":0,"delta":{"role":"assistant","content":"ok"},"finish_reason":null}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","created":1,"model":"glm-4.7-flash","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+			if broken != "stream" {
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"c","object":"chat.completion","created":1,"model":"glm-4.7-flash",`+
+				`"choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],`+
+				`"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+// TestRun tests that a conforming server passes and each kind of deviation fails its check
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		broken string
+		failed string
+		detail string
+	}{
+		{"conforming", "", "", ""},
+		{"malformed body", "GET /v1/models", "models.list", "openai.model_list: $: missing required property 'data'"},
+		{"unterminated stream", "stream", "chat.completion.stream", "stream did not end with data: [DONE]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := conformingProxy(tt.broken)
+			defer srv.Close()
+
+			r := &Runner{BaseURL: srv.URL, APIKey: "key", Model: "GLM-4.7-Flash"}
+			results, err := r.Run(context.Background(), "openai")
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if len(results) != len(suites["openai"]) {
+				t.Fatalf("Got %d results, want %d", len(results), len(suites["openai"]))
+			}
+			for _, res := range results {
+				wantPass := res.Check != tt.failed
+				if res.Passed != wantPass {
+					t.Errorf("Check %s passed = %v, want %v (%s)", res.Check, res.Passed, wantPass, res.Detail)
+				}
+				if !res.Passed && !strings.Contains(res.Detail, tt.detail) {
+					t.Errorf("Check %s detail = %q, want it to contain %q", res.Check, res.Detail, tt.detail)
+				}
+			}
+		})
+	}
+}
+
+// TestRunMissingEndpoint tests that a dialect the server does not serve fails every check
+func TestRunMissingEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	r := &Runner{BaseURL: srv.URL, Model: "GLM-4.7-Flash"}
+	results, err := r.Run(context.Background(), "anthropic")
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	for _, res := range results {
+		if res.Passed {
+			t.Errorf("Check %s passed against a server without /v1/messages", res.Check)
+		}
+	}
+}
+
+// TestRunErrors tests unknown dialects and unreachable servers
+func TestRunErrors(t *testing.T) {
+	r := &Runner{BaseURL: "http://127.0.0.1:1", Model: "GLM-4.7-Flash"}
+	if _, err := r.Run(context.Background(), "cohere"); err == nil || !strings.Contains(err.Error(), "unknown dialect") {
+		t.Errorf("Expected unknown dialect error, got %v", err)
+	}
+	if _, err := r.Run(context.Background(), "openai"); err == nil || !strings.Contains(err.Error(), "cannot reach the proxy") {
+		t.Errorf("Expected unreachable proxy error, got %v", err)
+	}
+}
+
+// TestDialects tests that every dialect has a suite
+func TestDialects(t *testing.T) {
+	for _, d := range Dialects() {
+		if len(suites[d]) == 0 {
+			t.Errorf("Dialect %s has no checks", d)
+		}
+	}
+	if len(suites) != len(Dialects()) {
+		t.Errorf("Got %d suites, want %d", len(suites), len(Dialects()))
+	}
+}
@@ -0,0 +1,145 @@
+package conformance
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// schemasJSON holds the response schemas of each dialect, transcribed from the published API
+// references. Each schema is named "<dialect>.<object>".
+//
+//go:embed schemas.json
+var schemasJSON []byte
+
+// schemas holds the parsed response schemas by name
+var schemas = func() map[string]*Schema {
+	var m map[string]*Schema
+	if err := json.Unmarshal(schemasJSON, &m); err != nil {
+		panic(fmt.Sprintf("conformance: invalid schemas.json: %v", err))
+	}
+	return m
+}()
+
+// Schema is the subset of JSON Schema needed to describe API responses: types, required and
+// nested properties, array items, enums and references to other schemas by name
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       schemaTypes        `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+	MinItems   int                `json:"minItems"`
+	Enum       []any              `json:"enum"`
+}
+
+// schemaTypes accepts "type" as a single type name or a list of them
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// Validate checks a decoded JSON document against the schema and returns one message per
+// violation, each prefixed with the JSON path of the offending value
+func (s *Schema) Validate(doc any) []string {
+	var violations []string
+	s.validate(doc, "$", &violations)
+	return violations
+}
+
+func (s *Schema) validate(v any, path string, violations *[]string) {
+	if s.Ref != "" {
+		ref, ok := schemas[s.Ref]
+		if !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: unknown schema '%s'", path, s.Ref))
+			return
+		}
+		ref.validate(v, path, violations)
+		return
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasType(v, t) }) {
+		*violations = append(*violations, fmt.Sprintf("%s: got %s, want %s", path, typeName(v), strings.Join(s.Type, " or ")))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		*violations = append(*violations, fmt.Sprintf("%s: %s is not one of %s", path, jsonText(v), jsonText(s.Enum)))
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*violations = append(*violations, fmt.Sprintf("%s: missing required property '%s'", path, name))
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+			if value, ok := v[name]; ok {
+				s.Properties[name].validate(value, path+"."+name, violations)
+			}
+		}
+	case []any:
+		if len(v) < s.MinItems {
+			*violations = append(*violations, fmt.Sprintf("%s: got %d items, want at least %d", path, len(v), s.MinItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	}
+}
+
+// hasType reports whether a value decoded by encoding/json is of a JSON Schema type
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return v == nil
+	}
+	return typeName(v) == t
+}
+
+// typeName returns the JSON Schema type of a value decoded by encoding/json
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonText formats a value for a violation message
+func jsonText(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,208 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chew-z/copilot-proxy/internal/redact"
+)
+
+// DefaultTag is the partition used when a request carries no dataset tag
+const DefaultTag = "default"
+
+// maxToolCalls bounds the tool calls assembled from a stream, so a bogus index cannot grow the list
+const maxToolCalls = 128
+
+// tagSanitizer strips characters that are unsafe in file names
+var tagSanitizer = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+
+// Collector appends prompt/response pairs to per-tag JSONL files in OpenAI fine-tuning format
+type Collector struct {
+	dir       string
+	redactPII bool
+	mu        sync.Mutex
+}
+
+// New creates a collector writing to dir, creating it if needed
+func New(dir string, redactPII bool) (*Collector, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dataset directory: %w", err)
+	}
+	return &Collector{dir: dir, redactPII: redactPII}, nil
+}
+
+// Record appends one training example built from the request and the upstream response body.
+// The response may be a chat completion JSON object or an SSE stream of chunks.
+// It returns false without error when the response has no usable assistant message.
+func (c *Collector) Record(tag string, request map[string]any, response []byte) (bool, error) {
+	assistant := AssistantMessage(response)
+	if assistant == nil {
+		return false, nil
+	}
+
+	messages, _ := request["messages"].([]any)
+	example := map[string]any{
+		"messages": append(append([]any{}, messages...), assistant),
+	}
+	if tools, ok := request["tools"]; ok {
+		example["tools"] = tools
+	}
+
+	var record any = example
+	if c.redactPII {
+		record = redact.Value(example, redact.PII)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode dataset record: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(c.path(tag), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open dataset file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return false, fmt.Errorf("failed to write dataset record: %w", err)
+	}
+	return true, nil
+}
+
+// path returns the JSONL file for a tag
+func (c *Collector) path(tag string) string {
+	tag = tagSanitizer.ReplaceAllString(tag, "_")
+	if tag == "" {
+		tag = DefaultTag
+	}
+	return filepath.Join(c.dir, tag+".jsonl")
+}
+
+// AssistantMessage extracts the assistant message from a chat completion response or SSE stream.
+// A stream's deltas are merged into the message a non-streaming response would carry: text
+// fields are concatenated and tool calls are assembled by index. Reasoning is left out of both,
+// as it is not part of the fine-tuning format.
+func AssistantMessage(body []byte) map[string]any {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var resp struct {
+			Choices []struct {
+				Message map[string]any `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(trimmed, &resp); err != nil || len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+			return nil
+		}
+		msg := resp.Choices[0].Message
+		delete(msg, "reasoning_content")
+		return msg
+	}
+
+	texts := make(map[string]*strings.Builder)
+	var calls []map[string]any // Indexed by the tool call's index
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta map[string]any `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) == 0 {
+			continue
+		}
+		for key, value := range chunk.Choices[0].Delta {
+			switch key {
+			case "role", "reasoning_content":
+			case "tool_calls":
+				items, _ := value.([]any)
+				for _, item := range items {
+					if delta, ok := item.(map[string]any); ok {
+						calls = mergeToolCall(calls, delta)
+					}
+				}
+			default:
+				if text, ok := value.(string); ok {
+					if texts[key] == nil {
+						texts[key] = new(strings.Builder)
+					}
+					texts[key].WriteString(text)
+				}
+			}
+		}
+	}
+
+	msg := map[string]any{"role": "assistant"}
+	for key, text := range texts {
+		if text.Len() > 0 {
+			msg[key] = text.String()
+		}
+	}
+	var toolCalls []any
+	for _, call := range calls {
+		if call != nil {
+			toolCalls = append(toolCalls, call)
+		}
+	}
+	if len(toolCalls) > 0 {
+		msg["tool_calls"] = toolCalls
+		if _, ok := msg["content"]; !ok {
+			msg["content"] = nil
+		}
+	}
+	if _, ok := msg["content"]; !ok {
+		return nil
+	}
+	return msg
+}
+
+// mergeToolCall folds one streamed tool call delta into the call at its index: the first chunk
+// carries the id, type and function name, later ones append to the arguments
+func mergeToolCall(calls []map[string]any, delta map[string]any) []map[string]any {
+	index, _ := delta["index"].(float64)
+	i := int(index)
+	if i < 0 || i >= maxToolCalls {
+		return calls
+	}
+	for len(calls) <= i {
+		calls = append(calls, nil)
+	}
+	call := calls[i]
+	if call == nil {
+		call = map[string]any{"function": map[string]any{"name": "", "arguments": ""}}
+		calls[i] = call
+	}
+	for _, key := range []string{"id", "type"} {
+		if v, ok := delta[key].(string); ok && v != "" {
+			call[key] = v
+		}
+	}
+	fn, _ := delta["function"].(map[string]any)
+	merged := call["function"].(map[string]any)
+	if name, ok := fn["name"].(string); ok && name != "" {
+		merged["name"] = name
+	}
+	if args, ok := fn["arguments"].(string); ok {
+		merged["arguments"] = merged["arguments"].(string) + args
+	}
+	return calls
+}
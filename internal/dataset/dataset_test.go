@@ -0,0 +1,103 @@
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssistantMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected map[string]any
+	}{
+		{
+			name:     "Non-streaming",
+			body:     `{"choices":[{"message":{"role":"assistant","content":"Hello","reasoning_content":"hmm"}}]}`,
+			expected: map[string]any{"role": "assistant", "content": "Hello"},
+		},
+		{
+			name:     "Streaming",
+			body:     "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\ndata: [DONE]\n\n",
+			expected: map[string]any{"role": "assistant", "content": "Hello"},
+		},
+		{
+			name: "Streaming tool calls",
+			body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"reasoning_content\":\"hmm\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"get_time\",\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Paris\\\"}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			expected: map[string]any{"role": "assistant", "content": nil, "tool_calls": []any{
+				map[string]any{"id": "call_1", "type": "function", "function": map[string]any{"name": "get_weather", "arguments": `{"city":"Paris"}`}},
+				map[string]any{"id": "call_2", "type": "function", "function": map[string]any{"name": "get_time", "arguments": "{}"}},
+			}},
+		},
+		{
+			name:     "No choices",
+			body:     `{"choices":[]}`,
+			expected: nil,
+		},
+		{
+			name:     "Empty stream",
+			body:     "data: [DONE]\n\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AssistantMessage([]byte(tt.body))
+			if tt.expected == nil {
+				assert.Nil(t, got)
+			} else {
+				assert.Equal(t, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, true)
+	require.NoError(t, err)
+
+	request := map[string]any{
+		"model": "glm-4.7",
+		"messages": []any{
+			map[string]any{"role": "user", "content": "my email is jane@example.com"},
+		},
+	}
+	response := []byte(`{"choices":[{"message":{"role":"assistant","content":"Noted."}}]}`)
+
+	recorded, err := c.Record("code/review", request, response)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+
+	data, err := os.ReadFile(filepath.Join(dir, "code_review.jsonl"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+
+	var example struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &example))
+	require.Len(t, example.Messages, 2)
+	assert.Equal(t, "my email is [EMAIL]", example.Messages[0]["content"])
+	assert.Equal(t, "Noted.", example.Messages[1]["content"])
+
+	// Request messages must not be mutated by redaction
+	assert.Equal(t, "my email is jane@example.com", request["messages"].([]any)[0].(map[string]any)["content"])
+
+	recorded, err = c.Record("", request, []byte(`not json`))
+	require.NoError(t, err)
+	assert.False(t, recorded)
+}
@@ -0,0 +1,271 @@
+package gitctx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsPerToken is the rough ratio used to keep gathered context within a token budget
+const charsPerToken = 4
+
+// ErrOutsideRoots is returned when the repository or a file lies outside Options.Roots
+var ErrOutsideRoots = errors.New("outside the allowed roots")
+
+// Options controls what context is gathered from a repository
+type Options struct {
+	Base        string   // Diff against this ref; empty diffs the working tree against HEAD
+	Files       []string // Extra repo-relative files to include besides changed ones
+	TokenBudget int      // Approximate upper bound for the rendered context
+	Roots       []string // When set, the repository and every file read must lie under one of these resolved directories
+}
+
+// Context is the material gathered from a repository
+type Context struct {
+	Root      string    // Repository top-level directory
+	Branch    string    // Current branch, or "HEAD" when detached
+	Status    string    // `git status --short` output
+	Diff      string    // Unified diff, possibly truncated
+	Files     []Snippet // File contents, possibly truncated
+	Truncated bool      // Whether anything was cut to fit the budget
+	Omitted   []string  // Files left out entirely for lack of budget
+	budget    int       // Remaining characters while gathering
+}
+
+// Snippet is the (possibly truncated) content of one file
+type Snippet struct {
+	Path    string
+	Content string
+}
+
+// Gather collects status, diff and file contents from the repository containing dir.
+// Sections are filled in priority order (status, diff, files) until the budget runs out.
+func Gather(ctx context.Context, dir string, opts Options) (*Context, error) {
+	root, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %w", err)
+	}
+	root = strings.TrimSpace(root)
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	// The top level can sit above the requested directory, e.g. a dotfiles repository in $HOME
+	if !withinRoots(opts.Roots, root) {
+		return nil, fmt.Errorf("repository %s is %w", root, ErrOutsideRoots)
+	}
+
+	branch, err := git(ctx, root, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		// A repository without commits has no HEAD yet
+		branch = ""
+	}
+
+	gc := &Context{
+		Root:   root,
+		Branch: strings.TrimSpace(branch),
+		budget: opts.TokenBudget * charsPerToken,
+	}
+
+	status, err := git(ctx, root, "status", "--short")
+	if err != nil {
+		return nil, err
+	}
+	gc.Status = gc.take(strings.TrimRight(status, "\n"))
+
+	diffArgs := []string{"diff", "--no-color", "--no-ext-diff"}
+	if opts.Base != "" {
+		if strings.HasPrefix(opts.Base, "-") {
+			return nil, fmt.Errorf("invalid base ref %q", opts.Base)
+		}
+		diffArgs = append(diffArgs, opts.Base, "--")
+	} else if branch != "" {
+		diffArgs = append(diffArgs, "HEAD", "--")
+	}
+	diff, err := git(ctx, root, diffArgs...)
+	if err != nil {
+		return nil, err
+	}
+	gc.Diff = gc.take(strings.TrimRight(diff, "\n"))
+
+	paths, err := changedFiles(ctx, root, opts.Base, branch != "")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.Files {
+		if !slices.Contains(paths, f) {
+			paths = append(paths, f)
+		}
+	}
+
+	for _, p := range paths {
+		if gc.budget <= 0 {
+			gc.Omitted = append(gc.Omitted, p)
+			continue
+		}
+		content, err := readFile(root, p, opts.Roots)
+		if err != nil {
+			return nil, err
+		}
+		if content == "" {
+			continue
+		}
+		gc.Files = append(gc.Files, Snippet{Path: p, Content: gc.take(content)})
+	}
+	if len(gc.Omitted) > 0 {
+		gc.Truncated = true
+	}
+
+	return gc, nil
+}
+
+// take returns as much of s as the remaining budget allows
+func (gc *Context) take(s string) string {
+	if len(s) <= gc.budget {
+		gc.budget -= len(s)
+		return s
+	}
+	gc.Truncated = true
+	cut := max(gc.budget, 0)
+	// Don't split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	gc.budget = 0
+	return s[:cut] + "\n[truncated]"
+}
+
+// Render formats the context as markdown for inclusion in a prompt
+func (gc *Context) Render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repository: %s\n", filepath.Base(gc.Root))
+	if gc.Branch != "" {
+		fmt.Fprintf(&b, "Branch: %s\n", gc.Branch)
+	}
+
+	if gc.Status != "" {
+		fmt.Fprintf(&b, "\n## Changed files\n\n```\n%s\n```\n", gc.Status)
+	}
+	if gc.Diff != "" {
+		fmt.Fprintf(&b, "\n## Diff\n\n```diff\n%s\n```\n", gc.Diff)
+	}
+	for _, f := range gc.Files {
+		fmt.Fprintf(&b, "\n## %s\n\n```\n%s\n```\n", f.Path, f.Content)
+	}
+	if len(gc.Omitted) > 0 {
+		fmt.Fprintf(&b, "\nOmitted for length: %s\n", strings.Join(gc.Omitted, ", "))
+	}
+	return b.String()
+}
+
+// changedFiles lists modified, added and untracked files that still exist
+func changedFiles(ctx context.Context, root, base string, hasHead bool) ([]string, error) {
+	var paths []string
+
+	if base != "" || hasHead {
+		ref := base
+		if ref == "" {
+			ref = "HEAD"
+		}
+		out, err := git(ctx, root, "diff", "--name-only", "--diff-filter=d", ref, "--")
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, lines(out)...)
+	}
+
+	out, err := git(ctx, root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range lines(out) {
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	if !hasHead {
+		out, err := git(ctx, root, "ls-files", "--cached")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range lines(out) {
+			if !slices.Contains(paths, p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// readFile reads a repo-relative text file, refusing paths that escape the repository or
+// the allowed roots. Binary files yield empty content.
+func readFile(root, rel string, roots []string) (string, error) {
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("file %q not found", rel)
+		}
+		return "", err
+	}
+	if !Within(root, path) {
+		return "", fmt.Errorf("file %q is outside the repository", rel)
+	}
+	if !withinRoots(roots, path) {
+		return "", fmt.Errorf("file %q is %w", rel, ErrOutsideRoots)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", nil
+	}
+	return string(data), nil
+}
+
+// Within reports whether path is dir or lies beneath it
+func Within(dir, path string) bool {
+	r, err := filepath.Rel(dir, path)
+	return err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)) && !filepath.IsAbs(r)
+}
+
+// withinRoots reports whether path lies under one of roots, or whether there are no roots
+func withinRoots(roots []string, path string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(roots, func(root string) bool { return Within(root, path) })
+}
+
+// git runs a git command in dir and returns its stdout
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir, "-c", "core.quotepath=off"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// lines splits command output into non-empty lines
+func lines(out string) []string {
+	var result []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			result = append(result, l)
+		}
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package gitctx
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo creates a repository with one commit and returns its path
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	run("init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\n"), 0644))
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	return dir
+}
+
+// TestGather tests status, diff and file collection
+func TestGather(t *testing.T) {
+	dir := initRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n// new\n"), 0644))
+
+	gc, err := Gather(context.Background(), dir, Options{Files: []string{"README.md"}, TokenBudget: 1000})
+	require.NoError(t, err)
+
+	assert.Equal(t, "main", gc.Branch)
+	assert.Contains(t, gc.Status, "M main.go")
+	assert.Contains(t, gc.Status, "?? new.go")
+	assert.Contains(t, gc.Diff, "+func main() {}")
+	assert.False(t, gc.Truncated)
+
+	var paths []string
+	for _, f := range gc.Files {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, []string{"main.go", "new.go", "README.md"}, paths)
+
+	rendered := gc.Render()
+	assert.Contains(t, rendered, "Branch: main")
+	assert.Contains(t, rendered, "```diff\n")
+	assert.Contains(t, rendered, "## new.go")
+}
+
+// TestGather_Budget tests that context is truncated to the token budget
+func TestGather_Budget(t *testing.T) {
+	dir := initRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(strings.Repeat("// filler line\n", 200)), 0644))
+
+	gc, err := Gather(context.Background(), dir, Options{TokenBudget: 50})
+	require.NoError(t, err)
+
+	assert.True(t, gc.Truncated)
+	assert.Contains(t, gc.Diff, "[truncated]")
+	assert.Empty(t, gc.Files)
+	assert.Equal(t, []string{"main.go"}, gc.Omitted)
+}
+
+// TestGather_Errors tests rejected inputs
+func TestGather_Errors(t *testing.T) {
+	dir := initRepo(t)
+
+	_, err := Gather(context.Background(), t.TempDir(), Options{TokenBudget: 100})
+	assert.Error(t, err, "not a repository")
+
+	_, err = Gather(context.Background(), dir, Options{Base: "--output=/tmp/x", TokenBudget: 100})
+	assert.Error(t, err, "option-like base ref")
+
+	_, err = Gather(context.Background(), dir, Options{Files: []string{"../outside.txt"}, TokenBudget: 100})
+	assert.Error(t, err, "file outside repository")
+
+	// A directory under an allowed root whose repository starts above the root
+	root, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	sub := filepath.Join(root, "src")
+	require.NoError(t, os.Mkdir(sub, 0755))
+	_, err = Gather(context.Background(), sub, Options{Files: []string{"README.md"}, TokenBudget: 100, Roots: []string{sub}})
+	assert.ErrorIs(t, err, ErrOutsideRoots)
+
+	gc, err := Gather(context.Background(), sub, Options{TokenBudget: 100, Roots: []string{root}})
+	require.NoError(t, err)
+	assert.Equal(t, root, gc.Root)
+}
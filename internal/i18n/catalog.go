@@ -0,0 +1,262 @@
+package i18n
+
+// catalogs maps each supported language to translations of the English messages, keyed by the
+// English text or format string exactly as it appears at the call site
+var catalogs = map[string]map[string]string{
+	"de": {
+		// API errors
+		"%s '%s' is not a snapshot of model '%s'":                                              "%s '%s' ist kein Snapshot des Modells '%s'",
+		"%s is only available to authenticated clients":                                        "%s ist nur für authentifizierte Clients verfügbar",
+		"%s is up to date (config_version %d)":                                                 "%s ist aktuell (config_version %d)",
+		"%s must be 1-64 letters, digits, '.', '_' or '-'":                                     "%s muss aus 1-64 Buchstaben, Ziffern, '.', '_' oder '-' bestehen",
+		"%s quota of %d exceeded for %s, resets in %s":                                         "Kontingent %s von %d für %s überschritten, wird zurückgesetzt in %s",
+		"%v; the agent run was stopped":                                                        "%v; der Agent-Lauf wurde abgebrochen",
+		"--live requires admin.token; the running server only accepts key rotation with it":    "--live erfordert admin.token; der laufende Server akzeptiert Schlüsselrotation nur damit",
+		"Config file settings are not recognized and are ignored: %s":                          "Einstellungen der Konfigurationsdatei werden nicht erkannt und ignoriert: %s",
+		"Config file uses an old setting: %s; run 'copilot-proxy config migrate' to update it": "Die Konfigurationsdatei verwendet eine veraltete Einstellung: %s; führen Sie 'copilot-proxy config migrate' aus, um sie zu aktualisieren",
+		"Config file:":                              "Konfigurationsdatei:",
+		"Data directory:":                           "Datenverzeichnis:",
+		"Failed to connect to upstream server":      "Verbindung zum Upstream-Server fehlgeschlagen",
+		"Failed to locate the config directory: %v": "Konfigurationsverzeichnis konnte nicht ermittelt werden: %v",
+		"Failed to locate the data directory: %v":   "Datenverzeichnis konnte nicht ermittelt werden: %v",
+		"Failed to migrate configuration: %v":       "Konfiguration konnte nicht migriert werden: %v",
+		"Failed to prepare upstream request":        "Upstream-Anfrage konnte nicht vorbereitet werden",
+		"Failed to read upstream response":          "Upstream-Antwort konnte nicht gelesen werden",
+		"Failed to render prompt: %v":               "Prompt konnte nicht erstellt werden: %v",
+		"Invalid JSON: %v":                          "Ungültiges JSON: %v",
+		"Invalid embeddings response from upstream": "Ungültige Embeddings-Antwort vom Upstream",
+		"Log file:": "Protokolldatei:",
+		"Port %d is already in use by %s. Stop it, choose another port with --port, or start with --takeover to use the next free port.": "Port %d wird bereits von %s verwendet. Beenden Sie es, wählen Sie mit --port einen anderen Port oder starten Sie mit --takeover, um den nächsten freien Port zu verwenden.",
+		"Port %d is in use by %s, and so are the %d ports after it.":                                                                     "Port %d wird von %s verwendet, ebenso die %d Ports danach.",
+		"Port %d is in use by %s; listening on port %d instead. Point clients at it with:":                                               "Port %d wird von %s verwendet; stattdessen wird Port %d verwendet. Richten Sie Clients darauf aus mit:",
+		"To keep Ollama, run it on another port: OLLAMA_HOST=127.0.0.1:%d ollama serve":                                                  "Um Ollama weiter zu nutzen, starten Sie es auf einem anderen Port: OLLAMA_HOST=127.0.0.1:%d ollama serve",
+		"To keep this port, run 'copilot-proxy config set port %d'.":                                                                     "Um diesen Port beizubehalten, führen Sie 'copilot-proxy config set port %d' aus.",
+		"Unexpected upstream response":                                                         "Unerwartete Upstream-Antwort",
+		"Upgraded %s from config_version %d to %d (original kept as %s.bak)":                   "%s wurde von config_version %d auf %d aktualisiert (Original als %s.bak gespeichert)",
+		"Upstream returned an invalid response (status %d, %s, %d bytes): %s; body starts: %s": "Upstream hat eine ungültige Antwort geliefert (Status %d, %s, %d Bytes): %s; Beginn des Inhalts: %s",
+		"Upstream returned an invalid response: %s":                                            "Upstream hat eine ungültige Antwort geliefert: %s",
+		"Would upgrade %s from config_version %d to %d":                                        "%s würde von config_version %d auf %d aktualisiert",
+		"api_key is required":                                                                  "api_key ist erforderlich",
+		"canary target must differ from the model":                                             "Das Canary-Ziel muss sich vom Modell unterscheiden",
+		"cannot verify token: identity provider unavailable":                                   "Token kann nicht geprüft werden: Identitätsanbieter nicht erreichbar",
+		"changing canaries requires the admin token":                                           "Das Ändern von Canaries erfordert das Admin-Token",
+		"content block type '%s' is not supported here":                                        "Inhaltsblocktyp '%s' wird hier nicht unterstützt",
+		"content must be a string or an array of content blocks":                               "content muss eine Zeichenkette oder ein Array von Inhaltsblöcken sein",
+		"diff is required":                                "diff ist erforderlich",
+		"dimensions must be positive":                     "dimensions muss positiv sein",
+		"encoding_format is not supported by /api/embed":  "encoding_format wird von /api/embed nicht unterstützt",
+		"encoding_format must be float or base64":         "encoding_format muss float oder base64 sein",
+		"format must be \"json\" or a JSON schema object": "format muss \"json\" oder ein JSON-Schema-Objekt sein",
+		"identical request repeated more than %d times within %s; check the client for a retry loop and wait %s before sending it again": "Identische Anfrage mehr als %d-mal innerhalb von %s wiederholt; prüfen Sie den Client auf eine Wiederholungsschleife und warten Sie %s, bevor Sie sie erneut senden",
+		"included prompt fragments exceed %d bytes":                                "eingebundene Prompt-Fragmente überschreiten %d Bytes",
+		"input %d must be a non-empty string":                                      "input %d muss eine nicht leere Zeichenkette sein",
+		"input has %d texts, more than the limit of %d":                            "input enthält %d Texte, mehr als das Limit von %d",
+		"input must be a non-empty string or array of strings":                     "input muss eine nicht leere Zeichenkette oder ein Array von Zeichenketten sein",
+		"invalid %s value '%s' (use on, off or passthrough)":                       "ungültiger %s-Wert '%s' (verwenden Sie on, off oder passthrough)",
+		"invalid format: %s (use \"json\" or a JSON schema)":                       "Ungültiges format: %s (verwenden Sie \"json\" oder ein JSON-Schema)",
+		"invalid or missing API key":                                               "Ungültiger oder fehlender API-Schlüssel",
+		"invalid or missing admin token":                                           "Ungültiges oder fehlendes Admin-Token",
+		"invalid reasoning mode '%s' (use passthrough, strip or merge)":            "ungültiger Reasoning-Modus '%s' (verwenden Sie passthrough, strip oder merge)",
+		"invalid session ID %q":                                                    "ungültige Sitzungs-ID %q",
+		"invalid think level: %s (use low, medium or high)":                        "Ungültige think-Stufe: %s (verwenden Sie low, medium oder high)",
+		"invalid tool_choice type '%s'":                                            "Ungültiger tool_choice-Typ '%s'",
+		"invalid wait %q":                                                          "ungültige Wartezeit %q",
+		"key rotation requires the admin token":                                    "Schlüsselrotation erfordert das Admin-Token",
+		"message %d has invalid role: %s":                                          "Nachricht %d hat eine ungültige Rolle: %s",
+		"message %d must be an object":                                             "Nachricht %d muss ein Objekt sein",
+		"message %d requires a role":                                               "Nachricht %d benötigt eine Rolle",
+		"message %d: %v":                                                           "Nachricht %d: %v",
+		"messages is required and must be non-empty":                               "messages ist erforderlich und darf nicht leer sein",
+		"metadata has %d keys; at most %d are allowed":                             "metadata hat %d Schlüssel; höchstens %d sind erlaubt",
+		"metadata key %q is longer than %d characters":                             "metadata-Schlüssel %q ist länger als %d Zeichen",
+		"metadata must be an object":                                               "metadata muss ein Objekt sein",
+		"metadata value for %q is longer than %d characters":                       "metadata-Wert für %q ist länger als %d Zeichen",
+		"metadata value for %q must be a string":                                   "metadata-Wert für %q muss eine Zeichenkette sein",
+		"model '%s' does not support images; use a vision model such as GLM-4.6V":  "Modell '%s' unterstützt keine Bilder; verwenden Sie ein Vision-Modell wie GLM-4.6V",
+		"model '%s' is not allowed for %s":                                         "Modell '%s' ist für %s nicht erlaubt",
+		"model '%s' not found":                                                     "Modell '%s' nicht gefunden",
+		"model and percent are required":                                           "model und percent sind erforderlich",
+		"model is required":                                                        "model ist erforderlich",
+		"models must list exactly two models":                                      "models muss genau zwei Modelle enthalten",
+		"no canary for '%s'; a target model is required":                           "Kein Canary für '%s'; ein Zielmodell ist erforderlich",
+		"no generation in session %q":                                              "keine Generierung in Sitzung %q",
+		"no request '%s' in progress":                                              "Keine laufende Anfrage '%s'",
+		"percent must be between 0 and 100":                                        "percent muss zwischen 0 und 100 liegen",
+		"prompt fragments include each other: %s":                                  "Prompt-Fragmente binden sich gegenseitig ein: %s",
+		"query parameter %s must be a number":                                      "Query-Parameter %s muss eine Zahl sein",
+		"query parameter %s must be a positive integer":                            "Query-Parameter %s muss eine positive Ganzzahl sein",
+		"quota exceeded for %s, retry in %ds":                                      "Kontingent für %s überschritten, erneut versuchen in %ds",
+		"rate limit exceeded, retry in %ds":                                        "Ratenlimit überschritten, erneut versuchen in %ds",
+		"repo and query are required":                                              "repo und query sind erforderlich",
+		"repo is outside the allowed roots: %s":                                    "repo liegt außerhalb der erlaubten Verzeichnisse: %s",
+		"repo must be an absolute path":                                            "repo muss ein absoluter Pfad sein",
+		"repo not found: %s":                                                       "repo nicht gefunden: %s",
+		"request '%s' is already in progress":                                      "Anfrage '%s' läuft bereits",
+		"request rejected: plugin %s failed":                                       "Anfrage abgelehnt: Plugin %s ist fehlgeschlagen",
+		"request rejected: script %s failed":                                       "Anfrage abgelehnt: Skript %s ist fehlgeschlagen",
+		"request_id is required":                                                   "request_id ist erforderlich",
+		"requests can only be cancelled by the client that made them":              "Anfragen können nur von dem Client abgebrochen werden, der sie gestellt hat",
+		"suffix is not supported: the upstream API has no fill-in-the-middle mode": "suffix wird nicht unterstützt: Die Upstream-API hat keinen Fill-in-the-Middle-Modus",
+		"system: %v": "system: %v",
+		"the agent endpoint offers its own tools; remove tools from the request":         "der Agent-Endpunkt bietet eigene Tools an; entfernen Sie tools aus der Anfrage",
+		"think must be a boolean or one of low, medium, high":                            "think muss ein Boolean oder eines von low, medium, high sein",
+		"too many failed authentication attempts, retry in %ds":                          "Zu viele fehlgeschlagene Anmeldeversuche, erneut versuchen in %ds",
+		"tool '%s' of type '%s' is not supported":                                        "Werkzeug '%s' vom Typ '%s' wird nicht unterstützt",
+		"tools must be an array":                                                         "tools muss ein Array sein",
+		"tools[%d] (%s): function.description must be a string":                          "tools[%d] (%s): function.description muss eine Zeichenkette sein",
+		"tools[%d] (%s): function.parameters must be an object":                          "tools[%d] (%s): function.parameters muss ein Objekt sein",
+		"tools[%d] (%s): function.parameters.type must be \"object\"":                    "tools[%d] (%s): function.parameters.type muss \"object\" sein",
+		"tools[%d] (%s): name duplicates tools[%d]":                                      "tools[%d] (%s): Name doppelt mit tools[%d]",
+		"tools[%d] must be an object":                                                    "tools[%d] muss ein Objekt sein",
+		"tools[%d].function must be an object":                                           "tools[%d].function muss ein Objekt sein",
+		"tools[%d].function.name %q must be 1-64 letters, digits, underscores or dashes": "tools[%d].function.name %q muss aus 1-64 Buchstaben, Ziffern, Unter- oder Bindestrichen bestehen",
+		"tools[%d].type must be \"function\"":                                            "tools[%d].type muss \"function\" sein",
+		"unknown prompt fragment '%s'":                                                   "unbekanntes Prompt-Fragment '%s'",
+		"unknown upstream '%s'":                                                          "Unbekannter Upstream '%s'",
+		"upstream '%s' uses the default key; rotate that instead":                        "Upstream '%s' verwendet den Standardschlüssel; rotieren Sie stattdessen diesen",
+		"upstream returned status %d: %s":                                                "Upstream antwortete mit Status %d: %s",
+		"usage quotas need client authentication":                                        "Nutzungskontingente erfordern Client-Authentifizierung",
+		"usage store unavailable: %v":                                                    "Nutzungsspeicher nicht verfügbar: %v",
+
+		// CLI
+		"%s is not set": "%s ist nicht gesetzt",
+		"--live only applies to api_key; restart the server for %s": "--live gilt nur für api_key; starten Sie den Server für %s neu",
+		"Configuration updated: %s = %s":                            "Konfiguration aktualisiert: %s = %s",
+		"Failed to apply the key to the running server: %v":         "Schlüssel konnte nicht auf den laufenden Server angewendet werden: %v",
+		"Failed to save configuration: %v":                          "Konfiguration konnte nicht gespeichert werden: %v",
+		"Invalid %s value: %s. Must be true or false.":              "Ungültiger Wert für %s: %s. Muss true oder false sein.",
+		"Invalid key: %s. Valid keys are: %s":                       "Ungültiger Schlüssel: %s. Gültige Schlüssel sind: %s",
+		"Invalid locale value: %v":                                  "Ungültiger Wert für locale: %v",
+		"Invalid port value: %s. Must be an integer.":               "Ungültiger Wert für port: %s. Muss eine Ganzzahl sein.",
+		"Running server now uses the new api_key":                   "Der laufende Server verwendet jetzt den neuen api_key",
+		"API key is not configured. Please run 'copilot-proxy config set api_key YOUR_API_KEY' or set ZAI_API_KEY environment variable. Config file location: %s": "API-Schlüssel ist nicht konfiguriert. Führen Sie 'copilot-proxy config set api_key YOUR_API_KEY' aus oder setzen Sie die Umgebungsvariable ZAI_API_KEY. Speicherort der Konfigurationsdatei: %s",
+	},
+	"pl": {
+		// API errors
+		"%s '%s' is not a snapshot of model '%s'":                                              "%s '%s' nie jest migawką modelu '%s'",
+		"%s is only available to authenticated clients":                                        "%s jest dostępny tylko dla uwierzytelnionych klientów",
+		"%s is up to date (config_version %d)":                                                 "%s jest aktualny (config_version %d)",
+		"%s must be 1-64 letters, digits, '.', '_' or '-'":                                     "%s musi składać się z 1-64 liter, cyfr, '.', '_' lub '-'",
+		"%s quota of %d exceeded for %s, resets in %s":                                         "przekroczono limit %s wynoszący %d dla %s, reset za %s",
+		"%v; the agent run was stopped":                                                        "%v; działanie agenta zostało przerwane",
+		"--live requires admin.token; the running server only accepts key rotation with it":    "--live wymaga admin.token; działający serwer przyjmuje rotację klucza tylko z nim",
+		"Config file settings are not recognized and are ignored: %s":                          "Ustawienia pliku konfiguracyjnego nie są rozpoznawane i zostaną pominięte: %s",
+		"Config file uses an old setting: %s; run 'copilot-proxy config migrate' to update it": "Plik konfiguracyjny używa przestarzałego ustawienia: %s; uruchom 'copilot-proxy config migrate', aby je zaktualizować",
+		"Config file:":                              "Plik konfiguracji:",
+		"Data directory:":                           "Katalog danych:",
+		"Failed to connect to upstream server":      "Nie udało się połączyć z serwerem nadrzędnym",
+		"Failed to locate the config directory: %v": "Nie udało się ustalić katalogu konfiguracji: %v",
+		"Failed to locate the data directory: %v":   "Nie udało się ustalić katalogu danych: %v",
+		"Failed to migrate configuration: %v":       "Nie udało się zmigrować konfiguracji: %v",
+		"Failed to prepare upstream request":        "Nie udało się przygotować żądania do serwera nadrzędnego",
+		"Failed to read upstream response":          "Nie udało się odczytać odpowiedzi serwera nadrzędnego",
+		"Failed to render prompt: %v":               "Nie udało się zbudować promptu: %v",
+		"Invalid JSON: %v":                          "Nieprawidłowy JSON: %v",
+		"Invalid embeddings response from upstream": "Nieprawidłowa odpowiedź embeddings z serwera nadrzędnego",
+		"Log file:": "Plik dziennika:",
+		"Port %d is already in use by %s. Stop it, choose another port with --port, or start with --takeover to use the next free port.": "Port %d jest już używany przez %s. Zatrzymaj go, wybierz inny port opcją --port albo uruchom z --takeover, aby użyć następnego wolnego portu.",
+		"Port %d is in use by %s, and so are the %d ports after it.":                                                                     "Port %d jest używany przez %s, podobnie jak %d kolejnych portów.",
+		"Port %d is in use by %s; listening on port %d instead. Point clients at it with:":                                               "Port %d jest używany przez %s; zamiast niego używany jest port %d. Skieruj na niego klientów za pomocą:",
+		"To keep Ollama, run it on another port: OLLAMA_HOST=127.0.0.1:%d ollama serve":                                                  "Aby zachować Ollamę, uruchom ją na innym porcie: OLLAMA_HOST=127.0.0.1:%d ollama serve",
+		"To keep this port, run 'copilot-proxy config set port %d'.":                                                                     "Aby zachować ten port, uruchom 'copilot-proxy config set port %d'.",
+		"Unexpected upstream response":                                                         "Nieoczekiwana odpowiedź serwera nadrzędnego",
+		"Upgraded %s from config_version %d to %d (original kept as %s.bak)":                   "Zaktualizowano %s z config_version %d do %d (oryginał zachowano jako %s.bak)",
+		"Upstream returned an invalid response (status %d, %s, %d bytes): %s; body starts: %s": "Upstream zwrócił nieprawidłową odpowiedź (status %d, %s, %d bajtów): %s; początek treści: %s",
+		"Upstream returned an invalid response: %s":                                            "Upstream zwrócił nieprawidłową odpowiedź: %s",
+		"Would upgrade %s from config_version %d to %d":                                        "%s zostałby zaktualizowany z config_version %d do %d",
+		"api_key is required":                                                                  "api_key jest wymagany",
+		"canary target must differ from the model":                                             "cel canary musi różnić się od modelu",
+		"cannot verify token: identity provider unavailable":                                   "nie można zweryfikować tokenu: dostawca tożsamości niedostępny",
+		"changing canaries requires the admin token":                                           "zmiana canary wymaga tokenu administratora",
+		"content block type '%s' is not supported here":                                        "typ bloku treści '%s' nie jest tu obsługiwany",
+		"content must be a string or an array of content blocks":                               "content musi być ciągiem znaków lub tablicą bloków treści",
+		"diff is required":                                "diff jest wymagany",
+		"dimensions must be positive":                     "dimensions musi być dodatnie",
+		"encoding_format is not supported by /api/embed":  "encoding_format nie jest obsługiwany przez /api/embed",
+		"encoding_format must be float or base64":         "encoding_format musi mieć wartość float lub base64",
+		"format must be \"json\" or a JSON schema object": "format musi być \"json\" lub obiektem schematu JSON",
+		"identical request repeated more than %d times within %s; check the client for a retry loop and wait %s before sending it again": "identyczne żądanie powtórzono ponad %d razy w ciągu %s; sprawdź, czy klient nie ponawia go w pętli, i odczekaj %s przed ponownym wysłaniem",
+		"included prompt fragments exceed %d bytes":                                "dołączone fragmenty promptu przekraczają %d bajtów",
+		"input %d must be a non-empty string":                                      "input %d musi być niepustym ciągiem znaków",
+		"input has %d texts, more than the limit of %d":                            "input zawiera %d tekstów, więcej niż limit %d",
+		"input must be a non-empty string or array of strings":                     "input musi być niepustym ciągiem znaków lub tablicą ciągów",
+		"invalid %s value '%s' (use on, off or passthrough)":                       "nieprawidłowa wartość %s '%s' (użyj on, off lub passthrough)",
+		"invalid format: %s (use \"json\" or a JSON schema)":                       "nieprawidłowy format: %s (użyj \"json\" lub schematu JSON)",
+		"invalid or missing API key":                                               "nieprawidłowy lub brakujący klucz API",
+		"invalid or missing admin token":                                           "nieprawidłowy lub brakujący token administratora",
+		"invalid reasoning mode '%s' (use passthrough, strip or merge)":            "nieprawidłowy tryb rozumowania '%s' (użyj passthrough, strip lub merge)",
+		"invalid session ID %q":                                                    "nieprawidłowy identyfikator sesji %q",
+		"invalid think level: %s (use low, medium or high)":                        "nieprawidłowy poziom think: %s (użyj low, medium lub high)",
+		"invalid tool_choice type '%s'":                                            "nieprawidłowy typ tool_choice '%s'",
+		"invalid wait %q":                                                          "nieprawidłowy czas oczekiwania %q",
+		"key rotation requires the admin token":                                    "rotacja klucza wymaga tokenu administratora",
+		"message %d has invalid role: %s":                                          "wiadomość %d ma nieprawidłową rolę: %s",
+		"message %d must be an object":                                             "wiadomość %d musi być obiektem",
+		"message %d requires a role":                                               "wiadomość %d wymaga roli",
+		"message %d: %v":                                                           "wiadomość %d: %v",
+		"messages is required and must be non-empty":                               "messages jest wymagane i nie może być puste",
+		"metadata has %d keys; at most %d are allowed":                             "metadata ma %d kluczy; dozwolone jest najwyżej %d",
+		"metadata key %q is longer than %d characters":                             "klucz metadata %q jest dłuższy niż %d znaków",
+		"metadata must be an object":                                               "metadata musi być obiektem",
+		"metadata value for %q is longer than %d characters":                       "wartość metadata dla %q jest dłuższa niż %d znaków",
+		"metadata value for %q must be a string":                                   "wartość metadata dla %q musi być tekstem",
+		"model '%s' does not support images; use a vision model such as GLM-4.6V":  "model '%s' nie obsługuje obrazów; użyj modelu wizyjnego, np. GLM-4.6V",
+		"model '%s' is not allowed for %s":                                         "model '%s' nie jest dozwolony dla %s",
+		"model '%s' not found":                                                     "nie znaleziono modelu '%s'",
+		"model and percent are required":                                           "model i percent są wymagane",
+		"model is required":                                                        "model jest wymagany",
+		"models must list exactly two models":                                      "models musi zawierać dokładnie dwa modele",
+		"no canary for '%s'; a target model is required":                           "brak canary dla '%s'; wymagany jest model docelowy",
+		"no generation in session %q":                                              "brak generowania w sesji %q",
+		"no request '%s' in progress":                                              "brak trwającego żądania '%s'",
+		"percent must be between 0 and 100":                                        "percent musi mieścić się między 0 a 100",
+		"prompt fragments include each other: %s":                                  "fragmenty promptu dołączają się nawzajem: %s",
+		"query parameter %s must be a number":                                      "parametr zapytania %s musi być liczbą",
+		"query parameter %s must be a positive integer":                            "parametr zapytania %s musi być dodatnią liczbą całkowitą",
+		"quota exceeded for %s, retry in %ds":                                      "przekroczono limit dla %s, spróbuj ponownie za %ds",
+		"rate limit exceeded, retry in %ds":                                        "przekroczono limit żądań, spróbuj ponownie za %ds",
+		"repo and query are required":                                              "repo i query są wymagane",
+		"repo is outside the allowed roots: %s":                                    "repo leży poza dozwolonymi katalogami: %s",
+		"repo must be an absolute path":                                            "repo musi być ścieżką bezwzględną",
+		"repo not found: %s":                                                       "nie znaleziono repo: %s",
+		"request '%s' is already in progress":                                      "żądanie '%s' jest już w toku",
+		"request rejected: plugin %s failed":                                       "żądanie odrzucone: błąd wtyczki %s",
+		"request rejected: script %s failed":                                       "żądanie odrzucone: błąd skryptu %s",
+		"request_id is required":                                                   "request_id jest wymagany",
+		"requests can only be cancelled by the client that made them":              "żądanie może anulować tylko klient, który je wysłał",
+		"suffix is not supported: the upstream API has no fill-in-the-middle mode": "suffix nie jest obsługiwany: API upstream nie ma trybu uzupełniania środka (fill-in-the-middle)",
+		"system: %v": "system: %v",
+		"the agent endpoint offers its own tools; remove tools from the request":         "endpoint agenta udostępnia własne narzędzia; usuń tools z żądania",
+		"think must be a boolean or one of low, medium, high":                            "think musi być wartością logiczną lub jedną z low, medium, high",
+		"too many failed authentication attempts, retry in %ds":                          "zbyt wiele nieudanych prób uwierzytelnienia, spróbuj ponownie za %ds",
+		"tool '%s' of type '%s' is not supported":                                        "narzędzie '%s' typu '%s' nie jest obsługiwane",
+		"tools must be an array":                                                         "tools musi być tablicą",
+		"tools[%d] (%s): function.description must be a string":                          "tools[%d] (%s): function.description musi być tekstem",
+		"tools[%d] (%s): function.parameters must be an object":                          "tools[%d] (%s): function.parameters musi być obiektem",
+		"tools[%d] (%s): function.parameters.type must be \"object\"":                    "tools[%d] (%s): function.parameters.type musi mieć wartość \"object\"",
+		"tools[%d] (%s): name duplicates tools[%d]":                                      "tools[%d] (%s): nazwa powtarza tools[%d]",
+		"tools[%d] must be an object":                                                    "tools[%d] musi być obiektem",
+		"tools[%d].function must be an object":                                           "tools[%d].function musi być obiektem",
+		"tools[%d].function.name %q must be 1-64 letters, digits, underscores or dashes": "tools[%d].function.name %q musi składać się z 1-64 liter, cyfr, podkreśleń lub myślników",
+		"tools[%d].type must be \"function\"":                                            "tools[%d].type musi mieć wartość \"function\"",
+		"unknown prompt fragment '%s'":                                                   "nieznany fragment promptu '%s'",
+		"unknown upstream '%s'":                                                          "nieznany serwer nadrzędny '%s'",
+		"upstream '%s' uses the default key; rotate that instead":                        "serwer nadrzędny '%s' używa klucza domyślnego; zrób rotację tamtego klucza",
+		"upstream returned status %d: %s":                                                "serwer nadrzędny zwrócił status %d: %s",
+		"usage quotas need client authentication":                                        "limity użycia wymagają uwierzytelniania klientów",
+		"usage store unavailable: %v":                                                    "magazyn użycia niedostępny: %v",
+
+		// CLI
+		"%s is not set": "%s nie jest ustawiony",
+		"--live only applies to api_key; restart the server for %s": "--live dotyczy tylko api_key; aby zmienić %s, uruchom serwer ponownie",
+		"Configuration updated: %s = %s":                            "Zaktualizowano konfigurację: %s = %s",
+		"Failed to apply the key to the running server: %v":         "Nie udało się przekazać klucza do działającego serwera: %v",
+		"Failed to save configuration: %v":                          "Nie udało się zapisać konfiguracji: %v",
+		"Invalid %s value: %s. Must be true or false.":              "Nieprawidłowa wartość %s: %s. Dozwolone: true lub false.",
+		"Invalid key: %s. Valid keys are: %s":                       "Nieprawidłowy klucz: %s. Dozwolone klucze: %s",
+		"Invalid locale value: %v":                                  "Nieprawidłowa wartość locale: %v",
+		"Invalid port value: %s. Must be an integer.":               "Nieprawidłowa wartość port: %s. Musi być liczbą całkowitą.",
+		"Running server now uses the new api_key":                   "Działający serwer używa teraz nowego api_key",
+		"API key is not configured. Please run 'copilot-proxy config set api_key YOUR_API_KEY' or set ZAI_API_KEY environment variable. Config file location: %s": "Klucz API nie jest skonfigurowany. Uruchom 'copilot-proxy config set api_key YOUR_API_KEY' lub ustaw zmienną środowiskową ZAI_API_KEY. Plik konfiguracyjny: %s",
+	},
+}
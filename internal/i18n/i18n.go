@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is the language messages are written in
+const DefaultLocale = "en"
+
+// current holds the catalog of the active locale; nil for the default
+var current atomic.Pointer[map[string]string]
+
+// Locales lists the supported locales
+func Locales() []string {
+	locales := []string{DefaultLocale}
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	slices.Sort(locales[1:])
+	return locales
+}
+
+// normalize reduces a locale such as "pl_PL.UTF-8" or "de-AT" to its language
+func normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "_-."); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// SetLocale selects the language of translated messages; "" selects the default
+func SetLocale(locale string) error {
+	lang := normalize(locale)
+	if lang == "" || lang == DefaultLocale {
+		current.Store(nil)
+		return nil
+	}
+	catalog, ok := catalogs[lang]
+	if !ok {
+		return fmt.Errorf("unsupported locale '%s' (use one of %s)", locale, strings.Join(Locales(), ", "))
+	}
+	current.Store(&catalog)
+	return nil
+}
+
+// T translates a message into the active locale, returning it unchanged when the catalog has
+// no translation
+func T(msg string) string {
+	if catalog := current.Load(); catalog != nil {
+		if translated, ok := (*catalog)[msg]; ok {
+			return translated
+		}
+	}
+	return msg
+}
+
+// Sprintf translates a format string into the active locale, then formats it. Translations
+// keep the verbs of the original in order.
+func Sprintf(format string, args ...any) string {
+	if len(args) == 0 {
+		return T(format)
+	}
+	return fmt.Sprintf(T(format), args...)
+}
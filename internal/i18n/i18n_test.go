@@ -0,0 +1,64 @@
+package i18n
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestSprintf(t *testing.T) {
+	defer SetLocale("")
+
+	if got := Sprintf("model '%s' not found", "x"); got != "model 'x' not found" {
+		t.Errorf("default locale: %q", got)
+	}
+	if err := SetLocale("pl_PL.UTF-8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Sprintf("model '%s' not found", "x"); got != "nie znaleziono modelu 'x'" {
+		t.Errorf("pl: %q", got)
+	}
+	if got := Sprintf("untranslated %d", 1); got != "untranslated 1" {
+		t.Errorf("missing translation: %q", got)
+	}
+	// Messages without arguments are not formatted
+	if got := T("100% done"); got != "100% done" {
+		t.Errorf("T: %q", got)
+	}
+
+	if err := SetLocale("xx"); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+	if err := SetLocale("EN"); err != nil || Sprintf("model is required") != "model is required" {
+		t.Errorf("en: %v", err)
+	}
+	if !slices.Equal(Locales(), []string{"en", "de", "pl"}) {
+		t.Errorf("locales = %v", Locales())
+	}
+}
+
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestCatalogs checks that every catalog translates the same messages and keeps their verbs
+func TestCatalogs(t *testing.T) {
+	var reference []string
+	for msg := range catalogs["pl"] {
+		reference = append(reference, msg)
+	}
+	slices.Sort(reference)
+
+	for lang, catalog := range catalogs {
+		var keys []string
+		for msg, translated := range catalog {
+			keys = append(keys, msg)
+			if want, got := verbPattern.FindAllString(msg, -1), verbPattern.FindAllString(translated, -1); !reflect.DeepEqual(want, got) {
+				t.Errorf("%s: %q has verbs %v, translation %v", lang, msg, want, got)
+			}
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, reference) {
+			t.Errorf("%s translates a different set of messages than pl", lang)
+		}
+	}
+}
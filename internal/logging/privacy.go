@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// metadataKeys are attribute keys whose values describe a request without carrying its
+// content: identifiers, names, counts and settings. In privacy mode every other string or
+// structured value is summarized, so call sites added later cannot leak content by using a
+// new key.
+var metadataKeys = map[string]bool{
+	"addr": true, "age": true, "attempt": true, "audit": true, "baseline": true,
+	"batched_chunks": true, "bytes": true, "changes": true, "chunks": true, "client": true,
+	"command": true, "completion_tokens": true, "content_type": true, "count": true, "dir": true,
+	"duration": true, "elapsed": true, "endpoint": true, "event": true, "events": true,
+	"fallback": true, "files": true, "first_chunk_ms": true, "fragments": true, "from": true,
+	"gap_p95_ms": true, "header": true, "id": true, "ip": true, "job": true, "jobs": true,
+	"key": true, "limit": true, "local_model": true, "long_burn_rate": true,
+	"longest_stall_ms": true, "max_relay_ms": true, "max_repeats": true, "max_steps": true,
+	"method": true, "mode": true, "model": true, "multiplier": true, "of": true,
+	"on_chunk": true, "on_request": true, "on_response": true, "path": true, "percent": true,
+	"period": true, "plugin": true, "prompt_tokens": true, "proto": true, "quota": true,
+	"reason": true, "records": true, "redact_pii": true, "request_id": true, "requested": true,
+	"retention": true, "retry_in": true, "root": true, "rule": true, "sample_rate": true,
+	"schedule": true, "script": true, "service": true, "session": true,
+	"short_burn_rate": true, "slo": true, "spans": true, "state": true, "status": true,
+	"step": true, "store": true, "stream": true, "target": true, "tenant": true, "to": true,
+	"tokens": true, "tool": true, "top_clients": true, "top_models": true, "trace_id": true,
+	"truncated": true, "uploaded": true, "upstream": true, "user_agent": true, "verdict": true,
+	"wait": true, "window": true,
+}
+
+// Summarize describes content without revealing it: a short SHA-256 prefix, byte length and a token estimate
+func Summarize(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("sha256:%s len=%d tokens~%d", hex.EncodeToString(sum[:6]), len(content), EstimateTokens(content))
+}
+
+// EstimateTokens returns a rough token count (about four characters per token)
+func EstimateTokens(content string) int {
+	return (len(content) + 3) / 4
+}
+
+// PrivacyReplaceAttr is a slog.HandlerOptions.ReplaceAttr function that replaces every string
+// or structured attribute not named in metadataKeys or secretKeys, errors included, with its
+// Summarize form. Numbers, booleans, durations and times are kept. Installing it on the
+// process-wide handler enforces privacy for all log call sites, at every level.
+func PrivacyReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	// Secrets are masked already, and their masked form says more than a hash of it
+	if len(groups) == 0 && builtinKey(a.Key) || metadataKeys[strings.ToLower(a.Key)] || isSecretKey(a.Key) {
+		return a
+	}
+	switch a.Value.Kind() {
+	case slog.KindString, slog.KindAny:
+		return slog.String(a.Key, Summarize(valueString(a.Value)))
+	}
+	return a
+}
+
+// builtinKey reports whether key is one of the handler's own top-level attributes
+func builtinKey(key string) bool {
+	switch key {
+	case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey:
+		return true
+	}
+	return false
+}
+
+// valueString renders an attribute value for hashing; structured values are JSON-encoded
+func valueString(v slog.Value) string {
+	if v.Kind() == slog.KindString {
+		return v.String()
+	}
+	if data, err := json.Marshal(v.Any()); err == nil {
+		return string(data)
+	}
+	return v.String()
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPrivacyReplaceAttr tests that content attributes never reach the log output
+func TestPrivacyReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: PrivacyReplaceAttr,
+	}))
+
+	logger.Debug("Chat request",
+		"model", "glm-4.7",
+		"messages", []map[string]string{{"role": "user", "content": "secret plan"}},
+		slog.Group("upstream", "body", "secret body"),
+		// Keys no list names, and errors quoting upstream bodies
+		"arguments", `{"path": "secret.txt"}`,
+		"url", "https://example.com/secret",
+		"error", errors.New("upstream returned status 400: secret echo"),
+		"status", 400,
+		"elapsed", time.Second,
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("Log output leaked content: %s", out)
+	}
+	for _, kept := range []string{"model=glm-4.7", "status=400", "elapsed=1s"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Log output lost metadata %q: %s", kept, out)
+		}
+	}
+	if strings.Count(out, "sha256:") != 5 {
+		t.Errorf("Expected five summarized attributes: %s", out)
+	}
+}
+
+// TestSummarize tests that summaries are stable and content-free
+func TestSummarize(t *testing.T) {
+	a := Summarize("hello world")
+	if a != Summarize("hello world") {
+		t.Error("Summarize is not deterministic")
+	}
+	if strings.Contains(a, "hello") {
+		t.Errorf("Summary leaked content: %s", a)
+	}
+	if !strings.Contains(a, "len=11 tokens~3") {
+		t.Errorf("Unexpected summary: %s", a)
+	}
+}
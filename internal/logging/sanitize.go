@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/redact"
+)
+
+// redactedValue replaces the value of secret attributes and fields
+const redactedValue = "[REDACTED]"
+
+// secretKeys are attribute and field names whose values are always masked
+var secretKeys = map[string]bool{
+	"access_token":        true,
+	"api_key":             true,
+	"apikey":              true,
+	"authorization":       true,
+	"client_secret":       true,
+	"cookie":              true,
+	"password":            true,
+	"proxy-authorization": true,
+	"refresh_token":       true,
+	"secret":              true,
+	"set-cookie":          true,
+	"token":               true,
+	"x-api-key":           true,
+}
+
+// ReplaceAttr returns the slog.HandlerOptions.ReplaceAttr function for the process-wide logger.
+// Secrets are always sanitized; content is additionally summarized in privacy mode.
+func ReplaceAttr(privacy bool) func(groups []string, a slog.Attr) slog.Attr {
+	if !privacy {
+		return SanitizeReplaceAttr
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		return PrivacyReplaceAttr(groups, SanitizeReplaceAttr(groups, a))
+	}
+}
+
+// SanitizeReplaceAttr is a slog.HandlerOptions.ReplaceAttr function that masks credentials
+// (Authorization headers, api_key fields, bearer tokens) and collapses base64 data URLs,
+// including inside maps, slices, structs and http.Header values.
+func SanitizeReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, redactedValue)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redact.Secrets(a.Value.String()))
+	case slog.KindAny:
+		return slog.Any(a.Key, SanitizeValue(a.Value.Any()))
+	default:
+		return a
+	}
+}
+
+// SanitizeValue returns a copy of v with secrets masked. Errors and Stringers are sanitized
+// as text; other values are sanitized through their JSON form.
+func SanitizeValue(v any) any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return redact.Secrets(val)
+	case error:
+		return redact.Secrets(val.Error())
+	case fmt.Stringer:
+		return redact.Secrets(val.String())
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return redact.Secrets(fmt.Sprint(v))
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return redact.Secrets(string(data))
+	}
+	return sanitizeDecoded(decoded)
+}
+
+// sanitizeDecoded walks a decoded JSON value masking secret fields and scanning strings
+func sanitizeDecoded(v any) any {
+	switch val := v.(type) {
+	case string:
+		return redact.Secrets(val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			if isSecretKey(k) {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = sanitizeDecoded(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = sanitizeDecoded(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// isSecretKey reports whether a field name holds a credential
+func isSecretKey(key string) bool {
+	return secretKeys[strings.ToLower(key)]
+}
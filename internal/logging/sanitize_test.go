@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSanitizeReplaceAttr tests that credentials and data URLs never reach the log output
+func TestSanitizeReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: ReplaceAttr(false),
+	}))
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer sk-header-secret")
+	headers.Set("Content-Type", "application/json")
+
+	logger.Debug("Upstream request",
+		"authorization", "Bearer sk-attr-secret",
+		"api_key", "sk-key-secret",
+		"headers", headers,
+		"config", map[string]any{"api_key": "sk-nested-secret", "host": "127.0.0.1"},
+		"error", errors.New("rejected token Bearer sk-error-secret"),
+		"messages", []any{map[string]any{
+			"role":    "user",
+			"content": []any{map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,QUJDREVGR0g="}}},
+		}},
+	)
+
+	out := buf.String()
+	for _, leaked := range []string{"secret", "QUJDREVGR0g"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("Log output leaked %q: %s", leaked, out)
+		}
+	}
+	for _, kept := range []string{"application/json", "127.0.0.1", "data:image/png;base64,[12 bytes]", "role:user"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Log output lost %q: %s", kept, out)
+		}
+	}
+}
+
+// TestReplaceAttr_Privacy tests that privacy mode sanitizes before summarizing
+func TestReplaceAttr_Privacy(t *testing.T) {
+	replace := ReplaceAttr(true)
+
+	a := replace(nil, slog.String("api_key", "sk-secret"))
+	if a.Value.String() != redactedValue {
+		t.Errorf("Expected redacted api_key, got %s", a.Value.String())
+	}
+
+	a = replace(nil, slog.String("content", "hello"))
+	if !strings.HasPrefix(a.Value.String(), "sha256:") {
+		t.Errorf("Expected summarized content, got %s", a.Value.String())
+	}
+}
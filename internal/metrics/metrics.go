@@ -0,0 +1,326 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric types as reported in the Prometheus text exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry holds metric families and renders them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	restored map[string][]SeriesValue // Saved counter values seeded into families as they register
+}
+
+// family is a named metric with a fixed label set and one series per label combination
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64 // Upper bounds of a histogram's buckets, ascending, without +Inf
+	series  map[string]*series
+}
+
+// series is a single labelled value, or a histogram's observations
+type series struct {
+	labelValues []string
+	value       float64 // The sum of the observations of a histogram
+
+	counts    []uint64    // Per bucket, not cumulative; the last is +Inf
+	exemplars []*exemplar // The latest exemplar per bucket
+}
+
+// exemplar links an observation to a trace
+type exemplar struct {
+	labels map[string]string
+	value  float64
+	time   time.Time
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter registers (or returns the existing) monotonically increasing metric
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r: r, f: r.register(name, help, typeCounter, labels)}
+}
+
+// Gauge registers (or returns the existing) metric that can go up and down
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r: r, f: r.register(name, help, typeGauge, labels)}
+}
+
+// Histogram registers (or returns the existing) distribution of observations over buckets with
+// the given upper bounds
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	f := r.register(name, help, typeHistogram, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f.buckets == nil {
+		f.buckets = slices.Sorted(slices.Values(buckets))
+	} else if !slices.Equal(f.buckets, slices.Sorted(slices.Values(buckets))) {
+		panic(fmt.Sprintf("metrics: conflicting buckets for %s", name))
+	}
+	return &Histogram{r: r, f: f}
+}
+
+// register creates a family, panicking on conflicting re-registration (a programming error)
+func (r *Registry) register(name, help, typ string, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || strings.Join(f.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Sprintf("metrics: conflicting registration of %s", name))
+		}
+		return f
+	}
+
+	f := &family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	r.families[name] = f
+	if typ == typeCounter {
+		r.seed(f)
+	}
+	return f
+}
+
+// update applies fn to the series identified by labelValues, creating it if needed
+func (r *Registry) update(f *family, labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// Counter is a monotonically increasing metric
+type Counter struct {
+	r *Registry
+	f *family
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v, which must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.r.update(c.f, labelValues, func(s *series) { s.value += v })
+}
+
+// Gauge is a metric that can be set to arbitrary values
+type Gauge struct {
+	r *Registry
+	f *family
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.r.update(g.f, labelValues, func(s *series) { s.value = v })
+}
+
+// Add changes the gauge by v
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.r.update(g.f, labelValues, func(s *series) { s.value += v })
+}
+
+// Histogram counts observations, such as latencies, in buckets
+type Histogram struct {
+	r *Registry
+	f *family
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.ObserveExemplar(v, nil, labelValues...)
+}
+
+// ObserveExemplar records v with an exemplar, such as {"trace_id": "..."}, that replaces the
+// previous one of v's bucket. Exemplars are only rendered in the OpenMetrics format.
+func (h *Histogram) ObserveExemplar(v float64, labels map[string]string, labelValues ...string) {
+	i, _ := slices.BinarySearch(h.f.buckets, v)
+	var ex *exemplar
+	if len(labels) > 0 {
+		ex = &exemplar{labels: labels, value: v, time: time.Now()}
+	}
+	h.r.update(h.f, labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets)+1)
+			s.exemplars = make([]*exemplar, len(h.f.buckets)+1)
+		}
+		s.counts[i]++
+		s.value += v
+		if ex != nil {
+			s.exemplars[i] = ex
+		}
+	})
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format, sorted by name and labels
+func (r *Registry) WriteText(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes all metrics in the OpenMetrics text format, which adds exemplars to
+// histogram buckets
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+// write renders the registry in either text format
+func (r *Registry) write(w io.Writer, openMetrics bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		// OpenMetrics names a counter family without the _total suffix of its samples
+		familyName := f.name
+		if openMetrics && f.typ == typeCounter {
+			familyName = strings.TrimSuffix(f.name, "_total")
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", familyName, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", familyName, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ == typeHistogram {
+				writeHistogram(&b, f, s, openMetrics)
+				continue
+			}
+			b.WriteString(f.name)
+			writeLabels(&b, f.labels, s.labelValues)
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.value))
+			b.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHistogram renders a histogram series as cumulative buckets, sum and count
+func writeHistogram(b *strings.Builder, f *family, s *series, openMetrics bool) {
+	names := append(slices.Clone(f.labels), "le")
+	values := append(slices.Clone(s.labelValues), "")
+	var cumulative uint64
+	for i, n := range s.counts {
+		cumulative += n
+		values[len(values)-1] = "+Inf"
+		if i < len(f.buckets) {
+			values[len(values)-1] = formatValue(f.buckets[i])
+		}
+		b.WriteString(f.name + "_bucket")
+		writeLabels(b, names, values)
+		fmt.Fprintf(b, " %d", cumulative)
+		if ex := s.exemplars[i]; openMetrics && ex != nil {
+			b.WriteString(" # ")
+			exNames := slices.Sorted(maps.Keys(ex.labels))
+			exValues := make([]string, len(exNames))
+			for j, k := range exNames {
+				exValues[j] = ex.labels[k]
+			}
+			if len(exNames) == 0 {
+				b.WriteString("{}")
+			}
+			writeLabels(b, exNames, exValues)
+			fmt.Fprintf(b, " %s %s", formatValue(ex.value), strconv.FormatFloat(float64(ex.time.UnixMilli())/1000, 'f', 3, 64))
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(f.name + "_sum")
+	writeLabels(b, f.labels, s.labelValues)
+	b.WriteString(" " + formatValue(s.value) + "\n")
+	b.WriteString(f.name + "_count")
+	writeLabels(b, f.labels, s.labelValues)
+	fmt.Fprintf(b, " %d\n", cumulative)
+}
+
+// formatValue renders a sample value, spelling infinities as the exposition formats do
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeLabels renders {name="value",...} for a series
+func writeLabels(b *strings.Builder, names, values []string) {
+	if len(names) == 0 {
+		return
+	}
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	b.WriteByte('}')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestWriteText tests the Prometheus text exposition output
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	throttled := r.Counter("test_throttled_total", "Requests throttled", "ip")
+	tracked := r.Gauge("test_tracked", "Tracked clients")
+
+	throttled.Inc("10.0.0.2")
+	throttled.Inc("10.0.0.1")
+	throttled.Add(2, "10.0.0.1")
+	tracked.Set(5)
+	tracked.Add(-1)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := `# HELP test_throttled_total Requests throttled
+# TYPE test_throttled_total counter
+test_throttled_total{ip="10.0.0.1"} 3
+test_throttled_total{ip="10.0.0.2"} 1
+# HELP test_tracked Tracked clients
+# TYPE test_tracked gauge
+test_tracked 4
+`
+	if b.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", b.String(), expected)
+	}
+}
+
+// TestRegister_Idempotent tests that re-registering returns the same family
+func TestRegister_Idempotent(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "help", "a").Inc("x")
+	r.Counter("test_total", "help", "a").Inc("x")
+
+	var b strings.Builder
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), `test_total{a="x"} 2`) {
+		t.Errorf("Expected shared series, got:\n%s", b.String())
+	}
+}
+
+// TestLabelEscaping tests that label values are escaped
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "help", "v").Inc("a\"b\\c")
+
+	var b strings.Builder
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), `test_total{v="a\"b\\c"} 1`) {
+		t.Errorf("Label not escaped:\n%s", b.String())
+	}
+}
+
+// TestHistogram tests cumulative buckets, sum and count in the text format
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	latency := r.Histogram("test_seconds", "Latency", []float64{1, 0.5}, "model")
+	latency.Observe(0.2, "a")
+	latency.Observe(0.7, "a")
+	latency.ObserveExemplar(3, map[string]string{"trace_id": "t1"}, "a")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := `# HELP test_seconds Latency
+# TYPE test_seconds histogram
+test_seconds_bucket{model="a",le="0.5"} 1
+test_seconds_bucket{model="a",le="1"} 2
+test_seconds_bucket{model="a",le="+Inf"} 3
+test_seconds_sum{model="a"} 3.9
+test_seconds_count{model="a"} 3
+`
+	if b.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", b.String(), expected)
+	}
+}
+
+// TestWriteOpenMetrics tests exemplars and the OpenMetrics naming of counters
+func TestWriteOpenMetrics(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_requests_total", "Requests").Inc()
+	latency := r.Histogram("test_seconds", "Latency", []float64{1})
+	latency.ObserveExemplar(0.4, map[string]string{"trace_id": "t1"})
+	latency.ObserveExemplar(0.6, map[string]string{"trace_id": "t2", "model": "m"})
+	latency.Observe(2)
+
+	var b strings.Builder
+	if err := r.WriteOpenMetrics(&b); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests counter\ntest_requests_total 1\n",
+		`test_seconds_bucket{le="1"} 2 # {model="m",trace_id="t2"} 0.6 `,
+		"test_seconds_bucket{le=\"+Inf\"} 3\n",
+		"test_seconds_count 3\n# EOF\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+
+	// The plain text format has no room for exemplars
+	b.Reset()
+	r.WriteText(&b)
+	if strings.Contains(b.String(), "trace_id") || strings.Contains(b.String(), "# EOF") {
+		t.Errorf("Unexpected OpenMetrics syntax in text format:\n%s", b.String())
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot is the persisted form of a registry's counters. Gauges describe current state and
+// are not saved.
+type Snapshot struct {
+	SavedAt  time.Time                `json:"saved_at"`
+	Counters map[string][]SeriesValue `json:"counters"`
+}
+
+// SeriesValue is one saved counter series
+type SeriesValue struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Snapshot captures the current value of every counter series
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := Snapshot{SavedAt: time.Now().UTC(), Counters: make(map[string][]SeriesValue)}
+	for name, f := range r.families {
+		if f.typ != typeCounter {
+			continue
+		}
+		for _, s := range f.series {
+			var labels map[string]string
+			if len(f.labels) > 0 {
+				labels = make(map[string]string, len(f.labels))
+				for i, l := range f.labels {
+					labels[l] = s.labelValues[i]
+				}
+			}
+			snap.Counters[name] = append(snap.Counters[name], SeriesValue{Labels: labels, Value: s.value})
+		}
+	}
+	// Counters restored but not registered in this run are carried over unchanged
+	for name, values := range r.restored {
+		if _, ok := r.families[name]; !ok {
+			snap.Counters[name] = values
+		}
+	}
+	return snap
+}
+
+// Restore adds saved counter values to the registry. Counters registered later are seeded
+// when they register, so Restore can run before the rest of the application starts.
+func (r *Registry) Restore(snap Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.restored = snap.Counters
+	for _, f := range r.families {
+		if f.typ == typeCounter {
+			r.seed(f)
+		}
+	}
+}
+
+// seed adds the restored values of a counter family. Labels added to the family since the save
+// are seeded with an empty value; series with a saved label the family no longer has are dropped.
+// Callers hold r.mu.
+func (r *Registry) seed(f *family) {
+	for _, sv := range r.restored[f.name] {
+		values := make([]string, len(f.labels))
+		matched := 0
+		for i, l := range f.labels {
+			if v, ok := sv.Labels[l]; ok {
+				values[i] = v
+				matched++
+			}
+		}
+		if matched != len(sv.Labels) {
+			continue
+		}
+
+		key := strings.Join(values, "\xff")
+		s, ok := f.series[key]
+		if !ok {
+			s = &series{labelValues: values}
+			f.series[key] = s
+		}
+		s.value += sv.Value
+	}
+}
+
+// LoadFile reads a snapshot; a missing file yields an empty snapshot
+func LoadFile(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Snapshot{}, nil
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid metrics state %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// SaveFile writes a snapshot atomically so a crash mid-write cannot lose the previous state
+func SaveFile(path string, snap Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".metrics-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Persister periodically saves a registry's counters to a file
+type Persister struct {
+	registry *Registry
+	path     string
+	interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewPersister restores the registry from path and returns a persister that saves it back
+func NewPersister(registry *Registry, path string, interval time.Duration) (*Persister, error) {
+	snap, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	registry.Restore(snap)
+
+	return &Persister{registry: registry, path: path, interval: interval, stop: make(chan struct{})}, nil
+}
+
+// Start begins saving on every interval
+func (p *Persister) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.save()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic saving and writes a final snapshot
+func (p *Persister) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+	p.save()
+}
+
+// save writes the current counters, logging failures
+func (p *Persister) save() {
+	if err := SaveFile(p.path, p.registry.Snapshot()); err != nil {
+		slog.Error("Failed to save metrics", "path", p.path, "error", err)
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPersistRoundTrip tests that counters survive a save and restore into a new registry
+func TestPersistRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "metrics.json")
+
+	r := NewRegistry()
+	requests := r.Counter("test_requests_total", "Requests", "model")
+	r.Counter("test_unused_total", "Never restored here")
+	r.Gauge("test_inflight", "In flight").Set(3)
+	requests.Add(5, "glm-4.7")
+	r.Counter("test_unused_total", "Never restored here").Inc()
+
+	if err := SaveFile(path, r.Snapshot()); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	snap, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if _, ok := snap.Counters["test_inflight"]; ok {
+		t.Error("gauges should not be persisted")
+	}
+
+	// Restore before registration, as the server does at startup
+	restored := NewRegistry()
+	restored.Restore(snap)
+	restored.Counter("test_requests_total", "Requests", "model").Inc("glm-4.7")
+
+	var b strings.Builder
+	if err := restored.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if !strings.Contains(b.String(), `test_requests_total{model="glm-4.7"} 6`) {
+		t.Errorf("restored counter not continued:\n%s", b.String())
+	}
+
+	// Counters not registered in this run are carried over to the next save
+	if got := restored.Snapshot().Counters["test_unused_total"]; len(got) != 1 || got[0].Value != 1 {
+		t.Errorf("unregistered counter lost: %+v", got)
+	}
+}
+
+// TestRestoreLabelMismatch tests that series saved with different label names are dropped
+func TestRestoreLabelMismatch(t *testing.T) {
+	r := NewRegistry()
+	r.Restore(Snapshot{Counters: map[string][]SeriesValue{
+		"test_total": {{Labels: map[string]string{"client": "a"}, Value: 2}},
+	}})
+	r.Counter("test_total", "Test", "model")
+
+	if got := r.Snapshot().Counters["test_total"]; len(got) != 0 {
+		t.Errorf("expected mismatched series to be dropped, got %+v", got)
+	}
+}
+
+// TestLoadFileMissing tests that a missing state file is not an error
+func TestLoadFileMissing(t *testing.T) {
+	snap, err := LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(snap.Counters) != 0 {
+		t.Errorf("expected empty snapshot, got %+v, %v", snap, err)
+	}
+}
+
+// TestPersisterStop tests that stopping writes a final snapshot
+func TestPersisterStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	r := NewRegistry()
+	p, err := NewPersister(r, path, 0)
+	if err != nil {
+		t.Fatalf("NewPersister failed: %v", err)
+	}
+	r.Counter("test_total", "Test").Inc()
+	p.Stop()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+}
+
+// TestRestoreAddedLabels tests that series saved before a label was added are kept with it empty
+func TestRestoreAddedLabels(t *testing.T) {
+	r := NewRegistry()
+	r.Restore(Snapshot{Counters: map[string][]SeriesValue{
+		"test_total": {{Labels: map[string]string{"model": "glm-4.7"}, Value: 2}},
+	}})
+	r.Counter("test_total", "Test", "model", "client").Inc("glm-4.7", "alice")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	for _, want := range []string{`test_total{model="glm-4.7",client=""} 2`, `test_total{model="glm-4.7",client="alice"} 1`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %s in:\n%s", want, b.String())
+		}
+	}
+}
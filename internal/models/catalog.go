@@ -1,6 +1,12 @@
 package models
 
-import "strings"
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
 
 // Model represents a single model in the catalog
 type Model struct {
@@ -11,7 +17,15 @@ type Model struct {
 	Digest       string       `json:"digest"`
 	Capabilities []string     `json:"capabilities"`
 	Details      ModelDetails `json:"details"`
-	ContextLen   int          `json:"-"` // Internal use, not serialized
+	ContextLen   int          `json:"-"` // Context window in tokens (prompt plus completion)
+	MaxOutput    int          `json:"-"` // Maximum completion tokens
+	InputPrice   float64      `json:"-"` // List price in USD per million prompt tokens
+	OutputPrice  float64      `json:"-"` // List price in USD per million completion tokens
+}
+
+// Cost returns the list-price cost in USD of a request with the given token counts
+func (m Model) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.InputPrice + float64(completionTokens)*m.OutputPrice) / 1_000_000
 }
 
 // ModelDetails contains model metadata
@@ -28,17 +42,18 @@ type ModelCatalog struct {
 	Models []Model `json:"models"`
 }
 
-// Typed catalog with context lengths included
+// Typed catalog with context lengths included; digests and sizes are synthesized in init
 var Catalog = ModelCatalog{
 	Models: []Model{
 		{
 			Name:         "GLM-4.7",
 			Model:        "glm-4.7",
 			ModifiedAt:   "2025-01-01T00:00:00Z",
-			Size:         0,
-			Digest:       "glm-4.7",
-			Capabilities: []string{"tools", "vision"},
+			Capabilities: []string{"tools", "thinking"},
 			ContextLen:   200000,
+			MaxOutput:    131072,
+			InputPrice:   0.60,
+			OutputPrice:  2.20,
 			Details: ModelDetails{
 				Format:            "glm",
 				Family:            "glm",
@@ -51,10 +66,11 @@ var Catalog = ModelCatalog{
 			Name:         "GLM-4.7-Flash",
 			Model:        "glm-4.7-flash",
 			ModifiedAt:   "2026-01-22T00:00:00Z",
-			Size:         0,
-			Digest:       "glm-4.7-flash",
-			Capabilities: []string{"tools"},
+			Capabilities: []string{"tools", "thinking"},
 			ContextLen:   200000,
+			MaxOutput:    131072,
+			InputPrice:   0,
+			OutputPrice:  0,
 			Details: ModelDetails{
 				Format:            "glm",
 				Family:            "glm",
@@ -67,10 +83,62 @@ var Catalog = ModelCatalog{
 			Name:         "GLM-4.7-FlashX",
 			Model:        "glm-4.7-flashx",
 			ModifiedAt:   "2026-01-22T00:00:00Z",
-			Size:         0,
-			Digest:       "glm-4.7-flashx",
-			Capabilities: []string{"tools"},
+			Capabilities: []string{"tools", "thinking"},
 			ContextLen:   200000,
+			MaxOutput:    131072,
+			InputPrice:   0.07,
+			OutputPrice:  0.40,
+			Details: ModelDetails{
+				Format:            "glm",
+				Family:            "glm",
+				Families:          []string{"glm"},
+				ParameterSize:     "cloud",
+				QuantizationLevel: "cloud",
+			},
+		},
+		{
+			Name:         "GLM-4.6V",
+			Model:        "glm-4.6v",
+			ModifiedAt:   "2025-12-08T00:00:00Z",
+			Capabilities: []string{"tools", "vision", "thinking"},
+			ContextLen:   128000,
+			MaxOutput:    32768,
+			InputPrice:   0.30,
+			OutputPrice:  0.90,
+			Details: ModelDetails{
+				Format:            "glm",
+				Family:            "glm",
+				Families:          []string{"glm"},
+				ParameterSize:     "cloud",
+				QuantizationLevel: "cloud",
+			},
+		},
+		{
+			Name:         "GLM-4.6V-Flash",
+			Model:        "glm-4.6v-flash",
+			ModifiedAt:   "2025-12-08T00:00:00Z",
+			Capabilities: []string{"tools", "vision", "thinking"},
+			ContextLen:   128000,
+			MaxOutput:    32768,
+			InputPrice:   0,
+			OutputPrice:  0,
+			Details: ModelDetails{
+				Format:            "glm",
+				Family:            "glm",
+				Families:          []string{"glm"},
+				ParameterSize:     "cloud",
+				QuantizationLevel: "cloud",
+			},
+		},
+		{
+			Name:         "GLM-4-Flash",
+			Model:        "glm-4-flash-250414",
+			ModifiedAt:   "2025-04-14T00:00:00Z",
+			Capabilities: []string{"tools"},
+			ContextLen:   128000,
+			MaxOutput:    16384,
+			InputPrice:   0,
+			OutputPrice:  0,
 			Details: ModelDetails{
 				Format:            "glm",
 				Family:            "glm",
@@ -82,43 +150,149 @@ var Catalog = ModelCatalog{
 	},
 }
 
-// IsValidModel checks if a model name exists in the catalog (case-insensitive)
-func IsValidModel(name string) bool {
+func init() {
+	for i := range Catalog.Models {
+		m := &Catalog.Models[i]
+		if m.Digest == "" {
+			m.Digest = synthesizeDigest(m)
+		}
+		if m.Size == 0 {
+			m.Size = synthesizeSize(m.Digest)
+		}
+	}
+}
+
+// synthesizeDigest returns a stable pseudo-digest for a cloud model from its name and version
+// (modification date). Ollama clients key caches on the digest, so it must only change when
+// the model does.
+func synthesizeDigest(m *Model) string {
+	sum := sha256.Sum256([]byte(m.Model + "@" + m.ModifiedAt))
+	return hex.EncodeToString(sum[:])
+}
+
+// synthesizeSize derives a plausible, stable model size (1-9 GiB) from a digest
+func synthesizeSize(digest string) int {
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) < 4 {
+		return 1 << 30
+	}
+	return 1<<30 + int(binary.BigEndian.Uint32(raw[:4]))*2
+}
+
+// HasDigest reports whether digest (with or without a "sha256:" prefix) belongs to a catalog model
+func HasDigest(digest string) bool {
+	digest = strings.TrimPrefix(digest, "sha256:")
 	for _, m := range Catalog.Models {
-		if strings.EqualFold(m.Name, name) || strings.EqualFold(m.Model, name) {
+		if strings.EqualFold(m.Digest, digest) {
 			return true
 		}
 	}
 	return false
 }
 
-// GetModelContextLength returns the context length for a model
-func GetModelContextLength(name string) int {
+// DefaultTag is the tag Ollama clients append when none is given
+const DefaultTag = "latest"
+
+// aliasTags name no variant of their own: "name:tag" with one of them is the model itself
+var aliasTags = []string{DefaultTag, "cloud"}
+
+// lookup finds a catalog model by name (case-insensitive). Ollama-style "name:tag" forms are
+// resolved too: "glm-4.7:latest" and "glm-4.7:cloud" match glm-4.7, "glm:4.7" matches glm-4.7.
+// Any other tag must name a variant, so "glm-4.7:q4" is not found.
+func lookup(name string) (*Model, bool) {
+	if m, ok := lookupExact(name); ok {
+		return m, true
+	}
+
+	base, tag, ok := strings.Cut(name, ":")
+	if !ok {
+		return nil, false
+	}
+	if slices.ContainsFunc(aliasTags, func(alias string) bool { return strings.EqualFold(tag, alias) }) {
+		return lookupExact(base)
+	}
+	if tag == "" {
+		return nil, false
+	}
+	return lookupExact(base + "-" + tag)
+}
+
+// lookupExact finds a catalog model by display or API name
+func lookupExact(name string) (*Model, bool) {
 	for _, m := range Catalog.Models {
 		if strings.EqualFold(m.Name, name) || strings.EqualFold(m.Model, name) {
-			return m.ContextLen
+			return &m, true
 		}
 	}
+	return nil, false
+}
+
+// IsValidModel checks if a model name exists in the catalog (case-insensitive)
+func IsValidModel(name string) bool {
+	_, ok := lookup(name)
+	return ok
+}
+
+// GetModelContextLength returns the context length for a model
+func GetModelContextLength(name string) int {
+	if m, ok := lookup(name); ok {
+		return m.ContextLen
+	}
 	return 128000 // Default for older models
 }
 
+// GetModelMaxOutput returns the maximum completion tokens for a model
+func GetModelMaxOutput(name string) int {
+	if m, ok := lookup(name); ok && m.MaxOutput > 0 {
+		return m.MaxOutput
+	}
+	return 16384 // Conservative default
+}
+
 // GetModel returns the full model struct if found
 func GetModel(name string) (*Model, bool) {
-	for _, m := range Catalog.Models {
-		if strings.EqualFold(m.Name, name) || strings.EqualFold(m.Model, name) {
-			return &m, true
-		}
+	return lookup(name)
+}
+
+// HasCapability reports whether a model advertises a capability such as "tools", "vision" or "thinking"
+func HasCapability(name, capability string) bool {
+	m, ok := GetModel(name)
+	return ok && slices.Contains(m.Capabilities, capability)
+}
+
+// IsSnapshotOf reports whether id names an upstream snapshot of a catalog model, such as
+// "glm-4.7-251222" for glm-4.7: the model's API name, a dash and a suffix that does not make
+// it another catalog model
+func IsSnapshotOf(id, name string) bool {
+	m, ok := lookup(name)
+	if !ok || !strings.HasPrefix(strings.ToLower(id), m.Model+"-") || len(id) == len(m.Model)+1 {
+		return false
 	}
-	return nil, false
+	_, other := lookupExact(id)
+	return !other
 }
 
 // GetCanonicalModelName returns the canonical (lowercase) model name for any input
 // This ensures the proxy sends the correct lowercase model name to the upstream API
 func GetCanonicalModelName(name string) string {
-	for _, m := range Catalog.Models {
-		if strings.EqualFold(m.Name, name) || strings.EqualFold(m.Model, name) {
-			return m.Model // Return the lowercase Model field
-		}
+	if m, ok := lookup(name); ok {
+		return m.Model // Return the lowercase Model field
 	}
 	return name // Return original if not found (shouldn't happen after validation)
 }
+
+// Tags returns the catalog as listed by /api/tags, with each model in Ollama's tagged
+// "name:latest" form so clients that append a tag see the names they will request
+func Tags() ModelCatalog {
+	return TagsOf(Catalog.Models)
+}
+
+// TagsOf returns models as listed by /api/tags, each in the tagged "name:latest" form
+func TagsOf(list []Model) ModelCatalog {
+	tagged := ModelCatalog{Models: make([]Model, len(list))}
+	for i, m := range list {
+		m.Model += ":" + DefaultTag
+		tagged.Models[i] = m
+	}
+	return tagged
+}
@@ -14,6 +14,17 @@ func TestIsValidModel(t *testing.T) {
 		{"glm-4.7", true},        // case insensitive
 		{"glm-4.7-flash", true},  // case insensitive
 		{"glm-4.7-flashx", true}, // case insensitive
+		{"GLM-4.6V", true},
+		{"glm-4.6v-flash", true},
+		{"GLM-4-Flash", true},
+		{"glm-4-flash-250414", true},
+		{"glm-4.7:latest", true}, // Ollama tag
+		{"GLM-4.7-Flash:cloud", true},
+		{"glm:4.7", true},
+		{"unknown:latest", false},
+		{"glm-4.7:LATEST", true},
+		{"glm-4.7:q4_K_M", false}, // Unknown tags are not the base model
+		{"glm-4.7:", false},
 		{"unknown-model", false},
 		{"", false},
 	}
@@ -37,6 +48,8 @@ func TestGetModelContextLength(t *testing.T) {
 		{"GLM-4.7", 200000},
 		{"GLM-4.7-Flash", 200000},
 		{"GLM-4.7-FlashX", 200000},
+		{"GLM-4.6V", 128000},
+		{"GLM-4-Flash", 128000},
 		{"unknown-model", 128000}, // default
 		{"", 128000},              // default
 	}
@@ -51,6 +64,28 @@ func TestGetModelContextLength(t *testing.T) {
 	}
 }
 
+// TestGetModelMaxOutput tests the GetModelMaxOutput function
+func TestGetModelMaxOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected int
+	}{
+		{"GLM-4.7", 131072},
+		{"glm-4.6v:latest", 32768},
+		{"GLM-4-Flash", 16384},
+		{"unknown-model", 16384}, // default
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := GetModelMaxOutput(tt.name)
+			if result != tt.expected {
+				t.Errorf("GetModelMaxOutput(%s) = %v, want %v", tt.name, result, tt.expected)
+			}
+		})
+	}
+}
+
 // TestGetModel tests the GetModel function
 func TestGetModel(t *testing.T) {
 	// Test existing model
@@ -86,7 +121,11 @@ func TestGetCanonicalModelName(t *testing.T) {
 		{"Lowercase glm-4.7-flash", "glm-4.7-flash", "glm-4.7-flash"},
 		{"Uppercase GLM-4.7-FlashX", "GLM-4.7-FlashX", "glm-4.7-flashx"},
 		{"Lowercase glm-4.7-flashx", "glm-4.7-flashx", "glm-4.7-flashx"},
+		{"Tagged glm-4.7:latest", "glm-4.7:latest", "glm-4.7"},
+		{"Tag as version glm:4.7", "glm:4.7", "glm-4.7"},
+		{"Tag as variant glm-4.7:flashx", "glm-4.7:flashx", "glm-4.7-flashx"},
 		{"Unknown model (returns as-is)", "unknown-model", "unknown-model"},
+		{"Unknown tag (returns as-is)", "glm-4.7:q4", "glm-4.7:q4"},
 	}
 
 	for _, tt := range tests {
@@ -98,3 +137,97 @@ func TestGetCanonicalModelName(t *testing.T) {
 		})
 	}
 }
+
+// TestHasCapability tests capability lookups
+func TestHasCapability(t *testing.T) {
+	tests := []struct {
+		name       string
+		capability string
+		expected   bool
+	}{
+		{"GLM-4.7", "tools", true},
+		{"GLM-4.7", "vision", false},
+		{"GLM-4.6V", "vision", true},
+		{"glm-4.6v-flash", "vision", true},
+		{"GLM-4-Flash", "vision", false},
+		{"GLM-4.7", "thinking", true},
+		{"GLM-4.6V", "thinking", true},
+		{"GLM-4-Flash", "thinking", false},
+		{"unknown-model", "tools", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.capability, func(t *testing.T) {
+			if got := HasCapability(tt.name, tt.capability); got != tt.expected {
+				t.Errorf("HasCapability(%s, %s) = %v, want %v", tt.name, tt.capability, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestTags tests that /api/tags entries carry the default tag
+func TestTags(t *testing.T) {
+	tags := Tags()
+	if len(tags.Models) != len(Catalog.Models) {
+		t.Fatalf("Expected %d models, got %d", len(Catalog.Models), len(tags.Models))
+	}
+	for i, m := range tags.Models {
+		want := Catalog.Models[i].Model + ":latest"
+		if m.Model != want {
+			t.Errorf("Tags()[%d].Model = %s, want %s", i, m.Model, want)
+		}
+		if !IsValidModel(m.Model) {
+			t.Errorf("Tagged name %s should resolve", m.Model)
+		}
+	}
+	if Catalog.Models[0].Model != "glm-4.7" {
+		t.Error("Tags() must not modify the catalog")
+	}
+}
+
+// TestSynthesizedIdentity tests that digests and sizes are stable, distinct and plausible
+func TestSynthesizedIdentity(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, m := range Catalog.Models {
+		if len(m.Digest) != 64 {
+			t.Errorf("%s: digest %q is not a sha256 hex string", m.Name, m.Digest)
+		}
+		if seen[m.Digest] {
+			t.Errorf("%s: duplicate digest", m.Name)
+		}
+		seen[m.Digest] = true
+
+		if m.Digest != synthesizeDigest(&m) {
+			t.Errorf("%s: digest is not stable", m.Name)
+		}
+		if m.Size < 1<<30 || m.Size > 10<<30 {
+			t.Errorf("%s: implausible size %d", m.Name, m.Size)
+		}
+		if !HasDigest("sha256:" + m.Digest) {
+			t.Errorf("%s: HasDigest should accept the prefixed digest", m.Name)
+		}
+	}
+	if HasDigest("sha256:0000") {
+		t.Error("Unknown digest should not match")
+	}
+}
+
+func TestIsSnapshotOf(t *testing.T) {
+	tests := []struct {
+		id, name string
+		expected bool
+	}{
+		{"glm-4.7-251222", "GLM-4.7", true},
+		{"GLM-4.7-251222", "glm-4.7:latest", true},
+		{"glm-4.7", "glm-4.7", false},
+		{"glm-4.7-", "glm-4.7", false},
+		{"glm-4.7-flash", "glm-4.7", false}, // Another catalog model
+		{"glm-4.6v-251208", "glm-4.7", false},
+		{"glm-4.7-251222", "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := IsSnapshotOf(tt.id, tt.name); got != tt.expected {
+			t.Errorf("IsSnapshotOf(%q, %q) = %v, want %v", tt.id, tt.name, got, tt.expected)
+		}
+	}
+}
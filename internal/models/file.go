@@ -0,0 +1,247 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// defaultModifiedAt is the version date of file models that do not give one
+const defaultModifiedAt = "1970-01-01T00:00:00Z"
+
+// File is a catalog file: models to add to the built-in catalog, or to change in it
+type File struct {
+	Replace bool    `mapstructure:"replace"` // Drop the built-in models, serving only the file's
+	Models  []Entry `mapstructure:"models"`
+}
+
+// Entry is a model in a catalog file. An entry whose name or API name matches a built-in model
+// changes only the fields it sets; any other entry adds a model.
+type Entry struct {
+	Name          string   `mapstructure:"name"`  // Display name, e.g. "GLM-5"
+	Model         string   `mapstructure:"model"` // API name sent upstream; defaults to the lowercase name
+	ModifiedAt    string   `mapstructure:"modified_at"`
+	Capabilities  []string `mapstructure:"capabilities"` // e.g. tools, vision, thinking
+	ContextLength int      `mapstructure:"context_length"`
+	MaxOutput     int      `mapstructure:"max_output"`
+	InputPrice    *float64 `mapstructure:"input_price"`  // USD per million prompt tokens
+	OutputPrice   *float64 `mapstructure:"output_price"` // USD per million completion tokens
+	Family        string   `mapstructure:"family"`
+}
+
+// Capabilities are the model capabilities the proxy acts on
+var Capabilities = []string{"tools", "vision", "thinking"}
+
+// ReadFile reads a JSON or YAML catalog file, chosen by extension, without applying it
+func ReadFile(path string) (File, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return File{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var f File
+	if err := v.Unmarshal(&f); err != nil {
+		return File{}, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// LoadFile reads a JSON or YAML catalog file, chosen by extension, and applies it
+func LoadFile(path string) error {
+	f, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := Apply(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks a catalog file against the current catalog without changing it, returning
+// every problem found joined into one error
+func (f File) Validate() error {
+	_, errs := f.merge()
+	return errors.Join(errs...)
+}
+
+// Apply merges a catalog file into the catalog. It must run before the catalog is served. A file
+// with any problem is rejected whole.
+func Apply(f File) error {
+	models, errs := f.merge()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for i := range models {
+		m := &models[i]
+		m.Digest = synthesizeDigest(m)
+		m.Size = synthesizeSize(m.Digest)
+	}
+	Catalog.Models = models
+	return nil
+}
+
+// merge applies the file's entries to a copy of the catalog, returning the result and the
+// problems found: invalid fields, unknown capabilities, new models without a usable API name
+// and names that two models share
+func (f File) merge() ([]Model, []error) {
+	models := Catalog.Models
+	if f.Replace {
+		models = nil
+	}
+	models = slices.Clone(models)
+
+	var errs []error
+	seen := make(map[string]bool)
+	for i, e := range f.Models {
+		if e.Name == "" && e.Model == "" {
+			errs = append(errs, fmt.Errorf("model %d: name or model is required", i))
+			continue
+		}
+		id := cmp.Or(e.Name, e.Model)
+		if e.ModifiedAt != "" {
+			if _, err := time.Parse(time.RFC3339, e.ModifiedAt); err != nil {
+				errs = append(errs, fmt.Errorf("model %q: modified_at must be an RFC 3339 time", id))
+			}
+		}
+		if e.ContextLength < 0 || e.MaxOutput < 0 || (e.InputPrice != nil && *e.InputPrice < 0) || (e.OutputPrice != nil && *e.OutputPrice < 0) {
+			errs = append(errs, fmt.Errorf("model %q: lengths and prices must not be negative", id))
+		}
+		for _, c := range e.Capabilities {
+			if !slices.Contains(Capabilities, c) {
+				errs = append(errs, fmt.Errorf("model %q: unknown capability %q%s", id, c, suggest(c, Capabilities)))
+			}
+		}
+		if e.Model != "" && strings.ContainsFunc(e.Model, unicode.IsSpace) {
+			errs = append(errs, fmt.Errorf("model %q: model %q must not contain spaces", id, e.Model))
+		}
+
+		m := findEntry(models, e)
+		if m == nil {
+			if e.Model == "" && strings.ContainsFunc(e.Name, unicode.IsSpace) {
+				errs = append(errs, fmt.Errorf("model %q: model is required, since the name is not usable as an API name", id))
+			}
+			if e.Name == "" {
+				e.Name = e.Model
+			}
+			models = append(models, Model{
+				Name:         e.Name,
+				Model:        strings.ToLower(e.Name),
+				ModifiedAt:   defaultModifiedAt,
+				Capabilities: []string{},
+				ContextLen:   128000,
+				Details: ModelDetails{
+					Format:            "glm",
+					Family:            "glm",
+					Families:          []string{"glm"},
+					ParameterSize:     "cloud",
+					QuantizationLevel: "cloud",
+				},
+			})
+			m = &models[len(models)-1]
+		}
+		e.apply(m)
+
+		if seen[m.Model] {
+			errs = append(errs, fmt.Errorf("model %q: listed twice", m.Model))
+		}
+		seen[m.Model] = true
+	}
+
+	// Lookups match either name, so no name may belong to two models
+	for i, a := range models {
+		for _, b := range models[i+1:] {
+			for _, name := range []string{a.Name, a.Model} {
+				if strings.EqualFold(name, b.Name) || strings.EqualFold(name, b.Model) {
+					errs = append(errs, fmt.Errorf("model %q: name %q is also used by model %q", b.Model, name, a.Model))
+					break
+				}
+			}
+		}
+	}
+	return models, errs
+}
+
+// suggest returns a " (did you mean ...?)" hint naming the closest of known, or "" if none is close
+func suggest(name string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(strings.ToLower(name), k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// findEntry returns the model an entry changes, matching either of its names
+func findEntry(models []Model, e Entry) *Model {
+	for i := range models {
+		m := &models[i]
+		if (e.Model != "" && strings.EqualFold(m.Model, e.Model)) || (e.Name != "" && strings.EqualFold(m.Name, e.Name)) {
+			return m
+		}
+	}
+	return nil
+}
+
+// apply copies the fields the entry sets onto m
+func (e Entry) apply(m *Model) {
+	if e.Name != "" {
+		m.Name = e.Name
+	}
+	if e.Model != "" {
+		m.Model = strings.ToLower(e.Model)
+	}
+	if e.ModifiedAt != "" {
+		m.ModifiedAt = e.ModifiedAt
+	}
+	if e.Capabilities != nil {
+		m.Capabilities = e.Capabilities
+	}
+	if e.ContextLength > 0 {
+		m.ContextLen = e.ContextLength
+	}
+	if e.MaxOutput > 0 {
+		m.MaxOutput = e.MaxOutput
+	}
+	if e.InputPrice != nil {
+		m.InputPrice = *e.InputPrice
+	}
+	if e.OutputPrice != nil {
+		m.OutputPrice = *e.OutputPrice
+	}
+	if e.Family != "" {
+		m.Details.Family = e.Family
+		m.Details.Families = []string{e.Family}
+	}
+}
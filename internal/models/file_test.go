@@ -0,0 +1,165 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// restoreCatalog puts the built-in catalog back after a test changes it
+func restoreCatalog(t *testing.T) {
+	saved := slices.Clone(Catalog.Models)
+	t.Cleanup(func() { Catalog.Models = saved })
+}
+
+// loadFixture reads a catalog file from testdata
+func loadFixture(t *testing.T, name string) File {
+	t.Helper()
+	f, err := ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Reading fixture %s: %v", name, err)
+	}
+	return f
+}
+
+// TestLoadFile tests overriding and extending the catalog from a YAML file
+func TestLoadFile(t *testing.T) {
+	restoreCatalog(t)
+	digest := Catalog.Models[0].Digest
+
+	path := filepath.Join(t.TempDir(), "models.yaml")
+	data := `models:
+  - name: GLM-4.7
+    context_length: 256000
+    output_price: 0
+  - name: GLM-5
+    modified_at: "2026-09-01T00:00:00Z"
+    capabilities: [tools, thinking]
+    context_length: 400000
+    max_output: 65536
+    input_price: 1.2
+  - model: my-finetune
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	// Overrides change only the fields they set
+	m, _ := GetModel("glm-4.7")
+	if m.ContextLen != 256000 || m.MaxOutput != 131072 || m.InputPrice != 0.60 || m.OutputPrice != 0 {
+		t.Errorf("Unexpected override: %+v", m)
+	}
+	if m.Digest != digest {
+		t.Errorf("Digest changed without a new version: %s", m.Digest)
+	}
+
+	// New models are served like built-in ones
+	m, ok := GetModel("glm-5:latest")
+	if !ok || m.Name != "GLM-5" || m.ContextLen != 400000 || !HasCapability("GLM-5", "thinking") || m.Digest == "" || m.Size == 0 {
+		t.Errorf("Unexpected new model: %+v", m)
+	}
+	if GetCanonicalModelName("GLM-5") != "glm-5" {
+		t.Errorf("Unexpected canonical name %q", GetCanonicalModelName("GLM-5"))
+	}
+	if m, ok := GetModel("my-finetune"); !ok || m.ContextLen != 128000 || m.Capabilities == nil {
+		t.Errorf("Expected defaults for a bare model, got %+v", m)
+	}
+	if len(Catalog.Models) != 8 {
+		t.Errorf("Expected 8 models, got %d", len(Catalog.Models))
+	}
+}
+
+// TestApply_Replace tests serving only the file's models
+func TestApply_Replace(t *testing.T) {
+	restoreCatalog(t)
+	if err := Apply(File{Replace: true, Models: []Entry{{Name: "Qwen3-Coder", Model: "qwen3-coder", Family: "qwen"}}}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if IsValidModel("glm-4.7") || !IsValidModel("qwen3-coder") {
+		t.Errorf("Unexpected catalog: %+v", Catalog.Models)
+	}
+	if m, _ := GetModel("qwen3-coder"); m.Details.Family != "qwen" {
+		t.Errorf("Unexpected family %q", m.Details.Family)
+	}
+}
+
+// TestApply_Invalid tests that invalid files leave the catalog untouched
+func TestApply_Invalid(t *testing.T) {
+	restoreCatalog(t)
+	negative := -1.0
+	for _, f := range []File{
+		{Models: []Entry{{ContextLength: 1000}}},
+		{Models: []Entry{{Name: "GLM-5", ModifiedAt: "yesterday"}}},
+		{Models: []Entry{{Name: "GLM-5", InputPrice: &negative}}},
+		{Models: []Entry{{Name: "GLM-5"}, {Model: "glm-5"}}},
+	} {
+		if err := Apply(f); err == nil {
+			t.Errorf("Expected an error for %+v", f)
+		}
+		if len(Catalog.Models) != 6 {
+			t.Fatalf("Catalog changed by an invalid file: %d models", len(Catalog.Models))
+		}
+	}
+}
+
+// TestValidate tests that every problem of a catalog file is reported, without changing the catalog
+func TestValidate(t *testing.T) {
+	restoreCatalog(t)
+	tests := []struct {
+		fixture  string
+		problems []string
+	}{
+		{"valid.yaml", nil},
+		{"duplicate.yaml", []string{
+			`model "glm-5": listed twice`,
+			`name "GLM-4.6V" is also used by model "glm-4.7"`,
+		}},
+		{"missing_id.yaml", []string{
+			`model "Qwen3 Coder": model is required`,
+			`model 1: name or model is required`,
+		}},
+		{"capability_typo.yaml", []string{
+			`unknown capability "tool" (did you mean "tools"?)`,
+			`unknown capability "vison" (did you mean "vision"?)`,
+			`unknown capability "audio"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			err := loadFixture(t, tt.fixture).Validate()
+			if tt.problems == nil {
+				if err != nil {
+					t.Fatalf("Unexpected problems: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected problems")
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.problems) {
+				t.Errorf("Expected %d problems, got %d: %v", len(tt.problems), got, err)
+			}
+			for _, p := range tt.problems {
+				if !strings.Contains(err.Error(), p) {
+					t.Errorf("Missing %q in %v", p, err)
+				}
+			}
+		})
+	}
+	if len(Catalog.Models) != 6 {
+		t.Errorf("Catalog changed by validation: %d models", len(Catalog.Models))
+	}
+
+	// Valid fixtures apply like any catalog file
+	if err := Apply(loadFixture(t, "valid.yaml")); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if m, ok := GetModel("qwen3-coder"); !ok || m.Name != "Qwen3 Coder" || m.Details.Family != "qwen" {
+		t.Errorf("Unexpected model: %+v", m)
+	}
+}
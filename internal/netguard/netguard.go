@@ -0,0 +1,31 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrPrivateAddress refuses connections to loopback, private and link-local networks
+var ErrPrivateAddress = errors.New("connection to a private address refused")
+
+// PublicOnly is a net.Dialer Control function that refuses connections to addresses outside the
+// public internet, so requests to URLs a model produced cannot reach the proxy's own network.
+// It runs after name resolution, so it also catches names that resolve to private addresses.
+func PublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// IsPublic reports whether an IP address is routable on the public internet
+func IsPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsMulticast()
+}
@@ -0,0 +1,38 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// TestPublicOnly tests which dial addresses are refused
+func TestPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700::6810:84e5]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"192.168.0.10:8080", false},
+		{"169.254.169.254:80", false},
+		{"[::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+	}
+	for _, tt := range tests {
+		err := PublicOnly("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("PublicOnly(%s) = %v, want allowed", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("PublicOnly(%s) = %v, want ErrPrivateAddress", tt.address, err)
+		}
+	}
+
+	if IsPublic(net.ParseIP("172.16.0.1")) {
+		t.Error("172.16.0.1 reported public")
+	}
+}
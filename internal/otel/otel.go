@@ -0,0 +1,220 @@
+// Package otel exports request traces as OpenTelemetry spans over OTLP/HTTP, JSON encoded, and
+// propagates W3C trace context. It covers what the proxy needs without the OpenTelemetry SDK.
+package otel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the ID in lowercase hex, as trace backends show it
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the ID in lowercase hex
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext identifies a span across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the context as a W3C traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent reads a W3C traceparent header
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	flags, err := hex.DecodeString(parts[3])
+	if _, err1 := hex.Decode(sc.TraceID[:], []byte(parts[1])); err1 != nil || err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Extract reads the trace context a caller sent
+func Extract(h http.Header) (SpanContext, bool) {
+	return ParseTraceparent(h.Get("traceparent"))
+}
+
+// Inject sends the context's span as the parent of the request's handling
+func Inject(ctx context.Context, h http.Header) {
+	if span := SpanFromContext(ctx); span != nil {
+		h.Set("traceparent", span.sc.Traceparent())
+	}
+}
+
+// Kind is the role of a span in a call
+type Kind int
+
+// Span kinds, numbered as in OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Span is a timed operation. All methods are safe on a nil span, which is what a disabled
+// tracer hands out.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   Kind
+	start  time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     []attribute
+	errorText string
+	failed    bool
+	ended     bool
+}
+
+// attribute is a key and a string, integer, float or boolean value
+type attribute struct {
+	key   string
+	value any
+}
+
+// Context returns the span's identity
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes records key, value pairs; a key set again replaces its value
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		value := kv[i+1]
+		switch v := value.(type) {
+		case string, bool, int64, float64:
+		case int:
+			value = int64(v)
+		case time.Duration:
+			value = v.Milliseconds()
+		default:
+			value = fmt.Sprint(v)
+		}
+		replaced := false
+		for j := range s.attrs {
+			if s.attrs[j].key == key {
+				s.attrs[j].value, replaced = value, true
+			}
+		}
+		if !replaced {
+			s.attrs = append(s.attrs, attribute{key, value})
+		}
+	}
+}
+
+// SetError marks the span failed
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed, s.errorText = true, msg
+	s.mu.Unlock()
+}
+
+// End completes the span and queues sampled ones for export; later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// spanKey holds the current span in a context
+type spanKey struct{}
+
+// SpanFromContext returns the context's current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// newTraceID returns a random trace ID
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// sampled decides for a new trace from its ID, so every process sampling at the same rate agrees
+func sampled(id TraceID, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	// The low 56 bits are random in W3C trace IDs
+	return float64(binary.BigEndian.Uint64(id[8:])&(1<<56-1)) < rate*(1<<56)
+}
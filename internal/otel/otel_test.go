@@ -0,0 +1,144 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceparent(tt.value)
+		if ok != tt.ok || sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q) = %+v, %v; want ok %v, sampled %v", tt.value, sc, ok, tt.ok, tt.sampled)
+		}
+		if ok && tt.value[:2] == "00" && sc.Traceparent() != tt.value {
+			t.Errorf("Traceparent() = %q, want %q", sc.Traceparent(), tt.value)
+		}
+	}
+}
+
+func TestSampled(t *testing.T) {
+	low := TraceID{8: 0x00, 9: 0x10}
+	high := TraceID{8: 0x00, 9: 0xf0}
+	if !sampled(low, 0.5) || sampled(high, 0.5) {
+		t.Error("sampled() should keep IDs below the rate and drop those above")
+	}
+	if sampled(low, 0) || !sampled(high, 1) {
+		t.Error("sampled() should honor rates 0 and 1")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector.example:4318/",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "x-api-key=secret%20key, x-team = ai",
+		"OTEL_SERVICE_NAME":           "proxy-eu",
+		"OTEL_RESOURCE_ATTRIBUTES":    "deployment.environment=prod",
+		"OTEL_TRACES_SAMPLER_ARG":     "0.25",
+	}
+	o, enabled := FromEnv(Options{}, false, func(k string) string { return env[k] })
+	if !enabled {
+		t.Fatal("FromEnv() did not enable export for an OTLP endpoint")
+	}
+	if o.Endpoint != "https://collector.example:4318/v1/traces" || o.ServiceName != "proxy-eu" || o.SampleRate != 0.25 {
+		t.Errorf("FromEnv() = %+v", o)
+	}
+	if o.Headers["x-api-key"] != "secret key" || o.Headers["x-team"] != "ai" || o.Resource["deployment.environment"] != "prod" {
+		t.Errorf("FromEnv() headers %v, resource %v", o.Headers, o.Resource)
+	}
+
+	// The config file wins over the environment
+	o, _ = FromEnv(Options{Endpoint: "http://local:4318/v1/traces", ServiceName: "mine"}, true, func(k string) string { return env[k] })
+	if o.Endpoint != "http://local:4318/v1/traces" || o.ServiceName != "mine" {
+		t.Errorf("FromEnv() overrode the config file: %+v", o)
+	}
+
+	env["OTEL_SDK_DISABLED"] = "true"
+	if _, enabled := FromEnv(Options{}, true, func(k string) string { return env[k] }); enabled {
+		t.Error("FromEnv() enabled export with OTEL_SDK_DISABLED=true")
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got map[string]any
+	var apiKey string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("x-api-key")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer collector.Close()
+
+	tracer := New(Options{Endpoint: collector.URL, Headers: map[string]string{"x-api-key": "k"}, Version: "1.0"})
+	defer tracer.Shutdown(context.Background())
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := tracer.StartRemote(context.Background(), parent, "POST /v1/chat/completions", KindServer)
+	_, client := tracer.Start(ctx, "upstream", KindClient)
+	client.SetAttributes("http.response.status_code", 503, "retried", true, "ratio", 0.5)
+	client.SetError("Service Unavailable")
+	client.End()
+	server.End()
+	server.End()
+
+	header := http.Header{}
+	Inject(ctx, header)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + server.Context().SpanID.String() + "-01"; header.Get("traceparent") != want {
+		t.Errorf("Inject() traceparent = %q, want %q", header.Get("traceparent"), want)
+	}
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "k" {
+		t.Errorf("export header x-api-key = %q", apiKey)
+	}
+	data, _ := json.Marshal(got)
+	for _, want := range []string{
+		`"service.name","value":{"stringValue":"copilot-proxy"}`,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`"parentSpanId":"` + server.Context().SpanID.String() + `"`,
+		`{"key":"http.response.status_code","value":{"intValue":"503"}}`,
+		`{"key":"retried","value":{"boolValue":true}}`,
+		`"status":{"code":2,"message":"Service Unavailable"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("export missing %s in %s", want, data)
+		}
+	}
+	if n := strings.Count(string(data), `"spanId"`); n != 2 {
+		t.Errorf("exported %d spans, want 2", n)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "x", KindInternal)
+	span.SetAttributes("k", "v")
+	span.SetError("e")
+	span.End()
+	header := http.Header{}
+	Inject(ctx, header)
+	if span != nil || header.Get("traceparent") != "" || tracer.Shutdown(ctx) != nil {
+		t.Error("a nil tracer should hand out no-op spans")
+	}
+}
@@ -0,0 +1,336 @@
+package otel
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Export defaults
+const (
+	DefaultEndpoint      = "http://localhost:4318/v1/traces"
+	DefaultServiceName   = "copilot-proxy"
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	queueSize            = 4096
+)
+
+// Options configure a tracer
+type Options struct {
+	Endpoint      string            // Full OTLP/HTTP traces URL (default http://localhost:4318/v1/traces)
+	Headers       map[string]string // Sent with every export, e.g. an API key
+	ServiceName   string            // service.name resource attribute (default copilot-proxy)
+	Resource      map[string]string // Further resource attributes
+	SampleRate    float64           // Fraction of new traces exported (0-1, default 1)
+	Version       string            // Instrumentation scope version
+	BatchSize     int               // Spans per export (default 512)
+	FlushInterval time.Duration     // Longest a finished span waits for export (default 5s)
+	Client        *http.Client      // Defaults to a client with a ten second timeout
+}
+
+// FromEnv fills the options the config file left unset from the standard OTEL_* variables
+// and reports whether export is enabled: explicitly, or by an OTLP endpoint in the
+// environment. OTEL_SDK_DISABLED and OTEL_TRACES_EXPORTER=none turn it off.
+func FromEnv(o Options, enabled bool, getenv func(string) string) (Options, bool) {
+	if getenv("OTEL_SDK_DISABLED") == "true" || getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return o, false
+	}
+	if o.Endpoint == "" {
+		if endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+			o.Endpoint, enabled = endpoint, true
+		} else if endpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			o.Endpoint, enabled = strings.TrimSuffix(endpoint, "/")+"/v1/traces", true
+		}
+	}
+	if getenv("OTEL_TRACES_EXPORTER") == "otlp" {
+		enabled = true
+	}
+	if o.Headers == nil {
+		o.Headers = parsePairs(cmp.Or(getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS"), getenv("OTEL_EXPORTER_OTLP_HEADERS")))
+	}
+	o.ServiceName = cmp.Or(o.ServiceName, getenv("OTEL_SERVICE_NAME"))
+	if o.Resource == nil {
+		o.Resource = parsePairs(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	}
+	if rate, err := strconv.ParseFloat(getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil && o.SampleRate == 0 {
+		o.SampleRate = rate
+	}
+	return o, enabled
+}
+
+// parsePairs reads the key1=value1,key2=value2 lists of OTEL_* variables, whose values are
+// URL encoded
+func parsePairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		if decoded, err := url.PathUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		pairs[strings.TrimSpace(key)] = value
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	return pairs
+}
+
+// Tracer creates spans and exports the sampled ones in batches. A nil tracer hands out nil
+// spans, so callers need not check whether tracing is on.
+type Tracer struct {
+	opts    Options
+	queue   chan *Span
+	flush   chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// New creates a tracer and starts exporting
+func New(o Options) *Tracer {
+	o.Endpoint = cmp.Or(o.Endpoint, DefaultEndpoint)
+	o.ServiceName = cmp.Or(o.ServiceName, DefaultServiceName)
+	o.SampleRate = cmp.Or(o.SampleRate, 1)
+	o.BatchSize = cmp.Or(o.BatchSize, defaultBatchSize)
+	o.FlushInterval = cmp.Or(o.FlushInterval, defaultFlushInterval)
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	t := &Tracer{
+		opts:  o,
+		queue: make(chan *Span, queueSize),
+		flush: make(chan chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start begins a span as a child of the context's span, or of a new trace
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.sc
+	}
+	return t.start(ctx, parent, name, kind)
+}
+
+// StartRemote begins a span as a child of a caller's span, sent in a traceparent header. An
+// invalid parent starts a new trace.
+func (t *Tracer) StartRemote(ctx context.Context, parent SpanContext, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	return t.start(ctx, parent, name, kind)
+}
+
+// start creates the span under a parent and puts it in the context
+func (t *Tracer) start(ctx context.Context, parent SpanContext, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent.IsValid() {
+		span.sc = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = sampled(span.sc.TraceID, t.opts.SampleRate)
+	}
+	span.sc.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// enqueue hands a finished span to the exporter, dropping it when the queue is full
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		if t.dropped.Add(1) == 1 {
+			slog.Warn("OpenTelemetry export queue full, dropping spans", "endpoint", t.opts.Endpoint)
+		}
+	}
+}
+
+// run batches finished spans until Shutdown
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.FlushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	send := func() {
+		if len(batch) > 0 {
+			if err := t.export(batch); err != nil {
+				slog.Warn("OpenTelemetry export failed", "endpoint", t.opts.Endpoint, "spans", len(batch), "error", err)
+			}
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			if batch = append(batch, s); len(batch) >= t.opts.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case reply := <-t.flush:
+			batch = append(batch, t.drain()...)
+			send()
+			close(reply)
+		case <-t.stop:
+			batch = append(batch, t.drain()...)
+			send()
+			return
+		}
+	}
+}
+
+// drain takes the spans waiting in the queue
+func (t *Tracer) drain() []*Span {
+	var spans []*Span
+	for {
+		select {
+		case s := <-t.queue:
+			spans = append(spans, s)
+		default:
+			return spans
+		}
+	}
+}
+
+// Flush exports the finished spans now
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	reply := make(chan struct{})
+	select {
+	case t.flush <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the remaining spans and stops the tracer
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	close(t.stop)
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export posts a batch as an OTLP/HTTP JSON request
+func (t *Tracer) export(spans []*Span) error {
+	data, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.opts.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// encode builds the OTLP ExportTraceServiceRequest for a batch
+func (t *Tracer) encode(spans []*Span) map[string]any {
+	resource := []any{keyValue("service.name", t.opts.ServiceName)}
+	for k, v := range t.opts.Resource {
+		if k != "service.name" {
+			resource = append(resource, keyValue(k, v))
+		}
+	}
+	encoded := make([]any, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, s.encode())
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": resource},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": "github.com/chew-z/copilot-proxy", "version": t.opts.Version},
+			"spans": encoded,
+		}},
+	}}}
+}
+
+// encode returns the span in OTLP JSON form; IDs are hex and timestamps decimal strings
+func (s *Span) encode() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := make([]any, 0, len(s.attrs))
+	for _, a := range s.attrs {
+		attrs = append(attrs, keyValue(a.key, a.value))
+	}
+	span := map[string]any{
+		"traceId":           s.sc.TraceID.String(),
+		"spanId":            s.sc.SpanID.String(),
+		"name":              s.name,
+		"kind":              int(s.kind),
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        attrs,
+	}
+	if s.parent != (SpanID{}) {
+		span["parentSpanId"] = s.parent.String()
+	}
+	if s.failed {
+		span["status"] = map[string]any{"code": 2, "message": s.errorText}
+	}
+	return span
+}
+
+// keyValue encodes an attribute as an OTLP KeyValue
+func keyValue(key string, value any) map[string]any {
+	var v map[string]any
+	switch value := value.(type) {
+	case bool:
+		v = map[string]any{"boolValue": value}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": value}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(value)}
+	}
+	return map[string]any{"key": key, "value": v}
+}
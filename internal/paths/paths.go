@@ -0,0 +1,107 @@
+// Package paths locates the proxy's config, data and log directories following each platform's
+// conventions: XDG on Linux and other Unix systems, ~/Library on macOS and the AppData folders
+// on Windows.
+package paths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// App names the proxy's directory within each platform location
+const App = "copilot-proxy"
+
+// Platform is what directories are resolved against: the operating system, its environment
+// and home directory. Tests describe other platforms with their own.
+type Platform struct {
+	OS     string // A runtime.GOOS value
+	Getenv func(key string) string
+	Home   string                // The user's home directory; "" when unknown
+	Exists func(dir string) bool // Reports whether a directory exists, for pre-existing locations
+}
+
+// Current returns the platform the process runs on
+func Current() Platform {
+	home, _ := os.UserHomeDir()
+	return Platform{
+		OS:     runtime.GOOS,
+		Getenv: os.Getenv,
+		Home:   home,
+		Exists: func(dir string) bool {
+			info, err := os.Stat(dir)
+			return err == nil && info.IsDir()
+		},
+	}
+}
+
+// Dirs are the proxy's directories
+type Dirs struct {
+	Config string // config.json, models.json and prompt fragments
+	Data   string // Datasets, traces, usage ledgers, metrics and other persisted state
+	Logs   string // The server log
+}
+
+// Resolve returns the proxy's directories on the platform. XDG_CONFIG_HOME, XDG_DATA_HOME and
+// XDG_STATE_HOME are honored wherever they are set. On macOS and Windows, directories in the
+// XDG default locations that earlier versions used everywhere are kept while the platform's own
+// do not exist yet, so upgrading does not lose a config.
+func (p Platform) Resolve() (Dirs, error) {
+	if p.Home == "" && p.OS != "windows" {
+		return Dirs{}, errors.New("home directory is unknown")
+	}
+	xdgConfig := p.xdg("XDG_CONFIG_HOME", ".config")
+	xdgData := p.xdg("XDG_DATA_HOME", ".local", "share")
+	xdgState := p.xdg("XDG_STATE_HOME", ".local", "state")
+
+	switch p.OS {
+	case "darwin":
+		support := filepath.Join(p.Home, "Library", "Application Support", App)
+		return Dirs{
+			Config: p.pick("XDG_CONFIG_HOME", xdgConfig, support),
+			Data:   p.pick("XDG_DATA_HOME", xdgData, support),
+			Logs:   p.pick("XDG_STATE_HOME", xdgState, filepath.Join(p.Home, "Library", "Logs", App)),
+		}, nil
+	case "windows":
+		roaming := p.Getenv("APPDATA")
+		if roaming == "" {
+			if p.Home == "" {
+				return Dirs{}, errors.New("neither %APPDATA% nor the home directory is known")
+			}
+			roaming = filepath.Join(p.Home, "AppData", "Roaming")
+		}
+		local := p.Getenv("LOCALAPPDATA")
+		if local == "" {
+			local = roaming
+		}
+		return Dirs{
+			Config: p.pick("XDG_CONFIG_HOME", xdgConfig, filepath.Join(roaming, App)),
+			Data:   p.pick("XDG_DATA_HOME", xdgData, filepath.Join(local, App)),
+			Logs:   p.pick("XDG_STATE_HOME", xdgState, filepath.Join(local, App, "logs")),
+		}, nil
+	default:
+		return Dirs{Config: xdgConfig, Data: xdgData, Logs: xdgState}, nil
+	}
+}
+
+// xdg returns the proxy's directory under an XDG base directory, or under its default in the
+// home directory
+func (p Platform) xdg(env string, fallback ...string) string {
+	if base := p.Getenv(env); base != "" {
+		return filepath.Join(base, App)
+	}
+	return filepath.Join(append(append([]string{p.Home}, fallback...), App)...)
+}
+
+// pick chooses between the XDG location and the platform's own: XDG when its variable is set
+// or when a directory from an earlier version is there and the platform's is not
+func (p Platform) pick(env, xdgDir, native string) string {
+	if p.Getenv(env) != "" {
+		return xdgDir
+	}
+	if p.Home != "" && p.Exists != nil && p.Exists(xdgDir) && !p.Exists(native) {
+		return xdgDir
+	}
+	return native
+}
@@ -0,0 +1,118 @@
+package paths
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// fixture describes a platform with the given environment and existing directories
+func fixture(os, home string, env map[string]string, existing ...string) Platform {
+	return Platform{
+		OS:     os,
+		Getenv: func(key string) string { return env[key] },
+		Home:   home,
+		Exists: func(dir string) bool {
+			for _, e := range existing {
+				if e == dir {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	j := filepath.Join
+	tests := []struct {
+		name     string
+		platform Platform
+		want     Dirs
+	}{
+		{
+			name:     "linux defaults",
+			platform: fixture("linux", "/home/ann", nil),
+			want: Dirs{
+				Config: j("/home/ann", ".config", App),
+				Data:   j("/home/ann", ".local", "share", App),
+				Logs:   j("/home/ann", ".local", "state", App),
+			},
+		},
+		{
+			name:     "linux XDG",
+			platform: fixture("freebsd", "/home/ann", map[string]string{"XDG_CONFIG_HOME": "/cfg", "XDG_DATA_HOME": "/data", "XDG_STATE_HOME": "/state"}),
+			want:     Dirs{Config: j("/cfg", App), Data: j("/data", App), Logs: j("/state", App)},
+		},
+		{
+			name:     "macOS defaults",
+			platform: fixture("darwin", "/Users/ann", nil),
+			want: Dirs{
+				Config: j("/Users/ann", "Library", "Application Support", App),
+				Data:   j("/Users/ann", "Library", "Application Support", App),
+				Logs:   j("/Users/ann", "Library", "Logs", App),
+			},
+		},
+		{
+			name:     "macOS keeps an earlier config",
+			platform: fixture("darwin", "/Users/ann", nil, j("/Users/ann", ".config", App)),
+			want: Dirs{
+				Config: j("/Users/ann", ".config", App),
+				Data:   j("/Users/ann", "Library", "Application Support", App),
+				Logs:   j("/Users/ann", "Library", "Logs", App),
+			},
+		},
+		{
+			name: "macOS prefers its own once both exist",
+			platform: fixture("darwin", "/Users/ann", nil,
+				j("/Users/ann", ".config", App), j("/Users/ann", "Library", "Application Support", App)),
+			want: Dirs{
+				Config: j("/Users/ann", "Library", "Application Support", App),
+				Data:   j("/Users/ann", "Library", "Application Support", App),
+				Logs:   j("/Users/ann", "Library", "Logs", App),
+			},
+		},
+		{
+			name:     "macOS XDG",
+			platform: fixture("darwin", "/Users/ann", map[string]string{"XDG_DATA_HOME": "/data"}),
+			want: Dirs{
+				Config: j("/Users/ann", "Library", "Application Support", App),
+				Data:   j("/data", App),
+				Logs:   j("/Users/ann", "Library", "Logs", App),
+			},
+		},
+		{
+			name: "windows",
+			platform: fixture("windows", `C:\Users\ann`, map[string]string{
+				"APPDATA": `C:\Users\ann\AppData\Roaming`, "LOCALAPPDATA": `C:\Users\ann\AppData\Local`}),
+			want: Dirs{
+				Config: j(`C:\Users\ann\AppData\Roaming`, App),
+				Data:   j(`C:\Users\ann\AppData\Local`, App),
+				Logs:   j(`C:\Users\ann\AppData\Local`, App, "logs"),
+			},
+		},
+		{
+			name:     "windows without LOCALAPPDATA",
+			platform: fixture("windows", "", map[string]string{"APPDATA": `D:\Roaming`}),
+			want:     Dirs{Config: j(`D:\Roaming`, App), Data: j(`D:\Roaming`, App), Logs: j(`D:\Roaming`, App, "logs")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.platform.Resolve()
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve_NoHome(t *testing.T) {
+	for _, os := range []string{"linux", "darwin", "windows"} {
+		if _, err := fixture(os, "", nil).Resolve(); err == nil {
+			t.Errorf("Resolve() on %s without a home directory: error = nil", os)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Package plugin runs WebAssembly modules that inspect and edit chat requests and responses.
+// Modules run sandboxed in wazero: no filesystem, network or environment, bounded memory and a
+// deadline per call.
+//
+// The host API is versioned by the import module name, copilot_proxy_v1. A plugin exports
+// "memory" and "alloc(size u32) u32", optionally "dealloc(ptr u32, size u32)", and any of the
+// hooks "on_request(ptr u32, len u32) u64" and "on_chunk(ptr u32, len u32) u64". Hooks receive
+// a JSON event in memory obtained from alloc and return the address and length of a JSON
+// result packed as ptr<<32|len, or 0 to leave the payload unchanged. Plugins may import
+// "log(ptr u32, len u32)" from copilot_proxy_v1 to write to the proxy log. Modules are
+// instantiated as WASI reactors: "_initialize" runs if exported, "_start" never does.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// HostModule is the import module name of the host API
+const HostModule = "copilot_proxy_v1"
+
+// Defaults for unset limits
+const (
+	defaultMaxMemoryMB = 64
+	defaultTimeout     = 200 * time.Millisecond
+	defaultInstances   = 4
+)
+
+// RequestEvent is passed to on_request before a chat request is sent upstream
+type RequestEvent struct {
+	Model   string            `json:"model"`
+	Dialect string            `json:"dialect"` // openai or ollama
+	Client  string            `json:"client,omitempty"`
+	Headers map[string]string `json:"headers"`
+	Body    map[string]any    `json:"body"` // The upstream request body
+}
+
+// RequestResult is returned by on_request: a replacement body, or an error rejecting the request
+type RequestResult struct {
+	Body  map[string]any `json:"body,omitempty"`
+	Error *Rejection     `json:"error,omitempty"`
+}
+
+// Rejection is a plugin's refusal of a request
+type Rejection struct {
+	Status  int    `json:"status"` // Defaults to 400
+	Message string `json:"message"`
+}
+
+// ChunkEvent is passed to on_chunk for each streamed chunk, or once for a whole response
+type ChunkEvent struct {
+	Model  string         `json:"model"`
+	Stream bool           `json:"stream"`
+	Chunk  map[string]any `json:"chunk"`
+}
+
+// ChunkResult is returned by on_chunk: a replacement chunk, or drop to suppress it
+type ChunkResult struct {
+	Chunk map[string]any `json:"chunk,omitempty"`
+	Drop  bool           `json:"drop,omitempty"`
+}
+
+// Plugin is a loaded module with a pool of instances, so concurrent requests do not wait on
+// each other
+type Plugin struct {
+	Name       string
+	FailClosed bool // Reject requests when on_request fails instead of forwarding them unchanged
+
+	runtime    wazero.Runtime
+	compiled   wazero.CompiledModule
+	timeout    time.Duration
+	hasRequest bool
+	hasChunk   bool
+
+	idle    chan api.Module
+	created atomic.Int32
+	max     int32
+}
+
+// Load compiles a plugin module and checks its exports
+func Load(ctx context.Context, cfg config.PluginConfig) (*Plugin, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Path
+	}
+	wasm, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+
+	maxMB := cfg.MaxMemoryMB
+	if maxMB <= 0 {
+		maxMB = defaultMaxMemoryMB
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(maxMB)*16). // 64 KiB pages
+		WithCloseOnContextDone(true))
+
+	p := &Plugin{Name: name, FailClosed: cfg.FailClosed, runtime: runtime, timeout: cfg.Timeout}
+	if p.timeout <= 0 {
+		p.timeout = defaultTimeout
+	}
+	p.max = int32(cfg.Instances)
+	if p.max <= 0 {
+		p.max = defaultInstances
+	}
+	p.idle = make(chan api.Module, p.max)
+
+	fail := func(err error) (*Plugin, error) {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+
+	// WASI is provided for toolchains whose runtimes need it, without files, env or args
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return fail(err)
+	}
+	_, err = runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+			if msg, ok := m.Memory().Read(ptr, size); ok {
+				slog.Info("Plugin log", "plugin", name, "message", string(msg))
+			}
+		}).
+		Export("log").
+		Instantiate(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	p.compiled, err = runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return fail(err)
+	}
+	exports := p.compiled.ExportedFunctions()
+	if _, ok := exports["alloc"]; !ok {
+		return fail(errors.New("module does not export alloc"))
+	}
+	_, p.hasRequest = exports["on_request"]
+	_, p.hasChunk = exports["on_chunk"]
+	if !p.hasRequest && !p.hasChunk {
+		return fail(errors.New("module exports neither on_request nor on_chunk"))
+	}
+
+	// Instantiate once now so start-up errors surface at load time
+	mod, err := p.instantiate(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	p.created.Add(1)
+	p.idle <- mod
+	return p, nil
+}
+
+// HasRequestHook reports whether the plugin exports on_request
+func (p *Plugin) HasRequestHook() bool { return p.hasRequest }
+
+// HasChunkHook reports whether the plugin exports on_chunk
+func (p *Plugin) HasChunkHook() bool { return p.hasChunk }
+
+// OnRequest runs the on_request hook; a nil result leaves the request unchanged
+func (p *Plugin) OnRequest(ctx context.Context, ev RequestEvent) (*RequestResult, error) {
+	var res RequestResult
+	ok, err := p.call(ctx, "on_request", ev, &res)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OnChunk runs the on_chunk hook; a nil result leaves the chunk unchanged
+func (p *Plugin) OnChunk(ctx context.Context, ev ChunkEvent) (*ChunkResult, error) {
+	var res ChunkResult
+	ok, err := p.call(ctx, "on_chunk", ev, &res)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Close releases the runtime and every instance
+func (p *Plugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// call passes an event to a hook and decodes its result, reporting false when the hook
+// returned 0 for "unchanged"
+func (p *Plugin) call(ctx context.Context, hook string, ev, out any) (bool, error) {
+	input, err := json.Marshal(ev)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	mod, err := p.acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	defer p.release(mod)
+
+	output, err := invoke(ctx, mod, hook, input)
+	if err != nil {
+		return false, fmt.Errorf("plugin %s: %s: %w", p.Name, hook, err)
+	}
+	if output == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(output, out); err != nil {
+		return false, fmt.Errorf("plugin %s: %s returned invalid JSON: %w", p.Name, hook, err)
+	}
+	return true, nil
+}
+
+// invoke copies input into the instance, runs the hook and copies its output out
+func invoke(ctx context.Context, mod api.Module, hook string, input []byte) ([]byte, error) {
+	alloc := mod.ExportedFunction("alloc")
+	dealloc := mod.ExportedFunction("dealloc")
+	mem := mod.Memory()
+	if mem == nil {
+		return nil, errors.New("module does not export memory")
+	}
+
+	res, err := alloc.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	inPtr := uint32(res[0])
+	if !mem.Write(inPtr, input) {
+		return nil, errors.New("alloc returned an out of range address")
+	}
+
+	res, err = mod.ExportedFunction(hook).Call(ctx, uint64(inPtr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	if dealloc != nil {
+		if _, err := dealloc.Call(ctx, uint64(inPtr), uint64(len(input))); err != nil {
+			return nil, err
+		}
+	}
+	if res[0] == 0 {
+		return nil, nil
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	data, ok := mem.Read(outPtr, outLen)
+	if !ok {
+		return nil, errors.New("result is out of range")
+	}
+	output := append([]byte(nil), data...)
+	if dealloc != nil {
+		if _, err := dealloc.Call(ctx, uint64(outPtr), uint64(outLen)); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// instantiate creates a fresh instance of the module
+func (p *Plugin) instantiate(ctx context.Context) (api.Module, error) {
+	return p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+}
+
+// acquire takes an idle instance, creates one while under the pool size, or waits
+func (p *Plugin) acquire(ctx context.Context) (api.Module, error) {
+	select {
+	case mod := <-p.idle:
+		return mod, nil
+	default:
+	}
+	if p.created.Add(1) <= p.max {
+		mod, err := p.instantiate(ctx)
+		if err != nil {
+			p.created.Add(-1)
+		}
+		return mod, err
+	}
+	p.created.Add(-1)
+
+	select {
+	case mod := <-p.idle:
+		return mod, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns an instance to the pool; instances closed by a timeout or trap are discarded
+func (p *Plugin) release(mod api.Module) {
+	if mod.IsClosed() {
+		p.created.Add(-1)
+		return
+	}
+	p.idle <- mod
+}
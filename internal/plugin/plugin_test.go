@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// buildTestGuest compiles the test plugin in testdata/guest, skipping the test when the Go
+// toolchain cannot target WASI
+func buildTestGuest(t *testing.T) string {
+	t.Helper()
+	src, err := filepath.Abs(filepath.Join("testdata", "guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "guest.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, ".")
+	cmd.Dir = src
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build the test plugin: %v\n%s", err, output)
+	}
+	return out
+}
+
+func TestPlugin(t *testing.T) {
+	ctx := context.Background()
+	p, err := Load(ctx, config.PluginConfig{Name: "guest", Path: buildTestGuest(t), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+
+	if !p.HasRequestHook() || !p.HasChunkHook() {
+		t.Fatal("hooks not detected")
+	}
+
+	res, err := p.OnRequest(ctx, RequestEvent{Body: map[string]any{"model": "glm-4.7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Body["temperature"] != 0.1 || res.Body["model"] != "glm-4.7" {
+		t.Errorf("OnRequest() = %+v, want the body with temperature 0.1", res)
+	}
+
+	res, err = p.OnRequest(ctx, RequestEvent{Headers: map[string]string{"X-Block": "1"}, Body: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Error == nil || res.Error.Status != 403 || res.Error.Message != "blocked by policy" {
+		t.Errorf("OnRequest() = %+v, want a 403 rejection", res)
+	}
+
+	chunk := func(content string) map[string]any {
+		return map[string]any{"choices": []any{map[string]any{"index": 0.0, "delta": map[string]any{"content": content}}}}
+	}
+	if res, err := p.OnChunk(ctx, ChunkEvent{Stream: true, Chunk: chunk("hello")}); err != nil || res != nil {
+		t.Errorf("OnChunk(unchanged) = %+v, %v, want nil", res, err)
+	}
+	if res, _ := p.OnChunk(ctx, ChunkEvent{Stream: true, Chunk: chunk("DROP")}); res == nil || !res.Drop {
+		t.Errorf("OnChunk(DROP) = %+v, want drop", res)
+	}
+	res2, err := p.OnChunk(ctx, ChunkEvent{Stream: true, Chunk: chunk("the secret")})
+	if err != nil || res2 == nil {
+		t.Fatalf("OnChunk(secret) = %+v, %v", res2, err)
+	}
+	delta := res2.Chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+	if delta["content"] != "the [redacted]" {
+		t.Errorf("content = %v, want redacted", delta["content"])
+	}
+
+	// Concurrent calls use separate instances
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.OnRequest(ctx, RequestEvent{Body: map[string]any{}}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Load(ctx, config.PluginConfig{Path: filepath.Join(t.TempDir(), "missing.wasm")}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	garbage := filepath.Join(t.TempDir(), "garbage.wasm")
+	os.WriteFile(garbage, []byte("not wasm"), 0644)
+	if _, err := Load(ctx, config.PluginConfig{Path: garbage}); err == nil {
+		t.Error("expected an error for an invalid module")
+	}
+}
@@ -0,0 +1,100 @@
+// Command guest is a test plugin, built with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o guest.wasm .
+//
+// Its request hook rejects requests carrying X-Block, otherwise pins the temperature; its
+// chunk hook redacts "secret" from content and drops chunks whose content is "DROP".
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"unsafe"
+)
+
+//go:wasmimport copilot_proxy_v1 log
+func hostLog(ptr, size uint32)
+
+// buffers keeps memory handed to the host alive until it is released
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	b := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&b[0])))
+	buffers[ptr] = b
+	return ptr
+}
+
+//go:wasmexport dealloc
+func dealloc(ptr, size uint32) {
+	delete(buffers, ptr)
+}
+
+func read(ptr, size uint32) []byte {
+	return buffers[ptr][:size]
+}
+
+func write(v any) uint64 {
+	data, _ := json.Marshal(v)
+	ptr := alloc(uint32(len(data)))
+	copy(buffers[ptr], data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func log(msg string) {
+	b := []byte(msg)
+	hostLog(uint32(uintptr(unsafe.Pointer(&b[0]))), uint32(len(b)))
+}
+
+//go:wasmexport on_request
+func onRequest(ptr, size uint32) uint64 {
+	var ev struct {
+		Headers map[string]string `json:"headers"`
+		Body    map[string]any    `json:"body"`
+	}
+	if err := json.Unmarshal(read(ptr, size), &ev); err != nil {
+		return 0
+	}
+	if ev.Headers["X-Block"] != "" {
+		log("blocked a request")
+		return write(map[string]any{"error": map[string]any{"status": 403, "message": "blocked by policy"}})
+	}
+	ev.Body["temperature"] = 0.1
+	return write(map[string]any{"body": ev.Body})
+}
+
+//go:wasmexport on_chunk
+func onChunk(ptr, size uint32) uint64 {
+	var ev struct {
+		Chunk map[string]any `json:"chunk"`
+	}
+	if err := json.Unmarshal(read(ptr, size), &ev); err != nil {
+		return 0
+	}
+	changed := false
+	choices, _ := ev.Chunk["choices"].([]any)
+	for _, ch := range choices {
+		choice, _ := ch.(map[string]any)
+		for _, field := range []string{"delta", "message"} {
+			msg, _ := choice[field].(map[string]any)
+			content, ok := msg["content"].(string)
+			if !ok {
+				continue
+			}
+			if content == "DROP" {
+				return write(map[string]any{"drop": true})
+			}
+			if strings.Contains(content, "secret") {
+				msg["content"] = strings.ReplaceAll(content, "secret", "[redacted]")
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return 0
+	}
+	return write(map[string]any{"chunk": ev.Chunk})
+}
+
+func main() {}
@@ -0,0 +1,76 @@
+package postprocess
+
+import "strings"
+
+// CodeBlock is a fenced code block extracted from markdown
+type CodeBlock struct {
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// ExtractCodeBlocks returns the fenced code blocks in text, in order. A block left open at the
+// end of the text (e.g. a truncated completion) is still returned.
+func ExtractCodeBlocks(text string) []CodeBlock {
+	blocks := []CodeBlock{}
+
+	var (
+		open    bool
+		fence   string // Opening fence run, e.g. "```" or "~~~~"
+		current CodeBlock
+		body    []string
+	)
+
+	for line := range strings.Lines(text) {
+		line = strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if !open {
+			run := fenceRun(trimmed)
+			if run == "" {
+				continue
+			}
+			info := strings.TrimSpace(trimmed[len(run):])
+			// Backtick fences may not contain backticks in their info string
+			if run[0] == '`' && strings.Contains(info, "`") {
+				continue
+			}
+			open, fence, body = true, run, nil
+			current = CodeBlock{}
+			if fields := strings.Fields(info); len(fields) > 0 {
+				current.Language = fields[0]
+			}
+			continue
+		}
+
+		// A closing fence uses the same character, is at least as long and has no info string
+		if run := fenceRun(trimmed); run != "" && run[0] == fence[0] && len(run) >= len(fence) &&
+			strings.TrimSpace(trimmed[len(run):]) == "" {
+			current.Content = strings.Join(body, "\n")
+			blocks = append(blocks, current)
+			open = false
+			continue
+		}
+		body = append(body, line)
+	}
+
+	if open {
+		current.Content = strings.Join(body, "\n")
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// fenceRun returns the leading run of three or more backticks or tildes, or ""
+func fenceRun(line string) string {
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
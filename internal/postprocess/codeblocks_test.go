@@ -0,0 +1,56 @@
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExtractCodeBlocks tests fenced code block extraction
+func TestExtractCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []CodeBlock
+	}{
+		{
+			name:     "No Blocks",
+			input:    "Just prose.",
+			expected: []CodeBlock{},
+		},
+		{
+			name:  "Multiple Blocks",
+			input: "Here:\n```go\nx := 1\n\ny := 2\n```\nand\n~~~python title=\"a.py\"\nprint(1)\n~~~\n",
+			expected: []CodeBlock{
+				{Language: "go", Content: "x := 1\n\ny := 2"},
+				{Language: "python", Content: "print(1)"},
+			},
+		},
+		{
+			name:     "No Language",
+			input:    "```\nplain\n```",
+			expected: []CodeBlock{{Content: "plain"}},
+		},
+		{
+			name:     "Nested Shorter Fence",
+			input:    "````md\n```go\nx\n```\n````\n",
+			expected: []CodeBlock{{Language: "md", Content: "```go\nx\n```"}},
+		},
+		{
+			name:     "Unclosed Block",
+			input:    "```sh\necho hi\n",
+			expected: []CodeBlock{{Language: "sh", Content: "echo hi"}},
+		},
+		{
+			name:     "CRLF",
+			input:    "```js\r\nlet a\r\n```\r\n",
+			expected: []CodeBlock{{Language: "js", Content: "let a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExtractCodeBlocks(tt.input))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package postprocess
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUnifiedDiff tests unified diff output against what diff -u prints
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(s ...string) string { return strings.Join(s, "\n") + "\n" }
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name:     "Equal",
+			a:        "same\n",
+			b:        "same",
+			expected: "",
+		},
+		{
+			name: "Changed Line",
+			a:    lines("one", "two", "three"),
+			b:    lines("one", "2", "three"),
+			expected: lines("--- a", "+++ b", "@@ -1,3 +1,3 @@",
+				" one", "-two", "+2", " three"),
+		},
+		{
+			name: "Separate Hunks",
+			a:    lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"),
+			b:    lines("1", "x", "3", "4", "5", "6", "7", "8", "9", "10", "11"),
+			expected: lines("--- a", "+++ b",
+				"@@ -1,5 +1,5 @@", " 1", "-2", "+x", " 3", " 4", " 5",
+				"@@ -9,4 +9,3 @@", " 9", " 10", " 11", "-12"),
+		},
+		{
+			name: "Nearby Changes Merge",
+			a:    lines("1", "2", "3", "4", "5", "6", "7", "8"),
+			b:    lines("1", "x", "3", "4", "5", "6", "y", "8"),
+			expected: lines("--- a", "+++ b", "@@ -1,8 +1,8 @@",
+				" 1", "-2", "+x", " 3", " 4", " 5", " 6", "-7", "+y", " 8"),
+		},
+		{
+			name:     "From Empty",
+			a:        "",
+			b:        lines("new"),
+			expected: lines("--- a", "+++ b", "@@ -0,0 +1 @@", "+new"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, UnifiedDiff("a", "b", tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package postprocess
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Dead link handling modes
+const (
+	LinksAnnotate = "annotate" // Append a marker after each dead link
+	LinksStrip    = "strip"    // Remove dead links, keeping the label of markdown links
+)
+
+// urlPattern matches a candidate http(s) URL; trailing punctuation is trimmed afterwards
+var urlPattern = regexp.MustCompile("https?://[^\\s<>\"'`\\[\\]{}|\\\\^]+")
+
+// link is a URL found in text, at text[start:end]
+type link struct {
+	url        string
+	start, end int
+	label      int // Start of the "[label](" of a markdown link around the URL, or -1
+}
+
+// FindLinks returns the distinct http(s) URLs in text, in order of appearance
+func FindLinks(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, l := range findLinks(text) {
+		if !seen[l.url] {
+			seen[l.url] = true
+			urls = append(urls, l.url)
+		}
+	}
+	return urls
+}
+
+// RewriteLinks annotates or strips the links in text that dead reports as dead. Annotation
+// appends marker after the link; stripping keeps only the label of a markdown link and removes
+// a bare URL.
+func RewriteLinks(text string, dead func(url string) bool, mode, marker string) string {
+	links := findLinks(text)
+	if len(links) == 0 {
+		return text
+	}
+
+	var out strings.Builder
+	pos := 0
+	for _, l := range links {
+		if !dead(l.url) {
+			continue
+		}
+		// A markdown link spans from its "[" to the ")" after the URL
+		start, end := l.start, l.end
+		if l.label >= 0 {
+			start, end = l.label, l.end+1
+		}
+		if start < pos {
+			continue
+		}
+
+		out.WriteString(text[pos:start])
+		switch {
+		case mode == LinksStrip && l.label >= 0:
+			out.WriteString(text[l.label+1 : l.start-2])
+		case mode == LinksStrip:
+		default:
+			out.WriteString(text[start:end])
+			out.WriteString(marker)
+		}
+		pos = end
+	}
+	out.WriteString(text[pos:])
+	return out.String()
+}
+
+// findLinks locates the URLs in text
+func findLinks(text string) []link {
+	var links []link
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		url := trimURL(text[loc[0]:loc[1]])
+		if strings.HasSuffix(url, "//") {
+			continue // No host
+		}
+		l := link{url: url, start: loc[0], end: loc[0] + len(url), label: -1}
+
+		// [label](url)
+		if strings.HasSuffix(text[:l.start], "](") && strings.HasPrefix(text[l.end:], ")") {
+			line := text[:l.start-2]
+			if i := strings.LastIndexAny(line, "[\n"); i >= 0 && line[i] == '[' {
+				l.label = i
+			}
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// trimURL removes trailing characters that end the surrounding sentence rather than the URL,
+// keeping closing parentheses that balance an opening one inside it
+func trimURL(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		switch {
+		case strings.IndexByte(".,;:!?*_~", last) >= 0:
+		case last == ')' && strings.Count(url, "(") < strings.Count(url, ")"):
+		default:
+			return url
+		}
+		url = url[:len(url)-1]
+	}
+	return url
+}
@@ -0,0 +1,43 @@
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindLinks(t *testing.T) {
+	text := "See https://go.dev/doc/effective_go, the [spec](https://go.dev/ref/spec) and " +
+		"https://en.wikipedia.org/wiki/Go_(programming_language).\n" +
+		"(Mirror: https://example.com/a?b=1&c=2) https://go.dev/doc/effective_go again, not https:// or ftp://x.org."
+	assert.Equal(t, []string{
+		"https://go.dev/doc/effective_go",
+		"https://go.dev/ref/spec",
+		"https://en.wikipedia.org/wiki/Go_(programming_language)",
+		"https://example.com/a?b=1&c=2",
+	}, FindLinks(text))
+
+	assert.Empty(t, FindLinks("no links here"))
+}
+
+func TestRewriteLinks(t *testing.T) {
+	dead := func(url string) bool { return url != "https://ok.dev" }
+	text := "Read [the guide](https://gone.dev/guide) or https://gone.dev/raw, then https://ok.dev."
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{LinksAnnotate, "Read [the guide](https://gone.dev/guide) [dead link] or https://gone.dev/raw [dead link], then https://ok.dev."},
+		{LinksStrip, "Read the guide or , then https://ok.dev."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			assert.Equal(t, tt.want, RewriteLinks(text, dead, tt.mode, " [dead link]"))
+		})
+	}
+
+	// A bracket on an earlier line does not make a markdown link
+	assert.Equal(t, "[note\n]()", RewriteLinks("[note\n](https://gone.dev)", dead, LinksStrip, ""))
+	assert.Equal(t, "no links", RewriteLinks("no links", dead, LinksStrip, ""))
+}
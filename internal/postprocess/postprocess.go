@@ -0,0 +1,92 @@
+package postprocess
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// Rule types
+const (
+	TypeRegex             = "regex"              // Regular expression replacement
+	TypeReplace           = "replace"            // Literal string replacement
+	TypeStripFences       = "strip_fences"       // Remove markdown code fence lines
+	TypeNormalizeNewlines = "normalize_newlines" // Convert CRLF/CR line endings to LF
+)
+
+// fenceLine matches a markdown code fence opening or closing line
+var fenceLine = regexp.MustCompile("(?m)^[ \\t]*(```|~~~)[^\\n`]*\\n?")
+
+// Rule is a compiled post-processing rule
+type Rule struct {
+	Name   string
+	header string // Only apply when this request header is set to a truthy value
+	apply  func(string) string
+}
+
+// Compile validates a rule definition
+func Compile(cfg config.PostProcessRule) (*Rule, error) {
+	r := &Rule{Name: cfg.Name, header: cfg.Header}
+	if r.Name == "" {
+		r.Name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case TypeRegex:
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %w", r.Name, err)
+		}
+		r.apply = func(s string) string { return re.ReplaceAllString(s, cfg.Replacement) }
+	case TypeReplace:
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("rule %s: pattern is required", r.Name)
+		}
+		r.apply = func(s string) string { return strings.ReplaceAll(s, cfg.Pattern, cfg.Replacement) }
+	case TypeStripFences:
+		r.apply = func(s string) string { return fenceLine.ReplaceAllString(s, "") }
+	case TypeNormalizeNewlines:
+		r.apply = func(s string) string {
+			return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+		}
+	default:
+		return nil, fmt.Errorf("rule %s: unknown type %q", r.Name, cfg.Type)
+	}
+
+	return r, nil
+}
+
+// CompileAll compiles rule definitions in order
+func CompileAll(cfgs []config.PostProcessRule) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		r, err := Compile(cfg)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Applies reports whether the rule is active for a request with the given headers
+func (r *Rule) Applies(h http.Header) bool {
+	if r.header == "" {
+		return true
+	}
+	v := h.Get(r.header)
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	return err != nil || on // Any non-boolean value counts as set
+}
+
+// Apply rewrites text. In streams rules see whole lines at a time, so patterns cannot span lines.
+func (r *Rule) Apply(text string) string {
+	return r.apply(text)
+}
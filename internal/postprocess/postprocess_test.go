@@ -0,0 +1,94 @@
+package postprocess
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// TestRules tests each rule type
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     config.PostProcessRule
+		input    string
+		expected string
+	}{
+		{
+			name:     "Regex",
+			rule:     config.PostProcessRule{Type: TypeRegex, Pattern: `(?m)^Certainly! .*\n`, Replacement: ""},
+			input:    "Certainly! Here is the code:\nx = 1\n",
+			expected: "x = 1\n",
+		},
+		{
+			name:     "Replace",
+			rule:     config.PostProcessRule{Type: TypeReplace, Pattern: "GLM", Replacement: "model"},
+			input:    "GLM says hi",
+			expected: "model says hi",
+		},
+		{
+			name:     "Strip Fences",
+			rule:     config.PostProcessRule{Type: TypeStripFences},
+			input:    "```go\nx := 1\n```\n",
+			expected: "x := 1\n",
+		},
+		{
+			name:     "Normalize Newlines",
+			rule:     config.PostProcessRule{Type: TypeNormalizeNewlines},
+			input:    "a\r\nb\rc\n",
+			expected: "a\nb\nc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Compile(tt.rule)
+			if err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+			if got := r.Apply(tt.input); got != tt.expected {
+				t.Errorf("Apply(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCompile_Invalid tests rejected rule definitions
+func TestCompile_Invalid(t *testing.T) {
+	invalid := []config.PostProcessRule{
+		{Type: "uppercase"},
+		{Type: TypeRegex, Pattern: "("},
+		{Type: TypeReplace},
+	}
+	for _, rule := range invalid {
+		if _, err := Compile(rule); err == nil {
+			t.Errorf("Compile(%+v) expected error", rule)
+		}
+	}
+}
+
+// TestApplies tests header gating
+func TestApplies(t *testing.T) {
+	r, _ := Compile(config.PostProcessRule{Type: TypeStripFences, Header: "X-Raw-Code"})
+
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"", false},
+		{"1", true},
+		{"true", true},
+		{"false", false},
+		{"yes", true},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set("X-Raw-Code", tt.value)
+		}
+		if got := r.Applies(h); got != tt.expected {
+			t.Errorf("Applies(%q) = %v, want %v", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package prompts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DigestPrefix starts the content address of a fragment
+const DigestPrefix = "sha256:"
+
+// extensions are the file types loaded as fragments; the extension is not part of the name
+var extensions = []string{".md", ".txt", ".prompt"}
+
+// Fragment is a stored prompt, addressable by its name or the digest of its content
+type Fragment struct {
+	Name   string // Path below the store directory without extension, e.g. "style/go-reviewer"
+	Digest string // "sha256:" and the hex SHA-256 of Text
+	Text   string
+}
+
+// ShortDigest abbreviates the digest to 12 hex digits for logs and headers
+func (f *Fragment) ShortDigest() string {
+	return f.Digest[:len(DigestPrefix)+12]
+}
+
+// Store holds the fragments of a prompt directory
+type Store struct {
+	byName   map[string]*Fragment
+	byDigest map[string]*Fragment
+}
+
+// NotFoundError reports an include of a fragment the store does not have
+type NotFoundError struct {
+	Ref string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("unknown prompt fragment '%s'", e.Ref)
+}
+
+// CycleError reports fragments that include each other
+type CycleError struct {
+	Chain []string // Fragment names, ending with the first repeated one
+}
+
+func (e *CycleError) Error() string {
+	return "prompt include cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+// BudgetError reports includes whose expanded text exceeds the size budget
+type BudgetError struct {
+	MaxBytes int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("included prompt fragments exceed %d bytes", e.MaxBytes)
+}
+
+// Load reads every fragment file below dir. A missing directory yields an empty store.
+func Load(dir string) (*Store, error) {
+	s := &Store{byName: make(map[string]*Fragment), byDigest: make(map[string]*Fragment)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		ext := filepath.Ext(path)
+		if d.IsDir() || !slices.Contains(extensions, ext) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+		if _, ok := s.byName[name]; ok {
+			return fmt.Errorf("prompt fragment '%s' is defined by more than one file", name)
+		}
+		s.add(name, string(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// New creates a store from fragment texts keyed by name
+func New(texts map[string]string) *Store {
+	s := &Store{byName: make(map[string]*Fragment), byDigest: make(map[string]*Fragment)}
+	for name, text := range texts {
+		s.add(name, text)
+	}
+	return s
+}
+
+func (s *Store) add(name, text string) {
+	sum := sha256.Sum256([]byte(text))
+	f := &Fragment{Name: name, Digest: DigestPrefix + hex.EncodeToString(sum[:]), Text: text}
+	s.byName[name] = f
+	s.byDigest[f.Digest] = f
+}
+
+// Get looks up a fragment by name or by "sha256:<hex>" digest
+func (s *Store) Get(ref string) (*Fragment, bool) {
+	if strings.HasPrefix(ref, DigestPrefix) {
+		f, ok := s.byDigest[strings.ToLower(ref)]
+		return f, ok
+	}
+	f, ok := s.byName[ref]
+	return f, ok
+}
+
+// List returns the fragments sorted by name
+func (s *Store) List() []*Fragment {
+	list := make([]*Fragment, 0, len(s.byName))
+	for _, f := range s.byName {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b *Fragment) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Len returns the number of fragments
+func (s *Store) Len() int {
+	return len(s.byName)
+}
+
+// Resolver expands the includes of one request against a shared size budget
+type Resolver struct {
+	store    *Store
+	maxBytes int // 0 for no limit
+	used     int
+	included []*Fragment // Every fragment expanded, in order of first use
+}
+
+// NewResolver starts resolving a request's includes; maxBytes bounds the total expanded text
+func (s *Store) NewResolver(maxBytes int) *Resolver {
+	return &Resolver{store: s, maxBytes: maxBytes}
+}
+
+// Resolve returns the text of a fragment with the includes inside it expanded. A line holding
+// only {"$include": "<ref>"} is replaced by the referenced fragment.
+func (r *Resolver) Resolve(ref string) (string, error) {
+	return r.resolve(ref, nil)
+}
+
+// Included returns the fragments expanded so far, in order of first use
+func (r *Resolver) Included() []*Fragment {
+	return r.included
+}
+
+func (r *Resolver) resolve(ref string, chain []string) (string, error) {
+	f, ok := r.store.Get(ref)
+	if !ok {
+		return "", &NotFoundError{Ref: ref}
+	}
+	if slices.Contains(chain, f.Name) {
+		return "", &CycleError{Chain: append(slices.Clone(chain), f.Name)}
+	}
+	chain = append(chain, f.Name)
+	if !slices.Contains(r.included, f) {
+		r.included = append(r.included, f)
+	}
+
+	lines := strings.SplitAfter(f.Text, "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		nested, ok := ParseInclude(strings.TrimSpace(line))
+		if !ok {
+			if err := r.spend(len(line)); err != nil {
+				return "", err
+			}
+			out.WriteString(line)
+			continue
+		}
+
+		text, err := r.resolve(nested, chain)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(text)
+		// Keep the line break that ended the directive
+		if strings.HasSuffix(line, "\n") && !strings.HasSuffix(text, "\n") {
+			if err := r.spend(1); err != nil {
+				return "", err
+			}
+			out.WriteByte('\n')
+		}
+	}
+	return out.String(), nil
+}
+
+// spend charges expanded bytes against the budget
+func (r *Resolver) spend(n int) error {
+	r.used += n
+	if r.maxBytes > 0 && r.used > r.maxBytes {
+		return &BudgetError{MaxBytes: r.maxBytes}
+	}
+	return nil
+}
+
+// ParseInclude reports whether s is an include directive, {"$include": "<ref>"}, and returns
+// its reference
+func ParseInclude(s string) (string, bool) {
+	if !strings.HasPrefix(s, "{") || !strings.Contains(s, `"$include"`) {
+		return "", false
+	}
+	var directive any
+	if err := json.Unmarshal([]byte(s), &directive); err != nil {
+		return "", false
+	}
+	return IncludeRef(directive)
+}
+
+// IncludeRef reports whether a decoded JSON value is an include directive and returns its
+// reference. The directive object has no other fields.
+func IncludeRef(v any) (string, bool) {
+	directive, ok := v.(map[string]any)
+	if !ok || len(directive) != 1 {
+		return "", false
+	}
+	ref, ok := directive["$include"].(string)
+	return ref, ok && ref != ""
+}
@@ -0,0 +1,146 @@
+package prompts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoad tests that fragment files are named by their path without extension
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"style/go-reviewer.md": "Review Go code.\n",
+		"base.txt":             "Be brief.",
+		"notes.json":           "ignored",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	var names []string
+	for _, f := range s.List() {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "base,style/go-reviewer" {
+		t.Errorf("Fragments = %s, want base,style/go-reviewer", got)
+	}
+
+	f, ok := s.Get("style/go-reviewer")
+	if !ok {
+		t.Fatal("Fragment style/go-reviewer not found")
+	}
+	byDigest, ok := s.Get(strings.ToUpper(f.Digest[len(DigestPrefix):]))
+	if ok {
+		t.Errorf("Bare hex digest resolved to %s", byDigest.Name)
+	}
+	if byDigest, ok := s.Get(f.Digest); !ok || byDigest != f {
+		t.Errorf("Get(%s) did not return the fragment", f.Digest)
+	}
+
+	// A duplicate name from another extension is rejected
+	if err := os.WriteFile(filepath.Join(dir, "base.md"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("Expected an error for base.md and base.txt")
+	}
+
+	// A missing directory is an empty store
+	s, err = Load(filepath.Join(dir, "missing"))
+	if err != nil || s.Len() != 0 {
+		t.Errorf("Load(missing) = %d fragments, %v; want an empty store", s.Len(), err)
+	}
+}
+
+// TestResolve tests nested includes, cycles and the size budget
+func TestResolve(t *testing.T) {
+	s := New(map[string]string{
+		"base":     "Be brief.",
+		"reviewer": "You review Go code.\n{\"$include\": \"base\"}\n  {\"$include\":\"base\"}\nEnd.",
+		"a":        `{"$include": "b"}`,
+		"b":        `{"$include": "a"}`,
+		"self":     "x\n{\"$include\": \"self\"}",
+		"diamond":  "{\"$include\": \"reviewer\"}\n{\"$include\": \"base\"}",
+		"missing":  `{"$include": "nope"}`,
+		"not json": `{"$include": "base", "extra": 1}`,
+	})
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"reviewer", "You review Go code.\nBe brief.\nBe brief.\nEnd.", ""},
+		{"diamond", "You review Go code.\nBe brief.\nBe brief.\nEnd.\nBe brief.", ""},
+		{"not json", `{"$include": "base", "extra": 1}`, ""},
+		{"a", "", "prompt include cycle: a -> b -> a"},
+		{"self", "", "prompt include cycle: self -> self"},
+		{"missing", "", "unknown prompt fragment 'nope'"},
+		{"nope", "", "unknown prompt fragment 'nope'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := s.NewResolver(0).Resolve(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Resolve(%s) error = %v, want %s", tt.ref, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%s) error: %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%s) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+
+	// The budget is shared by every include of a resolver
+	r := s.NewResolver(15)
+	if _, err := r.Resolve("base"); err != nil {
+		t.Fatalf("First include error: %v", err)
+	}
+	_, err := r.Resolve("base")
+	var budget *BudgetError
+	if !errors.As(err, &budget) || budget.MaxBytes != 15 {
+		t.Errorf("Second include error = %v, want a 15 byte budget error", err)
+	}
+	if len(r.Included()) != 1 || r.Included()[0].Name != "base" {
+		t.Errorf("Included() = %v, want base once", r.Included())
+	}
+}
+
+// TestIncludeRef tests recognizing directives in decoded JSON
+func TestIncludeRef(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+		ok   bool
+	}{
+		{map[string]any{"$include": "style/go"}, "style/go", true},
+		{map[string]any{"$include": ""}, "", false},
+		{map[string]any{"$include": 1}, "", false},
+		{map[string]any{"$include": "x", "type": "text"}, "", false},
+		{"text", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := IncludeRef(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("IncludeRef(%v) = %q, %v; want %q, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// repeats tracks the most recent arrival times of one client/payload pair
+type repeats struct {
+	times    []time.Time // Oldest first, at most max entries
+	storming bool
+}
+
+// Duplicates detects a client sending the same payload more than max times within a window,
+// which usually means a misbehaving retry loop
+type Duplicates struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*repeats
+	lastSweep time.Time
+	clock     clock.Clock
+}
+
+// NewDuplicates creates a detector allowing up to max identical requests per window
+func NewDuplicates(max int, window time.Duration) *Duplicates {
+	if max < 1 {
+		max = 1
+	}
+	return &Duplicates{
+		max:     max,
+		window:  window,
+		entries: make(map[string]*repeats),
+		clock:   clock.Real{},
+	}
+}
+
+// Seen records a request with the given payload key and reports whether it is allowed.
+// Rejected requests are recorded too, so a storm stays blocked until the client pauses for
+// a full window. started is true only for the first rejection of a storm.
+func (d *Duplicates) Seen(key string) (allowed bool, started bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	d.sweep(now)
+
+	e, ok := d.entries[key]
+	if !ok {
+		e = &repeats{}
+		d.entries[key] = e
+	}
+
+	allowed = len(e.times) < d.max || now.Sub(e.times[0]) >= d.window
+	e.times = append(e.times, now)
+	if len(e.times) > d.max {
+		e.times = e.times[len(e.times)-d.max:]
+	}
+
+	if allowed {
+		e.storming = false
+		return true, false
+	}
+	started = !e.storming
+	e.storming = true
+	return false, started
+}
+
+// Len returns the number of tracked client/payload pairs
+func (d *Duplicates) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+// sweep evicts pairs not seen for a full window, at most once per window; callers must hold d.mu
+func (d *Duplicates) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+	for key, e := range d.entries {
+		if now.Sub(e.times[len(e.times)-1]) >= d.window {
+			delete(d.entries, key)
+		}
+	}
+}
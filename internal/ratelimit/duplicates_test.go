@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+func newTestDuplicates(max int, window time.Duration) (*Duplicates, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := NewDuplicates(max, window)
+	d.clock = clk
+	return d, clk
+}
+
+// TestDuplicates_Storm tests that repeats beyond the limit are rejected and a storm is reported once
+func TestDuplicates_Storm(t *testing.T) {
+	d, clk := newTestDuplicates(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := d.Seen("client|hash"); !ok {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+		clk.Advance(time.Second)
+	}
+
+	ok, started := d.Seen("client|hash")
+	if ok || !started {
+		t.Fatalf("Fourth repeat: got allowed=%v started=%v, want rejected storm start", ok, started)
+	}
+	ok, started = d.Seen("client|hash")
+	if ok || started {
+		t.Fatalf("Fifth repeat: got allowed=%v started=%v, want rejected without new storm", ok, started)
+	}
+
+	// Other payloads are independent
+	if ok, _ := d.Seen("client|other"); !ok {
+		t.Error("Different payload should be allowed")
+	}
+
+	// Retrying throughout keeps the storm blocked; a pause of a full window ends it
+	clk.Advance(30 * time.Second)
+	if ok, _ := d.Seen("client|hash"); ok {
+		t.Error("Repeat within window of previous attempts should stay blocked")
+	}
+	clk.Advance(time.Minute)
+	if ok, _ := d.Seen("client|hash"); !ok {
+		t.Error("Repeat after a quiet window should be allowed")
+	}
+}
+
+// TestDuplicates_Sweep tests that quiet pairs are evicted
+func TestDuplicates_Sweep(t *testing.T) {
+	d, clk := newTestDuplicates(3, time.Minute)
+	d.Seen("a")
+	d.Seen("b")
+	if d.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", d.Len())
+	}
+	clk.Advance(time.Minute)
+	d.Seen("c")
+	if d.Len() != 1 {
+		t.Errorf("Expected idle entries to be evicted, got %d", d.Len())
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// idleTTL is how long an untouched bucket is kept before it is evicted
+const idleTTL = 10 * time.Minute
+
+// bucket is a single token bucket
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter is a keyed token-bucket rate limiter. Each key (e.g. a client IP) gets its own
+// bucket that holds up to burst tokens and refills at rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	clock     clock.Clock
+}
+
+// New creates a limiter allowing a sustained requestsPerMinute with bursts of up to burst requests
+func New(requestsPerMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    requestsPerMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		clock:   clock.Real{},
+	}
+}
+
+// Allow takes a token for key. When the bucket is empty it returns false and the time until
+// the next token becomes available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastSeen).Seconds()
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.lastSeen = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.rate <= 0 {
+		return false, idleTTL
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Remaining returns the whole tokens left in key's bucket and the time until it is full again,
+// without taking one. Unknown keys have a full bucket.
+func (l *Limiter) Remaining(key string) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return int(l.burst), 0
+	}
+	tokens := math.Min(l.burst, b.tokens+l.clock.Now().Sub(b.lastSeen).Seconds()*l.rate)
+	if tokens >= l.burst || l.rate <= 0 {
+		return int(tokens), 0
+	}
+	return int(tokens), time.Duration((l.burst - tokens) / l.rate * float64(time.Second))
+}
+
+// Burst returns the most requests a key may send back to back
+func (l *Limiter) Burst() int {
+	return int(l.burst)
+}
+
+// Len returns the number of tracked keys
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep evicts idle buckets at most once per idleTTL; callers must hold l.mu
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
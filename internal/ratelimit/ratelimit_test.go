@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+func newTestLimiter(perMinute float64, burst int) (*Limiter, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := New(perMinute, burst)
+	l.clock = clk
+	return l, clk
+}
+
+// TestAllow_Burst tests that a burst is allowed and then throttled
+func TestAllow_Burst(t *testing.T) {
+	l, _ := newTestLimiter(60, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("10.0.0.1"); !ok {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("10.0.0.1")
+	if ok {
+		t.Fatal("Request beyond burst should be throttled")
+	}
+	if wait != time.Second {
+		t.Errorf("Expected 1s retry, got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("10.0.0.2"); !ok {
+		t.Error("Different key should be allowed")
+	}
+}
+
+// TestAllow_Refill tests that tokens refill at the sustained rate
+func TestAllow_Refill(t *testing.T) {
+	l, clk := newTestLimiter(60, 1)
+
+	l.Allow("ip")
+	if ok, _ := l.Allow("ip"); ok {
+		t.Fatal("Expected throttle")
+	}
+	clk.Advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("ip"); ok {
+		t.Fatal("Expected throttle after half a token")
+	}
+	clk.Advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("ip"); !ok {
+		t.Fatal("Expected allow after refill")
+	}
+}
+
+// TestSweep tests that idle buckets are evicted
+func TestSweep(t *testing.T) {
+	l, clk := newTestLimiter(60, 1)
+	l.Allow("a")
+	l.Allow("b")
+	if l.Len() != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", l.Len())
+	}
+	clk.Advance(idleTTL)
+	l.Allow("c")
+	if l.Len() != 1 {
+		t.Errorf("Expected idle buckets evicted, got %d", l.Len())
+	}
+}
+
+// TestRemaining tests reading a bucket without taking from it
+func TestRemaining(t *testing.T) {
+	l, clk := newTestLimiter(60, 3)
+	if n, full := l.Remaining("ip"); n != 3 || full != 0 {
+		t.Errorf("Expected a full bucket for a new key, got %d, %v", n, full)
+	}
+
+	l.Allow("ip")
+	l.Allow("ip")
+	if n, full := l.Remaining("ip"); n != 1 || full != 2*time.Second {
+		t.Errorf("Expected 1 token, full in 2s, got %d, %v", n, full)
+	}
+	clk.Advance(1500 * time.Millisecond)
+	if n, full := l.Remaining("ip"); n != 2 || full != 500*time.Millisecond {
+		t.Errorf("Expected 2 tokens, full in 500ms, got %d, %v", n, full)
+	}
+	if l.Burst() != 3 {
+		t.Errorf("Expected burst 3, got %d", l.Burst())
+	}
+}
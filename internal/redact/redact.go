@@ -0,0 +1,65 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// piiPattern pairs a detector with the placeholder that replaces its matches
+type piiPattern struct {
+	re          *regexp.Regexp
+	placeholder string
+}
+
+// piiPatterns are applied in order; more specific patterns come first
+var piiPatterns = []piiPattern{
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d(?:[ \-]?\d){12,15}\b`), "[CARD]"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[IP]"},
+	{regexp.MustCompile(`\+?\d{1,3}[ \-.]?\(?\d{2,4}\)?[ \-.]?\d{3,4}[ \-.]?\d{3,4}\b`), "[PHONE]"},
+}
+
+// PII replaces email addresses, card numbers, IPv4 addresses and phone numbers with placeholders
+func PII(s string) string {
+	for _, p := range piiPatterns {
+		s = p.re.ReplaceAllString(s, p.placeholder)
+	}
+	return s
+}
+
+// bearerPattern matches credentials in Authorization-style values
+var bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/\-]+=*`)
+
+// dataURLPattern matches base64 data URLs such as inline images
+var dataURLPattern = regexp.MustCompile(`data:([\w.+\-]+/[\w.+\-]+)?((?:;[\w\-]+=[^;,]*)*);base64,([A-Za-z0-9+/=]+)`)
+
+// Secrets masks bearer/basic credentials and collapses base64 data URLs to their media type and size
+func Secrets(s string) string {
+	s = bearerPattern.ReplaceAllString(s, "$1 [REDACTED]")
+	return dataURLPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := dataURLPattern.FindStringSubmatch(match)
+		return fmt.Sprintf("data:%s;base64,[%d bytes]", groups[1], len(groups[3]))
+	})
+}
+
+// Value applies fn to every string inside a decoded JSON value, returning a redacted copy
+func Value(v any, fn func(string) string) any {
+	switch val := v.(type) {
+	case string:
+		return fn(val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = Value(item, fn)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = Value(item, fn)
+		}
+		return out
+	default:
+		return v
+	}
+}
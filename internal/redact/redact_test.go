@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPII tests that common personal data is replaced with placeholders
+func TestPII(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"mail me at jane.doe@example.com", "mail me at [EMAIL]"},
+		{"card 4111 1111 1111 1111 ok", "card [CARD] ok"},
+		{"server at 192.168.1.20", "server at [IP]"},
+		{"call +48 601 234 567", "call [PHONE]"},
+		{"version 4.7 has 200000 tokens", "version 4.7 has 200000 tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := PII(tt.input); got != tt.expected {
+				t.Errorf("PII(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestValue tests that nested JSON strings are redacted without mutating the input
+func TestValue(t *testing.T) {
+	input := map[string]any{
+		"role":  "user",
+		"parts": []any{"a@b.io", 42.0},
+	}
+	got := Value(input, PII)
+
+	expected := map[string]any{
+		"role":  "user",
+		"parts": []any{"[EMAIL]", 42.0},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Value() = %v, want %v", got, expected)
+	}
+	if input["parts"].([]any)[0] != "a@b.io" {
+		t.Error("Value() mutated its input")
+	}
+}
+
+// TestSecrets tests that credentials and inline data are masked
+func TestSecrets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Bearer sk-abc.123_XYZ", "Bearer [REDACTED]"},
+		{"authorization: basic dXNlcjpwYXNz==", "authorization: basic [REDACTED]"},
+		{"img data:image/png;base64,iVBORw0KGgo= end", "img data:image/png;base64,[12 bytes] end"},
+		{"plain text", "plain text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Secrets(tt.input); got != tt.expected {
+				t.Errorf("Secrets(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
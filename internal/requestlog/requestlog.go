@@ -0,0 +1,290 @@
+// Package requestlog keeps a SQLite database of the chat requests a server relayed, one row
+// per request with its timing, status and token usage but no content, and answers the
+// queries behind the stats and logs commands.
+package requestlog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the pure Go "sqlite" driver
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// Record is one relayed chat request
+type Record struct {
+	Time             time.Time `json:"time"`
+	RequestID        string    `json:"request_id"`
+	Client           string    `json:"client,omitempty"`
+	Model            string    `json:"model"`
+	Status           int       `json:"status"`
+	LatencyMS        int64     `json:"latency_ms"` // From sending the request upstream to the end of the relay
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Stream           bool      `json:"stream"`
+	PromptHash       string    `json:"prompt_hash,omitempty"` // Truncated SHA-256 of the messages, to spot repeats without keeping content
+}
+
+// Filter selects records; zero fields match everything
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Model  string
+	Client string
+	Status int   // Exact status; see Errors for any failure
+	Errors bool  // Only statuses of 400 and above
+	Limit  int   // Newest first; 0 for no limit
+	Offset int64 // Skipped before Limit applies
+}
+
+// Summary aggregates the requests of one day and model
+type Summary struct {
+	Day              string  `json:"day"` // YYYY-MM-DD, UTC
+	Model            string  `json:"model"`
+	Requests         int64   `json:"requests"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AvgLatencyMS     float64 `json:"avg_latency_ms"`
+	MaxLatencyMS     int64   `json:"max_latency_ms"`
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id                INTEGER PRIMARY KEY,
+	time              INTEGER NOT NULL,
+	request_id        TEXT NOT NULL,
+	client            TEXT NOT NULL DEFAULT '',
+	model             TEXT NOT NULL,
+	status            INTEGER NOT NULL,
+	latency_ms        INTEGER NOT NULL,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	stream            INTEGER NOT NULL DEFAULT 0,
+	prompt_hash       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS requests_time ON requests (time);
+`
+
+// Log writes records in the background so a slow disk never delays a response
+type Log struct {
+	db      *sql.DB
+	maxAge  time.Duration
+	clock   clock.Clock
+	records chan Record
+	dropped atomic.Int64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// queueSize bounds the records waiting to be written; more are dropped
+const queueSize = 1024
+
+// Open opens the database at path, creating it and its directory if needed
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// WAL lets the stats and logs commands read while a server writes
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("request log %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// New opens the database at path and starts the writer. Records older than maxAge by clk are
+// deleted at start and hourly after; 0 keeps them.
+func New(path string, maxAge time.Duration, clk clock.Clock) (*Log, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{db: db, maxAge: maxAge, clock: clk, records: make(chan Record, queueSize), done: make(chan struct{})}
+	go l.run()
+	return l, nil
+}
+
+// Append queues a record, dropping it when the writer has fallen behind
+func (l *Log) Append(r Record) {
+	select {
+	case l.records <- r:
+	default:
+		if l.dropped.Add(1) == 1 {
+			slog.Warn("Request log is falling behind; dropping records")
+		}
+	}
+}
+
+// Close writes the queued records and closes the database
+func (l *Log) Close() error {
+	l.once.Do(func() { close(l.records) })
+	<-l.done
+	return l.db.Close()
+}
+
+// run writes queued records, batching those that arrive together into one transaction
+func (l *Log) run() {
+	defer close(l.done)
+	l.prune()
+	pruned := l.clock.Now()
+	for r := range l.records {
+		batch := []Record{r}
+	drain:
+		for len(batch) < queueSize {
+			select {
+			case r, ok := <-l.records:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		if err := Insert(context.Background(), l.db, batch...); err != nil {
+			slog.Error("Failed to write request log", "records", len(batch), "error", err)
+		}
+		if l.clock.Since(pruned) >= time.Hour {
+			l.prune()
+			pruned = l.clock.Now()
+		}
+	}
+}
+
+// prune deletes records past the age limit
+func (l *Log) prune() {
+	if l.maxAge <= 0 {
+		return
+	}
+	if n, err := Prune(context.Background(), l.db, l.clock.Now().Add(-l.maxAge)); err != nil {
+		slog.Error("Failed to prune request log", "error", err)
+	} else if n > 0 {
+		slog.Info("Pruned request log", "records", n)
+	}
+}
+
+// Insert writes records in one transaction
+func Insert(ctx context.Context, db *sql.DB, records ...Record) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO requests
+		(time, request_id, client, model, status, latency_ms, prompt_tokens, completion_tokens, stream, prompt_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		if _, err := stmt.ExecContext(ctx, r.Time.UnixMilli(), r.RequestID, r.Client, r.Model, r.Status, r.LatencyMS,
+			r.PromptTokens, r.CompletionTokens, r.Stream, r.PromptHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Prune deletes the records before cutoff and returns how many it deleted
+func Prune(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM requests WHERE time < ?`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// where builds the WHERE clause of a filter
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if !f.Since.IsZero() {
+		conds, args = append(conds, "time >= ?"), append(args, f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		conds, args = append(conds, "time < ?"), append(args, f.Until.UnixMilli())
+	}
+	if f.Model != "" {
+		conds, args = append(conds, "model = ?"), append(args, f.Model)
+	}
+	if f.Client != "" {
+		conds, args = append(conds, "client = ?"), append(args, f.Client)
+	}
+	if f.Status != 0 {
+		conds, args = append(conds, "status = ?"), append(args, f.Status)
+	}
+	if f.Errors {
+		conds = append(conds, "status >= 400")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Query returns the records matching f, newest first
+func Query(ctx context.Context, db *sql.DB, f Filter) ([]Record, error) {
+	where, args := f.where()
+	query := `SELECT time, request_id, client, model, status, latency_ms, prompt_tokens, completion_tokens, stream, prompt_hash
+		FROM requests` + where + ` ORDER BY time DESC, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, f.Limit, f.Offset)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		var ms int64
+		if err := rows.Scan(&ms, &r.RequestID, &r.Client, &r.Model, &r.Status, &r.LatencyMS,
+			&r.PromptTokens, &r.CompletionTokens, &r.Stream, &r.PromptHash); err != nil {
+			return nil, err
+		}
+		r.Time = time.UnixMilli(ms).UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Stats summarizes the records matching f by UTC day and model, oldest day first
+func Stats(ctx context.Context, db *sql.DB, f Filter) ([]Summary, error) {
+	where, args := f.where()
+	rows, err := db.QueryContext(ctx, `SELECT strftime('%Y-%m-%d', time / 1000, 'unixepoch') AS day, model,
+		COUNT(*), SUM(status >= 400), SUM(prompt_tokens), SUM(completion_tokens), AVG(latency_ms), MAX(latency_ms)
+		FROM requests`+where+` GROUP BY day, model ORDER BY day, model`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []Summary
+	for rows.Next() {
+		var s Summary
+		if err := rows.Scan(&s.Day, &s.Model, &s.Requests, &s.Errors, &s.PromptTokens, &s.CompletionTokens,
+			&s.AvgLatencyMS, &s.MaxLatencyMS); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,82 @@
+package requestlog
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// TestLog tests that appended records are written and can be queried and summarized
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "requests.db")
+	l, err := New(path, 0, clock.Real{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	for _, r := range []Record{
+		{Time: day1, RequestID: "r1", Client: "ci", Model: "glm-4.7", Status: 200, LatencyMS: 100, PromptTokens: 10, CompletionTokens: 5, Stream: true, PromptHash: "aa"},
+		{Time: day1.Add(time.Hour), RequestID: "r2", Client: "laptop", Model: "glm-4.7", Status: 502, LatencyMS: 300},
+		{Time: day1.Add(2 * time.Hour), RequestID: "r3", Client: "ci", Model: "glm-4.6", Status: 200, LatencyMS: 50, PromptTokens: 7, CompletionTokens: 3},
+		{Time: day2, RequestID: "r4", Client: "ci", Model: "glm-4.7", Status: 200, LatencyMS: 80, PromptTokens: 1, CompletionTokens: 1},
+	} {
+		l.Append(r)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	records, err := Query(ctx, db, Filter{Client: "ci", Limit: 2})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 2 || records[0].RequestID != "r4" || records[1].RequestID != "r3" {
+		t.Errorf("Query(client ci, limit 2) = %+v, want r4 and r3", records)
+	}
+	records, err = Query(ctx, db, Filter{Errors: true})
+	if err != nil || len(records) != 1 || records[0].RequestID != "r2" {
+		t.Errorf("Query(errors) = %+v, %v, want r2", records, err)
+	}
+	records, err = Query(ctx, db, Filter{Since: day1, Until: day1.Add(time.Minute)})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Query(first minute) = %+v, %v, want r1", records, err)
+	}
+	if want := (Record{Time: day1, RequestID: "r1", Client: "ci", Model: "glm-4.7", Status: 200, LatencyMS: 100,
+		PromptTokens: 10, CompletionTokens: 5, Stream: true, PromptHash: "aa"}); records[0] != want {
+		t.Errorf("Query(first minute) = %+v, want %+v", records[0], want)
+	}
+
+	summaries, err := Stats(ctx, db, Filter{})
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	want := []Summary{
+		{Day: "2026-03-01", Model: "glm-4.6", Requests: 1, PromptTokens: 7, CompletionTokens: 3, AvgLatencyMS: 50, MaxLatencyMS: 50},
+		{Day: "2026-03-01", Model: "glm-4.7", Requests: 2, Errors: 1, PromptTokens: 10, CompletionTokens: 5, AvgLatencyMS: 200, MaxLatencyMS: 300},
+		{Day: "2026-03-02", Model: "glm-4.7", Requests: 1, PromptTokens: 1, CompletionTokens: 1, AvgLatencyMS: 80, MaxLatencyMS: 80},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("Stats() = %+v, want %+v", summaries, want)
+	}
+	for i := range want {
+		if summaries[i] != want[i] {
+			t.Errorf("Stats()[%d] = %+v, want %+v", i, summaries[i], want[i])
+		}
+	}
+
+	n, err := Prune(ctx, db, day2)
+	if err != nil || n != 3 {
+		t.Errorf("Prune() = %d, %v, want 3", n, err)
+	}
+}
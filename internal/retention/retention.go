@@ -0,0 +1,178 @@
+// Package retention bounds the disk usage of the proxy's persisted data. Each store is a directory
+// of files (or a single append-only file) with an age limit and a size cap; a janitor sweeps the
+// stores periodically and the purge command sweeps them on demand.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// Store is one kind of persisted data and its retention policy
+type Store struct {
+	Name     string
+	Path     string        // Directory swept recursively, or a single file
+	MaxAge   time.Duration // Files not modified for this long are deleted; 0 disables
+	MaxBytes int64         // Oldest files are deleted until the store fits; 0 disables
+
+	// Truncate empties a single file over MaxBytes instead of deleting it, for files
+	// held open for appending such as the log
+	Truncate bool
+}
+
+// Result summarizes what a sweep removed from a store
+type Result struct {
+	Store string
+	Files int
+	Bytes int64
+}
+
+// file is a candidate for removal
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Sweep applies the store's policy as of now. With all set every file is removed regardless of
+// policy. With dryRun set nothing is changed and the result reports what would be removed.
+func Sweep(s Store, now time.Time, all, dryRun bool) (Result, error) {
+	res := Result{Store: s.Name}
+	files, err := list(s.Path)
+	if err != nil {
+		return res, err
+	}
+
+	remove := func(f file) error {
+		if !dryRun {
+			var err error
+			if s.Truncate {
+				err = os.Truncate(f.path, 0)
+			} else {
+				err = os.Remove(f.path)
+			}
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		res.Files++
+		res.Bytes += f.size
+		return nil
+	}
+
+	// Oldest first, so the size cap removes the stalest data
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+
+	var total int64
+	kept := files[:0]
+	cutoff := now.Add(-s.MaxAge)
+	for _, f := range files {
+		if all || (s.MaxAge > 0 && f.modTime.Before(cutoff)) {
+			if err := remove(f); err != nil {
+				return res, err
+			}
+			continue
+		}
+		kept = append(kept, f)
+		total += f.size
+	}
+
+	for _, f := range kept {
+		if s.MaxBytes <= 0 || total <= s.MaxBytes {
+			break
+		}
+		if err := remove(f); err != nil {
+			return res, err
+		}
+		total -= f.size
+	}
+	return res, nil
+}
+
+// list returns the regular files under path, or path itself if it is a file
+func list(path string) ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// Janitor sweeps stores on an interval
+type Janitor struct {
+	stores   []Store
+	interval time.Duration
+	clock    clock.Clock
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewJanitor creates a janitor for the stores, timing sweeps and ages by clk
+func NewJanitor(stores []Store, interval time.Duration, clk clock.Clock) *Janitor {
+	return &Janitor{stores: stores, interval: interval, clock: clk, stop: make(chan struct{})}
+}
+
+// Start sweeps immediately and then on every interval
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := j.clock.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			j.sweep()
+			select {
+			case <-ticker.C():
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic sweeping
+func (j *Janitor) Stop() {
+	close(j.stop)
+	j.wg.Wait()
+}
+
+// sweep applies every store's policy, logging removals and failures
+func (j *Janitor) sweep() {
+	for _, s := range j.stores {
+		res, err := Sweep(s, j.clock.Now(), false, false)
+		if err != nil {
+			slog.Error("Retention sweep failed", "store", s.Name, "error", err)
+			continue
+		}
+		if res.Files > 0 {
+			slog.Info("Retention sweep", "store", s.Name, "files", res.Files, "bytes", res.Bytes)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile creates a file of size bytes last modified age ago
+func writeFile(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(-age)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestSweep_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.json")
+	nested := filepath.Join(dir, "sub", "old.json")
+	fresh := filepath.Join(dir, "fresh.json")
+	writeFile(t, old, 10, 48*time.Hour)
+	writeFile(t, nested, 10, 48*time.Hour)
+	writeFile(t, fresh, 10, time.Minute)
+
+	res, err := Sweep(Store{Name: "traces", Path: dir, MaxAge: 24 * time.Hour}, time.Now(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 2 || res.Bytes != 20 {
+		t.Errorf("Sweep removed %d files, %d bytes; want 2, 20", res.Files, res.Bytes)
+	}
+	if exists(old) || exists(nested) || !exists(fresh) {
+		t.Error("Sweep should remove only expired files")
+	}
+}
+
+func TestSweep_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	oldest := filepath.Join(dir, "a.jsonl")
+	middle := filepath.Join(dir, "b.jsonl")
+	newest := filepath.Join(dir, "c.jsonl")
+	writeFile(t, oldest, 100, 3*time.Hour)
+	writeFile(t, middle, 100, 2*time.Hour)
+	writeFile(t, newest, 100, time.Hour)
+
+	res, err := Sweep(Store{Name: "datasets", Path: dir, MaxBytes: 150}, time.Now(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 2 {
+		t.Errorf("Sweep removed %d files, want 2", res.Files)
+	}
+	if exists(oldest) || exists(middle) || !exists(newest) {
+		t.Error("Sweep should remove the oldest files first")
+	}
+}
+
+func TestSweep_TruncateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "copilot-proxy.log")
+	writeFile(t, path, 200, 0)
+
+	if _, err := Sweep(Store{Name: "logs", Path: path, MaxBytes: 100, Truncate: true}, time.Now(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != 0 {
+		t.Errorf("Log file should be emptied, got %v, %v", info, err)
+	}
+}
+
+func TestSweep_AllAndDryRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fresh.json")
+	writeFile(t, path, 10, 0)
+	store := Store{Name: "traces", Path: dir}
+
+	res, err := Sweep(store, time.Now(), true, true)
+	if err != nil || res.Files != 1 || !exists(path) {
+		t.Errorf("Dry run should report without deleting: %+v, %v", res, err)
+	}
+	if res, err = Sweep(store, time.Now(), true, false); err != nil || res.Files != 1 || exists(path) {
+		t.Errorf("All should delete fresh files: %+v, %v", res, err)
+	}
+}
+
+func TestSweep_MissingPath(t *testing.T) {
+	res, err := Sweep(Store{Name: "datasets", Path: filepath.Join(t.TempDir(), "none"), MaxAge: time.Hour}, time.Now(), false, false)
+	if err != nil || res.Files != 0 {
+		t.Errorf("Missing store should be empty: %+v, %v", res, err)
+	}
+}
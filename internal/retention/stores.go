@@ -0,0 +1,35 @@
+package retention
+
+import "github.com/chew-z/copilot-proxy/internal/config"
+
+// bytesPerMB converts configured megabyte caps
+const bytesPerMB = 1 << 20
+
+// Stores returns the proxy's persisted data stores with their configured policies
+func Stores(cfg *config.Config) ([]Store, error) {
+	datasets, err := cfg.Dataset.DirPath()
+	if err != nil {
+		return nil, err
+	}
+	traces, err := cfg.Trace.DirPath()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := cfg.Usage.DirPath()
+	if err != nil {
+		return nil, err
+	}
+
+	r := cfg.Retention
+	traceAge := r.Traces.MaxAge
+	if traceAge == 0 {
+		traceAge = cfg.Trace.Retention
+	}
+
+	return []Store{
+		{Name: "datasets", Path: datasets, MaxAge: r.Datasets.MaxAge, MaxBytes: int64(r.Datasets.MaxMB) * bytesPerMB},
+		{Name: "traces", Path: traces, MaxAge: traceAge, MaxBytes: int64(r.Traces.MaxMB) * bytesPerMB},
+		{Name: "usage", Path: usage, MaxAge: r.Usage.MaxAge, MaxBytes: int64(r.Usage.MaxMB) * bytesPerMB},
+		{Name: "logs", Path: config.LogPath(), MaxBytes: int64(r.Logs.MaxMB) * bytesPerMB, Truncate: true},
+	}, nil
+}
@@ -0,0 +1,189 @@
+// Package rewrite applies declarative edits to upstream chat request bodies, so compatibility
+// tweaks can be configured instead of coded
+package rewrite
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// Dialects a rule can be limited to
+const (
+	DialectOpenAI = "openai"
+	DialectOllama = "ollama"
+)
+
+// Rule is a compiled body rewrite rule
+type Rule struct {
+	Name    string
+	model   string            // Glob on the canonical model; empty matches all
+	dialect string            // Empty matches both
+	headers map[string]string // Canonical header name -> required value, "*" for any
+	renames [][2]string       // Sorted by source path so rules apply deterministically
+	deletes [][]string
+	sets    []setOp
+}
+
+// setOp assigns a value at a field path
+type setOp struct {
+	path  []string
+	value any
+}
+
+// Compile validates a rule definition
+func Compile(cfg config.RewriteRule) (*Rule, error) {
+	r := &Rule{Name: cfg.Name, model: strings.ToLower(cfg.Model), dialect: cfg.Dialect}
+	if r.Name == "" {
+		r.Name = "rewrite"
+	}
+
+	if _, err := path.Match(r.model, ""); err != nil {
+		return nil, fmt.Errorf("rule %s: invalid model pattern %q", r.Name, cfg.Model)
+	}
+	switch r.dialect {
+	case "", DialectOpenAI, DialectOllama:
+	default:
+		return nil, fmt.Errorf("rule %s: unknown dialect %q (use openai or ollama)", r.Name, cfg.Dialect)
+	}
+	if len(cfg.Set) == 0 && len(cfg.Delete) == 0 && len(cfg.Rename) == 0 {
+		return nil, fmt.Errorf("rule %s: set, delete or rename is required", r.Name)
+	}
+
+	r.headers = make(map[string]string, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = value
+	}
+
+	for from, to := range cfg.Rename {
+		if !validPath(from) || !validPath(to) {
+			return nil, fmt.Errorf("rule %s: invalid rename %q -> %q", r.Name, from, to)
+		}
+		r.renames = append(r.renames, [2]string{from, to})
+	}
+	sort.Slice(r.renames, func(i, j int) bool { return r.renames[i][0] < r.renames[j][0] })
+
+	for _, field := range cfg.Delete {
+		if !validPath(field) {
+			return nil, fmt.Errorf("rule %s: invalid delete path %q", r.Name, field)
+		}
+		r.deletes = append(r.deletes, strings.Split(field, "."))
+	}
+
+	for field, value := range cfg.Set {
+		if !validPath(field) {
+			return nil, fmt.Errorf("rule %s: invalid set path %q", r.Name, field)
+		}
+		r.sets = append(r.sets, setOp{path: strings.Split(field, "."), value: value})
+	}
+	sort.Slice(r.sets, func(i, j int) bool {
+		return strings.Join(r.sets[i].path, ".") < strings.Join(r.sets[j].path, ".")
+	})
+
+	return r, nil
+}
+
+// CompileAll compiles rule definitions in order
+func CompileAll(cfgs []config.RewriteRule) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		r, err := Compile(cfg)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Matches reports whether the rule applies to a request for the canonical model in the given
+// dialect with the given headers
+func (r *Rule) Matches(model, dialect string, h http.Header) bool {
+	if r.model != "" {
+		if ok, _ := path.Match(r.model, strings.ToLower(model)); !ok {
+			return false
+		}
+	}
+	if r.dialect != "" && r.dialect != dialect {
+		return false
+	}
+	for name, want := range r.headers {
+		got := h.Get(name)
+		if got == "" || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply edits the body: renames first, then deletes, then sets. Paths are dot-separated
+// fields of nested objects; missing objects are created by sets and skipped otherwise.
+func (r *Rule) Apply(body map[string]any) {
+	for _, rn := range r.renames {
+		from, to := strings.Split(rn[0], "."), strings.Split(rn[1], ".")
+		if v, ok := lookup(body, from); ok {
+			remove(body, from)
+			assign(body, to, v)
+		}
+	}
+	for _, p := range r.deletes {
+		remove(body, p)
+	}
+	for _, op := range r.sets {
+		assign(body, op.path, op.value)
+	}
+}
+
+// validPath reports whether a dotted path has no empty segments
+func validPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, seg := range strings.Split(p, ".") {
+		if seg == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parent returns the object holding the last path segment, creating objects when create is set
+func parent(body map[string]any, p []string, create bool) (map[string]any, bool) {
+	obj := body
+	for _, seg := range p[:len(p)-1] {
+		next, ok := obj[seg].(map[string]any)
+		if !ok {
+			if !create {
+				return nil, false
+			}
+			next = make(map[string]any)
+			obj[seg] = next
+		}
+		obj = next
+	}
+	return obj, true
+}
+
+func lookup(body map[string]any, p []string) (any, bool) {
+	obj, ok := parent(body, p, false)
+	if !ok {
+		return nil, false
+	}
+	v, ok := obj[p[len(p)-1]]
+	return v, ok
+}
+
+func remove(body map[string]any, p []string) {
+	if obj, ok := parent(body, p, false); ok {
+		delete(obj, p[len(p)-1])
+	}
+}
+
+func assign(body map[string]any, p []string, v any) {
+	obj, _ := parent(body, p, true)
+	obj[p[len(p)-1]] = v
+}
@@ -0,0 +1,99 @@
+package rewrite
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+func TestApply(t *testing.T) {
+	r, err := Compile(config.RewriteRule{
+		Rename: map[string]string{"max_completion_tokens": "max_tokens", "options.seed": "seed"},
+		Delete: []string{"logit_bias", "missing.field"},
+		Set:    map[string]any{"thinking.type": "disabled", "user": "proxy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := map[string]any{
+		"model":                 "glm-4.7",
+		"max_completion_tokens": 100.0,
+		"logit_bias":            map[string]any{"1": 2.0},
+		"options":               map[string]any{"seed": 7.0, "top_k": 40.0},
+		"thinking":              map[string]any{"type": "enabled"},
+	}
+	r.Apply(body)
+
+	want := map[string]any{
+		"model":      "glm-4.7",
+		"max_tokens": 100.0,
+		"seed":       7.0,
+		"options":    map[string]any{"top_k": 40.0},
+		"thinking":   map[string]any{"type": "disabled"},
+		"user":       "proxy",
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("Apply() =\n%v\nwant\n%v", body, want)
+	}
+
+	// Sets create missing objects
+	body = map[string]any{}
+	r.Apply(body)
+	if got := body["thinking"]; !reflect.DeepEqual(got, map[string]any{"type": "disabled"}) {
+		t.Errorf("thinking = %v", got)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	r, err := Compile(config.RewriteRule{
+		Model:   "glm-4.7*",
+		Dialect: DialectOllama,
+		Headers: map[string]string{"x-client": "legacy", "X-Beta": "*"},
+		Delete:  []string{"tools"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := http.Header{"X-Client": {"legacy"}, "X-Beta": {"1"}}
+	tests := []struct {
+		name    string
+		model   string
+		dialect string
+		headers http.Header
+		want    bool
+	}{
+		{"All match", "glm-4.7-flash", DialectOllama, headers, true},
+		{"Model case", "GLM-4.7", DialectOllama, headers, true},
+		{"Other model", "glm-4.6v", DialectOllama, headers, false},
+		{"Other dialect", "glm-4.7", DialectOpenAI, headers, false},
+		{"Header value", "glm-4.7", DialectOllama, http.Header{"X-Client": {"new"}, "X-Beta": {"1"}}, false},
+		{"Header missing", "glm-4.7", DialectOllama, http.Header{"X-Client": {"legacy"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Matches(tt.model, tt.dialect, tt.headers); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := map[string]config.RewriteRule{
+		"No edits":      {Model: "glm-4.7"},
+		"Bad pattern":   {Model: "glm-[", Delete: []string{"x"}},
+		"Bad dialect":   {Dialect: "anthropic", Delete: []string{"x"}},
+		"Empty path":    {Delete: []string{""}},
+		"Empty segment": {Set: map[string]any{"a..b": 1}},
+		"Bad rename":    {Rename: map[string]string{"a": ""}},
+	}
+	for name, cfg := range tests {
+		if _, err := Compile(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package s3 uploads objects to S3-compatible storage using AWS Signature Version 4
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/signing"
+)
+
+// Client puts objects into one bucket, addressed path-style (endpoint/bucket/key) so it also
+// works with MinIO, R2 and other S3-compatible services
+type Client struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	HTTP *http.Client
+}
+
+// Put uploads body as the object at key
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	u := strings.TrimSuffix(c.Endpoint, "/") + "/" + signing.EscapePath(c.Bucket+"/"+strings.TrimPrefix(key, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	sign(req, body, c.Region, c.AccessKey, c.SecretKey, time.Now())
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload %s: status %d: %s", key, resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// sign adds SigV4 authentication for the request's headers and payload
+func sign(req *http.Request, payload []byte, region, accessKey, secretKey string, now time.Time) {
+	signing.V4{Region: region, Service: "s3", AccessKey: accessKey, SecretKey: secretKey}.Sign(req, payload, now)
+}
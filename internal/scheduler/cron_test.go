@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseSchedule_Invalid tests that malformed expressions are rejected
+func TestParseSchedule_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@sometimes",
+	}
+
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseSchedule(spec); err == nil {
+				t.Errorf("ParseSchedule(%q) expected error", spec)
+			}
+		})
+	}
+}
+
+// TestScheduleNext tests next activation times for common expressions
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	base := time.Date(2026, 1, 14, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 14, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 14, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2026, 1, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 1, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * 5", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)}, // day-of-month OR day-of-week
+		{"@hourly", time.Date(2026, 1, 14, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", tt.spec, err)
+			}
+			if got := s.Next(base); !got.Equal(tt.expected) {
+				t.Errorf("Next(%q) = %v, want %v", tt.spec, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestScheduleNext_Never tests that impossible schedules return the zero time
+func TestScheduleNext_Never(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Expected zero time, got %v", got)
+	}
+}
@@ -0,0 +1,308 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+)
+
+// CompleteFunc sends a non-streaming chat completion request body upstream and returns the raw response
+type CompleteFunc func(ctx context.Context, body map[string]any) ([]byte, error)
+
+// TemplateData is available to job prompt and output_file templates
+type TemplateData struct {
+	Name  string    // Job name
+	Model string    // Model the job runs against
+	Now   time.Time // Scheduled run time
+	Date  string    // Run date as YYYY-MM-DD
+}
+
+// job is a validated, parsed JobConfig
+type job struct {
+	cfg      config.JobConfig
+	schedule *Schedule
+	prompt   *template.Template
+	output   *template.Template
+}
+
+// Scheduler runs configured prompt jobs on their cron schedules
+type Scheduler struct {
+	jobs     []*job
+	complete CompleteFunc
+	client   *http.Client // Used for webhook delivery
+	clock    clock.Clock
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New validates the job definitions and creates a scheduler that is not yet running
+func New(jobs []config.JobConfig, complete CompleteFunc) (*Scheduler, error) {
+	s := &Scheduler{
+		complete: complete,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		clock:    clock.Real{},
+	}
+
+	seen := make(map[string]bool)
+	for i, cfg := range jobs {
+		j, err := parseJob(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i, err)
+		}
+		if seen[cfg.Name] {
+			return nil, fmt.Errorf("job %d: duplicate name %q", i, cfg.Name)
+		}
+		seen[cfg.Name] = true
+		s.jobs = append(s.jobs, j)
+	}
+
+	return s, nil
+}
+
+// parseJob validates a single job definition
+func parseJob(cfg config.JobConfig) (*job, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if cfg.Prompt == "" {
+		return nil, fmt.Errorf("%s: prompt is required", cfg.Name)
+	}
+	if !models.IsValidModel(cfg.Model) {
+		return nil, fmt.Errorf("%s: model '%s' not found", cfg.Name, cfg.Model)
+	}
+	if cfg.OutputFile == "" && cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("%s: output_file or webhook_url is required", cfg.Name)
+	}
+
+	schedule, err := ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Name, err)
+	}
+
+	prompt, err := template.New(cfg.Name).Parse(cfg.Prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid prompt template: %w", cfg.Name, err)
+	}
+
+	j := &job{cfg: cfg, schedule: schedule, prompt: prompt}
+	if cfg.OutputFile != "" {
+		if j.output, err = template.New(cfg.Name + "_output").Parse(cfg.OutputFile); err != nil {
+			return nil, fmt.Errorf("%s: invalid output_file template: %w", cfg.Name, err)
+		}
+	}
+
+	return j, nil
+}
+
+// Start launches one goroutine per job; it returns immediately
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+	slog.Info("Scheduler started", "jobs", len(s.jobs))
+}
+
+// Stop cancels pending and in-flight runs and waits for job goroutines to exit
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// loop waits for each activation of a job and runs it; runs never overlap
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(s.clock.Now())
+		if next.IsZero() {
+			slog.Warn("Job schedule never fires", "job", j.cfg.Name, "schedule", j.cfg.Schedule)
+			return
+		}
+
+		timer := s.clock.NewTimer(s.clock.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		if err := s.run(ctx, j, next); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			slog.Error("Scheduled job failed", "job", j.cfg.Name, "error", err)
+		}
+	}
+}
+
+// run executes one activation of a job and delivers its output
+func (s *Scheduler) run(ctx context.Context, j *job, at time.Time) error {
+	data := TemplateData{
+		Name:  j.cfg.Name,
+		Model: j.cfg.Model,
+		Now:   at,
+		Date:  at.Format("2006-01-02"),
+	}
+
+	var prompt strings.Builder
+	if err := j.prompt.Execute(&prompt, data); err != nil {
+		return fmt.Errorf("failed to render prompt: %w", err)
+	}
+
+	output, err := s.completeWithRetry(ctx, j, prompt.String())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Scheduled job completed", "job", j.cfg.Name, "bytes", len(output))
+
+	if j.output != nil {
+		if err := writeOutput(j, data, output); err != nil {
+			return err
+		}
+	}
+	if j.cfg.WebhookURL != "" {
+		if err := s.postWebhook(ctx, j, data, output); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// completeWithRetry sends the prompt, retrying network errors, 429 and 5xx responses with backoff
+func (s *Scheduler) completeWithRetry(ctx context.Context, j *job, prompt string) (string, error) {
+	messages := []map[string]any{}
+	if j.cfg.System != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": j.cfg.System})
+	}
+	messages = append(messages, map[string]any{"role": "user", "content": prompt})
+
+	var lastErr error
+	for attempt := 0; attempt <= j.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-s.clock.After(backoff):
+			}
+		}
+
+		body := map[string]any{
+			"model":    j.cfg.Model,
+			"messages": messages,
+			"stream":   false,
+		}
+		raw, err := s.complete(ctx, body)
+		if err == nil {
+			return extractContent(raw)
+		}
+		lastErr = err
+
+		var se *api.StatusError
+		if errors.As(err, &se) && se.StatusCode < 500 && se.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		slog.Warn("Scheduled job attempt failed", "job", j.cfg.Name, "attempt", attempt+1, "error", err)
+	}
+
+	return "", lastErr
+}
+
+// extractContent pulls the assistant message text out of a chat completion response
+func extractContent(raw []byte) (string, error) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse upstream response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("upstream response has no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// writeOutput appends a run's output to the job's (templated) output file
+func writeOutput(j *job, data TemplateData, output string) error {
+	var path strings.Builder
+	if err := j.output.Execute(&path, data); err != nil {
+		return fmt.Errorf("failed to render output path: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path.String()), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path.String(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "## %s %s\n\n%s\n\n", data.Name, data.Now.Format(time.RFC3339), output); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// postWebhook delivers a run's output as JSON to the job's webhook URL
+func (s *Scheduler) postWebhook(ctx context.Context, j *job, data TemplateData, output string) error {
+	payload, err := json.Marshal(map[string]any{
+		"job":    data.Name,
+		"model":  data.Model,
+		"ran_at": data.Now.Format(time.RFC3339),
+		"output": output,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", j.cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
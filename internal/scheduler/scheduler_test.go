@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func completionResponse(content string) []byte {
+	return []byte(`{"choices":[{"message":{"role":"assistant","content":"` + content + `"}}]}`)
+}
+
+func TestNew_Validation(t *testing.T) {
+	valid := config.JobConfig{
+		Name:       "daily",
+		Schedule:   "@daily",
+		Model:      "GLM-4.7",
+		Prompt:     "hello",
+		OutputFile: "out.md",
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(j *config.JobConfig)
+		wantErr string
+	}{
+		{"Valid", func(j *config.JobConfig) {}, ""},
+		{"Missing Name", func(j *config.JobConfig) { j.Name = "" }, "name is required"},
+		{"Missing Prompt", func(j *config.JobConfig) { j.Prompt = "" }, "prompt is required"},
+		{"Unknown Model", func(j *config.JobConfig) { j.Model = "gpt-4" }, "model 'gpt-4' not found"},
+		{"No Output", func(j *config.JobConfig) { j.OutputFile = "" }, "output_file or webhook_url is required"},
+		{"Bad Schedule", func(j *config.JobConfig) { j.Schedule = "every day" }, "invalid cron expression"},
+		{"Bad Template", func(j *config.JobConfig) { j.Prompt = "{{.Date" }, "invalid prompt template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := valid
+			tt.mutate(&job)
+			_, err := New([]config.JobConfig{job}, nil)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := New([]config.JobConfig{valid, valid}, nil)
+	assert.ErrorContains(t, err, "duplicate name")
+}
+
+func TestRun_WritesOutputAndWebhook(t *testing.T) {
+	dir := t.TempDir()
+
+	var webhookBody map[string]any
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&webhookBody)
+	}))
+	defer webhook.Close()
+
+	var sentBody map[string]any
+	complete := func(ctx context.Context, body map[string]any) ([]byte, error) {
+		sentBody = body
+		return completionResponse("All good"), nil
+	}
+
+	s, err := New([]config.JobConfig{{
+		Name:       "report",
+		Schedule:   "@daily",
+		Model:      "GLM-4.7-Flash",
+		System:     "Be brief",
+		Prompt:     "Summarize {{.Date}}",
+		OutputFile: filepath.Join(dir, "{{.Name}}-{{.Date}}.md"),
+		WebhookURL: webhook.URL,
+	}}, complete)
+	require.NoError(t, err)
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, s.run(context.Background(), s.jobs[0], at))
+
+	messages := sentBody["messages"].([]map[string]any)
+	assert.Equal(t, "system", messages[0]["role"])
+	assert.Equal(t, "Summarize 2026-03-02", messages[1]["content"])
+
+	data, err := os.ReadFile(filepath.Join(dir, "report-2026-03-02.md"))
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), "All good"))
+
+	assert.Equal(t, "report", webhookBody["job"])
+	assert.Equal(t, "All good", webhookBody["output"])
+}
+
+func TestCompleteWithRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"Retries Server Errors", []error{api.ErrBadGateway("down"), nil}, 2, false},
+		{"Gives Up After Retries", []error{api.ErrBadGateway("down"), api.ErrBadGateway("down")}, 2, true},
+		{"No Retry On Client Error", []error{api.ErrBadRequest("bad")}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			complete := func(ctx context.Context, body map[string]any) ([]byte, error) {
+				err := tt.errs[calls]
+				calls++
+				if err != nil {
+					return nil, err
+				}
+				return completionResponse("ok"), nil
+			}
+			s, err := New([]config.JobConfig{{
+				Name: "retry", Schedule: "@hourly", Model: "GLM-4.7", Prompt: "p", WebhookURL: "http://example.invalid", Retries: 1,
+			}}, complete)
+			require.NoError(t, err)
+			clk := clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+			s.clock = clk
+
+			type result struct {
+				out string
+				err error
+			}
+			done := make(chan result)
+			go func() {
+				out, err := s.completeWithRetry(context.Background(), s.jobs[0], "p")
+				done <- result{out, err}
+			}()
+			// Each retry waits for its backoff
+			for i := 1; i < tt.wantCalls; i++ {
+				clk.BlockUntil(1)
+				clk.Advance(time.Second << (i - 1))
+			}
+			res := <-done
+			out, err := res.out, res.err
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "ok", out)
+			}
+		})
+	}
+}
+
+func TestLoop_RunsOnSchedule(t *testing.T) {
+	runs := make(chan string)
+	complete := func(ctx context.Context, body map[string]any) ([]byte, error) {
+		messages := body["messages"].([]map[string]any)
+		runs <- messages[len(messages)-1]["content"].(string)
+		return completionResponse("ok"), nil
+	}
+	s, err := New([]config.JobConfig{{
+		Name: "hourly", Schedule: "@hourly", Model: "GLM-4.7", Prompt: "{{.Now.Format \"15:04\"}}", WebhookURL: "http://127.0.0.1:1",
+	}}, complete)
+	require.NoError(t, err)
+	clk := clock.NewFake(time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC))
+	s.clock = clk
+	s.Start()
+	defer s.Stop()
+
+	// Nothing runs before the next activation
+	clk.BlockUntil(1)
+	clk.Advance(29 * time.Minute)
+	select {
+	case prompt := <-runs:
+		t.Fatalf("job ran early with %q", prompt)
+	default:
+	}
+
+	clk.Advance(time.Minute)
+	select {
+	case prompt := <-runs:
+		assert.Equal(t, "10:00", prompt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run at its activation")
+	}
+}
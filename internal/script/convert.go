@@ -0,0 +1,127 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxDepth bounds the nesting converted from Lua, which also catches cyclic tables
+const maxDepth = 64
+
+// toLua converts a decoded JSON value to Lua. Arrays are marked so they convert back as
+// arrays even when emptied; null becomes proxy.null.
+func (st *state) toLua(v any) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return st.null
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case string:
+		return lua.LString(v)
+	case []any:
+		t := st.L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(st.toLua(item))
+		}
+		st.L.SetMetatable(t, st.arrayMT)
+		return t
+	case map[string]any:
+		t := st.L.CreateTable(0, len(v))
+		for k, item := range v {
+			t.RawSetString(k, st.toLua(item))
+		}
+		return t
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua converts a Lua value to its JSON counterpart. Tables marked as arrays, or whose keys
+// are exactly 1..n, become arrays; other tables become objects.
+func (st *state) fromLua(v lua.LValue, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("value nested too deeply")
+	}
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("number is not finite")
+		}
+		return f, nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LUserData:
+		if v == st.null {
+			return nil, nil
+		}
+	case *lua.LTable:
+		return st.tableFromLua(v, depth)
+	}
+	return nil, fmt.Errorf("cannot convert %s to JSON", v.Type())
+}
+
+// tableFromLua converts a table to an array or an object
+func (st *state) tableFromLua(t *lua.LTable, depth int) (any, error) {
+	n := t.MaxN()
+	keys := 0
+	t.ForEach(func(lua.LValue, lua.LValue) { keys++ })
+
+	if st.L.GetMetatable(t) == st.arrayMT || (n > 0 && keys == n) {
+		arr := make([]any, 0, n)
+		for i := 1; i <= n; i++ {
+			item, err := st.fromLua(t.RawGetInt(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	}
+
+	obj := make(map[string]any, keys)
+	var err error
+	t.ForEach(func(k, item lua.LValue) {
+		if err != nil {
+			return
+		}
+		var converted any
+		if converted, err = st.fromLua(item, depth+1); err == nil {
+			obj[lua.LVAsString(k)] = converted
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// marshal encodes a converted value as JSON
+func marshal(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// unmarshal decodes JSON text
+func unmarshal(s string) (any, error) {
+	var v any
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
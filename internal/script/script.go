@@ -0,0 +1,462 @@
+// Package script runs Lua hooks that inspect and edit chat requests and responses, a lighter
+// alternative to WebAssembly plugins for quick customizations.
+//
+// A script defines the global functions on_request(req) and/or on_response(res).
+// on_request receives a table {model, dialect, client, headers, body}. It may edit req.body in
+// place or return a replacement body table. on_response receives {model, stream, chunk} for each
+// streamed chunk, or once for a whole response. It may edit res.chunk in place, return a
+// replacement table, or return false to drop the chunk.
+//
+// Scripts see a global "proxy" table:
+//
+//	proxy.log(...)                              write to the proxy log
+//	proxy.json_encode(v), proxy.json_decode(s)  JSON conversion
+//	proxy.null                                  the JSON null value
+//	proxy.array(t)                              mark t as a JSON array, e.g. proxy.array({})
+//	proxy.reject(status, message)               stop and reject the request (on_request only)
+//	proxy.set_header(name, value)               set an upstream request header (on_request only)
+//	proxy.set_response_header(name, value)      set a client response header (on_request only)
+//
+// Scripts run with the base, string, table and math libraries only: no io, os, require or
+// loading of other code, and a deadline per call.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Defaults for unset limits
+const (
+	defaultTimeout = 100 * time.Millisecond
+	defaultStates  = 4
+)
+
+// RequestEvent is passed to on_request before a chat request is sent upstream
+type RequestEvent struct {
+	Model   string
+	Dialect string // openai or ollama
+	Client  string
+	Headers map[string]string
+	Body    map[string]any // The upstream request body
+}
+
+// RequestResult is the outcome of on_request: the resulting body and headers to set, or an
+// error rejecting the request
+type RequestResult struct {
+	Body            map[string]any
+	Headers         http.Header // Upstream request headers
+	ResponseHeaders http.Header // Client response headers
+	Error           *Rejection
+}
+
+// Rejection is a script's refusal of a request
+type Rejection struct {
+	Status  int // Defaults to 400
+	Message string
+}
+
+// ResponseEvent is passed to on_response for each streamed chunk, or once for a whole response
+type ResponseEvent struct {
+	Model  string
+	Stream bool
+	Chunk  map[string]any
+}
+
+// ResponseResult is the outcome of on_response: the resulting chunk, or drop to suppress it
+type ResponseResult struct {
+	Chunk map[string]any
+	Drop  bool
+}
+
+// Script is a compiled Lua file with a pool of interpreter states, so concurrent requests do
+// not wait on each other
+type Script struct {
+	Name       string
+	FailClosed bool // Reject requests when on_request fails instead of forwarding them unchanged
+
+	proto       *lua.FunctionProto
+	timeout     time.Duration
+	hasRequest  bool
+	hasResponse bool
+
+	idle    chan *state
+	created atomic.Int32
+	max     int32
+
+	mu     sync.Mutex // orders release against Close
+	closed bool
+	done   chan struct{} // closed by Close to wake waiting callers
+}
+
+// errClosed is returned to calls that start after Close
+var errClosed = errors.New("script closed")
+
+// state is an interpreter with the script loaded. call holds the headers set by the hook
+// currently running; it is nil outside on_request. A broken state failed mid-call and is not
+// reused.
+type state struct {
+	L       *lua.LState
+	arrayMT *lua.LTable
+	null    *lua.LUserData
+	call    *RequestResult
+	broken  bool
+}
+
+// Load compiles a script, runs its top level and checks it defines a hook
+func Load(cfg config.ScriptConfig) (*Script, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Path
+	}
+	src, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	chunk, err := parse.Parse(strings.NewReader(string(src)), cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	proto, err := lua.Compile(chunk, cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+
+	s := &Script{Name: name, FailClosed: cfg.FailClosed, proto: proto, timeout: cfg.Timeout}
+	if s.timeout <= 0 {
+		s.timeout = defaultTimeout
+	}
+	s.max = int32(cfg.States)
+	if s.max <= 0 {
+		s.max = defaultStates
+	}
+	s.idle = make(chan *state, s.max)
+	s.done = make(chan struct{})
+
+	// Load once now so errors surface at start-up
+	st, err := s.newState(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	_, s.hasRequest = st.L.GetGlobal("on_request").(*lua.LFunction)
+	_, s.hasResponse = st.L.GetGlobal("on_response").(*lua.LFunction)
+	if !s.hasRequest && !s.hasResponse {
+		st.L.Close()
+		return nil, fmt.Errorf("script %s: defines neither on_request nor on_response", name)
+	}
+	s.created.Add(1)
+	s.idle <- st
+	return s, nil
+}
+
+// HasRequestHook reports whether the script defines on_request
+func (s *Script) HasRequestHook() bool { return s.hasRequest }
+
+// HasResponseHook reports whether the script defines on_response
+func (s *Script) HasResponseHook() bool { return s.hasResponse }
+
+// OnRequest runs the on_request hook
+func (s *Script) OnRequest(ctx context.Context, ev RequestEvent) (*RequestResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	st, err := s.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", s.Name, err)
+	}
+	defer s.release(st)
+
+	res := &RequestResult{Headers: http.Header{}, ResponseHeaders: http.Header{}}
+	st.call = res
+
+	headers := st.L.NewTable()
+	for k, v := range ev.Headers {
+		headers.RawSetString(k, lua.LString(v))
+	}
+	req := st.L.NewTable()
+	req.RawSetString("model", lua.LString(ev.Model))
+	req.RawSetString("dialect", lua.LString(ev.Dialect))
+	req.RawSetString("client", lua.LString(ev.Client))
+	req.RawSetString("headers", headers)
+	req.RawSetString("body", st.toLua(ev.Body))
+
+	ret, err := s.run(ctx, st, "on_request", req)
+	if err != nil {
+		var rej *Rejection
+		if errors.As(err, &rej) {
+			res.Error = rej
+			return res, nil
+		}
+		return nil, err
+	}
+
+	body := req.RawGetString("body")
+	if tbl, ok := ret.(*lua.LTable); ok {
+		body = tbl
+	}
+	converted, err := st.fromLua(body, 0)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: on_request: body: %w", s.Name, err)
+	}
+	obj, ok := converted.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("script %s: on_request: body is not an object", s.Name)
+	}
+	res.Body = obj
+	return res, nil
+}
+
+// OnResponse runs the on_response hook
+func (s *Script) OnResponse(ctx context.Context, ev ResponseEvent) (*ResponseResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	st, err := s.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", s.Name, err)
+	}
+	defer s.release(st)
+
+	res := st.L.NewTable()
+	res.RawSetString("model", lua.LString(ev.Model))
+	res.RawSetString("stream", lua.LBool(ev.Stream))
+	res.RawSetString("chunk", st.toLua(ev.Chunk))
+
+	ret, err := s.run(ctx, st, "on_response", res)
+	if err != nil {
+		return nil, err
+	}
+	if ret == lua.LFalse {
+		return &ResponseResult{Drop: true}, nil
+	}
+
+	chunk := res.RawGetString("chunk")
+	if tbl, ok := ret.(*lua.LTable); ok {
+		chunk = tbl
+	}
+	converted, err := st.fromLua(chunk, 0)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: on_response: chunk: %w", s.Name, err)
+	}
+	obj, ok := converted.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("script %s: on_response: chunk is not an object", s.Name)
+	}
+	return &ResponseResult{Chunk: obj}, nil
+}
+
+// Close releases the idle interpreter states; states in use are closed when their call
+// returns, and calls started afterwards fail
+func (s *Script) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	for {
+		select {
+		case st := <-s.idle:
+			st.L.Close()
+		default:
+			return
+		}
+	}
+}
+
+// run calls a hook with one argument under the deadline and returns its first result. A
+// failed call may leave the state inconsistent, so it is marked broken.
+func (s *Script) run(ctx context.Context, st *state, hook string, arg lua.LValue) (lua.LValue, error) {
+	st.L.SetContext(ctx)
+	err := st.L.CallByParam(lua.P{Fn: st.L.GetGlobal(hook), NRet: 1, Protect: true}, arg)
+	st.L.RemoveContext()
+
+	if err != nil {
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			if ud, ok := apiErr.Object.(*lua.LUserData); ok {
+				if rej, ok := ud.Value.(*Rejection); ok {
+					st.L.SetTop(0)
+					return nil, rej
+				}
+			}
+		}
+		st.broken = true
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("script %s: %s: %w", s.Name, hook, err)
+	}
+
+	ret := st.L.Get(-1)
+	st.L.Pop(1)
+	return ret, nil
+}
+
+// Error implements error so a rejection can unwind through run
+func (r *Rejection) Error() string { return r.Message }
+
+// newState creates an interpreter, installs the proxy API and runs the script's top level
+func (s *Script) newState(ctx context.Context) (*state, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 200, RegistryMaxSize: 1 << 20})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	st := &state{L: L, arrayMT: L.NewTable(), null: L.NewUserData()}
+	st.installAPI(s.Name)
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(s.proto))
+	err := L.PCall(0, 0, nil)
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// installAPI sets the global proxy table
+func (st *state) installAPI(name string) {
+	L := st.L
+	api := L.NewTable()
+	api.RawSetString("null", st.null)
+
+	L.SetFuncs(api, map[string]lua.LGFunction{
+		"log": func(L *lua.LState) int {
+			parts := make([]string, L.GetTop())
+			for i := range parts {
+				parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+			}
+			slog.Info("Script log", "script", name, "message", strings.Join(parts, " "))
+			return 0
+		},
+		"json_encode": func(L *lua.LState) int {
+			v, err := st.fromLua(L.Get(1), 0)
+			if err != nil {
+				L.RaiseError("json_encode: %v", err)
+			}
+			data, err := marshal(v)
+			if err != nil {
+				L.RaiseError("json_encode: %v", err)
+			}
+			L.Push(lua.LString(data))
+			return 1
+		},
+		"json_decode": func(L *lua.LState) int {
+			v, err := unmarshal(L.CheckString(1))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(st.toLua(v))
+			return 1
+		},
+		"array": func(L *lua.LState) int {
+			t := L.OptTable(1, L.NewTable())
+			L.SetMetatable(t, st.arrayMT)
+			L.Push(t)
+			return 1
+		},
+		"reject": func(L *lua.LState) int {
+			rej := &Rejection{Status: L.OptInt(1, http.StatusBadRequest), Message: L.OptString(2, "")}
+			ud := L.NewUserData()
+			ud.Value = rej
+			L.Error(ud, 0)
+			return 0
+		},
+		"set_header": func(L *lua.LState) int {
+			if st.call == nil {
+				L.RaiseError("set_header is only available in on_request")
+			}
+			st.call.Headers.Set(L.CheckString(1), L.CheckString(2))
+			return 0
+		},
+		"set_response_header": func(L *lua.LState) int {
+			if st.call == nil {
+				L.RaiseError("set_response_header is only available in on_request")
+			}
+			st.call.ResponseHeaders.Set(L.CheckString(1), L.CheckString(2))
+			return 0
+		},
+	})
+	L.SetGlobal("proxy", api)
+}
+
+// acquire takes an idle state, creates one while under the pool size, or waits
+func (s *Script) acquire(ctx context.Context) (*state, error) {
+	select {
+	case <-s.done:
+		return nil, errClosed
+	case st := <-s.idle:
+		return st, nil
+	default:
+	}
+	if s.created.Add(1) <= s.max {
+		st, err := s.newState(ctx)
+		if err != nil {
+			s.created.Add(-1)
+		}
+		return st, err
+	}
+	s.created.Add(-1)
+
+	select {
+	case <-s.done:
+		return nil, errClosed
+	case st := <-s.idle:
+		return st, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns a state to the pool, closing broken ones and any released after Close
+func (s *Script) release(st *state) {
+	st.call = nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.broken || s.closed {
+		s.discard(st)
+		return
+	}
+	select {
+	case s.idle <- st:
+	default:
+		s.discard(st)
+	}
+}
+
+// discard closes a state that will not be reused
+func (s *Script) discard(st *state) {
+	st.L.Close()
+	s.created.Add(-1)
+}
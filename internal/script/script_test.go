@@ -0,0 +1,190 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+const testScript = `
+function on_request(req)
+  if req.headers["X-Block"] then
+    proxy.reject(403, "blocked for " .. req.client)
+  end
+  if req.dialect == "ollama" then
+    return { model = req.model, replaced = true }
+  end
+  req.body.temperature = 0.1
+  req.body.stop = proxy.array({})
+  req.body.metadata = proxy.json_decode('{"tags":["a","b"],"none":null}')
+  proxy.set_header("X-Script", "yes")
+  proxy.set_response_header("X-Seen", req.model)
+  proxy.log("rewrote", req.model)
+end
+
+function on_response(res)
+  local choice = res.chunk.choices and res.chunk.choices[1]
+  local msg = choice and (choice.delta or choice.message)
+  if msg and msg.content == "DROP" then
+    return false
+  end
+  if msg and msg.content then
+    msg.content = string.gsub(msg.content, "secret", "[redacted]")
+  end
+end
+`
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScript(t *testing.T) {
+	s, err := Load(config.ScriptConfig{Name: "test", Path: writeScript(t, testScript), States: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.HasRequestHook() || !s.HasResponseHook() {
+		t.Fatal("hooks not detected")
+	}
+	ctx := context.Background()
+
+	res, err := s.OnRequest(ctx, RequestEvent{
+		Model:   "glm-4.7",
+		Dialect: "openai",
+		Headers: map[string]string{"User-Agent": "test"},
+		Body:    map[string]any{"model": "glm-4.7", "messages": []any{map[string]any{"role": "user", "content": "hi"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"model":       "glm-4.7",
+		"messages":    []any{map[string]any{"role": "user", "content": "hi"}},
+		"temperature": 0.1,
+		"stop":        []any{},
+		"metadata":    map[string]any{"tags": []any{"a", "b"}, "none": nil},
+	}
+	if !reflect.DeepEqual(res.Body, want) {
+		t.Errorf("body = %#v", res.Body)
+	}
+	if res.Headers.Get("X-Script") != "yes" || res.ResponseHeaders.Get("X-Seen") != "glm-4.7" {
+		t.Errorf("headers = %v, response headers = %v", res.Headers, res.ResponseHeaders)
+	}
+
+	res, err = s.OnRequest(ctx, RequestEvent{Model: "glm-4.7", Dialect: "ollama", Body: map[string]any{"model": "glm-4.7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Body, map[string]any{"model": "glm-4.7", "replaced": true}) {
+		t.Errorf("replaced body = %#v", res.Body)
+	}
+
+	res, err = s.OnRequest(ctx, RequestEvent{Client: "alice", Headers: map[string]string{"X-Block": "1"}, Body: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error == nil || res.Error.Status != 403 || res.Error.Message != "blocked for alice" {
+		t.Errorf("rejection = %+v", res.Error)
+	}
+
+	chunk := map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": "a secret"}}}}
+	out, err := s.OnResponse(ctx, ResponseEvent{Model: "glm-4.7", Stream: true, Chunk: chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)["content"]; got != "a [redacted]" {
+		t.Errorf("content = %v", got)
+	}
+
+	out, err = s.OnResponse(ctx, ResponseEvent{Chunk: map[string]any{"choices": []any{map[string]any{"message": map[string]any{"content": "DROP"}}}}})
+	if err != nil || !out.Drop {
+		t.Errorf("drop = %+v, %v", out, err)
+	}
+}
+
+func TestScript_Failures(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := Load(config.ScriptConfig{Path: writeScript(t, `
+function on_request(req)
+  if req.model == "loop" then
+    while true do end
+  end
+  if req.model == "error" then
+    error("boom")
+  end
+  if req.model == "func" then
+    req.body.f = print
+  end
+end`), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, model := range []string{"loop", "error", "func"} {
+		if _, err := s.OnRequest(ctx, RequestEvent{Model: model, Body: map[string]any{}}); err == nil {
+			t.Errorf("%s: expected an error", model)
+		}
+	}
+	// Broken states are replaced
+	res, err := s.OnRequest(ctx, RequestEvent{Model: "ok", Body: map[string]any{"a": 1.0}})
+	if err != nil || !reflect.DeepEqual(res.Body, map[string]any{"a": 1.0}) {
+		t.Errorf("after failures: %+v, %v", res, err)
+	}
+}
+
+func TestScript_Close(t *testing.T) {
+	ctx := context.Background()
+	s, err := Load(config.ScriptConfig{Path: writeScript(t, `function on_request(req) end`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A state busy when the script closes is closed on release instead of pooled
+	st, err := s.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s.release(st)
+	if n := s.created.Load(); n != 0 {
+		t.Errorf("%d states left open after Close", n)
+	}
+	if len(s.idle) != 0 {
+		t.Error("released state returned to the pool after Close")
+	}
+	if _, err := s.OnRequest(ctx, RequestEvent{Body: map[string]any{}}); !errors.Is(err, errClosed) {
+		t.Errorf("OnRequest after Close error = %v, want errClosed", err)
+	}
+	s.Close()
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, src := range map[string]string{
+		"syntax":   "function on_request(",
+		"no hooks": "x = 1",
+		"sandbox":  "io.write('x')",
+		"require":  "require('os')",
+	} {
+		if _, err := Load(config.ScriptConfig{Path: writeScript(t, src)}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Load(config.ScriptConfig{Path: "missing.lua"}); err == nil || !strings.Contains(err.Error(), "missing.lua") {
+		t.Errorf("missing file: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader carries the ID that cancels an in-flight chat request. Clients may choose it
+// by sending the header, so a stop button works before any response arrives.
+const requestIDHeader = "X-Proxy-Request-Id"
+
+// canceledFinishReason ends streams cancelled through the cancel endpoints
+const canceledFinishReason = "cancelled"
+
+// validRequestID limits client-chosen request IDs to what is safe in a URL path
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// activeRequest is an in-flight chat request that can be cancelled
+type activeRequest struct {
+	id      string
+	model   string
+	client  string // Authenticated client name, empty for anonymous requests
+	started time.Time
+	cancel  context.CancelFunc // Cancels the upstream request
+
+	canceled atomic.Bool
+	bytes    atomic.Int64 // Response body bytes relayed so far
+}
+
+// Write counts response body bytes as they are relayed
+func (r *activeRequest) Write(p []byte) (int, error) {
+	r.bytes.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// activeRequestInfo describes an in-flight request for the admin listing
+type activeRequestInfo struct {
+	ID        string    `json:"request_id"`
+	Model     string    `json:"model"`
+	Client    string    `json:"client,omitempty"`
+	Started   time.Time `json:"started"`
+	ElapsedMS int64     `json:"elapsed_ms"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// activeRequests tracks in-flight chat requests by ID
+type activeRequests struct {
+	mu   sync.Mutex
+	byID map[string]*activeRequest
+}
+
+// newActiveRequests creates an empty registry
+func newActiveRequests() *activeRequests {
+	return &activeRequests{byID: make(map[string]*activeRequest)}
+}
+
+// start registers a request under the client's chosen ID or a new random one, and sends the ID
+// back in the response headers. cancel must abort the upstream request.
+func (a *activeRequests) start(c *gin.Context, model string, cancel context.CancelFunc) (*activeRequest, error) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" {
+		b := make([]byte, 12)
+		_, _ = rand.Read(b)
+		id = "req_" + hex.EncodeToString(b)
+	} else if !validRequestID.MatchString(id) {
+		return nil, api.ErrBadRequest("%s must be 1-64 letters, digits, '.', '_' or '-'", requestIDHeader)
+	}
+
+	r := &activeRequest{id: id, model: model, started: time.Now(), cancel: cancel}
+	if p := principalFrom(c); p != nil {
+		r.client = p.Name
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.byID[id]; ok {
+		return nil, api.ErrConflict("request '%s' is already in progress", id)
+	}
+	a.byID[id] = r
+	c.Header(requestIDHeader, id)
+	return r, nil
+}
+
+// finish forgets a completed request
+func (a *activeRequests) finish(r *activeRequest) {
+	a.mu.Lock()
+	delete(a.byID, r.id)
+	a.mu.Unlock()
+}
+
+// list describes the in-flight requests, oldest first
+func (a *activeRequests) list(now time.Time) []activeRequestInfo {
+	a.mu.Lock()
+	infos := make([]activeRequestInfo, 0, len(a.byID))
+	for _, r := range a.byID {
+		infos = append(infos, activeRequestInfo{
+			ID:        r.id,
+			Model:     r.model,
+			Client:    r.client,
+			Started:   r.started,
+			ElapsedMS: now.Sub(r.started).Milliseconds(),
+			Bytes:     r.bytes.Load(),
+		})
+	}
+	a.mu.Unlock()
+
+	slices.SortFunc(infos, func(x, y activeRequestInfo) int { return x.Started.Compare(y.Started) })
+	return infos
+}
+
+// cancel aborts the upstream side of an in-flight request. Requests made by an authenticated
+// client can only be cancelled by that client.
+func (a *activeRequests) cancel(id, client string) error {
+	a.mu.Lock()
+	r, ok := a.byID[id]
+	a.mu.Unlock()
+	if !ok {
+		return api.ErrNotFound("no request '%s' in progress", id)
+	}
+	if r.client != "" && r.client != client {
+		return api.ErrForbidden("requests can only be cancelled by the client that made them")
+	}
+	r.canceled.Store(true)
+	r.cancel()
+	return nil
+}
+
+// handleListRequests returns the in-flight chat requests, the targets of the cancel endpoints
+func (s *Server) handleListRequests(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"requests": s.active.list(time.Now())})
+}
+
+// handleCancelRequest cancels the in-flight chat request named in the path
+func (s *Server) handleCancelRequest(c *gin.Context) {
+	s.cancelRequest(c, c.Param("request_id"))
+}
+
+// handleOllamaCancel cancels the in-flight chat request named by "request_id" in the body
+func (s *Server) handleOllamaCancel(c *gin.Context) {
+	var req struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if req.RequestID == "" {
+		handleError(c, api.ErrBadRequest("request_id is required"))
+		return
+	}
+	s.cancelRequest(c, req.RequestID)
+}
+
+// cancelRequest cancels a request on behalf of the calling client
+func (s *Server) cancelRequest(c *gin.Context, id string) {
+	client := ""
+	if p := principalFrom(c); p != nil {
+		client = p.Name
+	}
+	if err := s.active.cancel(id, client); err != nil {
+		handleError(c, err)
+		return
+	}
+	slog.Info("Request cancelled", "request_id", id, "client", client)
+	c.JSON(http.StatusOK, gin.H{"request_id": id, "status": "cancelled"})
+}
+
+// cancellationChunk ends a stream cancelled mid-generation with a final chunk carrying the
+// cancelled finish reason. The leading newline terminates any partially forwarded event.
+func cancellationChunk(id, model string) []byte {
+	chunk := map[string]any{
+		"id":      id,
+		"object":  "chat.completion.chunk",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": canceledFinishReason}},
+	}
+	data, _ := json.Marshal(chunk)
+	return fmt.Appendf(nil, "\ndata: %s\n\ndata: [DONE]\n\n", data)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelRequest(t *testing.T) {
+	upstreamDone := make(chan struct{})
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Once\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		// Generate until the proxy gives up
+		select {
+		case <-r.Context().Done():
+			close(upstreamDone)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+	proxy := httptest.NewServer(s.router)
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("POST", proxy.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "Tell a story"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, "story-1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "story-1", resp.Header.Get(requestIDHeader))
+
+	br := bufio.NewReader(resp.Body)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "Once")
+
+	// The same ID cannot be reused while the request runs
+	dup, _ := http.NewRequest("POST", proxy.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+	dup.Header.Set("Content-Type", "application/json")
+	dup.Header.Set(requestIDHeader, "story-1")
+	dupResp, err := http.DefaultClient.Do(dup)
+	require.NoError(t, err)
+	dupResp.Body.Close()
+	assert.Equal(t, http.StatusConflict, dupResp.StatusCode)
+
+	// Listed while running, with the bytes relayed so far
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/admin/requests", nil))
+	var listed struct {
+		Requests []activeRequestInfo `json:"requests"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	if assert.Len(t, listed.Requests, 1) {
+		r := listed.Requests[0]
+		assert.Equal(t, "story-1", r.ID)
+		assert.Equal(t, "glm-4.7", r.Model)
+		assert.Equal(t, int64(len(line)+1), r.Bytes)
+		assert.GreaterOrEqual(t, r.ElapsedMS, int64(0))
+	}
+
+	del, _ := http.NewRequest("DELETE", proxy.URL+"/v1/chat/completions/story-1", nil)
+	delResp, err := http.DefaultClient.Do(del)
+	require.NoError(t, err)
+	delResp.Body.Close()
+	assert.Equal(t, http.StatusOK, delResp.StatusCode)
+
+	select {
+	case <-upstreamDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request was not cancelled")
+	}
+
+	var rest strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		rest.WriteString(line)
+		if err != nil {
+			break
+		}
+	}
+	assert.Contains(t, rest.String(), `"finish_reason":"cancelled"`)
+	assert.True(t, strings.HasSuffix(rest.String(), "data: [DONE]\n\n"), rest.String())
+
+	// Finished requests are forgotten
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/admin/requests", nil))
+	assert.JSONEq(t, `{"requests": []}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/chat/completions/story-1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cancel", strings.NewReader(`{"request_id": "story-1"}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cancel", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestActiveRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newActiveRequests()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Set(principalKey, &auth.Principal{Name: "alice"})
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := a.start(c, "glm-4.7", cancel)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(r.id, "req_"))
+	assert.Equal(t, r.id, c.Writer.Header().Get(requestIDHeader))
+
+	assert.Error(t, a.cancel(r.id, "bob"), "only the owner may cancel")
+	assert.Error(t, a.cancel(r.id, ""))
+	assert.NoError(t, ctx.Err())
+	assert.NoError(t, a.cancel(r.id, "alice"))
+	assert.Error(t, ctx.Err())
+	assert.True(t, r.canceled.Load())
+
+	c.Request.Header.Set(requestIDHeader, "second")
+	second, err := a.start(c, "glm-4.7-flash", cancel)
+	require.NoError(t, err)
+	second.Write([]byte("data: x\n\n"))
+	infos := a.list(r.started.Add(time.Second))
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, r.id, infos[0].ID)
+		assert.Equal(t, "alice", infos[0].Client)
+		assert.Equal(t, "second", infos[1].ID)
+		assert.Equal(t, int64(9), infos[1].Bytes)
+	}
+
+	a.finish(r)
+	assert.Error(t, a.cancel(r.id, "alice"))
+
+	c.Request.Header.Set(requestIDHeader, "bad id/../x")
+	_, err = a.start(c, "glm-4.7", cancel)
+	assert.Error(t, err)
+}
+
+func TestCancelRequest_CORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{}, "127.0.0.1", 0)
+
+	// Browser clients may name their request and cancel it later
+	req := httptest.NewRequest("OPTIONS", "/v1/chat/completions/story-1", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	req.Header.Set("Access-Control-Request-Headers", requestIDHeader)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "DELETE")
+	assert.Contains(t, strings.ToLower(w.Header().Get("Access-Control-Allow-Headers")), strings.ToLower(requestIDHeader))
+
+	// and read the ID the proxy assigned
+	req = httptest.NewRequest("GET", "/api/version", nil)
+	req.Header.Set("Origin", "https://app.example")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Contains(t, strings.ToLower(w.Header().Get("Access-Control-Expose-Headers")), strings.ToLower(requestIDHeader))
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// adminKey is the gin context key marking requests that presented the admin token
+const adminKey = "admin"
+
+// isManagementPath reports whether a path is one of the management endpoints, which expose
+// usage across all clients
+func isManagementPath(path string) bool {
+	return path == "/metrics" || strings.HasPrefix(path, "/admin/")
+}
+
+// setupManagementRoutes registers the metrics and admin endpoints
+func (s *Server) setupManagementRoutes(r gin.IRoutes) {
+	r.GET("/metrics", s.handleMetrics)
+	r.GET("/admin/grafana-dashboard", s.handleGrafanaDashboard)
+	r.POST("/admin/upstream-key", s.handleRotateKey)
+	r.GET("/admin/canary", s.handleListCanaries)
+	r.POST("/admin/canary", s.handleSetCanary)
+	r.GET("/admin/requests", s.handleListRequests)
+	r.GET("/admin/prompts", s.handleListPrompts)
+	r.GET("/admin/stats", s.handleStats)
+	r.GET("/admin/quotas", s.handleListQuotas)
+	r.GET("/admin/cache", s.handleCacheStats)
+	r.DELETE("/admin/cache", s.handleFlushCache)
+}
+
+// newManagementServer creates the listener-only server for the management endpoints, or
+// returns nil when they are served with the API
+func newManagementServer(cfg config.AdminConfig) (*http.Server, *gin.Engine) {
+	if cfg.Listen == "" {
+		return nil, nil
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	_ = router.SetTrustedProxies(nil)
+	return &http.Server{Addr: cfg.Listen, Handler: router}, router
+}
+
+// adminMiddleware requires the admin token on the management endpoints. Client keys are not
+// accepted there, so API users cannot read other clients' usage. Without a token it guards the
+// management listener, where reaching the address is what makes a request the admin's.
+func adminMiddleware(token string, registry *metrics.Registry) gin.HandlerFunc {
+	keys := auth.NewKeys(map[string]string{"admin": token})
+	failures := registry.Counter("copilot_proxy_admin_auth_failures_total",
+		"Management requests rejected for a missing or invalid admin token")
+
+	return func(c *gin.Context) {
+		if !isManagementPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		if token == "" {
+			c.Set(adminKey, true)
+			c.Next()
+			return
+		}
+		if _, ok := keys.Lookup(auth.FromRequest(c.Request)); !ok {
+			failures.Inc()
+			slog.Warn("Admin authentication failed", "audit", "admin_auth_failure", "ip", c.ClientIP(), "path", c.Request.URL.Path)
+			handleError(c, api.ErrUnauthorized("invalid or missing admin token"))
+			c.Abort()
+			return
+		}
+		c.Set(adminKey, true)
+		c.Next()
+	}
+}
+
+// isAdmin reports whether the request came from the admin: with the admin token, or on a
+// management listener without one
+func isAdmin(c *gin.Context) bool {
+	return c.GetBool(adminKey)
+}
+
+// actorName names who made a management request in audit logs: the admin, or the
+// authenticated client
+func actorName(c *gin.Context) string {
+	if isAdmin(c) {
+		return "admin"
+	}
+	if p := principalFrom(c); p != nil {
+		return p.Name
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAdminToken serves the management endpoints on the API router in tests that use them
+const testAdminToken = "admin-secret"
+
+// adminRequest builds a management request carrying testAdminToken
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestAdmin_Token(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		Auth:  config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+		Admin: config.AdminConfig{Token: "admin-secret"},
+	}, "127.0.0.1", 0)
+	get := func(path, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Client keys no longer open the management endpoints; the admin token does
+	for _, path := range []string{"/metrics", "/admin/requests", "/admin/grafana-dashboard"} {
+		assert.Equal(t, http.StatusUnauthorized, get(path, "alice-key").Code, path)
+		assert.Equal(t, http.StatusUnauthorized, get(path, "").Code, path)
+		assert.Equal(t, http.StatusOK, get(path, "admin-secret").Code, path)
+	}
+	assert.Contains(t, get("/metrics", "admin-secret").Body.String(), "copilot_proxy_admin_auth_failures_total 6")
+
+	// The admin token is not a client key
+	assert.Equal(t, http.StatusOK, get("/v1/models", "alice-key").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/v1/models", "admin-secret").Code)
+}
+
+func TestAdmin_Listener(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		Auth:  config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+		Admin: config.AdminConfig{Listen: "127.0.0.1:0"},
+	}, "127.0.0.1", 0)
+	require.NotNil(t, s.managementRouter)
+
+	// The management endpoints are only on the management listener
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer alice-key")
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	s.managementRouter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	s.managementRouter.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdmin_Unconfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{}, "127.0.0.1", 0)
+	require.Nil(t, s.managementRouter)
+
+	// Without an admin token or listener the management endpoints are not served at all
+	for _, path := range []string{"/metrics", "/admin/requests", "/admin/stats"} {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestAdmin_Post(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, listen := range []string{"", "127.0.0.1:0"} {
+		s := NewServer(&config.Config{
+			APIKey: "old-key",
+			Auth:   config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+			Admin:  config.AdminConfig{Token: "admin-secret", Listen: listen},
+		}, "127.0.0.1", 0)
+		router := s.router
+		if s.managementRouter != nil {
+			router = s.managementRouter
+		}
+		post := func(path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer admin-secret")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		// The admin token is enough for the endpoints that change the server
+		w := post("/admin/upstream-key", `{"api_key": "new-key-123456"}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "new-key-123456", s.apiKey.get())
+
+		w = post("/admin/canary", `{"model": "glm-4.7-flash", "target": "glm-4.7", "percent": 10}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Len(t, s.canary.list(), 1)
+	}
+}
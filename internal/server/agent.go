@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/agent"
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// agentMaxStepsReason is the finish reason of an agent run cut off by max_steps
+const agentMaxStepsReason = "max_steps"
+
+// agentStep is one tool call of an agent run, or its result
+type agentStep struct {
+	Step      int    `json:"step"`
+	Type      string `json:"type"` // tool_call or tool_result
+	Tool      string `json:"tool"`
+	CallID    string `json:"call_id"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms,omitempty"`
+
+	Injection []agent.Finding `json:"injection,omitempty"` // Suspected prompt injections in the output
+}
+
+// agentToolCall is a function call in an assistant message
+type agentToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// agentTurn is the part of a chat completion the agent loop needs
+type agentTurn struct {
+	Choices []struct {
+		Message      map[string]any `json:"message"`
+		FinishReason string         `json:"finish_reason"`
+	} `json:"choices"`
+	Usage map[string]any `json:"usage"`
+}
+
+// AgentOptions converts the agent configuration into toolbox options. The serve command builds a
+// toolbox from them at startup so invalid tool declarations stop the server.
+func AgentOptions(cfg config.AgentConfig) agent.Options {
+	opts := agent.Options{
+		Fetch:        cfg.Fetch,
+		AllowPrivate: cfg.AllowPrivate,
+		Commands:     cfg.Commands,
+		SandboxDir:   cfg.SandboxDir,
+		Timeout:      cfg.Timeout,
+		MaxOutput:    cfg.MaxOutput,
+
+		Guard:         cfg.Guard.Policy,
+		GuardPatterns: cfg.Guard.Patterns,
+	}
+	for _, t := range cfg.Tools {
+		opts.Tools = append(opts.Tools, agent.Spec{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.Parameters,
+			Executor:    t.Executor,
+			Timeout:     t.Timeout,
+			Allowlist:   t.Allowlist,
+			Guard:       t.Guard,
+		})
+	}
+	return opts
+}
+
+// loadAgent creates the tools of the agent endpoint; it returns nil when the endpoint is off
+func loadAgent(cfg config.AgentConfig) *agent.Toolbox {
+	if !cfg.Enabled {
+		return nil
+	}
+	tools, err := agent.NewToolbox(AgentOptions(cfg))
+	if err != nil {
+		slog.Error("Agent endpoint disabled", "error", err)
+		return nil
+	}
+	if tools.Len() == 0 {
+		slog.Warn("Agent endpoint disabled: no tools configured")
+		return nil
+	}
+	return tools
+}
+
+// handleAgent runs a chat request in a loop where the proxy executes the model's tool calls
+// itself and sends back the results, until the model answers without calling a tool or
+// max_steps turns have passed. The answer is a chat completion with the steps taken; streaming
+// requests get each step as an "event: step" SSE event as it happens and the answer as a
+// single chunk at the end.
+func (s *Server) handleAgent(c *gin.Context) {
+	var bodyMap map[string]any
+	if err := c.ShouldBindJSON(&bodyMap); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if _, ok := bodyMap["tools"]; ok {
+		handleError(c, api.ErrBadRequest("the agent endpoint offers its own tools; remove tools from the request"))
+		return
+	}
+	if model, _ := bodyMap["model"].(string); model == "" {
+		bodyMap["model"] = s.config.Agent.Model
+	}
+	stream, _ := bodyMap["stream"].(bool)
+	delete(bodyMap, "stream")
+	delete(bodyMap, "stream_options")
+	if err := s.validateChatRequest(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// Stream headers go out with the first event, so early errors still get a status code
+	started := false
+	write := func(ev sse.Event) {
+		if !started {
+			c.Writer.Header().Set("Content-Type", "text/event-stream")
+			c.Writer.Header().Set("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		_ = sse.Write(c.Writer, ev)
+		c.Writer.Flush()
+	}
+
+	// Errors after the first event go into an error event, since the status has been sent
+	fail := func(err error) {
+		if !started {
+			handleError(c, err)
+			return
+		}
+		slog.Error("Agent run failed", "error", err)
+		data, _ := json.Marshal(map[string]any{"error": map[string]any{"message": err.Error(), "type": "server_error"}})
+		write(sse.Event{Event: "error", Data: string(data)})
+	}
+
+	steps := []agentStep{}
+	emit := func(step agentStep) {
+		steps = append(steps, step)
+		if stream {
+			data, _ := json.Marshal(step)
+			write(sse.Event{Event: "step", Data: string(data)})
+		}
+	}
+
+	ctx := c.Request.Context()
+	messages := bodyMap["messages"].([]any)
+	usage := map[string]any{}
+	maxSteps := max(s.config.Agent.MaxSteps, 1)
+	var resp map[string]any
+	var turn agentTurn
+	for step := 1; step <= maxSteps; step++ {
+		body := maps.Clone(bodyMap)
+		body["messages"] = messages
+		body["tools"] = s.agentTools.Definitions()
+		body["stream"] = false
+
+		raw, err := s.complete(ctx, principalFrom(c), body)
+		if err == nil {
+			resp, turn = nil, agentTurn{}
+			if json.Unmarshal(raw, &resp) != nil || json.Unmarshal(raw, &turn) != nil || len(turn.Choices) == 0 {
+				err = api.ErrBadGateway("Unexpected upstream response")
+			}
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		addUsage(usage, turn.Usage)
+
+		message := turn.Choices[0].Message
+		var calls []agentToolCall
+		if raw, err := json.Marshal(message["tool_calls"]); err == nil {
+			_ = json.Unmarshal(raw, &calls)
+		}
+		if len(calls) == 0 {
+			break
+		}
+		if step == maxSteps {
+			slog.Warn("Agent run stopped at max_steps", "max_steps", maxSteps)
+			turn.Choices[0].FinishReason = agentMaxStepsReason
+			break
+		}
+
+		messages = append(messages, message)
+		for _, call := range calls {
+			emit(agentStep{Step: step, Type: "tool_call", Tool: call.Function.Name, CallID: call.ID, Arguments: call.Function.Arguments})
+
+			start := time.Now()
+			res, err := s.agentTools.Call(ctx, call.Function.Name, call.Function.Arguments)
+			result := agentStep{Step: step, Type: "tool_result", Tool: call.Function.Name, CallID: call.ID, Output: res.Output,
+				ElapsedMS: time.Since(start).Milliseconds(), Injection: res.Findings}
+			if len(res.Findings) > 0 {
+				slog.Warn("Possible prompt injection in tool output", "tool", call.Function.Name, "rule", res.Findings[0].Rule, "text", res.Findings[0].Text)
+			}
+
+			var injection *agent.InjectionError
+			if errors.As(err, &injection) {
+				result.Error = err.Error()
+				emit(result)
+				fail(api.ErrBadGateway("%v; the agent run was stopped", err))
+				return
+			}
+			content := res.Content
+			if err != nil {
+				result.Error = err.Error()
+				content = "error: " + err.Error()
+			}
+			slog.Info("Agent tool call", "step", step, "tool", call.Function.Name, "elapsed", time.Since(start), "error", result.Error)
+			emit(result)
+			messages = append(messages, map[string]any{"role": "tool", "tool_call_id": call.ID, "content": content})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	// The last turn's completion is the answer; usage covers every turn
+	choice := resp["choices"].([]any)[0].(map[string]any)
+	choice["finish_reason"] = turn.Choices[0].FinishReason
+	if len(usage) > 0 {
+		resp["usage"] = usage
+	}
+	resp["steps"] = steps
+
+	if !stream {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	chunk := map[string]any{
+		"id":      resp["id"],
+		"object":  "chat.completion.chunk",
+		"created": resp["created"],
+		"model":   resp["model"],
+		"choices": []any{map[string]any{"index": 0, "delta": choice["message"], "finish_reason": choice["finish_reason"]}},
+	}
+	if len(usage) > 0 {
+		chunk["usage"] = usage
+	}
+	data, _ := json.Marshal(chunk)
+	write(sse.Event{Data: string(data)})
+	write(sse.Event{Data: sse.DoneData})
+}
+
+// addUsage sums the numeric token counts of a completion into total
+func addUsage(total, usage map[string]any) {
+	for k, v := range usage {
+		if n, ok := v.(float64); ok {
+			sum, _ := total[k].(float64)
+			total[k] = sum + n
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+)
+
+// annotation collects the token usage, cost and timing reported in SSE comments at the end of
+// a stream. Comments are ignored by SSE parsers but show up in curl output and debug tools.
+type annotation struct {
+	model string
+	sent  time.Time // When the request was sent upstream
+	first time.Time // First reasoning, answer or tool call token
+	usage *tokenUsage
+	clock clock.Clock
+}
+
+// observe records the first token time and the usage report of a stream chunk
+func (a *annotation) observe(chunk map[string]any) {
+	if a.first.IsZero() {
+		choices, _ := chunk["choices"].([]any)
+		for _, c := range choices {
+			if hasChannel(c, "reasoning_content") || hasChannel(c, "content") || hasChannel(c, "tool_calls") {
+				a.first = a.clock.Now()
+				break
+			}
+		}
+	}
+
+	if usage, ok := chunk["usage"].(map[string]any); ok {
+		count := func(key string) int {
+			v, _ := usage[key].(float64)
+			return int(v)
+		}
+		a.usage = &tokenUsage{
+			PromptTokens:     count("prompt_tokens"),
+			CompletionTokens: count("completion_tokens"),
+			TotalTokens:      count("total_tokens"),
+		}
+	}
+}
+
+// event renders the collected figures as an SSE comment event
+func (a *annotation) event() sse.Event {
+	lines := []string{"copilot-proxy model=" + a.model}
+
+	if a.usage != nil {
+		lines = append(lines, fmt.Sprintf("copilot-proxy prompt_tokens=%d completion_tokens=%d total_tokens=%d",
+			a.usage.PromptTokens, a.usage.CompletionTokens, a.usage.TotalTokens))
+		if m, ok := models.GetModel(a.model); ok {
+			lines = append(lines, fmt.Sprintf("copilot-proxy cost_usd=%.6f",
+				m.Cost(a.usage.PromptTokens, a.usage.CompletionTokens)))
+		}
+	} else {
+		lines = append(lines, "copilot-proxy usage=unreported")
+	}
+
+	timing := fmt.Sprintf("copilot-proxy total_ms=%d", a.clock.Since(a.sent).Milliseconds())
+	if !a.first.IsZero() {
+		timing = fmt.Sprintf("copilot-proxy ttft_ms=%d total_ms=%d",
+			a.first.Sub(a.sent).Milliseconds(), a.clock.Since(a.sent).Milliseconds())
+	}
+	lines = append(lines, timing)
+
+	return sse.Event{Comment: strings.Join(lines, "\n")}
+}
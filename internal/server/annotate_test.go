@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationEvent(t *testing.T) {
+	a := &annotation{model: "glm-4.7", sent: time.Now().Add(-time.Second), clock: clock.Real{}}
+	a.observe(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"role": "assistant"}}}})
+	assert.True(t, a.first.IsZero(), "role-only chunks carry no token")
+
+	a.observe(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": "hi"}}}})
+	a.observe(map[string]any{"choices": []any{}, "usage": map[string]any{
+		"prompt_tokens": 1000000.0, "completion_tokens": 1000000.0, "total_tokens": 2000000.0,
+	}})
+
+	comment := a.event().Comment
+	assert.Contains(t, comment, "copilot-proxy model=glm-4.7")
+	assert.Contains(t, comment, "prompt_tokens=1000000 completion_tokens=1000000 total_tokens=2000000")
+	assert.Contains(t, comment, "cost_usd=2.800000")
+	assert.Contains(t, comment, "ttft_ms=")
+
+	assert.Contains(t, (&annotation{model: "glm-4.7", sent: time.Now(), clock: clock.Real{}}).event().Comment, "usage=unreported")
+}
+
+func TestChatCompletions_StreamAnnotations(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n" +
+			"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1,\"total_tokens\":6}}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:  mockUpstream.URL,
+		Profiles: map[string]config.ProfileConfig{"curl": {Annotations: true}},
+	}, "127.0.0.1", 0)
+
+	send := func(profile string) string {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(profileHeader, profile)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	body := send("curl")
+	assert.Contains(t, body, ": copilot-proxy prompt_tokens=5 completion_tokens=1 total_tokens=6\n")
+	// Comments come right before the end of the stream
+	assert.True(t, strings.HasSuffix(body, "\n\ndata: [DONE]\n\n"))
+	assert.Less(t, strings.Index(body, ": copilot-proxy"), strings.Index(body, "data: [DONE]"))
+
+	assert.NotContains(t, send("other"), "copilot-proxy")
+}
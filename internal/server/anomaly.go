@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+)
+
+// anomalyTopN is how many clients and models an alert names
+const anomalyTopN = 3
+
+// minBaselineHours is how much history the baseline needs before alerts are raised
+const minBaselineHours = 3
+
+// usageShare is one client's or model's tokens in the current hour
+type usageShare struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+}
+
+// anomalyDetector compares the tokens used this hour with the average of the preceding
+// hours and raises an alert when usage exceeds a multiple of that baseline, as runaway
+// agents and leaked keys do
+type anomalyDetector struct {
+	multiplier float64
+	hours      int // Hours in the rolling baseline
+	minTokens  int // Hourly usage below this never alerts
+	webhookURL string
+	client     *http.Client
+	alerts     *metrics.Counter
+	clock      clock.Clock
+
+	mu        sync.Mutex
+	hour      time.Time      // Start of the current hour
+	total     int            // Tokens this hour
+	byClient  map[string]int // Tokens this hour per client
+	byModel   map[string]int // Tokens this hour per model
+	history   []int          // Totals of the preceding hours, oldest first
+	alertedAt time.Time      // Hour of the last alert; one alert per hour
+}
+
+// newAnomalyDetector creates a detector from configuration
+func newAnomalyDetector(cfg config.AnomalyConfig, registry *metrics.Registry) *anomalyDetector {
+	return &anomalyDetector{
+		multiplier: cfg.Multiplier,
+		hours:      cfg.BaselineHours,
+		minTokens:  cfg.MinTokens,
+		webhookURL: cfg.WebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		alerts: registry.Counter("copilot_proxy_usage_anomalies_total",
+			"Hours in which token usage exceeded the baseline multiple"),
+		clock:    clock.Real{},
+		byClient: make(map[string]int),
+		byModel:  make(map[string]int),
+	}
+}
+
+// observe adds a request's tokens and raises an alert on the first request that pushes the
+// current hour over the threshold
+func (d *anomalyDetector) observe(client, model string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	d.advance(d.clock.Now().Truncate(time.Hour))
+	d.total += tokens
+	d.byClient[client] += tokens
+	d.byModel[model] += tokens
+
+	baseline, ok := d.baseline()
+	threshold := baseline * d.multiplier
+	if !ok || d.alertedAt.Equal(d.hour) || d.total < d.minTokens || float64(d.total) <= threshold {
+		d.mu.Unlock()
+		return
+	}
+	d.alertedAt = d.hour
+	alert := map[string]any{
+		"event":          "usage_anomaly",
+		"hour":           d.hour.UTC().Format(time.RFC3339),
+		"tokens":         d.total,
+		"baseline":       int(baseline),
+		"multiplier":     d.multiplier,
+		"top_clients":    topShares(d.byClient),
+		"top_models":     topShares(d.byModel),
+		"detected_at":    d.clock.Now().UTC().Format(time.RFC3339),
+		"baseline_hours": len(d.history),
+	}
+	d.mu.Unlock()
+
+	d.alerts.Inc()
+	slog.Warn("Token usage anomaly", "tokens", alert["tokens"], "baseline", alert["baseline"],
+		"multiplier", d.multiplier, "top_clients", alert["top_clients"], "top_models", alert["top_models"])
+	if d.webhookURL != "" {
+		go d.alert(alert)
+	}
+}
+
+// advance closes hours that have ended, recording their totals (zero for idle hours)
+func (d *anomalyDetector) advance(hour time.Time) {
+	if d.hour.IsZero() {
+		d.hour = hour
+		return
+	}
+	elapsed := int(hour.Sub(d.hour) / time.Hour)
+	if elapsed <= 0 {
+		return
+	}
+	d.history = append(d.history, d.total)
+	d.history = append(d.history, make([]int, min(elapsed-1, d.hours))...)
+	if len(d.history) > d.hours {
+		d.history = d.history[len(d.history)-d.hours:]
+	}
+	d.total = 0
+	clear(d.byClient)
+	clear(d.byModel)
+	d.hour = hour
+}
+
+// baseline returns the mean hourly tokens of the history, once there is enough of it
+func (d *anomalyDetector) baseline() (float64, bool) {
+	if len(d.history) < min(minBaselineHours, d.hours) {
+		return 0, false
+	}
+	sum := 0
+	for _, v := range d.history {
+		sum += v
+	}
+	return float64(sum) / float64(len(d.history)), true
+}
+
+// topShares returns the largest entries, biggest first
+func topShares(m map[string]int) []usageShare {
+	shares := make([]usageShare, 0, len(m))
+	for name, tokens := range m {
+		shares = append(shares, usageShare{Name: name, Tokens: tokens})
+	}
+	slices.SortFunc(shares, func(a, b usageShare) int {
+		if a.Tokens != b.Tokens {
+			return b.Tokens - a.Tokens
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return shares[:min(len(shares), anomalyTopN)]
+}
+
+// alert posts an anomaly notification to the configured webhook
+func (d *anomalyDetector) alert(alert map[string]any) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", d.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Failed to create anomaly alert", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		slog.Error("Anomaly alert delivery failed", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("Anomaly alert webhook returned error", "status", resp.StatusCode)
+	}
+}
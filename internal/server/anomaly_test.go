@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	alerts := make(chan map[string]any, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]any
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	d := newAnomalyDetector(config.AnomalyConfig{Multiplier: 3, BaselineHours: 4, MinTokens: 100, WebhookURL: webhook.URL}, metrics.NewRegistry())
+	clk := clock.NewFake(time.Date(2026, 10, 1, 0, 30, 0, 0, time.UTC))
+	d.clock = clk
+
+	// Four ordinary hours of 1000 tokens each build the baseline
+	for range 4 {
+		d.observe("alice", "glm-4.7", 1000)
+		clk.Advance(time.Hour)
+	}
+
+	// Within the multiple: no alert
+	d.observe("alice", "glm-4.7", 2500)
+	assert.Equal(t, 2500, d.total)
+	select {
+	case a := <-alerts:
+		t.Fatalf("Unexpected alert %v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A leaked key pushes the hour past three times the baseline
+	d.observe("leaked", "glm-4.7-flash", 4000)
+	select {
+	case a := <-alerts:
+		assert.Equal(t, "usage_anomaly", a["event"])
+		assert.Equal(t, float64(6500), a["tokens"])
+		assert.Equal(t, float64(1000), a["baseline"])
+		top := a["top_clients"].([]any)
+		assert.Equal(t, "leaked", top[0].(map[string]any)["name"])
+		assert.Len(t, a["top_models"], 2)
+	case <-time.After(time.Second):
+		t.Fatal("No alert delivered")
+	}
+
+	// One alert per hour
+	d.observe("leaked", "glm-4.7-flash", 4000)
+	select {
+	case a := <-alerts:
+		t.Fatalf("Repeated alert %v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAnomalyDetector_IdleHours(t *testing.T) {
+	d := newAnomalyDetector(config.AnomalyConfig{Multiplier: 3, BaselineHours: 4}, metrics.NewRegistry())
+	clk := clock.NewFake(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	d.clock = clk
+
+	d.observe("alice", "glm-4.7", 1000)
+	clk.Advance(100 * time.Hour)
+	d.observe("alice", "glm-4.7", 10)
+
+	assert.Equal(t, []int{0, 0, 0, 0}, d.history)
+	assert.Equal(t, 10, d.total)
+}
+
+func TestAnomalyDetector_NeedsHistory(t *testing.T) {
+	d := newAnomalyDetector(config.AnomalyConfig{Multiplier: 3, BaselineHours: 24}, metrics.NewRegistry())
+	d.observe("alice", "glm-4.7", 1_000_000)
+	assert.True(t, d.alertedAt.IsZero())
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// anthropicWriter translates whatever is written through it into the Anthropic Messages API:
+// an SSE stream of chat completion chunks becomes a stream of message events, a completion
+// object becomes a message, and error bodies become Anthropic errors. The kind of body is
+// known from the status and Content-Type once writing starts.
+type anthropicWriter struct {
+	gin.ResponseWriter
+	model  string // As the client asked for it
+	status int    // Held back until the kind of body is known
+	mode   anthropicMode
+
+	events sseSplitter
+	body   []byte // A buffered completion or error body
+
+	// Stream state
+	started   bool
+	id        string
+	open      int    // Index of the open content block, -1 when none
+	openType  string // Type of the open content block
+	blocks    int    // Content blocks started so far
+	toolBlock map[int]int
+	reason    string
+	usage     *tokenUsage
+	done      bool
+}
+
+// anthropicMode is the kind of body an anthropicWriter is translating
+type anthropicMode int
+
+const (
+	anthropicPending anthropicMode = iota
+	anthropicStream
+	anthropicBuffered
+)
+
+// newAnthropicWriter wraps a response writer whose headers have not been sent yet
+func newAnthropicWriter(w gin.ResponseWriter, model string) *anthropicWriter {
+	return &anthropicWriter{ResponseWriter: w, model: model, open: -1, toolBlock: make(map[int]int)}
+}
+
+// WriteHeader implements http.ResponseWriter; the status is sent with the translated body
+func (w *anthropicWriter) WriteHeader(code int) {
+	if w.mode == anthropicPending {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow implements gin.ResponseWriter
+func (w *anthropicWriter) WriteHeaderNow() {}
+
+// Status implements gin.ResponseWriter
+func (w *anthropicWriter) Status() int {
+	if w.mode != anthropicStream && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+// Write implements io.Writer. Stream events are translated as they complete; other bodies are
+// held until Close.
+func (w *anthropicWriter) Write(p []byte) (int, error) {
+	if w.mode == anthropicPending {
+		w.decide()
+	}
+	if w.mode == anthropicBuffered {
+		w.body = append(w.body, p...)
+		return len(p), nil
+	}
+	return len(p), w.events.write(p, w.chunk)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *anthropicWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush implements http.Flusher; only a stream goes out before Close
+func (w *anthropicWriter) Flush() {
+	if w.mode == anthropicStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// decide picks the translation from the status and Content-Type of the first write
+func (w *anthropicWriter) decide() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.Header().Del("Content-Length")
+	if w.status < 300 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.mode = anthropicStream
+		w.ResponseWriter.WriteHeader(w.status)
+		return
+	}
+	w.mode = anthropicBuffered
+}
+
+// Close writes the translated message or error, or ends a stream that stopped without [DONE]
+func (w *anthropicWriter) Close() error {
+	switch w.mode {
+	case anthropicStream:
+		if err := w.events.flush(w.chunk); err != nil {
+			return err
+		}
+		return w.finish()
+	case anthropicPending:
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return nil
+	}
+
+	out := w.body
+	var doc map[string]any
+	decoded := json.Unmarshal(w.body, &doc) == nil
+	switch {
+	case w.status >= 300:
+		msg := strings.TrimSpace(string(w.body))
+		if decoded && doc["error"] != nil {
+			msg = errorText(doc["error"])
+		}
+		out, _ = json.Marshal(anthropicError(w.status, msg))
+	case decoded && doc["choices"] != nil:
+		out, _ = json.Marshal(w.message(doc))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(out)
+	return err
+}
+
+// message translates a chat completion object into an Anthropic message
+func (w *anthropicWriter) message(resp map[string]any) map[string]any {
+	content := []any{}
+	choices, _ := resp["choices"].([]any)
+	if len(choices) > 0 {
+		choice, _ := choices[0].(map[string]any)
+		msg, _ := choice["message"].(map[string]any)
+		if reasoning, _ := msg["reasoning_content"].(string); reasoning != "" {
+			content = append(content, map[string]any{"type": "thinking", "thinking": reasoning, "signature": ""})
+		}
+		if text, _ := msg["content"].(string); text != "" {
+			content = append(content, map[string]any{"type": "text", "text": text})
+		}
+		calls, _ := msg["tool_calls"].([]any)
+		for _, c := range calls {
+			call, _ := c.(map[string]any)
+			fn, _ := call["function"].(map[string]any)
+			id, _ := call["id"].(string)
+			name, _ := fn["name"].(string)
+			arguments, _ := fn["arguments"].(string)
+			content = append(content, map[string]any{"type": "tool_use", "id": id, "name": name, "input": toolInput(name, arguments)})
+		}
+		w.reason, _ = choice["finish_reason"].(string)
+	}
+	id, _ := resp["id"].(string)
+	return map[string]any{
+		"id":            anthropicMessageID(id),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         w.model,
+		"content":       content,
+		"stop_reason":   anthropicStopReason(w.reason),
+		"stop_sequence": nil,
+		"usage":         anthropicUsage(usageFrom(resp["usage"])),
+	}
+}
+
+// chunk translates one stream event
+func (w *anthropicWriter) chunk(data []byte) error {
+	if w.done {
+		return nil
+	}
+	if string(bytes.TrimSpace(data)) == sse.DoneData {
+		return w.finish()
+	}
+
+	var chunk map[string]any
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		slog.Debug("Dropping undecodable stream event", "error", err)
+		return nil
+	}
+	if e, ok := chunk["error"]; ok {
+		w.done = true
+		return w.event("error", anthropicError(http.StatusInternalServerError, errorText(e)))
+	}
+	if w.id == "" {
+		w.id, _ = chunk["id"].(string)
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	if usage := usageFrom(chunk["usage"]); usage != nil {
+		w.usage = usage
+	}
+
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]any)
+	if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+		w.reason = reason
+	}
+	delta, _ := choice["delta"].(map[string]any)
+	if reasoning, _ := delta["reasoning_content"].(string); reasoning != "" {
+		if err := w.delta("thinking", map[string]any{"type": "thinking_delta", "thinking": reasoning}); err != nil {
+			return err
+		}
+	}
+	if text, _ := delta["content"].(string); text != "" {
+		if err := w.delta("text", map[string]any{"type": "text_delta", "text": text}); err != nil {
+			return err
+		}
+	}
+	calls, _ := delta["tool_calls"].([]any)
+	for i, c := range calls {
+		call, _ := c.(map[string]any)
+		index := i
+		if n, ok := call["index"].(float64); ok {
+			index = int(n)
+		}
+		fn, _ := call["function"].(map[string]any)
+		block, ok := w.toolBlock[index]
+		if !ok {
+			id, _ := call["id"].(string)
+			name, _ := fn["name"].(string)
+			if err := w.startBlock(map[string]any{"type": "tool_use", "id": id, "name": name, "input": map[string]any{}}); err != nil {
+				return err
+			}
+			block = w.open
+			w.toolBlock[index] = block
+		}
+		if arguments, _ := fn["arguments"].(string); arguments != "" {
+			if err := w.event("content_block_delta", map[string]any{
+				"type": "content_block_delta", "index": block,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": arguments},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// start sends message_start before the first content
+func (w *anthropicWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.event("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            anthropicMessageID(w.id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         w.model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         anthropicUsage(nil),
+		},
+	})
+}
+
+// delta adds to the open text or thinking block, starting one of that type if needed
+func (w *anthropicWriter) delta(blockType string, delta map[string]any) error {
+	if w.openType != blockType {
+		block := map[string]any{"type": blockType, blockType: ""}
+		if blockType == "thinking" {
+			block["signature"] = ""
+		}
+		if err := w.startBlock(block); err != nil {
+			return err
+		}
+	}
+	return w.event("content_block_delta", map[string]any{"type": "content_block_delta", "index": w.open, "delta": delta})
+}
+
+// startBlock closes the open content block and starts the next
+func (w *anthropicWriter) startBlock(block map[string]any) error {
+	if err := w.stopBlock(); err != nil {
+		return err
+	}
+	w.open, w.openType = w.blocks, block["type"].(string)
+	w.blocks++
+	return w.event("content_block_start", map[string]any{"type": "content_block_start", "index": w.open, "content_block": block})
+}
+
+// stopBlock closes the open content block, if any
+func (w *anthropicWriter) stopBlock() error {
+	if w.open < 0 {
+		return nil
+	}
+	index := w.open
+	w.open, w.openType = -1, ""
+	return w.event("content_block_stop", map[string]any{"type": "content_block_stop", "index": index})
+}
+
+// finish ends a stream with the stop reason and usage
+func (w *anthropicWriter) finish() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.stopBlock(); err != nil {
+		return err
+	}
+	if err := w.event("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": anthropicStopReason(w.reason), "stop_sequence": nil},
+		"usage": anthropicUsage(w.usage),
+	}); err != nil {
+		return err
+	}
+	return w.event("message_stop", map[string]any{"type": "message_stop"})
+}
+
+// event writes one named SSE event
+func (w *anthropicWriter) event(name string, v map[string]any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// anthropicMessageID derives a message ID from a completion ID
+func anthropicMessageID(id string) string {
+	if id == "" {
+		return "msg_proxy"
+	}
+	return "msg_" + id
+}
+
+// anthropicStopReason maps an OpenAI finish_reason to Anthropic's stop_reason
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls":
+		return "tool_use"
+	case "sensitive", "content_filter":
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// anthropicUsage converts token usage; unknown usage is reported as zero. Anthropic counts prompt
+// cache reads apart from input tokens.
+func anthropicUsage(u *tokenUsage) map[string]any {
+	if u == nil {
+		u = &tokenUsage{}
+	}
+	usage := map[string]any{"input_tokens": u.PromptTokens, "output_tokens": u.CompletionTokens}
+	if cached, ok := u.cachedTokens(); ok {
+		usage["input_tokens"] = max(u.PromptTokens-cached, 0)
+		usage["cache_read_input_tokens"] = cached
+	}
+	return usage
+}
+
+// anthropicError builds an Anthropic error body, typed by status
+func anthropicError(status int, msg string) map[string]any {
+	errType := "api_error"
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		errType = "invalid_request_error"
+	case status == http.StatusUnauthorized:
+		errType = "authentication_error"
+	case status == http.StatusForbidden:
+		errType = "permission_error"
+	case status == http.StatusNotFound:
+		errType = "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		errType = "request_too_large"
+	case status == http.StatusTooManyRequests:
+		errType = "rate_limit_error"
+	case status == http.StatusServiceUnavailable, status == 529:
+		errType = "overloaded_error"
+	}
+	return map[string]any{"type": "error", "error": map[string]any{"type": errType, "message": msg}}
+}
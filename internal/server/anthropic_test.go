@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// anthropicEvents decodes an Anthropic SSE stream into event names and data
+func anthropicEvents(t *testing.T, body string) ([]string, []map[string]any) {
+	var names []string
+	var events []map[string]any
+	for _, ev := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		name, data, ok := strings.Cut(ev, "\ndata: ")
+		require.True(t, ok, ev)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &doc), data)
+		names = append(names, strings.TrimPrefix(name, "event: "))
+		events = append(events, doc)
+	}
+	return names, events
+}
+
+func TestAnthropicWriter_Stream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	w := newAnthropicWriter(c.Writer, "claude-sonnet-4-5")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Content-Length", "999")
+	w.WriteHeader(http.StatusOK)
+
+	stream := "data: {\"id\":\"chatcmpl-7\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"reasoning_content\":\"Need the\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-7\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\" weather\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-7\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Checking.\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-7\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"weather\",\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-7\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Oslo\\\"}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-7\",\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":12}}\n\n" +
+		"data: [DONE]\n\n"
+	for len(stream) > 0 {
+		n := min(41, len(stream))
+		_, err := w.Write([]byte(stream[:n]))
+		require.NoError(t, err)
+		stream = stream[n:]
+	}
+	require.NoError(t, w.Close())
+
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	names, events := anthropicEvents(t, rec.Body.String())
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, names)
+
+	msg := events[0]["message"].(map[string]any)
+	assert.Equal(t, "msg_chatcmpl-7", msg["id"])
+	assert.Equal(t, "claude-sonnet-4-5", msg["model"])
+	assert.Equal(t, map[string]any{"type": "thinking", "thinking": "", "signature": ""}, events[1]["content_block"])
+	assert.Equal(t, map[string]any{"type": "thinking_delta", "thinking": " weather"}, events[3]["delta"])
+	assert.Equal(t, map[string]any{"type": "text_delta", "text": "Checking."}, events[6]["delta"])
+	assert.Equal(t, float64(1), events[6]["index"])
+	assert.Equal(t, map[string]any{"type": "tool_use", "id": "call_1", "name": "weather", "input": map[string]any{}}, events[8]["content_block"])
+	assert.Equal(t, map[string]any{"type": "input_json_delta", "partial_json": "\"Oslo\"}"}, events[10]["delta"])
+	assert.Equal(t, float64(2), events[11]["index"])
+	assert.Equal(t, "tool_use", events[12]["delta"].(map[string]any)["stop_reason"])
+	assert.Equal(t, map[string]any{"input_tokens": float64(30), "output_tokens": float64(12)}, events[12]["usage"])
+}
+
+func TestAnthropicWriter_StreamError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	w := newAnthropicWriter(c.Writer, "claude-sonnet-4-5")
+	w.Header().Set("Content-Type", "text/event-stream")
+	_, err := w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hm\"}}]}\n\n" +
+		"data: {\"error\":{\"message\":\"reasoning took too long\",\"type\":\"server_error\"}}\n\ndata: [DONE]\n\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	names, events := anthropicEvents(t, rec.Body.String())
+	assert.Equal(t, []string{"message_start", "content_block_start", "content_block_delta", "error"}, names)
+	assert.Equal(t, map[string]any{"type": "error", "error": map[string]any{"type": "api_error", "message": "reasoning took too long"}}, events[3])
+}
+
+func TestAnthropicWriter_Buffered(t *testing.T) {
+	write := func(status int, body string) (*httptest.ResponseRecorder, map[string]any) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		w := newAnthropicWriter(c.Writer, "claude-haiku-4-5")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+		assert.False(t, c.Writer.Written())
+		require.NoError(t, w.Close())
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		return rec, doc
+	}
+
+	rec, msg := write(http.StatusOK, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"It is sunny.","reasoning_content":"Look it up",`+
+		`"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}}]},"finish_reason":"length"}],`+
+		`"usage":{"prompt_tokens":12,"completion_tokens":4}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+	assert.Equal(t, map[string]any{
+		"id": "msg_chatcmpl-1", "type": "message", "role": "assistant", "model": "claude-haiku-4-5",
+		"content": []any{
+			map[string]any{"type": "thinking", "thinking": "Look it up", "signature": ""},
+			map[string]any{"type": "text", "text": "It is sunny."},
+			map[string]any{"type": "tool_use", "id": "call_1", "name": "weather", "input": map[string]any{"city": "Oslo"}},
+		},
+		"stop_reason": "max_tokens", "stop_sequence": nil,
+		"usage": map[string]any{"input_tokens": float64(12), "output_tokens": float64(4)},
+	}, msg)
+
+	// Proxy and upstream errors keep their status
+	rec, doc := write(http.StatusNotFound, `{"error":"model 'claude-x' not found"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, map[string]any{"type": "error", "error": map[string]any{"type": "not_found_error", "message": "model 'claude-x' not found"}}, doc)
+	rec, doc = write(http.StatusTooManyRequests, `{"error":{"code":"1302","message":"Rate limit reached"}}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "rate_limit_error", doc["error"].(map[string]any)["type"])
+	assert.Equal(t, "Rate limit reached", doc["error"].(map[string]any)["message"])
+}
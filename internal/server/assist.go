@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Default prompt templates for the assist endpoints
+const (
+	DefaultCommitPrompt = `Write a commit message for the following diff using the Conventional Commits format.
+The first line is "<type>(<optional scope>): <summary>" in the imperative mood, at most 72 characters.
+Types: feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert.
+If the change needs explanation, add a blank line and a short body wrapped at 72 characters.
+Reply with the commit message only, without code fences or commentary.
+{{if .Context}}
+Additional context from the author:
+{{.Context}}
+{{end}}
+Diff:
+{{.Diff}}`
+
+	DefaultPRPrompt = `Write a pull request description for the following diff.
+The first line is a concise title. After a blank line, write the body in markdown:
+a short summary of what changes and why, then a "## Changes" bullet list, then "## Testing" notes if the diff includes tests.
+Reply with the title and body only, without code fences or commentary.
+{{if .Context}}
+Additional context from the author:
+{{.Context}}
+{{end}}
+Diff:
+{{.Diff}}`
+)
+
+// assistData is available to assist prompt templates
+type assistData struct {
+	Diff    string
+	Context string
+}
+
+// assistRequest is the body accepted by the assist endpoints
+type assistRequest struct {
+	Diff    string `json:"diff"`
+	Context string `json:"context"` // Optional notes, e.g. a ticket summary
+	Model   string `json:"model"`   // Overrides the configured model
+}
+
+// assistant renders prompts for the commit and PR endpoints
+type assistant struct {
+	model  string
+	commit *template.Template
+	pr     *template.Template
+}
+
+// newAssistant parses the configured prompt templates, falling back to the defaults
+func newAssistant(cfg config.AssistConfig) (*assistant, error) {
+	if cfg.Model != "" && !models.IsValidModel(cfg.Model) {
+		return nil, fmt.Errorf("model '%s' not found", cfg.Model)
+	}
+
+	commitSrc, prSrc := cfg.CommitPrompt, cfg.PRPrompt
+	if commitSrc == "" {
+		commitSrc = DefaultCommitPrompt
+	}
+	if prSrc == "" {
+		prSrc = DefaultPRPrompt
+	}
+
+	commit, err := template.New("commit").Parse(commitSrc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit_prompt: %w", err)
+	}
+	pr, err := template.New("pr").Parse(prSrc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pr_prompt: %w", err)
+	}
+
+	return &assistant{model: cfg.Model, commit: commit, pr: pr}, nil
+}
+
+// handleAssistCommit returns a conventional-commit message for a diff
+func (s *Server) handleAssistCommit(c *gin.Context) {
+	text, model, ok := s.runAssist(c, s.assist.commit)
+	if !ok {
+		return
+	}
+	if wantsPlainText(c) {
+		c.String(http.StatusOK, text+"\n")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"model": model, "message": text})
+}
+
+// handleAssistPR returns a pull request title and description for a diff
+func (s *Server) handleAssistPR(c *gin.Context) {
+	text, model, ok := s.runAssist(c, s.assist.pr)
+	if !ok {
+		return
+	}
+	if wantsPlainText(c) {
+		c.String(http.StatusOK, text+"\n")
+		return
+	}
+	title, body, _ := strings.Cut(text, "\n")
+	c.JSON(http.StatusOK, gin.H{
+		"model":       model,
+		"title":       strings.TrimSpace(strings.TrimLeft(title, "# ")),
+		"description": strings.TrimSpace(body),
+	})
+}
+
+// runAssist renders the prompt for the request's diff and runs a non-streaming completion.
+// It writes the error response itself and reports false on failure.
+func (s *Server) runAssist(c *gin.Context, tmpl *template.Template) (string, string, bool) {
+	var req assistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return "", "", false
+	}
+	if strings.TrimSpace(req.Diff) == "" {
+		handleError(c, api.ErrBadRequest("diff is required"))
+		return "", "", false
+	}
+
+	model := req.Model
+	if model == "" {
+		model = s.assist.model
+	}
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, assistData{Diff: req.Diff, Context: req.Context}); err != nil {
+		handleError(c, api.ErrInternalServer("Failed to render prompt: %v", err))
+		return "", "", false
+	}
+
+	bodyMap := map[string]any{
+		"model":    model,
+		"stream":   false,
+		"messages": []any{map[string]any{"role": "user", "content": prompt.String()}},
+	}
+	if err := s.validateChatRequest(c, bodyMap); err != nil {
+		handleError(c, err)
+		return "", "", false
+	}
+
+	raw, err := s.complete(c.Request.Context(), principalFrom(c), bodyMap)
+	if err != nil {
+		handleError(c, err)
+		return "", "", false
+	}
+
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil || len(resp.Choices) == 0 {
+		handleError(c, api.ErrBadGateway("Unexpected upstream response"))
+		return "", "", false
+	}
+	if resp.Model != "" {
+		model = resp.Model
+	}
+
+	return unfence(resp.Choices[0].Message.Content), model, true
+}
+
+// unfence trims whitespace and removes a code fence wrapped around the whole text
+func unfence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	inner := strings.TrimSuffix(text, "```")
+	if _, rest, ok := strings.Cut(inner, "\n"); ok {
+		return strings.TrimSpace(rest)
+	}
+	return text
+}
+
+// wantsPlainText reports whether the client prefers text/plain over JSON, as git hooks usually do
+func wantsPlainText(c *gin.Context) bool {
+	return strings.HasPrefix(c.GetHeader("Accept"), "text/plain")
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnfence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"feat: add x\n", "feat: add x"},
+		{"```\nfeat: add x\n```", "feat: add x"},
+		{"```text\nfix(api): y\n\nbody\n```\n", "fix(api): y\n\nbody"},
+		{"see ```code``` inline", "see ```code``` inline"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, unfence(tt.input))
+	}
+}
+
+func TestAssistEndpoints(t *testing.T) {
+	var upstreamBody map[string]any
+	reply := ""
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":   upstreamBody["model"],
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": reply}}},
+		})
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		BaseURL: mockUpstream.URL,
+		Assist:  config.AssistConfig{Model: "GLM-4.7-Flash", PRPrompt: "PR for {{.Context}}:\n{{.Diff}}"},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	post := func(path, body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		reply = "```\nfeat(parser): support tabs\n```"
+		w := post("/api/assist/commit", `{"diff": "+tab support", "context": "JIRA-1"}`, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"model": "glm-4.7-flash", "message": "feat(parser): support tabs"}`, w.Body.String())
+		prompt := upstreamBody["messages"].([]any)[0].(map[string]any)["content"].(string)
+		assert.Contains(t, prompt, "Conventional Commits")
+		assert.Contains(t, prompt, "JIRA-1")
+		assert.Contains(t, prompt, "+tab support")
+		assert.Equal(t, false, upstreamBody["stream"])
+	})
+
+	t.Run("Commit Plain Text", func(t *testing.T) {
+		reply = "fix: typo"
+		w := post("/api/assist/commit", `{"diff": "-teh\n+the"}`, "text/plain")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "fix: typo\n", w.Body.String())
+	})
+
+	t.Run("PR", func(t *testing.T) {
+		reply = "# Add tab support\n\nParser now accepts tabs.\n\n## Changes\n- tabs"
+		w := post("/api/assist/pr", `{"diff": "+tab", "context": "ticket", "model": "GLM-4.7"}`, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, "glm-4.7", resp["model"])
+		assert.Equal(t, "Add tab support", resp["title"])
+		assert.Equal(t, "Parser now accepts tabs.\n\n## Changes\n- tabs", resp["description"])
+		prompt := upstreamBody["messages"].([]any)[0].(map[string]any)["content"].(string)
+		assert.Equal(t, "PR for ticket:\n+tab", prompt)
+	})
+
+	t.Run("Missing Diff", func(t *testing.T) {
+		w := post("/api/assist/commit", `{"diff": "  "}`, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// generatedByHeader marks responses as AI-generated
+const generatedByHeader = "X-Generated-By"
+
+// attribution marks completions as generated through the proxy
+type attribution struct {
+	header  bool
+	trailer *template.Template // nil when no trailer is configured
+	clients map[string]bool    // nil applies attribution to every request
+}
+
+// attributionData is available to the trailer template
+type attributionData struct {
+	Model  string // Canonical model name
+	Client string // Authenticated client name (empty when auth is disabled)
+}
+
+// newAttribution parses the attribution configuration; it returns nil when attribution is off
+func newAttribution(cfg config.AttributionConfig) (*attribution, error) {
+	if !cfg.Header && cfg.Trailer == "" {
+		return nil, nil
+	}
+
+	a := &attribution{header: cfg.Header}
+	if cfg.Trailer != "" {
+		tmpl, err := template.New("trailer").Parse(cfg.Trailer)
+		if err != nil {
+			return nil, err
+		}
+		a.trailer = tmpl
+	}
+	if len(cfg.Clients) > 0 {
+		a.clients = make(map[string]bool, len(cfg.Clients))
+		for _, name := range cfg.Clients {
+			a.clients[name] = true
+		}
+	}
+	return a, nil
+}
+
+// appliesTo reports whether the request's client is subject to attribution
+func (a *attribution) appliesTo(c *gin.Context) (bool, string) {
+	client := ""
+	if p := principalFrom(c); p != nil {
+		client = p.Name
+	}
+	if a.clients != nil && !a.clients[client] {
+		return false, client
+	}
+	return true, client
+}
+
+// apply sets the attribution header and returns the trailer transform, if any
+func (a *attribution) apply(c *gin.Context, model string) contentTransform {
+	ok, client := a.appliesTo(c)
+	if !ok {
+		return nil
+	}
+
+	if a.header {
+		c.Header(generatedByHeader, "copilot-proxy/"+model)
+	}
+	if a.trailer == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	if err := a.trailer.Execute(&b, attributionData{Model: model, Client: client}); err != nil || b.Len() == 0 {
+		return nil
+	}
+	return appendTransform(b.String())
+}
+
+// appendTransform appends fixed text to the end of a message
+type appendTransform string
+
+// Apply implements contentTransform
+func (t appendTransform) Apply(content string) string {
+	return content + string(t)
+}
+
+// NewStream implements contentTransform
+func (t appendTransform) NewStream() streamTransform {
+	return &appendStream{suffix: string(t)}
+}
+
+// appendStream passes deltas through and emits the suffix on flush
+type appendStream struct {
+	suffix string
+}
+
+// Push implements streamTransform
+func (s *appendStream) Push(delta string) string { return delta }
+
+// Flush implements streamTransform
+func (s *appendStream) Flush() string { return s.suffix }
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the gin context key holding the authenticated *auth.Principal
+const principalKey = "principal"
+
+// authenticator resolves client credentials (static keys or OIDC-issued JWTs) to principals
+type authenticator struct {
+	keys     *auth.Keys
+	verifier *auth.Verifier // nil unless OIDC is configured
+	mapping  auth.ClaimMapping
+	quotas   storage.Store // Per-minute request counters, shared by replicas with a shared backend
+	clock    clock.Clock
+}
+
+// newAuthenticator builds an authenticator from the auth configuration
+func newAuthenticator(cfg config.AuthConfig, store storage.Store) *authenticator {
+	keyMap := make(map[string]string, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		keyMap[k.Name] = k.Key
+	}
+
+	a := &authenticator{
+		keys:   auth.NewKeys(keyMap),
+		quotas: store,
+		clock:  clock.Real{},
+	}
+	if cfg.OIDC.Enabled() {
+		a.verifier = auth.NewVerifier(auth.OIDCOptions{
+			Issuer:   cfg.OIDC.Issuer,
+			JWKSURL:  cfg.OIDC.JWKSURL,
+			Audience: cfg.OIDC.Audience,
+		})
+		a.mapping = auth.ClaimMapping{
+			Client: cfg.OIDC.ClientClaim,
+			Models: cfg.OIDC.ModelsClaim,
+			Quota:  cfg.OIDC.QuotaClaim,
+		}
+	}
+	return a
+}
+
+// authenticate returns the principal for the request's credentials
+func (a *authenticator) authenticate(c *gin.Context) (*auth.Principal, error) {
+	token := auth.FromRequest(c.Request)
+	if token == "" {
+		return nil, errors.New("missing API key")
+	}
+
+	if name, ok := a.keys.Lookup(token); ok {
+		return &auth.Principal{Name: name}, nil
+	}
+
+	if a.verifier != nil && auth.LooksLikeJWT(token) {
+		claims, err := a.verifier.Verify(c.Request.Context(), token)
+		if err != nil {
+			return nil, err
+		}
+		return auth.PrincipalFromClaims(claims, a.mapping)
+	}
+
+	return nil, errors.New("invalid API key")
+}
+
+// allowQuota applies the principal's requests-per-minute quota, if any, counting requests in
+// fixed one-minute windows, and returns where the principal stands. If the store is unreachable
+// the request is allowed.
+func (a *authenticator) allowQuota(ctx context.Context, p *auth.Principal) (bool, rateLimitStatus) {
+	if p.RequestsPerMinute <= 0 {
+		return true, rateLimitStatus{}
+	}
+
+	ok, st, err := allowWindow(ctx, a.quotas, "quota:"+p.Name, p.RequestsPerMinute, a.clock.Now())
+	if err != nil {
+		slog.Warn("Quota check skipped", "client", p.Name, "error", err)
+	}
+	return ok, st
+}
+
+// authMiddleware requires valid client credentials on every request except health checks, and
+// the management endpoints when they have an admin token of their own, and locks out source
+// IPs that repeatedly fail authentication. Failures and lockouts are written to the log as
+// audit events.
+func authMiddleware(cfg config.AuthConfig, adminToken bool, store storage.Store, registry *metrics.Registry, hooks *hookRunner) gin.HandlerFunc {
+	authn := newAuthenticator(cfg, store)
+	guard := auth.NewGuard(cfg.Lockout.MaxFailures, cfg.Lockout.Base, cfg.Lockout.Max)
+
+	failures := registry.Counter("copilot_proxy_auth_failures_total",
+		"Requests rejected for a missing or invalid client key")
+	lockouts := registry.Counter("copilot_proxy_auth_lockouts_total",
+		"Source IPs locked out after repeated authentication failures")
+	quotaExceeded := registry.Counter("copilot_proxy_auth_quota_exceeded_total",
+		"Requests rejected by a client's requests-per-minute quota", "client")
+
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/healthz" || (adminToken && isManagementPath(c.Request.URL.Path)) {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		if locked, remaining := guard.Locked(ip); locked {
+			rejectLocked(c, remaining)
+			return
+		}
+
+		principal, err := authn.authenticate(c)
+		if errors.Is(err, auth.ErrKeyFetch) {
+			// The provider being down is not the client's failure, so it does not count toward a lockout
+			slog.Error("Cannot verify token", "ip", ip, "path", c.Request.URL.Path, "error", err)
+			handleError(c, api.Errorf(http.StatusServiceUnavailable, "cannot verify token: identity provider unavailable"))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			// The audit log records the source; as a label it would grow the metric without bound
+			failures.Inc()
+			slog.Warn("Authentication failed", "audit", "auth_failure", "ip", ip, "path", c.Request.URL.Path, "reason", err)
+
+			if lockout := guard.Fail(ip); lockout > 0 {
+				lockouts.Inc()
+				slog.Warn("Source locked out", "audit", "auth_lockout", "ip", ip, "duration", lockout)
+				rejectLocked(c, lockout)
+				return
+			}
+
+			handleError(c, api.ErrUnauthorized("invalid or missing API key"))
+			c.Abort()
+			return
+		}
+
+		guard.Succeed(ip)
+
+		ok, st := authn.allowQuota(c.Request.Context(), principal)
+		noteRateLimit(c, st)
+		if !ok {
+			quotaExceeded.Inc(principal.Name)
+			hooks.quotaExceeded(principal.Name, principal.RequestsPerMinute)
+			retryAfter := int(math.Ceil(st.reset.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			handleError(c, api.ErrTooManyRequests("quota exceeded for %s, retry in %ds", principal.Name, retryAfter))
+			c.Abort()
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// principalFrom returns the authenticated principal, or nil when auth is disabled
+func principalFrom(c *gin.Context) *auth.Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if p, ok := v.(*auth.Principal); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// allowedModel reports whether the request's principal, if any, may use model under its own
+// or its canonical name
+func allowedModel(c *gin.Context, model string) bool {
+	p := principalFrom(c)
+	return p == nil || p.AllowsModel(model) || p.AllowsModel(models.GetCanonicalModelName(model))
+}
+
+// rejectLocked answers a locked-out source with 429 and Retry-After
+func rejectLocked(c *gin.Context, remaining time.Duration) {
+	retryAfter := int(math.Ceil(remaining.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	handleError(c, api.ErrTooManyRequests("too many failed authentication attempts, retry in %ds", retryAfter))
+	c.Abort()
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionHeader names the session a chat request's response is broadcast under
+const sessionHeader = "X-Session-Id"
+
+// Defaults for broadcast sessions
+const (
+	defaultBroadcastMaxBuffer = 4 << 20
+	defaultBroadcastLinger    = time.Minute
+	maxBroadcastWait          = 5 * time.Minute
+)
+
+// sessionIDPattern restricts session IDs to what fits in a URL path segment
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// generation is one response broadcast under a session. The relay appends to it as the client
+// receives the response; subscribers replay what is buffered and then follow it live.
+type generation struct {
+	owner string // Client that started it; empty without auth
+	max   int
+
+	mu          sync.Mutex
+	contentType string // As sent to the client, known from the first append
+	buf         []byte
+	done        bool
+	truncated   bool          // The response outgrew the buffer and the broadcast stopped
+	changed     chan struct{} // Closed and replaced on every append
+}
+
+// append adds bytes sent to the client with the response's content type, ending the broadcast
+// once the buffer is full. It cannot fail, so a slow or oversized broadcast cannot break the
+// relay it copies.
+func (g *generation) append(p []byte, contentType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return
+	}
+	if g.contentType == "" {
+		g.contentType = contentType
+	}
+	if len(g.buf)+len(p) > g.max {
+		g.truncated = true
+		g.finishLocked()
+		return
+	}
+	g.buf = append(g.buf, p...)
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// finish marks the response complete
+func (g *generation) finish() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.done {
+		g.finishLocked()
+	}
+}
+
+func (g *generation) finishLocked() {
+	g.done = true
+	close(g.changed)
+}
+
+// next returns the bytes after offset, whether the response is complete, and a channel closed
+// when more arrive
+func (g *generation) next(offset int) ([]byte, bool, bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf[offset:], g.done, g.truncated, g.changed
+}
+
+// mediaType returns the content type of the response, empty before anything was appended
+func (g *generation) mediaType() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.contentType
+}
+
+// broadcastHub fans out the responses of chat requests sent with X-Session-Id to GET
+// subscribers of /v1/sessions/:id/stream. Each session holds its latest generation; a finished
+// one is kept for the linger period so viewers that connect just after it still see it.
+type broadcastHub struct {
+	maxBuffer int
+	linger    time.Duration
+	clock     clock.Clock
+
+	subscribers *metrics.Gauge
+
+	mu       sync.Mutex
+	sessions map[string]*generation
+	started  chan struct{} // Closed and replaced whenever a generation starts
+}
+
+// newBroadcastHub creates the hub, or returns nil when broadcasting is disabled
+func newBroadcastHub(cfg config.BroadcastConfig, registry *metrics.Registry) *broadcastHub {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &broadcastHub{
+		maxBuffer: cmp.Or(cfg.MaxBuffer, defaultBroadcastMaxBuffer),
+		linger:    cmp.Or(cfg.Linger, defaultBroadcastLinger),
+		clock:     clock.Real{},
+		subscribers: registry.Gauge("copilot_proxy_broadcast_subscribers",
+			"Clients following a broadcast session"),
+		sessions: make(map[string]*generation),
+		started:  make(chan struct{}),
+	}
+}
+
+// begin starts a generation under session, replacing the previous one, and returns nil while
+// the session holds another client's generation so its viewers cannot be taken over.
+// Subscribers of a replaced generation follow it to its end.
+func (h *broadcastHub) begin(session, owner string) *generation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if prev := h.sessions[session]; prev != nil && prev.owner != owner {
+		return nil
+	}
+	g := &generation{owner: owner, max: h.maxBuffer, changed: make(chan struct{})}
+	h.sessions[session] = g
+	close(h.started)
+	h.started = make(chan struct{})
+	return g
+}
+
+// end finishes a generation and forgets it after the linger period unless a newer one took
+// its session
+func (h *broadcastHub) end(session string, g *generation) {
+	g.finish()
+	h.clock.AfterFunc(h.linger, func() {
+		h.mu.Lock()
+		if h.sessions[session] == g {
+			delete(h.sessions, session)
+		}
+		h.mu.Unlock()
+	})
+}
+
+// lookup returns the session's generation, waiting up to wait for one to start
+func (h *broadcastHub) lookup(ctx context.Context, session string, wait time.Duration) *generation {
+	var timeout clock.Timer
+	for {
+		h.mu.Lock()
+		g, started := h.sessions[session], h.started
+		h.mu.Unlock()
+		if g != nil || wait <= 0 {
+			return g
+		}
+		if timeout == nil {
+			timeout = h.clock.NewTimer(wait)
+			defer timeout.Stop()
+		}
+		select {
+		case <-started:
+		case <-timeout.C():
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// broadcastWriter copies what a client receives into the generation of its session, once the
+// relay has started one
+type broadcastWriter struct {
+	gin.ResponseWriter
+	session string
+	gen     *generation
+}
+
+// Write implements io.Writer
+func (w *broadcastWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if w.gen != nil {
+		w.gen.append(p[:n], w.Header().Get("Content-Type"))
+	}
+	return n, err
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *broadcastWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// middleware puts a broadcastWriter beneath the writers that translate or re-frame responses
+// for requests naming a session, so subscribers get exactly the bytes the client does, and
+// ends the generation once they are all written
+func (h *broadcastHub) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(sessionHeader) == "" {
+			c.Next()
+			return
+		}
+		w := &broadcastWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Set(broadcastKey, w)
+		c.Next()
+		if w.gen != nil {
+			h.end(w.session, w.gen)
+		}
+	}
+}
+
+// broadcastKey holds the request's broadcastWriter in the gin context
+const broadcastKey = "broadcast"
+
+// startBroadcast starts broadcasting a successful response when the request names a valid
+// session that is not another client's
+func (s *Server) startBroadcast(c *gin.Context, resp *http.Response) {
+	v, ok := c.Get(broadcastKey)
+	if !ok || resp.StatusCode >= 300 {
+		return
+	}
+	w := v.(*broadcastWriter)
+	session := c.GetHeader(sessionHeader)
+	if !sessionIDPattern.MatchString(session) {
+		slog.Warn("Ignoring invalid session ID", "session", session)
+		return
+	}
+	owner := ""
+	if p := principalFrom(c); p != nil {
+		owner = p.Name
+	}
+	if w.gen = s.broadcast.begin(session, owner); w.gen == nil {
+		slog.Warn("Not broadcasting: the session belongs to another client", "session", session, "client", owner)
+		return
+	}
+	w.session = session
+}
+
+// handleSessionStream relays a session's generation to a subscriber: the buffered prefix at
+// once, then the rest as it arrives. ?wait=30s waits that long for a generation to start.
+func (s *Server) handleSessionStream(c *gin.Context) {
+	session := c.Param("session")
+	if !sessionIDPattern.MatchString(session) {
+		handleError(c, api.ErrBadRequest("invalid session ID %q", session))
+		return
+	}
+	var wait time.Duration
+	if v := c.Query("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			handleError(c, api.ErrBadRequest("invalid wait %q", v))
+			return
+		}
+		wait = min(d, maxBroadcastWait)
+	}
+
+	ctx := c.Request.Context()
+	g := s.broadcast.lookup(ctx, session, wait)
+	if g == nil {
+		handleError(c, api.ErrNotFound("no generation in session %q", session))
+		return
+	}
+	// Only the client that started a session may watch it
+	if p := principalFrom(c); p != nil && p.Name != g.owner {
+		handleError(c, api.ErrNotFound("no generation in session %q", session))
+		return
+	}
+
+	s.broadcast.subscribers.Add(1)
+	defer s.broadcast.subscribers.Add(-1)
+	offset := 0
+	for {
+		data, done, truncated, changed := g.next(offset)
+		// The content type is known once the relay has written
+		if offset == 0 && !c.Writer.Written() && (len(data) > 0 || done) {
+			if contentType := g.mediaType(); contentType != "" {
+				c.Header("Content-Type", contentType)
+			}
+			c.Header("Cache-Control", "no-cache")
+			c.Writer.WriteHeaderNow()
+		}
+		if len(data) > 0 {
+			if _, err := c.Writer.Write(data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			offset += len(data)
+		}
+		if done {
+			if truncated && strings.HasPrefix(g.mediaType(), "text/event-stream") {
+				c.Writer.Write(broadcastTruncatedChunk(s.broadcast.maxBuffer))
+				c.Writer.Flush()
+			}
+			return
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// broadcastTruncatedChunk tells a subscriber the broadcast stopped before the response ended
+func broadcastTruncatedChunk(limit int) []byte {
+	return []byte(`data: {"error":{"message":"broadcast stopped: response exceeds ` + strconv.Itoa(limit) +
+		` bytes","type":"broadcast_truncated"}}` + "\n\ndata: [DONE]\n\n")
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcast_LateJoiner(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"one\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"two\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Broadcast: config.BroadcastConfig{Enabled: true}}, "127.0.0.1", 0)
+	proxy := httptest.NewServer(s.router)
+	defer proxy.Close()
+
+	// A viewer waiting before the generation starts
+	waiting := make(chan string)
+	go func() {
+		resp, err := http.Get(proxy.URL + "/v1/sessions/demo/stream?wait=5s")
+		if err != nil {
+			waiting <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		waiting <- string(data)
+	}()
+
+	req, _ := http.NewRequest("POST", proxy.URL+"/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(sessionHeader, "demo")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// A late joiner gets the buffered prefix at once
+	late, err := http.Get(proxy.URL + "/v1/sessions/demo/stream")
+	require.NoError(t, err)
+	defer late.Body.Close()
+	assert.Equal(t, "text/event-stream", late.Header.Get("Content-Type"))
+	buf := make([]byte, 512)
+	n, err := late.Body.Read(buf)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), `"one"`)
+
+	// ... and follows the rest live, as does the early viewer
+	close(release)
+	client, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(late.Body)
+	require.NoError(t, err)
+	assert.Equal(t, string(client), string(buf[:n])+string(rest))
+	select {
+	case got := <-waiting:
+		assert.Equal(t, string(client), got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting viewer did not finish")
+	}
+
+	// Sessions that never started are not found
+	missing, err := http.Get(proxy.URL + "/v1/sessions/other/stream")
+	require.NoError(t, err)
+	missing.Body.Close()
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestBroadcastHub_TruncateAndLinger(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := newBroadcastHub(config.BroadcastConfig{Enabled: true, MaxBuffer: 8, Linger: time.Minute}, metrics.NewRegistry())
+	h.clock = fake
+
+	g := h.begin("s1", "")
+	g.append([]byte("12345"), "text/event-stream")
+	g.append([]byte("67890"), "text/event-stream")
+	data, done, truncated, _ := g.next(0)
+	assert.Equal(t, "12345", string(data))
+	assert.True(t, done)
+	assert.True(t, truncated)
+	assert.Equal(t, "text/event-stream", g.mediaType())
+
+	// A finished generation stays until the linger period passes
+	h.end("s1", g)
+	assert.Same(t, g, h.lookup(context.Background(), "s1", 0))
+	fake.Advance(time.Minute)
+	assert.Nil(t, h.lookup(context.Background(), "s1", 0))
+
+	// A newer generation in the session is not removed by the older one's linger
+	old := h.begin("s2", "")
+	h.end("s2", old)
+	newer := h.begin("s2", "")
+	fake.Advance(time.Minute)
+	assert.Same(t, newer, h.lookup(context.Background(), "s2", 0))
+
+	// Another client cannot take over a session while it holds a generation
+	ci := h.begin("s3", "ci")
+	require.NotNil(t, ci)
+	assert.Nil(t, h.begin("s3", "laptop"))
+	assert.Same(t, ci, h.lookup(context.Background(), "s3", 0))
+	h.end("s3", ci)
+	assert.Nil(t, h.begin("s3", "laptop"))
+	fake.Advance(time.Minute)
+	assert.NotNil(t, h.begin("s3", "laptop"))
+}
+
+func TestBroadcast_OtherClient(t *testing.T) {
+	s := NewServer(&config.Config{
+		Broadcast: config.BroadcastConfig{Enabled: true},
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "ci", Key: "ci-key"}, {Name: "laptop", Key: "laptop-key"}},
+			Lockout: config.LockoutConfig{MaxFailures: 5, Base: time.Second, Max: time.Minute},
+		},
+	}, "127.0.0.1", 0)
+	g := s.broadcast.begin("pair", "ci")
+	g.append([]byte(`{"ok":true}`), "application/json")
+	g.finish()
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/sessions/pair/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	w := get("ci-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"ok":true}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("laptop-key").Code)
+}
+
+func TestBroadcast_AsClientReceives(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"one\"}}]}\n\n"))
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"two\"},\"finish_reason\":\"stop\"}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Broadcast: config.BroadcastConfig{Enabled: true}}, "127.0.0.1", 0)
+	proxy := httptest.NewServer(s.router)
+	defer proxy.Close()
+
+	// Viewers get the response translated and framed as the client gets it, to its last byte
+	for _, path := range []string{"/api/chat", anthropicMessagesPath} {
+		req, _ := http.NewRequest("POST", proxy.URL+path, strings.NewReader(`{"model": "glm-4.7", "max_tokens": 100, "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(sessionHeader, "translated")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		client, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(client))
+
+		viewer, err := http.Get(proxy.URL + "/v1/sessions/translated/stream")
+		require.NoError(t, err)
+		got, err := io.ReadAll(viewer.Body)
+		viewer.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, resp.Header.Get("Content-Type"), viewer.Header.Get("Content-Type"), path)
+		assert.Equal(t, string(client), string(got), path)
+		assert.NotContains(t, string(got), "[DONE]", path)
+	}
+}
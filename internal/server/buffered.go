@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamDowngradeHeader tells a client its streaming request was answered in one piece, and why
+const streamDowngradeHeader = "X-Stream-Downgraded"
+
+// bufferedReason reports why a client cannot consume a streamed response, or "" if it can.
+// HTTP/1.0 has no chunked transfer encoding, and some clients (e.g. Windows PowerShell's
+// Invoke-RestMethod) buffer the whole body and hand back raw SSE text.
+func (s *Server) bufferedReason(c *gin.Context) string {
+	if !c.Request.ProtoAtLeast(1, 1) {
+		return "http/1.0"
+	}
+	ua := strings.ToLower(c.Request.UserAgent())
+	for _, pattern := range s.config.BufferedUserAgents {
+		if pattern != "" && strings.Contains(ua, strings.ToLower(pattern)) {
+			return "user-agent"
+		}
+	}
+	return ""
+}
+
+// downgradeStream turns a streaming request from a client that cannot consume streams into a
+// non-streaming one, so the client receives the aggregated completion as a single JSON body
+func (s *Server) downgradeStream(c *gin.Context, bodyMap map[string]any) {
+	if stream, _ := bodyMap["stream"].(bool); !stream {
+		return
+	}
+	reason := s.bufferedReason(c)
+	if reason == "" {
+		return
+	}
+
+	bodyMap["stream"] = false
+	delete(bodyMap, "stream_options")
+	c.Header(streamDowngradeHeader, reason)
+	slog.Info("Streaming request downgraded to a single response", "reason", reason,
+		"proto", c.Request.Proto, "user_agent", c.Request.UserAgent(), "model", bodyMap["model"])
+}
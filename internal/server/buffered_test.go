@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatCompletions_BufferedClients(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody = nil
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		if upstreamBody["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, BufferedUserAgents: []string{"WindowsPowerShell/"}}, "127.0.0.1", 0)
+
+	tests := []struct {
+		name       string
+		proto      string
+		userAgent  string
+		downgraded string
+	}{
+		{"Streaming Client", "HTTP/1.1", "curl/8.5.0", ""},
+		{"HTTP/1.0", "HTTP/1.0", "curl/8.5.0", "http/1.0"},
+		{"PowerShell", "HTTP/1.1", "Mozilla/5.0 (Windows NT; Windows NT 10.0; en-US) WindowsPowerShell/5.1.19041.4291", "user-agent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(
+				`{"model": "GLM-4.7", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "hi"}]}`))
+			req.Proto = tt.proto
+			req.ProtoMajor, req.ProtoMinor, _ = http.ParseHTTPVersion(tt.proto)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.downgraded, w.Header().Get(streamDowngradeHeader))
+			if tt.downgraded == "" {
+				assert.Equal(t, true, upstreamBody["stream"])
+				assert.Contains(t, w.Body.String(), "data: [DONE]")
+				return
+			}
+			assert.Equal(t, false, upstreamBody["stream"])
+			assert.Nil(t, upstreamBody["stream_options"])
+			assert.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`, w.Body.String())
+		})
+	}
+}
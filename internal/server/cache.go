@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// cacheHeader reports whether a cacheable response was served from the cache
+const cacheHeader = "X-Cache"
+
+// Defaults for the response cache
+const (
+	defaultCacheMaxEntries    = 1000
+	defaultCacheTTL           = time.Hour
+	defaultCacheMaxEntryBytes = 1 << 20
+)
+
+// cachedResponse is a stored upstream answer
+type cachedResponse struct {
+	key         string
+	contentType string
+	body        []byte
+	stored      time.Time
+}
+
+// responseCache keeps successful non-streaming answers to deterministic chat requests, those
+// with temperature 0, so repeats are served without reaching upstream. Entries expire after the
+// TTL, and the least recently used go first when the cache is full.
+type responseCache struct {
+	maxEntries    int
+	ttl           time.Duration
+	maxEntryBytes int
+	clock         clock.Clock
+	lookups       *metrics.Counter
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Values are *cachedResponse
+	order   *list.List               // Most recently used first
+	hits    int64
+	misses  int64
+}
+
+// newResponseCache creates the cache, or returns nil when it is disabled
+func newResponseCache(cfg config.CacheConfig, registry *metrics.Registry) *responseCache {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &responseCache{
+		maxEntries:    cmp.Or(cfg.MaxEntries, defaultCacheMaxEntries),
+		ttl:           cmp.Or(cfg.TTL, defaultCacheTTL),
+		maxEntryBytes: cmp.Or(cfg.MaxEntryBytes, defaultCacheMaxEntryBytes),
+		clock:         clock.Real{},
+		lookups: registry.Counter("copilot_proxy_response_cache_total",
+			"Lookups of cacheable chat requests in the response cache", "result"),
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// cacheKey returns the cache key of a chat request, or "" when its answer must not be cached:
+// the cache is off, the request streams or samples, or the client sent Cache-Control: no-store.
+// The body is the marshaled upstream request, whose keys encoding/json sorts, so equal requests
+// hash alike however the client ordered its fields. With client authentication on, each
+// client has its own entries, so one cannot read answers to another's prompts.
+func (s *Server) cacheKey(c *gin.Context, target *upstream, bodyMap map[string]any, body []byte) string {
+	if s.cache == nil || strings.Contains(c.GetHeader("Cache-Control"), "no-store") {
+		return ""
+	}
+	if stream, _ := bodyMap["stream"].(bool); stream {
+		return ""
+	}
+	if temperature, ok := bodyMap["temperature"].(float64); !ok || temperature != 0 {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(target.name))
+	h.Write([]byte{0})
+	if p := principalFrom(c); p != nil {
+		h.Write([]byte(p.Name))
+	}
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns a response built from the cache entry for key, or nil on a miss. Clients
+// sending Cache-Control: no-cache always miss, refreshing the entry.
+func (rc *responseCache) lookup(c *gin.Context, key string) *http.Response {
+	if key == "" {
+		return nil
+	}
+	entry := rc.get(key)
+	if entry == nil || strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+		rc.count(false)
+		c.Header(cacheHeader, "miss")
+		return nil
+	}
+	rc.count(true)
+	c.Header(cacheHeader, "hit")
+	c.Header("Age", strconv.Itoa(int(rc.clock.Since(entry.stored).Seconds())))
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {entry.contentType}},
+		Body:          io.NopCloser(bytes.NewReader(entry.body)),
+		ContentLength: int64(len(entry.body)),
+	}
+}
+
+// count records a hit or a miss
+func (rc *responseCache) count(hit bool) {
+	rc.mu.Lock()
+	if hit {
+		rc.hits++
+	} else {
+		rc.misses++
+	}
+	rc.mu.Unlock()
+	if hit {
+		rc.lookups.Inc("hit")
+	} else {
+		rc.lookups.Inc("miss")
+	}
+}
+
+// get returns the live entry for key, dropping it if it expired
+func (rc *responseCache) get(key string) *cachedResponse {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cachedResponse)
+	if rc.clock.Since(entry.stored) >= rc.ttl {
+		rc.order.Remove(el)
+		delete(rc.entries, key)
+		return nil
+	}
+	rc.order.MoveToFront(el)
+	return entry
+}
+
+// store keeps a successful upstream answer under key. The body has already been buffered by
+// validation; it is read and put back for the relay.
+func (rc *responseCache) store(key string, resp *http.Response) {
+	if key == "" || resp.StatusCode != http.StatusOK {
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(data), resp.Body}
+	if err != nil || len(data) > rc.maxEntryBytes {
+		return
+	}
+
+	entry := &cachedResponse{key: key, contentType: resp.Header.Get("Content-Type"), body: data, stored: rc.clock.Now()}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[key]; ok {
+		el.Value = entry
+		rc.order.MoveToFront(el)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(entry)
+	for rc.order.Len() > rc.maxEntries {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// flush empties the cache and returns how many entries it held
+func (rc *responseCache) flush() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	n := rc.order.Len()
+	clear(rc.entries)
+	rc.order.Init()
+	return n
+}
+
+// handleCacheStats reports the cache's size and hit counts
+func (s *Server) handleCacheStats(c *gin.Context) {
+	if s.cache == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":     true,
+		"entries":     s.cache.order.Len(),
+		"max_entries": s.cache.maxEntries,
+		"ttl":         s.cache.ttl.String(),
+		"hits":        s.cache.hits,
+		"misses":      s.cache.misses,
+	})
+}
+
+// handleFlushCache empties the response cache
+func (s *Server) handleFlushCache(c *gin.Context) {
+	flushed := 0
+	if s.cache != nil {
+		flushed = s.cache.flush()
+	}
+	c.JSON(http.StatusOK, gin.H{"flushed": flushed})
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`))
+	}))
+	defer upstream.Close()
+
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Cache: config.CacheConfig{Enabled: true, TTL: time.Minute}, Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+	s.cache.clock = fake
+	chat := func(body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	const deterministic = `{"model": "glm-4.7", "stream": false, "temperature": 0, "messages": [{"role": "user", "content": "2+2?"}]}`
+
+	first := chat(deterministic)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "miss", first.Header().Get(cacheHeader))
+
+	// The same request with its fields in another order is served from the cache
+	second := chat(`{"messages": [{"role": "user", "content": "2+2?"}], "temperature": 0, "stream": false, "model": "glm-4.7"}`)
+	assert.Equal(t, "hit", second.Header().Get(cacheHeader))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Sampled requests and no-store bypass the cache; no-cache refreshes the entry
+	assert.Empty(t, chat(strings.Replace(deterministic, `"temperature": 0`, `"temperature": 0.7`, 1)).Header().Get(cacheHeader))
+	assert.Empty(t, chat(deterministic, "Cache-Control", "no-store").Header().Get(cacheHeader))
+	assert.Equal(t, "miss", chat(deterministic, "Cache-Control", "no-cache").Header().Get(cacheHeader))
+	assert.Equal(t, int32(4), calls.Load())
+
+	// Entries expire after the TTL
+	fake.Advance(time.Minute)
+	assert.Equal(t, "miss", chat(deterministic).Header().Get(cacheHeader))
+	assert.Equal(t, int32(5), calls.Load())
+
+	// The admin endpoints report and flush the cache
+	admin := func(method string) map[string]any {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, adminRequest(method, "/admin/cache", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got
+	}
+	stats := admin("GET")
+	assert.Equal(t, 1.0, stats["entries"])
+	assert.Equal(t, 1.0, stats["hits"])
+	assert.Equal(t, 3.0, stats["misses"])
+	assert.Equal(t, 1.0, admin("DELETE")["flushed"])
+	assert.Equal(t, "miss", chat(deterministic).Header().Get(cacheHeader))
+}
+
+func TestResponseCache_PerClient(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		BaseURL: upstream.URL,
+		Cache:   config.CacheConfig{Enabled: true},
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "alice", Key: "alice-key"}, {Name: "bob", Key: "bob-key"}},
+			Lockout: config.LockoutConfig{MaxFailures: 5, Base: time.Minute, Max: time.Hour},
+		},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+	chat := func(key string) string {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "glm-4.7", "temperature": 0, "messages": [{"role": "user", "content": "2+2?"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Get(cacheHeader)
+	}
+
+	// One client's cached answers are not served to another
+	assert.Equal(t, "miss", chat("alice-key"))
+	assert.Equal(t, "miss", chat("bob-key"))
+	assert.Equal(t, "hit", chat("alice-key"))
+	assert.Equal(t, "hit", chat("bob-key"))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestResponseCache_Eviction(t *testing.T) {
+	rc := newResponseCache(config.CacheConfig{Enabled: true, MaxEntries: 2, MaxEntryBytes: 8}, metrics.NewRegistry())
+	store := func(key, body string) {
+		rc.store(key, &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))})
+	}
+	store("a", "1")
+	store("b", "2")
+	require.NotNil(t, rc.get("a"))
+	store("c", "3")
+
+	// The least recently used entry goes first; oversized answers are not kept
+	assert.Nil(t, rc.get("b"))
+	assert.NotNil(t, rc.get("a"))
+	assert.NotNil(t, rc.get("c"))
+	store("d", "too large to keep")
+	assert.Nil(t, rc.get("d"))
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// canaryKey is the gin context key holding the *canaryTag of a request to a model under rollout
+const canaryKey = "canary"
+
+// canaryTag records how a request to a model under rollout was routed, for usage records
+type canaryTag struct {
+	requested string // Canonical model the client asked for
+	arm       string // "canary" when served by the rollout model, else "control"
+}
+
+// canaryRoute sends a percentage of one model's requests to another
+type canaryRoute struct {
+	Model   string  `json:"model"`   // Requested model, canonical
+	Target  string  `json:"target"`  // Model serving the canary share, canonical
+	Percent float64 `json:"percent"` // 0-100
+}
+
+// canaryRouter holds the rollouts, which the admin API can change while serving
+type canaryRouter struct {
+	mu     sync.RWMutex
+	routes map[string]canaryRoute // Keyed by canonical requested model
+	rand   func() float64         // [0, 1)
+}
+
+// newCanaryRouter builds a router from the configured rollouts (validated by the serve command)
+func newCanaryRouter(cfg map[string]config.CanaryConfig) *canaryRouter {
+	r := &canaryRouter{routes: make(map[string]canaryRoute, len(cfg)), rand: rand.Float64}
+	for from, cc := range cfg {
+		if err := r.set(from, cc.Model, cc.Percent); err != nil {
+			slog.Error("Canary ignored", "model", from, "error", err)
+		}
+	}
+	return r
+}
+
+// set starts, adjusts or (with percent 0 and no target) removes the rollout for model
+func (r *canaryRouter) set(model, target string, percent float64) error {
+	if !models.IsValidModel(model) {
+		return api.ErrNotFound("model '%s' not found", model)
+	}
+	if percent < 0 || percent > 100 {
+		return api.ErrBadRequest("percent must be between 0 and 100")
+	}
+	from := models.GetCanonicalModelName(model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	route, exists := r.routes[from]
+	if target == "" {
+		if !exists {
+			return api.ErrBadRequest("no canary for '%s'; a target model is required", model)
+		}
+		if percent == 0 {
+			delete(r.routes, from)
+			return nil
+		}
+	} else {
+		if !models.IsValidModel(target) {
+			return api.ErrNotFound("model '%s' not found", target)
+		}
+		route.Target = models.GetCanonicalModelName(target)
+		if route.Target == from {
+			return api.ErrBadRequest("canary target must differ from the model")
+		}
+	}
+	route.Model, route.Percent = from, percent
+	r.routes[from] = route
+	return nil
+}
+
+// list returns the rollouts sorted by model
+func (r *canaryRouter) list() []canaryRoute {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]canaryRoute, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Model < routes[j].Model })
+	return routes
+}
+
+// route picks the canary or control arm for a request to a model under rollout, rewriting
+// the body's model for the canary arm and tagging the request for usage records. Clients not
+// allowed the canary model always get the control arm.
+func (r *canaryRouter) route(c *gin.Context, bodyMap map[string]any) {
+	model, _ := bodyMap["model"].(string)
+	from := models.GetCanonicalModelName(model)
+
+	r.mu.RLock()
+	route, ok := r.routes[from]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	tag := &canaryTag{requested: from, arm: "control"}
+	messages, _ := bodyMap["messages"].([]any)
+	if r.rand()*100 < route.Percent && (!hasImages(messages) || models.HasCapability(route.Target, "vision")) && allowedModel(c, route.Target) {
+		tag.arm = "canary"
+		bodyMap["model"] = route.Target
+	}
+	c.Set(canaryKey, tag)
+}
+
+// canaryFrom returns the request's canary tag, or nil when no rollout applied
+func canaryFrom(c *gin.Context) *canaryTag {
+	if v, ok := c.Get(canaryKey); ok {
+		if tag, ok := v.(*canaryTag); ok {
+			return tag
+		}
+	}
+	return nil
+}
+
+// canaryRequest is the body accepted by the canary admin endpoint
+type canaryRequest struct {
+	Model   string   `json:"model"`
+	Target  string   `json:"target"`  // Optional when adjusting an existing rollout
+	Percent *float64 `json:"percent"` // 0 with no target ends the rollout
+}
+
+// handleListCanaries returns the current rollouts
+func (s *Server) handleListCanaries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"canaries": s.canary.list()})
+}
+
+// handleSetCanary starts, adjusts or ends a rollout while serving. Routing applies to every
+// client, so only the admin may change it, and every change is written to the log as an
+// audit event.
+func (s *Server) handleSetCanary(c *gin.Context) {
+	if !isAdmin(c) {
+		handleError(c, api.ErrForbidden("changing canaries requires the admin token"))
+		return
+	}
+
+	var req canaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if req.Model == "" || req.Percent == nil {
+		handleError(c, api.ErrBadRequest("model and percent are required"))
+		return
+	}
+	if err := s.canary.set(req.Model, req.Target, *req.Percent); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	slog.Info("Canary updated", "audit", "canary_update", "client", actorName(c), "ip", c.ClientIP(),
+		"model", req.Model, "target", req.Target, "percent", *req.Percent)
+	c.JSON(http.StatusOK, gin.H{"canaries": s.canary.list()})
+}
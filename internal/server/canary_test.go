@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/usage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanaryRouter_Set(t *testing.T) {
+	r := newCanaryRouter(map[string]config.CanaryConfig{"GLM-4.7-Flash": {Model: "GLM-4.7", Percent: 10}})
+	assert.Equal(t, []canaryRoute{{Model: "glm-4.7-flash", Target: "glm-4.7", Percent: 10}}, r.list())
+
+	// Adjusting keeps the target
+	assert.NoError(t, r.set("glm-4.7-flash", "", 50))
+	assert.Equal(t, []canaryRoute{{Model: "glm-4.7-flash", Target: "glm-4.7", Percent: 50}}, r.list())
+
+	assert.Error(t, r.set("GLM-4.7-FlashX", "", 10), "new rollouts need a target")
+	assert.Error(t, r.set("glm-4.7-flash", "glm-4.7-flash", 10))
+	assert.Error(t, r.set("glm-4.7-flash", "nope", 10))
+	assert.Error(t, r.set("glm-4.7-flash", "", 101))
+
+	// Zero without a target ends the rollout
+	assert.NoError(t, r.set("glm-4.7-flash", "", 0))
+	assert.Empty(t, r.list())
+}
+
+func TestChatCompletions_Canary(t *testing.T) {
+	var served string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		served = body["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Usage:   config.UsageConfig{Ledger: true, Dir: dir},
+		Canary:  map[string]config.CanaryConfig{"glm-4.7-flash": {Model: "glm-4.7", Percent: 30}},
+	}, "127.0.0.1", 0)
+
+	send := func(model string, roll float64) {
+		s.canary.rand = func() float64 { return roll }
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("GLM-4.7-Flash", 0.29)
+	assert.Equal(t, "glm-4.7", served)
+	send("GLM-4.7-Flash", 0.3)
+	assert.Equal(t, "glm-4.7-flash", served)
+	send("GLM-4.7-FlashX", 0)
+	assert.Equal(t, "glm-4.7-flashx", served)
+
+	records, err := usage.ReadMonth(dir, time.Now())
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, []string{"glm-4.7", "glm-4.7-flash", "canary"}, []string{records[0].Model, records[0].RequestedModel, records[0].Canary})
+		assert.Equal(t, []string{"glm-4.7-flash", "glm-4.7-flash", "control"}, []string{records[1].Model, records[1].RequestedModel, records[1].Canary})
+		assert.Equal(t, []string{"glm-4.7-flashx", "", ""}, []string{records[2].Model, records[2].RequestedModel, records[2].Canary})
+	}
+}
+
+func TestCanaryRouter_Allowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newCanaryRouter(map[string]config.CanaryConfig{"glm-4.7-flash": {Model: "glm-4.7", Percent: 100}})
+	r.rand = func() float64 { return 0 }
+	route := func(p *auth.Principal) (string, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if p != nil {
+			c.Set(principalKey, p)
+		}
+		body := map[string]any{"model": "glm-4.7-flash"}
+		r.route(c, body)
+		return body["model"].(string), canaryFrom(c).arm
+	}
+
+	model, arm := route(&auth.Principal{Name: "bob", Models: []string{"glm-4.7-flash"}})
+	assert.Equal(t, "glm-4.7-flash", model, "the canary model is not on bob's allowlist")
+	assert.Equal(t, "control", arm)
+
+	model, arm = route(&auth.Principal{Name: "alice"})
+	assert.Equal(t, "glm-4.7", model)
+	assert.Equal(t, "canary", arm)
+}
+
+func TestCanaryAdmin(t *testing.T) {
+	s := NewServer(&config.Config{
+		Auth:  config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+		Admin: config.AdminConfig{Token: "admin-secret"},
+	}, "127.0.0.1", 0)
+
+	call := func(method, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/canary", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("POST", `{"model": "glm-4.7-flash", "target": "glm-4.7", "percent": 10}`, "admin-secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"canaries": [{"model": "glm-4.7-flash", "target": "glm-4.7", "percent": 10}]}`, w.Body.String())
+
+	w = call("GET", "", "admin-secret")
+	assert.JSONEq(t, `{"canaries": [{"model": "glm-4.7-flash", "target": "glm-4.7", "percent": 10}]}`, w.Body.String())
+
+	w = call("POST", `{"model": "glm-4.7-flash"}`, "admin-secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = call("POST", `{"model": "nope", "target": "glm-4.7", "percent": 10}`, "admin-secret")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = call("POST", `{"model": "glm-4.7-flash", "percent": 0}`, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Without an admin token or listener the endpoint is not served, so client keys cannot
+	// change routing for everyone
+	s = NewServer(&config.Config{
+		Auth: config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+	}, "127.0.0.1", 0)
+	w = call("POST", `{"model": "glm-4.7-flash", "target": "glm-4.7", "percent": 10}`, "alice-key")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, s.canary.list())
+}
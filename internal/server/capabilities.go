@@ -0,0 +1,165 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// capabilitiesVersion is the schema version of /api/capabilities. It changes only when a field
+// is removed or changes meaning; new fields are added without a bump, so clients should ignore
+// fields they do not know.
+const capabilitiesVersion = 1
+
+// capabilities describes what this proxy instance does, so clients can adapt without probing
+type capabilities struct {
+	Version       int                    `json:"version"`
+	ProxyVersion  string                 `json:"proxy_version"`
+	Dialects      map[string]dialectInfo `json:"dialects"`
+	Thinking      thinkingInfo           `json:"thinking"`
+	ToolStreaming toolStreamingInfo      `json:"tool_streaming"`
+	Budgets       budgetsInfo            `json:"budgets"`
+	SharedState   string                 `json:"shared_state"` // Backend of quotas and limits: memory, sqlite or redis
+	Features      map[string]bool        `json:"features"`
+	Headers       []string               `json:"headers"` // Request headers the proxy acts on
+}
+
+// dialectInfo lists the endpoints served in one API dialect
+type dialectInfo struct {
+	Endpoints []string `json:"endpoints"` // "METHOD /path"
+}
+
+// thinkingInfo describes reasoning control
+type thinkingInfo struct {
+	Models      []string `json:"models"`                 // Models that reason by default; "think": false or X-Thinking: off turns it off
+	MaxDuration string   `json:"max_duration,omitempty"` // Streams still reasoning after this long are cut off
+	Fallback    bool     `json:"fallback"`               // Cut-off requests are retried without thinking
+}
+
+// toolStreamingInfo describes incremental streaming of tool call arguments
+type toolStreamingInfo struct {
+	Models []string `json:"models"` // Enabled automatically for streamed requests with tools
+}
+
+// budgetsInfo lists the size limits applied to requests; zero values are omitted
+type budgetsInfo struct {
+	ImageMaxCost        float64 `json:"image_max_cost,omitempty"` // USD per prompt before images are downgraded
+	ImageDowngrade      bool    `json:"image_downgrade"`
+	ToolResultMaxChars  int     `json:"tool_result_max_chars,omitempty"`
+	ToolResultMode      string  `json:"tool_result_mode,omitempty"`
+	PromptIncludesBytes int     `json:"prompt_includes_max_bytes,omitempty"`
+	GitContextTokens    int     `json:"git_context_tokens,omitempty"`
+	EmbeddingsMaxInputs int     `json:"embeddings_max_inputs,omitempty"`
+}
+
+// handleCapabilities describes the enabled proxy features
+func (s *Server) handleCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, s.capabilities(c))
+}
+
+// capabilities builds the description, with per-client settings resolved for the caller
+func (s *Server) capabilities(c *gin.Context) capabilities {
+	cfg := s.config
+	profile := s.profileFor(c)
+
+	caps := capabilities{
+		Version:      capabilitiesVersion,
+		ProxyVersion: proxyVersion,
+		Dialects:     s.dialects(),
+		Thinking: thinkingInfo{
+			Models:   []string{},
+			Fallback: cfg.Thinking.Fallback,
+		},
+		ToolStreaming: toolStreamingInfo{Models: toolStreamModels},
+		Budgets: budgetsInfo{
+			ImageMaxCost:        cfg.Images.MaxCost,
+			ImageDowngrade:      cfg.Images.Downgrade,
+			ToolResultMaxChars:  cfg.ToolResults.MaxChars,
+			PromptIncludesBytes: cfg.Prompts.MaxBytes,
+			GitContextTokens:    cfg.GitContext.TokenBudget,
+			EmbeddingsMaxInputs: cfg.Embeddings.MaxInputs,
+		},
+		SharedState: "memory",
+		Features: map[string]bool{
+			"auth":               cfg.Auth.Enabled(),
+			"broadcast":          s.broadcast != nil,
+			"cancellation":       true,
+			"canary":             len(cfg.Canary) > 0,
+			"catalog_views":      s.catalogViews != nil,
+			"dataset":            s.dataset != nil,
+			"dead_links":         cfg.Links.Mode != "" && cfg.Links.Mode != "off",
+			"environment":        profile.Environment.Enabled,
+			"failover":           s.failover != nil,
+			"fallbacks":          s.fallbacks != nil,
+			"model_snapshots":    len(cfg.ModelSnapshots) > 0,
+			"opentelemetry":      s.otel != nil,
+			"prompt_cache":       cfg.PromptCache.Enabled,
+			"providers":          len(s.providers) > 0,
+			"response_cache":     s.cache != nil,
+			"retries":            s.retry != nil,
+			"stream_annotations": profile.Annotations,
+			"split_stream":       profile.SplitStream,
+			"tracing":            s.tracer != nil,
+			"upstream_selection": len(s.upstreams) > 0,
+			"usage_quotas":       s.quotas != nil && cfg.Auth.Quotas.Enabled(),
+		},
+		Headers: []string{modelSnapshotHeader, linkCheckHeader, thinkingHeader, reasoningHeader},
+	}
+	if cfg.ToolResults.MaxChars > 0 {
+		caps.Budgets.ToolResultMode = cfg.ToolResults.Mode
+	}
+	if cfg.Thinking.MaxDuration > 0 {
+		caps.Thinking.MaxDuration = cfg.Thinking.MaxDuration.String()
+	}
+	for _, m := range models.Catalog.Models {
+		if slices.Contains(m.Capabilities, "thinking") && s.defaultThinkingMode(m.Model) == thinkingEnabled {
+			caps.Thinking.Models = append(caps.Thinking.Models, m.Model)
+		}
+	}
+	if cfg.Storage.Backend != "" {
+		caps.SharedState = cfg.Storage.Backend
+	}
+
+	if len(cfg.Profiles) > 0 {
+		caps.Headers = append(caps.Headers, profileHeader)
+	}
+	if len(s.upstreams) > 0 {
+		caps.Headers = append(caps.Headers, upstreamHeader)
+	}
+	if s.fallbacks != nil {
+		caps.Headers = append(caps.Headers, fallbackHeader)
+	}
+	if s.otel != nil {
+		caps.Headers = append(caps.Headers, otelTraceHeader)
+	}
+	if s.dataset != nil {
+		caps.Headers = append(caps.Headers, datasetTagHeader)
+	}
+	if profile.Environment.Enabled {
+		caps.Headers = append(caps.Headers, workspaceHeader)
+	}
+	if s.tracer != nil && cfg.Trace.Header != "" {
+		caps.Headers = append(caps.Headers, cfg.Trace.Header)
+	}
+	return caps
+}
+
+// dialects groups the registered API endpoints by dialect, leaving out management endpoints
+func (s *Server) dialects() map[string]dialectInfo {
+	dialects := make(map[string]dialectInfo)
+	for _, r := range s.router.Routes() {
+		if isManagementPath(r.Path) || r.Path == "/healthz" || r.Method == http.MethodHead {
+			continue
+		}
+		name := dialectOf(r.Path)
+		d := dialects[name]
+		d.Endpoints = append(d.Endpoints, r.Method+" "+r.Path)
+		dialects[name] = d
+	}
+	for _, d := range dialects {
+		slices.Sort(d.Endpoints)
+	}
+	return dialects
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		Thinking:    config.ThinkingConfig{MaxDuration: 90 * time.Second},
+		ToolResults: config.ToolResultsConfig{MaxChars: 20000, Mode: "truncate"},
+		Embeddings:  config.EmbeddingsConfig{Models: []string{"embedding-3"}, MaxInputs: 64},
+		Upstreams:   map[string]config.UpstreamConfig{"eu": {BaseURL: "http://eu.example"}},
+		Profiles:    map[string]config.ProfileConfig{"zed": {SplitStream: true}},
+	}, "127.0.0.1", 0)
+	get := func(profile string) capabilities {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/capabilities", nil)
+		req.Header.Set(profileHeader, profile)
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var caps capabilities
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &caps))
+		return caps
+	}
+
+	caps := get("")
+	assert.Equal(t, capabilitiesVersion, caps.Version)
+	assert.Equal(t, proxyVersion, caps.ProxyVersion)
+	assert.Contains(t, caps.Dialects["openai"].Endpoints, "POST /v1/chat/completions")
+	assert.Contains(t, caps.Dialects["ollama"].Endpoints, "POST /api/embed")
+	assert.Equal(t, []string{"POST /v1/messages"}, caps.Dialects["anthropic"].Endpoints)
+	assert.NotContains(t, caps.Dialects["openai"].Endpoints, "GET /metrics")
+	assert.Contains(t, caps.Thinking.Models, "glm-4.7")
+	assert.NotContains(t, caps.Thinking.Models, "glm-4-flash-250414")
+	assert.Equal(t, "1m30s", caps.Thinking.MaxDuration)
+	assert.Equal(t, []string{"glm-4.7", "glm-4.7-flash", "glm-4.7-flashx"}, caps.ToolStreaming.Models)
+	assert.Equal(t, budgetsInfo{ToolResultMaxChars: 20000, ToolResultMode: "truncate", EmbeddingsMaxInputs: 64}, caps.Budgets)
+	assert.Equal(t, "memory", caps.SharedState)
+	assert.True(t, caps.Features["upstream_selection"])
+	assert.False(t, caps.Features["tracing"])
+	assert.False(t, caps.Features["split_stream"])
+	assert.Subset(t, caps.Headers, []string{modelSnapshotHeader, profileHeader, upstreamHeader})
+
+	// Per-client settings follow the caller's profile
+	assert.True(t, get("zed").Features["split_stream"])
+}
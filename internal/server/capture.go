@@ -0,0 +1,33 @@
+package server
+
+import "bytes"
+
+// maxCaptureBytes bounds how much of an upstream response is retained for post-processing
+const maxCaptureBytes = 8 << 20 // 8MB
+
+// captureBuffer records up to maxCaptureBytes of a streamed response while it is forwarded.
+// Writes never fail so a full buffer cannot interrupt the client stream.
+type captureBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// Write implements io.Writer
+func (c *captureBuffer) Write(p []byte) (int, error) {
+	if c.truncated {
+		return len(p), nil
+	}
+	if c.buf.Len()+len(p) > maxCaptureBytes {
+		c.truncated = true
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// Bytes returns the captured data, or nil if the response exceeded the capture limit
+func (c *captureBuffer) Bytes() []byte {
+	if c.truncated {
+		return nil
+	}
+	return c.buf.Bytes()
+}
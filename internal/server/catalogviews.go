@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// viewEntry is one model of a catalog view: the name clients see and the catalog model behind it
+type viewEntry struct {
+	name  string
+	model models.Model
+}
+
+// listed returns the catalog model as the view lists it, renamed when the entry is an alias
+func (e viewEntry) listed() models.Model {
+	m := e.model
+	if !strings.EqualFold(e.name, m.Name) {
+		m.Name, m.Model = e.name, e.name
+	}
+	return m
+}
+
+// catalogView is the part of the catalog a group of clients sees, in catalog order
+type catalogView struct {
+	name    string
+	entries []viewEntry
+}
+
+// resolve returns the catalog model a name the view lists stands for. Names match as catalog
+// lookups do: case-insensitively and with an Ollama ":latest" tag.
+func (v *catalogView) resolve(name string) (string, bool) {
+	bare := strings.TrimSuffix(strings.ToLower(name), ":"+models.DefaultTag)
+	for _, e := range v.entries {
+		if e.name == bare {
+			return e.model.Model, true
+		}
+	}
+	canonical := models.GetCanonicalModelName(name)
+	for _, e := range v.entries {
+		if !strings.EqualFold(e.name, e.model.Name) {
+			continue // Aliased models are only listed under their alias
+		}
+		if e.model.Model == canonical {
+			return e.model.Model, true
+		}
+	}
+	return "", false
+}
+
+// catalogViews maps lowercase client names to their view
+type catalogViews map[string]*catalogView
+
+// ValidateCatalogViews checks the configured catalog views
+func ValidateCatalogViews(cfg *config.Config) error {
+	_, err := newCatalogViews(cfg)
+	return err
+}
+
+// newCatalogViews builds the configured views and assigns them to clients, directly or through
+// the usage export tenants they belong to
+func newCatalogViews(cfg *config.Config) (catalogViews, error) {
+	if len(cfg.CatalogViews) == 0 {
+		return nil, nil
+	}
+	if !cfg.Auth.Enabled() {
+		return nil, fmt.Errorf("views apply to authenticated clients; configure auth keys or oidc")
+	}
+
+	views := make(catalogViews)
+	names := make([]string, 0, len(cfg.CatalogViews))
+	for name := range cfg.CatalogViews {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		vc := cfg.CatalogViews[name]
+		v, err := newCatalogView(name, vc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		clients := slices.Clone(vc.Clients)
+		for _, tenant := range vc.Tenants {
+			tc, ok := findTenant(cfg.Usage.Export.Tenants, tenant)
+			if !ok {
+				return nil, fmt.Errorf("%s: tenant '%s' not found in usage.export.tenants", name, tenant)
+			}
+			clients = append(clients, tc.Clients...)
+		}
+		if len(clients) == 0 {
+			return nil, fmt.Errorf("%s: clients or tenants are required", name)
+		}
+		for _, client := range clients {
+			key := strings.ToLower(client)
+			if other, ok := views[key]; ok && other != v {
+				return nil, fmt.Errorf("%s: client '%s' is already in view '%s'", name, client, other.name)
+			}
+			views[key] = v
+		}
+	}
+	return views, nil
+}
+
+// newCatalogView resolves a view's models and aliases against the catalog
+func newCatalogView(name string, vc config.CatalogViewConfig) (*catalogView, error) {
+	listed := make(map[string]string) // Lowercase listed name to catalog model
+	for _, model := range vc.Models {
+		m, ok := models.GetModel(model)
+		if !ok {
+			return nil, fmt.Errorf("model '%s' not found", model)
+		}
+		listed[strings.ToLower(m.Name)] = m.Model
+	}
+	for alias, model := range vc.Aliases {
+		m, ok := models.GetModel(model)
+		if !ok {
+			return nil, fmt.Errorf("aliases.%s: model '%s' not found", alias, model)
+		}
+		if other, ok := models.GetModel(alias); ok && other.Model != m.Model {
+			return nil, fmt.Errorf("aliases.%s: alias names another catalog model", alias)
+		}
+		listed[strings.ToLower(alias)] = m.Model
+	}
+	if len(listed) == 0 {
+		return nil, fmt.Errorf("models or aliases are required")
+	}
+
+	v := &catalogView{name: name}
+	for _, m := range models.Catalog.Models {
+		var aliases []string
+		for n, model := range listed {
+			if model == m.Model {
+				aliases = append(aliases, n)
+			}
+		}
+		slices.Sort(aliases)
+		for _, n := range aliases {
+			if n == strings.ToLower(m.Name) {
+				n = m.Name
+			}
+			v.entries = append(v.entries, viewEntry{name: n, model: m})
+		}
+	}
+	return v, nil
+}
+
+// findTenant returns a usage export tenant by name; the config loader lowercases map keys
+func findTenant(tenants map[string]config.TenantConfig, name string) (config.TenantConfig, bool) {
+	for key, t := range tenants {
+		if strings.EqualFold(key, name) {
+			return t, true
+		}
+	}
+	return config.TenantConfig{}, false
+}
+
+// catalogViewFor returns the authenticated client's catalog view, or nil when it sees the full
+// catalog
+func (s *Server) catalogViewFor(c *gin.Context) *catalogView {
+	p := principalFrom(c)
+	if p == nil || s.catalogViews == nil {
+		return nil
+	}
+	return s.catalogViews[strings.ToLower(p.Name)]
+}
+
+// catalogFor returns the models a request may list, under the names it sees them by
+func (s *Server) catalogFor(c *gin.Context) []viewEntry {
+	if v := s.catalogViewFor(c); v != nil {
+		return v.entries
+	}
+	entries := make([]viewEntry, len(models.Catalog.Models))
+	for i, m := range models.Catalog.Models {
+		entries[i] = viewEntry{name: m.Name, model: m}
+	}
+	return entries
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogViews(t *testing.T) {
+	var upstreamModel string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		upstreamModel, _ = body["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: upstream.URL,
+		Auth: config.AuthConfig{Keys: []config.ClientKey{
+			{Name: "ci", Key: "ci-key"}, {Name: "contractor", Key: "contractor-key"}, {Name: "admin", Key: "admin-key"},
+		}},
+		Usage: config.UsageConfig{Export: config.UsageExportConfig{Tenants: map[string]config.TenantConfig{
+			"acme": {Clients: []string{"contractor"}},
+		}}},
+		CatalogViews: map[string]config.CatalogViewConfig{
+			"basic": {
+				Clients: []string{"CI"},
+				Tenants: []string{"acme"},
+				Models:  []string{"glm-4.7"},
+				Aliases: map[string]string{"fast": "glm-4.7-flash"},
+			},
+		},
+	}, "127.0.0.1", 0)
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	chat := func(key, model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "stream": false, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	ids := func(key string) []string {
+		var list struct {
+			Data []openAIModel `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(get("/v1/models", key).Body.Bytes(), &list))
+		var ids []string
+		for _, m := range list.Data {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	// Clients in the view, directly or through a tenant, see only its models
+	assert.Equal(t, []string{"GLM-4.7", "fast"}, ids("ci-key"))
+	assert.Equal(t, []string{"GLM-4.7", "fast"}, ids("contractor-key"))
+	assert.Greater(t, len(ids("admin-key")), 2)
+
+	var tags struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	require.NoError(t, json.Unmarshal(get("/api/tags", "ci-key").Body.Bytes(), &tags))
+	require.Len(t, tags.Models, 2)
+	assert.Equal(t, "fast:latest", tags.Models[1].Model)
+
+	w := get("/v1/models/fast", "ci-key")
+	require.Equal(t, http.StatusOK, w.Code)
+	var model openAIModel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &model))
+	assert.Equal(t, "fast", model.ID)
+	assert.Equal(t, http.StatusNotFound, get("/v1/models/glm-4.6v", "ci-key").Code)
+
+	// Aliases resolve to the catalog model; models outside the view are not found
+	require.Equal(t, http.StatusOK, chat("ci-key", "fast:latest").Code)
+	assert.Equal(t, "glm-4.7-flash", upstreamModel)
+	assert.Equal(t, http.StatusNotFound, chat("ci-key", "glm-4.7-flash").Code)
+	assert.Equal(t, http.StatusOK, chat("ci-key", "GLM-4.7").Code)
+	assert.Equal(t, http.StatusOK, chat("admin-key", "glm-4.7-flash").Code)
+}
+
+func TestValidateCatalogViews(t *testing.T) {
+	auth := config.AuthConfig{Keys: []config.ClientKey{{Name: "ci", Key: "k"}}}
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		error string
+	}{
+		{"no auth", config.Config{CatalogViews: map[string]config.CatalogViewConfig{"v": {Clients: []string{"ci"}, Models: []string{"glm-4.7"}}}}, "authenticated"},
+		{"unknown model", config.Config{Auth: auth, CatalogViews: map[string]config.CatalogViewConfig{"v": {Clients: []string{"ci"}, Models: []string{"gpt-4"}}}}, "model 'gpt-4' not found"},
+		{"alias shadows a model", config.Config{Auth: auth, CatalogViews: map[string]config.CatalogViewConfig{"v": {Clients: []string{"ci"}, Aliases: map[string]string{"glm-4.6v": "glm-4.7"}}}}, "another catalog model"},
+		{"unknown tenant", config.Config{Auth: auth, CatalogViews: map[string]config.CatalogViewConfig{"v": {Tenants: []string{"acme"}, Models: []string{"glm-4.7"}}}}, "tenant 'acme' not found"},
+		{"client in two views", config.Config{Auth: auth, CatalogViews: map[string]config.CatalogViewConfig{
+			"a": {Clients: []string{"ci"}, Models: []string{"glm-4.7"}},
+			"b": {Clients: []string{"ci"}, Models: []string{"glm-4.6v"}},
+		}}, "already in view 'a'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCatalogViews(&tt.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.error)
+		})
+	}
+}
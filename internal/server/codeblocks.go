@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+	"github.com/gin-gonic/gin"
+)
+
+// codeBlocksResponse is returned by the code-block extraction endpoint
+type codeBlocksResponse struct {
+	Model  string                  `json:"model"`
+	Blocks []postprocess.CodeBlock `json:"blocks"`
+	Usage  map[string]any          `json:"usage,omitempty"`
+}
+
+// handleCodeBlocks runs a chat completion and returns only the fenced code blocks of the answer
+// as structured JSON, for scripts that don't want to parse markdown. The optional "language"
+// query parameter keeps only blocks tagged with that language.
+func (s *Server) handleCodeBlocks(c *gin.Context) {
+	var bodyMap map[string]any
+	if err := c.ShouldBindJSON(&bodyMap); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+
+	if err := s.validateChatRequest(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// Extraction needs the whole answer
+	bodyMap["stream"] = false
+
+	raw, err := s.complete(c.Request.Context(), principalFrom(c), bodyMap)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage map[string]any `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil || len(resp.Choices) == 0 {
+		handleError(c, api.ErrBadGateway("Unexpected upstream response"))
+		return
+	}
+
+	blocks := postprocess.ExtractCodeBlocks(resp.Choices[0].Message.Content)
+	if lang := c.Query("language"); lang != "" {
+		filtered := []postprocess.CodeBlock{}
+		for _, b := range blocks {
+			if b.Language == lang {
+				filtered = append(filtered, b)
+			}
+		}
+		blocks = filtered
+	}
+
+	model := resp.Model
+	if model == "" {
+		model, _ = bodyMap["model"].(string)
+	}
+
+	c.JSON(http.StatusOK, codeBlocksResponse{Model: model, Blocks: blocks, Usage: resp.Usage})
+}
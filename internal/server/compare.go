@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+	"github.com/gin-gonic/gin"
+)
+
+// compareAnswer is one model's side of a comparison
+type compareAnswer struct {
+	Model   string         `json:"model"`
+	Content string         `json:"content,omitempty"`
+	Usage   map[string]any `json:"usage,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// compareResponse is the body returned by the compare endpoint
+type compareResponse struct {
+	Answers []compareAnswer `json:"answers"`
+	Diff    string          `json:"diff"`
+}
+
+// handleCompare sends one chat request to two models concurrently and returns both answers
+// with a unified diff of the first against the second. The request is a chat completion with
+// "models": ["a", "b"] in place of "model"; it always runs non-streaming.
+func (s *Server) handleCompare(c *gin.Context) {
+	var bodyMap map[string]any
+	if err := c.ShouldBindJSON(&bodyMap); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+
+	list, _ := bodyMap["models"].([]any)
+	if len(list) != 2 {
+		handleError(c, api.ErrBadRequest("models must list exactly two models"))
+		return
+	}
+	delete(bodyMap, "models")
+
+	// Each side gets its own copy of the body, validated as a regular chat request
+	bodies := make([]map[string]any, len(list))
+	for i, m := range list {
+		body := maps.Clone(bodyMap)
+		body["model"] = m
+		body["stream"] = false
+		if err := s.validateChatRequest(c, body); err != nil {
+			handleError(c, err)
+			return
+		}
+		bodies[i] = body
+	}
+
+	answers := make([]compareAnswer, len(bodies))
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answers[i] = s.compareOne(c, body)
+		}()
+	}
+	wg.Wait()
+
+	resp := compareResponse{Answers: answers}
+	if answers[0].Error == "" && answers[1].Error == "" {
+		resp.Diff = postprocess.UnifiedDiff(answers[0].Model, answers[1].Model, answers[0].Content, answers[1].Content)
+	}
+
+	if wantsPlainText(c) {
+		for _, a := range answers {
+			if a.Error != "" {
+				c.String(http.StatusBadGateway, "%s: %s\n", a.Model, a.Error)
+				return
+			}
+		}
+		c.String(http.StatusOK, resp.Diff)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// compareOne runs one side of a comparison; a failure is reported in the answer so the other
+// side is still returned
+func (s *Server) compareOne(c *gin.Context, body map[string]any) compareAnswer {
+	answer := compareAnswer{}
+	answer.Model, _ = body["model"].(string)
+
+	raw, err := s.complete(c.Request.Context(), principalFrom(c), body)
+	if err != nil {
+		answer.Error = err.Error()
+		return answer
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage map[string]any `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil || len(resp.Choices) == 0 {
+		answer.Error = fmt.Sprintf("unexpected upstream response: %.200s", raw)
+		return answer
+	}
+	answer.Content, answer.Usage = resp.Choices[0].Message.Content, resp.Usage
+	return answer
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	answers := map[string]string{
+		"glm-4.7":       "Use a map.\nIt is fast.\n",
+		"glm-4.7-flash": "Use a map.\nIt is simple.\n",
+	}
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, false, body["stream"])
+		assert.Nil(t, body["models"])
+		answer, ok := answers[body["model"].(string)]
+		if !ok {
+			http.Error(w, `{"error":"overloaded"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": answer}}},
+			"usage":   map[string]any{"total_tokens": 10},
+		})
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	post := func(body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/compare", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	const messages = `"messages": [{"role": "user", "content": "How do I dedupe?"}]`
+
+	w := post(`{"models": ["glm-4.7", "glm-4.7-flash"], "stream": true, `+messages+`}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp compareResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Answers, 2) {
+		assert.Equal(t, "glm-4.7", resp.Answers[0].Model)
+		assert.Equal(t, answers["glm-4.7-flash"], resp.Answers[1].Content)
+		assert.Equal(t, 10.0, resp.Answers[0].Usage["total_tokens"])
+	}
+	expected := "--- glm-4.7\n+++ glm-4.7-flash\n@@ -1,2 +1,2 @@\n Use a map.\n-It is fast.\n+It is simple.\n"
+	assert.Equal(t, expected, resp.Diff)
+
+	w = post(`{"models": ["glm-4.7", "glm-4.7-flash"], `+messages+`}`, "text/plain")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, expected, w.Body.String())
+
+	// One side failing still returns the other
+	w = post(`{"models": ["glm-4.7", "glm-4-flash"], `+messages+`}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp = compareResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, answers["glm-4.7"], resp.Answers[0].Content)
+	assert.Contains(t, resp.Answers[1].Error, "503")
+	assert.Empty(t, resp.Diff)
+
+	w = post(`{"models": ["glm-4.7", "glm-4-flash"], `+messages+`}`, "text/plain")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "glm-4-flash: ")
+
+	for _, body := range []string{
+		`{"models": ["glm-4.7"], ` + messages + `}`,
+		`{"model": "glm-4.7", ` + messages + `}`,
+		`{"models": ["glm-4.7", "glm-4.7-flash"]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, post(body, "").Code, body)
+	}
+	assert.Equal(t, http.StatusNotFound, post(`{"models": ["glm-4.7", "no-such-model"], `+messages+`}`, "").Code)
+}
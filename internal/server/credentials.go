@@ -0,0 +1,65 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// rotateKeyRequest is the body accepted by the upstream key rotation endpoint
+type rotateKeyRequest struct {
+	APIKey   string `json:"api_key"`
+	Upstream string `json:"upstream"` // Named upstream with its own key; empty for the default key
+}
+
+// handleRotateKey replaces an upstream API key for new requests without a restart. Streams
+// already in progress finish with the key they started with. Only the admin may rotate keys,
+// never a client key, and every rotation is written to the log as an audit event.
+func (s *Server) handleRotateKey(c *gin.Context) {
+	if !isAdmin(c) {
+		handleError(c, api.ErrForbidden("key rotation requires the admin token"))
+		return
+	}
+
+	var req rotateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	req.APIKey = strings.TrimSpace(req.APIKey)
+	if req.APIKey == "" {
+		handleError(c, api.ErrBadRequest("api_key is required"))
+		return
+	}
+
+	target, name := s.apiKey, "default"
+	if req.Upstream != "" {
+		u, ok := s.namedUpstream(req.Upstream)
+		if !ok {
+			handleError(c, api.ErrNotFound("unknown upstream '%s'", req.Upstream))
+			return
+		}
+		if u.apiKey == s.apiKey {
+			handleError(c, api.ErrBadRequest("upstream '%s' uses the default key; rotate that instead", u.name))
+			return
+		}
+		target, name = u.apiKey, u.name
+	}
+
+	target.set(req.APIKey)
+	slog.Info("Upstream API key rotated", "audit", "key_rotation", "client", actorName(c), "ip", c.ClientIP(),
+		"upstream", name, "key", maskKey(req.APIKey))
+
+	c.JSON(http.StatusOK, gin.H{"upstream": name, "key": maskKey(req.APIKey)})
+}
+
+// maskKey identifies a key in logs and responses by its last four characters
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
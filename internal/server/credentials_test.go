@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateKey(t *testing.T) {
+	var auth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		APIKey:  "old-key",
+		BaseURL: upstream.URL,
+		Auth:    config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+		Admin:   config.AdminConfig{Token: "admin-secret"},
+		Upstreams: map[string]config.UpstreamConfig{
+			"inherits": {},
+			"own":      {APIKey: "own-old-key"},
+		},
+	}, "127.0.0.1", 0)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	chat := func(name string) string {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer alice-key")
+		if name != "" {
+			req.Header.Set(upstreamHeader, name)
+		}
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+		return auth
+	}
+
+	w := post("/admin/upstream-key", `{"api_key": "new-key-123456"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"upstream": "default", "key": "****3456"}`, w.Body.String())
+
+	// The default key and upstreams inheriting it switch; separately keyed upstreams do not
+	assert.Equal(t, "Bearer new-key-123456", chat(""))
+	assert.Equal(t, "Bearer new-key-123456", chat("inherits"))
+	assert.Equal(t, "Bearer own-old-key", chat("own"))
+
+	w = post("/admin/upstream-key", `{"api_key": "own-new-key", "upstream": "OWN"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Bearer own-new-key", chat("own"))
+	assert.Equal(t, "Bearer new-key-123456", chat(""))
+
+	w = post("/admin/upstream-key", `{"api_key": "x", "upstream": "inherits"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "uses the default key")
+
+	w = post("/admin/upstream-key", `{"api_key": "x", "upstream": "nope"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = post("/admin/upstream-key", `{"api_key": " "}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRotateKey_RequiresAdmin(t *testing.T) {
+	rotate := func(router http.Handler, key string) int {
+		req := httptest.NewRequest("POST", "/admin/upstream-key", strings.NewReader(`{"api_key": "new-key"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without an admin token or listener nobody can rotate keys, not even with a client key
+	s := NewServer(&config.Config{
+		APIKey: "old-key",
+		Auth:   config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+	}, "127.0.0.1", 0)
+	assert.Equal(t, http.StatusNotFound, rotate(s.router, "alice-key"))
+	assert.Equal(t, "old-key", s.apiKey.get())
+
+	// Requests on a management listener without a token are the admin's
+	s = NewServer(&config.Config{APIKey: "old-key", Admin: config.AdminConfig{Listen: "127.0.0.1:0"}}, "127.0.0.1", 0)
+	assert.Equal(t, http.StatusOK, rotate(s.managementRouter, ""))
+	assert.Equal(t, "new-key", s.apiKey.get())
+}
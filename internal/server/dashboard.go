@@ -0,0 +1,20 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// grafanaDashboard is a Grafana dashboard for the proxy's metrics, importable as is; Grafana
+// asks for the Prometheus data source on import
+//
+//go:embed grafana_dashboard.json
+var grafanaDashboard []byte
+
+// handleGrafanaDashboard serves the dashboard as a download
+func (s *Server) handleGrafanaDashboard(c *gin.Context) {
+	c.Header("Content-Disposition", `attachment; filename="copilot-proxy-dashboard.json"`)
+	c.Data(http.StatusOK, "application/json", grafanaDashboard)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrafanaDashboard(t *testing.T) {
+	s := NewServer(&config.Config{Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/admin/grafana-dashboard", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "copilot-proxy-dashboard.json")
+
+	var dash struct {
+		Panels []struct {
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &dash))
+
+	// Every metric the dashboard queries is one the proxy registers
+	m := httptest.NewRecorder()
+	s.router.ServeHTTP(m, adminRequest("GET", "/metrics", nil))
+	names := regexp.MustCompile(`copilot_proxy_[a-z_]+`)
+	for _, p := range dash.Panels {
+		for _, target := range p.Targets {
+			for _, name := range names.FindAllString(target.Expr, -1) {
+				assert.True(t, strings.Contains(m.Body.String(), "# TYPE "+name+" ") || optionalMetric(name),
+					"dashboard queries unknown metric %s", name)
+			}
+		}
+	}
+}
+
+// optionalMetric reports whether a metric is only registered when its feature is enabled
+func optionalMetric(name string) bool {
+	switch name {
+	case "copilot_proxy_failover_total", "copilot_proxy_thinking_cutoffs_total", "copilot_proxy_duplicate_rejected_total",
+		"copilot_proxy_ratelimit_throttled_total", "copilot_proxy_auth_failures_total", "copilot_proxy_usage_anomalies_total":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"log/slog"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/dataset"
+	"github.com/gin-gonic/gin"
+)
+
+// datasetTagHeader selects the dataset partition (JSONL file) a request is recorded into
+const datasetTagHeader = "X-Dataset-Tag"
+
+// newDatasetCollector creates the dataset collector, returning nil if it cannot be initialized
+func newDatasetCollector(cfg config.DatasetConfig) *dataset.Collector {
+	dir, err := cfg.DirPath()
+	if err != nil {
+		slog.Error("Dataset collection disabled", "error", err)
+		return nil
+	}
+
+	collector, err := dataset.New(dir, cfg.RedactPII)
+	if err != nil {
+		slog.Error("Dataset collection disabled", "error", err)
+		return nil
+	}
+	slog.Info("Dataset collection enabled", "dir", dir, "redact_pii", cfg.RedactPII)
+	return collector
+}
+
+// recordDataset mirrors a completed prompt/response pair into the dataset
+func (s *Server) recordDataset(c *gin.Context, request map[string]any, response []byte) {
+	if response == nil {
+		slog.Debug("Dataset record skipped: response exceeded capture limit")
+		return
+	}
+
+	tag := c.GetHeader(datasetTagHeader)
+	if tag == "" {
+		tag = dataset.DefaultTag
+	}
+
+	recorded, err := s.dataset.Record(tag, request, response)
+	if err != nil {
+		slog.Error("Failed to record dataset example", "tag", tag, "error", err)
+		return
+	}
+	if recorded {
+		slog.Debug("Dataset example recorded", "tag", tag)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// duplicateGuard rejects identical chat requests repeated by one client beyond a limit, which
+// protects the upstream quota from runaway retry loops
+type duplicateGuard struct {
+	detector   *ratelimit.Duplicates
+	maxRepeats int
+	window     time.Duration
+	webhookURL string
+	client     *http.Client
+	clock      clock.Clock
+
+	rejected *metrics.Counter
+	storms   *metrics.Counter
+}
+
+// newDuplicateGuard creates a guard from the duplicates configuration
+func newDuplicateGuard(cfg config.DuplicatesConfig, registry *metrics.Registry) *duplicateGuard {
+	return &duplicateGuard{
+		detector:   ratelimit.NewDuplicates(cfg.MaxRepeats, cfg.Window),
+		maxRepeats: cfg.MaxRepeats,
+		window:     cfg.Window,
+		webhookURL: cfg.WebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		clock:      clock.Real{},
+		rejected: registry.Counter("copilot_proxy_duplicate_rejected_total",
+			"Requests rejected as repeats of an identical payload", "client"),
+		storms: registry.Counter("copilot_proxy_duplicate_storms_total",
+			"Duplicate request storms detected", "client"),
+	}
+}
+
+// check records the request body for the calling client and returns a 429 error when the
+// same payload has been sent too often
+func (g *duplicateGuard) check(c *gin.Context, body []byte, model string) error {
+	// Anonymous clients are told apart by IP, but share one metric label so the series stay bounded
+	client, label := c.ClientIP(), anonymousClient
+	if p := principalFrom(c); p != nil {
+		client, label = p.Name, p.Name
+	}
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:8])
+
+	allowed, started := g.detector.Seen(client + "|" + hash)
+	if allowed {
+		return nil
+	}
+
+	g.rejected.Inc(label)
+	if started {
+		g.storms.Inc(label)
+		slog.Warn("Duplicate request storm detected", "client", client, "payload", hash, "model", model,
+			"max_repeats", g.maxRepeats, "window", g.window)
+		if g.webhookURL != "" {
+			go g.alert(client, hash, model)
+		}
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(g.window.Seconds()))))
+	return api.ErrTooManyRequests(
+		"identical request repeated more than %d times within %s; check the client for a retry loop and wait %s before sending it again",
+		g.maxRepeats, g.window, g.window)
+}
+
+// alert posts a storm notification to the configured webhook
+func (g *duplicateGuard) alert(client, hash, model string) {
+	payload, err := json.Marshal(map[string]any{
+		"event":       "duplicate_request_storm",
+		"client":      client,
+		"payload":     hash,
+		"model":       model,
+		"max_repeats": g.maxRepeats,
+		"window":      g.window.String(),
+		"detected_at": g.clock.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", g.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Failed to create storm alert", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		slog.Error("Storm alert delivery failed", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("Storm alert webhook returned error", "status", resp.StatusCode)
+	}
+}
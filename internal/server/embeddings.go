@@ -0,0 +1,198 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// handleEmbeddings serves the OpenAI embeddings endpoint, relaying the upstream response as it is
+func (s *Server) handleEmbeddings(c *gin.Context) {
+	s.embed(c, false)
+}
+
+// handleEmbed serves Ollama's embeddings endpoint, translating the upstream response
+func (s *Server) handleEmbed(c *gin.Context) {
+	s.embed(c, true)
+}
+
+// embeddingsUpstream is the upstream embedding requests go to: the configured embeddings base
+// URL, or the default upstream
+func (s *Server) embeddingsUpstream() *upstream {
+	if s.config.Embeddings.BaseURL == "" {
+		return s.defaultUpstream()
+	}
+	return &upstream{baseURL: s.config.Embeddings.BaseURL, apiKey: s.apiKey, signer: s.signer, clock: s.clock}
+}
+
+// embed validates an embeddings request, sends it upstream and writes the response in the
+// client's format
+func (s *Server) embed(c *gin.Context, ollama bool) {
+	var req api.EmbeddingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	model, err := s.validateEmbeddingsRequest(c, &req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if ollama && req.EncodingFormat != "" {
+		handleError(c, api.ErrBadRequest("encoding_format is not supported by /api/embed"))
+		return
+	}
+	if !s.allowUsage(c) {
+		return
+	}
+
+	bodyMap := map[string]any{"model": model, "input": req.Input}
+	if req.Dimensions != nil {
+		bodyMap["dimensions"] = *req.Dimensions
+	}
+	if req.EncodingFormat != "" {
+		bodyMap["encoding_format"] = req.EncodingFormat
+	}
+	if req.User != "" {
+		bodyMap["user"] = req.User
+	}
+	body, err := json.Marshal(bodyMap)
+	if err != nil {
+		handleError(c, api.ErrInternalServer("Failed to prepare upstream request"))
+		return
+	}
+
+	sent := s.clock.Now()
+	path := cmp.Or(s.config.Embeddings.Path, "/embeddings")
+	resp, err := s.embeddingsUpstream().post(c.Request.Context(), s.client, path, body, nil)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			handleError(c, err)
+			return
+		}
+		slog.Error("Embeddings request failed", "error", err)
+		handleError(c, api.ErrBadGateway("Failed to connect to upstream server"))
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		handleError(c, api.ErrBadGateway("Failed to read upstream response"))
+		return
+	}
+
+	var decoded embeddingsResponse
+	if resp.StatusCode < 300 {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			handleError(c, api.ErrBadGateway("Invalid embeddings response from upstream"))
+			return
+		}
+	}
+	labels := requestLabelsFor(c, model)
+	s.usage.record(labels, resp.StatusCode, decoded.Usage)
+	s.recordUsage(c, decoded.Usage)
+	sizes := traffic{request: int64(len(body)), response: int64(len(data))}
+	s.usage.recordTraffic(labels, sizes)
+	s.usage.recordLatency(labels, s.clock.Since(sent), nil)
+	if s.ledger != nil {
+		s.recordLedger(c, model, resp.StatusCode, decoded.Usage, nil, sizes, nil)
+	}
+
+	switch {
+	case resp.StatusCode >= 300 && ollama:
+		// Ollama reports errors as a bare message
+		var upstreamErr map[string]any
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &upstreamErr) == nil && upstreamErr["error"] != nil {
+			msg = errorText(upstreamErr["error"])
+		}
+		c.JSON(resp.StatusCode, gin.H{"error": msg})
+	case ollama:
+		c.JSON(http.StatusOK, decoded.ollama(req.Model, s.clock.Since(sent)))
+	default:
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	}
+}
+
+// validateEmbeddingsRequest checks the model and the input, returning the model's upstream name
+func (s *Server) validateEmbeddingsRequest(c *gin.Context, req *api.EmbeddingsRequest) (string, error) {
+	if req.Model == "" {
+		return "", api.ErrBadRequest("model is required")
+	}
+	// Ollama clients may add a tag
+	model := strings.ToLower(strings.TrimSuffix(req.Model, ":latest"))
+	if !slices.ContainsFunc(s.config.Embeddings.Models, func(m string) bool { return strings.EqualFold(m, model) }) {
+		return "", api.ErrNotFound("model '%s' not found", req.Model)
+	}
+	if p := principalFrom(c); p != nil && !p.AllowsModel(model) {
+		return "", api.ErrForbidden("model '%s' is not allowed for %s", req.Model, p.Name)
+	}
+
+	var inputs []any
+	switch input := req.Input.(type) {
+	case string:
+		inputs = []any{input}
+	case []any:
+		inputs = input
+	}
+	if len(inputs) == 0 {
+		return "", api.ErrBadRequest("input must be a non-empty string or array of strings")
+	}
+	if limit := s.config.Embeddings.MaxInputs; limit > 0 && len(inputs) > limit {
+		return "", api.ErrBadRequest("input has %d texts, more than the limit of %d", len(inputs), limit)
+	}
+	for i, in := range inputs {
+		if text, ok := in.(string); !ok || text == "" {
+			return "", api.ErrBadRequest("input %d must be a non-empty string", i)
+		}
+	}
+	if req.Dimensions != nil && *req.Dimensions <= 0 {
+		return "", api.ErrBadRequest("dimensions must be positive")
+	}
+	switch req.EncodingFormat {
+	case "", "float", "base64":
+	default:
+		return "", api.ErrBadRequest("encoding_format must be float or base64")
+	}
+	return model, nil
+}
+
+// embeddingsResponse is the part of an OpenAI embeddings response that Ollama's format needs.
+// Vectors are kept as they are, whether float arrays or base64.
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int             `json:"index"`
+		Embedding json.RawMessage `json:"embedding"`
+	} `json:"data"`
+	Usage *tokenUsage `json:"usage"`
+}
+
+// ollama translates the response into /api/embed's, ordering the vectors as the inputs were
+func (r embeddingsResponse) ollama(model string, elapsed time.Duration) gin.H {
+	embeddings := make([]json.RawMessage, len(r.Data))
+	for i, d := range r.Data {
+		if d.Index >= 0 && d.Index < len(embeddings) {
+			i = d.Index
+		}
+		embeddings[i] = d.Embedding
+	}
+	resp := gin.H{
+		"model":          model,
+		"embeddings":     embeddings,
+		"total_duration": elapsed.Nanoseconds(),
+	}
+	if r.Usage != nil {
+		resp["prompt_eval_count"] = r.Usage.PromptTokens
+	}
+	return resp
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddings(t *testing.T) {
+	var upstreamPath string
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = nil
+		_ = json.Unmarshal(data, &upstreamBody)
+		if upstreamBody["input"] == "fail" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":"1302","message":"Rate limit reached"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Vectors may come back in any order
+		w.Write([]byte(`{"object":"list","model":"embedding-3","data":[` +
+			`{"object":"embedding","index":1,"embedding":[0.3,0.4]},{"object":"embedding","index":0,"embedding":[0.1,0.2]}],` +
+			`"usage":{"prompt_tokens":6,"total_tokens":6}}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		BaseURL:    mockUpstream.URL + "/api/coding/paas/v4",
+		Embeddings: config.EmbeddingsConfig{BaseURL: mockUpstream.URL + "/api/paas/v4", Path: "/embeddings", Models: []string{"embedding-3"}, MaxInputs: 2},
+		Admin:      config.AdminConfig{Token: testAdminToken},
+	}, "127.0.0.1", 0)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The OpenAI endpoint relays the response unchanged
+	w := post("/v1/embeddings", `{"model": "Embedding-3", "input": ["one", "two"], "dimensions": 256}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "/api/paas/v4/embeddings", upstreamPath)
+	assert.Equal(t, map[string]any{"model": "embedding-3", "input": []any{"one", "two"}, "dimensions": float64(256)}, upstreamBody)
+	assert.Contains(t, w.Body.String(), `"object":"list"`)
+
+	// Ollama's endpoint gets the vectors in input order
+	w = post("/api/embed", `{"model": "embedding-3:latest", "input": ["one", "two"], "truncate": true, "keep_alive": "5m"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "embedding-3:latest", resp["model"])
+	assert.Equal(t, []any{[]any{0.1, 0.2}, []any{0.3, 0.4}}, resp["embeddings"])
+	assert.Equal(t, float64(6), resp["prompt_eval_count"])
+	assert.NotContains(t, upstreamBody, "truncate")
+
+	// Upstream errors keep their status; Ollama clients get a bare message
+	w = post("/v1/embeddings", `{"model": "embedding-3", "input": "fail"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"1302"`)
+	w = post("/api/embed", `{"model": "embedding-3", "input": "fail"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"error": "Rate limit reached"}`, w.Body.String())
+
+	metrics := httptest.NewRecorder()
+	s.router.ServeHTTP(metrics, adminRequest("GET", "/metrics", nil))
+	assert.Contains(t, metrics.Body.String(), `copilot_proxy_tokens_total{model="embedding-3",client="anonymous",dialect="ollama",type="prompt"} 6`)
+
+	// Invalid requests never reach upstream
+	upstreamBody = nil
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"model": "glm-4.7", "input": "hi"}`, http.StatusNotFound},
+		{`{"model": "embedding-3"}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": []}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": ["a", ""]}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": [[1, 2]]}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": ["a", "b", "c"]}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": "a", "dimensions": 0}`, http.StatusBadRequest},
+		{`{"model": "embedding-3", "input": "a", "encoding_format": "int8"}`, http.StatusBadRequest},
+	} {
+		assert.Equal(t, tt.status, post("/v1/embeddings", tt.body).Code, tt.body)
+	}
+	assert.Equal(t, http.StatusBadRequest, post("/api/embed", `{"model": "embedding-3", "input": "a", "encoding_format": "base64"}`).Code)
+	assert.Nil(t, upstreamBody)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultReprobeInterval is how often an unreachable base URL is probed when unconfigured
+const defaultReprobeInterval = 30 * time.Second
+
+// endpoints remembers which of a provider's base URLs is in use: the primary, or the first
+// backup that accepted a connection after it failed. While a backup is in use the primary is
+// probed in the background and used again once it accepts connections.
+type endpoints struct {
+	backups  []string
+	interval time.Duration
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu      sync.Mutex
+	active  int    // Index into primary followed by backups; 0 is the primary
+	primary string // Primary URL last requested, probed while a backup is in use
+	probing bool
+	done    chan struct{}
+}
+
+// newEndpoints tracks the backups of a base URL, or returns nil when there are none
+func newEndpoints(backups []string, interval, connectTimeout time.Duration) *endpoints {
+	if len(backups) == 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = defaultReprobeInterval
+	}
+	return &endpoints{
+		backups:  backups,
+		interval: interval,
+		dial:     (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		done:     make(chan struct{}),
+	}
+}
+
+// order lists the base URLs to try for primary: the one in use first, then the others in
+// configured order. Each comes with its index for reporting back with use.
+func (e *endpoints) order(primary string) ([]string, []int) {
+	if e == nil {
+		return []string{primary}, []int{0}
+	}
+	all := append([]string{primary}, e.backups...)
+
+	e.mu.Lock()
+	e.primary = primary
+	active := e.active
+	e.mu.Unlock()
+
+	urls, idx := []string{all[active]}, []int{active}
+	for i, u := range all {
+		if i != active {
+			urls, idx = append(urls, u), append(idx, i)
+		}
+	}
+	return urls, idx
+}
+
+// use records that the base URL at index i accepted a connection, probing the primary while
+// another one is in use
+func (e *endpoints) use(i int, baseURL string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active == i {
+		return
+	}
+	slog.Warn("Switched upstream endpoint", "from", e.endpoint(e.active), "to", baseURL)
+	e.active = i
+	if i != 0 && !e.probing {
+		e.probing = true
+		go e.probe()
+	}
+}
+
+// endpoint returns the base URL at index i; the caller holds mu
+func (e *endpoints) endpoint(i int) string {
+	if i == 0 {
+		return e.primary
+	}
+	return e.backups[i-1]
+}
+
+// probe dials the primary at each interval until it accepts a connection, then switches back
+func (e *endpoints) probe() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		}
+
+		e.mu.Lock()
+		primary := e.primary
+		e.mu.Unlock()
+		if !e.reachable(primary) {
+			continue
+		}
+
+		e.mu.Lock()
+		if e.active != 0 {
+			slog.Info("Primary upstream endpoint reachable again", "endpoint", primary)
+			e.active = 0
+		}
+		e.probing = false
+		e.mu.Unlock()
+		return
+	}
+}
+
+// reachable reports whether a TCP connection to the URL's host can be made
+func (e *endpoints) reachable(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+	conn, err := e.dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// close stops probing
+func (e *endpoints) close() {
+	if e != nil {
+		close(e.done)
+	}
+}
+
+// connectFailed reports whether a request failed before reaching a server, so sending it to
+// another endpoint cannot duplicate it: DNS failures and refused or timed out connections
+func connectFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// closedURL returns the URL of a port nothing listens on
+func closedURL(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func TestChatCompletions_EndpointFailover(t *testing.T) {
+	var primaryHits, backupHits atomic.Int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer backup.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	send := func(s *Server) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// An unreachable primary moves requests to the backup, which stays in use
+	s := NewServer(&config.Config{
+		BaseURL:        closedURL(t),
+		BackupBaseURLs: []string{closedURL(t), backup.URL},
+		Endpoints:      config.EndpointsConfig{ReprobeInterval: time.Hour},
+	}, "127.0.0.1", 0)
+	defer s.endpoints.close()
+	assert.Equal(t, http.StatusOK, send(s))
+	assert.Equal(t, int32(1), backupHits.Load())
+	urls, _ := s.endpoints.order(s.config.BaseURL)
+	assert.Equal(t, backup.URL, urls[0])
+	assert.Equal(t, http.StatusOK, send(s))
+	assert.Equal(t, int32(2), backupHits.Load())
+
+	// A primary that answers, even with an error, is not retried elsewhere
+	s = NewServer(&config.Config{
+		BaseURL:        failing.URL,
+		BackupBaseURLs: []string{backup.URL},
+	}, "127.0.0.1", 0)
+	defer s.endpoints.close()
+	assert.Equal(t, http.StatusServiceUnavailable, send(s))
+	assert.Equal(t, int32(1), primaryHits.Load())
+	assert.Equal(t, int32(2), backupHits.Load())
+}
+
+func TestEndpoints_Reprobe(t *testing.T) {
+	var reachable atomic.Bool
+	e := newEndpoints([]string{"https://backup.example"}, 10*time.Millisecond, time.Second)
+	defer e.close()
+	var dialed atomic.Value
+	e.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Store(addr)
+		if !reachable.Load() {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	urls, idx := e.order("https://primary.example/api")
+	assert.Equal(t, []string{"https://primary.example/api", "https://backup.example"}, urls)
+	assert.Equal(t, []int{0, 1}, idx)
+
+	e.use(1, "https://backup.example")
+	urls, idx = e.order("https://primary.example/api")
+	assert.Equal(t, []string{"https://backup.example", "https://primary.example/api"}, urls)
+	assert.Equal(t, []int{1, 0}, idx)
+
+	// The primary is used again once it accepts connections
+	time.Sleep(50 * time.Millisecond)
+	urls, _ = e.order("https://primary.example/api")
+	assert.Equal(t, "https://backup.example", urls[0])
+	reachable.Store(true)
+	assert.Eventually(t, func() bool {
+		urls, _ := e.order("https://primary.example/api")
+		return urls[0] == "https://primary.example/api"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "primary.example:443", dialed.Load())
+
+	var none *endpoints
+	urls, idx = none.order("https://primary.example")
+	assert.Equal(t, []string{"https://primary.example"}, urls)
+	assert.Equal(t, []int{0}, idx)
+	none.use(0, "https://primary.example")
+	none.close()
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceHeader names the client's workspace, such as the open project, for the environment message
+const workspaceHeader = "X-Workspace"
+
+// maxWorkspaceName bounds the header value placed in the prompt
+const maxWorkspaceName = 100
+
+// DefaultEnvironmentTemplate is the environment message used when a profile sets no template
+const DefaultEnvironmentTemplate = `Current date and time: {{.Weekday}}, {{.Date}} {{.Time}} ({{.Timezone}}, UTC{{.Offset}}).
+Operating system: {{.OS}}.{{if .Workspace}}
+Workspace: {{.Workspace}}.{{end}}`
+
+// environmentData is available to environment templates
+type environmentData struct {
+	Date      string // 2006-01-02
+	Time      string // 15:04
+	Weekday   string
+	Timezone  string // IANA name, e.g. Europe/Warsaw
+	Offset    string // +02:00
+	OS        string
+	Workspace string // From the X-Workspace header; may be empty
+}
+
+// environmentSetup is a profile's parsed template and time zone
+type environmentSetup struct {
+	tmpl *template.Template
+	loc  *time.Location
+}
+
+// environments caches setups by configuration, since profiles are resolved per request
+var environments sync.Map // config.EnvironmentConfig -> *environmentSetup
+
+// ValidateEnvironment checks a profile's environment template and time zone
+func ValidateEnvironment(cfg config.EnvironmentConfig) error {
+	_, err := parseEnvironment(cfg)
+	return err
+}
+
+// parseEnvironment prepares an environment configuration for use
+func parseEnvironment(cfg config.EnvironmentConfig) (*environmentSetup, error) {
+	if cached, ok := environments.Load(cfg); ok {
+		return cached.(*environmentSetup), nil
+	}
+
+	src := cfg.Template
+	if src == "" {
+		src = DefaultEnvironmentTemplate
+	}
+	tmpl, err := template.New("environment").Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	setup := &environmentSetup{tmpl: tmpl, loc: loc}
+	environments.Store(cfg, setup)
+	return setup, nil
+}
+
+// injectEnvironment adds a system message with the current date, time and environment when
+// the client's profile asks for it. It goes after any leading system messages, so the
+// client's own system prompt stays first.
+func (s *Server) injectEnvironment(c *gin.Context, bodyMap map[string]any) {
+	cfg := s.profileFor(c).Environment
+	if !cfg.Enabled {
+		return
+	}
+	setup, err := parseEnvironment(cfg)
+	if err != nil {
+		// Validated by the serve command
+		slog.Error("Skipping environment message", "error", err)
+		return
+	}
+
+	now := s.clock.Now().In(setup.loc)
+	var text strings.Builder
+	err = setup.tmpl.Execute(&text, environmentData{
+		Date:      now.Format("2006-01-02"),
+		Time:      now.Format("15:04"),
+		Weekday:   now.Weekday().String(),
+		Timezone:  now.Location().String(),
+		Offset:    now.Format("-07:00"),
+		OS:        osName(runtime.GOOS),
+		Workspace: workspaceName(c.GetHeader(workspaceHeader)),
+	})
+	if err != nil {
+		slog.Error("Skipping environment message", "error", err)
+		return
+	}
+
+	messages := bodyMap["messages"].([]any)
+	at := 0
+	for at < len(messages) {
+		if msg, _ := messages[at].(map[string]any); msg["role"] != "system" {
+			break
+		}
+		at++
+	}
+	// The message changes every minute. With prompt caching it goes just before the newest
+	// message, so the conversation before it stays a prefix the upstream cache can reuse.
+	if s.config.PromptCache.Enabled {
+		at = max(at, len(messages)-1)
+	}
+	// A new slice, since compare shares the messages between its two requests
+	out := make([]any, 0, len(messages)+1)
+	out = append(out, messages[:at]...)
+	out = append(out, map[string]any{"role": "system", "content": text.String()})
+	bodyMap["messages"] = append(out, messages[at:]...)
+}
+
+// osName returns the display name of a GOOS value
+func osName(goos string) string {
+	switch goos {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	case "windows":
+		return "Windows"
+	case "freebsd":
+		return "FreeBSD"
+	}
+	return goos
+}
+
+// workspaceName cleans a client-supplied workspace name for use in a prompt: one line of
+// printable text, cut to a bounded length
+func workspaceName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	if runes := []rune(name); len(runes) > maxWorkspaceName {
+		name = string(runes[:maxWorkspaceName])
+	}
+	return name
+}
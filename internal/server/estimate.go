@@ -0,0 +1,86 @@
+package server
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// estimateResponse is returned by the token estimation endpoint
+type estimateResponse struct {
+	Model           string       `json:"model"`
+	PromptTokens    int          `json:"prompt_tokens"`
+	ContextLength   int          `json:"context_length"`
+	RemainingTokens int          `json:"remaining_tokens"`     // Context left for the completion
+	MaxTokens       *int         `json:"max_tokens,omitempty"` // As requested
+	Fits            bool         `json:"fits"`                 // Prompt plus max_tokens fit the context
+	EstimatedCost   estimateCost `json:"estimated_cost"`
+	Method          string       `json:"method"`
+}
+
+// estimateCost is the list-price cost of the prompt and of a completion of max_tokens
+type estimateCost struct {
+	Currency   string  `json:"currency"`
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	Total      float64 `json:"total"`
+}
+
+// handleEstimate estimates prompt tokens, remaining context and cost for a chat payload
+// without calling upstream, so agents can decide whether to compact history first
+func (s *Server) handleEstimate(c *gin.Context) {
+	var bodyMap map[string]any
+	if err := c.ShouldBindJSON(&bodyMap); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	messages, _ := bodyMap["messages"].([]any)
+	ollamaImageParts(messages)
+
+	if err := s.validateChatRequest(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	name, _ := bodyMap["model"].(string)
+	model, _ := models.GetModel(name)
+
+	contextLength, _ := s.modelLimits(name)
+	prompt := tokens.Request(bodyMap)
+	remaining := max(contextLength-prompt, 0)
+
+	resp := estimateResponse{
+		Model:           model.Model,
+		PromptTokens:    prompt,
+		ContextLength:   contextLength,
+		RemainingTokens: remaining,
+		Fits:            prompt < contextLength,
+		Method:          "heuristic",
+	}
+
+	completion := 0
+	if v, ok := bodyMap["max_tokens"].(float64); ok && v > 0 {
+		maxTokens := int(v)
+		resp.MaxTokens = &maxTokens
+		resp.Fits = prompt+maxTokens <= contextLength
+		completion = min(maxTokens, remaining)
+	}
+
+	resp.EstimatedCost = estimateCost{
+		Currency:   "USD",
+		Prompt:     roundCost(model.Cost(prompt, 0)),
+		Completion: roundCost(model.Cost(0, completion)),
+		Total:      roundCost(model.Cost(prompt, completion)),
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// roundCost rounds a USD amount to a millionth of a dollar
+func roundCost(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/models"
+)
+
+// failoverHeader names the local model that answered when the cloud was unavailable
+const failoverHeader = "X-Failover"
+
+// cloudOnlyFields are request fields that only the Z.AI API understands
+var cloudOnlyFields = []string{"thinking", "tool_stream"}
+
+// failover relays chat requests to a local Ollama instance through its OpenAI-compatible API
+// when the cloud API cannot be reached
+type failover struct {
+	url      string
+	models   map[string]string // Canonical cloud model -> local model
+	fallback string            // Local model for cloud models not in models
+	client   *http.Client
+	used     *metrics.Counter
+}
+
+// newFailover creates the failover target from configuration
+func newFailover(cfg config.FailoverConfig, registry *metrics.Registry) *failover {
+	mapped := make(map[string]string, len(cfg.Models))
+	for cloud, local := range cfg.Models {
+		mapped[models.GetCanonicalModelName(cloud)] = local
+	}
+	return &failover{
+		url:      strings.TrimSuffix(cfg.OllamaURL, "/"),
+		models:   mapped,
+		fallback: cfg.Model,
+		// Local models may need a while to load, so no header timeout
+		client: &http.Client{},
+		used: registry.Counter("copilot_proxy_failover_total",
+			"Chat requests answered by the local Ollama failover", "model", "local_model"),
+	}
+}
+
+// localModel returns the local model standing in for a cloud model, or "" if there is none
+func (f *failover) localModel(cloud string) string {
+	if local, ok := f.models[models.GetCanonicalModelName(cloud)]; ok {
+		return local
+	}
+	return f.fallback
+}
+
+// cloudUnavailable reports whether an upstream attempt failed in a way failover should cover:
+// a connection error or a gateway status. Client cancellation never triggers failover.
+func cloudUnavailable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends the prepared upstream body to the local instance with the model swapped
+func (f *failover) do(ctx context.Context, bodyMap map[string]any) (*http.Response, string, error) {
+	cloud := fmt.Sprint(bodyMap["model"])
+	local := f.localModel(cloud)
+	if local == "" {
+		return nil, "", fmt.Errorf("no local model configured for %s", cloud)
+	}
+
+	body := maps.Clone(bodyMap)
+	body["model"] = local
+	for _, field := range cloudOnlyFields {
+		delete(body, field)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", f.url+"/v1/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	f.used.Inc(cloud, local)
+	slog.Warn("Cloud API unavailable, answered by local Ollama", "model", cloud, "local_model", local)
+	return resp, local, nil
+}
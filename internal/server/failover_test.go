@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailover(t *testing.T) {
+	var local map[string]any
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		local = nil
+		json.NewDecoder(r.Body).Decode(&local)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"local","choices":[{"index":0,"message":{"role":"assistant","content":"offline answer"}}]}`))
+	}))
+	defer ollama.Close()
+
+	cloudStatus := http.StatusServiceUnavailable
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(cloudStatus)
+		w.Write([]byte(`{"error":"cloud says no"}`))
+	}))
+	defer cloud.Close()
+
+	newServer := func(baseURL string) *Server {
+		return NewServer(&config.Config{
+			BaseURL: baseURL,
+			Failover: config.FailoverConfig{
+				OllamaURL: ollama.URL,
+				Models:    map[string]string{"glm-4.7": "qwen2.5-coder:7b"},
+				Model:     "llama3.2",
+			},
+		}, "127.0.0.1", 0)
+	}
+
+	send := func(s *Server, model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "tools": [], "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Gateway status", func(t *testing.T) {
+		w := send(newServer(cloud.URL), "GLM-4.7")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "offline answer")
+		assert.Equal(t, "ollama/qwen2.5-coder:7b", w.Header().Get(failoverHeader))
+
+		// Translated for Ollama: local model, no Z.AI-only fields
+		assert.Equal(t, "qwen2.5-coder:7b", local["model"])
+		assert.NotContains(t, local, "thinking")
+		assert.NotContains(t, local, "tool_stream")
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		w := send(newServer("http://127.0.0.1:1"), "GLM-4.7-Flash")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ollama/llama3.2", w.Header().Get(failoverHeader))
+	})
+
+	t.Run("Client error is not failed over", func(t *testing.T) {
+		cloudStatus = http.StatusBadRequest
+		defer func() { cloudStatus = http.StatusServiceUnavailable }()
+
+		w := send(newServer(cloud.URL), "GLM-4.7")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get(failoverHeader))
+	})
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackHeader turns fallbacks off for a request when sent as "off", and names the fallback
+// model that answered on responses
+const fallbackHeader = "X-Fallback"
+
+// fallbackChains retries chat requests against other models while a model's upstream is rate
+// limited or failing
+type fallbackChains struct {
+	chains map[string][]string // Canonical model -> canonical fallbacks, in order
+	used   *metrics.Counter
+}
+
+// newFallbackChains creates the chains from configuration
+func newFallbackChains(cfg map[string][]string, registry *metrics.Registry) *fallbackChains {
+	chains := make(map[string][]string, len(cfg))
+	for model, fallbacks := range cfg {
+		canonical := make([]string, len(fallbacks))
+		for i, f := range fallbacks {
+			canonical[i] = models.GetCanonicalModelName(f)
+		}
+		chains[models.GetCanonicalModelName(model)] = canonical
+	}
+	return &fallbackChains{
+		chains: chains,
+		used: registry.Counter("copilot_proxy_fallback_total",
+			"Chat requests retried against a fallback model", "model", "fallback", "reason"),
+	}
+}
+
+// fallbackReason reports why an upstream attempt should move on to the next model: a rate
+// limit, a server error or a failed connection. Client cancellation never does.
+func fallbackReason(ctx context.Context, resp *http.Response, err error) (string, bool) {
+	if ctx.Err() != nil {
+		return "", false
+	}
+	if err != nil {
+		return "connection", !errors.Is(err, context.Canceled)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return strconv.Itoa(resp.StatusCode), true
+	}
+	return "", false
+}
+
+// fallbackBody is the prepared upstream body sent to another model, without the fields the
+// fallback does not support
+func fallbackBody(bodyMap map[string]any, model string) map[string]any {
+	body := maps.Clone(bodyMap)
+	body["model"] = model
+	if !models.HasCapability(model, "thinking") {
+		delete(body, "thinking")
+	}
+	if !slices.Contains(toolStreamModels, model) {
+		delete(body, "tool_stream")
+	}
+	return body
+}
+
+// upstreamBodyFor returns the body sent to target: on the default upstream the model is swapped
+// for its snapshot, and providers with explicit prompt caching get a breakpoint. bodyMap is
+// left alone.
+func upstreamBodyFor(target *upstream, bodyMap map[string]any, snapshot string) map[string]any {
+	body := bodyMap
+	if target.name == "" && snapshot != "" && snapshot != bodyMap["model"] {
+		body = maps.Clone(bodyMap)
+		body["model"] = snapshot
+	}
+	if target.cacheControl {
+		body = markCachePrefix(body)
+	}
+	return body
+}
+
+// tryFallbacks sends the request down the fallback chain of model, the catalog model the
+// request was routed for, while attempts fail, starting from the first attempt's outcome.
+// Fallbacks the client is not allowed are skipped, and each is routed and prepared for its own
+// upstream. The last attempt is returned whether or not it succeeded; when a fallback answers,
+// bodyMap takes its model. Requests sent to an explicitly chosen upstream, or with fallbacks
+// turned off, are left alone.
+func (s *Server) tryFallbacks(c *gin.Context, ctx context.Context, model string, bodyMap map[string]any, target *upstream, resp *http.Response, err error, extra http.Header) (*upstream, *http.Response, error) {
+	if s.fallbacks == nil || c.GetHeader(upstreamHeader) != "" || strings.EqualFold(c.GetHeader(fallbackHeader), "off") {
+		return target, resp, err
+	}
+	for _, next := range s.fallbacks.chains[model] {
+		reason, ok := fallbackReason(ctx, resp, err)
+		if !ok {
+			break
+		}
+		if !allowedModel(c, next) {
+			continue
+		}
+
+		nextTarget := s.routeUpstream(next)
+		body := fallbackBody(bodyMap, next)
+		nextTarget.mapModel(body)
+		// The client's snapshot override names a snapshot of the requested model, so only pins apply
+		snapshot := ""
+		if nextTarget.name == "" {
+			if snapshot = s.pinnedSnapshot(next); snapshot == "" {
+				snapshot = next
+			}
+		}
+		data, merr := json.Marshal(upstreamBodyFor(nextTarget, body, snapshot))
+		if merr != nil {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		slog.Warn("Upstream failed, trying fallback model", "model", model, "fallback", next, "reason", reason)
+		s.fallbacks.used.Inc(model, next, reason)
+
+		target = nextTarget
+		resp, err = target.do(ctx, s.client, data, extra)
+		s.hooks.observeUpstream(ctx, target.name, resp, err)
+		if _, failed := fallbackReason(ctx, resp, err); !failed {
+			clear(bodyMap)
+			maps.Copy(bodyMap, body)
+			c.Header(fallbackHeader, next)
+			// An empty snapshot removes the header of the first attempt
+			c.Header(modelSnapshotHeader, snapshot)
+			break
+		}
+	}
+	return target, resp, err
+}
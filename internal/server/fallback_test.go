@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbacks(t *testing.T) {
+	// Each model answers with its configured status; the models tried are recorded in order
+	statuses := map[string]int{}
+	var tried []string
+	var last map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = nil
+		json.NewDecoder(r.Body).Decode(&last)
+		model := last["model"].(string)
+		tried = append(tried, model)
+		w.Header().Set("Content-Type", "application/json")
+		if status := statuses[model]; status != 0 {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"` + model + ` failed"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"1","model":"` + model + `","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:   upstream.URL,
+		Fallbacks: map[string][]string{"GLM-4.7": {"GLM-4.6V", "GLM-4-Flash-250414"}},
+		Admin:     config.AdminConfig{Token: testAdminToken},
+	}, "127.0.0.1", 0)
+
+	send := func(model string, header string) *httptest.ResponseRecorder {
+		tried = nil
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "tools": [{"type": "function", "function": {"name": "f"}}], "stream": false, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(fallbackHeader, header)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Rate limited", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.7": http.StatusTooManyRequests}
+		w := send("glm-4.7", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"glm-4.7", "glm-4.6v"}, tried)
+		assert.Equal(t, "glm-4.6v", w.Header().Get(fallbackHeader))
+
+		metrics := httptest.NewRecorder()
+		s.router.ServeHTTP(metrics, adminRequest("GET", "/metrics", nil))
+		assert.Contains(t, metrics.Body.String(), `copilot_proxy_fallback_total{model="glm-4.7",fallback="glm-4.6v",reason="429"} 1`)
+		assert.Contains(t, metrics.Body.String(), `copilot_proxy_requests_total{model="glm-4.6v",client="anonymous",dialect="openai",status="200",status_class="2xx"} 1`)
+	})
+
+	t.Run("Down the chain", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.7": http.StatusInternalServerError, "glm-4.6v": http.StatusServiceUnavailable}
+		w := send("glm-4.7", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"glm-4.7", "glm-4.6v", "glm-4-flash-250414"}, tried)
+		assert.Equal(t, "glm-4-flash-250414", w.Header().Get(fallbackHeader))
+		// The last fallback does not reason, so thinking is not sent to it
+		assert.NotContains(t, last, "thinking")
+	})
+
+	t.Run("Chain exhausted", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.7": 500, "glm-4.6v": 502, "glm-4-flash-250414": 503}
+		w := send("glm-4.7", "")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Len(t, tried, 3)
+		assert.Empty(t, w.Header().Get(fallbackHeader))
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.7": http.StatusBadRequest}
+		w := send("glm-4.7", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, []string{"glm-4.7"}, tried)
+	})
+
+	t.Run("Opt out", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.7": http.StatusTooManyRequests}
+		w := send("glm-4.7", "off")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, []string{"glm-4.7"}, tried)
+	})
+
+	t.Run("Models without a chain", func(t *testing.T) {
+		statuses = map[string]int{"glm-4.6v": http.StatusTooManyRequests}
+		w := send("glm-4.6v", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, []string{"glm-4.6v"}, tried)
+	})
+}
+
+func TestFallbacks_Providers(t *testing.T) {
+	// Both upstreams answer 503 for the failing model
+	var failing string
+	serve := func(bodies *[]map[string]any) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			*bodies = append(*bodies, body)
+			w.Header().Set("Content-Type", "application/json")
+			if body["model"] == failing {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error":"unavailable"}`))
+				return
+			}
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+		}))
+	}
+	var zaiBodies, routerBodies []map[string]any
+	zai := serve(&zaiBodies)
+	defer zai.Close()
+	router := serve(&routerBodies)
+	defer router.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:        zai.URL,
+		ModelSnapshots: map[string]string{"glm-4.7-flash": "glm-4.7-flash-0925"},
+		Providers:      []config.ProviderConfig{{Name: "openrouter", BaseURL: router.URL, Models: []string{"GLM-4.6V"}, CacheControl: true}},
+		Fallbacks:      map[string][]string{"glm-4.7": {"glm-4.6v"}, "glm-4.6v": {"glm-4.7-flash"}},
+	}, "127.0.0.1", 0)
+	send := func(model string) *httptest.ResponseRecorder {
+		failing, zaiBodies, routerBodies = model, nil, nil
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A fallback served by a provider is prepared for it
+	w := send("glm-4.7")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "glm-4.6v", w.Header().Get(fallbackHeader))
+	assert.Equal(t, "openrouter", w.Header().Get(upstreamHeader))
+	assert.Empty(t, w.Header().Get(modelSnapshotHeader))
+	require.Len(t, routerBodies, 1)
+	system := routerBodies[0]["messages"].([]any)[0].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Be brief.", "cache_control": map[string]any{"type": "ephemeral"}}}, system["content"])
+
+	// A provider-routed model has its chain, and a fallback on the default upstream its pin
+	w = send("glm-4.6v")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "glm-4.7-flash", w.Header().Get(fallbackHeader))
+	assert.Equal(t, "glm-4.7-flash-0925", w.Header().Get(modelSnapshotHeader))
+	require.Len(t, zaiBodies, 1)
+	assert.Equal(t, "glm-4.7-flash-0925", zaiBodies[0]["model"])
+}
+
+func TestFallbacks_Allowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var tried []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		tried = append(tried, body["model"].(string))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:   upstream.URL,
+		Fallbacks: map[string][]string{"glm-4.7": {"glm-4.6v", "glm-4.7-flash"}},
+	}, "127.0.0.1", 0)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Set(principalKey, &auth.Principal{Name: "bob", Models: []string{"glm-4.7", "GLM-4.7-Flash"}})
+
+	failed := &http.Response{StatusCode: http.StatusTooManyRequests, Body: io.NopCloser(strings.NewReader(""))}
+	body := map[string]any{"model": "glm-4.7"}
+	_, resp, err := s.tryFallbacks(c, context.Background(), "glm-4.7", body, s.defaultUpstream(), failed, nil, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// glm-4.6v is not on bob's allowlist
+	assert.Equal(t, []string{"glm-4.7-flash"}, tried)
+	assert.Equal(t, "glm-4.7-flash", body["model"])
+}
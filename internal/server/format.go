@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+)
+
+// invalidJSONCode identifies the error sent when a structured output does not parse
+const invalidJSONCode = "invalid_json_output"
+
+// jsonFormat is the structured output requested through Ollama's format field
+type jsonFormat struct {
+	schema map[string]any // nil for format "json"
+}
+
+// parseFormat reads Ollama's format field, which is either "json" or a JSON schema object.
+// It returns nil when no structured output was requested.
+func parseFormat(v any) (*jsonFormat, error) {
+	switch f := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch f {
+		case "":
+			return nil, nil
+		case "json":
+			return &jsonFormat{}, nil
+		}
+		return nil, api.ErrBadRequest("invalid format: %s (use \"json\" or a JSON schema)", f)
+	case map[string]any:
+		return &jsonFormat{schema: f}, nil
+	default:
+		return nil, api.ErrBadRequest("format must be \"json\" or a JSON schema object")
+	}
+}
+
+// applyFormat replaces the format field with the upstream response_format. Z.AI only offers
+// JSON mode, so a schema is passed to the model as a system instruction instead.
+func applyFormat(bodyMap map[string]any) {
+	format, err := parseFormat(bodyMap["format"])
+	delete(bodyMap, "format")
+	if err != nil || format == nil {
+		return
+	}
+
+	bodyMap["response_format"] = map[string]string{"type": "json_object"}
+	if format.schema == nil {
+		return
+	}
+
+	schema, err := json.Marshal(format.schema)
+	if err != nil {
+		return
+	}
+	messages, _ := bodyMap["messages"].([]any)
+	instruction := map[string]any{
+		"role":    "system",
+		"content": "Respond only with a JSON value that conforms to this JSON schema:\n" + string(schema),
+	}
+	bodyMap["messages"] = append([]any{instruction}, messages...)
+}
+
+// check verifies that content parses as JSON and, for a schema, that an object result carries
+// the schema's required top-level properties
+func (f *jsonFormat) check(content string) error {
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &v); err != nil {
+		return errors.New("model output is not valid JSON")
+	}
+
+	required, _ := f.schema["required"].([]any)
+	obj, isObject := v.(map[string]any)
+	if len(required) == 0 {
+		return nil
+	}
+	if !isObject {
+		return errors.New("model output is not a JSON object")
+	}
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, present := obj[name]; !present {
+				return fmt.Errorf("model output is missing required property %q", name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  any
+		want    bool
+		wantErr bool
+	}{
+		{"Absent", nil, false, false},
+		{"Empty", "", false, false},
+		{"JSON", "json", true, false},
+		{"Schema", map[string]any{"type": "object"}, true, false},
+		{"Unknown string", "yaml", false, true},
+		{"Wrong type", 1.0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseFormat(tt.format)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, f != nil)
+		})
+	}
+}
+
+func TestApplyFormat(t *testing.T) {
+	body := map[string]any{
+		"format":   map[string]any{"type": "object", "required": []any{"name"}},
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	}
+	applyFormat(body)
+
+	assert.NotContains(t, body, "format")
+	assert.Equal(t, map[string]string{"type": "json_object"}, body["response_format"])
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 2)
+	system := messages[0].(map[string]any)
+	assert.Equal(t, "system", system["role"])
+	assert.Contains(t, system["content"], `"required":["name"]`)
+}
+
+func TestJSONFormatCheck(t *testing.T) {
+	schema := &jsonFormat{schema: map[string]any{"required": []any{"name"}}}
+
+	tests := []struct {
+		name    string
+		format  *jsonFormat
+		content string
+		wantErr bool
+	}{
+		{"Valid JSON", &jsonFormat{}, ` {"a": 1} `, false},
+		{"Invalid JSON", &jsonFormat{}, `{"a": `, true},
+		{"Required present", schema, `{"name": "x"}`, false},
+		{"Required missing", schema, `{"other": "x"}`, true},
+		{"Not an object", schema, `["x"]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.format.check(tt.content) != nil)
+		})
+	}
+}
+
+func TestWriteTransformed_Format(t *testing.T) {
+	opts := rewriteOptions{format: &jsonFormat{}}
+
+	t.Run("Streaming invalid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"{\\\"a\\\":\"}}]}\n\n" +
+			"data: [DONE]\n\n"
+		require.NoError(t, writeTransformed(context.Background(), c, strings.NewReader(body), true, opts))
+		assert.Contains(t, w.Body.String(), invalidJSONCode)
+		assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+	})
+
+	t.Run("Streaming valid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"{\\\"a\\\":\"}}]}\n\n" +
+			"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"1}\"},\"finish_reason\":\"stop\"}]}\n\n" +
+			"data: [DONE]\n\n"
+		require.NoError(t, writeTransformed(context.Background(), c, strings.NewReader(body), true, opts))
+		assert.NotContains(t, w.Body.String(), invalidJSONCode)
+	})
+
+	t.Run("Non-streaming invalid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := `{"choices":[{"index":0,"message":{"role":"assistant","content":"not json"}}]}`
+		require.NoError(t, writeTransformed(context.Background(), c, strings.NewReader(body), false, opts))
+		assert.Equal(t, 502, w.Code)
+		assert.Contains(t, w.Body.String(), "not valid JSON")
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ollamaOptions maps Ollama's generation options to their chat completion parameters; the
+// others, such as num_ctx, describe a local runtime and have no upstream equivalent
+var ollamaOptions = map[string]string{
+	"num_predict": "max_tokens",
+	"temperature": "temperature",
+	"top_p":       "top_p",
+	"stop":        "stop",
+	"seed":        "seed",
+}
+
+// handleGenerate serves Ollama's completion endpoint, which takes a prompt instead of messages,
+// by wrapping the prompt in a chat request. The answer comes back as generate responses.
+func (s *Server) handleGenerate(c *gin.Context) {
+	var req api.GenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if req.Suffix != "" {
+		handleError(c, api.ErrBadRequest("suffix is not supported: the upstream API has no fill-in-the-middle mode"))
+		return
+	}
+
+	// An empty prompt only loads the model in Ollama; there is nothing to load here
+	if req.Prompt == "" && len(req.Images) == 0 {
+		if req.Model == "" {
+			handleError(c, api.ErrBadRequest("model is required"))
+			return
+		}
+		if !models.IsValidModel(req.Model) {
+			handleError(c, api.ErrNotFound("model '%s' not found", req.Model))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"model":       req.Model,
+			"created_at":  s.clock.Now().UTC().Format(time.RFC3339Nano),
+			"response":    "",
+			"done":        true,
+			"done_reason": "load",
+		})
+		return
+	}
+
+	bodyMap := map[string]any{
+		"model":    req.Model,
+		"messages": generateMessages(req),
+		"stream":   req.Stream == nil || *req.Stream,
+	}
+	if req.Format != nil {
+		bodyMap["format"] = req.Format
+	}
+	if req.Think != nil {
+		bodyMap["think"] = req.Think
+	}
+	if req.Metadata != nil {
+		bodyMap["metadata"] = req.Metadata
+	}
+	for option, param := range ollamaOptions {
+		v, ok := req.Options[option]
+		if !ok {
+			continue
+		}
+		// A negative num_predict means no limit
+		if n, _ := v.(float64); option == "num_predict" && n < 0 {
+			continue
+		}
+		bodyMap[param] = v
+	}
+	if err := applyQueryOverrides(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	s.proxyChat(c, bodyMap)
+}
+
+// generateMessages builds the chat messages of a generate request: the system prompt, then the
+// prompt as a user message carrying the images
+func generateMessages(req api.GenerateRequest) []any {
+	var messages []any
+	if req.System != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": req.System})
+	}
+	var content any = req.Prompt
+	if len(req.Images) > 0 {
+		parts := []any{map[string]any{"type": "text", "text": req.Prompt}}
+		for _, img := range req.Images {
+			parts = append(parts, map[string]any{
+				"type":      "image_url",
+				"image_url": map[string]any{"url": imageDataURL(img)},
+			})
+		}
+		content = parts
+	}
+	return append(messages, map[string]any{"role": "user", "content": content})
+}
+
+// imageDataURL turns an Ollama image, which is bare base64, into a data URL, sniffing its media
+// type from the first bytes
+func imageDataURL(img string) string {
+	if strings.HasPrefix(img, "data:") {
+		return img
+	}
+	head, _ := base64.StdEncoding.DecodeString(img[:min(len(img), 344)&^3])
+	return "data:" + http.DetectContentType(head) + ";base64," + img
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = nil
+		_ = json.Unmarshal(data, &upstreamBody)
+		if upstreamBody["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"Sum\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"func add\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"(a, b int)\"},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":6}}\n\n" +
+				"data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"func add(a, b int)"},"finish_reason":"length"}],"usage":{"prompt_tokens":9,"completion_tokens":6}}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/generate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Generate streams by default, as in Ollama; the prompt becomes a chat message
+	w := post(`{"model": "glm-4.7:latest", "system": "Write Go.", "prompt": "An add function", "options": {"num_predict": 64, "temperature": 0.2, "num_ctx": 8192}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, true, upstreamBody["stream"])
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "Write Go."},
+		map[string]any{"role": "user", "content": "An add function"},
+	}, upstreamBody["messages"])
+	assert.Equal(t, float64(64), upstreamBody["max_tokens"])
+	assert.Equal(t, 0.2, upstreamBody["temperature"])
+	assert.NotContains(t, upstreamBody, "options")
+
+	lines := ollamaLines(t, w.Body.String())
+	require.Len(t, lines, 4)
+	assert.Equal(t, "Sum", lines[0]["thinking"])
+	assert.Equal(t, "", lines[0]["response"])
+	assert.Equal(t, "func add", lines[1]["response"])
+	assert.Equal(t, "glm-4.7:latest", lines[1]["model"])
+	assert.Equal(t, false, lines[1]["done"])
+	assert.NotContains(t, lines[1], "message")
+	assert.Equal(t, "(a, b int)", lines[2]["response"])
+	assert.Equal(t, true, lines[3]["done"])
+	assert.Equal(t, "stop", lines[3]["done_reason"])
+	assert.Equal(t, float64(6), lines[3]["eval_count"])
+
+	// Non-streaming requests get the whole response at once
+	w = post(`{"model": "GLM-4.7", "prompt": "An add function", "stream": false, "options": {"num_predict": -1}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, upstreamBody, "max_tokens")
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "func add(a, b int)", resp["response"])
+	assert.Equal(t, "length", resp["done_reason"])
+	assert.Equal(t, float64(9), resp["prompt_eval_count"])
+
+	// Images travel with the prompt as data URLs
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	w = post(`{"model": "GLM-4.6V", "prompt": "What is this?", "stream": false, "images": ["` + png + `"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	parts := upstreamBody["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	require.Len(t, parts, 2)
+	assert.Equal(t, map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64," + png}}, parts[1])
+
+	// An empty prompt only checks the model
+	upstreamBody = nil
+	w = post(`{"model": "GLM-4.7"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "load", resp["done_reason"])
+	assert.Nil(t, upstreamBody)
+	assert.Equal(t, http.StatusNotFound, post(`{"model": "llama3"}`).Code)
+
+	w = post(`{"model": "GLM-4.7", "prompt": "func add(", "suffix": "}"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "suffix is not supported")
+}
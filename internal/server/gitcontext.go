@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/gitctx"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGitContextSystem introduces the gathered repository context to the model
+const defaultGitContextSystem = "You are a coding assistant. Answer the user's question using the repository context below."
+
+// gitContextRequest is the body accepted by the git context endpoint
+type gitContextRequest struct {
+	Model       string   `json:"model"`
+	Repo        string   `json:"repo"`         // Path inside the repository
+	Query       string   `json:"query"`        // The user's question
+	Base        string   `json:"base"`         // Diff base ref; defaults to HEAD
+	Files       []string `json:"files"`        // Extra repo-relative files to include
+	TokenBudget int      `json:"token_budget"` // Overrides the configured budget
+	Stream      bool     `json:"stream"`
+}
+
+// handleGitContext gathers status, diff and file contents from a local repository, composes
+// them into a prompt with the query and proxies it like a chat completion
+func (s *Server) handleGitContext(c *gin.Context) {
+	var req gitContextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if req.Repo == "" || req.Query == "" {
+		handleError(c, api.ErrBadRequest("repo and query are required"))
+		return
+	}
+
+	repo, err := s.allowedRepo(req.Repo)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	budget := req.TokenBudget
+	if budget <= 0 {
+		budget = s.config.GitContext.TokenBudget
+	}
+
+	gathered, err := gitctx.Gather(c.Request.Context(), repo, gitctx.Options{
+		Base:        req.Base,
+		Files:       req.Files,
+		TokenBudget: budget,
+		Roots:       s.gitRoots(),
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			handleError(c, err)
+			return
+		}
+		if errors.Is(err, gitctx.ErrOutsideRoots) {
+			handleError(c, api.ErrForbidden("%v", err))
+			return
+		}
+		handleError(c, api.ErrBadRequest("%v", err))
+		return
+	}
+	slog.Debug("Gathered git context", "root", gathered.Root, "files", len(gathered.Files), "truncated", gathered.Truncated)
+
+	system := s.config.GitContext.System
+	if system == "" {
+		system = defaultGitContextSystem
+	}
+
+	s.proxyChat(c, map[string]any{
+		"model":  req.Model,
+		"stream": req.Stream,
+		"messages": []any{
+			map[string]any{"role": "system", "content": system + "\n\n" + gathered.Render()},
+			map[string]any{"role": "user", "content": req.Query},
+		},
+	})
+}
+
+// allowedRepo resolves a requested repository path and checks it lies under a configured root
+func (s *Server) allowedRepo(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", api.ErrBadRequest("repo must be an absolute path")
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", api.ErrBadRequest("repo not found: %s", path)
+	}
+
+	for _, root := range s.gitRoots() {
+		if gitctx.Within(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", api.ErrForbidden("repo is outside the allowed roots: %s", path)
+}
+
+// gitRoots returns the configured repository roots with symlinks resolved; roots that do not
+// exist are left out
+func (s *Server) gitRoots() []string {
+	var roots []string
+	for _, root := range s.config.GitContext.Roots {
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			roots = append(roots, r)
+		}
+	}
+	return roots
+}
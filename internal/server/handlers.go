@@ -1,7 +1,6 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,9 +8,16 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/auth"
 	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/otel"
+	"github.com/chew-z/copilot-proxy/internal/tokens"
+	"github.com/chew-z/copilot-proxy/internal/trace"
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,10 +35,13 @@ func handleError(c *gin.Context, err error) {
 	c.JSON(http.StatusInternalServerError, api.StatusError{ErrorMessage: err.Error()})
 }
 
+// proxyVersion is the version reported to Ollama clients and in the capabilities
+const proxyVersion = "0.6.4"
+
 // handleVersion returns the API version
 func (s *Server) handleVersion(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"version": "0.6.4",
+		"version": proxyVersion,
 	})
 }
 
@@ -43,9 +52,23 @@ func (s *Server) handlePs(c *gin.Context) {
 	})
 }
 
-// handleTags returns the model catalog
+// handleTags returns the model catalog, or the client's view of it
 func (s *Server) handleTags(c *gin.Context) {
-	c.JSON(http.StatusOK, models.Catalog)
+	entries := s.catalogFor(c)
+	list := make([]models.Model, len(entries))
+	for i, e := range entries {
+		list[i] = e.listed()
+	}
+	c.JSON(http.StatusOK, models.TagsOf(list))
+}
+
+// handleBlobHead answers Ollama's blob existence check; only the synthesized model digests exist
+func (s *Server) handleBlobHead(c *gin.Context) {
+	if models.HasDigest(c.Param("digest")) {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Status(http.StatusNotFound)
 }
 
 // handleShow returns model metadata
@@ -61,12 +84,23 @@ func (s *Server) handleShow(c *gin.Context) {
 	if modelName == "" {
 		modelName = "GLM-4.7-Flash"
 	}
+	if v := s.catalogViewFor(c); v != nil {
+		if model, ok := v.resolve(modelName); ok {
+			modelName = model
+		}
+	}
 
-	contextLength := models.GetModelContextLength(modelName)
+	maxInput, maxOutput := s.modelLimits(modelName)
+
+	capabilities := []string{"tools"}
+	if m, ok := models.GetModel(modelName); ok {
+		capabilities = m.Capabilities
+	}
 
 	response := api.ShowResponse{
 		Template:     "{{ .System }}\n{{ .Prompt }}",
-		Capabilities: []string{"tools", "vision"},
+		Parameters:   fmt.Sprintf("num_ctx %d\nnum_predict %d", maxInput, maxOutput),
+		Capabilities: capabilities,
 		Details: api.ModelDetails{
 			Family:            "glm",
 			Families:          []string{"glm"},
@@ -75,9 +109,11 @@ func (s *Server) handleShow(c *gin.Context) {
 			QuantizationLevel: "cloud",
 		},
 		ModelInfo: map[string]any{
-			"general.basename":     modelName,
-			"general.architecture": "glm",
-			"glm.context_length":   contextLength,
+			"general.basename":      modelName,
+			"general.architecture":  "glm",
+			"glm.context_length":    maxInput,
+			"glm.max_input_tokens":  maxInput,
+			"glm.max_output_tokens": maxOutput,
 		},
 	}
 
@@ -89,128 +125,665 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 	// Parse once into map
 	var bodyMap map[string]any
 	if err := c.ShouldBindJSON(&bodyMap); err != nil {
-		handleError(c, api.ErrBadRequest("Invalid JSON: "+err.Error()))
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	if err := applyQueryOverrides(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+	messages, _ := bodyMap["messages"].([]any)
+	ollamaImageParts(messages)
+
+	s.proxyChat(c, bodyMap)
+}
+
+// proxyChat validates a chat completion body and relays it upstream, streaming the response
+// back through content transforms and dataset capture
+func (s *Server) proxyChat(c *gin.Context, bodyMap map[string]any) {
+	_, validateSpan := s.otel.Start(c.Request.Context(), "validate", otel.KindInternal)
+	if err := s.validateChatRequest(c, bodyMap); err != nil {
+		validateSpan.SetError(err.Error())
+		validateSpan.End()
+		handleError(c, err)
+		return
+	}
+	validateSpan.End()
+	if !s.allowUsage(c) {
+		return
+	}
+	// Ollama answers with the model name as the client gave it, whichever model serves it
+	requestedModel, _ := bodyMap["model"].(string)
+	s.canary.route(c, bodyMap)
+	s.downgradeStream(c, bodyMap)
+
+	target, err := s.selectUpstream(c, fmt.Sprint(bodyMap["model"]))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	messages, _ := bodyMap["messages"].([]any)
+	if n := s.limitToolResults(c.Request.Context(), principalFrom(c), messages); n > 0 {
+		c.Header(toolResultsHeader, strconv.Itoa(n))
+	}
+	if changes := s.fitImages(bodyMap); changes != "" {
+		slog.Info("Adjusted images to fit budget", "model", bodyMap["model"], "changes", changes)
+		c.Header(imageAdjustmentsHeader, changes)
+	}
+	format, _ := parseFormat(bodyMap["format"])
+	metadata := metadataStrings(bodyMap["metadata"])
+	prepareUpstreamBody(bodyMap, s.thinkingMode(c, bodyMap))
+	s.applyRewrites(c, bodyMap)
+	if err := s.runRequestPlugins(c, bodyMap); err != nil {
+		handleError(c, err)
+		return
+	}
+	scriptHeaders, err := s.runRequestScripts(c, bodyMap)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	// Fallback chains are keyed by the catalog model, before an upstream renames it
+	chainModel := models.GetCanonicalModelName(fmt.Sprint(bodyMap["model"]))
+	target.mapModel(bodyMap)
+
+	// Pinned snapshots apply to the default upstream only; other upstreams map models themselves.
+	// The body keeps the catalog model for transforms, failover and usage accounting.
+	var snapshot string
+	if target.name == "" {
+		model, _ := bodyMap["model"].(string)
+		snapshot, err = s.resolveSnapshot(c, model)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		c.Header(modelSnapshotHeader, snapshot)
+	}
+	upstreamBody := upstreamBodyFor(target, bodyMap, snapshot)
+
+	stream, _ := bodyMap["stream"].(bool)
+	slog.Debug("Proxying chat completion", "model", upstreamBody["model"], "stream", stream)
+
+	newBodyBytes, err := json.Marshal(upstreamBody)
+	if err != nil {
+		handleError(c, api.ErrInternalServer("Failed to prepare upstream request"))
+		return
+	}
+
+	// Reject runaway retry loops before they reach upstream
+	if s.duplicates != nil {
+		if err := s.duplicates.check(c, newBodyBytes, fmt.Sprint(bodyMap["model"])); err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	// Create upstream request with context for cancellation handling; the request gets its own
+	// cancel so the thinking guard can abort generation without ending the client response
+	ctx := c.Request.Context()
+	upstreamCtx, cancelUpstream := context.WithCancel(ctx)
+	defer cancelUpstream()
+	// Register the request so it can be cancelled by ID while it runs
+	active, err := s.active.start(c, fmt.Sprint(bodyMap["model"]), cancelUpstream)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	defer s.active.finish(active)
+	// Trace a sample of exchanges in full
+	var tr *trace.Record
+	var trCapture *traceCapture
+	if s.tracer != nil {
+		if tr = s.tracer.start(c, fmt.Sprint(bodyMap["model"]), newBodyBytes); tr != nil {
+			tr.Metadata = metadata
+			defer func() { s.tracer.finish(tr, trCapture) }()
+		}
+	}
+
+	// Execute request; the upstream span is sent as the parent of the upstream's handling
+	otel.SpanFromContext(ctx).SetAttributes("gen_ai.request.model", fmt.Sprint(bodyMap["model"]), "copilot_proxy.stream", stream)
+	spanCtx, upstreamSpan := s.otel.Start(upstreamCtx, "upstream", otel.KindClient)
+	sent := s.clock.Now()
+	// Repeated deterministic requests are answered from the cache without reaching upstream
+	cacheKey := s.cacheKey(c, target, bodyMap, newBodyBytes)
+	resp := s.cache.lookup(c, cacheKey)
+	cached := resp != nil
+	if !cached {
+		resp, err = s.send(spanCtx, target, newBodyBytes, scriptHeaders)
+		target, resp, err = s.tryFallbacks(c, spanCtx, chainModel, bodyMap, target, resp, err, scriptHeaders)
+	}
+	upstreamSpan.SetAttributes("copilot_proxy.cache_hit", cached)
+
+	// Fall back to a local model when the cloud cannot be reached; explicitly chosen upstreams
+	// are reported as they are
+	servedBy := fmt.Sprint(bodyMap["model"])
+	if target.name != "" {
+		servedBy = target.name + "/" + servedBy
+		c.Header(upstreamHeader, target.name)
+	}
+	if s.failover != nil && target.name == "" && cloudUnavailable(ctx, resp, err) {
+		if localResp, local, ferr := s.failover.do(spanCtx, bodyMap); ferr == nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			resp, err = localResp, nil
+			servedBy = "ollama/" + local
+			c.Header(failoverHeader, servedBy)
+		} else {
+			slog.Error("Local Ollama failover failed", "error", ferr)
+		}
+	}
+	upstreamSpan.SetAttributes("gen_ai.response.model", servedBy, "server.address", hostOf(target.baseURL))
+	if err != nil {
+		upstreamSpan.SetError(err.Error())
+	} else {
+		upstreamSpan.SetAttributes("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= 400 {
+			upstreamSpan.SetError(http.StatusText(resp.StatusCode))
+		}
+	}
+	upstreamSpan.End()
+	if tr != nil {
+		tr.Timing.UpstreamHeadersMS = millis(s.clock.Since(tr.Time))
+		if err != nil {
+			tr.Error = err.Error()
+		} else {
+			tr.Status, tr.ResponseHeaders = resp.StatusCode, resp.Header.Clone()
+		}
+	}
+	if err != nil {
+		// Check for context cancellation (client disconnected)
+		if errors.Is(err, context.Canceled) {
+			slog.Debug("Client disconnected during upstream request")
+			c.JSON(499, gin.H{"error": "request canceled"})
+			return
+		}
+		handleError(c, api.ErrBadGateway("Failed to connect to upstream server"))
 		return
 	}
+	// Account for the open body until the relay ends; the watchdog closes it past the caps
+	s.watchdog.track(resp, active, cancelUpstream)
+	defer resp.Body.Close()
+
+	// Check whole responses before relaying them, so garbage becomes a clean error
+	if !isEventStream(resp) {
+		if err := s.validateResponse(upstreamCtx, resp, active.id, servedBy); err != nil {
+			var se *api.StatusError
+			if errors.As(err, &se) {
+				s.usage.record(requestLabelsFor(c, servedBy), se.StatusCode, nil)
+			}
+			handleError(c, err)
+			return
+		}
+		// Answers from a fallback model or local failover are not what the request asked for
+		if !cached && c.Writer.Header().Get(fallbackHeader) == "" && c.Writer.Header().Get(failoverHeader) == "" {
+			s.cache.store(cacheKey, resp)
+		}
+	}
+
+	// Collect response rewrites for successful responses; they change the body length
+	var rewrite rewriteOptions
+	if resp.StatusCode < 300 {
+		canonicalModel, _ := bodyMap["model"].(string)
+		rewrite = rewriteOptions{
+			chain:     s.contentTransforms(c, canonicalModel),
+			split:     isEventStream(resp) && s.profileFor(c).SplitStream,
+			reasoning: s.reasoningMode(c),
+			format:    format,
+			metadata:  metadata,
+			chunkHook: chainChunkHooks(s.chunkPluginHook(ctx, canonicalModel), s.responseScriptHook(ctx, canonicalModel)),
+		}
+		if isEventStream(resp) && s.profileFor(c).Annotations {
+			rewrite.annotate = &annotation{model: canonicalModel, sent: sent, clock: s.clock}
+		}
+	}
+
+	// Copy the response headers the dialect's policy allows
+	s.headerPolicyFor(c.Request.URL.Path).copy(c.Writer.Header(), resp.Header, rewrite.active())
+	s.applyUpstreamRateLimit(c, target.name, resp)
+
+	// Answer Ollama's endpoints in their own format, as SSE events for clients that asked for
+	// them, and re-frame other successful streams for clients that asked for NDJSON
+	if path := c.FullPath(); resp.StatusCode < 300 && (path == "/api/chat" || path == "/api/generate") {
+		ollama := newOllamaWriter(c.Writer, requestedModel, sent, s.clock, isEventStream(resp))
+		ollama.generate = path == "/api/generate"
+		if isEventStream(resp) && streamFormatFor(c, streamFormatNDJSON) == streamFormatSSE {
+			ollama.eventStream = true
+			c.Writer.Header().Set("Content-Type", "text/event-stream")
+		}
+		c.Writer = ollama
+		defer ollama.Close()
+	} else if resp.StatusCode < 300 && isEventStream(resp) && streamFormatFor(c, streamFormatSSE) == streamFormatNDJSON {
+		ndjson := newNDJSONWriter(c.Writer)
+		c.Writer = ndjson
+		defer ndjson.Close()
+	}
+
+	// Set status code
+	c.Writer.WriteHeader(resp.StatusCode)
+
+	// Time the stream's chunks as they arrive when the client asked for a latency trace
+	if lt := s.startLatencyTrace(c, resp, sent); lt != nil {
+		defer lt.finish(c, active.id, servedBy)
+	}
+
+	// Bound the reasoning phase of successful streams
+	body := io.Reader(resp.Body)
+	if limit := s.config.Thinking.MaxDuration; limit > 0 && stream && resp.StatusCode < 300 && isEventStream(resp) {
+		canonicalModel, _ := bodyMap["model"].(string)
+		guard := newThinkingGuard(resp.Body, cancelUpstream, limit, canonicalModel, s.metrics, s.clock)
+		if s.config.Thinking.Fallback {
+			guard.fallback = s.thinkingFallback(ctx, target, bodyMap)
+		}
+		defer guard.Close()
+		body = guard
+	}
+
+	// End successful streams cleanly when upstream reports an error inside them or stops
+	// speaking SSE
+	if resp.StatusCode < 300 && isEventStream(resp) {
+		body = newStreamErrorGuard(body, active.id, servedBy, s.usage.failed)
+
+		// Parse the stream into well-formed chunks ending in [DONE] for everything below
+		normalizer := newStreamNormalizer(body, active.id, servedBy, s.usage.repaired)
+		normalizer.hooks = append(normalizer.hooks, newToolCallRepair(normalizer.repair))
+		body = normalizer
+	}
+
+	// Give clients that asked for include_usage a usage chunk even when upstream leaves it out
+	if resp.StatusCode < 300 && isEventStream(resp) && includeUsage(bodyMap) {
+		body = newStreamUsage(body, tokens.Request(bodyMap), active.id, servedBy, s.usage.estimated)
+	}
+
+	// Tee successful responses into a capture buffer when they will be mirrored to the dataset
+	var capture *captureBuffer
+	if s.dataset != nil && resp.StatusCode < 300 {
+		capture = &captureBuffer{}
+		body = io.TeeReader(body, capture)
+	}
+
+	// Capture the body of traced exchanges, including error responses
+	if tr != nil {
+		trCapture = &traceCapture{clock: s.clock}
+		body = io.TeeReader(body, trCapture)
+	}
+
+	// Fan the response out to the subscribers of its session
+	s.startBroadcast(c, resp)
+
+	// Count relayed bytes for the admin listing of active requests
+	body = io.TeeReader(body, active)
+
+	// Watch successful responses for the token usage report, timing streams as they arrive
+	var tap *usageTap
+	var meter *throughputMeter
+	if resp.StatusCode < 300 {
+		tap = &usageTap{streaming: isEventStream(resp)}
+		body = io.TeeReader(body, tap)
+		if tap.streaming {
+			meter = newThroughputMeter(sent)
+			body = io.TeeReader(body, meter)
+		}
+	}
+
+	// Stream response body with context awareness
+	_, relaySpan := s.otel.Start(ctx, "stream", otel.KindInternal)
+	if rewrite.active() {
+		err = writeTransformed(ctx, c, body, isEventStream(resp), rewrite)
+	} else {
+		err = streamResponse(ctx, c, body)
+	}
+	if err != nil && active.canceled.Load() && ctx.Err() == nil {
+		slog.Debug("Request cancelled during streaming", "request_id", active.id)
+		if isEventStream(resp) {
+			c.Writer.Write(cancellationChunk(active.id, active.model))
+			c.Writer.Flush()
+		}
+	}
+
+	var usage *tokenUsage
+	if tap != nil {
+		usage = tap.Usage()
+	}
+	relaySpan.SetAttributes("copilot_proxy.response_bytes", active.bytes.Load(), "copilot_proxy.event_stream", isEventStream(resp))
+	if usage != nil {
+		relaySpan.SetAttributes("gen_ai.usage.input_tokens", usage.PromptTokens, "gen_ai.usage.output_tokens", usage.CompletionTokens)
+	}
+	if err != nil {
+		relaySpan.SetError(err.Error())
+	}
+	relaySpan.End()
+	labels := requestLabelsFor(c, servedBy)
+	s.usage.record(labels, resp.StatusCode, usage)
+	sizes := traffic{request: int64(len(newBodyBytes)), response: active.bytes.Load()}
+	s.usage.recordTraffic(labels, sizes)
+	elapsed := s.clock.Since(sent)
+	exemplar := map[string]string{"request_id": active.id}
+	if tr != nil {
+		exemplar = map[string]string{"trace_id": tr.ID}
+	}
+	s.usage.recordLatency(labels, elapsed, exemplar)
+	if s.slo != nil {
+		s.slo.observe(servedBy, resp.StatusCode, elapsed)
+	}
+	var tp *throughput
+	if meter != nil {
+		completionTokens := 0
+		if usage != nil {
+			completionTokens = usage.CompletionTokens
+		}
+		if tp = meter.result(completionTokens); tp != nil {
+			s.usage.recordStream(labels, tp, usage)
+		}
+	}
+	if s.ledger != nil {
+		s.recordLedger(c, servedBy, resp.StatusCode, usage, tp, sizes, metadata)
+	}
+	if s.requestLog != nil {
+		s.logRequest(c, active.id, servedBy, resp.StatusCode, usage, isEventStream(resp), elapsed, messages)
+	}
+	s.recordUsage(c, usage)
+	s.requestCompleted(c, servedBy, resp.StatusCode, usage, metadata, sent)
+	if s.anomalies != nil && usage != nil {
+		client := c.ClientIP()
+		if p := principalFrom(c); p != nil {
+			client = p.Name
+		}
+		s.anomalies.observe(client, servedBy, usage.PromptTokens+usage.CompletionTokens)
+	}
+	if len(metadata) > 0 {
+		// Tie the client's correlation metadata to the usage it incurred
+		attrs := []any{"model", servedBy, "status", resp.StatusCode, "metadata", metadata}
+		if usage != nil {
+			attrs = append(attrs, "prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+		}
+		slog.Info("Chat completion usage", attrs...)
+	}
+
+	if err != nil {
+		// Check if client disconnected
+		if errors.Is(err, context.Canceled) {
+			slog.Debug("Client disconnected during streaming")
+		}
+		return
+	}
+
+	if capture != nil {
+		s.recordDataset(c, bodyMap, capture.Bytes())
+	}
+}
+
+// validateChatRequest checks a chat completion body's model and messages, routes image-bearing
+// requests to a vision-capable model and enforces the client's model allowlist
+func (s *Server) validateChatRequest(c *gin.Context, bodyMap map[string]any) error {
+	// Clients that cannot choose a model get the configured default
+	if s.config.DefaultModel != "" && s.isPlaceholderModel(bodyMap["model"]) {
+		slog.Debug("Using default model", "requested", bodyMap["model"], "model", s.config.DefaultModel)
+		bodyMap["model"] = s.config.DefaultModel
+	}
 
-	// Validate required fields
 	model, ok := bodyMap["model"].(string)
 	if !ok || model == "" {
-		handleError(c, api.ErrBadRequest("model is required"))
-		return
+		return api.ErrBadRequest("model is required")
+	}
+
+	// Clients with a catalog view request the models it lists, aliases included
+	if v := s.catalogViewFor(c); v != nil {
+		resolved, ok := v.resolve(model)
+		if !ok {
+			return api.ErrNotFound("model '%s' not found", model)
+		}
+		model = resolved
+		bodyMap["model"] = model
 	}
 
 	messages, ok := bodyMap["messages"].([]any)
 	if !ok || len(messages) == 0 {
-		handleError(c, api.ErrBadRequest("messages is required and must be non-empty"))
-		return
+		return api.ErrBadRequest("messages is required and must be non-empty")
 	}
 
 	// Validate message structure
 	for i, msg := range messages {
 		msgMap, ok := msg.(map[string]any)
 		if !ok {
-			handleError(c, api.ErrBadRequest(fmt.Sprintf("message %d must be an object", i)))
-			return
+			return api.ErrBadRequest("message %d must be an object", i)
 		}
 
 		role, ok := msgMap["role"].(string)
 		if !ok || role == "" {
-			handleError(c, api.ErrBadRequest(fmt.Sprintf("message %d requires a role", i)))
-			return
+			return api.ErrBadRequest("message %d requires a role", i)
 		}
 
 		validRoles := map[string]bool{"system": true, "user": true, "assistant": true, "tool": true}
 		if !validRoles[role] {
-			handleError(c, api.ErrBadRequest(fmt.Sprintf("message %d has invalid role: %s", i, role)))
-			return
+			return api.ErrBadRequest("message %d has invalid role: %s", i, role)
 		}
 	}
 
+	// Stored prompt fragments are expanded before anything measures the messages
+	if err := s.resolveIncludes(c, messages); err != nil {
+		return err
+	}
+
 	// Validate model exists
 	if !models.IsValidModel(model) {
-		handleError(c, api.ErrNotFound(fmt.Sprintf("model '%s' not found", model)))
-		return
+		return api.ErrNotFound("model '%s' not found", model)
+	}
+
+	// Ollama's think field is a boolean or an effort level
+	switch think := bodyMap["think"].(type) {
+	case nil, bool:
+	case string:
+		if !thinkLevels[think] {
+			return api.ErrBadRequest("invalid think level: %s (use low, medium or high)", think)
+		}
+	default:
+		return api.ErrBadRequest("think must be a boolean or one of low, medium, high")
+	}
+
+	if err := validateReasoningMode(c); err != nil {
+		return err
+	}
+	if err := validateThinkingHeader(c); err != nil {
+		return err
+	}
+
+	// Ollama's format field requests structured output
+	if _, err := parseFormat(bodyMap["format"]); err != nil {
+		return err
 	}
 
-	// Enable deep thinking for GLM models
-	bodyMap["thinking"] = map[string]string{
-		"type": "enabled",
+	// Malformed tools are rejected here with a precise error rather than upstream
+	if err := validateTools(bodyMap["tools"], s.config.ToolValidation); err != nil {
+		return err
 	}
 
+	// Metadata is echoed back for correlation, not sent upstream
+	if err := validateMetadata(bodyMap["metadata"]); err != nil {
+		return err
+	}
+
+	// Image-bearing requests need a vision model; upgrade to the configured one if allowed
+	if hasImages(messages) && !models.HasCapability(model, "vision") {
+		if s.config.VisionModel == "" {
+			return api.ErrBadRequest("model '%s' does not support images; use a vision model such as GLM-4.6V", model)
+		}
+		slog.Debug("Upgrading to vision model", "from", model, "to", s.config.VisionModel)
+		model = s.config.VisionModel
+		bodyMap["model"] = model
+	}
+
+	// Enforce the client's model allowlist
+	if p := principalFrom(c); p != nil && !p.AllowsModel(model) && !p.AllowsModel(models.GetCanonicalModelName(model)) {
+		return api.ErrForbidden("model '%s' is not allowed for %s", model, p.Name)
+	}
+
+	// Profiles can ask for the current date and environment to be stated in the conversation
+	s.injectEnvironment(c, bodyMap)
+
+	return nil
+}
+
+// isPlaceholderModel reports whether a request's model is missing or one of the placeholder
+// names that hard-coded clients send, such as "default" or "gpt-3.5-turbo"
+func (s *Server) isPlaceholderModel(v any) bool {
+	model, _ := v.(string)
+	model = strings.ToLower(strings.TrimSpace(model))
+	if model == "" || model == "default" {
+		return true
+	}
+	for _, p := range s.config.PlaceholderModels {
+		if strings.ToLower(p) == model {
+			return true
+		}
+	}
+	return false
+}
+
+// hasImages reports whether any message carries an image, either as an OpenAI image_url
+// content part or in an Ollama-style "images" list not yet converted
+func hasImages(messages []any) bool {
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if images, ok := msg["images"].([]any); ok && len(images) > 0 {
+			return true
+		}
+		parts, _ := msg["content"].([]any)
+		for _, p := range parts {
+			if part, _ := p.(map[string]any); part["type"] == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ollamaImageParts moves the images of Ollama chat messages, bare base64 in an "images" list,
+// into OpenAI image_url content parts after the text, as generateMessages does for a prompt
+func ollamaImageParts(messages []any) {
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		images, _ := msg["images"].([]any)
+		if len(images) == 0 {
+			continue
+		}
+		var parts []any
+		switch content := msg["content"].(type) {
+		case []any:
+			parts = content
+		case string:
+			parts = []any{map[string]any{"type": "text", "text": content}}
+		}
+		for _, img := range images {
+			if data, ok := img.(string); ok && data != "" {
+				parts = append(parts, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]any{"url": imageDataURL(data)},
+				})
+			}
+		}
+		msg["content"] = parts
+		delete(msg, "images")
+	}
+}
+
+// thinkLevels are the effort levels accepted in Ollama's think field. Z.AI only switches
+// thinking on or off, so every level enables it.
+var thinkLevels = map[string]bool{"low": true, "medium": true, "high": true}
+
+// toolStreamModels are the models whose tool call arguments can be streamed incrementally
+var toolStreamModels = []string{"glm-4.7", "glm-4.7-flash", "glm-4.7-flashx"}
+
+// prepareUpstreamBody applies the proxy's request rewrites (thinking, model name, format, metadata,
+// tool_stream). thinking is the mode of thinking-capable models when Ollama's think field is absent.
+func prepareUpstreamBody(bodyMap map[string]any, thinking string) {
 	// Normalize model name to lowercase for upstream API (Z.AI expects lowercase)
+	model, _ := bodyMap["model"].(string)
 	canonicalModel := models.GetCanonicalModelName(model)
 	bodyMap["model"] = canonicalModel
 
+	// Translate Ollama's format field into JSON mode
+	applyFormat(bodyMap)
+
+	// Metadata stays with the proxy
+	delete(bodyMap, "metadata")
+
+	// Ollama's think field is not understood upstream; think:false turns thinking off
+	if think, ok := bodyMap["think"]; ok {
+		delete(bodyMap, "think")
+		thinking = thinkingEnabled
+		if think == false {
+			thinking = thinkingDisabled
+		}
+	}
+
+	// Switch deep thinking on or off for GLM models that support it, unless the client's own
+	// setting passes through
+	if models.HasCapability(canonicalModel, "thinking") && thinking != thinkingPassthrough {
+		bodyMap["thinking"] = map[string]string{
+			"type": thinking,
+		}
+	}
+
 	// Auto-enable tool_stream for GLM-4.7 family models when tools are present and streaming is enabled
 	// This enables real-time streaming of tool call parameters
-	if canonicalModel == "glm-4.7" || canonicalModel == "glm-4.7-flash" || canonicalModel == "glm-4.7-flashx" {
+	if slices.Contains(toolStreamModels, canonicalModel) {
 		_, hasTools := bodyMap["tools"]
 		stream, _ := bodyMap["stream"].(bool)
 		if hasTools && stream {
 			bodyMap["tool_stream"] = true
 		}
 	}
+}
 
-	newBodyBytes, err := json.Marshal(bodyMap)
-	if err != nil {
-		handleError(c, api.ErrInternalServer("Failed to prepare upstream request"))
-		return
+// complete sends a non-streaming chat completion through the upstream pipeline and returns the
+// raw body. The request is admitted against the quotas of p, the client it is made for, and its
+// tokens are charged to them.
+func (s *Server) complete(ctx context.Context, p *auth.Principal, bodyMap map[string]any) ([]byte, error) {
+	if _, err := s.admitUsage(ctx, p); err != nil {
+		return nil, err
 	}
+	prepareUpstreamBody(bodyMap, s.bodyThinkingMode(bodyMap))
 
-	// Create upstream request with context for cancellation handling
-	ctx := c.Request.Context()
-	upstreamURL := s.config.BaseURL + "/chat/completions"
-	upstreamReq, err := http.NewRequestWithContext(ctx, "POST", upstreamURL, bytes.NewReader(newBodyBytes))
+	body, err := json.Marshal(bodyMap)
 	if err != nil {
-		handleError(c, api.ErrInternalServer("Failed to create upstream request"))
-		return
-	}
-
-	// Set Content-Type for upstream
-	upstreamReq.Header.Set("Content-Type", "application/json")
-
-	// Add Authorization header
-	if s.config.APIKey != "" {
-		upstreamReq.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+		return nil, fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	// Execute request
-	resp, err := s.client.Do(upstreamReq)
+	resp, err := s.send(ctx, s.routeUpstream(fmt.Sprint(bodyMap["model"])), body, nil)
 	if err != nil {
-		// Check for context cancellation (client disconnected)
-		if errors.Is(err, context.Canceled) {
-			slog.Debug("Client disconnected during upstream request")
-			c.JSON(499, gin.H{"error": "request canceled"})
-			return
-		}
-		handleError(c, api.ErrBadGateway("Failed to connect to upstream server"))
-		return
+		return nil, api.WrapError(err, http.StatusBadGateway, "Failed to connect to upstream server")
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Writer.Header().Add(key, value)
-		}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, api.WrapError(err, http.StatusBadGateway, "Failed to read upstream response")
+	}
+	if resp.StatusCode >= 400 {
+		return nil, api.Errorf(resp.StatusCode, "upstream returned status %d: %s", resp.StatusCode, data)
+	}
+	if reason, detail := checkCompletion(resp.StatusCode, data, nil); reason != "" {
+		return nil, api.ErrBadGateway("Upstream returned an invalid response: %s", detail)
+	}
+	var completion struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if json.Unmarshal(data, &completion) == nil {
+		s.chargeUsage(ctx, p, completion.Usage)
 	}
 
-	// Set status code
-	c.Writer.WriteHeader(resp.StatusCode)
+	return data, nil
+}
 
-	// Stream response body with context awareness
-	if err := streamResponse(ctx, c, resp.Body); err != nil {
-		// Check if client disconnected
-		if errors.Is(err, context.Canceled) {
-			slog.Debug("Client disconnected during streaming")
-		}
-		return
-	}
+// isEventStream reports whether an upstream response is a server-sent event stream
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
 }
 
 // streamResponse streams the response body with SSE support and context awareness
-func streamResponse(ctx context.Context, c *gin.Context, body io.ReadCloser) error {
+func streamResponse(ctx context.Context, c *gin.Context, body io.Reader) error {
 	buf := make([]byte, 32*1024) // 32KB buffer
 
 	for {
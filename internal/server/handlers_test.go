@@ -2,15 +2,27 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/auth"
 	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/i18n"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/usage"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestServer() *Server {
@@ -114,6 +126,20 @@ func TestChatCompletions_Validation(t *testing.T) {
 	}
 }
 
+func TestChatCompletions_LocalizedErrors(t *testing.T) {
+	s := setupTestServer()
+	assert.NoError(t, i18n.SetLocale("pl"))
+	defer i18n.SetLocale("")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"UNKNOWN-MODEL", "messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "nie znaleziono modelu 'UNKNOWN-MODEL'"}`, w.Body.String())
+}
+
 func TestChatCompletions_SuccessfulStreaming(t *testing.T) {
 	// Create mock upstream that sends SSE events
 	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -206,9 +232,13 @@ func TestChatCompletions_SuccessfulNonStreaming(t *testing.T) {
 
 	s.router.ServeHTTP(w, req)
 
+	// Ollama's endpoint answers in its own format
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Hello World")
-	assert.Contains(t, w.Body.String(), "chatcmpl-123")
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "Hello World"}, resp["message"])
+	assert.Equal(t, true, resp["done"])
+	assert.Equal(t, float64(12), resp["eval_count"])
 }
 
 func TestChatCompletions_UpstreamError(t *testing.T) {
@@ -385,3 +415,765 @@ func TestToolStreamAutoEnable(t *testing.T) {
 		})
 	}
 }
+
+func TestChatCompletions_DatasetRecording(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"choices\": [{\"delta\": {\"content\": \"Hello\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		APIKey:  "test-key",
+		BaseURL: mockUpstream.URL,
+		Dataset: config.DatasetConfig{Enabled: true, Dir: dir},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	reqBody := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}], "stream": true}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(datasetTagHeader, "greetings")
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	data, err := os.ReadFile(filepath.Join(dir, "greetings.jsonl"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"content":"Hello","role":"assistant"}`)
+}
+
+func TestChatCompletions_ModelAllowlist(t *testing.T) {
+	s := setupTestServer()
+
+	reqBody := `{"model": "GLM-4.7-FlashX", "messages": [{"role": "user", "content": "hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set(principalKey, &auth.Principal{Name: "alice", Models: []string{"glm-4.7", "glm-4.7-flash"}})
+
+	s.handleChatCompletions(c)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "model 'GLM-4.7-FlashX' is not allowed for alice")
+}
+
+func TestCodeBlocks(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model": "glm-4.7", "choices": [{"index": 0, "message": {"role": "assistant",
+			"content": "Try:\n` + "```go" + `\nfmt.Println(1)\n` + "```" + `\nor\n` + "```sh" + `\necho 1\n` + "```" + `"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	reqBody := `{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/code-blocks?language=go", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, false, upstreamBody["stream"])
+	assert.JSONEq(t, `{"model": "glm-4.7", "blocks": [{"language": "go", "content": "fmt.Println(1)"}]}`, w.Body.String())
+
+	// Validation is shared with chat completions
+	req = httptest.NewRequest("POST", "/v1/code-blocks", strings.NewReader(`{"model": "GLM-4.7"}`))
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGitContext(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	out, err := exec.Command("git", "-C", repo, "init", "-q").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	os.WriteFile(filepath.Join(repo, "todo.txt"), []byte("fix the parser\n"), 0644)
+
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "ok"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{BaseURL: mockUpstream.URL, GitContext: config.GitContextConfig{Roots: []string{repo}, TokenBudget: 1000}}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/context/git", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"model": "GLM-4.7", "repo": "` + repo + `", "query": "What is left to do?"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	messages, _ := upstreamBody["messages"].([]any)
+	if assert.Len(t, messages, 2) {
+		system, _ := messages[0].(map[string]any)["content"].(string)
+		assert.Contains(t, system, "## todo.txt")
+		assert.Contains(t, system, "fix the parser")
+		assert.Equal(t, "What is left to do?", messages[1].(map[string]any)["content"])
+	}
+
+	w = post(`{"model": "GLM-4.7", "repo": "` + t.TempDir() + `", "query": "q"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = post(`{"model": "GLM-4.7", "repo": "relative/path", "query": "q"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	// A root inside a repository does not expose the rest of it
+	nested := filepath.Join(repo, "src")
+	os.Mkdir(nested, 0755)
+	s.config.GitContext.Roots = []string{nested}
+	w = post(`{"model": "GLM-4.7", "repo": "` + nested + `", "query": "q", "files": ["todo.txt"]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestChatCompletions_DuplicateStorm(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "ok"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	alerts := make(chan map[string]any, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]any
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		BaseURL:    mockUpstream.URL,
+		Duplicates: config.DuplicatesConfig{Enabled: true, MaxRepeats: 2, Window: time.Minute, WebhookURL: webhook.URL},
+		Admin:      config.AdminConfig{Token: testAdminToken},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	send := func(content string) *httptest.ResponseRecorder {
+		body := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "` + content + `"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("same").Code)
+	assert.Equal(t, http.StatusOK, send("same").Code)
+
+	w := send("same")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "retry loop")
+
+	// A different payload is unaffected
+	assert.Equal(t, http.StatusOK, send("different").Code)
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "duplicate_request_storm", alert["event"])
+		assert.Equal(t, "glm-4.7", alert["model"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected storm alert")
+	}
+
+	// Continued repeats don't raise another alert
+	send("same")
+	select {
+	case <-alerts:
+		t.Fatal("unexpected second alert")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Anonymous clients share one label instead of one per IP
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `copilot_proxy_duplicate_rejected_total{client="anonymous"} 2`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_duplicate_storms_total{client="anonymous"} 1`)
+}
+
+func TestEstimate(t *testing.T) {
+	s := setupTestServer()
+
+	tests := []struct {
+		name      string
+		body      string
+		code      int
+		fits      bool
+		maxTokens bool
+	}{
+		{
+			name: "Prompt Only",
+			body: `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "Hello, world!"}]}`,
+			code: http.StatusOK,
+			fits: true,
+		},
+		{
+			name:      "Max Tokens Overflow",
+			body:      `{"model": "GLM-4.7", "max_tokens": 199990, "messages": [{"role": "user", "content": "Hello, world!"}]}`,
+			code:      http.StatusOK,
+			fits:      false,
+			maxTokens: true,
+		},
+		{
+			name: "Unknown Model",
+			body: `{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`,
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/estimate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var resp estimateResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "glm-4.7", resp.Model)
+			// priming 3 + message overhead 4 + role 1 + content 4
+			assert.Equal(t, 12, resp.PromptTokens)
+			assert.Equal(t, 200000, resp.ContextLength)
+			assert.Equal(t, 200000-12, resp.RemainingTokens)
+			assert.Equal(t, tt.fits, resp.Fits)
+			assert.Equal(t, tt.maxTokens, resp.MaxTokens != nil)
+			assert.Equal(t, "USD", resp.EstimatedCost.Currency)
+			assert.Greater(t, resp.EstimatedCost.Prompt, 0.0)
+		})
+	}
+}
+
+func TestChatCompletions_VisionGating(t *testing.T) {
+	var upstreamModel string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		upstreamModel, _ = body["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "a cat"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	imageBody := func(model string) string {
+		return `{"model": "` + model + `", "messages": [{"role": "user", "content": [
+			{"type": "text", "text": "What is this?"},
+			{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]}]}`
+	}
+
+	tests := []struct {
+		name          string
+		visionModel   string
+		body          string
+		expectedCode  int
+		expectedModel string
+	}{
+		{"Text Model Rejected", "", imageBody("GLM-4.7"), http.StatusBadRequest, ""},
+		{"Vision Model Passes", "", imageBody("GLM-4.6V"), http.StatusOK, "glm-4.6v"},
+		{"Auto Upgrade", "GLM-4.6V-Flash", imageBody("GLM-4.7"), http.StatusOK, "glm-4.6v-flash"},
+		{"Ollama Images", "GLM-4.6V", `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi", "images": ["AAAA"]}]}`, http.StatusOK, "glm-4.6v"},
+		{"Text Only Unchanged", "GLM-4.6V", `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`, http.StatusOK, "glm-4.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamModel = ""
+			gin.SetMode(gin.TestMode)
+			s := NewServer(&config.Config{BaseURL: mockUpstream.URL, VisionModel: tt.visionModel}, "127.0.0.1", 0)
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedModel, upstreamModel)
+		})
+	}
+}
+
+func TestOllamaChat_Images(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "a cat"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	body := `{"model": "GLM-4.6V", "stream": false, "messages": [{"role": "user", "content": "What is this?", "images": ["` + png + `"]}]}`
+	req := httptest.NewRequest("POST", "/api/chat", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The images reach upstream as content parts after the text
+	msg := upstreamBody["messages"].([]any)[0].(map[string]any)
+	assert.NotContains(t, msg, "images")
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "What is this?"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64," + png}},
+	}, msg["content"])
+
+	// Estimates count them like image_url parts
+	req = httptest.NewRequest("POST", "/api/estimate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var estimate estimateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &estimate))
+	assert.Greater(t, estimate.PromptTokens, 1000)
+}
+
+func TestChatCompletions_TaggedModel(t *testing.T) {
+	var upstreamModel string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		upstreamModel, _ = body["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "ok"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	req := httptest.NewRequest("POST", "/api/chat", strings.NewReader(`{"model": "glm-4.7:latest", "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glm-4.7", upstreamModel)
+}
+
+func TestHandleBlobHead(t *testing.T) {
+	s := setupTestServer()
+	digest, _ := models.GetModel("GLM-4.7")
+
+	tests := []struct {
+		name     string
+		digest   string
+		expected int
+	}{
+		{"Known Digest", "sha256:" + digest.Digest, http.StatusOK},
+		{"Unknown Digest", "sha256:" + strings.Repeat("0", 64), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("HEAD", "/api/blobs/"+tt.digest, nil)
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestThinkingCapability(t *testing.T) {
+	s := setupTestServer()
+
+	tests := []struct {
+		model    string
+		thinking bool
+	}{
+		{"GLM-4.7", true},
+		{"GLM-4-Flash", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			// Advertised in /api/show so Ollama clients expose their reasoning toggle
+			req := httptest.NewRequest("POST", "/api/show", strings.NewReader(`{"model": "`+tt.model+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			var resp api.ShowResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.thinking, slices.Contains(resp.Capabilities, "thinking"))
+
+			// Only injected upstream for models that support it
+			body := map[string]any{"model": tt.model}
+			prepareUpstreamBody(body, thinkingEnabled)
+			_, injected := body["thinking"]
+			assert.Equal(t, tt.thinking, injected)
+		})
+	}
+}
+
+func TestChatCompletions_Think(t *testing.T) {
+	var upstream map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = nil
+		json.NewDecoder(r.Body).Decode(&upstream)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"4","reasoning_content":"2+2"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	tests := []struct {
+		name     string
+		path     string
+		think    string
+		status   int
+		thinking string // Upstream thinking type
+	}{
+		{"Enabled", "/api/chat", `true`, http.StatusOK, "enabled"},
+		{"Disabled", "/api/chat", `false`, http.StatusOK, "disabled"},
+		{"Level", "/api/chat", `"high"`, http.StatusOK, "enabled"},
+		{"Invalid level", "/api/chat", `"max"`, http.StatusBadRequest, ""},
+		{"Invalid type", "/api/chat", `1`, http.StatusBadRequest, ""},
+		{"OpenAI route", "/v1/chat/completions", `false`, http.StatusOK, "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBody := `{"model": "GLM-4.7", "think": ` + tt.think + `, "messages": [{"role": "user", "content": "2+2?"}]}`
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			assert.NotContains(t, upstream, "think")
+			assert.Equal(t, map[string]any{"type": tt.thinking}, upstream["thinking"])
+
+			// Ollama's endpoint returns the reasoning as its thinking field
+			var resp struct {
+				Message map[string]any `json:"message"`
+				Choices []struct {
+					Message map[string]any `json:"message"`
+				} `json:"choices"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			if tt.path == "/api/chat" {
+				assert.Equal(t, "2+2", resp.Message["thinking"])
+			} else {
+				assert.Equal(t, "2+2", resp.Choices[0].Message["reasoning_content"])
+				assert.NotContains(t, resp.Choices[0].Message, "thinking")
+			}
+		})
+	}
+}
+
+func TestChatCompletions_UsageMetrics(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `copilot_proxy_requests_total{model="glm-4.7",client="anonymous",dialect="openai",status="200",status_class="2xx"} 1`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_tokens_total{model="glm-4.7",client="anonymous",dialect="openai",type="prompt"} 9`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_tokens_total{model="glm-4.7",client="anonymous",dialect="openai",type="completion"} 2`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_bytes_total{model="glm-4.7",client="anonymous",dialect="openai",direction="response"} 148`)
+	assert.Regexp(t, `copilot_proxy_bytes_total\{model="glm-4.7",client="anonymous",dialect="openai",direction="request"\} [1-9]`, w.Body.String())
+	assert.Contains(t, w.Body.String(), `copilot_proxy_request_duration_seconds_count{model="glm-4.7",client="anonymous",dialect="openai"} 1`)
+	assert.NotContains(t, w.Body.String(), "request_id=")
+
+	// OpenMetrics scrapers get the request ID as an exemplar of the latency bucket
+	w = httptest.NewRecorder()
+	req = adminRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, "application/openmetrics-text; version=1.0.0; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `copilot_proxy_request_duration_seconds_bucket\{model="glm-4.7",client="anonymous",dialect="openai",le="0.25"\} 1 # \{request_id="[^"]+"\} `, w.Body.String())
+	assert.True(t, strings.HasSuffix(w.Body.String(), "# EOF\n"))
+}
+
+func TestChatCompletions_UsageLedger(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, Usage: config.UsageConfig{Ledger: true, Dir: dir}}, "127.0.0.1", 0)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model": "GLM-4.7", "metadata": {"run": "7"}, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	records, err := usage.ReadMonth(dir, time.Now())
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "glm-4.7", records[0].Model)
+		assert.Equal(t, 9, records[0].PromptTokens)
+		assert.Equal(t, 2, records[0].CompletionTokens)
+		assert.Greater(t, records[0].CostUSD, 0.0)
+		assert.Equal(t, map[string]string{"run": "7"}, records[0].Metadata)
+		assert.Greater(t, records[0].RequestBytes, int64(0))
+		assert.Equal(t, int64(148), records[0].ResponseBytes)
+	}
+}
+
+func TestChatCompletions_StreamThroughput(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":20,\"total_tokens\":29}}\n\ndata: [DONE]\n\n"))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, Usage: config.UsageConfig{Ledger: true, Dir: dir}, Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	records, err := usage.ReadMonth(dir, time.Now())
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		r := records[0]
+		assert.True(t, r.Stream)
+		assert.Greater(t, r.Bytes, int64(100))
+		assert.GreaterOrEqual(t, r.DurationMS, int64(90))
+		assert.Greater(t, r.BytesPerSec, 0.0)
+		// 20 tokens over at least 0.1s
+		assert.Greater(t, r.TokensPerSec, 0.0)
+		assert.LessOrEqual(t, r.TokensPerSec, 220.0)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `copilot_proxy_streams_total{model="glm-4.7",client="anonymous",dialect="openai"} 1`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_stream_completion_tokens_total{model="glm-4.7",client="anonymous",dialect="openai"} 20`)
+	assert.Contains(t, w.Body.String(), `copilot_proxy_stream_tokens_per_second{model="glm-4.7"}`)
+}
+
+func TestChatCompletions_Trace(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream-Region", "eu")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Trace:   config.TraceConfig{Enabled: true, Header: "X-Debug-Trace", Dir: dir, Retention: time.Hour},
+	}, "127.0.0.1", 0)
+
+	send := func(traced bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if traced {
+			req.Header.Set("X-Debug-Trace", "1")
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Sample rate is zero, so only the header selects a request
+	w := send(false)
+	assert.Empty(t, w.Header().Get(traceIDHeader))
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+
+	w = send(true)
+	id := w.Header().Get(traceIDHeader)
+	assert.NotEmpty(t, id)
+
+	entries, _ = os.ReadDir(dir)
+	if assert.Len(t, entries, 1) {
+		assert.Contains(t, entries[0].Name(), id)
+		data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+		assert.NoError(t, err)
+
+		var rec map[string]any
+		assert.NoError(t, json.Unmarshal(data, &rec))
+		assert.Equal(t, "header", rec["reason"])
+		assert.Equal(t, "glm-4.7", rec["request"].(map[string]any)["model"])
+		assert.Equal(t, float64(200), rec["status"])
+		assert.Contains(t, rec["response_headers"], "X-Upstream-Region")
+		assert.Contains(t, rec["response"], `"content":"hi"`)
+		assert.Contains(t, rec, "timing")
+	}
+}
+
+func TestModelLimits(t *testing.T) {
+	s := NewServer(&config.Config{
+		ModelLimits: map[string]config.ModelLimitsConfig{
+			// Viper lowercases map keys
+			"glm-4.6v": {MaxInputTokens: 64000},
+		},
+	}, "127.0.0.1", 0)
+
+	t.Run("OpenAI models list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Object string        `json:"object"`
+			Data   []openAIModel `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "list", resp.Object)
+		assert.Len(t, resp.Data, len(models.Catalog.Models))
+
+		byID := map[string]openAIModel{}
+		for _, m := range resp.Data {
+			byID[m.ID] = m
+		}
+		assert.Equal(t, 200000, byID["GLM-4.7"].MaxInputTokens)
+		assert.Equal(t, 131072, byID["GLM-4.7"].MaxOutputTokens)
+		// Configured override
+		assert.Equal(t, 64000, byID["GLM-4.6V"].MaxInputTokens)
+		assert.Equal(t, 32768, byID["GLM-4.6V"].MaxOutputTokens)
+	})
+
+	t.Run("OpenAI single model", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/glm-4-flash", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"max_output_tokens":16384`)
+
+		w = httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/gpt-4", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Ollama show", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/show", strings.NewReader(`{"model": "GLM-4.6V"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+
+		var resp api.ShowResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, float64(64000), resp.ModelInfo["glm.context_length"])
+		assert.Equal(t, float64(32768), resp.ModelInfo["glm.max_output_tokens"])
+		assert.Contains(t, resp.Parameters, "num_ctx 64000")
+	})
+}
+
+func TestChatCompletions_DefaultModel(t *testing.T) {
+	var got map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	send := func(s *Server, model string) *httptest.ResponseRecorder {
+		body := `{"messages": [{"role": "user", "content": "hi"}]` + model + `}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	s := NewServer(&config.Config{
+		BaseURL:           mockUpstream.URL,
+		DefaultModel:      "GLM-4.7-Flash",
+		PlaceholderModels: []string{"gpt-3.5-turbo"},
+	}, "127.0.0.1", 0)
+
+	for _, model := range []string{``, `, "model": ""`, `, "model": "default"`, `, "model": "GPT-3.5-Turbo"`} {
+		w := send(s, model)
+		assert.Equal(t, http.StatusOK, w.Code, model)
+		assert.Equal(t, "glm-4.7-flash", got["model"], model)
+	}
+
+	// Real models and unknown names are left alone
+	send(s, `, "model": "glm-4.7"`)
+	assert.Equal(t, "glm-4.7", got["model"])
+	assert.Equal(t, http.StatusNotFound, send(s, `, "model": "gpt-5"`).Code)
+
+	// Without a default the placeholders are rejected as before
+	s = NewServer(&config.Config{BaseURL: mockUpstream.URL, PlaceholderModels: []string{"gpt-3.5-turbo"}}, "127.0.0.1", 0)
+	assert.Equal(t, http.StatusBadRequest, send(s, ``).Code)
+	assert.Equal(t, http.StatusNotFound, send(s, `, "model": "gpt-3.5-turbo"`).Code)
+}
+
+func TestChatCompletions_Rewrites(t *testing.T) {
+	var got map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Rewrites: []config.RewriteRule{
+			{Model: "glm-4.7*", Dialect: "ollama", Set: map[string]any{"thinking.type": "disabled"}, Delete: []string{"user"}},
+		},
+	}, "127.0.0.1", 0)
+
+	send := func(path string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model": "GLM-4.7", "user": "x", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("/api/chat")
+	assert.Equal(t, map[string]any{"type": "disabled"}, got["thinking"])
+	assert.NotContains(t, got, "user")
+
+	send("/v1/chat/completions")
+	assert.Equal(t, map[string]any{"type": "enabled"}, got["thinking"])
+	assert.Equal(t, "x", got["user"])
+}
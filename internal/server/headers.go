@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// Default upstream response headers passed through per dialect. Entries ending in "*" match a prefix.
+var (
+	DefaultOpenAIHeaders = []string{"Content-Type", "Content-Length", "Cache-Control", "Retry-After", "X-Request-Id", "X-RateLimit-*"}
+	DefaultOllamaHeaders = []string{"Content-Type", "Content-Length", "Cache-Control", "Retry-After"}
+)
+
+// hopByHopHeaders describe a single connection and are never forwarded, whatever the policy
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// envelopeHeaders describe the body bytes and no longer hold once the proxy rewrites the body
+var envelopeHeaders = []string{"Content-Length", "Content-MD5", "Digest", "ETag"}
+
+// headerPolicy decides which upstream response headers reach the client
+type headerPolicy struct {
+	allow []string // Canonical names, or prefixes ending in "*"
+	deny  []string
+}
+
+// newHeaderPolicy builds a policy from configuration, using defaults when no allowlist is set
+func newHeaderPolicy(cfg config.HeaderPolicyConfig, defaults []string) headerPolicy {
+	allow := cfg.Allow
+	if len(allow) == 0 {
+		allow = defaults
+	}
+	return headerPolicy{allow: canonicalPatterns(allow), deny: canonicalPatterns(cfg.Deny)}
+}
+
+// canonicalPatterns canonicalizes header names so matching is case-insensitive
+func canonicalPatterns(patterns []string) []string {
+	out := make([]string, len(patterns))
+	for i, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			out[i] = strings.ToLower(prefix) + "*"
+		} else {
+			out[i] = strings.ToLower(p)
+		}
+	}
+	return out
+}
+
+// allows reports whether a header may be forwarded
+func (p headerPolicy) allows(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	if hopByHopHeaders[name] {
+		return false
+	}
+	lower := strings.ToLower(name)
+	return matchHeader(p.allow, lower) && !matchHeader(p.deny, lower)
+}
+
+// matchHeader reports whether a lowercase header name matches any pattern
+func matchHeader(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		if prefix, ok := strings.CutSuffix(pat, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pat == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copy forwards the allowed headers; envelope headers are dropped when the body will be rewritten
+func (p headerPolicy) copy(dst, src http.Header, rewritten bool) {
+	for key, values := range src {
+		if !p.allows(key) {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+	if rewritten {
+		for _, h := range envelopeHeaders {
+			dst.Del(h)
+		}
+	}
+}
+
+// headerPolicyFor returns the policy of the dialect a request was made in
+func (s *Server) headerPolicyFor(path string) headerPolicy {
+	if dialectOf(path) == "ollama" {
+		return s.ollamaHeaders
+	}
+	return s.openAIHeaders
+}
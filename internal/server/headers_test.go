@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderPolicy(t *testing.T) {
+	policy := newHeaderPolicy(config.HeaderPolicyConfig{Deny: []string{"x-ratelimit-reset*"}}, DefaultOpenAIHeaders)
+
+	tests := []struct {
+		header  string
+		allowed bool
+	}{
+		{"Content-Type", true},
+		{"content-type", true},
+		{"X-RateLimit-Remaining", true},
+		{"X-Ratelimit-Reset-Requests", false}, // Denied by prefix
+		{"Set-Cookie", false},                 // Not allowed
+		{"Server", false},
+		{"Transfer-Encoding", false}, // Hop-by-hop
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, policy.allows(tt.header))
+		})
+	}
+
+	// Hop-by-hop headers cannot be allowed
+	assert.False(t, newHeaderPolicy(config.HeaderPolicyConfig{Allow: []string{"*"}}, nil).allows("Connection"))
+}
+
+func TestHeaderPolicyCopy(t *testing.T) {
+	policy := newHeaderPolicy(config.HeaderPolicyConfig{}, DefaultOpenAIHeaders)
+	src := http.Header{"Content-Type": {"application/json"}, "Content-Length": {"42"}, "Etag": {"abc"}}
+
+	dst := http.Header{}
+	policy.copy(dst, src, false)
+	assert.Equal(t, "42", dst.Get("Content-Length"))
+
+	// Envelope headers no longer describe a rewritten body
+	dst = http.Header{}
+	policy.copy(dst, src, true)
+	assert.Empty(t, dst.Get("Content-Length"))
+	assert.Equal(t, "application/json", dst.Get("Content-Type"))
+}
+
+func TestChatCompletions_HeaderPolicyPerDialect(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Remaining", "99")
+		w.Header().Set("X-Upstream-Node", "node-7")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		ResponseHeaders: config.ResponseHeadersConfig{
+			Ollama: config.HeaderPolicyConfig{Allow: []string{"Content-Type", "X-Upstream-*"}},
+		},
+	}, "127.0.0.1", 0)
+
+	send := func(path string) http.Header {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	openai := send("/v1/chat/completions")
+	assert.Equal(t, "99", openai.Get("X-RateLimit-Remaining"))
+	assert.Empty(t, openai.Get("X-Upstream-Node"))
+	assert.Empty(t, openai.Get("Set-Cookie"))
+
+	ollama := send("/api/chat")
+	assert.Empty(t, ollama.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "node-7", ollama.Get("X-Upstream-Node"))
+	assert.Empty(t, ollama.Get("Set-Cookie"))
+}
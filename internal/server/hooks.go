@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Lifecycle events that can run hook commands
+const (
+	hookServerStart       = "server_start"
+	hookUpstreamOutage    = "upstream_outage"
+	hookUpstreamRecovered = "upstream_recovered"
+	hookQuotaExceeded     = "quota_exceeded"
+	hookRequestCompleted  = "request_completed"
+)
+
+// HookEvents lists the events hooks may subscribe to
+var HookEvents = []string{hookServerStart, hookUpstreamOutage, hookUpstreamRecovered, hookQuotaExceeded, hookRequestCompleted}
+
+// defaultHookTimeout bounds a hook command without a configured timeout
+const defaultHookTimeout = 10 * time.Second
+
+// maxRunningHooks caps concurrent hook commands; events beyond it are dropped, not queued
+const maxRunningHooks = 8
+
+// quotaHookInterval is how often one client's quota rejections run hooks
+const quotaHookInterval = time.Minute
+
+// hookRunner runs configured commands on lifecycle events, passing the event as JSON on stdin.
+// Commands run in the background; a nil runner ignores events.
+type hookRunner struct {
+	hooks   []config.HookConfig
+	running chan struct{}
+	wg      sync.WaitGroup
+	clock   clock.Clock
+
+	mu        sync.Mutex
+	down      map[string]bool      // Upstreams currently in an outage, by name
+	quotaSent map[string]time.Time // Last quota_exceeded run per client
+}
+
+// newHookRunner creates a runner for the configured hooks, or nil when there are none
+func newHookRunner(cfgs []config.HookConfig) *hookRunner {
+	if len(cfgs) == 0 {
+		return nil
+	}
+	return &hookRunner{
+		hooks:     cfgs,
+		running:   make(chan struct{}, maxRunningHooks),
+		clock:     clock.Real{},
+		down:      make(map[string]bool),
+		quotaSent: make(map[string]time.Time),
+	}
+}
+
+// subscribed reports whether any hook runs on the event
+func (h *hookRunner) subscribed(event string) bool {
+	if h == nil {
+		return false
+	}
+	return slices.ContainsFunc(h.hooks, func(hc config.HookConfig) bool { return hc.Event == event })
+}
+
+// fire runs the event's hooks; tags, when given, must include one a tag-filtered hook wants
+func (h *hookRunner) fire(event string, fields map[string]any, tags ...string) {
+	if h == nil {
+		return
+	}
+
+	payload := map[string]any{"event": event, "time": h.clock.Now().UTC().Format(time.RFC3339)}
+	for k, v := range fields {
+		payload[k] = v
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode hook event", "event", event, "error", err)
+		return
+	}
+
+	for _, hc := range h.hooks {
+		if hc.Event != event {
+			continue
+		}
+		if len(hc.Tags) > 0 && !slices.ContainsFunc(hc.Tags, func(t string) bool { return slices.Contains(tags, t) }) {
+			continue
+		}
+		select {
+		case h.running <- struct{}{}:
+		default:
+			slog.Warn("Hook skipped, too many running", "event", event, "command", hc.Command)
+			continue
+		}
+		h.wg.Add(1)
+		go func() {
+			defer func() {
+				<-h.running
+				h.wg.Done()
+			}()
+			runHook(hc, input)
+		}()
+	}
+}
+
+// runHook runs one hook command with the event on stdin, logging failures with their output
+func runHook(hc config.HookConfig, input []byte) {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, hc.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	// Children of the shell may hold the output open after a timeout kills it
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		slog.Error("Hook command failed", "event", hc.Event, "command", hc.Command, "error", err,
+			"output", strings.TrimSpace(string(out[:min(len(out), 500)])))
+		return
+	}
+	slog.Debug("Hook command ran", "event", hc.Event, "command", hc.Command)
+}
+
+// shellCommand runs a command line through the platform shell
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// observeUpstream tracks an upstream's availability from an attempt and runs the outage and
+// recovery hooks on transitions. Attempts the client cancelled say nothing about the upstream.
+func (h *hookRunner) observeUpstream(ctx context.Context, name string, resp *http.Response, err error) {
+	if h == nil || ctx.Err() != nil {
+		return
+	}
+	if name == "" {
+		name = "default"
+	}
+	down := cloudUnavailable(ctx, resp, err)
+
+	h.mu.Lock()
+	changed := h.down[name] != down
+	h.down[name] = down
+	h.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if !down {
+		h.fire(hookUpstreamRecovered, map[string]any{"upstream": name})
+		return
+	}
+	detail := ""
+	if err != nil {
+		detail = err.Error()
+	} else {
+		detail = resp.Status
+	}
+	h.fire(hookUpstreamOutage, map[string]any{"upstream": name, "error": detail})
+}
+
+// quotaExceeded runs the quota hooks for a client, at most once per interval
+func (h *hookRunner) quotaExceeded(client string, limit float64) {
+	if h == nil {
+		return
+	}
+	now := h.clock.Now()
+	h.mu.Lock()
+	if last, ok := h.quotaSent[client]; ok && now.Sub(last) < quotaHookInterval {
+		h.mu.Unlock()
+		return
+	}
+	h.quotaSent[client] = now
+	h.mu.Unlock()
+
+	h.fire(hookQuotaExceeded, map[string]any{"client": client, "requests_per_minute": limit})
+}
+
+// requestCompleted runs the request_completed hooks for a finished chat request
+func (s *Server) requestCompleted(c *gin.Context, model string, status int, usage *tokenUsage, metadata map[string]string, started time.Time) {
+	if !s.hooks.subscribed(hookRequestCompleted) {
+		return
+	}
+	tags := requestTags(metadata)
+	fields := map[string]any{
+		"model":       model,
+		"status":      status,
+		"dialect":     dialectOf(c.Request.URL.Path),
+		"duration_ms": s.clock.Since(started).Milliseconds(),
+		"tags":        tags,
+		"metadata":    metadata,
+	}
+	if p := principalFrom(c); p != nil {
+		fields["client"] = p.Name
+	}
+	if usage != nil {
+		fields["prompt_tokens"], fields["completion_tokens"] = usage.PromptTokens, usage.CompletionTokens
+	}
+	s.hooks.fire(hookRequestCompleted, fields, tags...)
+}
+
+// requestTags splits a request's "tag" metadata, a comma-separated list, into tags
+func requestTags(metadata map[string]string) []string {
+	var tags []string
+	for _, t := range strings.Split(metadata["tag"], ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// wait blocks until running hook commands finish or ctx ends
+func (h *hookRunner) wait(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookLog returns a hook command saving each event to its own file, and a reader for the
+// events in the order they ran
+func hookLog(t *testing.T) (string, func() []map[string]any) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use sh")
+	}
+	dir := t.TempDir()
+	command := "cat > " + dir + "/$(date +%s%N)-$$.json"
+	return command, func() []map[string]any {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		sort.Strings(files)
+		var events []map[string]any
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ev map[string]any
+			if err := json.Unmarshal(data, &ev); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+}
+
+func TestHookRunner_Upstream(t *testing.T) {
+	command, events := hookLog(t)
+	h := newHookRunner([]config.HookConfig{
+		{Event: hookUpstreamOutage, Command: command},
+		{Event: hookUpstreamRecovered, Command: command},
+	})
+	ctx := context.Background()
+
+	// Healthy attempts run nothing; only transitions do
+	h.observeUpstream(ctx, "", &http.Response{StatusCode: 200, Status: "200 OK"}, nil)
+	h.observeUpstream(ctx, "", nil, errors.New("connection refused"))
+	h.wait(ctx)
+	h.observeUpstream(ctx, "", &http.Response{StatusCode: 503, Status: "503 Service Unavailable"}, nil)
+	h.observeUpstream(ctx, "", &http.Response{StatusCode: 200, Status: "200 OK"}, nil)
+	h.wait(ctx)
+
+	// Cancelled attempts say nothing about the upstream
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	h.observeUpstream(cancelled, "", nil, context.Canceled)
+	h.wait(ctx)
+
+	got := events()
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, "upstream_outage", got[0]["event"])
+		assert.Equal(t, "default", got[0]["upstream"])
+		assert.Equal(t, "connection refused", got[0]["error"])
+		assert.Equal(t, "upstream_recovered", got[1]["event"])
+		assert.NotEmpty(t, got[1]["time"])
+	}
+}
+
+func TestHookRunner_Quota(t *testing.T) {
+	command, events := hookLog(t)
+	h := newHookRunner([]config.HookConfig{{Event: hookQuotaExceeded, Command: command}})
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	h.clock = clk
+
+	h.quotaExceeded("ci", 10)
+	h.quotaExceeded("ci", 10)
+	h.quotaExceeded("laptop", 5)
+	clk.Advance(time.Minute)
+	h.quotaExceeded("ci", 10)
+	h.wait(context.Background())
+
+	got := events()
+	assert.Len(t, got, 3)
+	clients := map[any]int{}
+	for _, ev := range got {
+		clients[ev["client"]]++
+	}
+	assert.Equal(t, map[any]int{"ci": 2, "laptop": 1}, clients)
+}
+
+func TestHookRunner_Failures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use sh")
+	}
+	// Failing and slow commands are logged, never block callers and end at their timeout
+	h := newHookRunner([]config.HookConfig{
+		{Event: hookServerStart, Command: "exit 3"},
+		{Event: hookServerStart, Command: "sleep 10", Timeout: 50 * time.Millisecond},
+	})
+	start := time.Now()
+	h.fire(hookServerStart, nil)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	h.wait(context.Background())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	var nilRunner *hookRunner
+	nilRunner.fire(hookServerStart, nil)
+	assert.False(t, nilRunner.subscribed(hookServerStart))
+}
+
+func TestChatCompletions_RequestCompletedHook(t *testing.T) {
+	command, events := hookLog(t)
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Hooks:   []config.HookConfig{{Event: hookRequestCompleted, Command: command, Tags: []string{"nightly"}}},
+	}, "127.0.0.1", 0)
+
+	for _, metadata := range []string{`{"tag": "adhoc"}`, `{"tag": "ci, nightly", "run": "42"}`} {
+		body := `{"model": "GLM-4.7", "metadata": ` + metadata + `, "messages": [{"role": "user", "content": "hi"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	s.hooks.wait(context.Background())
+
+	got := events()
+	if assert.Len(t, got, 1, "only the tagged request runs the hook") {
+		ev := got[0]
+		assert.Equal(t, "request_completed", ev["event"])
+		assert.Equal(t, "glm-4.7", ev["model"])
+		assert.Equal(t, 200.0, ev["status"])
+		assert.Equal(t, []any{"ci", "nightly"}, ev["tags"])
+		assert.Equal(t, map[string]any{"tag": "ci, nightly", "run": "42"}, ev["metadata"])
+		assert.Equal(t, 7.0, ev["prompt_tokens"])
+		assert.Equal(t, 3.0, ev["completion_tokens"])
+	}
+}
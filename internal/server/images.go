@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/tokens"
+)
+
+// imageAdjustmentsHeader reports the image changes made to fit a request within budget
+const imageAdjustmentsHeader = "X-Image-Adjustments"
+
+// droppedImageText replaces an image removed from the conversation
+const droppedImageText = "[image removed by copilot-proxy to fit the context]"
+
+// fitImages lowers image detail and then, if allowed, drops older images until the request's
+// estimated prompt fits the model's context (leaving room for max_tokens) and the configured cost
+// budget. It returns a description of the changes, or "" if none were needed.
+func (s *Server) fitImages(bodyMap map[string]any) string {
+	cfg := s.config.Images
+	if !cfg.Downgrade {
+		return ""
+	}
+	messages, _ := bodyMap["messages"].([]any)
+	parts := imageParts(messages)
+	if len(parts) == 0 {
+		return ""
+	}
+
+	name, _ := bodyMap["model"].(string)
+	model, _ := models.GetModel(name)
+	contextLength, _ := s.modelLimits(name)
+	reserve := 0
+	if v, ok := bodyMap["max_tokens"].(float64); ok && v > 0 {
+		reserve = int(v)
+	}
+	fits := func() bool {
+		prompt := tokens.Request(bodyMap)
+		if prompt+reserve > contextLength {
+			return false
+		}
+		return cfg.MaxCost <= 0 || model.Cost(prompt, 0) <= cfg.MaxCost
+	}
+	if fits() {
+		return ""
+	}
+
+	downgraded := 0
+	for _, p := range parts {
+		image, _ := p["image_url"].(map[string]any)
+		if image != nil && image["detail"] != "low" {
+			image["detail"] = "low"
+			downgraded++
+		}
+	}
+
+	// Drop the oldest images first, always keeping the most recent one
+	dropped := 0
+	if cfg.DropOlder {
+		for _, p := range parts[:len(parts)-1] {
+			if fits() {
+				break
+			}
+			clear(p)
+			p["type"] = "text"
+			p["text"] = droppedImageText
+			dropped++
+		}
+	}
+
+	if downgraded == 0 && dropped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("downgraded=%d, dropped=%d", downgraded, dropped)
+}
+
+// imageParts returns the image_url content parts of the messages in conversation order
+func imageParts(messages []any) []map[string]any {
+	var parts []map[string]any
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		content, _ := msg["content"].([]any)
+		for _, p := range content {
+			if part, _ := p.(map[string]any); part["type"] == "image_url" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return parts
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// imageRequest builds a vision request with one image per user turn
+func imageRequest(images int, maxTokens float64) map[string]any {
+	var messages []any
+	for range images {
+		messages = append(messages, map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "text", "text": "And this one?"},
+			map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,AAAA"}},
+		}})
+	}
+	return map[string]any{"model": "GLM-4.6V", "messages": messages, "max_tokens": maxTokens}
+}
+
+func TestFitImages(t *testing.T) {
+	s := NewServer(&config.Config{Images: config.ImagesConfig{Downgrade: true}}, "127.0.0.1", 0)
+	contextLength, _ := s.modelLimits("GLM-4.6V")
+
+	t.Run("Fits", func(t *testing.T) {
+		body := imageRequest(3, 1000)
+		assert.Empty(t, s.fitImages(body))
+		assert.Len(t, imageParts(body["messages"].([]any))[0]["image_url"], 1)
+	})
+
+	t.Run("Downgrade", func(t *testing.T) {
+		// Three full-detail images leave less than 2500 tokens for the completion
+		body := imageRequest(3, float64(contextLength-2500))
+		assert.Equal(t, "downgraded=3, dropped=0", s.fitImages(body))
+		for _, p := range imageParts(body["messages"].([]any)) {
+			assert.Equal(t, "low", p["image_url"].(map[string]any)["detail"])
+		}
+	})
+
+	t.Run("DropOlder", func(t *testing.T) {
+		s := NewServer(&config.Config{Images: config.ImagesConfig{Downgrade: true, DropOlder: true}}, "127.0.0.1", 0)
+		body := imageRequest(3, float64(contextLength-200))
+		assert.Equal(t, "downgraded=3, dropped=2", s.fitImages(body))
+
+		parts := imageParts(body["messages"].([]any))
+		assert.Len(t, parts, 1)
+		first := body["messages"].([]any)[0].(map[string]any)["content"].([]any)[1].(map[string]any)
+		assert.Equal(t, droppedImageText, first["text"])
+	})
+
+	t.Run("CostBudget", func(t *testing.T) {
+		s := NewServer(&config.Config{Images: config.ImagesConfig{Downgrade: true, MaxCost: 0.0005}}, "127.0.0.1", 0)
+		body := imageRequest(3, 100)
+		assert.Equal(t, "downgraded=3, dropped=0", s.fitImages(body))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := NewServer(&config.Config{}, "127.0.0.1", 0)
+		assert.Empty(t, s.fitImages(imageRequest(3, float64(contextLength))))
+	})
+}
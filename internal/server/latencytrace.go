@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/gin-gonic/gin"
+)
+
+// latencyTraceHeader asks for a chunk-by-chunk timing summary of a streamed response
+const latencyTraceHeader = "X-Latency-Trace"
+
+// gapBuckets are the upper bounds of the inter-chunk gap histogram
+var gapBuckets = []time.Duration{
+	10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+// Thresholds of the latency trace verdict
+const (
+	stallThreshold      = 2 * time.Second // An arrival gap this long is an upstream stall
+	slowClientThreshold = time.Second     // A relay write this long means the client reads slowly
+)
+
+// latencyTrace wraps an upstream stream body and times every read. Arrival gaps are the time
+// between chunks carrying data; relay time is what the proxy spends between reads, writing the
+// previous chunk to the client. A frozen stream with long arrival gaps stalled upstream; one
+// with long relay times is held up between the proxy and the client; one whose chunks each
+// carry many events was buffered before it reached the proxy.
+type latencyTrace struct {
+	io.ReadCloser
+	clock clock.Clock
+	sent  time.Time // When the request was sent upstream
+
+	first      time.Time // First chunk
+	lastData   time.Time // Latest chunk
+	lastReturn time.Time // Latest return from Read
+	gaps       []time.Duration
+	longest    time.Duration
+	longestAt  time.Duration // From the first chunk to the end of the longest gap
+	longestIdx int           // Chunk that ended the longest gap
+	events     int
+	batched    int
+	bytes      int64
+	relay      time.Duration
+	maxRelay   time.Duration
+}
+
+// newLatencyTrace starts timing body for a request sent at sent
+func newLatencyTrace(body io.ReadCloser, sent time.Time, clk clock.Clock) *latencyTrace {
+	return &latencyTrace{ReadCloser: body, clock: clk, sent: sent}
+}
+
+// Read times the read and the relay since the previous one
+func (t *latencyTrace) Read(p []byte) (int, error) {
+	called := t.clock.Now()
+	if !t.lastReturn.IsZero() {
+		d := called.Sub(t.lastReturn)
+		t.relay += d
+		t.maxRelay = max(t.maxRelay, d)
+	}
+	n, err := t.ReadCloser.Read(p)
+	now := t.clock.Now()
+	t.lastReturn = now
+	if n == 0 {
+		return n, err
+	}
+
+	if t.first.IsZero() {
+		t.first = now
+	} else {
+		gap := now.Sub(t.lastData)
+		t.gaps = append(t.gaps, gap)
+		if gap > t.longest {
+			t.longest, t.longestAt, t.longestIdx = gap, now.Sub(t.first), len(t.gaps)
+		}
+	}
+	t.lastData = now
+	t.bytes += int64(n)
+	events := bytes.Count(p[:n], []byte("\n\n"))
+	t.events += events
+	if events > 1 {
+		t.batched++
+	}
+	return n, err
+}
+
+// latencyBucket counts the gaps up to a bound; the last bucket has no bound
+type latencyBucket struct {
+	LE    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// latencyStall is the longest gap between chunks
+type latencyStall struct {
+	MS         float64 `json:"ms"`
+	AtMS       float64 `json:"at_ms"`       // From the first chunk to the end of the stall
+	AfterChunk int     `json:"after_chunk"` // Chunks received before the stall
+}
+
+// latencySummary describes how a stream arrived from upstream and was relayed
+type latencySummary struct {
+	Chunks        int             `json:"chunks"`
+	Events        int             `json:"events"`
+	BatchedChunks int             `json:"batched_chunks"` // Chunks carrying more than one event
+	Bytes         int64           `json:"bytes"`
+	FirstChunkMS  float64         `json:"first_chunk_ms"` // From sending the request
+	DurationMS    float64         `json:"duration_ms"`    // From the first chunk to the last
+	GapP50MS      float64         `json:"gap_p50_ms"`
+	GapP95MS      float64         `json:"gap_p95_ms"`
+	GapP99MS      float64         `json:"gap_p99_ms"`
+	Histogram     []latencyBucket `json:"histogram"`
+	LongestStall  latencyStall    `json:"longest_stall"`
+	RelayMS       float64         `json:"relay_ms"`     // Spent writing to the client between reads
+	MaxRelayMS    float64         `json:"max_relay_ms"` // Longest single write to the client
+	Verdict       string          `json:"verdict"`      // steady, upstream_stall, upstream_buffering or slow_client
+}
+
+// summary describes the stream, or returns nil when no data arrived
+func (t *latencyTrace) summary() *latencySummary {
+	if t.first.IsZero() {
+		return nil
+	}
+	s := &latencySummary{
+		Chunks:        len(t.gaps) + 1,
+		Events:        t.events,
+		BatchedChunks: t.batched,
+		Bytes:         t.bytes,
+		FirstChunkMS:  millis(t.first.Sub(t.sent)),
+		DurationMS:    millis(t.lastData.Sub(t.first)),
+		LongestStall:  latencyStall{MS: millis(t.longest), AtMS: millis(t.longestAt), AfterChunk: t.longestIdx},
+		RelayMS:       millis(t.relay),
+		MaxRelayMS:    millis(t.maxRelay),
+	}
+
+	sorted := slices.Sorted(slices.Values(t.gaps))
+	s.GapP50MS, s.GapP95MS, s.GapP99MS = millis(percentile(sorted, 50)), millis(percentile(sorted, 95)), millis(percentile(sorted, 99))
+	for _, bound := range gapBuckets {
+		s.Histogram = append(s.Histogram, latencyBucket{LE: bound.String()})
+	}
+	s.Histogram = append(s.Histogram, latencyBucket{LE: "+Inf"})
+	for _, gap := range t.gaps {
+		i, _ := slices.BinarySearch(gapBuckets, gap)
+		s.Histogram[i].Count++
+	}
+
+	switch {
+	case t.maxRelay >= slowClientThreshold && t.maxRelay >= t.longest/2:
+		s.Verdict = "slow_client"
+	case t.longest >= stallThreshold:
+		s.Verdict = "upstream_stall"
+	case t.batched*4 > s.Chunks:
+		s.Verdict = "upstream_buffering"
+	default:
+		s.Verdict = "steady"
+	}
+	return s
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted durations, or 0 for none
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[max((len(sorted)*p+99)/100-1, 0)]
+}
+
+// startLatencyTrace wraps a successful stream's body when the client sent X-Latency-Trace with
+// any value
+func (s *Server) startLatencyTrace(c *gin.Context, resp *http.Response, sent time.Time) *latencyTrace {
+	if c.GetHeader(latencyTraceHeader) == "" || resp.StatusCode >= 300 || !isEventStream(resp) {
+		return nil
+	}
+	t := newLatencyTrace(resp.Body, sent, s.clock)
+	resp.Body = t
+	return t
+}
+
+// finish logs the summary and, on SSE responses, appends it as a comment line that
+// SSE clients ignore and curl shows
+func (t *latencyTrace) finish(c *gin.Context, requestID, model string) {
+	summary := t.summary()
+	if summary == nil {
+		return
+	}
+	slog.Info("Stream latency trace", "request_id", requestID, "model", model, "verdict", summary.Verdict,
+		"chunks", summary.Chunks, "events", summary.Events, "batched_chunks", summary.BatchedChunks,
+		"first_chunk_ms", summary.FirstChunkMS, "gap_p95_ms", summary.GapP95MS,
+		"longest_stall_ms", summary.LongestStall.MS, "max_relay_ms", summary.MaxRelayMS)
+	if !strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	c.Writer.Write([]byte(": latency-trace " + string(data) + "\n\n"))
+	c.Writer.Flush()
+}
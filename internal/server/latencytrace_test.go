@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timedReader returns one chunk per read, advancing the clock by its delay first
+type timedReader struct {
+	clock  *clock.Fake
+	chunks []string
+	delays []time.Duration
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	r.clock.Advance(r.delays[0])
+	n := copy(p, r.chunks[0])
+	r.chunks, r.delays = r.chunks[1:], r.delays[1:]
+	return n, nil
+}
+
+func TestLatencyTrace(t *testing.T) {
+	event := "data: {}\n\n"
+	tests := []struct {
+		name    string
+		delays  []time.Duration
+		chunks  []string
+		relay   time.Duration // Spent by the relay between reads
+		verdict string
+	}{
+		{"steady", []time.Duration{300 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond}, []string{event, event, event, event}, 0, "steady"},
+		{"upstream stall", []time.Duration{300 * time.Millisecond, 20 * time.Millisecond, 3 * time.Second, 20 * time.Millisecond}, []string{event, event, event, event}, 0, "upstream_stall"},
+		{"upstream buffering", []time.Duration{300 * time.Millisecond, 900 * time.Millisecond, 900 * time.Millisecond}, []string{event + event + event, event + event, event}, 0, "upstream_buffering"},
+		{"slow client", []time.Duration{300 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond}, []string{event, event, event}, 2 * time.Second, "slow_client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			lt := newLatencyTrace(io.NopCloser(&timedReader{clock: fake, chunks: tt.chunks, delays: tt.delays}), fake.Now(), fake)
+			buf := make([]byte, 1024)
+			for {
+				if _, err := lt.Read(buf); err != nil {
+					break
+				}
+				fake.Advance(tt.relay)
+			}
+			s := lt.summary()
+			require.NotNil(t, s)
+			assert.Equal(t, tt.verdict, s.Verdict)
+			assert.Equal(t, len(tt.chunks), s.Chunks)
+			assert.Equal(t, 300.0, s.FirstChunkMS)
+		})
+	}
+
+	// The longest stall is located and the gaps are bucketed
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	lt := newLatencyTrace(io.NopCloser(&timedReader{clock: fake,
+		chunks: []string{event, event, event, event},
+		delays: []time.Duration{time.Second, 5 * time.Millisecond, 3 * time.Second, 5 * time.Millisecond}}), fake.Now(), fake)
+	io.ReadAll(lt)
+	s := lt.summary()
+	assert.Equal(t, latencyStall{MS: 3000, AtMS: 3005, AfterChunk: 2}, s.LongestStall)
+	assert.Equal(t, latencyBucket{LE: "10ms", Count: 2}, s.Histogram[0])
+	assert.Equal(t, latencyBucket{LE: "5s", Count: 1}, s.Histogram[len(s.Histogram)-2])
+	assert.Equal(t, 3000.0, s.GapP99MS)
+}
+
+func TestLatencyTrace_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL}, "127.0.0.1", 0)
+	chat := func(trace bool) string {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if trace {
+			req.Header.Set(latencyTraceHeader, "1")
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	assert.NotContains(t, chat(false), "latency-trace")
+	body := chat(true)
+	_, comment, ok := strings.Cut(body, "data: [DONE]\n\n: latency-trace ")
+	require.True(t, ok, body)
+	var summary latencySummary
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(comment)), &summary))
+	assert.Equal(t, 2, summary.Events)
+	assert.NotEmpty(t, summary.Verdict)
+}
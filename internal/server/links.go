@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/netguard"
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+	"github.com/gin-gonic/gin"
+)
+
+// linkCheckHeader lowers the configured dead link mode for one request: off, or annotate when
+// the configured mode is strip. Clients cannot turn checks on, since each makes outbound requests.
+const linkCheckHeader = "X-Link-Check"
+
+// linkModeRank orders the dead link modes from least to most invasive
+var linkModeRank = map[string]int{"off": 0, "": 0, postprocess.LinksAnnotate: 1, postprocess.LinksStrip: 2}
+
+// linkCheckUserAgent identifies link checks; some sites refuse requests without a user agent
+const linkCheckUserAgent = "Mozilla/5.0 (compatible; copilot-proxy link check)"
+
+// maxLinkCacheEntries bounds the link result cache
+const maxLinkCacheEntries = 10000
+
+// linkState is the outcome of checking a link
+type linkState int
+
+const (
+	linkUnknown linkState = iota // Timed out, refused by policy, or an ambiguous status
+	linkAlive
+	linkDead // The host does not exist or the server reports the page missing
+)
+
+func (s linkState) String() string {
+	return [...]string{"unknown", "alive", "dead"}[s]
+}
+
+// linkResult is a cached link check
+type linkResult struct {
+	state   linkState
+	checked time.Time
+}
+
+// linkChecker probes the URLs in completions so hallucinated links can be marked or removed
+type linkChecker struct {
+	mode     string
+	timeout  time.Duration
+	maxLinks int
+	ttl      time.Duration
+	marker   string
+	client   *http.Client
+	clock    clock.Clock
+
+	mu    sync.Mutex
+	cache map[string]linkResult
+}
+
+// newLinkChecker creates a checker; zero settings take their defaults
+func newLinkChecker(cfg config.LinksConfig) *linkChecker {
+	lc := &linkChecker{
+		mode:     cfg.Mode,
+		timeout:  cfg.Timeout,
+		maxLinks: cfg.MaxLinks,
+		ttl:      cfg.CacheTTL,
+		marker:   cfg.Marker,
+		clock:    clock.Real{},
+		cache:    make(map[string]linkResult),
+	}
+	if lc.timeout <= 0 {
+		lc.timeout = 3 * time.Second
+	}
+	if lc.maxLinks <= 0 {
+		lc.maxLinks = 20
+	}
+	if lc.marker == "" {
+		lc.marker = " [dead link]"
+	}
+
+	dialer := &net.Dialer{Timeout: lc.timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = netguard.PublicOnly
+	}
+	// No proxy: a proxy would dial the link's host itself, bypassing the address check above
+	lc.client = &http.Client{Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: lc.timeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     30 * time.Second,
+	}}
+	return lc
+}
+
+// transform returns the link check for this request's response, or nil when it is off
+func (lc *linkChecker) transform(c *gin.Context) contentTransform {
+	mode := lc.mode
+	if h := c.GetHeader(linkCheckHeader); h != "" {
+		if rank, ok := linkModeRank[h]; !ok || rank > linkModeRank[mode] {
+			slog.Debug("Ignoring link check mode", "header", linkCheckHeader, "value", h, "configured", mode)
+		} else {
+			mode = h
+		}
+	}
+	if mode != postprocess.LinksAnnotate && mode != postprocess.LinksStrip {
+		return nil
+	}
+
+	t := linkTransform{checker: lc, ctx: c.Request.Context(), mode: mode, budget: new(atomic.Int64)}
+	t.budget.Store(int64(lc.maxLinks))
+	return t
+}
+
+// deadLinks checks links concurrently, up to the remaining budget, and returns the dead ones
+func (lc *linkChecker) deadLinks(ctx context.Context, urls []string, budget *atomic.Int64) map[string]bool {
+	dead := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		if budget.Add(-1) < 0 {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lc.check(ctx, url) == linkDead {
+				mu.Lock()
+				dead[url] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return dead
+}
+
+// check probes one link with HEAD, falling back to GET for servers that do not allow HEAD.
+// Only definite answers are cached.
+func (lc *linkChecker) check(ctx context.Context, url string) linkState {
+	lc.mu.Lock()
+	cached, ok := lc.cache[url]
+	lc.mu.Unlock()
+	if ok && lc.clock.Since(cached.checked) < lc.ttl {
+		return cached.state
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lc.timeout)
+	defer cancel()
+	state := lc.probe(ctx, http.MethodHead, url)
+	if state == linkUnknown && ctx.Err() == nil {
+		state = lc.probe(ctx, http.MethodGet, url)
+	}
+	slog.Debug("Checked link", "url", url, "state", state)
+
+	if state != linkUnknown && lc.ttl > 0 {
+		lc.mu.Lock()
+		if len(lc.cache) >= maxLinkCacheEntries {
+			clear(lc.cache)
+		}
+		lc.cache[url] = linkResult{state: state, checked: lc.clock.Now()}
+		lc.mu.Unlock()
+	}
+	return state
+}
+
+// probe sends one request and classifies the answer
+func (lc *linkChecker) probe(ctx context.Context, method, url string) linkState {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return linkUnknown
+	}
+	req.Header.Set("User-Agent", linkCheckUserAgent)
+
+	resp, err := lc.client.Do(req)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if (errors.As(err, &dnsErr) && dnsErr.IsNotFound) || errors.Is(err, syscall.ECONNREFUSED) {
+			return linkDead
+		}
+		return linkUnknown
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return linkDead
+	case resp.StatusCode < 400:
+		return linkAlive
+	}
+	// Forbidden, rate limited, server errors and HEAD refusals say nothing about the page
+	return linkUnknown
+}
+
+// linkTransform marks or removes dead links in a response's content
+type linkTransform struct {
+	checker *linkChecker
+	ctx     context.Context
+	mode    string
+	budget  *atomic.Int64 // Links this response may still check
+}
+
+// Apply implements contentTransform
+func (t linkTransform) Apply(content string) string {
+	urls := postprocess.FindLinks(content)
+	if len(urls) == 0 {
+		return content
+	}
+	dead := t.checker.deadLinks(t.ctx, urls, t.budget)
+	if len(dead) == 0 {
+		return content
+	}
+	slog.Info("Dead links in completion", "count", len(dead), "mode", t.mode)
+	return postprocess.RewriteLinks(content, func(url string) bool { return dead[url] }, t.mode, t.checker.marker)
+}
+
+// NewStream implements contentTransform; links are checked a line at a time, so each line is
+// held back until its links have been checked
+func (t linkTransform) NewStream() streamTransform {
+	return &lineStream{apply: t.Apply}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkCheck(t *testing.T) {
+	var probes atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		switch r.URL.Path {
+		case "/ok":
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer site.Close()
+
+	// A port nobody listens on refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := "http://" + l.Addr().String() + "/docs"
+	l.Close()
+
+	content := "Docs: " + site.URL + "/ok, [guide](" + site.URL + "/missing), " + site.URL + "/gone\n" +
+		"Also " + site.URL + "/no-head and " + site.URL + "/forbidden and " + refused + "."
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			// Split the content mid-URL to exercise line buffering
+			for _, part := range []string{content[:20], content[20:]} {
+				delta, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": part}}}})
+				w.Write([]byte("data: " + string(delta) + "\n\n"))
+			}
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		resp, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}}}})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	newServer := func(links config.LinksConfig) *Server {
+		return NewServer(&config.Config{BaseURL: mockUpstream.URL, Links: links}, "127.0.0.1", 0)
+	}
+	chat := func(s *Server, stream bool, mode string) string {
+		body := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "links?"}]}`
+		if stream {
+			body = `{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "links?"}]}`
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if mode != "" {
+			req.Header.Set(linkCheckHeader, mode)
+		}
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		if !stream {
+			var resp struct {
+				Choices []struct {
+					Message struct {
+						Content string `json:"content"`
+					} `json:"message"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			return resp.Choices[0].Message.Content
+		}
+		var text strings.Builder
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			for _, ch := range chunk.Choices {
+				text.WriteString(ch.Delta.Content)
+			}
+		}
+		return text.String()
+	}
+
+	annotated := "Docs: " + site.URL + "/ok, [guide](" + site.URL + "/missing) [dead link], " + site.URL + "/gone [dead link]\n" +
+		"Also " + site.URL + "/no-head and " + site.URL + "/forbidden and " + refused + " [dead link]."
+	stripped := "Docs: " + site.URL + "/ok, guide, \n" +
+		"Also " + site.URL + "/no-head and " + site.URL + "/forbidden and ."
+
+	s := newServer(config.LinksConfig{Mode: "annotate", AllowPrivate: true, CacheTTL: time.Minute})
+	assert.Equal(t, annotated, chat(s, false, ""))
+	assert.Equal(t, annotated, chat(s, true, ""))
+	assert.Equal(t, content, chat(s, false, "off"))
+	// The header only lowers the configured mode
+	assert.Equal(t, annotated, chat(s, false, "strip"))
+	strip := newServer(config.LinksConfig{Mode: "strip", AllowPrivate: true})
+	assert.Equal(t, stripped, chat(strip, false, ""))
+	assert.Equal(t, annotated, chat(strip, false, "annotate"))
+
+	// Definite results are cached; the forbidden link is probed again each time
+	before := probes.Load()
+	chat(s, false, "")
+	assert.Equal(t, int64(2), probes.Load()-before)
+
+	// Off by default, where the header cannot turn checks on, and links to private addresses
+	// are never probed unless allowed
+	assert.Equal(t, content, chat(newServer(config.LinksConfig{}), false, ""))
+	before = probes.Load()
+	assert.Equal(t, content, chat(newServer(config.LinksConfig{}), false, "annotate"))
+	assert.Equal(t, before, probes.Load())
+
+	// Only max_links links are checked per response
+	assert.Equal(t, "Docs: "+site.URL+"/ok, [guide]("+site.URL+"/missing) [dead link], "+site.URL+"/gone\n"+
+		"Also "+site.URL+"/no-head and "+site.URL+"/forbidden and "+refused+".",
+		chat(newServer(config.LinksConfig{Mode: "annotate", AllowPrivate: true, MaxLinks: 2}), false, ""))
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// anthropicMessagesPath is the Anthropic Messages API endpoint
+const anthropicMessagesPath = "/v1/messages"
+
+// anthropicRequest is an Anthropic Messages API request
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	System        json.RawMessage      `json:"system"` // A string or text blocks
+	Messages      []anthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature"`
+	TopP          *float64             `json:"top_p"`
+	StopSequences []string             `json:"stop_sequences"`
+	Stream        bool                 `json:"stream"`
+	Tools         []anthropicTool      `json:"tools"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice"`
+	Thinking      *struct {
+		Type string `json:"type"` // "enabled" or "disabled"
+	} `json:"thinking"`
+}
+
+// anthropicMessage is a conversation turn, whose content is a string or content blocks
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// anthropicBlock is a content block of any type; fields are set according to the type
+type anthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+
+	Source *struct {
+		Type      string `json:"type"` // "base64" or "url"
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+		URL       string `json:"url"`
+	} `json:"source"`
+
+	// tool_use
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+
+	// tool_result
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// anthropicTool is a client tool definition
+type anthropicTool struct {
+	Type        string         `json:"type"` // Empty or "custom"; server tools are not available
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// anthropicToolChoice says whether and which tools the model must use
+type anthropicToolChoice struct {
+	Type string `json:"type"` // auto, any, tool or none
+	Name string `json:"name"`
+}
+
+// handleMessages serves the Anthropic Messages API by translating requests into chat
+// completions and answers back into Anthropic messages, so Anthropic clients can use GLM
+func (s *Server) handleMessages(c *gin.Context) {
+	// Every answer, errors included, is in the Anthropic format
+	w := newAnthropicWriter(c.Writer, "")
+	c.Writer = w
+	defer w.Close()
+
+	var req anthropicRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, api.ErrBadRequest("Invalid JSON: %v", err))
+		return
+	}
+	w.model = req.Model
+	bodyMap, err := s.anthropicToChat(req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	s.proxyChat(c, bodyMap)
+}
+
+// anthropicModel returns the catalog model serving a requested model: Claude models are mapped,
+// other names are kept
+func (s *Server) anthropicModel(name string) string {
+	cfg := s.config.Anthropic
+	for claude, model := range cfg.Models {
+		if strings.EqualFold(claude, name) {
+			return model
+		}
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case !strings.HasPrefix(lower, "claude"):
+		return name
+	case strings.Contains(lower, "haiku") && cfg.SmallModel != "":
+		return cfg.SmallModel
+	case cfg.Model != "":
+		return cfg.Model
+	}
+	return name
+}
+
+// anthropicToChat converts a Messages API request into a chat completion body
+func (s *Server) anthropicToChat(req anthropicRequest) (map[string]any, error) {
+	var messages []any
+	if len(req.System) > 0 {
+		system, err := anthropicText(req.System)
+		if err != nil {
+			return nil, api.ErrBadRequest("system: %v", err)
+		}
+		if system != "" {
+			messages = append(messages, map[string]any{"role": "system", "content": system})
+		}
+	}
+	for i, m := range req.Messages {
+		converted, err := anthropicMessageToChat(m)
+		if err != nil {
+			return nil, api.ErrBadRequest("message %d: %v", i, err)
+		}
+		messages = append(messages, converted...)
+	}
+
+	bodyMap := map[string]any{
+		"model":    s.anthropicModel(req.Model),
+		"messages": messages,
+		"stream":   req.Stream,
+	}
+	if req.MaxTokens > 0 {
+		// As JSON decoding would have it, so image fitting and estimates read it
+		bodyMap["max_tokens"] = float64(req.MaxTokens)
+	}
+	if req.Temperature != nil {
+		bodyMap["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		bodyMap["top_p"] = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		bodyMap["stop"] = req.StopSequences
+	}
+	if req.Thinking != nil {
+		bodyMap["think"] = req.Thinking.Type != "disabled"
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			if t.Type != "" && t.Type != "custom" {
+				return nil, api.ErrBadRequest("tool '%s' of type '%s' is not supported", t.Name, t.Type)
+			}
+			fn := map[string]any{"name": t.Name, "description": t.Description}
+			if t.InputSchema != nil {
+				fn["parameters"] = t.InputSchema
+			}
+			tools = append(tools, map[string]any{"type": "function", "function": fn})
+		}
+		bodyMap["tools"] = tools
+	}
+	if tc := req.ToolChoice; tc != nil {
+		switch tc.Type {
+		case "auto", "none":
+			bodyMap["tool_choice"] = tc.Type
+		case "any":
+			bodyMap["tool_choice"] = "required"
+		case "tool":
+			bodyMap["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": tc.Name}}
+		default:
+			return nil, api.ErrBadRequest("invalid tool_choice type '%s'", tc.Type)
+		}
+	}
+	return bodyMap, nil
+}
+
+// anthropicMessageToChat converts a turn into chat messages. Tool results in a user turn
+// become tool messages, ahead of the turn's other content.
+func anthropicMessageToChat(m anthropicMessage) ([]any, error) {
+	blocks, err := anthropicBlocks(m.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []any
+	var texts []string
+	var parts []any // Text and image parts, when the turn carries images
+	var calls []any
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			texts = append(texts, b.Text)
+			parts = append(parts, map[string]any{"type": "text", "text": b.Text})
+		case "image":
+			if m.Role != "user" || b.Source == nil {
+				return nil, errUnsupportedBlock(b.Type)
+			}
+			url := b.Source.URL
+			if b.Source.Type == "base64" {
+				url = "data:" + b.Source.MediaType + ";base64," + b.Source.Data
+			}
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		case "tool_use":
+			if m.Role != "assistant" {
+				return nil, errUnsupportedBlock(b.Type)
+			}
+			arguments := "{}"
+			var compact bytes.Buffer
+			if json.Compact(&compact, b.Input) == nil {
+				arguments = compact.String()
+			}
+			calls = append(calls, map[string]any{
+				"id":       b.ID,
+				"type":     "function",
+				"function": map[string]any{"name": b.Name, "arguments": arguments},
+			})
+		case "tool_result":
+			if m.Role != "user" {
+				return nil, errUnsupportedBlock(b.Type)
+			}
+			content, err := anthropicText(b.Content)
+			if err != nil {
+				return nil, err
+			}
+			if b.IsError {
+				content = "Error: " + content
+			}
+			out = append(out, map[string]any{"role": "tool", "tool_call_id": b.ToolUseID, "content": content})
+		case "thinking", "redacted_thinking":
+			// Upstream keeps no reasoning between turns
+		default:
+			return nil, errUnsupportedBlock(b.Type)
+		}
+	}
+
+	msg := map[string]any{"role": m.Role}
+	switch {
+	case len(parts) > len(texts):
+		msg["content"] = parts
+	case len(texts) > 0:
+		msg["content"] = strings.Join(texts, "\n\n")
+	case len(calls) > 0:
+		msg["content"] = ""
+	default:
+		// A turn of tool results only
+		return out, nil
+	}
+	if len(calls) > 0 {
+		msg["tool_calls"] = calls
+	}
+	return append(out, msg), nil
+}
+
+// anthropicBlocks decodes content given as a string or as blocks
+func anthropicBlocks(raw json.RawMessage) ([]anthropicBlock, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []anthropicBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, api.ErrBadRequest("content must be a string or an array of content blocks")
+	}
+	return blocks, nil
+}
+
+// anthropicText joins the text of content given as a string or as blocks. Images, which chat
+// completions only take in user messages, are replaced by a note.
+func anthropicText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	blocks, err := anthropicBlocks(raw)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			texts = append(texts, b.Text)
+		case "image":
+			texts = append(texts, "[image omitted]")
+		default:
+			return "", errUnsupportedBlock(b.Type)
+		}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// errUnsupportedBlock rejects a content block that has no chat completion equivalent where it is
+func errUnsupportedBlock(blockType string) error {
+	return api.ErrBadRequest("content block type '%s' is not supported here", blockType)
+}
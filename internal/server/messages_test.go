@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessages(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = nil
+		_ = json.Unmarshal(data, &upstreamBody)
+		if upstreamBody["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1}}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c2","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		BaseURL:   mockUpstream.URL,
+		Anthropic: config.AnthropicConfig{Model: "GLM-4.7", SmallModel: "GLM-4.7-Flash", Models: map[string]string{"claude-opus-4-1": "GLM-4.6V"}},
+	}, "127.0.0.1", 0)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A conversation with a system prompt, images and a tool round trip
+	w := post(`{
+		"model": "claude-opus-4-1", "max_tokens": 1024, "stop_sequences": ["END"],
+		"system": [{"type": "text", "text": "Be brief.", "cache_control": {"type": "ephemeral"}}],
+		"thinking": {"type": "disabled"},
+		"tools": [{"name": "weather", "description": "Current weather", "input_schema": {"type": "object", "properties": {"city": {"type": "string"}}}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": "Weather in Oslo?"},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "Look it up", "signature": "x"},
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "call_1", "name": "weather", "input": {"city": "Oslo"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "call_1", "content": [{"type": "text", "text": "Sunny"}]},
+				{"type": "text", "text": "And this?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}
+			]}
+		]
+	}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "glm-4.6v", upstreamBody["model"])
+	assert.Equal(t, float64(1024), upstreamBody["max_tokens"])
+	assert.Equal(t, []any{"END"}, upstreamBody["stop"])
+	assert.Equal(t, map[string]any{"type": "disabled"}, upstreamBody["thinking"])
+	assert.Equal(t, "required", upstreamBody["tool_choice"])
+	assert.Equal(t, []any{map[string]any{"type": "function", "function": map[string]any{
+		"name": "weather", "description": "Current weather",
+		"parameters": map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}}}, upstreamBody["tools"])
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "Be brief."},
+		map[string]any{"role": "user", "content": "Weather in Oslo?"},
+		map[string]any{"role": "assistant", "content": "Checking.", "tool_calls": []any{map[string]any{
+			"id": "call_1", "type": "function", "function": map[string]any{"name": "weather", "arguments": `{"city":"Oslo"}`},
+		}}},
+		map[string]any{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"},
+		map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "text", "text": "And this?"},
+			map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,iVBORw0KGgo="}},
+		}},
+	}, upstreamBody["messages"])
+
+	var msg map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &msg))
+	assert.Equal(t, "message", msg["type"])
+	assert.Equal(t, "claude-opus-4-1", msg["model"])
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Hi"}}, msg["content"])
+	assert.Equal(t, "end_turn", msg["stop_reason"])
+
+	// Other Claude models go to the configured model, Haiku models to the small one
+	w = post(`{"model": "claude-haiku-4-5", "max_tokens": 16, "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glm-4.7-flash", upstreamBody["model"])
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream"))
+	names, _ := anthropicEvents(t, w.Body.String())
+	assert.Equal(t, []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}, names)
+	post(`{"model": "claude-sonnet-4-5", "max_tokens": 16, "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Equal(t, "glm-4.7", upstreamBody["model"])
+
+	// Requests that cannot be translated fail in the Anthropic error format
+	upstreamBody = nil
+	for _, body := range []string{
+		`{"model": "claude-sonnet-4-5", "messages": [{"role": "user", "content": [{"type": "document", "source": {}}]}]}`,
+		`{"model": "claude-sonnet-4-5", "tools": [{"type": "web_search_20250305", "name": "web_search"}], "messages": [{"role": "user", "content": "hi"}]}`,
+		`{"model": "claude-sonnet-4-5", "messages": []}`,
+	} {
+		w = post(body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "error", doc["type"])
+		assert.Equal(t, "invalid_request_error", doc["error"].(map[string]any)["type"])
+	}
+	assert.Nil(t, upstreamBody)
+}
+
+func TestMessages_ImageFitting(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"Cats"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		BaseURL:   mockUpstream.URL,
+		Anthropic: config.AnthropicConfig{Model: "GLM-4.6V"},
+		Images:    config.ImagesConfig{Downgrade: true},
+	}, "127.0.0.1", 0)
+	contextLength, _ := s.modelLimits("GLM-4.6V")
+
+	// max_tokens leaves too little room for three full-detail images
+	image := `{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}`
+	body := `{"model": "claude-sonnet-4-5", "max_tokens": ` + strconv.Itoa(contextLength-2500) + `, "messages": [{"role": "user", "content": [` +
+		image + `, ` + image + `, ` + image + `, {"type": "text", "text": "What are these?"}]}]}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	s.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "downgraded=3, dropped=0", w.Header().Get(imageAdjustmentsHeader))
+}
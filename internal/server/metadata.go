@@ -0,0 +1,67 @@
+package server
+
+import (
+	"github.com/chew-z/copilot-proxy/internal/api"
+)
+
+// Limits on request metadata, matching OpenAI's
+const (
+	maxMetadataPairs    = 16
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 512
+)
+
+// validateMetadata checks an OpenAI-style metadata object: up to 16 string values with
+// bounded key and value lengths
+func validateMetadata(v any) error {
+	if v == nil {
+		return nil
+	}
+	md, ok := v.(map[string]any)
+	if !ok {
+		return api.ErrBadRequest("metadata must be an object")
+	}
+	if len(md) > maxMetadataPairs {
+		return api.ErrBadRequest("metadata has %d keys; at most %d are allowed", len(md), maxMetadataPairs)
+	}
+	for key, value := range md {
+		if len(key) > maxMetadataKeyLen {
+			return api.ErrBadRequest("metadata key %q is longer than %d characters", key, maxMetadataKeyLen)
+		}
+		s, ok := value.(string)
+		if !ok {
+			return api.ErrBadRequest("metadata value for %q must be a string", key)
+		}
+		if len(s) > maxMetadataValueLen {
+			return api.ErrBadRequest("metadata value for %q is longer than %d characters", key, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// metadataStrings converts validated metadata to a string map
+func metadataStrings(v any) map[string]string {
+	md, _ := v.(map[string]any)
+	if len(md) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(md))
+	for k, v := range md {
+		out[k], _ = v.(string)
+	}
+	return out
+}
+
+// isFinalChunk reports whether a stream chunk finishes a choice or reports usage
+func isFinalChunk(chunk map[string]any) bool {
+	if _, ok := chunk["usage"].(map[string]any); ok {
+		return true
+	}
+	choices, _ := chunk["choices"].([]any)
+	for _, c := range choices {
+		if choice, _ := c.(map[string]any); choice["finish_reason"] != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	assert.NoError(t, validateMetadata(nil))
+	assert.NoError(t, validateMetadata(map[string]any{"run": "42"}))
+	assert.Error(t, validateMetadata("run=42"))
+	assert.Error(t, validateMetadata(map[string]any{"run": 42}))
+	assert.Error(t, validateMetadata(map[string]any{strings.Repeat("k", 65): "v"}))
+	assert.Error(t, validateMetadata(map[string]any{"k": strings.Repeat("v", 513)}))
+
+	tooMany := map[string]any{}
+	for i := range 17 {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+	assert.Error(t, validateMetadata(tooMany))
+}
+
+func TestChatCompletions_Metadata(t *testing.T) {
+	var upstream map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = nil
+		json.NewDecoder(r.Body).Decode(&upstream)
+		if upstream["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n" +
+				"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	send := func(stream bool) *httptest.ResponseRecorder {
+		body := `{"model": "GLM-4.7", "stream": ` + map[bool]string{true: "true", false: "false"}[stream] +
+			`, "metadata": {"run": "42"}, "messages": [{"role": "user", "content": "hi"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("NonStreaming", func(t *testing.T) {
+		w := send(false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, upstream, "metadata")
+
+		var resp map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, map[string]any{"run": "42"}, resp["metadata"])
+	})
+
+	t.Run("Streaming", func(t *testing.T) {
+		w := send(true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, upstream, "metadata")
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+		assert.Len(t, lines, 3)
+		assert.NotContains(t, lines[0], "metadata")
+		assert.Contains(t, lines[1], `"metadata":{"run":"42"}`)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "GLM-4.7", "metadata": {"run": 42}, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/ratelimit"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitMiddleware throttles requests per source IP, answering 429 with Retry-After when a
+// client's token bucket is empty. With a shared store, replicas instead count each IP's
+// requests in common one-minute windows of perMinute requests.
+func rateLimitMiddleware(limiter *ratelimit.Limiter, shared storage.Store, perMinute float64, registry *metrics.Registry, clk clock.Clock) gin.HandlerFunc {
+	throttled := registry.Counter("copilot_proxy_ratelimit_throttled_total",
+		"Requests rejected by the per-IP rate limiter")
+	tracked := registry.Gauge("copilot_proxy_ratelimit_tracked_ips",
+		"Source IPs currently tracked by the rate limiter")
+
+	return func(c *gin.Context) {
+		// Never throttle health checks
+		if c.Request.URL.Path == "/healthz" {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		var ok bool
+		var wait time.Duration
+		if shared != nil {
+			var st rateLimitStatus
+			ok, st, _ = allowWindow(c.Request.Context(), shared, "ratelimit:"+ip, perMinute, clk.Now())
+			wait = st.reset
+			noteRateLimit(c, st)
+		} else {
+			ok, wait = limiter.Allow(ip)
+			tracked.Set(float64(limiter.Len()))
+			remaining, full := limiter.Remaining(ip)
+			noteRateLimit(c, rateLimitStatus{limit: limiter.Burst(), remaining: remaining, reset: full})
+		}
+		if ok {
+			c.Next()
+			return
+		}
+
+		// Source IPs are only logged; as a label they would grow the metric without bound
+		throttled.Inc()
+		slog.Warn("Rate limit exceeded", "ip", ip, "path", c.Request.URL.Path)
+
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		handleError(c, api.ErrTooManyRequests("rate limit exceeded, retry in %ds", retryAfter))
+		c.Abort()
+	}
+}
+
+// allowWindow counts a request against key in the current one-minute window of store and
+// reports whether the count is within limit, with the requests left and the time until the next
+// window. Store errors allow the request, with no status.
+func allowWindow(ctx context.Context, store storage.Store, key string, limit float64, now time.Time) (bool, rateLimitStatus, error) {
+	window := now.Truncate(time.Minute)
+	n, err := store.IncrBy(ctx, fmt.Sprintf("%s:%d", key, window.Unix()), 1, time.Minute)
+	if err != nil {
+		return true, rateLimitStatus{}, err
+	}
+	st := rateLimitStatus{limit: int(limit), remaining: int(limit) - int(n), reset: window.Add(time.Minute).Sub(now)}
+	return float64(n) <= limit, st, nil
+}
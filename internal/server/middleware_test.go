@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{Enabled: true, RequestsPerMinute: 1, Burst: 2},
+		Admin:     config.AdminConfig{Token: testAdminToken},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/api/version", "10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, get("/api/version", "10.0.0.1:1001").Code)
+
+	w := get("/api/version", "10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "rate limit exceeded")
+
+	// Forwarding headers must not let a client escape its bucket
+	req := httptest.NewRequest("GET", "/api/version", nil)
+	req.RemoteAddr = "10.0.0.1:1003"
+	req.Header.Set("X-Forwarded-For", "192.168.9.9")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Other IPs and health checks are unaffected
+	assert.Equal(t, http.StatusOK, get("/api/version", "10.0.0.2:1000").Code)
+	assert.Equal(t, http.StatusOK, get("/healthz", "10.0.0.1:1004").Code)
+
+	req = adminRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "10.0.0.3:1000"
+	metrics := httptest.NewRecorder()
+	s.router.ServeHTTP(metrics, req)
+	assert.Contains(t, metrics.Body.String(), "copilot_proxy_ratelimit_throttled_total 2")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "laptop", Key: "good-key"}},
+			Lockout: config.LockoutConfig{MaxFailures: 2, Base: time.Minute, Max: time.Hour},
+		},
+		Admin: config.AdminConfig{Token: testAdminToken},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	get := func(path, remoteAddr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/api/version", "10.0.0.1:1", "good-key").Code)
+	assert.Equal(t, http.StatusOK, get("/healthz", "10.0.0.1:1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/version", "10.0.0.1:1", "").Code)
+
+	// Second failure triggers the lockout, which then also blocks the valid key
+	w := get("/api/version", "10.0.0.1:1", "bad-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/api/version", "10.0.0.1:1", "good-key").Code)
+
+	// Other sources are unaffected
+	assert.Equal(t, http.StatusOK, get("/api/version", "10.0.0.2:1", "good-key").Code)
+
+	metrics := get("/metrics", "10.0.0.2:1", testAdminToken)
+	assert.Contains(t, metrics.Body.String(), "copilot_proxy_auth_failures_total 2")
+	assert.Contains(t, metrics.Body.String(), "copilot_proxy_auth_lockouts_total 1")
+}
+
+func TestAuthMiddleware_ProviderDown(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer provider.Close()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "laptop", Key: "good-key"}},
+			OIDC:    config.OIDCConfig{JWKSURL: provider.URL, Audience: "copilot-proxy"},
+			Lockout: config.LockoutConfig{MaxFailures: 2, Base: time.Minute, Max: time.Hour},
+		},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/version", nil)
+		req.RemoteAddr = "10.0.0.1:1"
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Tokens that cannot be checked are not held against the source
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`)) + ".e30.sig"
+	for range 3 {
+		assert.Equal(t, http.StatusServiceUnavailable, get(token).Code)
+	}
+	assert.Equal(t, http.StatusOK, get("good-key").Code)
+}
+
+func TestAllowQuota_SharedStore(t *testing.T) {
+	// Two replicas sharing a store share each client's quota
+	store := storage.NewMemory()
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 15, 0, time.UTC))
+	a := newAuthenticator(config.AuthConfig{}, store)
+	b := newAuthenticator(config.AuthConfig{}, store)
+	a.clock = clk
+	b.clock = clk
+
+	p := &auth.Principal{Name: "ci", RequestsPerMinute: 2}
+	ctx := context.Background()
+
+	ok, _ := a.allowQuota(ctx, p)
+	assert.True(t, ok)
+	ok, _ = b.allowQuota(ctx, p)
+	assert.True(t, ok)
+	ok, st := a.allowQuota(ctx, p)
+	assert.False(t, ok)
+	assert.Equal(t, 45*time.Second, st.reset)
+
+	// Other clients and unlimited principals are unaffected
+	ok, _ = b.allowQuota(ctx, &auth.Principal{Name: "laptop", RequestsPerMinute: 2})
+	assert.True(t, ok)
+	ok, _ = b.allowQuota(ctx, &auth.Principal{Name: "admin"})
+	assert.True(t, ok)
+
+	// The next minute starts a fresh window
+	clk.Advance(time.Minute)
+	ok, _ = b.allowQuota(ctx, p)
+	assert.True(t, ok)
+}
+
+func TestRateLimitMiddleware_SharedStoreDown(t *testing.T) {
+	// Point the shared store at a closed port; limits degrade to this replica only
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{Enabled: true, RequestsPerMinute: 1, Burst: 5},
+		Storage:   config.StorageConfig{Backend: "redis", Redis: config.RedisConfig{Addr: addr, Timeout: time.Second}},
+		Admin:     config.AdminConfig{Token: testAdminToken},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:1000"
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/api/version").Code)
+	w := get("/api/version")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	req := adminRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "10.0.0.2:1000"
+	metrics := httptest.NewRecorder()
+	s.router.ServeHTTP(metrics, req)
+	assert.Contains(t, metrics.Body.String(), "copilot_proxy_storage_shared_up 0")
+}
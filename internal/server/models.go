@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// modelLimits returns the advertised context window and completion cap of a model, with
+// configured overrides taking precedence over the catalog
+func (s *Server) modelLimits(name string) (maxInput, maxOutput int) {
+	maxInput = models.GetModelContextLength(name)
+	maxOutput = models.GetModelMaxOutput(name)
+
+	canonical := models.GetCanonicalModelName(name)
+	for key, limits := range s.config.ModelLimits {
+		if models.GetCanonicalModelName(key) != canonical {
+			continue
+		}
+		if limits.MaxInputTokens > 0 {
+			maxInput = limits.MaxInputTokens
+		}
+		if limits.MaxOutputTokens > 0 {
+			maxOutput = limits.MaxOutputTokens
+		}
+	}
+	return maxInput, min(maxOutput, maxInput)
+}
+
+// openAIModel is an OpenAI model object extended with token limits and capabilities
+type openAIModel struct {
+	ID              string   `json:"id"`
+	Object          string   `json:"object"`
+	Created         int64    `json:"created"`
+	OwnedBy         string   `json:"owned_by"`
+	ContextLength   int      `json:"context_length"`
+	MaxInputTokens  int      `json:"max_input_tokens"`
+	MaxOutputTokens int      `json:"max_output_tokens"`
+	Capabilities    []string `json:"capabilities"`
+	Snapshot        string   `json:"snapshot,omitempty"` // Pinned upstream snapshot
+}
+
+// openAIModelFor describes a catalog model in the OpenAI format
+func (s *Server) openAIModelFor(m models.Model) openAIModel {
+	created, _ := time.Parse(time.RFC3339, m.ModifiedAt)
+	maxInput, maxOutput := s.modelLimits(m.Model)
+	return openAIModel{
+		ID:              m.Name,
+		Object:          "model",
+		Created:         created.Unix(),
+		OwnedBy:         "z-ai",
+		ContextLength:   maxInput,
+		MaxInputTokens:  maxInput,
+		MaxOutputTokens: maxOutput,
+		Capabilities:    m.Capabilities,
+		Snapshot:        s.pinnedSnapshot(m.Model),
+	}
+}
+
+// handleModels lists the catalog, or the client's view of it, in the OpenAI format
+func (s *Server) handleModels(c *gin.Context) {
+	entries := s.catalogFor(c)
+	data := make([]openAIModel, 0, len(entries))
+	for _, e := range entries {
+		m := s.openAIModelFor(e.model)
+		m.ID = e.name
+		data = append(data, m)
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// handleModel returns one model in the OpenAI format
+func (s *Server) handleModel(c *gin.Context) {
+	name := c.Param("model")
+	lookup := name
+	if v := s.catalogViewFor(c); v != nil {
+		resolved, ok := v.resolve(name)
+		if !ok {
+			handleError(c, api.ErrNotFound("model '%s' not found", name))
+			return
+		}
+		lookup = resolved
+	}
+	m, ok := models.GetModel(lookup)
+	if !ok {
+		handleError(c, api.ErrNotFound("model '%s' not found", name))
+		return
+	}
+	data := s.openAIModelFor(*m)
+	if lookup != name {
+		data.ID = name
+	}
+	c.JSON(http.StatusOK, data)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Client-facing stream formats
+const (
+	streamFormatSSE    = "sse"
+	streamFormatNDJSON = "ndjson"
+)
+
+// ndjsonContentType is sent for streams delivered as newline-delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+// streamFormatFor picks the client-facing stream format from the Accept header, or def, the
+// dialect's own format, if it names neither; the first recognized media type wins.
+// application/json is not taken as a preference: the OpenAI SDKs send it with every request,
+// streaming or not.
+func streamFormatFor(c *gin.Context, def string) string {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/event-stream":
+			return streamFormatSSE
+		case ndjsonContentType, "application/ndjson", "application/jsonl":
+			return streamFormatNDJSON
+		}
+	}
+	return def
+}
+
+// sseSplitter collects SSE text written in arbitrary pieces into events, handing each event's
+// joined data lines to a callback. Comments and event names are dropped.
+type sseSplitter struct {
+	line []byte   // Incomplete SSE line
+	data [][]byte // Data lines of the current event
+}
+
+// write consumes p, calling event for each event its terminating blank line completes
+func (s *sseSplitter) write(p []byte, event func(data []byte) error) error {
+	s.line = append(s.line, p...)
+	for {
+		i := bytes.IndexByte(s.line, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := bytes.TrimSuffix(s.line[:i], []byte("\r"))
+		s.line = s.line[i+1:]
+		if err := s.handle(line, event); err != nil {
+			return err
+		}
+	}
+}
+
+// flush completes an event left unterminated at the end of the stream
+func (s *sseSplitter) flush(event func(data []byte) error) error {
+	if len(s.line) > 0 {
+		if err := s.handle(s.line, event); err != nil {
+			return err
+		}
+		s.line = nil
+	}
+	return s.handle(nil, event)
+}
+
+// handle processes one SSE line
+func (s *sseSplitter) handle(line []byte, event func(data []byte) error) error {
+	if len(line) == 0 {
+		if len(s.data) == 0 {
+			return nil
+		}
+		data := bytes.Join(s.data, []byte("\n"))
+		s.data = s.data[:0]
+		return event(data)
+	}
+	if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+		s.data = append(s.data, bytes.TrimPrefix(value, []byte(" ")))
+	}
+	return nil
+}
+
+// ndjsonWriter re-frames an SSE stream written through it as newline-delimited JSON: each
+// event's data becomes one line. Comments, event names and the [DONE] sentinel are dropped.
+type ndjsonWriter struct {
+	gin.ResponseWriter
+	events sseSplitter
+}
+
+// newNDJSONWriter wraps a response writer whose headers have not been sent yet
+func newNDJSONWriter(w gin.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Del("Content-Length")
+	return &ndjsonWriter{ResponseWriter: w}
+}
+
+// Write implements io.Writer, forwarding each event once its terminating blank line arrives
+func (w *ndjsonWriter) Write(p []byte) (int, error) {
+	return len(p), w.events.write(p, w.emit)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *ndjsonWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// emit writes an event's data as one line
+func (w *ndjsonWriter) emit(data []byte) error {
+	if string(bytes.TrimSpace(data)) == sse.DoneData {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(append(data, '\n'))
+	return err
+}
+
+// Close forwards an event left unterminated at the end of the stream
+func (w *ndjsonWriter) Close() error {
+	return w.events.flush(w.emit)
+}
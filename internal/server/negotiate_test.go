@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamFormatFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", streamFormatSSE},
+		{"*/*", streamFormatSSE},
+		{"application/json", streamFormatSSE},
+		{"text/event-stream", streamFormatSSE},
+		{"application/x-ndjson", streamFormatNDJSON},
+		{"application/json, application/x-ndjson;q=0.9", streamFormatNDJSON},
+		{"text/event-stream, application/x-ndjson", streamFormatSSE},
+		{"application/ndjson", streamFormatNDJSON},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		c.Request.Header.Set("Accept", tt.accept)
+		assert.Equal(t, tt.expected, streamFormatFor(c, streamFormatSSE), tt.accept)
+	}
+
+	// Dialects streaming NDJSON keep it unless the client asks for SSE
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/chat", nil)
+	c.Request.Header.Set("Accept", "application/json")
+	assert.Equal(t, streamFormatNDJSON, streamFormatFor(c, streamFormatNDJSON))
+	c.Request.Header.Set("Accept", "text/event-stream")
+	assert.Equal(t, streamFormatSSE, streamFormatFor(c, streamFormatNDJSON))
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	w := newNDJSONWriter(c.Writer)
+
+	// Writes split events at arbitrary points
+	for _, part := range []string{
+		": keep-alive\n\ndata: {\"a\"",
+		":1}\n\nevent: content\r\ndata: {\"b\":2}\r\n\r",
+		"\ndata: [DONE]\n\ndata: {\"c\":3}",
+	} {
+		w.WriteString(part)
+	}
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "{\"a\":1}\n{\"b\":2}\n{\"c\":3}\n", rec.Body.String())
+	assert.Equal(t, ndjsonContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestChatCompletions_AcceptNegotiation(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	post := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/v1/chat/completions", "application/x-ndjson")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"content":"Hel"`)
+		assert.Contains(t, lines[1], `"finish_reason":"stop"`)
+	}
+	assert.NotContains(t, w.Body.String(), "data:")
+
+	w = post("/v1/chat/completions", "text/event-stream")
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+
+	// Ollama's endpoints stream their own messages as NDJSON, or as SSE events when asked
+	ollama := func(path, accept string) *httptest.ResponseRecorder {
+		body := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`
+		if path == "/api/generate" {
+			body = `{"model": "GLM-4.7", "prompt": "hi"}`
+		}
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	for _, path := range []string{"/api/chat", "/api/generate"} {
+		w = ollama(path, "")
+		assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"), path)
+		assert.NotContains(t, w.Body.String(), "data:", path)
+		assert.Contains(t, w.Body.String(), `"done":true`, path)
+
+		w = ollama(path, "text/event-stream")
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"), path)
+		events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+		if assert.Len(t, events, 3, path) {
+			assert.True(t, strings.HasPrefix(events[0], "data: {"), events[0])
+			assert.Contains(t, events[0], `"model":"GLM-4.7"`, path)
+			assert.Contains(t, events[2], `"done":true`, path)
+		}
+		assert.NotContains(t, w.Body.String(), "[DONE]", path)
+	}
+}
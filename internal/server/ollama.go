@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// ollamaWriter translates the OpenAI chat completion written through it into the response of
+// Ollama's /api/chat, or of /api/generate. An SSE stream becomes newline-delimited messages
+// ending in a done line; a completion object becomes a single done message. Other bodies, such
+// as errors, pass through.
+type ollamaWriter struct {
+	gin.ResponseWriter
+	model     string // As the client asked for it
+	sent      time.Time
+	clock     clock.Clock
+	streaming bool
+	generate  bool // Answer with generate responses, whose text is in "response"
+	// Frame stream messages as SSE events rather than lines, for clients that asked for them
+	eventStream bool
+
+	events sseSplitter
+	body   []byte // The buffered completion object of a non-streaming response
+
+	calls    map[int]*ollamaToolCall // Streamed tool calls, assembled by index
+	reason   string
+	usage    *tokenUsage
+	metadata any  // The client's metadata, echoed on the done message
+	done     bool // The done line or an error line has been written
+}
+
+// ollamaToolCall is a tool call whose arguments may still be arriving in fragments
+type ollamaToolCall struct {
+	name      string
+	arguments string
+}
+
+// newOllamaWriter wraps a response writer whose headers have not been sent yet
+func newOllamaWriter(w gin.ResponseWriter, model string, sent time.Time, clk clock.Clock, streaming bool) *ollamaWriter {
+	if streaming {
+		w.Header().Set("Content-Type", ndjsonContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Del("Content-Length")
+	return &ollamaWriter{
+		ResponseWriter: w,
+		model:          model,
+		sent:           sent,
+		clock:          clk,
+		streaming:      streaming,
+		calls:          make(map[int]*ollamaToolCall),
+	}
+}
+
+// Write implements io.Writer. Stream events are translated as they complete; a non-streaming
+// body is held until Close.
+func (w *ollamaWriter) Write(p []byte) (int, error) {
+	if !w.streaming {
+		w.body = append(w.body, p...)
+		return len(p), nil
+	}
+	return len(p), w.events.write(p, w.chunk)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *ollamaWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush implements http.Flusher; a non-streaming body is not complete, or its length known,
+// before Close
+func (w *ollamaWriter) Flush() {
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Close writes the translated completion, or ends a stream that stopped without [DONE]
+func (w *ollamaWriter) Close() error {
+	if w.streaming {
+		if err := w.events.flush(w.chunk); err != nil {
+			return err
+		}
+		return w.finish()
+	}
+
+	out := w.body
+	var resp map[string]any
+	if err := json.Unmarshal(w.body, &resp); err == nil && resp["choices"] != nil {
+		if translated, err := json.Marshal(w.completion(resp)); err == nil {
+			out = translated
+		}
+	}
+	// Headers are still unsent, so the translated length can be announced
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	_, err := w.ResponseWriter.Write(out)
+	return err
+}
+
+// completion translates a chat completion object into a done message
+func (w *ollamaWriter) completion(resp map[string]any) map[string]any {
+	message := map[string]any{"role": "assistant", "content": ""}
+	choices, _ := resp["choices"].([]any)
+	if len(choices) > 0 {
+		choice, _ := choices[0].(map[string]any)
+		msg, _ := choice["message"].(map[string]any)
+		if content, ok := msg["content"].(string); ok {
+			message["content"] = content
+		}
+		if reasoning, ok := msg["reasoning_content"].(string); ok && reasoning != "" {
+			message["thinking"] = reasoning
+		}
+		calls, _ := msg["tool_calls"].([]any)
+		for i, c := range calls {
+			call, _ := c.(map[string]any)
+			fn, _ := call["function"].(map[string]any)
+			name, _ := fn["name"].(string)
+			arguments, _ := fn["arguments"].(string)
+			w.calls[i] = &ollamaToolCall{name: name, arguments: arguments}
+		}
+		if calls := w.toolCalls(); calls != nil {
+			message["tool_calls"] = calls
+		}
+		w.reason, _ = choice["finish_reason"].(string)
+	}
+	w.usage = usageFrom(resp["usage"])
+	w.metadata = resp["metadata"]
+	return w.doneMessage(message)
+}
+
+// chunk translates one stream event
+func (w *ollamaWriter) chunk(data []byte) error {
+	if w.done {
+		return nil
+	}
+	if string(bytes.TrimSpace(data)) == sse.DoneData {
+		return w.finish()
+	}
+
+	var chunk map[string]any
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		slog.Debug("Dropping undecodable stream event", "error", err)
+		return nil
+	}
+	// Ollama ends a failed stream with an error line
+	if e, ok := chunk["error"]; ok {
+		w.done = true
+		return w.line(map[string]any{"error": errorText(e)})
+	}
+	if usage := usageFrom(chunk["usage"]); usage != nil {
+		w.usage = usage
+	}
+	if metadata, ok := chunk["metadata"]; ok {
+		w.metadata = metadata
+	}
+
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]any)
+	if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+		w.reason = reason
+	}
+	delta, _ := choice["delta"].(map[string]any)
+	calls, _ := delta["tool_calls"].([]any)
+	for i, c := range calls {
+		call, _ := c.(map[string]any)
+		index := i
+		if n, ok := call["index"].(float64); ok {
+			index = int(n)
+		}
+		tc := w.calls[index]
+		if tc == nil {
+			tc = &ollamaToolCall{}
+			w.calls[index] = tc
+		}
+		fn, _ := call["function"].(map[string]any)
+		if name, ok := fn["name"].(string); ok && name != "" {
+			tc.name = name
+		}
+		if arguments, ok := fn["arguments"].(string); ok {
+			tc.arguments += arguments
+		}
+	}
+
+	message := map[string]any{"role": "assistant", "content": ""}
+	content, _ := delta["content"].(string)
+	reasoning, _ := delta["reasoning_content"].(string)
+	if content == "" && reasoning == "" {
+		return nil
+	}
+	message["content"] = content
+	if reasoning != "" {
+		message["thinking"] = reasoning
+	}
+	return w.line(w.message(message, false))
+}
+
+// finish ends a stream: the tool calls assembled from its chunks go out whole, as Ollama sends
+// them, followed by the done line
+func (w *ollamaWriter) finish() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	if calls := w.toolCalls(); calls != nil && !w.generate {
+		message := map[string]any{"role": "assistant", "content": "", "tool_calls": calls}
+		if err := w.line(w.message(message, false)); err != nil {
+			return err
+		}
+	}
+	return w.line(w.doneMessage(map[string]any{"role": "assistant", "content": ""}))
+}
+
+// message wraps an assistant message in a response line. Generate responses carry its text
+// and reasoning at the top level instead.
+func (w *ollamaWriter) message(message map[string]any, done bool) map[string]any {
+	resp := map[string]any{
+		"model":      w.model,
+		"created_at": w.clock.Now().UTC().Format(time.RFC3339Nano),
+		"done":       done,
+	}
+	if !w.generate {
+		resp["message"] = message
+		return resp
+	}
+	resp["response"] = message["content"]
+	if thinking, ok := message["thinking"]; ok {
+		resp["thinking"] = thinking
+	}
+	return resp
+}
+
+// doneMessage wraps the final message with the reason generation stopped, timing and token counts
+func (w *ollamaWriter) doneMessage(message map[string]any) map[string]any {
+	resp := w.message(message, true)
+	resp["done_reason"] = ollamaDoneReason(w.reason)
+	resp["total_duration"] = w.clock.Since(w.sent).Nanoseconds()
+	if w.usage != nil {
+		resp["prompt_eval_count"] = w.usage.PromptTokens
+		resp["eval_count"] = w.usage.CompletionTokens
+	}
+	if w.metadata != nil {
+		resp["metadata"] = w.metadata
+	}
+	return resp
+}
+
+// toolCalls returns the assembled tool calls in Ollama's form, whose arguments are an object
+// rather than a JSON string
+func (w *ollamaWriter) toolCalls() []any {
+	if len(w.calls) == 0 {
+		return nil
+	}
+	var calls []any
+	for _, i := range slices.Sorted(maps.Keys(w.calls)) {
+		tc := w.calls[i]
+		calls = append(calls, map[string]any{"function": map[string]any{
+			"index":     i,
+			"name":      tc.name,
+			"arguments": toolInput(tc.name, tc.arguments),
+		}})
+	}
+	return calls
+}
+
+// line writes one JSON line of a stream, or one SSE event
+func (w *ollamaWriter) line(v map[string]any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if w.eventStream {
+		data = append([]byte("data: "), append(data, '\n')...)
+	}
+	if _, err := w.ResponseWriter.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// ollamaDoneReason maps an OpenAI finish_reason to Ollama's done_reason. Ollama reports tool
+// calls as an ordinary stop.
+func ollamaDoneReason(reason string) string {
+	switch reason {
+	case "", "stop", "tool_calls":
+		return "stop"
+	}
+	return reason
+}
+
+// usageFrom decodes an OpenAI usage object
+func usageFrom(v any) *tokenUsage {
+	u, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	prompt, _ := u["prompt_tokens"].(float64)
+	completion, _ := u["completion_tokens"].(float64)
+	usage := &tokenUsage{PromptTokens: int(prompt), CompletionTokens: int(completion)}
+	if details, ok := u["prompt_tokens_details"].(map[string]any); ok {
+		cached, _ := details["cached_tokens"].(float64)
+		usage.PromptTokensDetails = &promptTokensDetails{CachedTokens: int(cached)}
+	}
+	return usage
+}
+
+// errorText returns the message of an error value, which is either a string or an object
+func errorText(e any) string {
+	switch e := e.(type) {
+	case string:
+		return e
+	case map[string]any:
+		if msg, ok := e["message"].(string); ok {
+			return msg
+		}
+	}
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+// toolInput decodes tool call arguments, which Anthropic clients expect as an object
+func toolInput(name, arguments string) map[string]any {
+	input := map[string]any{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+			slog.Warn("Tool call arguments are not a JSON object", "tool", name, "error", err)
+		}
+	}
+	return input
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ollamaLines decodes an NDJSON body
+func ollamaLines(t *testing.T, body string) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &doc), line)
+		lines = append(lines, doc)
+	}
+	return lines
+}
+
+func TestOllamaWriter_Stream(t *testing.T) {
+	sent := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(sent.Add(1500 * time.Millisecond))
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Writer.Header().Set("Content-Length", "999")
+	w := newOllamaWriter(c.Writer, "glm-4.7:latest", sent, clk, true)
+
+	// Events may arrive split anywhere; tool call arguments arrive in fragments
+	stream := "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"reasoning_content\":\"Look it up\"}}]}\n\n" +
+		": keep-alive\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Checking\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"weather\",\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Paris\\\"}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":7,\"total_tokens\":27},\"metadata\":{\"run\":\"42\"}}\n\n" +
+		"data: [DONE]\n\n"
+	for len(stream) > 0 {
+		n := min(37, len(stream))
+		_, err := w.Write([]byte(stream[:n]))
+		require.NoError(t, err)
+		stream = stream[n:]
+	}
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, ndjsonContentType, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	lines := ollamaLines(t, rec.Body.String())
+	require.Len(t, lines, 4)
+	assert.Equal(t, map[string]any{
+		"model": "glm-4.7:latest", "created_at": "2026-05-01T12:00:01.5Z", "done": false,
+		"message": map[string]any{"role": "assistant", "content": "", "thinking": "Look it up"},
+	}, lines[0])
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "Checking"}, lines[1]["message"])
+	assert.Equal(t, []any{map[string]any{"function": map[string]any{
+		"index": float64(0), "name": "weather", "arguments": map[string]any{"city": "Paris"},
+	}}}, lines[2]["message"].(map[string]any)["tool_calls"])
+	assert.Equal(t, false, lines[2]["done"])
+
+	done := lines[3]
+	assert.Equal(t, true, done["done"])
+	assert.Equal(t, "stop", done["done_reason"])
+	assert.Equal(t, float64(1500*time.Millisecond), done["total_duration"])
+	assert.Equal(t, float64(20), done["prompt_eval_count"])
+	assert.Equal(t, float64(7), done["eval_count"])
+	assert.Equal(t, map[string]any{"run": "42"}, done["metadata"])
+}
+
+func TestOllamaWriter_StreamEnds(t *testing.T) {
+	write := func(stream string) []map[string]any {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		w := newOllamaWriter(c.Writer, "glm-4.7", time.Now(), clock.Real{}, true)
+		_, err := w.Write([]byte(stream))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return ollamaLines(t, rec.Body.String())
+	}
+
+	// A stream cut off without [DONE] still ends with a done line
+	lines := write("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"length\"}]}")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "Hi", lines[0]["message"].(map[string]any)["content"])
+	assert.Equal(t, "length", lines[1]["done_reason"])
+	assert.NotContains(t, lines[1], "eval_count")
+
+	// Errors end the stream the way Ollama reports them
+	lines = write("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hm\"}}]}\n\n" +
+		"data: {\"error\":{\"message\":\"reasoning took too long\",\"type\":\"server_error\"}}\n\ndata: [DONE]\n\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, map[string]any{"error": "reasoning took too long"}, lines[1])
+}
+
+func TestOllamaWriter_Completion(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Writer.Header().Set("Content-Length", "999")
+	sent := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := newOllamaWriter(c.Writer, "GLM-4.7", sent, clock.NewFake(sent.Add(time.Second)), false)
+
+	body := `{"id":"chatcmpl-1","object":"chat.completion","model":"glm-4.7","choices":[{"index":0,"message":{"role":"assistant","content":"","reasoning_content":"Needs a tool",` +
+		`"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}}]},"finish_reason":"tool_calls"}],` +
+		`"usage":{"prompt_tokens":12,"completion_tokens":4,"total_tokens":16}}`
+	// Nothing is sent until the body is complete
+	_, err := w.Write([]byte(body[:40]))
+	require.NoError(t, err)
+	w.Flush()
+	assert.False(t, c.Writer.Written())
+	_, err = w.Write([]byte(body[40:]))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]any{
+		"model": "GLM-4.7", "created_at": "2026-05-01T12:00:01Z", "done": true, "done_reason": "stop",
+		"total_duration": float64(time.Second), "prompt_eval_count": float64(12), "eval_count": float64(4),
+		"message": map[string]any{
+			"role": "assistant", "content": "", "thinking": "Needs a tool",
+			"tool_calls": []any{map[string]any{"function": map[string]any{
+				"index": float64(0), "name": "weather", "arguments": map[string]any{"city": "Oslo"},
+			}}},
+		},
+	}, resp)
+
+	// Bodies that are not completions, such as errors, pass through
+	rec = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(rec)
+	w = newOllamaWriter(c.Writer, "GLM-4.7", sent, clock.Real{}, false)
+	_, _ = w.Write([]byte(`{"error":"output does not match the format"}`))
+	require.NoError(t, w.Close())
+	assert.JSONEq(t, `{"error":"output does not match the format"}`, rec.Body.String())
+}
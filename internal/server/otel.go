@@ -0,0 +1,77 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/otel"
+	"github.com/gin-gonic/gin"
+)
+
+// otelTraceHeader names the OpenTelemetry trace of a request, to look it up in the tracing backend
+const otelTraceHeader = "X-Otel-Trace-Id"
+
+// newOTelTracer creates the span exporter from the config file and the OTEL_* environment
+// variables, or returns nil when export is off
+func newOTelTracer(cfg config.OTelConfig) *otel.Tracer {
+	opts, enabled := otel.FromEnv(otel.Options{
+		Endpoint:    cfg.Endpoint,
+		Headers:     cfg.Headers,
+		ServiceName: cfg.ServiceName,
+		SampleRate:  cfg.SampleRate,
+		Version:     proxyVersion,
+	}, cfg.Enabled, os.Getenv)
+	if !enabled {
+		return nil
+	}
+	tracer := otel.New(opts)
+	slog.Info("OpenTelemetry tracing enabled", "endpoint", opts.Endpoint, "service", opts.ServiceName, "sample_rate", opts.SampleRate)
+	return tracer
+}
+
+// otelMiddleware makes each proxied API request a server span, continuing the caller's trace
+// when it sent a traceparent, and names the trace in the response
+func otelMiddleware(tracer *otel.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !strings.HasPrefix(route, "/v1/") && !strings.HasPrefix(route, "/api/") {
+			c.Next()
+			return
+		}
+		parent, _ := otel.Extract(c.Request.Header)
+		ctx, span := tracer.StartRemote(c.Request.Context(), parent, c.Request.Method+" "+route, otel.KindServer)
+		defer span.End()
+		span.SetAttributes(
+			"http.request.method", c.Request.Method,
+			"http.route", route,
+			"url.path", c.Request.URL.Path,
+			"client.address", c.ClientIP(),
+			"user_agent.original", c.Request.UserAgent(),
+		)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(otelTraceHeader, span.Context().TraceID.String())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes("http.response.status_code", status)
+		if p := principalFrom(c); p != nil {
+			span.SetAttributes("copilot_proxy.client", p.Name)
+		}
+		if status >= 500 {
+			span.SetError(http.StatusText(status))
+		}
+	}
+}
+
+// hostOf returns the host of a base URL for span attributes
+func hostOf(baseURL string) string {
+	if u, err := url.Parse(baseURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
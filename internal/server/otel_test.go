@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTelTracing(t *testing.T) {
+	var mu sync.Mutex
+	var spans []map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]any `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\n\ndata: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: upstream.URL,
+		OTel:    config.OTelConfig{Enabled: true, Endpoint: collector.URL + "/v1/traces"},
+	}, "127.0.0.1", 0)
+	require.NotNil(t, s.otel)
+	defer s.otel.Shutdown(context.Background())
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The caller's trace continues through the proxy to the upstream
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get(otelTraceHeader))
+	assert.True(t, strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"), traceparent)
+
+	require.NoError(t, s.otel.Flush(context.Background()))
+	mu.Lock()
+	defer mu.Unlock()
+	byName := make(map[string]map[string]any)
+	for _, span := range spans {
+		byName[span["name"].(string)] = span
+	}
+	require.Len(t, byName, 4, "spans: %v", byName)
+	root := byName["POST /v1/chat/completions"]
+	require.NotNil(t, root)
+	assert.Equal(t, "00f067aa0ba902b7", root["parentSpanId"])
+	for _, name := range []string{"validate", "upstream", "stream"} {
+		require.Contains(t, byName, name)
+		assert.Equal(t, root["spanId"], byName[name]["parentSpanId"], name)
+	}
+	// The upstream saw the upstream span as its parent
+	assert.Contains(t, traceparent, byName["upstream"]["spanId"].(string))
+	data, _ := json.Marshal(byName["stream"])
+	assert.Contains(t, string(data), `{"key":"gen_ai.usage.output_tokens","value":{"intValue":"1"}}`)
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// queryOverrides are the chat completion fields a client may set in the query string, for
+// clients that let users change the endpoint URL but not the request body
+var queryOverrides = []string{"model", "think", "temperature", "top_p", "max_tokens"}
+
+// applyQueryOverrides replaces body fields with their query-string values. It runs before
+// validation, so overridden values are checked like any other.
+func applyQueryOverrides(c *gin.Context, bodyMap map[string]any) error {
+	query := c.Request.URL.Query()
+	for _, name := range queryOverrides {
+		if !query.Has(name) {
+			continue
+		}
+		value := query.Get(name)
+
+		switch name {
+		case "model":
+			bodyMap[name] = value
+		case "think":
+			// A boolean, or an effort level passed through for validation
+			if b, err := strconv.ParseBool(value); err == nil {
+				bodyMap[name] = b
+			} else {
+				bodyMap[name] = value
+			}
+		case "temperature", "top_p":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return api.ErrBadRequest("query parameter %s must be a number", name)
+			}
+			bodyMap[name] = f
+		case "max_tokens":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return api.ErrBadRequest("query parameter %s must be a positive integer", name)
+			}
+			// As JSON decoding would have it, so readers of the body see one type
+			bodyMap[name] = float64(n)
+		}
+	}
+	return nil
+}
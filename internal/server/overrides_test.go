@@ -0,0 +1,73 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatCompletions_QueryOverrides(t *testing.T) {
+	var got map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL}, "127.0.0.1", 0)
+
+	send := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions"+query,
+			strings.NewReader(`{"model": "GLM-4.7-Flash", "temperature": 1, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("?model=glm-4.7&think=false&temperature=0.2&top_p=0.9&max_tokens=100")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glm-4.7", got["model"])
+	assert.Equal(t, map[string]any{"type": "disabled"}, got["thinking"])
+	assert.Equal(t, 0.2, got["temperature"])
+	assert.Equal(t, 0.9, got["top_p"])
+	assert.Equal(t, 100.0, got["max_tokens"])
+
+	// Without overrides the body is used as sent
+	w = send("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glm-4.7-flash", got["model"])
+	assert.Equal(t, 1.0, got["temperature"])
+
+	// Overridden values are validated like body fields
+	for query, msg := range map[string]string{
+		"?model=nope":       "model 'nope' not found",
+		"?think=extreme":    "invalid think level",
+		"?temperature=warm": "temperature must be a number",
+		"?max_tokens=-1":    "max_tokens must be a positive integer",
+	} {
+		w = send(query)
+		assert.NotEqual(t, http.StatusOK, w.Code, query)
+		assert.Contains(t, w.Body.String(), msg, query)
+	}
+
+	// An overridden max_tokens counts when images are fitted into the context
+	s = NewServer(&config.Config{BaseURL: mockUpstream.URL, Images: config.ImagesConfig{Downgrade: true}}, "127.0.0.1", 0)
+	contextLength, _ := s.modelLimits("GLM-4.6V")
+	body, _ := json.Marshal(imageRequest(3, 100))
+	req := httptest.NewRequest("POST", "/v1/chat/completions?max_tokens="+strconv.Itoa(contextLength-2500), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "downgraded=3, dropped=0", w.Header().Get(imageAdjustmentsHeader))
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/plugin"
+	"github.com/gin-gonic/gin"
+)
+
+// loadPlugins loads the configured WebAssembly plugins, skipping any that fail to load
+func loadPlugins(cfgs []config.PluginConfig) []*plugin.Plugin {
+	var plugins []*plugin.Plugin
+	for _, cfg := range cfgs {
+		p, err := plugin.Load(context.Background(), cfg)
+		if err != nil {
+			slog.Error("Plugin disabled", "error", err)
+			continue
+		}
+		slog.Info("Plugin loaded", "plugin", p.Name, "on_request", p.HasRequestHook(), "on_chunk", p.HasChunkHook())
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+// runRequestPlugins passes the prepared upstream body through each plugin's request hook in
+// order. A plugin may replace the body or reject the request; a failing hook is skipped
+// unless the plugin is configured to fail closed.
+func (s *Server) runRequestPlugins(c *gin.Context, bodyMap map[string]any) error {
+	for _, p := range s.plugins {
+		if !p.HasRequestHook() {
+			continue
+		}
+
+		model, _ := bodyMap["model"].(string)
+		ev := plugin.RequestEvent{
+			Model:   model,
+			Dialect: dialectOf(c.Request.URL.Path),
+			Headers: make(map[string]string, len(c.Request.Header)),
+			Body:    bodyMap,
+		}
+		for name := range c.Request.Header {
+			if !hopByHopHeaders[name] && name != "Authorization" && name != "X-Api-Key" {
+				ev.Headers[name] = c.Request.Header.Get(name)
+			}
+		}
+		if principal := principalFrom(c); principal != nil {
+			ev.Client = principal.Name
+		}
+
+		res, err := p.OnRequest(c.Request.Context(), ev)
+		if err != nil {
+			slog.Error("Plugin request hook failed", "error", err)
+			if p.FailClosed {
+				return api.ErrInternalServer("request rejected: plugin %s failed", p.Name)
+			}
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		if res.Error != nil {
+			return hookRejection("plugin "+p.Name, res.Error.Status, res.Error.Message)
+		}
+		if res.Body != nil {
+			clear(bodyMap)
+			for k, v := range res.Body {
+				bodyMap[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+// hookRejection turns a plugin's or script's refusal into an API error
+func hookRejection(source string, status int, msg string) error {
+	if msg == "" {
+		msg = "request rejected by " + source
+	}
+	if status < 400 || status > 599 {
+		status = http.StatusBadRequest
+	}
+	return &api.StatusError{StatusCode: status, ErrorMessage: msg}
+}
+
+// chunkPluginHook returns a function passing response chunks through each plugin's chunk
+// hook, or nil when no plugin has one. It reports false when a plugin drops the chunk.
+func (s *Server) chunkPluginHook(ctx context.Context, model string) func(chunk map[string]any, stream bool) (map[string]any, bool) {
+	var hooked []*plugin.Plugin
+	for _, p := range s.plugins {
+		if p.HasChunkHook() {
+			hooked = append(hooked, p)
+		}
+	}
+	if len(hooked) == 0 {
+		return nil
+	}
+
+	return func(chunk map[string]any, stream bool) (map[string]any, bool) {
+		for _, p := range hooked {
+			res, err := p.OnChunk(ctx, plugin.ChunkEvent{Model: model, Stream: stream, Chunk: chunk})
+			if err != nil {
+				slog.Error("Plugin chunk hook failed", "error", err)
+				continue
+			}
+			if res == nil {
+				continue
+			}
+			if res.Drop {
+				return nil, false
+			}
+			if res.Chunk != nil {
+				chunk = res.Chunk
+			}
+		}
+		return chunk, true
+	}
+}
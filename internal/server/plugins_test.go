@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTestPlugin compiles the plugin package's test guest, skipping the test when the Go
+// toolchain cannot target WASI
+func buildTestPlugin(t *testing.T) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "guest.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, ".")
+	cmd.Dir = filepath.Join("..", "plugin", "testdata", "guest")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build the test plugin: %v\n%s", err, output)
+	}
+	return out
+}
+
+func TestChatCompletions_Plugins(t *testing.T) {
+	var got map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		if stream, _ := got["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a secret\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"DROP\"}}]}\n\n" +
+				"data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"my secret"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Plugins: []config.PluginConfig{{Name: "guest", Path: buildTestPlugin(t), Timeout: 5 * time.Second}},
+	}, "127.0.0.1", 0)
+	if !assert.Len(t, s.plugins, 1) {
+		return
+	}
+
+	send := func(stream bool, block bool) *httptest.ResponseRecorder {
+		body := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`
+		if stream {
+			body = `{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`
+		}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if block {
+			req.Header.Set("X-Block", "1")
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(false, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0.1, got["temperature"])
+	assert.Contains(t, w.Body.String(), `"content":"my [redacted]"`)
+
+	w = send(true, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"a [redacted]"`)
+	assert.NotContains(t, w.Body.String(), "DROP")
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+
+	got = nil
+	w = send(false, true)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "blocked by policy")
+	assert.Nil(t, got, "rejected requests must not reach upstream")
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// probeTimeout bounds each request asking a port's owner what it is
+const probeTimeout = 2 * time.Second
+
+// IsAddrInUse reports whether a listen error means another program holds the address
+func IsAddrInUse(err error) bool {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true
+	}
+	// Windows reports WSAEADDRINUSE, which is not mapped to EADDRINUSE
+	return err != nil && strings.Contains(err.Error(), "Only one usage of each socket address")
+}
+
+// DescribeListener names the program answering HTTP on host and port: another copilot-proxy,
+// Ollama (both answer /api/version, only the proxy /api/capabilities), or another program
+func DescribeListener(ctx context.Context, host string, port int) string {
+	addr := baseURL(host, port)
+	var caps struct {
+		ProxyVersion string `json:"proxy_version"`
+	}
+	if probeJSON(ctx, addr+"/api/capabilities", &caps) && caps.ProxyVersion != "" {
+		return "copilot-proxy " + caps.ProxyVersion
+	}
+	var version struct {
+		Version string `json:"version"`
+	}
+	if probeJSON(ctx, addr+"/api/version", &version) && version.Version != "" {
+		return "Ollama " + version.Version
+	}
+	return "another program"
+}
+
+// probeJSON decodes the body of a successful GET into v, reporting whether it could
+func probeJSON(ctx context.Context, url string, v any) bool {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(v) == nil
+}
+
+// ClientSettings returns the environment variables that point Ollama and OpenAI clients at a
+// proxy listening on host and port
+func ClientSettings(host string, port int) []string {
+	base := baseURL(host, port)
+	return []string{"OLLAMA_HOST=" + base, "OPENAI_BASE_URL=" + base + "/v1"}
+}
+
+// baseURL returns the URL a server listening on host and port is reached at; servers bound to
+// all interfaces are reached over loopback
+func baseURL(host string, port int) string {
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hostPort splits a test server's address
+func hostPort(t *testing.T, rawURL string) (string, int) {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return u.Hostname(), port
+}
+
+func TestPortConflict(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"version":"0.12.3"}`))
+	}))
+	defer ollama.Close()
+	host, port := hostPort(t, ollama.URL)
+
+	// The port's owner is named, and the bind failure recognized as a conflict
+	assert.Equal(t, "Ollama 0.12.3", DescribeListener(context.Background(), host, port))
+	s := NewServer(&config.Config{}, host, port)
+	err := s.Listen()
+	require.Error(t, err)
+	assert.True(t, IsAddrInUse(err))
+
+	// Another proxy is told apart from Ollama
+	proxy := httptest.NewServer(s.router)
+	defer proxy.Close()
+	host, port = hostPort(t, proxy.URL)
+	assert.Equal(t, "copilot-proxy "+proxyVersion, DescribeListener(context.Background(), host, port))
+
+	// A port nothing answers HTTP on belongs to another program
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	assert.Equal(t, "another program", DescribeListener(context.Background(), "127.0.0.1", ln.Addr().(*net.TCPAddr).Port))
+
+	// Moving to a free port binds there
+	s.SetAddr("127.0.0.1", 0)
+	require.NoError(t, s.Listen())
+	s.listener.Close()
+}
+
+func TestClientSettings(t *testing.T) {
+	assert.Equal(t, []string{"OLLAMA_HOST=http://127.0.0.1:11435", "OPENAI_BASE_URL=http://127.0.0.1:11435/v1"}, ClientSettings("0.0.0.0", 11435))
+	assert.Equal(t, []string{"OLLAMA_HOST=http://[::1]:11435", "OPENAI_BASE_URL=http://[::1]:11435/v1"}, ClientSettings("::1", 11435))
+	assert.False(t, IsAddrInUse(nil))
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+)
+
+// ruleTransform applies a post-processing rule to completion content
+type ruleTransform struct {
+	rule *postprocess.Rule
+}
+
+// Apply implements contentTransform
+func (t ruleTransform) Apply(content string) string {
+	return t.rule.Apply(content)
+}
+
+// NewStream implements contentTransform
+func (t ruleTransform) NewStream() streamTransform {
+	return &lineStream{apply: t.rule.Apply}
+}
+
+// lineStream holds streamed text back until a line is complete so rules see whole lines
+type lineStream struct {
+	apply func(string) string
+	buf   strings.Builder
+}
+
+// Push implements streamTransform
+func (ls *lineStream) Push(delta string) string {
+	ls.buf.WriteString(delta)
+	text := ls.buf.String()
+
+	idx := strings.LastIndexByte(text, '\n')
+	if idx < 0 {
+		return ""
+	}
+
+	ls.buf.Reset()
+	ls.buf.WriteString(text[idx+1:])
+	return ls.apply(text[:idx+1])
+}
+
+// Flush implements streamTransform
+func (ls *lineStream) Flush() string {
+	text := ls.buf.String()
+	ls.buf.Reset()
+	if text == "" {
+		return ""
+	}
+	return ls.apply(text)
+}
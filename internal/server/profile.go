@@ -0,0 +1,40 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// profileHeader lets a client select a configured profile explicitly
+const profileHeader = "X-Client-Profile"
+
+// defaultProfile applies to requests that match no other profile
+const defaultProfile = "default"
+
+// profileFor returns the client profile for a request. Profile names are case-insensitive
+// because the config loader lowercases map keys.
+func (s *Server) profileFor(c *gin.Context) config.ProfileConfig {
+	if len(s.config.Profiles) == 0 {
+		return config.ProfileConfig{}
+	}
+
+	candidates := []string{c.GetHeader(profileHeader)}
+	if p := principalFrom(c); p != nil {
+		candidates = append(candidates, p.Name)
+	}
+	candidates = append(candidates, defaultProfile)
+
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		for key, profile := range s.config.Profiles {
+			if strings.EqualFold(key, name) {
+				return profile
+			}
+		}
+	}
+	return config.ProfileConfig{}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"maps"
+	"slices"
+)
+
+// cacheControlMarker is the explicit prompt caching breakpoint of Anthropic models, also read
+// through OpenAI-compatible APIs such as OpenRouter
+var cacheControlMarker = map[string]any{"type": "ephemeral"}
+
+// markCachePrefix returns a copy of body whose leading system messages, the stable prefix of a
+// conversation, end with a cache_control breakpoint. Text content becomes a content part to
+// carry the marker. Bodies without a system prompt are returned unchanged.
+func markCachePrefix(body map[string]any) map[string]any {
+	messages, _ := body["messages"].([]any)
+	last := -1
+	for i, m := range messages {
+		if msg, _ := m.(map[string]any); msg["role"] != "system" {
+			break
+		}
+		last = i
+	}
+	if last < 0 {
+		return body
+	}
+
+	msg := maps.Clone(messages[last].(map[string]any))
+	switch content := msg["content"].(type) {
+	case string:
+		msg["content"] = []any{map[string]any{"type": "text", "text": content, "cache_control": cacheControlMarker}}
+	case []any:
+		if len(content) == 0 {
+			return body
+		}
+		part, ok := content[len(content)-1].(map[string]any)
+		if !ok {
+			return body
+		}
+		part = maps.Clone(part)
+		part["cache_control"] = cacheControlMarker
+		content = slices.Clone(content)
+		content[len(content)-1] = part
+		msg["content"] = content
+	default:
+		return body
+	}
+
+	marked := maps.Clone(body)
+	out := slices.Clone(messages)
+	out[last] = msg
+	marked["messages"] = out
+	return marked
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkCachePrefix(t *testing.T) {
+	marker := map[string]any{"type": "ephemeral"}
+	body := map[string]any{"messages": []any{
+		map[string]any{"role": "system", "content": "You review code."},
+		map[string]any{"role": "system", "content": []any{map[string]any{"type": "text", "text": "Style guide"}}},
+		map[string]any{"role": "user", "content": "Review this"},
+	}}
+
+	// The last system message carries the breakpoint; the original body is left alone
+	marked := markCachePrefix(body)
+	messages := marked["messages"].([]any)
+	assert.Equal(t, "You review code.", messages[0].(map[string]any)["content"])
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Style guide", "cache_control": marker}},
+		messages[1].(map[string]any)["content"])
+	assert.Equal(t, "Review this", messages[2].(map[string]any)["content"])
+	assert.NotContains(t, body["messages"].([]any)[1].(map[string]any)["content"].([]any)[0], "cache_control")
+
+	// Text content becomes a content part
+	marked = markCachePrefix(map[string]any{"messages": []any{map[string]any{"role": "system", "content": "Be brief."}}})
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Be brief.", "cache_control": marker}},
+		marked["messages"].([]any)[0].(map[string]any)["content"])
+
+	// Conversations without a system prompt have no stable prefix to mark
+	plain := map[string]any{"messages": []any{map[string]any{"role": "user", "content": "hi"}}}
+	assert.Equal(t, plain, markCachePrefix(plain))
+}
+
+func TestPromptCache(t *testing.T) {
+	var zaiBody, routerBody map[string]any
+	usage := `"usage":{"prompt_tokens":1000,"completion_tokens":5,"total_tokens":1005,"prompt_tokens_details":{"cached_tokens":800}}`
+	zai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		zaiBody = nil
+		json.Unmarshal(data, &zaiBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],` + usage + `}`))
+	}))
+	defer zai.Close()
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &routerBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c2","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer router.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:     zai.URL,
+		PromptCache: config.PromptCacheConfig{Enabled: true},
+		Profiles:    map[string]config.ProfileConfig{"default": {Environment: config.EnvironmentConfig{Enabled: true, Timezone: "UTC"}}},
+		Providers:   []config.ProviderConfig{{Name: "openrouter", BaseURL: router.URL, Models: []string{"GLM-4.6V"}, CacheControl: true}},
+		Anthropic:   config.AnthropicConfig{Models: map[string]string{"claude-sonnet-4": "glm-4.7"}},
+	}, "127.0.0.1", 0)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w
+	}
+	const conversation = `"messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Hi"},
+		{"role": "assistant", "content": "Hello"}, {"role": "user", "content": "What day is it?"}]`
+
+	// The environment message goes before the newest message, after the stable history
+	post("/v1/chat/completions", `{"model": "glm-4.7", `+conversation+`}`)
+	messages := zaiBody["messages"].([]any)
+	require.Len(t, messages, 5)
+	assert.Equal(t, "Hello", messages[2].(map[string]any)["content"])
+	assert.Contains(t, messages[3].(map[string]any)["content"], "Current date and time")
+	assert.Equal(t, "What day is it?", messages[4].(map[string]any)["content"])
+	assert.Equal(t, "Be brief.", messages[0].(map[string]any)["content"], "Z.AI caches implicitly, without markers")
+
+	// Providers with explicit caching get a breakpoint after the system prompt
+	post("/v1/chat/completions", `{"model": "glm-4.6v", `+conversation+`}`)
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Be brief.", "cache_control": map[string]any{"type": "ephemeral"}}},
+		routerBody["messages"].([]any)[0].(map[string]any)["content"])
+
+	// Cache reads are counted, and Anthropic clients see them apart from input tokens
+	w := post("/v1/messages", `{"model": "claude-sonnet-4", "max_tokens": 100, "messages": [{"role": "user", "content": "Hi"}]}`)
+	var msg struct {
+		Usage map[string]int `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &msg))
+	assert.Equal(t, map[string]int{"input_tokens": 200, "cache_read_input_tokens": 800, "output_tokens": 5}, msg.Usage)
+
+	var metricsText strings.Builder
+	s.metrics.WriteText(&metricsText)
+	assert.Contains(t, metricsText.String(), `copilot_proxy_prompt_cache_tokens_total{model="glm-4.7",result="hit"} 1600`)
+	assert.Contains(t, metricsText.String(), `copilot_proxy_prompt_cache_tokens_total{model="glm-4.7",result="miss"} 400`)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/prompts"
+	"github.com/gin-gonic/gin"
+)
+
+// promptIncludesHeader lists the fragments a request included, with their digests, so clients
+// can record which prompt versions produced an answer
+const promptIncludesHeader = "X-Prompt-Includes"
+
+// promptInfo describes a stored fragment for the admin listing
+type promptInfo struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+	Bytes  int    `json:"bytes"`
+}
+
+// loadPrompts reads the prompt fragment store; on failure includes report unknown fragments
+func loadPrompts(cfg config.PromptsConfig) *prompts.Store {
+	dir, err := cfg.DirPath()
+	if err == nil {
+		var store *prompts.Store
+		if store, err = prompts.Load(dir); err == nil {
+			if store.Len() > 0 {
+				slog.Info("Prompt fragments loaded", "dir", dir, "fragments", store.Len())
+			}
+			return store
+		}
+	}
+	slog.Error("Prompt fragments disabled", "error", err)
+	return prompts.New(nil)
+}
+
+// resolveIncludes replaces {"$include": "<ref>"} in message content, or in a content part,
+// with the referenced fragment's text. All includes of a request share the size budget.
+func (s *Server) resolveIncludes(c *gin.Context, messages []any) error {
+	resolver := s.prompts.NewResolver(s.config.Prompts.MaxBytes)
+	resolve := func(ref string) (string, error) {
+		text, err := resolver.Resolve(ref)
+		var notFound *prompts.NotFoundError
+		var cycle *prompts.CycleError
+		var budget *prompts.BudgetError
+		switch {
+		case errors.As(err, &notFound):
+			return "", api.ErrBadRequest("unknown prompt fragment '%s'", notFound.Ref)
+		case errors.As(err, &cycle):
+			return "", api.ErrBadRequest("prompt fragments include each other: %s", strings.Join(cycle.Chain, " -> "))
+		case errors.As(err, &budget):
+			return "", api.Errorf(http.StatusRequestEntityTooLarge, "included prompt fragments exceed %d bytes", budget.MaxBytes)
+		}
+		return text, err
+	}
+
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if ref, ok := prompts.IncludeRef(msg["content"]); ok {
+			text, err := resolve(ref)
+			if err != nil {
+				return err
+			}
+			msg["content"] = text
+			continue
+		}
+
+		parts, _ := msg["content"].([]any)
+		for i, p := range parts {
+			if ref, ok := prompts.IncludeRef(p); ok {
+				text, err := resolve(ref)
+				if err != nil {
+					return err
+				}
+				parts[i] = map[string]any{"type": "text", "text": text}
+			}
+		}
+	}
+
+	if included := resolver.Included(); len(included) > 0 {
+		refs := make([]string, len(included))
+		for i, f := range included {
+			refs[i] = f.Name + "@" + f.ShortDigest()
+		}
+		c.Header(promptIncludesHeader, strings.Join(refs, ", "))
+		slog.Debug("Resolved prompt includes", "fragments", refs)
+	}
+	return nil
+}
+
+// handleListPrompts lists the stored prompt fragments with their content addresses
+func (s *Server) handleListPrompts(c *gin.Context) {
+	list := s.prompts.List()
+	infos := make([]promptInfo, len(list))
+	for i, f := range list {
+		infos[i] = promptInfo{Name: f.Name, Digest: f.Digest, Bytes: len(f.Text)}
+	}
+	c.JSON(http.StatusOK, gin.H{"prompts": infos})
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptIncludes(t *testing.T) {
+	var upstreamBody map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = nil
+		_ = json.Unmarshal(data, &upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	dir := t.TempDir()
+	fragments := map[string]string{
+		"base.md":              "Be brief.",
+		"style/go-reviewer.md": "You review Go code.\n{\"$include\": \"base\"}\n",
+		"loop/a.md":            `{"$include": "loop/b"}`,
+		"loop/b.md":            `{"$include": "loop/a"}`,
+		"big.txt":              strings.Repeat("x", 200),
+	}
+	for name, text := range fragments {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	}
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Prompts: config.PromptsConfig{Dir: dir, MaxBytes: 100},
+		Admin:   config.AdminConfig{Token: testAdminToken},
+	}, "127.0.0.1", 0)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Includes in message content and in content parts are expanded before forwarding
+	w := post(`{"model": "GLM-4.7", "messages": [
+		{"role": "system", "content": {"$include": "style/go-reviewer"}},
+		{"role": "user", "content": [{"$include": "base"}, {"type": "text", "text": "Review this."}]}
+	]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	messages := upstreamBody["messages"].([]any)
+	assert.Equal(t, "You review Go code.\nBe brief.\n", messages[0].(map[string]any)["content"])
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Be brief."},
+		map[string]any{"type": "text", "text": "Review this."},
+	}, messages[1].(map[string]any)["content"])
+
+	includes := w.Header().Get(promptIncludesHeader)
+	assert.Regexp(t, `^style/go-reviewer@sha256:[0-9a-f]{12}, base@sha256:[0-9a-f]{12}$`, includes)
+
+	// A fragment can be pinned by the digest of its content
+	var listed struct {
+		Prompts []promptInfo `json:"prompts"`
+	}
+	lw := httptest.NewRecorder()
+	s.router.ServeHTTP(lw, adminRequest("GET", "/admin/prompts", nil))
+	require.NoError(t, json.Unmarshal(lw.Body.Bytes(), &listed))
+	require.Len(t, listed.Prompts, 5)
+	assert.Equal(t, "base", listed.Prompts[0].Name)
+	assert.Equal(t, 9, listed.Prompts[0].Bytes)
+
+	w = post(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": {"$include": "` + listed.Prompts[0].Digest + `"}}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "Be brief.", upstreamBody["messages"].([]any)[0].(map[string]any)["content"])
+
+	// Broken includes are rejected before anything is sent upstream
+	upstreamBody = nil
+	for _, tc := range []struct {
+		ref    string
+		status int
+		msg    string
+	}{
+		{"missing", http.StatusBadRequest, "unknown prompt fragment 'missing'"},
+		{"loop/a", http.StatusBadRequest, "prompt fragments include each other: loop/a -> loop/b -> loop/a"},
+		{"big", http.StatusRequestEntityTooLarge, "included prompt fragments exceed 100 bytes"},
+	} {
+		w = post(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": {"$include": "` + tc.ref + `"}}]}`)
+		assert.Equal(t, tc.status, w.Code, tc.ref)
+		var body struct {
+			Error string `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, tc.msg, body.Error)
+	}
+	assert.Nil(t, upstreamBody)
+}
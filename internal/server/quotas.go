@@ -0,0 +1,254 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// quotaPeriod is a UTC day or calendar month over which a client's usage is counted
+type quotaPeriod struct {
+	name string // "daily" or "monthly"
+	key  string // Distinguishes one day or month from the next in counter keys
+	end  time.Time
+}
+
+// quotaPeriods returns the day and the month containing now
+func quotaPeriods(now time.Time) [2]quotaPeriod {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return [2]quotaPeriod{
+		{name: "daily", key: day.Format("20060102"), end: day.AddDate(0, 0, 1)},
+		{name: "monthly", key: month.Format("200601"), end: month.AddDate(0, 1, 0)},
+	}
+}
+
+// periodUsage is a client's usage within one period
+type periodUsage struct {
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	Requests         int64     `json:"requests"`
+	ResetsAt         time.Time `json:"resets_at"`
+}
+
+// quotaBreach describes the budget a request would exceed
+type quotaBreach struct {
+	quota string // e.g. "daily_tokens"
+	limit int64
+	reset time.Duration
+}
+
+// clientQuotas counts each authenticated client's tokens and chat requests per UTC day and
+// calendar month in the shared store, and refuses chat requests once a configured budget is
+// spent. Token budgets are checked before a request is sent, so the request that crosses one
+// completes and the next is refused.
+type clientQuotas struct {
+	cfg      config.QuotasConfig
+	store    storage.Store
+	clock    clock.Clock
+	exceeded *metrics.Counter
+}
+
+// newClientQuotas creates the accounting for authenticated clients, or returns nil when auth is
+// disabled and clients cannot be told apart
+func newClientQuotas(cfg config.AuthConfig, store storage.Store, registry *metrics.Registry) *clientQuotas {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &clientQuotas{
+		cfg:   cfg.Quotas,
+		store: store,
+		clock: clock.Real{},
+		exceeded: registry.Counter("copilot_proxy_usage_quota_exceeded_total",
+			"Chat requests rejected by a client's daily or monthly quota", "client", "quota"),
+	}
+}
+
+// counterKey names one of a client's usage counters
+func counterKey(client string, p quotaPeriod, field string) string {
+	return fmt.Sprintf("usage:%s:%s:%s", client, p.key, field)
+}
+
+// add adds to one of a client's counters in both periods. Counters outlive their period by a
+// day, so they can still be reported just after it ends.
+func (q *clientQuotas) add(ctx context.Context, client, field string, delta int64, now time.Time) error {
+	for _, p := range quotaPeriods(now) {
+		if _, err := q.store.IncrBy(ctx, counterKey(client, p, field), delta, p.end.Sub(now)+24*time.Hour); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usage returns a client's usage in the day and the month containing now
+func (q *clientQuotas) usage(ctx context.Context, client string, now time.Time) (map[string]periodUsage, error) {
+	result := make(map[string]periodUsage, 2)
+	for _, p := range quotaPeriods(now) {
+		u := periodUsage{ResetsAt: p.end}
+		for field, dst := range map[string]*int64{"prompt": &u.PromptTokens, "completion": &u.CompletionTokens, "requests": &u.Requests} {
+			n, err := q.store.IncrBy(ctx, counterKey(client, p, field), 0, p.end.Sub(now)+24*time.Hour)
+			if err != nil {
+				return nil, err
+			}
+			*dst = n
+		}
+		result[p.name] = u
+	}
+	return result, nil
+}
+
+// admit counts a chat request against the client's budgets, or returns the budget it would
+// exceed. A request that is refused is not counted.
+func (q *clientQuotas) admit(ctx context.Context, client string) (*quotaBreach, error) {
+	now := q.clock.Now()
+	limits := q.cfg.For(client)
+	if limits != (config.QuotaLimits{}) {
+		used, err := q.usage(ctx, client, now)
+		if err != nil {
+			return nil, err
+		}
+		periods := quotaPeriods(now)
+		checks := []struct {
+			quota string
+			limit int64
+			used  int64
+			end   time.Time
+		}{
+			{"daily_requests", limits.DailyRequests, used["daily"].Requests, periods[0].end},
+			{"daily_tokens", limits.DailyTokens, used["daily"].PromptTokens + used["daily"].CompletionTokens, periods[0].end},
+			{"monthly_requests", limits.MonthlyRequests, used["monthly"].Requests, periods[1].end},
+			{"monthly_tokens", limits.MonthlyTokens, used["monthly"].PromptTokens + used["monthly"].CompletionTokens, periods[1].end},
+		}
+		for _, c := range checks {
+			if c.limit > 0 && c.used >= c.limit {
+				return &quotaBreach{quota: c.quota, limit: c.limit, reset: c.end.Sub(now)}, nil
+			}
+		}
+	}
+	return nil, q.add(ctx, client, "requests", 1, now)
+}
+
+// record adds the tokens of a completed request to the client's usage
+func (q *clientQuotas) record(ctx context.Context, client string, usage *tokenUsage) {
+	if usage == nil {
+		return
+	}
+	now := q.clock.Now()
+	for field, n := range map[string]int{"prompt": usage.PromptTokens, "completion": usage.CompletionTokens} {
+		if n <= 0 {
+			continue
+		}
+		if err := q.add(ctx, client, field, int64(n), now); err != nil {
+			slog.Warn("Client usage not recorded", "client", client, "error", err)
+			return
+		}
+	}
+}
+
+// allowUsage applies the authenticated client's quotas to a chat request and answers 429 with
+// Retry-After when one is spent. Without auth every request is allowed. If the store is
+// unreachable the request is allowed.
+func (s *Server) allowUsage(c *gin.Context) bool {
+	breach, err := s.admitUsage(c.Request.Context(), principalFrom(c))
+	if err == nil {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(breach.reset.Seconds()))))
+	handleError(c, err)
+	return false
+}
+
+// admitUsage counts an upstream request of p against its quotas, returning the budget that is
+// spent and the 429 error to answer with, if any. Requests without a principal, or while the
+// store is unreachable, are allowed.
+func (s *Server) admitUsage(ctx context.Context, p *auth.Principal) (*quotaBreach, error) {
+	if s.quotas == nil || p == nil {
+		return nil, nil
+	}
+	breach, err := s.quotas.admit(ctx, p.Name)
+	if err != nil {
+		slog.Warn("Usage quota check skipped", "client", p.Name, "error", err)
+		return nil, nil
+	}
+	if breach == nil {
+		return nil, nil
+	}
+
+	s.quotas.exceeded.Inc(p.Name, breach.quota)
+	slog.Warn("Usage quota exceeded", "client", p.Name, "quota", breach.quota, "limit", breach.limit)
+	return breach, api.ErrTooManyRequests("%s quota of %d exceeded for %s, resets in %s",
+		breach.quota, breach.limit, p.Name, breach.reset.Round(time.Minute))
+}
+
+// recordUsage adds a completed chat request's tokens to the authenticated client's usage, even
+// when the client hung up at the end
+func (s *Server) recordUsage(c *gin.Context, usage *tokenUsage) {
+	s.chargeUsage(c.Request.Context(), principalFrom(c), usage)
+}
+
+// chargeUsage adds the tokens of an upstream request made for p to its usage, even when the
+// request's context has ended
+func (s *Server) chargeUsage(ctx context.Context, p *auth.Principal, usage *tokenUsage) {
+	if s.quotas != nil && p != nil {
+		s.quotas.record(context.WithoutCancel(ctx), p.Name, usage)
+	}
+}
+
+// clientQuotaInfo reports one client's usage and limits for /admin/quotas
+type clientQuotaInfo struct {
+	Client string                 `json:"client"`
+	Limits config.QuotaLimits     `json:"limits"`
+	Usage  map[string]periodUsage `json:"usage"`
+}
+
+// handleListQuotas reports the usage and limits of the configured clients, or of the one named
+// by ?client=, which also covers OIDC clients
+func (s *Server) handleListQuotas(c *gin.Context) {
+	if s.quotas == nil {
+		handleError(c, api.ErrNotFound("usage quotas need client authentication"))
+		return
+	}
+
+	var clients []string
+	if name := c.Query("client"); name != "" {
+		clients = []string{name}
+	} else {
+		for _, k := range s.config.Auth.Keys {
+			clients = append(clients, k.Name)
+		}
+		for name := range s.config.Auth.Quotas.Clients {
+			if !slices.ContainsFunc(clients, func(c string) bool { return strings.EqualFold(c, name) }) {
+				clients = append(clients, name)
+			}
+		}
+	}
+
+	now := s.quotas.clock.Now()
+	infos := make([]clientQuotaInfo, 0, len(clients))
+	for _, name := range clients {
+		used, err := s.quotas.usage(c.Request.Context(), name, now)
+		if err != nil {
+			handleError(c, api.Errorf(http.StatusServiceUnavailable, "usage store unavailable: %v", err))
+			return
+		}
+		infos = append(infos, clientQuotaInfo{Client: name, Limits: s.quotas.cfg.For(name), Usage: used})
+	}
+	slices.SortFunc(infos, func(x, y clientQuotaInfo) int { return cmp.Compare(x.Client, y.Client) })
+	c.JSON(http.StatusOK, gin.H{"clients": infos})
+}
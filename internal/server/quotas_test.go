@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientQuotas(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 5, 31, 23, 0, 0, 0, time.UTC))
+	q := newClientQuotas(config.AuthConfig{
+		Keys: []config.ClientKey{{Name: "ci", Key: "k"}},
+		Quotas: config.QuotasConfig{
+			Default: config.QuotaLimits{DailyTokens: 100},
+			Clients: map[string]config.QuotaLimits{"laptop": {MonthlyRequests: 2}},
+		},
+	}, storage.NewMemory(), metrics.NewRegistry())
+	q.clock = clk
+	ctx := context.Background()
+
+	// The request that crosses a token budget completes; the next is refused until midnight
+	breach, err := q.admit(ctx, "ci")
+	require.NoError(t, err)
+	assert.Nil(t, breach)
+	q.record(ctx, "ci", &tokenUsage{PromptTokens: 80, CompletionTokens: 30})
+	breach, err = q.admit(ctx, "ci")
+	require.NoError(t, err)
+	require.NotNil(t, breach)
+	assert.Equal(t, "daily_tokens", breach.quota)
+	assert.Equal(t, time.Hour, breach.reset)
+
+	used, err := q.usage(ctx, "ci", clk.Now())
+	require.NoError(t, err)
+	assert.Equal(t, periodUsage{PromptTokens: 80, CompletionTokens: 30, Requests: 1,
+		ResetsAt: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)}, used["daily"])
+
+	// Client limits replace the default, matched case-insensitively
+	for range 2 {
+		breach, err = q.admit(ctx, "Laptop")
+		require.NoError(t, err)
+		assert.Nil(t, breach)
+	}
+	breach, err = q.admit(ctx, "Laptop")
+	require.NoError(t, err)
+	require.NotNil(t, breach)
+	assert.Equal(t, "monthly_requests", breach.quota)
+
+	// A new day and month start fresh budgets
+	clk.Advance(time.Hour)
+	breach, err = q.admit(ctx, "ci")
+	require.NoError(t, err)
+	assert.Nil(t, breach)
+	breach, err = q.admit(ctx, "Laptop")
+	require.NoError(t, err)
+	assert.Nil(t, breach)
+}
+
+func TestClientQuotas_Disabled(t *testing.T) {
+	assert.Nil(t, newClientQuotas(config.AuthConfig{}, storage.NewMemory(), metrics.NewRegistry()))
+}
+
+func TestUsageQuota_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":40,\"completion_tokens\":20,\"total_tokens\":60}}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: upstream.URL,
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "ci", Key: "ci-key"}, {Name: "laptop", Key: "laptop-key"}},
+			Lockout: config.LockoutConfig{MaxFailures: 5, Base: time.Second, Max: time.Minute},
+			Quotas:  config.QuotasConfig{Clients: map[string]config.QuotaLimits{"ci": {DailyTokens: 50}}},
+		},
+		Admin: config.AdminConfig{Token: testAdminToken},
+	}, "127.0.0.1", 0)
+	chat := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, chat("ci-key").Code)
+	w := chat("ci-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "daily_tokens quota of 50 exceeded for ci")
+
+	// Clients without limits are tracked but never refused
+	assert.Equal(t, http.StatusOK, chat("laptop-key").Code)
+	assert.Equal(t, http.StatusOK, chat("laptop-key").Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, adminRequest("GET", "/admin/quotas", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got struct {
+		Clients []clientQuotaInfo `json:"clients"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Len(t, got.Clients, 2)
+	assert.Equal(t, "ci", got.Clients[0].Client)
+	assert.Equal(t, int64(50), got.Clients[0].Limits.DailyTokens)
+	assert.Equal(t, int64(1), got.Clients[0].Usage["daily"].Requests)
+	assert.Equal(t, int64(40), got.Clients[0].Usage["daily"].PromptTokens)
+	assert.Equal(t, "laptop", got.Clients[1].Client)
+	assert.Equal(t, int64(2), got.Clients[1].Usage["monthly"].Requests)
+	assert.Equal(t, int64(40), got.Clients[1].Usage["monthly"].CompletionTokens)
+}
+
+func TestUsageQuota_OtherEndpoints(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			w.Write([]byte(`{"object":"list","model":"embedding-3","data":[{"object":"embedding","index":0,"embedding":[0.1]}],"usage":{"prompt_tokens":30,"total_tokens":30}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":40,"completion_tokens":20,"total_tokens":60}}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:    upstream.URL,
+		Embeddings: config.EmbeddingsConfig{Models: []string{"embedding-3"}},
+		Auth: config.AuthConfig{
+			Keys:    []config.ClientKey{{Name: "ci", Key: "ci-key"}, {Name: "laptop", Key: "laptop-key"}},
+			Lockout: config.LockoutConfig{MaxFailures: 5, Base: time.Second, Max: time.Minute},
+			Quotas:  config.QuotasConfig{Default: config.QuotaLimits{DailyTokens: 50}},
+		},
+	}, "127.0.0.1", 0)
+	post := func(key, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	const chat = `{"model": "glm-4.7", "messages": [{"role": "user", "content": "hi"}]}`
+	const embed = `{"model": "embedding-3", "input": "hi"}`
+
+	// Completions made for endpoints other than chat are charged and refused like chat requests
+	assert.Equal(t, http.StatusOK, post("ci-key", "/v1/code-blocks", chat).Code)
+	w := post("ci-key", "/v1/code-blocks", chat)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "daily_tokens quota of 50 exceeded for ci")
+	w = post("ci-key", "/v1/embeddings", embed)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Embedding tokens count too
+	assert.Equal(t, http.StatusOK, post("laptop-key", "/v1/embeddings", embed).Code)
+	assert.Equal(t, http.StatusOK, post("laptop-key", "/v1/embeddings", embed).Code)
+	assert.Equal(t, http.StatusTooManyRequests, post("laptop-key", "/v1/code-blocks", chat).Code)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit headers telling clients how fast they may go, so they pace themselves instead of
+// waiting for a 429
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// rateLimitKey stores the tightest local limit of a request in the gin context
+const rateLimitKey = "rateLimit"
+
+// rateLimitStatus is where a client stands against one limit
+type rateLimitStatus struct {
+	limit     int           // Requests allowed per window or burst; 0 when there is no limit
+	remaining int           // Requests left
+	reset     time.Duration // Until remaining is back at limit
+}
+
+// tighter reports whether st leaves less room than other: fewer requests left, or as few for longer
+func (st rateLimitStatus) tighter(other rateLimitStatus) bool {
+	if other.limit == 0 {
+		return true
+	}
+	if st.remaining != other.remaining {
+		return st.remaining < other.remaining
+	}
+	return st.reset > other.reset
+}
+
+// noteRateLimit records a local limit's status for a request, keeping the tightest, and sets the
+// headers at once so that rejections carry them too
+func noteRateLimit(c *gin.Context, st rateLimitStatus) {
+	if st.limit <= 0 {
+		return
+	}
+	if v, ok := c.Get(rateLimitKey); ok {
+		if prev := v.(rateLimitStatus); !st.tighter(prev) {
+			st = prev
+		}
+	}
+	c.Set(rateLimitKey, st)
+	writeRateLimitHeaders(c.Writer.Header(), st)
+}
+
+// writeRateLimitHeaders sets the rate limit headers from a status; reset is in whole seconds
+func writeRateLimitHeaders(h http.Header, st rateLimitStatus) {
+	h.Set(rateLimitLimitHeader, strconv.Itoa(st.limit))
+	h.Set(rateLimitRemainingHeader, strconv.Itoa(max(st.remaining, 0)))
+	h.Set(rateLimitResetHeader, strconv.Itoa(int(math.Ceil(st.reset.Seconds()))))
+}
+
+// upstreamLimits remembers the rate limits upstreams report, per upstream, until they reset
+type upstreamLimits struct {
+	clock clock.Clock
+
+	mu     sync.Mutex
+	limits map[string]upstreamLimit // By upstream name; "" for the default upstream
+}
+
+// upstreamLimit is the last rate limit an upstream reported
+type upstreamLimit struct {
+	limit, remaining int
+	resetAt          time.Time
+}
+
+// newUpstreamLimits creates an empty tracker
+func newUpstreamLimits(clk clock.Clock) *upstreamLimits {
+	return &upstreamLimits{clock: clk, limits: make(map[string]upstreamLimit)}
+}
+
+// observe records the rate limit headers of an upstream response, in the X-RateLimit-* form or
+// OpenAI's per-request form (x-ratelimit-limit-requests). Responses without them are ignored.
+func (u *upstreamLimits) observe(name string, h http.Header) {
+	limit, err := strconv.Atoi(firstHeader(h, rateLimitLimitHeader, "X-Ratelimit-Limit-Requests"))
+	if err != nil || limit <= 0 {
+		return
+	}
+	remaining, err := strconv.Atoi(firstHeader(h, rateLimitRemainingHeader, "X-Ratelimit-Remaining-Requests"))
+	if err != nil {
+		return
+	}
+	now := u.clock.Now()
+	reset, ok := parseRateLimitReset(firstHeader(h, rateLimitResetHeader, "X-Ratelimit-Reset-Requests"), now)
+	if !ok {
+		// Without a reset time, assume the usual one-minute window
+		reset = time.Minute
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.limits[name] = upstreamLimit{limit: limit, remaining: remaining, resetAt: now.Add(reset)}
+}
+
+// status returns an upstream's last reported limit, unless it has reset since
+func (u *upstreamLimits) status(name string) (rateLimitStatus, bool) {
+	u.mu.Lock()
+	l, ok := u.limits[name]
+	u.mu.Unlock()
+
+	now := u.clock.Now()
+	if !ok || !now.Before(l.resetAt) {
+		return rateLimitStatus{}, false
+	}
+	return rateLimitStatus{limit: l.limit, remaining: l.remaining, reset: l.resetAt.Sub(now)}, true
+}
+
+// firstHeader returns the first of the named headers that is set
+func firstHeader(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// parseRateLimitReset reads a reset given in seconds, as a Unix time, or as a duration such as
+// "6m0s" or "20ms"
+func parseRateLimitReset(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil && n >= 0 {
+		// Values past a year are timestamps, not delays
+		if n > 365*24*60*60 {
+			return max(time.Unix(int64(n), 0).Sub(now), 0), true
+		}
+		return time.Duration(n * float64(time.Second)), true
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// applyUpstreamRateLimit sets the rate limit headers of a proxied response to the tighter of the
+// request's local limits and what the upstream that served it last reported
+func (s *Server) applyUpstreamRateLimit(c *gin.Context, name string, resp *http.Response) {
+	s.rateLimits.observe(name, resp.Header)
+
+	st, _ := c.Get(rateLimitKey)
+	local, _ := st.(rateLimitStatus)
+	h := c.Writer.Header()
+	if upstream, ok := s.rateLimits.status(name); ok && upstream.tighter(local) {
+		writeRateLimitHeaders(h, upstream)
+	} else if local.limit > 0 {
+		writeRateLimitHeaders(h, local)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	upstreamHeaders := http.Header{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range upstreamHeaders {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL:   upstream.URL,
+		RateLimit: config.RateLimitConfig{Enabled: true, RequestsPerMinute: 60, Burst: 10},
+	}, "127.0.0.1", 0)
+	send := func(req *http.Request) http.Header {
+		req.RemoteAddr = "10.0.0.1:1000"
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Header()
+	}
+	chat := func() http.Header {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "messages": [{"role": "user", "content": "2+2?"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		return send(req)
+	}
+	limits := func(h http.Header) []string {
+		return []string{h.Get(rateLimitLimitHeader), h.Get(rateLimitRemainingHeader), h.Get(rateLimitResetHeader)}
+	}
+
+	// Every response reports the local bucket
+	assert.Equal(t, []string{"10", "9", "1"}, limits(send(httptest.NewRequest("GET", "/api/version", nil))))
+
+	// An upstream with less room left replaces it, and is remembered until it resets
+	upstreamHeaders.Set("X-RateLimit-Limit", "100")
+	upstreamHeaders.Set("X-RateLimit-Remaining", "3")
+	upstreamHeaders.Set("X-RateLimit-Reset", "30")
+	assert.Equal(t, []string{"100", "3", "30"}, limits(chat()))
+	upstreamHeaders = http.Header{}
+	assert.Equal(t, "3", chat().Get(rateLimitRemainingHeader))
+
+	// OpenAI's header names are read too; the local bucket is tighter now
+	upstreamHeaders.Set("X-Ratelimit-Limit-Requests", "500")
+	upstreamHeaders.Set("X-Ratelimit-Remaining-Requests", "499")
+	upstreamHeaders.Set("X-Ratelimit-Reset-Requests", "120ms")
+	assert.Equal(t, []string{"10", "6", "4"}, limits(chat()))
+
+	// Rejections carry the headers as well
+	for range 6 {
+		send(httptest.NewRequest("GET", "/api/version", nil))
+	}
+	req := httptest.NewRequest("GET", "/api/version", nil)
+	req.RemoteAddr = "10.0.0.1:1000"
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get(rateLimitRemainingHeader))
+}
+
+func TestUpstreamLimits(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	u := newUpstreamLimits(clk)
+
+	// Reports without a usable limit are ignored
+	u.observe("", http.Header{"X-Ratelimit-Remaining": {"5"}})
+	_, ok := u.status("")
+	assert.False(t, ok)
+
+	// Resets may be Unix times; reports expire when they reset
+	reset := clk.Now().Add(40 * time.Second).Unix()
+	u.observe("openrouter", http.Header{"X-Ratelimit-Limit": {"20"}, "X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(reset, 10)}})
+	st, ok := u.status("openrouter")
+	require.True(t, ok)
+	assert.Equal(t, rateLimitStatus{limit: 20, remaining: 0, reset: 40 * time.Second}, st)
+	_, ok = u.status("")
+	assert.False(t, ok)
+	clk.Advance(40 * time.Second)
+	_, ok = u.status("openrouter")
+	assert.False(t, ok)
+
+	// Without a reset, a one-minute window is assumed
+	u.observe("", http.Header{"X-Ratelimit-Limit": {"20"}, "X-Ratelimit-Remaining": {"7"}})
+	st, _ = u.status("")
+	assert.Equal(t, time.Minute, st.reset)
+}
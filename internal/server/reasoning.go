@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// reasoningHeader and reasoningQuery choose how reasoning reaches an OpenAI client, per request
+const (
+	reasoningHeader = "X-Reasoning"
+	reasoningQuery  = "reasoning"
+)
+
+// Reasoning modes decide what OpenAI clients get of the reasoning_content GLM sends
+const (
+	reasoningPassthrough = "passthrough" // reasoning_content as upstream sends it
+	reasoningStrip       = "strip"       // Reasoning dropped
+	reasoningMerge       = "merge"       // Reasoning moved into content, inside <think> tags
+)
+
+// Tags wrapping merged reasoning; the blank line keeps the answer apart in Markdown renderers
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>\n\n"
+)
+
+// ValidateReasoning checks a profile's reasoning mode
+func ValidateReasoning(mode string) error {
+	if mode != "" && !validReasoningMode(mode) {
+		return fmt.Errorf("invalid mode '%s' (use passthrough, strip or merge)", mode)
+	}
+	return nil
+}
+
+// validReasoningMode reports whether mode is a reasoning mode
+func validReasoningMode(mode string) bool {
+	switch mode {
+	case reasoningPassthrough, reasoningStrip, reasoningMerge:
+		return true
+	}
+	return false
+}
+
+// requestedReasoningMode returns the mode a request asks for in its X-Reasoning header, else
+// its reasoning query parameter, or "" if it asks for none
+func requestedReasoningMode(c *gin.Context) string {
+	value := c.GetHeader(reasoningHeader)
+	if value == "" {
+		value = c.Query(reasoningQuery)
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// validateReasoningMode rejects requested reasoning modes that do not exist
+func validateReasoningMode(c *gin.Context) error {
+	if mode := requestedReasoningMode(c); mode != "" && !validReasoningMode(mode) {
+		return api.ErrBadRequest("invalid reasoning mode '%s' (use passthrough, strip or merge)", mode)
+	}
+	return nil
+}
+
+// reasoningMode returns the reasoning mode of a response: the request's own choice, then its
+// client profile's. Only the OpenAI chat route is rewritten; the Ollama and Anthropic dialects
+// carry reasoning in fields of their own.
+func (s *Server) reasoningMode(c *gin.Context) string {
+	if c.FullPath() != "/v1/chat/completions" {
+		return reasoningPassthrough
+	}
+	if mode := requestedReasoningMode(c); mode != "" {
+		return mode
+	}
+	if mode := s.profileFor(c).Reasoning; mode != "" {
+		return mode
+	}
+	return reasoningPassthrough
+}
+
+// rewriteReasoning applies a strip or merge mode to a streamed delta. open tracks whether the
+// choice has an unclosed <think> block, which is closed by the first answer text or tool call,
+// or when the choice finishes.
+func rewriteReasoning(mode string, delta map[string]any, open *bool, finished bool) {
+	reasoning, _ := delta["reasoning_content"].(string)
+	delete(delta, "reasoning_content")
+	if mode != reasoningMerge {
+		return
+	}
+
+	var b strings.Builder
+	if reasoning != "" {
+		if !*open {
+			b.WriteString(thinkOpen)
+			*open = true
+		}
+		b.WriteString(reasoning)
+	}
+	content, hasContent := delta["content"].(string)
+	_, hasTools := delta["tool_calls"]
+	if *open && (content != "" || hasTools || finished) {
+		b.WriteString(thinkClose)
+		*open = false
+	}
+	if b.Len() > 0 || hasContent {
+		delta["content"] = b.String() + content
+	}
+}
+
+// rewriteReasoningMessage applies a strip or merge mode to a complete message
+func rewriteReasoningMessage(mode string, msg map[string]any) {
+	reasoning, _ := msg["reasoning_content"].(string)
+	delete(msg, "reasoning_content")
+	if mode != reasoningMerge || reasoning == "" {
+		return
+	}
+	content, _ := msg["content"].(string)
+	msg["content"] = thinkOpen + reasoning + thinkClose + content
+}
+
+// emptyChunk reports whether a chunk carries nothing a client needs, as chunks that only
+// held reasoning do once it is stripped
+func emptyChunk(chunk map[string]any) bool {
+	if chunk["usage"] != nil {
+		return false
+	}
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		return false
+	}
+	for _, ch := range choices {
+		choice, _ := ch.(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		if choice["finish_reason"] != nil || len(delta) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasoningMode(t *testing.T) {
+	chunk := func(delta, finish string) string {
+		return `data: {"id":"c1","choices":[{"index":0,"delta":` + delta + `,"finish_reason":` + finish + `}]}` + "\n\n"
+	}
+	stream := chunk(`{"role":"assistant","reasoning_content":"Add "}`, "null") +
+		chunk(`{"reasoning_content":"them."}`, "null") +
+		chunk(`{"content":"4"}`, "null") +
+		chunk(`{}`, `"stop"`) + "data: [DONE]\n\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(data), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(stream))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","reasoning_content":"Add them.","content":"4"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Profiles: map[string]config.ProfileConfig{
+		"default": {Reasoning: reasoningStrip},
+	}}, "127.0.0.1", 0)
+	chat := func(path, header string, stream bool) *httptest.ResponseRecorder {
+		body := `{"model": "glm-4.7", "messages": [{"role": "user", "content": "2+2?"}]}`
+		if stream {
+			body = `{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "2+2?"}]}`
+		}
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(reasoningHeader, header)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The profile strips reasoning, dropping chunks left empty
+	w := chat("/v1/chat/completions", "", true)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "reasoning_content")
+	assert.Equal(t, "4", streamedContent(t, w.Body.String()))
+	assert.Equal(t, 4, strings.Count(w.Body.String(), "data: "), w.Body.String())
+	w = chat("/v1/chat/completions", "", false)
+	assert.NotContains(t, w.Body.String(), "reasoning_content")
+	assert.Contains(t, w.Body.String(), `"content":"4"`)
+
+	// Merging wraps reasoning in <think> tags, closed before the answer
+	w = chat("/v1/chat/completions", "merge", true)
+	assert.NotContains(t, w.Body.String(), "reasoning_content")
+	assert.Equal(t, "<think>Add them.</think>\n\n4", streamedContent(t, w.Body.String()))
+	w = chat("/v1/chat/completions?reasoning=merge", "", false)
+	var resp struct {
+		Choices []struct {
+			Message map[string]any `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "<think>Add them.</think>\n\n4"}, resp.Choices[0].Message)
+
+	// The header beats the query and the profile
+	w = chat("/v1/chat/completions?reasoning=strip", "Passthrough", true)
+	assert.Equal(t, stream, w.Body.String())
+
+	// Other dialects keep their own reasoning fields
+	w = chat("/api/chat", "", false)
+	assert.Contains(t, w.Body.String(), `"thinking":"Add them."`)
+
+	w = chat("/v1/chat/completions", "summarize", false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRewriteReasoning(t *testing.T) {
+	// Tool calls close the think block as answer text does
+	open := false
+	delta := map[string]any{"reasoning_content": "Hmm"}
+	rewriteReasoning(reasoningMerge, delta, &open, false)
+	assert.Equal(t, map[string]any{"content": "<think>Hmm"}, delta)
+	assert.True(t, open)
+
+	delta = map[string]any{"tool_calls": []any{}}
+	rewriteReasoning(reasoningMerge, delta, &open, false)
+	assert.Equal(t, "</think>\n\n", delta["content"])
+	assert.False(t, open)
+
+	assert.NoError(t, ValidateReasoning(""))
+	assert.NoError(t, ValidateReasoning(reasoningMerge))
+	assert.ErrorContains(t, ValidateReasoning("hide"), "invalid mode 'hide'")
+}
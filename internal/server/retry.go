@@ -0,0 +1,133 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+)
+
+// Default backoff between attempts at a transient upstream failure
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// retryPolicy resends upstream requests that failed transiently: a broken connection, a rate
+// limit or an overloaded gateway. Attempts happen before anything is written to the client, so
+// streamed requests are retried the same way until their response starts.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	clock       clock.Clock
+	jitter      func(n int64) int64 // Random duration in [0, n)
+	retries     *metrics.Counter
+}
+
+// newRetryPolicy creates a policy from configuration, or returns nil when retries are off
+func newRetryPolicy(cfg config.RetryConfig, registry *metrics.Registry) *retryPolicy {
+	if cfg.MaxAttempts <= 1 {
+		return nil
+	}
+	return &retryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		baseDelay:   cmp.Or(cfg.BaseDelay, defaultRetryBaseDelay),
+		maxDelay:    cmp.Or(cfg.MaxDelay, defaultRetryMaxDelay),
+		clock:       clock.Real{},
+		jitter:      rand.Int64N,
+		retries: registry.Counter("copilot_proxy_upstream_retries_total",
+			"Upstream requests resent after a transient failure", "upstream", "reason"),
+	}
+}
+
+// retryReason reports whether an attempt failed transiently. Client cancellation never did.
+func retryReason(ctx context.Context, resp *http.Response, err error) (string, bool) {
+	if ctx.Err() != nil {
+		return "", false
+	}
+	if err != nil {
+		return "connection", !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return strconv.Itoa(resp.StatusCode), true
+	}
+	return "", false
+}
+
+// delay is the wait before the given retry (1 for the first): the upstream's Retry-After when
+// it sent one, otherwise an exponential backoff with jitter. A Retry-After longer than the
+// maximum delay is not waited out, so the failure is returned as it is.
+func (p *retryPolicy) delay(retry int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), p.clock.Now()); ok {
+			return after, after <= p.maxDelay
+		}
+	}
+	backoff := p.maxDelay
+	if shift := retry - 1; shift < 32 {
+		backoff = min(p.baseDelay<<shift, p.maxDelay)
+	}
+	// Spread clients that failed together over the upper half of the backoff
+	half := int64(backoff / 2)
+	return time.Duration(half + p.jitter(half+1)), true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// send posts a chat completion to the upstream, retrying transient failures under the retry
+// policy. Every attempt is reported to the hooks; the last one is returned whether or not it
+// succeeded.
+func (s *Server) send(ctx context.Context, target *upstream, body []byte, extra http.Header) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := target.do(ctx, s.client, body, extra)
+		s.hooks.observeUpstream(ctx, target.name, resp, err)
+		if s.retry == nil || attempt >= s.retry.maxAttempts {
+			return resp, err
+		}
+		reason, ok := retryReason(ctx, resp, err)
+		if !ok {
+			return resp, err
+		}
+		wait, ok := s.retry.delay(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		name := cmp.Or(target.name, "default")
+		slog.Warn("Upstream failed, retrying", "upstream", name, "reason", reason,
+			"attempt", attempt+1, "of", s.retry.maxAttempts, "wait", wait.Round(time.Millisecond))
+		s.retry.retries.Inc(name, reason)
+
+		timer := s.retry.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
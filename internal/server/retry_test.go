@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetries(t *testing.T) {
+	// The upstream fails with the queued statuses, then answers
+	var failures []int
+	var retryAfter string
+	var attempts atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if len(failures) > 0 {
+			status := failures[0]
+			failures = failures[1:]
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"busy"}`))
+			return
+		}
+		if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: upstream.URL,
+		Retry:   config.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond},
+	}, "127.0.0.1", 0)
+
+	send := func(stream bool) *httptest.ResponseRecorder {
+		attempts.Store(0)
+		body := `{"model": "glm-4.7", "stream": false, "messages": [{"role": "user", "content": "hi"}]}`
+		if stream {
+			body = strings.Replace(body, `"stream": false`, `"stream": true`, 1)
+		}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Transient failures", func(t *testing.T) {
+		failures, retryAfter = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, ""
+		w := send(false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("Streaming before the response starts", func(t *testing.T) {
+		failures, retryAfter = []int{http.StatusBadGateway}, ""
+		w := send(true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "[DONE]")
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+
+	t.Run("Attempts run out", func(t *testing.T) {
+		failures, retryAfter = []int{503, 503, 503, 503}, ""
+		w := send(false)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("Permanent failure", func(t *testing.T) {
+		failures, retryAfter = []int{http.StatusBadRequest}, ""
+		w := send(false)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("Retry-After past the maximum delay", func(t *testing.T) {
+		failures, retryAfter = []int{http.StatusTooManyRequests}, "60"
+		w := send(false)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, int32(1), attempts.Load())
+	})
+
+	var out strings.Builder
+	s.metrics.WriteText(&out)
+	assert.Contains(t, out.String(), `copilot_proxy_upstream_retries_total{upstream="default",reason="503"} 3`)
+	assert.Contains(t, out.String(), `copilot_proxy_upstream_retries_total{upstream="default",reason="429"} 1`)
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := newRetryPolicy(config.RetryConfig{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, metrics.NewRegistry())
+	p.jitter = func(n int64) int64 { return n - 1 } // Longest wait
+
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 40: time.Second} {
+		got, ok := p.delay(retry, nil)
+		assert.True(t, ok)
+		assert.Equal(t, want, got, "retry %d", retry)
+	}
+	p.jitter = func(int64) int64 { return 0 } // Shortest wait
+	got, _ := p.delay(1, nil)
+	assert.Equal(t, 50*time.Millisecond, got)
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"1"}}}
+	got, ok := p.delay(1, resp)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, got)
+	resp.Header.Set("Retry-After", p.clock.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	_, ok = p.delay(1, resp)
+	assert.False(t, ok)
+
+	assert.Nil(t, newRetryPolicy(config.RetryConfig{MaxAttempts: 1}, metrics.NewRegistry()))
+}
+
+func TestRetryReason(t *testing.T) {
+	ctx := context.Background()
+	_, ok := retryReason(ctx, nil, errors.New("connection reset by peer"))
+	assert.True(t, ok)
+	_, ok = retryReason(ctx, &http.Response{StatusCode: http.StatusInternalServerError}, nil)
+	assert.False(t, ok)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, ok = retryReason(canceled, nil, context.Canceled)
+	assert.False(t, ok)
+
+	// A cancelled wait ends the retries at once
+	s := NewServer(&config.Config{BaseURL: "http://127.0.0.1:1", Retry: config.RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}}, "127.0.0.1", 0)
+	waitCtx, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer stop()
+	_, err := s.send(waitCtx, s.defaultUpstream(), []byte(`{}`), nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
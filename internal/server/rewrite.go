@@ -0,0 +1,20 @@
+package server
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyRewrites runs the configured body rewrite rules matching the request, in order, on the
+// prepared upstream body
+func (s *Server) applyRewrites(c *gin.Context, bodyMap map[string]any) {
+	model, _ := bodyMap["model"].(string)
+	dialect := dialectOf(c.Request.URL.Path)
+	for _, r := range s.rewrites {
+		if r.Matches(model, dialect, c.Request.Header) {
+			r.Apply(bodyMap)
+			slog.Debug("Applied rewrite rule", "rule", r.Name, "model", model)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/script"
+	"github.com/gin-gonic/gin"
+)
+
+// loadScripts loads the configured Lua hook scripts, skipping any that fail to load
+func loadScripts(cfgs []config.ScriptConfig) []*script.Script {
+	var scripts []*script.Script
+	for _, cfg := range cfgs {
+		sc, err := script.Load(cfg)
+		if err != nil {
+			slog.Error("Script disabled", "error", err)
+			continue
+		}
+		slog.Info("Script loaded", "script", sc.Name, "on_request", sc.HasRequestHook(), "on_response", sc.HasResponseHook())
+		scripts = append(scripts, sc)
+	}
+	return scripts
+}
+
+// runRequestScripts passes the prepared upstream body through each script's on_request hook in
+// order and returns the upstream headers they set. Response headers are set on the client
+// response directly. A failing hook is skipped unless the script is configured to fail closed.
+func (s *Server) runRequestScripts(c *gin.Context, bodyMap map[string]any) (http.Header, error) {
+	headers := http.Header{}
+	for _, sc := range s.scripts {
+		if !sc.HasRequestHook() {
+			continue
+		}
+
+		model, _ := bodyMap["model"].(string)
+		ev := script.RequestEvent{
+			Model:   model,
+			Dialect: dialectOf(c.Request.URL.Path),
+			Headers: make(map[string]string, len(c.Request.Header)),
+			Body:    bodyMap,
+		}
+		for name := range c.Request.Header {
+			if !hopByHopHeaders[name] && name != "Authorization" && name != "X-Api-Key" {
+				ev.Headers[name] = c.Request.Header.Get(name)
+			}
+		}
+		if principal := principalFrom(c); principal != nil {
+			ev.Client = principal.Name
+		}
+
+		res, err := sc.OnRequest(c.Request.Context(), ev)
+		if err != nil {
+			slog.Error("Script request hook failed", "error", err)
+			if sc.FailClosed {
+				return nil, api.ErrInternalServer("request rejected: script %s failed", sc.Name)
+			}
+			continue
+		}
+		if res.Error != nil {
+			return nil, hookRejection("script "+sc.Name, res.Error.Status, res.Error.Message)
+		}
+		clear(bodyMap)
+		for k, v := range res.Body {
+			bodyMap[k] = v
+		}
+		for name, values := range res.Headers {
+			headers[name] = values
+		}
+		for name, values := range res.ResponseHeaders {
+			c.Writer.Header()[name] = values
+		}
+	}
+	return headers, nil
+}
+
+// responseScriptHook returns a function passing response chunks through each script's
+// on_response hook, or nil when no script has one. It reports false when a script drops the
+// chunk.
+func (s *Server) responseScriptHook(ctx context.Context, model string) func(chunk map[string]any, stream bool) (map[string]any, bool) {
+	var hooked []*script.Script
+	for _, sc := range s.scripts {
+		if sc.HasResponseHook() {
+			hooked = append(hooked, sc)
+		}
+	}
+	if len(hooked) == 0 {
+		return nil
+	}
+
+	return func(chunk map[string]any, stream bool) (map[string]any, bool) {
+		for _, sc := range hooked {
+			res, err := sc.OnResponse(ctx, script.ResponseEvent{Model: model, Stream: stream, Chunk: chunk})
+			if err != nil {
+				slog.Error("Script response hook failed", "error", err)
+				continue
+			}
+			if res.Drop {
+				return nil, false
+			}
+			chunk = res.Chunk
+		}
+		return chunk, true
+	}
+}
+
+// chainChunkHooks runs chunk hooks in order, skipping nil ones; it returns nil when none remain
+func chainChunkHooks(hooks ...func(map[string]any, bool) (map[string]any, bool)) func(map[string]any, bool) (map[string]any, bool) {
+	var active []func(map[string]any, bool) (map[string]any, bool)
+	for _, h := range hooks {
+		if h != nil {
+			active = append(active, h)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+	return func(chunk map[string]any, stream bool) (map[string]any, bool) {
+		for _, h := range active {
+			var ok bool
+			if chunk, ok = h(chunk, stream); !ok {
+				return nil, false
+			}
+		}
+		return chunk, true
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatCompletions_Scripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	os.WriteFile(path, []byte(`
+function on_request(req)
+  if req.headers["X-Block"] then
+    proxy.reject(429, "slow down")
+  end
+  req.body.temperature = 0.2
+  proxy.set_header("X-Tenant", "acme")
+  proxy.set_response_header("X-Hooked", "lua")
+end
+
+function on_response(res)
+  local msg = res.chunk.choices[1].message or res.chunk.choices[1].delta
+  if msg.content == "DROP" then
+    return false
+  end
+  msg.content = string.upper(msg.content)
+end
+`), 0o644)
+
+	var got map[string]any
+	var tenant string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		tenant = r.Header.Get("X-Tenant")
+		json.NewDecoder(r.Body).Decode(&got)
+		if stream, _ := got["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hello\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"DROP\"}}]}\n\n" +
+				"data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi there"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		Scripts: []config.ScriptConfig{{Name: "hook", Path: path}},
+	}, "127.0.0.1", 0)
+	if !assert.Len(t, s.scripts, 1) {
+		return
+	}
+
+	send := func(body string, block bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if block {
+			req.Header.Set("X-Block", "1")
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0.2, got["temperature"])
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "lua", w.Header().Get("X-Hooked"))
+	assert.Contains(t, w.Body.String(), `"content":"HI THERE"`)
+
+	w = send(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"HELLO"`)
+	assert.NotContains(t, w.Body.String(), "DROP")
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+
+	got = nil
+	w = send(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`, true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "slow down")
+	assert.Nil(t, got, "rejected requests must not reach upstream")
+}
@@ -5,23 +5,94 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/chew-z/copilot-proxy/internal/agent"
+	"github.com/chew-z/copilot-proxy/internal/clock"
 	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/dataset"
+	"github.com/chew-z/copilot-proxy/internal/logging"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/otel"
+	"github.com/chew-z/copilot-proxy/internal/plugin"
+	"github.com/chew-z/copilot-proxy/internal/postprocess"
+	"github.com/chew-z/copilot-proxy/internal/prompts"
+	"github.com/chew-z/copilot-proxy/internal/ratelimit"
+	"github.com/chew-z/copilot-proxy/internal/requestlog"
+	"github.com/chew-z/copilot-proxy/internal/retention"
+	"github.com/chew-z/copilot-proxy/internal/rewrite"
+	"github.com/chew-z/copilot-proxy/internal/scheduler"
+	"github.com/chew-z/copilot-proxy/internal/script"
+	"github.com/chew-z/copilot-proxy/internal/signing"
+	"github.com/chew-z/copilot-proxy/internal/storage"
+	"github.com/chew-z/copilot-proxy/internal/usage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	config  *config.Config
-	router  *gin.Engine
-	server  *http.Server
-	client  *http.Client
-	logFile *os.File
+	config *config.Config
+	router *gin.Engine
+	server *http.Server
+
+	listener net.Listener // Bound by Listen; nil until then
+
+	managementRouter *gin.Engine  // nil unless the management endpoints have their own listener
+	management       *http.Server // Serves managementRouter
+	client           *http.Client
+	logFile          *os.File
+	scheduler        *scheduler.Scheduler // nil when no jobs are configured
+	dataset          *dataset.Collector   // nil unless dataset collection is enabled
+	metrics          *metrics.Registry
+	persister        *metrics.Persister // nil when metrics persistence is disabled
+	janitor          *retention.Janitor // nil when retention sweeps are disabled
+	store            storage.Store      // State shared between replicas, such as quota counters
+	usage            *usageMetrics
+	ledger           *usage.Ledger   // nil unless the usage ledger is enabled
+	exporter         *usage.Exporter // nil unless usage reports are scheduled
+	requestLog       *requestlog.Log // nil unless the request log is enabled
+
+	attribution  *attribution         // nil unless attribution is configured
+	postRules    []*postprocess.Rule  // Completion post-processing rules, in order
+	rewrites     []*rewrite.Rule      // Upstream request body rewrite rules, in order
+	plugins      []*plugin.Plugin     // WebAssembly request/response hooks, in order
+	scripts      []*script.Script     // Lua request/response hooks, in order
+	assist       *assistant           // Commit/PR prompt templates; nil if they fail to parse
+	duplicates   *duplicateGuard      // nil unless duplicate detection is enabled
+	anomalies    *anomalyDetector     // nil unless usage anomaly alerts are enabled
+	slo          *sloEvaluator        // nil unless latency objectives are enabled
+	tracer       *tracer              // nil unless tracing is enabled
+	otel         *otel.Tracer         // OpenTelemetry span exporter; nil, handing out no-op spans, unless enabled
+	failover     *failover            // nil unless a local Ollama failover is configured
+	fallbacks    *fallbackChains      // nil unless fallback models are configured
+	watchdog     *streamWatchdog      // Open upstream responses, force-closed past their caps
+	retry        *retryPolicy         // nil when transient upstream failures are not retried
+	quotas       *clientQuotas        // nil unless clients authenticate
+	broadcast    *broadcastHub        // nil unless broadcasting is enabled
+	cache        *responseCache       // nil unless response caching is enabled
+	catalogViews catalogViews         // Catalog subsets keyed by lowercase client name; nil when all clients see the full catalog
+	rateLimits   *upstreamLimits      // Rate limits upstreams last reported, echoed to clients
+	hooks        *hookRunner          // nil unless lifecycle hook commands are configured
+	upstreams    map[string]*upstream // Named upstreams selectable with X-Upstream, keyed by lowercase name
+	providers    map[string]*upstream // Providers serving routed models, keyed by canonical model
+	apiKey       *credential          // Default upstream API key, rotatable at runtime
+	signer       signing.Signer       // nil unless upstream requests are signed
+	endpoints    *endpoints           // Backups of the default base URL, nil when there are none
+	canary       *canaryRouter        // Weighted model rollouts, adjustable at runtime
+	active       *activeRequests      // In-flight chat requests, cancellable by ID
+	prompts      *prompts.Store       // Fragments that messages include by name or digest
+	links        *linkChecker         // Dead link checks, enabled by config
+	agentTools   *agent.Toolbox       // Tools of the agent endpoint; nil when it is off
+	clock        clock.Clock          // Time source of cutoffs, caches and injected dates
+
+	openAIHeaders headerPolicy // Upstream response headers forwarded on /v1 routes
+	ollamaHeaders headerPolicy // Upstream response headers forwarded on /api routes
 }
 
 // NewServer creates a new server instance
@@ -34,7 +105,10 @@ func NewServer(cfg *config.Config, host string, port int) *Server {
 	}
 
 	// Setup logging
-	logPath := filepath.Join(os.TempDir(), "copilot-proxy.log")
+	logPath := config.LogPath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		slog.Error("Could not create log directory", "path", filepath.Dir(logPath), "error", err)
+	}
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		slog.Error("Could not create log file", "path", logPath, "error", err)
@@ -45,15 +119,19 @@ func NewServer(cfg *config.Config, host string, port int) *Server {
 			logLevel = slog.LevelDebug
 		}
 
+		// Credentials are always masked; privacy mode also scrubs message content from every record
+		handlerOpts := &slog.HandlerOptions{
+			Level:       logLevel,
+			ReplaceAttr: logging.ReplaceAttr(cfg.LogPrivacy),
+		}
+
 		// Setup writers based on verbose mode (default: quiet, log to file only)
 		if cfg.Verbose {
 			// Verbose mode: log to both file and stdout
 			gin.DefaultWriter = io.MultiWriter(logFile, os.Stdout)
 			gin.DefaultErrorWriter = io.MultiWriter(logFile, os.Stderr)
 
-			handler := slog.NewTextHandler(io.MultiWriter(logFile, os.Stdout), &slog.HandlerOptions{
-				Level: logLevel,
-			})
+			handler := slog.NewTextHandler(io.MultiWriter(logFile, os.Stdout), handlerOpts)
 			slog.SetDefault(slog.New(handler))
 			slog.Info("Logging initialized", "path", logPath)
 		} else {
@@ -61,9 +139,7 @@ func NewServer(cfg *config.Config, host string, port int) *Server {
 			gin.DefaultWriter = logFile
 			gin.DefaultErrorWriter = logFile
 
-			handler := slog.NewTextHandler(logFile, &slog.HandlerOptions{
-				Level: logLevel,
-			})
+			handler := slog.NewTextHandler(logFile, handlerOpts)
 			slog.SetDefault(slog.New(handler))
 		}
 	}
@@ -77,28 +153,85 @@ func NewServer(cfg *config.Config, host string, port int) *Server {
 	router := gin.New()
 	router.Use(gin.Recovery())
 
+	// Use the socket peer address for ClientIP; forwarding headers are trivially spoofed
+	_ = router.SetTrustedProxies(nil)
+
+	registry := metrics.NewRegistry()
+
 	// Add logger middleware in debug mode
 	if cfg.Debug {
 		router.Use(gin.Logger())
 	}
 
+	// Make proxied requests OpenTelemetry spans, including those the middleware below rejects
+	otelTracer := newOTelTracer(cfg.OTel)
+	if otelTracer != nil {
+		router.Use(otelMiddleware(otelTracer))
+	}
+
 	// Add CORS middleware
+	allowHeaders := []string{"Origin", "Content-Type", "Authorization", "X-Api-Key", "traceparent", datasetTagHeader, profileHeader, upstreamHeader, linkCheckHeader, workspaceHeader, sessionHeader, latencyTraceHeader, requestIDHeader}
+	if cfg.Trace.Enabled && cfg.Trace.Header != "" {
+		allowHeaders = append(allowHeaders, cfg.Trace.Header)
+	}
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowHeaders:     allowHeaders,
+		ExposeHeaders:    []string{"Content-Length", rateLimitLimitHeader, rateLimitRemainingHeader, rateLimitResetHeader, traceIDHeader, otelTraceHeader, failoverHeader, fallbackHeader, upstreamHeader, toolResultsHeader, imageAdjustmentsHeader, cacheHeader, requestIDHeader},
 		AllowCredentials: false,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Open the store for state shared between replicas, falling back to this process only
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		slog.Error("Shared storage unavailable, using memory", "error", err)
+		store = storage.NewMemory()
+	}
+	var shared storage.Store // nil unless limits are coordinated between replicas
+	if fallback, ok := store.(*storage.Fallback); ok {
+		shared = fallback
+		up := registry.Gauge("copilot_proxy_storage_shared_up",
+			"Whether shared state is coordinated through the shared store (1) or kept locally during an outage (0)")
+		up.Set(1)
+		fallback.OnChange = func(ok bool) {
+			if ok {
+				up.Set(1)
+			} else {
+				up.Set(0)
+			}
+		}
+	}
+
+	// Add per-IP rate limiting
+	if cfg.RateLimit.Enabled {
+		limiter := ratelimit.New(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+		router.Use(rateLimitMiddleware(limiter, shared, cfg.RateLimit.RequestsPerMinute, registry, clock.Real{}))
+	}
+
+	// Run configured commands on lifecycle events
+	hooks := newHookRunner(cfg.Hooks)
+
+	// Guard the management endpoints with their own token, on their own listener if configured.
+	// Without either they are not served at all.
+	management, managementRouter := newManagementServer(cfg.Admin)
+	if managementRouter != nil {
+		managementRouter.Use(adminMiddleware(cfg.Admin.Token, registry))
+	} else if cfg.Admin.Token != "" {
+		router.Use(adminMiddleware(cfg.Admin.Token, registry))
+	} else {
+		slog.Info("Management endpoints disabled; set admin.token or admin.listen to serve /metrics and /admin/*")
+	}
+
+	// Add client authentication with brute-force lockout
+	if cfg.Auth.Enabled() {
+		router.Use(authMiddleware(cfg.Auth, cfg.Admin.Token != "", store, registry, hooks))
+	}
+
 	// Create optimized HTTP client
 	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost:   50, // Default is 2, way too low for concurrent requests
-			IdleConnTimeout:       90 * time.Second,
-			ResponseHeaderTimeout: 30 * time.Second, // Timeout only for headers
-		},
+		Transport: newTransport(cfg.Transport),
 		// No global Timeout - let context handle cancellation
 	}
 
@@ -108,32 +241,306 @@ func NewServer(cfg *config.Config, host string, port int) *Server {
 		Handler: router,
 	}
 
+	apiKey := newCredential(cfg.APIKey)
+	dialTimeout := withTransportDefaults(cfg.Transport).DialTimeout
+	defaultEndpoints := newEndpoints(cfg.BackupBaseURLs, cfg.Endpoints.ReprobeInterval, dialTimeout)
+
+	// Sign upstream requests for egress gateways that require it
+	signer, err := signing.New(cfg.Signing)
+	if err != nil {
+		slog.Error("Upstream request signing disabled", "error", err)
+	}
+
 	server := &Server{
-		config:  cfg,
-		router:  router,
-		server:  srv,
+		clock:  clock.Real{},
+		config: cfg,
+		router: router,
+		server: srv,
+
+		managementRouter: managementRouter,
+		management:       management,
+
 		client:  client,
 		logFile: logFile,
+		metrics: registry,
+		store:   store,
+		usage:   newUsageMetrics(registry),
+		hooks:   hooks,
+
+		apiKey:    apiKey,
+		signer:    signer,
+		endpoints: defaultEndpoints,
+
+		upstreams:  newUpstreams(cfg, apiKey, defaultEndpoints, dialTimeout, signer, clock.Real{}),
+		providers:  newProviders(cfg, dialTimeout),
+		canary:     newCanaryRouter(cfg.Canary),
+		active:     newActiveRequests(),
+		watchdog:   newStreamWatchdog(cfg.Streams, registry),
+		retry:      newRetryPolicy(cfg.Retry, registry),
+		quotas:     newClientQuotas(cfg.Auth, store, registry),
+		broadcast:  newBroadcastHub(cfg.Broadcast, registry),
+		cache:      newResponseCache(cfg.Cache, registry),
+		rateLimits: newUpstreamLimits(clock.Real{}),
+		otel:       otelTracer,
+
+		openAIHeaders: newHeaderPolicy(cfg.ResponseHeaders.OpenAI, DefaultOpenAIHeaders),
+		ollamaHeaders: newHeaderPolicy(cfg.ResponseHeaders.Ollama, DefaultOllamaHeaders),
+	}
+	if server.broadcast != nil {
+		router.Use(server.broadcast.middleware())
+	}
+
+	// Restore cumulative counters saved by a previous run
+	if cfg.Metrics.FlushInterval > 0 {
+		if path, err := cfg.Metrics.StatePath(); err != nil {
+			slog.Error("Metrics persistence disabled", "error", err)
+		} else if persister, err := metrics.NewPersister(registry, path, cfg.Metrics.FlushInterval); err != nil {
+			slog.Error("Metrics persistence disabled", "error", err)
+		} else {
+			server.persister = persister
+		}
+	}
+
+	// Record per-request usage for reports
+	if cfg.Usage.Ledger {
+		server.ledger = newUsageLedger(cfg.Usage)
+	}
+	if cfg.Usage.Export.Schedule != "" {
+		server.exporter = newUsageExporter(cfg.Usage, server.clock)
+	}
+	if cfg.RequestLog.Enabled {
+		if path, err := cfg.RequestLog.DBPath(); err != nil {
+			slog.Error("Request log disabled", "error", err)
+		} else if server.requestLog, err = requestlog.New(path, cfg.RequestLog.MaxAge, server.clock); err != nil {
+			slog.Error("Request log disabled", "error", err)
+		}
+	}
+
+	// Keep persisted data within its retention limits
+	if cfg.Retention.Interval > 0 {
+		if stores, err := retention.Stores(cfg); err != nil {
+			slog.Error("Retention sweeps disabled", "error", err)
+		} else {
+			server.janitor = retention.NewJanitor(stores, cfg.Retention.Interval, server.clock)
+		}
 	}
 
-	// Setup routes
+	// Setup attribution of generated content (the trailer template is validated by the serve command)
+	if attr, err := newAttribution(cfg.Attribution); err != nil {
+		slog.Error("Attribution disabled", "error", err)
+	} else {
+		server.attribution = attr
+	}
+
+	// Setup post-processing rules (validated by the serve command)
+	if rules, err := postprocess.CompileAll(cfg.PostProcess); err != nil {
+		slog.Error("Post-processing disabled", "error", err)
+	} else {
+		server.postRules = rules
+	}
+
+	// Setup request body rewrite rules (validated by the serve command)
+	if rules, err := rewrite.CompileAll(cfg.Rewrites); err != nil {
+		slog.Error("Body rewrites disabled", "error", err)
+	} else {
+		server.rewrites = rules
+	}
+
+	// Setup per-client catalog views (validated by the serve command)
+	if views, err := newCatalogViews(cfg); err != nil {
+		slog.Error("Catalog views disabled", "error", err)
+	} else {
+		server.catalogViews = views
+	}
+
+	// Load WebAssembly plugins
+	server.plugins = loadPlugins(cfg.Plugins)
+
+	// Load Lua hook scripts
+	server.scripts = loadScripts(cfg.Scripts)
+
+	// Load the prompt fragments that messages can include
+	server.prompts = loadPrompts(cfg.Prompts)
+
+	// Setup dead link checks on completions
+	server.links = newLinkChecker(cfg.Links)
+
+	// Setup the tools the agent endpoint executes
+	server.agentTools = loadAgent(cfg.Agent)
+
+	// Setup commit message and PR description prompts (validated by the serve command)
+	if assist, err := newAssistant(cfg.Assist); err != nil {
+		slog.Error("Assist endpoints disabled", "error", err)
+	} else {
+		server.assist = assist
+	}
+
+	// Setup duplicate request storm detection
+	if cfg.Duplicates.Enabled {
+		server.duplicates = newDuplicateGuard(cfg.Duplicates, registry)
+	}
+
+	// Setup alerts on token usage spikes
+	if cfg.Anomalies.Enabled {
+		server.anomalies = newAnomalyDetector(cfg.Anomalies, registry)
+	}
+
+	// Setup latency objectives and their burn alerts
+	if cfg.SLO.Enabled {
+		server.slo = newSLOEvaluator(cfg.SLO, registry)
+	}
+
+	// Setup dataset collection (transcripts are never written in log privacy mode)
+	if cfg.Dataset.Enabled && cfg.LogPrivacy {
+		slog.Warn("Dataset collection disabled: log privacy mode is enabled")
+	} else if cfg.Dataset.Enabled {
+		server.dataset = newDatasetCollector(cfg.Dataset)
+	}
+
+	// Setup sampled debug traces (full payloads are never written in log privacy mode)
+	if cfg.Trace.Enabled && cfg.LogPrivacy {
+		slog.Warn("Tracing disabled: log privacy mode is enabled")
+	} else if cfg.Trace.Enabled {
+		server.tracer = newTracer(cfg.Trace, server.clock)
+	}
+
+	// Setup fallback models for rate limited or failing upstreams
+	if len(cfg.Fallbacks) > 0 {
+		server.fallbacks = newFallbackChains(cfg.Fallbacks, registry)
+	}
+
+	// Setup last-resort failover to a local Ollama instance
+	if cfg.Failover.OllamaURL != "" {
+		server.failover = newFailover(cfg.Failover, registry)
+	}
+
+	// Setup scheduled jobs (definitions are validated by the serve command)
+	if len(cfg.Jobs) > 0 {
+		// Jobs run for no client, so no quota applies
+		complete := func(ctx context.Context, bodyMap map[string]any) ([]byte, error) {
+			return server.complete(ctx, nil, bodyMap)
+		}
+		sched, err := scheduler.New(cfg.Jobs, complete)
+		if err != nil {
+			slog.Error("Scheduled jobs disabled", "error", err)
+		} else {
+			server.scheduler = sched
+		}
+	}
+
+	// Setup routes last; some endpoints are only registered when their feature is available
 	server.setupRoutes()
 
 	return server
 }
 
+// SetAddr changes the address the server listens on; it must be called before Listen or Start
+func (s *Server) SetAddr(host string, port int) {
+	s.server.Addr = getAddr(host, port)
+}
+
+// Listen binds the server's address, so that a port conflict can be handled before anything
+// starts. Start binds it itself when Listen has not.
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	return nil
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	return s.server.ListenAndServe()
+	if s.listener == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
+	ln := s.listener
+	if s.management != nil {
+		mln, err := net.Listen("tcp", s.management.Addr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("management listener: %w", err)
+		}
+		slog.Info("Management endpoints listening", "addr", mln.Addr().String())
+		go func() {
+			if err := s.management.Serve(mln); err != nil && err != http.ErrServerClosed {
+				slog.Error("Management listener failed", "error", err)
+			}
+		}()
+	}
+	if s.scheduler != nil {
+		s.scheduler.Start()
+	}
+	if s.persister != nil {
+		s.persister.Start()
+	}
+	if s.janitor != nil {
+		s.janitor.Start()
+	}
+	s.watchdog.Start()
+	if s.exporter != nil {
+		s.exporter.Start()
+	}
+	s.hooks.fire(hookServerStart, map[string]any{"addr": ln.Addr().String()})
+	return s.server.Serve(ln)
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server. The listeners stop first and in-flight requests
+// finish before the store, plugins and scripts they use are closed.
 func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if s.management != nil {
+		s.management.Shutdown(ctx)
+	}
+	// Stop scheduled jobs before the log file goes away
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+	// Save counters for the next run
+	if s.persister != nil {
+		s.persister.Stop()
+	}
+	if s.janitor != nil {
+		s.janitor.Stop()
+	}
+	s.watchdog.Stop()
+	if s.exporter != nil {
+		s.exporter.Stop()
+	}
+	s.store.Close()
+	for _, p := range s.plugins {
+		p.Close(ctx)
+	}
+	for _, sc := range s.scripts {
+		sc.Close()
+	}
+	s.endpoints.close()
+	for _, u := range s.upstreams {
+		if u.endpoints != s.endpoints {
+			u.endpoints.close()
+		}
+	}
+	closed := make(map[*upstream]bool)
+	for _, u := range s.providers {
+		if !closed[u] {
+			u.endpoints.close()
+			closed[u] = true
+		}
+	}
+	s.hooks.wait(ctx)
+	// Export the spans of the requests that just finished
+	s.otel.Shutdown(ctx)
+	if s.requestLog != nil {
+		s.requestLog.Close()
+	}
 	// Close log file if it was opened
 	if s.logFile != nil {
 		s.logFile.Close()
 	}
-	return s.server.Shutdown(ctx)
+	return err
 }
 
 // CreateShutdownContext creates a context for graceful shutdown
@@ -147,15 +554,50 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/api/tags", s.handleTags)
 	s.router.GET("/api/list", s.handleTags) // Alias for /api/tags
 	s.router.GET("/api/version", s.handleVersion)
+	s.router.GET("/api/capabilities", s.handleCapabilities)
 	s.router.GET("/api/ps", s.handlePs)
 	s.router.POST("/api/show", s.handleShow)
+	s.router.HEAD("/api/blobs/:digest", s.handleBlobHead)
+	s.router.GET("/v1/models", s.handleModels)
+	s.router.GET("/v1/models/:model", s.handleModel)
 
 	// Proxy endpoint
 	s.router.POST("/v1/chat/completions", s.handleChatCompletions)
 	s.router.POST("/api/chat", s.handleChatCompletions) // Alias for v1/chat/completions
+	s.router.POST("/api/generate", s.handleGenerate)
+	s.router.POST(anthropicMessagesPath, s.handleMessages)
+	s.router.POST("/v1/embeddings", s.handleEmbeddings)
+	s.router.POST("/api/embed", s.handleEmbed)
+	s.router.DELETE("/v1/chat/completions/:request_id", s.handleCancelRequest)
+	s.router.POST("/api/cancel", s.handleOllamaCancel)
+	if s.broadcast != nil {
+		s.router.GET("/v1/sessions/:session/stream", s.handleSessionStream)
+	}
+
+	// Convenience endpoints built on chat completions
+	s.router.POST("/v1/code-blocks", s.handleCodeBlocks)
+	s.router.POST("/api/estimate", s.handleEstimate)
+	s.router.POST("/v1/compare", s.handleCompare)
+	if s.assist != nil {
+		s.router.POST("/api/assist/commit", s.handleAssistCommit)
+		s.router.POST("/api/assist/pr", s.handleAssistPR)
+	}
+	if len(s.config.GitContext.Roots) > 0 {
+		s.router.POST("/v1/context/git", s.handleGitContext)
+	}
+	if s.agentTools != nil {
+		s.router.POST("/v1/agent", s.handleAgent)
+	}
 
 	// Optional health check endpoint
 	s.router.GET("/healthz", s.handleHealth)
+
+	// Prometheus metrics and admin endpoints, only for the admin
+	if s.managementRouter != nil {
+		s.setupManagementRoutes(s.managementRouter)
+	} else if s.config.Admin.Token != "" {
+		s.setupManagementRoutes(s.router)
+	}
 }
 
 // getAddr returns the address string from host and port
@@ -163,6 +605,22 @@ func getAddr(host string, port int) string {
 	return fmt.Sprintf("%s:%d", host, port)
 }
 
+// handleMetrics exposes metrics in the Prometheus text format, or in the OpenMetrics format
+// with latency exemplars when the scraper accepts it
+func (s *Server) handleMetrics(c *gin.Context) {
+	write := s.metrics.WriteText
+	if strings.Contains(c.GetHeader("Accept"), "application/openmetrics-text") {
+		c.Header("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		write = s.metrics.WriteOpenMetrics
+	} else {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+	if err := write(c.Writer); err != nil {
+		slog.Error("Failed to write metrics", "error", err)
+	}
+}
+
 // handleHealth is a simple health check endpoint
 func (s *Server) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+)
+
+// sloBucketsPerWindow is how many buckets the short window is counted in; the long window
+// uses buckets of the same width
+const sloBucketsPerWindow = 10
+
+// sloBucket counts the requests that started in one slice of time
+type sloBucket struct {
+	start time.Time
+	total int
+	bad   int
+}
+
+// sloSeries is the recent history of one objective for one model
+type sloSeries struct {
+	objective config.SLOObjective
+	model     string
+	buckets   []sloBucket // Oldest first, covering at most the long window
+	burning   bool
+}
+
+// sloEvaluator tracks latency objectives per model and raises an alert when both the long and
+// the short window spend the error budget faster than the configured burn rate, the
+// multi-window alert of the SRE workbook. Windows are evaluated as requests complete.
+type sloEvaluator struct {
+	objectives  []config.SLOObjective
+	long        time.Duration
+	short       time.Duration
+	burnRate    float64
+	minRequests int
+	webhookURL  string
+	client      *http.Client
+	clock       clock.Clock
+
+	rates   *metrics.Gauge
+	burning *metrics.Gauge
+	alerts  *metrics.Counter
+
+	mu     sync.Mutex
+	series map[string]*sloSeries // By objective name and model
+}
+
+// newSLOEvaluator creates an evaluator from configuration
+func newSLOEvaluator(cfg config.SLOConfig, registry *metrics.Registry) *sloEvaluator {
+	return &sloEvaluator{
+		objectives:  cfg.Objectives,
+		long:        cfg.LongWindow,
+		short:       cfg.ShortWindow,
+		burnRate:    cfg.BurnRate,
+		minRequests: cfg.MinRequests,
+		webhookURL:  cfg.WebhookURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		clock:       clock.Real{},
+		rates: registry.Gauge("copilot_proxy_slo_burn_rate",
+			"Speed at which a latency objective spends its error budget; 1 spends it exactly", "slo", "model", "window"),
+		burning: registry.Gauge("copilot_proxy_slo_burning",
+			"1 while a latency objective burns its error budget faster than the alert rate", "slo", "model"),
+		alerts: registry.Counter("copilot_proxy_slo_alerts_total",
+			"Times a latency objective started burning its error budget", "slo"),
+		series: make(map[string]*sloSeries),
+	}
+}
+
+// observe counts a completed request against every objective matching its model. Upstream
+// errors are bad requests; client errors say nothing about the service and are left out.
+func (e *sloEvaluator) observe(model string, status int, elapsed time.Duration) {
+	if status >= 400 && status < 500 {
+		return
+	}
+
+	now := e.clock.Now()
+	var alerts []map[string]any
+	e.mu.Lock()
+	for _, o := range e.objectives {
+		if ok, _ := path.Match(o.Model, strings.ToLower(model)); o.Model != "" && !ok {
+			continue
+		}
+		key := o.Name + "\x00" + model
+		s := e.series[key]
+		if s == nil {
+			s = &sloSeries{objective: o, model: model}
+			e.series[key] = s
+		}
+		s.add(now, e.width(), status >= 500 || elapsed > o.Threshold)
+	}
+	// Every series is re-evaluated so that models which went quiet recover too
+	for _, s := range e.series {
+		if alert := e.evaluate(s, now); alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range alerts {
+		if e.webhookURL != "" {
+			go e.alert(alert)
+		}
+	}
+}
+
+// width is the duration of a bucket
+func (e *sloEvaluator) width() time.Duration {
+	return max(e.short/sloBucketsPerWindow, time.Second)
+}
+
+// add counts a request in the current bucket
+func (s *sloSeries) add(now time.Time, width time.Duration, bad bool) {
+	start := now.Truncate(width)
+	if n := len(s.buckets); n == 0 || !s.buckets[n-1].start.Equal(start) {
+		s.buckets = append(s.buckets, sloBucket{start: start})
+	}
+	b := &s.buckets[len(s.buckets)-1]
+	b.total++
+	if bad {
+		b.bad++
+	}
+}
+
+// window sums the buckets that started within d of now
+func (s *sloSeries) window(now time.Time, d time.Duration) (total, bad int) {
+	for _, b := range s.buckets {
+		if now.Sub(b.start) < d {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	return total, bad
+}
+
+// evaluate drops buckets older than the long window, updates the gauges and returns an alert
+// when the series starts or stops burning
+func (e *sloEvaluator) evaluate(s *sloSeries, now time.Time) map[string]any {
+	for len(s.buckets) > 0 && now.Sub(s.buckets[0].start) >= e.long {
+		s.buckets = s.buckets[1:]
+	}
+
+	budget := 1 - s.objective.Objective
+	burn := func(total, bad int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(bad) / float64(total) / budget
+	}
+	shortTotal, shortBad := s.window(now, e.short)
+	longTotal, longBad := s.window(now, e.long)
+	shortRate, longRate := burn(shortTotal, shortBad), burn(longTotal, longBad)
+	e.rates.Set(shortRate, s.objective.Name, s.model, "short")
+	e.rates.Set(longRate, s.objective.Name, s.model, "long")
+
+	burning := shortTotal >= e.minRequests && shortRate >= e.burnRate && longRate >= e.burnRate
+	// Recovery waits for the short window to calm down, so a burst does not flap the alert
+	if s.burning && shortRate >= e.burnRate {
+		burning = true
+	}
+	if burning == s.burning {
+		return nil
+	}
+	s.burning = burning
+
+	event := "slo_recovered"
+	value := 0.0
+	if burning {
+		event, value = "slo_burn", 1
+		e.alerts.Inc(s.objective.Name)
+		slog.Warn("SLO error budget burning", "slo", s.objective.Name, "model", s.model,
+			"short_burn_rate", shortRate, "long_burn_rate", longRate)
+	} else {
+		slog.Info("SLO error budget burn recovered", "slo", s.objective.Name, "model", s.model)
+	}
+	e.burning.Set(value, s.objective.Name, s.model)
+	return map[string]any{
+		"event":           event,
+		"slo":             s.objective.Name,
+		"model":           s.model,
+		"objective":       s.objective.Objective,
+		"threshold":       s.objective.Threshold.String(),
+		"short_burn_rate": shortRate,
+		"long_burn_rate":  longRate,
+		"alert_burn_rate": e.burnRate,
+		"short_requests":  shortTotal,
+		"long_requests":   longTotal,
+		"detected_at":     now.UTC().Format(time.RFC3339),
+	}
+}
+
+// alert posts a burn notification to the configured webhook
+func (e *sloEvaluator) alert(alert map[string]any) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Failed to create SLO alert", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		slog.Error("SLO alert delivery failed", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("SLO alert webhook returned error", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOEvaluator(t *testing.T) {
+	alerts := make(chan map[string]any, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	registry := metrics.NewRegistry()
+	e := newSLOEvaluator(config.SLOConfig{
+		Objectives:  []config.SLOObjective{{Name: "fast", Model: "glm-4.*", Objective: 0.9, Threshold: 10 * time.Second}},
+		LongWindow:  time.Hour,
+		ShortWindow: 5 * time.Minute,
+		BurnRate:    5,
+		MinRequests: 4,
+		WebhookURL:  webhook.URL,
+	}, registry)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	e.clock = fake
+	gauges := func() string {
+		var b strings.Builder
+		registry.WriteText(&b)
+		return b.String()
+	}
+
+	// A healthy hour, then requests that are slow, fail upstream or are the client's fault
+	for range 40 {
+		e.observe("glm-4.7", http.StatusOK, time.Second)
+		fake.Advance(time.Minute)
+	}
+	e.observe("glm-4.7", http.StatusOK, 20*time.Second)
+	e.observe("glm-4.7", http.StatusBadGateway, time.Second)
+	e.observe("glm-4.7", http.StatusBadRequest, time.Second)
+	e.observe("other", http.StatusBadGateway, time.Second)
+	// 2 of the 6 requests in the short window were bad, against a budget of 10%
+	assert.Contains(t, gauges(), `copilot_proxy_slo_burn_rate{slo="fast",model="glm-4.7",window="short"} 3.33`)
+	assert.NotContains(t, gauges(), "copilot_proxy_slo_burning{")
+	assert.NotContains(t, gauges(), `model="other"`)
+
+	// The short window has enough bad requests, but the hour is still mostly good
+	e.observe("glm-4.7", http.StatusBadGateway, time.Second)
+	e.observe("glm-4.7", http.StatusBadGateway, time.Second)
+	assert.NotContains(t, gauges(), "copilot_proxy_slo_burning{")
+
+	// Both windows burn once failures keep coming
+	for range 40 {
+		e.observe("glm-4.7", http.StatusBadGateway, time.Second)
+	}
+	assert.Contains(t, gauges(), `copilot_proxy_slo_burning{slo="fast",model="glm-4.7"} 1`)
+	assert.Contains(t, gauges(), `copilot_proxy_slo_alerts_total{slo="fast"} 1`)
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "slo_burn", alert["event"])
+		assert.Equal(t, "fast", alert["slo"])
+		assert.Equal(t, "glm-4.7", alert["model"])
+		assert.Equal(t, "10s", alert["threshold"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("No burn alert delivered")
+	}
+
+	// Recovery comes with the short window calming down
+	fake.Advance(10 * time.Minute)
+	e.observe("glm-4.7", http.StatusOK, time.Second)
+	assert.Contains(t, gauges(), `copilot_proxy_slo_burning{slo="fast",model="glm-4.7"} 0`)
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "slo_recovered", alert["event"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("No recovery alert delivered")
+	}
+}
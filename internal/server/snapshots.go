@@ -0,0 +1,47 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// modelSnapshotHeader requests a snapshot of the model, overriding its pin, and reports the
+// snapshot a response came from
+const modelSnapshotHeader = "X-Model-Snapshot"
+
+// unpinnedSnapshot is the override value that sends the bare model name, whichever snapshot
+// upstream currently serves under it
+const unpinnedSnapshot = "latest"
+
+// pinnedSnapshot returns the configured snapshot of a model, or "" if it is not pinned
+func (s *Server) pinnedSnapshot(name string) string {
+	canonical := models.GetCanonicalModelName(name)
+	for key, snapshot := range s.config.ModelSnapshots {
+		if models.GetCanonicalModelName(key) == canonical {
+			return snapshot
+		}
+	}
+	return ""
+}
+
+// resolveSnapshot returns the upstream model identifier for a canonical model: the snapshot the
+// client asked for, its pin, or the model itself. Overrides must name a snapshot of the same
+// model, so they cannot reach models the client was not allowed.
+func (s *Server) resolveSnapshot(c *gin.Context, model string) (string, error) {
+	override := strings.TrimSpace(c.GetHeader(modelSnapshotHeader))
+	switch {
+	case override == "":
+		if pinned := s.pinnedSnapshot(model); pinned != "" {
+			return pinned, nil
+		}
+		return model, nil
+	case strings.EqualFold(override, unpinnedSnapshot):
+		return model, nil
+	case models.IsSnapshotOf(override, model):
+		return override, nil
+	}
+	return "", api.ErrBadRequest("%s '%s' is not a snapshot of model '%s'", modelSnapshotHeader, override, model)
+}
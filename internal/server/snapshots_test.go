@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelSnapshots(t *testing.T) {
+	var upstreamModel string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(data, &body)
+		upstreamModel, _ = body["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	s := NewServer(&config.Config{
+		BaseURL:        mockUpstream.URL,
+		ModelSnapshots: map[string]string{"glm-4.7": "glm-4.7-251222"},
+	}, "127.0.0.1", 0)
+	post := func(model, snapshot string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if snapshot != "" {
+			req.Header.Set(modelSnapshotHeader, snapshot)
+		}
+		upstreamModel = ""
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A pinned model is sent as its snapshot, and the response says which one served it
+	w := post("GLM-4.7", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glm-4.7-251222", upstreamModel)
+	assert.Equal(t, "glm-4.7-251222", w.Header().Get(modelSnapshotHeader))
+
+	// Unpinned models go out as they are
+	w = post("GLM-4.7-Flash", "")
+	assert.Equal(t, "glm-4.7-flash", upstreamModel)
+	assert.Equal(t, "glm-4.7-flash", w.Header().Get(modelSnapshotHeader))
+
+	// The header overrides the pin, or lifts it
+	w = post("glm-4.7", "glm-4.7-260115")
+	assert.Equal(t, "glm-4.7-260115", upstreamModel)
+	assert.Equal(t, "glm-4.7-260115", w.Header().Get(modelSnapshotHeader))
+	post("glm-4.7", "latest")
+	assert.Equal(t, "glm-4.7", upstreamModel)
+
+	// Overrides cannot switch to another model
+	w = post("glm-4.7", "glm-4.7-flashx")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, upstreamModel)
+
+	// The model list shows the pins
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/glm-4.7", nil))
+	assert.Contains(t, w.Body.String(), `"snapshot":"glm-4.7-251222"`)
+}
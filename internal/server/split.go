@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/chew-z/copilot-proxy/internal/sse"
+)
+
+// streamChannel maps a delta field to the SSE event type it is delivered on when splitting
+type streamChannel struct {
+	event string
+	field string
+}
+
+// splitChannels are emitted in this order when one chunk carries several of them
+var splitChannels = []streamChannel{
+	{event: "reasoning", field: "reasoning_content"},
+	{event: "content", field: "content"},
+	{event: "tool_call", field: "tool_calls"},
+}
+
+// splitChunk turns a stream chunk into one named SSE event per channel it carries. The role is
+// kept on the first event and finish_reason and usage on the last; chunks with no channel
+// (role-only, finish or usage chunks) are sent as a single unnamed event.
+func splitChunk(ev sse.Event, chunk map[string]any) ([]sse.Event, error) {
+	choices, _ := chunk["choices"].([]any)
+
+	var present []streamChannel
+	for _, ch := range splitChannels {
+		for _, c := range choices {
+			if hasChannel(c, ch.field) {
+				present = append(present, ch)
+				break
+			}
+		}
+	}
+
+	if len(present) == 0 {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, err
+		}
+		ev.Data = string(data)
+		return []sse.Event{ev}, nil
+	}
+
+	events := make([]sse.Event, 0, len(present))
+	for i, ch := range present {
+		first, last := i == 0, i == len(present)-1
+
+		part := make(map[string]any, len(chunk))
+		for k, v := range chunk {
+			if k != "usage" || last {
+				part[k] = v
+			}
+		}
+
+		var partChoices []any
+		for _, c := range choices {
+			choice, _ := c.(map[string]any)
+			if choice == nil {
+				continue
+			}
+			has := hasChannel(choice, ch.field)
+			if !has && !(last && choice["finish_reason"] != nil) {
+				continue
+			}
+
+			delta, _ := choice["delta"].(map[string]any)
+			partDelta := map[string]any{}
+			if has {
+				partDelta[ch.field] = delta[ch.field]
+			}
+			if role, ok := delta["role"]; ok && first {
+				partDelta["role"] = role
+			}
+
+			partChoice := make(map[string]any, len(choice))
+			for k, v := range choice {
+				partChoice[k] = v
+			}
+			partChoice["delta"] = partDelta
+			if !last {
+				partChoice["finish_reason"] = nil
+			}
+			partChoices = append(partChoices, partChoice)
+		}
+		part["choices"] = partChoices
+
+		data, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, sse.Event{Event: ch.event, ID: ev.ID, Data: string(data)})
+	}
+	return events, nil
+}
+
+// hasChannel reports whether a choice's delta carries a non-empty value for field
+func hasChannel(choice any, field string) bool {
+	c, _ := choice.(map[string]any)
+	delta, _ := c["delta"].(map[string]any)
+	switch v := delta[field].(type) {
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	default:
+		return false
+	}
+}
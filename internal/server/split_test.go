@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvents parses an SSE body into events
+func readEvents(t *testing.T, body string) []sse.Event {
+	t.Helper()
+	var events []sse.Event
+	r := sse.NewReader(strings.NewReader(body))
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			break
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestSplitChunk(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []sse.Event
+	}{
+		{
+			name:     "Reasoning",
+			data:     `{"choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"hmm"}}]}`,
+			expected: []sse.Event{{Event: "reasoning", Data: `{"choices":[{"delta":{"reasoning_content":"hmm","role":"assistant"},"index":0}]}`}},
+		},
+		{
+			name: "Content And Finish",
+			data: `{"choices":[{"index":0,"delta":{"reasoning_content":"a","content":"b"},"finish_reason":"stop"}],"usage":{"total_tokens":3}}`,
+			expected: []sse.Event{
+				{Event: "reasoning", Data: `{"choices":[{"delta":{"reasoning_content":"a"},"finish_reason":null,"index":0}]}`},
+				{Event: "content", Data: `{"choices":[{"delta":{"content":"b"},"finish_reason":"stop","index":0}],"usage":{"total_tokens":3}}`},
+			},
+		},
+		{
+			name:     "Tool Call",
+			data:     `{"choices":[{"index":0,"delta":{"content":"","tool_calls":[{"index":0,"function":{"name":"f"}}]}}]}`,
+			expected: []sse.Event{{Event: "tool_call", Data: `{"choices":[{"delta":{"tool_calls":[{"function":{"name":"f"},"index":0}]},"index":0}]}`}},
+		},
+		{
+			name:     "No Channel",
+			data:     `{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			expected: []sse.Event{{Data: `{"choices":[{"delta":{},"finish_reason":"stop","index":0}]}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := sse.Event{Data: tt.data}
+			var chunk map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tt.data), &chunk))
+
+			events, err := splitChunk(ev, chunk)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, events)
+		})
+	}
+}
+
+func TestChatCompletions_SplitStream(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"think\"}}]}\n\n" +
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"answer\"}}]}\n\n" +
+			"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer mockUpstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		BaseURL:  mockUpstream.URL,
+		Profiles: map[string]config.ProfileConfig{"ui": {SplitStream: true}},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	send := func(profile string) []sse.Event {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if profile != "" {
+			req.Header.Set(profileHeader, profile)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return readEvents(t, w.Body.String())
+	}
+
+	names := func(events []sse.Event) []string {
+		var out []string
+		for _, ev := range events {
+			out = append(out, ev.Event)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"reasoning", "content", "", ""}, names(send("UI")))
+	assert.Equal(t, []string{"", "", "", ""}, names(send("")))
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+)
+
+// rawErrorLimit caps how much of a failed stream's upstream payload is logged
+const rawErrorLimit = 8 * 1024
+
+// sseFields are the field names that may start a line of an event stream
+var sseFields = []string{"data", "event", "id", "retry"}
+
+// streamErrorGuard relays an upstream event stream event by event, ending it cleanly when the
+// upstream reports an error inside it (an error object in a data frame, or an "error" event) or
+// switches to something that is not an event stream, such as a proxy's HTML error page. The
+// failure is replaced by one error chunk in the OpenAI shape and the [DONE] sentinel; the
+// dialect writers translate that chunk for Anthropic and Ollama clients like any error chunk.
+type streamErrorGuard struct {
+	lines     *bufio.Reader
+	event     bytes.Buffer // Lines of the event being read
+	pending   bytes.Buffer // Relayed output not yet read
+	done      bool
+	err       error // Read error returned once pending output is drained
+	requestID string
+	model     string
+	failures  *metrics.Counter
+}
+
+// newStreamErrorGuard wraps a successful upstream event stream
+func newStreamErrorGuard(body io.Reader, requestID, model string, failures *metrics.Counter) *streamErrorGuard {
+	return &streamErrorGuard{
+		lines:     bufio.NewReaderSize(body, 32*1024),
+		requestID: requestID,
+		model:     model,
+		failures:  failures,
+	}
+}
+
+// Read implements io.Reader
+func (g *streamErrorGuard) Read(p []byte) (int, error) {
+	for g.pending.Len() == 0 && !g.done {
+		g.fill()
+	}
+	if g.pending.Len() > 0 {
+		return g.pending.Read(p)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return 0, io.EOF
+}
+
+// fill reads one line of the stream, relaying the event it completes
+func (g *streamErrorGuard) fill() {
+	line, err := g.lines.ReadBytes('\n')
+	if len(line) > 0 {
+		text := strings.TrimRight(string(line), "\r\n")
+		switch {
+		case text == "":
+			g.event.Write(line)
+			g.relayEvent()
+		case isSSELine(text):
+			g.event.Write(line)
+		default:
+			g.garbage(line)
+			return
+		}
+	}
+	if err != nil {
+		if g.event.Len() > 0 {
+			g.relayEvent()
+		}
+		g.done = true
+		if !errors.Is(err, io.EOF) {
+			g.err = err
+		}
+	}
+}
+
+// isSSELine reports whether a non-blank line is a comment or a known field
+func isSSELine(line string) bool {
+	if strings.HasPrefix(line, ":") {
+		return true
+	}
+	field, _, _ := strings.Cut(line, ":")
+	for _, f := range sseFields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
+
+// relayEvent passes the buffered event on, unless it carries an error
+func (g *streamErrorGuard) relayEvent() {
+	raw := bytes.Clone(g.event.Bytes())
+	g.event.Reset()
+	ev, err := sse.NewReader(bytes.NewReader(raw)).Next()
+	if err != nil {
+		g.pending.Write(raw)
+		return
+	}
+	if msg, code, ok := eventError(ev); ok {
+		g.fail("error_event", msg, code, raw)
+		return
+	}
+	g.pending.Write(raw)
+}
+
+// eventError extracts the error an event reports, if any. Chunks that carry choices are
+// regular output whatever else they hold.
+func eventError(ev sse.Event) (msg string, code any, ok bool) {
+	var chunk map[string]any
+	decoded := json.Unmarshal([]byte(ev.Data), &chunk) == nil
+	if ev.Event == "error" {
+		if decoded && chunk["error"] != nil {
+			return errorText(chunk["error"]), errorCode(chunk["error"]), true
+		}
+		return cmp.Or(strings.TrimSpace(ev.Data), "upstream reported an error"), nil, true
+	}
+	if !decoded || chunk["error"] == nil || chunk["choices"] != nil {
+		return "", nil, false
+	}
+	return errorText(chunk["error"]), errorCode(chunk["error"]), true
+}
+
+// errorCode returns the code of an error object, if it has one
+func errorCode(e any) any {
+	if obj, ok := e.(map[string]any); ok {
+		return obj["code"]
+	}
+	return nil
+}
+
+// garbage ends the stream at a line that does not belong in an event stream
+func (g *streamErrorGuard) garbage(line []byte) {
+	raw := append(g.event.Bytes(), line...)
+	g.event.Reset()
+	rest, _ := io.ReadAll(io.LimitReader(g.lines, rawErrorLimit))
+	raw = append(raw, rest...)
+	reason := "not_sse"
+	if bytes.HasPrefix(bytes.TrimSpace(line), []byte("<")) {
+		reason = "html"
+	}
+	g.fail(reason, "upstream stream was interrupted by a response that is not an event stream: "+snippet(raw), nil, raw)
+}
+
+// fail replaces the rest of the stream with an error chunk and the end-of-stream sentinel
+func (g *streamErrorGuard) fail(reason, msg string, code any, raw []byte) {
+	g.done = true
+	g.failures.Inc(g.model, reason)
+	if len(raw) > rawErrorLimit {
+		raw = raw[:rawErrorLimit]
+	}
+	slog.Warn("Upstream stream failed", "request_id", g.requestID, "model", g.model, "reason", reason,
+		"message", msg, "payload", string(raw))
+
+	data, _ := json.Marshal(map[string]any{"error": map[string]any{
+		"message": msg,
+		"type":    "upstream_error",
+		"code":    code,
+	}})
+	sse.Write(&g.pending, sse.Event{Data: string(data)})
+	sse.Write(&g.pending, sse.Event{Data: sse.DoneData})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const okChunk = "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n"
+
+func TestStreamErrorGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		want     []string
+		reason   string
+	}{
+		{
+			name:     "clean stream",
+			upstream: ": keepalive\n\n" + okChunk + "data: [DONE]\n\n",
+			want:     []string{": keepalive\n\n" + okChunk + "data: [DONE]\n\n"},
+		},
+		{
+			name:     "error object in a data frame",
+			upstream: okChunk + "data: {\"error\":{\"code\":\"1305\",\"message\":\"Service overloaded\"}}\n\n" + okChunk,
+			want:     []string{okChunk, `"message":"Service overloaded"`, `"code":"1305"`, `"type":"upstream_error"`, "data: [DONE]\n\n"},
+			reason:   "error_event",
+		},
+		{
+			name:     "error event",
+			upstream: okChunk + "event: error\ndata: rate limited\n\n",
+			want:     []string{okChunk, `"message":"rate limited"`, "data: [DONE]\n\n"},
+			reason:   "error_event",
+		},
+		{
+			name:     "html page mid-stream",
+			upstream: okChunk + "<html>\r\n<body>502 Bad Gateway</body>\r\n</html>\r\n",
+			want:     []string{okChunk, "not an event stream: \\u003chtml\\u003e \\u003cbody\\u003e502 Bad Gateway", "data: [DONE]\n\n"},
+			reason:   "html",
+		},
+		{
+			name:     "unterminated last event",
+			upstream: okChunk + "data: {\"error\":\"cut\"}",
+			want:     []string{okChunk, `"message":"cut"`},
+			reason:   "error_event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := metrics.NewRegistry()
+			failures := registry.Counter("failures", "", "model", "reason")
+			out, err := io.ReadAll(newStreamErrorGuard(strings.NewReader(tt.upstream), "req_1", "glm-4.7", failures))
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, string(out), want)
+			}
+			if tt.reason != "" {
+				// Nothing after the failure is relayed
+				assert.Equal(t, 1, strings.Count(string(out), okChunk))
+				assert.True(t, strings.HasSuffix(string(out), "data: [DONE]\n\n"))
+			}
+
+			var metricsText strings.Builder
+			registry.WriteText(&metricsText)
+			if tt.reason != "" {
+				assert.Contains(t, metricsText.String(), `failures{model="glm-4.7",reason="`+tt.reason+`"} 1`)
+			} else {
+				assert.NotContains(t, metricsText.String(), "failures{")
+			}
+		})
+	}
+}
+
+func TestStreamErrors_Dialects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(okChunk + "data: {\"error\":{\"message\":\"Service overloaded\"}}\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Anthropic: config.AnthropicConfig{Model: "GLM-4.7"}}, "127.0.0.1", 0)
+	post := func(path, body string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	openAI := post("/v1/chat/completions", `{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Contains(t, openAI, `data: {"error":{"code":null,"message":"Service overloaded","type":"upstream_error"}}`)
+	assert.True(t, strings.HasSuffix(openAI, "data: [DONE]\n\n"))
+
+	anthropic := post("/v1/messages", `{"model": "claude-sonnet-4", "max_tokens": 100, "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Contains(t, anthropic, "event: error\n")
+	assert.Contains(t, anthropic, "Service overloaded")
+
+	ollama := post("/api/chat", `{"model": "glm-4.7", "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Contains(t, ollama, `{"error":"Service overloaded"}`)
+}
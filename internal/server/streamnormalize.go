@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+)
+
+// Repairs a normalized stream may need, the repair label of copilot_proxy_stream_repairs_total
+const (
+	repairMissingDone   = "missing_done"    // The stream ended without [DONE]
+	repairJoinedChunks  = "joined_chunks"   // One event held several JSON chunks
+	repairInvalidChunk  = "invalid_chunk"   // Data that is not JSON was dropped
+	repairChunkFields   = "chunk_fields"    // A chunk lacked id, object, created, model or a choice index
+	repairToolCallIndex = "tool_call_index" // A tool call delta lacked its index
+)
+
+// streamHook sees each chunk of a normalized stream, after repairs, so features that rewrite
+// or accumulate chunks do not each parse the stream themselves
+type streamHook interface {
+	// Chunk may change the chunk, reporting whether it did and whether to keep it
+	Chunk(chunk map[string]any) (changed, keep bool)
+	// End returns chunks to send before [DONE]
+	End() []map[string]any
+}
+
+// streamNormalizer relays a successful OpenAI-style event stream event by event, so everything
+// after it can rely on well-formed chunks: lines are parsed as SSE, several JSON objects in one
+// event are split, data that is not JSON is dropped, chunks that lack the id, object, created
+// or model of earlier chunks get them, and the stream ends with exactly one [DONE]. Events
+// that need no repair keep their data as sent.
+type streamNormalizer struct {
+	events  *sse.Reader
+	pending bytes.Buffer // Relayed output not yet read
+	done    bool
+	err     error // Read error returned once pending output is drained
+	hooks   []streamHook
+
+	// Taken from the first chunk that has them, for chunks that do not
+	id      any
+	object  any
+	created any
+	model   any
+
+	requestID string
+	upstream  string // Model label of the metric
+	repairs   *metrics.Counter
+}
+
+// newStreamNormalizer wraps a successful upstream event stream
+func newStreamNormalizer(body io.Reader, requestID, model string, repairs *metrics.Counter, hooks ...streamHook) *streamNormalizer {
+	return &streamNormalizer{
+		events:    sse.NewReader(body),
+		hooks:     hooks,
+		requestID: requestID,
+		upstream:  model,
+		repairs:   repairs,
+	}
+}
+
+// Read implements io.Reader
+func (n *streamNormalizer) Read(p []byte) (int, error) {
+	for n.pending.Len() == 0 && !n.done {
+		n.fill()
+	}
+	if n.pending.Len() > 0 {
+		return n.pending.Read(p)
+	}
+	if n.err != nil {
+		return 0, n.err
+	}
+	return 0, io.EOF
+}
+
+// fill relays the next upstream event
+func (n *streamNormalizer) fill() {
+	ev, err := n.events.Next()
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			n.err = err
+		}
+		n.repair(repairMissingDone)
+		n.finish()
+		return
+	}
+
+	switch {
+	case ev.IsDone():
+		// Anything upstream sends after [DONE] is not read
+		n.finish()
+	case ev.Data == "":
+		// Comments such as keepalives, and events without data
+		sse.Write(&n.pending, ev)
+	default:
+		n.relay(ev)
+	}
+}
+
+// relay passes on the chunks of a data event, repaired as needed
+func (n *streamNormalizer) relay(ev sse.Event) {
+	chunks, joined, err := decodeChunks(ev.Data)
+	if err != nil {
+		n.repair(repairInvalidChunk)
+		slog.Warn("Dropped a malformed stream chunk", "request_id", n.requestID, "model", n.upstream, "bytes", len(ev.Data))
+		return
+	}
+	if joined {
+		n.repair(repairJoinedChunks)
+	}
+
+	for i, chunk := range chunks {
+		changed := joined
+		if n.fillFields(chunk) {
+			n.repair(repairChunkFields)
+			changed = true
+		}
+		keep := true
+		for _, h := range n.hooks {
+			c, k := h.Chunk(chunk)
+			changed = changed || c
+			if keep = k; !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+
+		out := ev
+		if i > 0 {
+			// Only the first part keeps a comment the event carried
+			out.Comment = ""
+		}
+		if changed {
+			data, err := json.Marshal(chunk)
+			if err != nil {
+				continue
+			}
+			out.Data = string(data)
+		}
+		sse.Write(&n.pending, out)
+	}
+}
+
+// finish ends the stream with the hooks' final chunks and one [DONE]
+func (n *streamNormalizer) finish() {
+	for _, h := range n.hooks {
+		for _, chunk := range h.End() {
+			n.fillFields(chunk)
+			if data, err := json.Marshal(chunk); err == nil {
+				sse.Write(&n.pending, sse.Event{Data: string(data)})
+			}
+		}
+	}
+	sse.Write(&n.pending, sse.Event{Data: sse.DoneData})
+	n.done = true
+}
+
+// fillFields gives a chunk the id, object, created and model earlier chunks had, and its choices
+// an index, when it lacks them, reporting whether anything was missing. Error chunks are left
+// as they are.
+func (n *streamNormalizer) fillFields(chunk map[string]any) bool {
+	if chunk["error"] != nil && chunk["choices"] == nil {
+		return false
+	}
+	changed := false
+	for key, value := range map[string]*any{"id": &n.id, "object": &n.object, "created": &n.created, "model": &n.model} {
+		if v, ok := chunk[key]; ok && v != nil {
+			if *value == nil {
+				*value = v
+			}
+		} else if *value != nil {
+			chunk[key] = *value
+			changed = true
+		}
+	}
+	choices, _ := chunk["choices"].([]any)
+	for i, c := range choices {
+		if choice, ok := c.(map[string]any); ok && choice["index"] == nil {
+			choice["index"] = i
+			changed = true
+		}
+	}
+	return changed
+}
+
+// repair counts a repair of the stream
+func (n *streamNormalizer) repair(kind string) {
+	if n.repairs != nil {
+		n.repairs.Inc(n.upstream, kind)
+	}
+}
+
+// decodeChunks decodes the JSON objects of an event's data, reporting whether there were
+// several. Data that is not entirely JSON objects is an error.
+func decodeChunks(data string) ([]map[string]any, bool, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	var chunks []map[string]any
+	for {
+		var chunk map[string]any
+		err := dec.Decode(&chunk)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if chunk == nil {
+			return nil, false, errors.New("not a JSON object")
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		return nil, false, errors.New("no JSON object")
+	}
+	return chunks, len(chunks) > 1, nil
+}
+
+// toolCallRepair gives tool call deltas the index that some upstreams leave out of them. A
+// delta with an id starts a new call; one without continues the last call of its choice.
+type toolCallRepair struct {
+	calls  map[int]int       // Calls started per choice index
+	repair func(kind string) // Counts repairs
+}
+
+// newToolCallRepair creates the hook, counting repairs with repair
+func newToolCallRepair(repair func(kind string)) *toolCallRepair {
+	return &toolCallRepair{calls: make(map[int]int), repair: repair}
+}
+
+// Chunk implements streamHook
+func (r *toolCallRepair) Chunk(chunk map[string]any) (bool, bool) {
+	changed := false
+	choices, _ := chunk["choices"].([]any)
+	for _, c := range choices {
+		choice, _ := c.(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		calls, _ := delta["tool_calls"].([]any)
+		idx := jsonInt(choice["index"])
+		for _, tc := range calls {
+			call, ok := tc.(map[string]any)
+			if !ok {
+				continue
+			}
+			if index, ok := call["index"].(float64); ok {
+				r.calls[idx] = max(r.calls[idx], int(index)+1)
+				continue
+			}
+			if id, _ := call["id"].(string); id != "" || r.calls[idx] == 0 {
+				r.calls[idx]++
+			}
+			call["index"] = r.calls[idx] - 1
+			changed = true
+		}
+	}
+	if changed {
+		r.repair(repairToolCallIndex)
+	}
+	return changed, true
+}
+
+// jsonInt returns a decoded JSON number, or an int set since, as an int
+func jsonInt(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// End implements streamHook
+func (r *toolCallRepair) End() []map[string]any { return nil }
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHook drops chunks without choices and ends the stream with a count of the others
+type countingHook struct{ n int }
+
+func (h *countingHook) Chunk(chunk map[string]any) (bool, bool) {
+	if choices, _ := chunk["choices"].([]any); len(choices) == 0 {
+		return false, false
+	}
+	h.n++
+	return false, true
+}
+
+func (h *countingHook) End() []map[string]any {
+	return []map[string]any{{"choices": []any{}, "count": h.n}}
+}
+
+func TestStreamNormalizer(t *testing.T) {
+	registry := metrics.NewRegistry()
+	repairs := registry.Counter("repairs", "", "model", "repair")
+	normalize := func(upstream string, hooks ...streamHook) string {
+		out, err := io.ReadAll(newStreamNormalizer(strings.NewReader(upstream), "r1", "glm-4.7", repairs, hooks...))
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	// Well-formed streams pass through as sent
+	upstream := ": keepalive\n\n" + okChunk + "data: [DONE]\n\n"
+	assert.Equal(t, upstream, normalize(upstream))
+
+	// Repairs: CRLF and missing spaces, joined chunks, missing fields, garbage and a missing [DONE]
+	upstream = "data:{\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"glm-4.7\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"A\"}}]}\r\n\r\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"B\"}}]}{\"choices\":[{\"index\":0,\"delta\":{\"content\":\"C\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"del\n\n" +
+		"data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"glm-4.7\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"
+	assert.Equal(t, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"glm-4.7\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"A\"}}]}\n\n"+
+		"data: {\"choices\":[{\"delta\":{\"content\":\"B\"},\"index\":0}],\"id\":\"c1\",\"model\":\"glm-4.7\",\"object\":\"chat.completion.chunk\"}\n\n"+
+		"data: {\"choices\":[{\"delta\":{\"content\":\"C\"},\"index\":0}],\"id\":\"c1\",\"model\":\"glm-4.7\",\"object\":\"chat.completion.chunk\"}\n\n"+
+		"data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"glm-4.7\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"+
+		"data: [DONE]\n\n", normalize(upstream))
+
+	// Nothing after [DONE] is relayed
+	assert.Equal(t, okChunk+"data: [DONE]\n\n", normalize(okChunk+"data: [DONE]\n\n"+okChunk+"data: [DONE]\n\n"))
+
+	// Hooks may drop chunks and add their own before [DONE]
+	upstream = okChunk + "data: {\"id\":\"c1\",\"choices\":[],\"usage\":{\"total_tokens\":3}}\n\n" + okChunk + "data: [DONE]\n\n"
+	assert.Equal(t, okChunk+okChunk+"data: {\"choices\":[],\"count\":2,\"id\":\"c1\"}\n\ndata: [DONE]\n\n", normalize(upstream, &countingHook{}))
+
+	var metricsText strings.Builder
+	registry.WriteText(&metricsText)
+	for _, repair := range []string{`repair="chunk_fields"} 2`, `repair="joined_chunks"} 1`, `repair="invalid_chunk"} 1`, `repair="missing_done"} 1`} {
+		assert.Contains(t, metricsText.String(), `repairs{model="glm-4.7",`+repair)
+	}
+}
+
+func TestToolCallRepair(t *testing.T) {
+	var repairs []string
+	hook := newToolCallRepair(func(kind string) { repairs = append(repairs, kind) })
+	call := func(fields map[string]any) map[string]any {
+		return map[string]any{"choices": []any{map[string]any{"index": 0.0, "delta": map[string]any{"tool_calls": []any{fields}}}}}
+	}
+	index := func(chunk map[string]any) any {
+		return chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)["index"]
+	}
+
+	// A call with an id starts a new index; fragments without one continue it
+	chunks := []map[string]any{
+		call(map[string]any{"id": "a", "function": map[string]any{"name": "read"}}),
+		call(map[string]any{"function": map[string]any{"arguments": "{}"}}),
+		call(map[string]any{"id": "b", "function": map[string]any{"name": "write"}}),
+	}
+	for _, chunk := range chunks {
+		changed, keep := hook.Chunk(chunk)
+		assert.True(t, changed)
+		assert.True(t, keep)
+	}
+	assert.Equal(t, []any{0, 0, 1}, []any{index(chunks[0]), index(chunks[1]), index(chunks[2])})
+	assert.Equal(t, []string{repairToolCallIndex, repairToolCallIndex, repairToolCallIndex}, repairs)
+
+	// Indexes upstream sends are kept and counted
+	indexed := call(map[string]any{"index": 4.0, "id": "c"})
+	changed, _ := hook.Chunk(indexed)
+	assert.False(t, changed)
+	next := call(map[string]any{"id": "d"})
+	hook.Chunk(next)
+	assert.Equal(t, 5, index(next))
+}
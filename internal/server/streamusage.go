@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/chew-z/copilot-proxy/internal/tokens"
+)
+
+// includeUsage reports whether a chat body asks for a usage chunk at the end of its stream
+func includeUsage(bodyMap map[string]any) bool {
+	opts, _ := bodyMap["stream_options"].(map[string]any)
+	include, _ := opts["include_usage"].(bool)
+	return include
+}
+
+// streamUsage relays an event stream whose client set stream_options.include_usage. Upstream
+// normally ends such a stream with a chunk reporting usage; when it does not, a chunk with
+// estimated counts is inserted before [DONE] so the client's billing and telemetry still get
+// one. The prompt is estimated from the request and the completion from the text streamed.
+type streamUsage struct {
+	lines    *bufio.Reader
+	event    bytes.Buffer // Lines of the event being read
+	pending  bytes.Buffer // Relayed output not yet read
+	done     bool
+	err      error // Read error returned once pending output is drained
+	reported bool  // Upstream sent usage
+
+	prompt     int             // Estimated prompt tokens
+	completion strings.Builder // Generated text: content, reasoning and tool call arguments
+	id         string
+	model      string
+	created    any
+
+	requestID string
+	estimated *metrics.Counter
+}
+
+// newStreamUsage wraps a successful event stream for a request of an estimated prompt size
+func newStreamUsage(body io.Reader, prompt int, requestID, model string, estimated *metrics.Counter) *streamUsage {
+	return &streamUsage{
+		lines:     bufio.NewReaderSize(body, 32*1024),
+		prompt:    prompt,
+		model:     model,
+		requestID: requestID,
+		estimated: estimated,
+	}
+}
+
+// Read implements io.Reader
+func (u *streamUsage) Read(p []byte) (int, error) {
+	for u.pending.Len() == 0 && !u.done {
+		u.fill()
+	}
+	if u.pending.Len() > 0 {
+		return u.pending.Read(p)
+	}
+	if u.err != nil {
+		return 0, u.err
+	}
+	return 0, io.EOF
+}
+
+// fill reads one line of the stream, relaying the event it completes
+func (u *streamUsage) fill() {
+	line, err := u.lines.ReadBytes('\n')
+	if len(line) > 0 {
+		u.event.Write(line)
+		if strings.TrimRight(string(line), "\r\n") == "" {
+			u.relayEvent()
+		}
+	}
+	if err != nil {
+		if u.event.Len() > 0 {
+			u.relayEvent()
+		}
+		u.done = true
+		if !errors.Is(err, io.EOF) {
+			u.err = err
+		}
+	}
+}
+
+// relayEvent passes the buffered event on, first inserting the usage chunk when the event is
+// [DONE] and upstream reported no usage
+func (u *streamUsage) relayEvent() {
+	raw := bytes.Clone(u.event.Bytes())
+	u.event.Reset()
+	ev, err := sse.NewReader(bytes.NewReader(raw)).Next()
+	if err == nil && ev.IsDone() && !u.reported {
+		u.inject()
+	} else if err == nil && ev.Data != "" {
+		u.observe(ev.Data)
+	}
+	u.pending.Write(raw)
+}
+
+// observe notes a chunk's usage report and the text it adds to the completion
+func (u *streamUsage) observe(data string) {
+	var chunk struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Created any    `json:"created"`
+		Usage   any    `json:"usage"`
+		Choices []struct {
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return
+	}
+	if chunk.Usage != nil {
+		u.reported = true
+	}
+	if u.id == "" {
+		u.id, u.created = chunk.ID, chunk.Created
+		if chunk.Model != "" {
+			u.model = chunk.Model
+		}
+	}
+	for _, choice := range chunk.Choices {
+		u.completion.WriteString(choice.Delta.ReasoningContent)
+		u.completion.WriteString(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			u.completion.WriteString(call.Function.Name)
+			u.completion.WriteString(call.Function.Arguments)
+		}
+	}
+}
+
+// inject writes a final chunk reporting estimated usage, in the shape of OpenAI's usage chunk
+func (u *streamUsage) inject() {
+	completion := tokens.Text(u.completion.String())
+	usage := tokenUsage{PromptTokens: u.prompt, CompletionTokens: completion, TotalTokens: u.prompt + completion}
+	data, err := json.Marshal(map[string]any{
+		"id":      u.id,
+		"object":  "chat.completion.chunk",
+		"created": u.created,
+		"model":   u.model,
+		"choices": []any{},
+		"usage":   usage,
+	})
+	if err != nil {
+		return
+	}
+	u.reported = true
+	u.estimated.Inc(u.model)
+	slog.Debug("Estimated stream usage", "request_id", u.requestID, "model", u.model,
+		"prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+	sse.Write(&u.pending, sse.Event{Data: string(data)})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamUsage(t *testing.T) {
+	usageChunk := "data: {\"id\":\"c1\",\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":2,\"total_tokens\":11}}\n\n"
+	registry := metrics.NewRegistry()
+	estimated := registry.Counter("estimated", "", "model")
+
+	// Upstream usage passes through untouched
+	upstream := ": keepalive\n\n" + okChunk + usageChunk + "data: [DONE]\n\n"
+	out, err := io.ReadAll(newStreamUsage(strings.NewReader(upstream), 40, "r1", "glm-4.7", estimated))
+	require.NoError(t, err)
+	assert.Equal(t, upstream, string(out))
+
+	// A missing report is estimated and inserted before [DONE]
+	upstream = "data: {\"id\":\"c1\",\"created\":1700000000,\"model\":\"glm-4.7\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"Thinking it over\"}}]}\n\n" +
+		okChunk + "data: [DONE]\n\n"
+	out, err = io.ReadAll(newStreamUsage(strings.NewReader(upstream), 40, "r1", "glm-4.7", estimated))
+	require.NoError(t, err)
+	head, tail, ok := strings.Cut(string(out), okChunk)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(upstream, head))
+	data, done, ok := strings.Cut(strings.TrimPrefix(tail, "data: "), "\n\n")
+	require.True(t, ok, tail)
+	assert.Equal(t, "data: [DONE]\n\n", done)
+
+	var chunk struct {
+		ID      string     `json:"id"`
+		Created int64      `json:"created"`
+		Model   string     `json:"model"`
+		Choices []any      `json:"choices"`
+		Usage   tokenUsage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+	assert.Equal(t, "c1", chunk.ID)
+	assert.Equal(t, int64(1700000000), chunk.Created)
+	assert.NotNil(t, chunk.Choices)
+	assert.Empty(t, chunk.Choices)
+	assert.Equal(t, 40, chunk.Usage.PromptTokens)
+	assert.Positive(t, chunk.Usage.CompletionTokens)
+	assert.Equal(t, chunk.Usage.PromptTokens+chunk.Usage.CompletionTokens, chunk.Usage.TotalTokens)
+	var metricsText strings.Builder
+	registry.WriteText(&metricsText)
+	assert.Contains(t, metricsText.String(), `estimated{model="glm-4.7"} 1`)
+}
+
+func TestStreamUsage_Proxy(t *testing.T) {
+	var forwarded map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &forwarded)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(okChunk + "data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL}, "127.0.0.1", 0)
+	chat := func(options string) string {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true`+options+`, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// The option is forwarded, and the estimate is only added when it was asked for
+	assert.NotContains(t, chat(""), `"usage"`)
+	body := chat(`, "stream_options": {"include_usage": true}`)
+	assert.Equal(t, map[string]any{"include_usage": true}, forwarded["stream_options"])
+	assert.Contains(t, body, `"usage":{"prompt_tokens":`)
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"), body)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+)
+
+// thinkingTimeoutCode identifies the error chunk sent when reasoning is cut off
+const thinkingTimeoutCode = "thinking_timeout"
+
+// thinkingGuard wraps a streaming upstream body and cancels generation when the model has
+// reasoned for longer than the limit without producing answer tokens. The stream then either
+// continues with a fallback request made with thinking disabled or ends with an error chunk.
+type thinkingGuard struct {
+	src      io.ReadCloser
+	br       *bufio.Reader
+	cancel   context.CancelFunc                                // Cancels the guarded upstream request
+	fallback func() (io.ReadCloser, context.CancelFunc, error) // nil to end with an error chunk
+	limit    time.Duration
+	model    string
+	cutoffs  *metrics.Counter
+
+	timer    clock.Timer
+	timedOut atomic.Bool
+	answered bool
+	pending  []byte
+	done     bool
+}
+
+// newThinkingGuard starts the reasoning clock for a streaming response
+func newThinkingGuard(src io.ReadCloser, cancel context.CancelFunc, limit time.Duration, model string, registry *metrics.Registry, clk clock.Clock) *thinkingGuard {
+	g := &thinkingGuard{
+		src:    src,
+		br:     bufio.NewReaderSize(src, 32*1024),
+		cancel: cancel,
+		limit:  limit,
+		model:  model,
+		cutoffs: registry.Counter("copilot_proxy_thinking_cutoffs_total",
+			"Streams whose reasoning phase exceeded the configured maximum duration", "model", "action"),
+	}
+	g.timer = clk.AfterFunc(limit, func() {
+		g.timedOut.Store(true)
+		cancel()
+	})
+	return g
+}
+
+// Read implements io.Reader, passing the stream through line by line
+func (g *thinkingGuard) Read(p []byte) (int, error) {
+	for len(g.pending) == 0 {
+		if g.done {
+			return 0, io.EOF
+		}
+
+		line, err := g.br.ReadBytes('\n')
+		if len(line) > 0 && (err == nil || !g.timedOut.Load()) {
+			g.observe(line)
+			g.pending = line
+		}
+		if err == nil {
+			continue
+		}
+		if g.timedOut.Load() && !g.answered {
+			g.cutoff()
+			continue
+		}
+		if err == io.EOF {
+			g.done = true
+			continue
+		}
+		return 0, err
+	}
+
+	n := copy(p, g.pending)
+	g.pending = g.pending[n:]
+	return n, nil
+}
+
+// observe stops the clock once a line carries answer content or a tool call
+func (g *thinkingGuard) observe(line []byte) {
+	if g.answered {
+		return
+	}
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+
+	var chunk map[string]any
+	if json.Unmarshal(bytes.TrimSpace(data), &chunk) != nil {
+		return
+	}
+	choices, _ := chunk["choices"].([]any)
+	for _, c := range choices {
+		if hasChannel(c, "content") || hasChannel(c, "tool_calls") {
+			g.answered = true
+			g.timer.Stop()
+			return
+		}
+	}
+}
+
+// cutoff switches to the fallback stream, or queues an error chunk and the end of the stream
+func (g *thinkingGuard) cutoff() {
+	g.src.Close()
+	// Terminate any partially forwarded event before anything else is sent
+	g.pending = []byte("\n")
+
+	if g.fallback != nil {
+		src, cancel, err := g.fallback()
+		if err == nil {
+			slog.Warn("Reasoning exceeded limit, retrying without thinking", "model", g.model, "limit", g.limit)
+			g.cutoffs.Inc(g.model, "fallback")
+			g.src, g.br, g.cancel = src, bufio.NewReaderSize(src, 32*1024), cancel
+			g.answered = true
+			g.timedOut.Store(false)
+			return
+		}
+		slog.Error("Thinking-disabled fallback failed", "model", g.model, "error", err)
+	}
+
+	slog.Warn("Reasoning exceeded limit, stream aborted", "model", g.model, "limit", g.limit)
+	g.cutoffs.Inc(g.model, "error")
+
+	chunk, _ := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": fmt.Sprintf("model reasoned for more than %s without answering", g.limit),
+			"type":    "server_error",
+			"code":    thinkingTimeoutCode,
+		},
+	})
+	g.pending = append(g.pending, fmt.Sprintf("data: %s\n\ndata: [DONE]\n\n", chunk)...)
+	g.done = true
+}
+
+// Close stops the clock and releases the current upstream body
+func (g *thinkingGuard) Close() error {
+	g.timer.Stop()
+	g.cancel()
+	return g.src.Close()
+}
+
+// thinkingFallback returns a function that re-issues the request as a stream with thinking
+// disabled, for use once the original request has been cut off
+func (s *Server) thinkingFallback(ctx context.Context, target *upstream, bodyMap map[string]any) func() (io.ReadCloser, context.CancelFunc, error) {
+	return func() (io.ReadCloser, context.CancelFunc, error) {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		body := maps.Clone(bodyMap)
+		body["thinking"] = map[string]string{"type": "disabled"}
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fbCtx, cancel := context.WithCancel(ctx)
+		resp, err := target.do(fbCtx, s.client, data, nil)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		if resp.StatusCode >= 300 {
+			resp.Body.Close()
+			cancel()
+			return nil, nil, errors.New(resp.Status)
+		}
+		return resp.Body, cancel, nil
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatCompletions_ThinkingCutoff(t *testing.T) {
+	// Upstream reasons forever unless thinking is disabled
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		thinking, _ := body["thinking"].(map[string]any)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if thinking["type"] == "disabled" {
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"quick answer\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+
+		for {
+			if _, err := w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"hmm \"}}]}\n\n")); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer mockUpstream.Close()
+
+	tests := []struct {
+		name     string
+		fallback bool
+		contains []string
+	}{
+		{
+			name:     "Error Chunk",
+			fallback: false,
+			contains: []string{"hmm", `"code":"thinking_timeout"`, "data: [DONE]"},
+		},
+		{
+			name:     "Fallback Without Thinking",
+			fallback: true,
+			contains: []string{"hmm", "quick answer", "data: [DONE]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			cfg := &config.Config{
+				BaseURL:  mockUpstream.URL,
+				Thinking: config.ThinkingConfig{MaxDuration: 50 * time.Millisecond, Fallback: tt.fallback},
+			}
+			s := NewServer(cfg, "127.0.0.1", 0)
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions",
+				strings.NewReader(`{"model": "GLM-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			done := make(chan struct{})
+			go func() {
+				s.router.ServeHTTP(w, req)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream was not cut off")
+			}
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			for _, want := range tt.contains {
+				assert.Contains(t, w.Body.String(), want)
+			}
+			// Every event must still parse after the cutoff
+			for _, ev := range readEvents(t, w.Body.String()) {
+				if !ev.IsDone() {
+					assert.True(t, json.Valid([]byte(ev.Data)), "invalid event data %q", ev.Data)
+				}
+			}
+		})
+	}
+}
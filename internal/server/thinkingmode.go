@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// thinkingHeader lets a client switch reasoning on or off, or leave its body alone, per request
+const thinkingHeader = "X-Thinking"
+
+// Thinking modes decide what thinking-capable models are sent when a request does not choose
+const (
+	thinkingEnabled     = "enabled"
+	thinkingDisabled    = "disabled"
+	thinkingPassthrough = "passthrough" // The client's own thinking field, if any, goes upstream as is
+)
+
+// thinkingHeaderModes maps X-Thinking values to modes
+var thinkingHeaderModes = map[string]string{
+	"on": thinkingEnabled, "enabled": thinkingEnabled,
+	"off": thinkingDisabled, "disabled": thinkingDisabled,
+	"passthrough": thinkingPassthrough,
+}
+
+// ValidateThinking checks the configured thinking modes
+func ValidateThinking(cfg config.ThinkingConfig) error {
+	if !validThinkingMode(cfg.Mode) {
+		return fmt.Errorf("invalid mode '%s' (use enabled, disabled or passthrough)", cfg.Mode)
+	}
+	for model, mode := range cfg.Models {
+		if !models.IsValidModel(model) {
+			return fmt.Errorf("models: model '%s' not found", model)
+		}
+		if mode == "" || !validThinkingMode(mode) {
+			return fmt.Errorf("models.%s: invalid mode '%s' (use enabled, disabled or passthrough)", model, mode)
+		}
+	}
+	return nil
+}
+
+// validThinkingMode reports whether mode is a thinking mode or empty for the default
+func validThinkingMode(mode string) bool {
+	switch mode {
+	case "", thinkingEnabled, thinkingDisabled, thinkingPassthrough:
+		return true
+	}
+	return false
+}
+
+// defaultThinkingMode returns the configured mode of a model, per-model settings first
+func (s *Server) defaultThinkingMode(model string) string {
+	canonical := models.GetCanonicalModelName(model)
+	for key, mode := range s.config.Thinking.Models {
+		if models.GetCanonicalModelName(key) == canonical {
+			return mode
+		}
+	}
+	if s.config.Thinking.Mode != "" {
+		return s.config.Thinking.Mode
+	}
+	return thinkingEnabled
+}
+
+// thinkingMode returns the thinking mode of a chat request: the X-Thinking header, then a
+// thinking field the client set itself, then the model's configured default. Ollama's think
+// field still decides when the header is absent; the header replaces it.
+func (s *Server) thinkingMode(c *gin.Context, bodyMap map[string]any) string {
+	if value := c.GetHeader(thinkingHeader); value != "" {
+		delete(bodyMap, "think")
+		return thinkingHeaderModes[strings.ToLower(strings.TrimSpace(value))]
+	}
+	return s.bodyThinkingMode(bodyMap)
+}
+
+// bodyThinkingMode returns the thinking mode of a body: passthrough when it sets thinking
+// itself, else its model's default
+func (s *Server) bodyThinkingMode(bodyMap map[string]any) string {
+	if _, ok := bodyMap["thinking"]; ok {
+		return thinkingPassthrough
+	}
+	model, _ := bodyMap["model"].(string)
+	return s.defaultThinkingMode(model)
+}
+
+// validateThinkingHeader rejects X-Thinking values that name no mode
+func validateThinkingHeader(c *gin.Context) error {
+	value := c.GetHeader(thinkingHeader)
+	if value == "" {
+		return nil
+	}
+	if _, ok := thinkingHeaderModes[strings.ToLower(strings.TrimSpace(value))]; !ok {
+		return api.ErrBadRequest("invalid %s value '%s' (use on, off or passthrough)", thinkingHeader, value)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThinkingMode(t *testing.T) {
+	var upstream map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = nil
+		json.NewDecoder(r.Body).Decode(&upstream)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: mockUpstream.URL, Thinking: config.ThinkingConfig{
+		Mode:   thinkingDisabled,
+		Models: map[string]string{"GLM-4.6V": thinkingPassthrough},
+	}}, "127.0.0.1", 0)
+
+	tests := []struct {
+		name     string
+		model    string
+		fields   string // Extra body fields
+		header   string // X-Thinking
+		status   int
+		thinking any // Upstream thinking field; nil when absent
+	}{
+		{"configured mode", "glm-4.7", ``, "", http.StatusOK, map[string]any{"type": "disabled"}},
+		{"per-model passthrough", "glm-4.6v", ``, "", http.StatusOK, nil},
+		{"client thinking passes through", "glm-4.7", `, "thinking": {"type": "enabled", "budget": 1}`, "", http.StatusOK, map[string]any{"type": "enabled", "budget": 1.0}},
+		{"think field", "glm-4.7", `, "think": true`, "", http.StatusOK, map[string]any{"type": "enabled"}},
+		{"header on", "glm-4.7", ``, "on", http.StatusOK, map[string]any{"type": "enabled"}},
+		{"header beats think", "glm-4.7", `, "think": true`, "Off", http.StatusOK, map[string]any{"type": "disabled"}},
+		{"header beats client thinking", "glm-4.7", `, "thinking": {"type": "enabled"}`, "off", http.StatusOK, map[string]any{"type": "disabled"}},
+		{"header passthrough", "glm-4.7", ``, "passthrough", http.StatusOK, nil},
+		{"invalid header", "glm-4.7", ``, "maybe", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream = nil
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+tt.model+`"`+tt.fields+`, "messages": [{"role": "user", "content": "2+2?"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(thinkingHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status != http.StatusOK {
+				return
+			}
+			assert.NotContains(t, upstream, "think")
+			assert.Equal(t, tt.thinking, upstream["thinking"])
+		})
+	}
+
+	// Only models that reason by default are advertised as reasoning
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/capabilities", nil))
+	var caps capabilities
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &caps))
+	assert.Empty(t, caps.Thinking.Models)
+	assert.Contains(t, caps.Headers, thinkingHeader)
+}
+
+func TestValidateThinking(t *testing.T) {
+	assert.NoError(t, ValidateThinking(config.ThinkingConfig{Mode: "passthrough", Models: map[string]string{"glm-4.7": "enabled"}}))
+	assert.ErrorContains(t, ValidateThinking(config.ThinkingConfig{Mode: "auto"}), "invalid mode 'auto'")
+	assert.ErrorContains(t, ValidateThinking(config.ThinkingConfig{Models: map[string]string{"gpt-4": "enabled"}}), "model 'gpt-4' not found")
+	assert.ErrorContains(t, ValidateThinking(config.ThinkingConfig{Models: map[string]string{"glm-4.7": "off"}}), "models.glm-4.7: invalid mode 'off'")
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// throughputMeter times a streamed response body as it arrives from upstream
+type throughputMeter struct {
+	sent  time.Time // When the request was sent upstream
+	first time.Time
+	last  time.Time
+	bytes int64
+	clock clock.Clock
+}
+
+// newThroughputMeter starts timing a response to a request sent at sent
+func newThroughputMeter(sent time.Time) *throughputMeter {
+	return &throughputMeter{sent: sent, clock: clock.Real{}}
+}
+
+// Write implements io.Writer; it never fails so it cannot interrupt the response
+func (m *throughputMeter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	now := m.clock.Now()
+	if m.first.IsZero() {
+		m.first = now
+	}
+	m.last = now
+	m.bytes += int64(len(p))
+	return len(p), nil
+}
+
+// throughput describes how fast a stream was delivered. Generation is timed from the first
+// body byte to the last, so the wait for the first token does not dilute the rates.
+type throughput struct {
+	Bytes        int64
+	FirstByte    time.Duration // From sending the request to the first body byte
+	Duration     time.Duration // From the first body byte to the last
+	BytesPerSec  float64
+	TokensPerSec float64 // Completion tokens; zero when upstream reported no usage
+}
+
+// result summarizes the stream, or returns nil when no body arrived
+func (m *throughputMeter) result(completionTokens int) *throughput {
+	if m == nil || m.first.IsZero() {
+		return nil
+	}
+	t := &throughput{Bytes: m.bytes, FirstByte: m.first.Sub(m.sent), Duration: m.last.Sub(m.first)}
+	if secs := t.Duration.Seconds(); secs > 0 {
+		t.BytesPerSec = float64(t.Bytes) / secs
+		t.TokensPerSec = float64(completionTokens) / secs
+	}
+	return t
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputMeter(t *testing.T) {
+	sent := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := newThroughputMeter(sent)
+	clk := clock.NewFake(sent)
+	m.clock = clk
+
+	assert.Nil(t, m.result(0), "no body, no throughput")
+
+	clk.Advance(800 * time.Millisecond)
+	m.Write(make([]byte, 1000))
+	m.Write(nil)
+	clk.Advance(2 * time.Second)
+	m.Write(make([]byte, 3000))
+
+	tp := m.result(100)
+	assert.Equal(t, int64(4000), tp.Bytes)
+	assert.Equal(t, 800*time.Millisecond, tp.FirstByte)
+	assert.Equal(t, 2*time.Second, tp.Duration)
+	assert.Equal(t, 2000.0, tp.BytesPerSec)
+	assert.Equal(t, 50.0, tp.TokensPerSec)
+
+	// A body arriving at once has no measurable rate
+	single := newThroughputMeter(sent)
+	single.Write([]byte("data: [DONE]\n\n"))
+	tp = single.result(5)
+	assert.Zero(t, tp.Duration)
+	assert.Zero(t, tp.TokensPerSec)
+
+	var none *throughputMeter
+	assert.Nil(t, none.result(1))
+}
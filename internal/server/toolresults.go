@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/chew-z/copilot-proxy/internal/auth"
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// toolResultsHeader reports how many tool results were shortened before forwarding
+const toolResultsHeader = "X-Tool-Results-Limited"
+
+// summaryPrompt asks the summary model to condense an oversized tool result
+const summaryPrompt = `The following is the output of a tool call made by an AI agent. It is too long to pass on in full.
+Summarize it in at most %d characters, keeping every detail the agent is likely to need: identifiers, paths, numbers, errors and conclusions.
+
+%s`
+
+// limitToolResults shortens role:"tool" message content longer than the configured limit,
+// truncating it with a marker or summarizing it with a cheap model. It returns how many
+// results were changed. Summaries are charged to p, the client the request is for.
+func (s *Server) limitToolResults(ctx context.Context, p *auth.Principal, messages []any) int {
+	cfg := s.config.ToolResults
+	if cfg.MaxChars <= 0 {
+		return 0
+	}
+
+	limited := 0
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if msg["role"] != "tool" {
+			continue
+		}
+		switch content := msg["content"].(type) {
+		case string:
+			if short, ok := s.shortenToolResult(ctx, p, cfg, content); ok {
+				msg["content"] = short
+				limited++
+			}
+		case []any:
+			// Content parts: shorten each text part on its own
+			changed := false
+			for _, item := range content {
+				part, _ := item.(map[string]any)
+				text, isText := part["text"].(string)
+				if part["type"] != "text" || !isText {
+					continue
+				}
+				if short, ok := s.shortenToolResult(ctx, p, cfg, text); ok {
+					part["text"] = short
+					changed = true
+				}
+			}
+			if changed {
+				limited++
+			}
+		}
+	}
+	return limited
+}
+
+// shortenToolResult returns content within the limit, or false if it already fits
+func (s *Server) shortenToolResult(ctx context.Context, p *auth.Principal, cfg config.ToolResultsConfig, content string) (string, bool) {
+	runes := []rune(content)
+	if len(runes) <= cfg.MaxChars {
+		return content, false
+	}
+	if cfg.Mode == "summarize" {
+		summary, err := s.summarizeToolResult(ctx, p, cfg, content)
+		if err == nil {
+			return summary, true
+		}
+		slog.Warn("Tool result summary failed, truncating instead", "error", err)
+	}
+	return truncateToolResult(runes, cfg.MaxChars), true
+}
+
+// truncateToolResult keeps the head and tail of an oversized result around an explicit marker,
+// since errors and conclusions tend to be at the end
+func truncateToolResult(runes []rune, maxChars int) string {
+	marker := func(n int) string {
+		return fmt.Sprintf("\n\n[... %d characters truncated by copilot-proxy ...]\n\n", n)
+	}
+	// Size the kept text so the result including the marker fits the limit
+	keep := max(maxChars-len(marker(len(runes))), 0)
+	head := keep * 2 / 3
+	tail := keep - head
+	return string(runes[:head]) + marker(len(runes)-keep) + string(runes[len(runes)-tail:])
+}
+
+// summarizeToolResult condenses a tool result with the configured summary model
+func (s *Server) summarizeToolResult(ctx context.Context, p *auth.Principal, cfg config.ToolResultsConfig, content string) (string, error) {
+	bodyMap := map[string]any{
+		"model":  cfg.Model,
+		"stream": false,
+		"think":  false,
+		"messages": []any{map[string]any{
+			"role":    "user",
+			"content": fmt.Sprintf(summaryPrompt, cfg.MaxChars, content),
+		}},
+	}
+	raw, err := s.complete(ctx, p, bodyMap)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil || len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("unexpected summary response")
+	}
+	summary := []rune(resp.Choices[0].Message.Content)
+	if len(summary) > cfg.MaxChars {
+		return truncateToolResult(summary, cfg.MaxChars), nil
+	}
+	return "[Summarized by copilot-proxy from " + strconv.Itoa(len([]rune(content))) + " characters]\n" + string(summary), nil
+}
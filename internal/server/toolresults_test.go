@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateToolResult(t *testing.T) {
+	content := strings.Repeat("a", 500) + strings.Repeat("z", 500)
+	out := truncateToolResult([]rune(content), 200)
+
+	assert.LessOrEqual(t, len(out), 200)
+	assert.True(t, strings.HasPrefix(out, "aaa"))
+	assert.True(t, strings.HasSuffix(out, "zzz"))
+	assert.Contains(t, out, "characters truncated by copilot-proxy")
+}
+
+func TestChatCompletions_ToolResults(t *testing.T) {
+	var requests []map[string]any
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"short summary"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	long := strings.Repeat("x", 1000)
+	reqBody := `{"model": "GLM-4.7", "messages": [
+		{"role": "user", "content": "read the file"},
+		{"role": "assistant", "content": "", "tool_calls": [{"id": "1", "type": "function", "function": {"name": "read", "arguments": "{}"}}]},
+		{"role": "tool", "tool_call_id": "1", "content": "` + long + `"},
+		{"role": "tool", "tool_call_id": "2", "content": "fits"}
+	]}`
+
+	send := func(cfg config.ToolResultsConfig) (*httptest.ResponseRecorder, []any) {
+		requests = nil
+		s := NewServer(&config.Config{BaseURL: mockUpstream.URL, ToolResults: cfg}, "127.0.0.1", 0)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		messages, _ := requests[len(requests)-1]["messages"].([]any)
+		return w, messages
+	}
+	content := func(m any) string {
+		return m.(map[string]any)["content"].(string)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		w, messages := send(config.ToolResultsConfig{})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(toolResultsHeader))
+		assert.Equal(t, long, content(messages[2]))
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		w, messages := send(config.ToolResultsConfig{MaxChars: 200, Mode: "truncate"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get(toolResultsHeader))
+		assert.Len(t, requests, 1)
+		assert.Contains(t, content(messages[2]), "truncated by copilot-proxy")
+		assert.LessOrEqual(t, len(content(messages[2])), 200)
+		assert.Equal(t, "fits", content(messages[3]))
+	})
+
+	t.Run("Summarize", func(t *testing.T) {
+		w, messages := send(config.ToolResultsConfig{MaxChars: 200, Mode: "summarize", Model: "GLM-4.7-Flash"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get(toolResultsHeader))
+		assert.Len(t, requests, 2)
+		assert.Equal(t, "glm-4.7-flash", requests[0]["model"])
+		assert.Contains(t, content(messages[2]), "short summary")
+	})
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+)
+
+// Tool validation modes
+const (
+	toolValidationOff    = "off"    // Forward tools unchecked
+	toolValidationBasic  = "basic"  // Check structure, names and the top-level parameters object
+	toolValidationStrict = "strict" // Also check the parameter schema recursively
+)
+
+// toolNamePattern is OpenAI's constraint on function names
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// schemaTypes are the JSON Schema type names
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// validateTools checks client-supplied tool definitions so malformed ones are rejected with an
+// error naming the tool and field, instead of a generic upstream error
+func validateTools(v any, mode string) error {
+	if v == nil || mode == toolValidationOff {
+		return nil
+	}
+	tools, ok := v.([]any)
+	if !ok {
+		return api.ErrBadRequest("tools must be an array")
+	}
+
+	seen := make(map[string]int, len(tools))
+	for i, t := range tools {
+		tool, ok := t.(map[string]any)
+		if !ok {
+			return api.ErrBadRequest("tools[%d] must be an object", i)
+		}
+		if typ, _ := tool["type"].(string); typ != "function" {
+			return api.ErrBadRequest("tools[%d].type must be \"function\"", i)
+		}
+		fn, ok := tool["function"].(map[string]any)
+		if !ok {
+			return api.ErrBadRequest("tools[%d].function must be an object", i)
+		}
+
+		name, _ := fn["name"].(string)
+		if !toolNamePattern.MatchString(name) {
+			return api.ErrBadRequest("tools[%d].function.name %q must be 1-64 letters, digits, underscores or dashes", i, name)
+		}
+		if j, dup := seen[name]; dup {
+			return api.ErrBadRequest("tools[%d] (%s): name duplicates tools[%d]", i, name, j)
+		}
+		seen[name] = i
+
+		if desc, ok := fn["description"]; ok {
+			if _, isString := desc.(string); !isString {
+				return api.ErrBadRequest("tools[%d] (%s): function.description must be a string", i, name)
+			}
+		}
+
+		params, ok := fn["parameters"]
+		if !ok {
+			continue
+		}
+		schema, ok := params.(map[string]any)
+		if !ok {
+			return api.ErrBadRequest("tools[%d] (%s): function.parameters must be an object", i, name)
+		}
+		if typ, ok := schema["type"]; ok && typ != "object" {
+			return api.ErrBadRequest("tools[%d] (%s): function.parameters.type must be \"object\"", i, name)
+		}
+		if mode != toolValidationStrict {
+			continue
+		}
+		if err := checkSchema(schema, "function.parameters"); err != nil {
+			return api.ErrBadRequest("tools[%d] (%s): %v", i, name, err)
+		}
+	}
+	return nil
+}
+
+// checkSchema validates the parts of a JSON schema that models rely on: types, properties,
+// required names, array items and enums. path names the schema in errors.
+func checkSchema(schema map[string]any, path string) error {
+	switch typ := schema["type"].(type) {
+	case nil:
+	case string:
+		if !slices.Contains(schemaTypes, typ) {
+			return fmt.Errorf("%s.type: unknown type %q", path, typ)
+		}
+	case []any:
+		for _, t := range typ {
+			if s, _ := t.(string); !slices.Contains(schemaTypes, s) {
+				return fmt.Errorf("%s.type: unknown type %v", path, t)
+			}
+		}
+	default:
+		return fmt.Errorf("%s.type must be a string or an array of strings", path)
+	}
+
+	var props map[string]any
+	if p, ok := schema["properties"]; ok {
+		if props, ok = p.(map[string]any); !ok {
+			return fmt.Errorf("%s.properties must be an object", path)
+		}
+		for name, prop := range props {
+			sub, ok := prop.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s.properties.%s must be a schema object", path, name)
+			}
+			if err := checkSchema(sub, path+".properties."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r, ok := schema["required"]; ok {
+		required, ok := r.([]any)
+		if !ok {
+			return fmt.Errorf("%s.required must be an array", path)
+		}
+		for _, name := range required {
+			s, ok := name.(string)
+			if !ok {
+				return fmt.Errorf("%s.required entries must be strings", path)
+			}
+			if _, defined := props[s]; !defined {
+				return fmt.Errorf("%s.required: %q is not in properties", path, s)
+			}
+		}
+	}
+
+	if it, ok := schema["items"]; ok {
+		items, ok := it.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s.items must be a schema object", path)
+		}
+		if err := checkSchema(items, path+".items"); err != nil {
+			return err
+		}
+	}
+
+	if e, ok := schema["enum"]; ok {
+		if enum, ok := e.([]any); !ok || len(enum) == 0 {
+			return fmt.Errorf("%s.enum must be a non-empty array", path)
+		}
+	}
+	return nil
+}
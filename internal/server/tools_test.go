@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTools(t *testing.T) {
+	tests := []struct {
+		name   string
+		tools  string
+		mode   string
+		errMsg string // Empty when valid
+	}{
+		{"Valid", `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}}}]`, toolValidationStrict, ""},
+		{"No parameters", `[{"type":"function","function":{"name":"now"}}]`, toolValidationBasic, ""},
+		{"Not an array", `{"type":"function"}`, toolValidationBasic, "tools must be an array"},
+		{"Wrong type", `[{"type":"retrieval"}]`, toolValidationBasic, `tools[0].type must be "function"`},
+		{"Bad name", `[{"type":"function","function":{"name":"get weather"}}]`, toolValidationBasic, `tools[0].function.name "get weather"`},
+		{"Duplicate", `[{"type":"function","function":{"name":"a"}},{"type":"function","function":{"name":"a"}}]`, toolValidationBasic, "tools[1] (a): name duplicates tools[0]"},
+		{"Parameters type", `[{"type":"function","function":{"name":"a","parameters":{"type":"string"}}}]`, toolValidationBasic, `tools[0] (a): function.parameters.type must be "object"`},
+		{"Unknown type passes basic", `[{"type":"function","function":{"name":"a","parameters":{"type":"object","properties":{"city":{"type":"text"}}}}}]`, toolValidationBasic, ""},
+		{"Unknown type", `[{"type":"function","function":{"name":"a","parameters":{"type":"object","properties":{"city":{"type":"text"}}}}}]`, toolValidationStrict, `tools[0] (a): function.parameters.properties.city.type: unknown type "text"`},
+		{"Undefined required", `[{"type":"function","function":{"name":"a","parameters":{"type":"object","properties":{},"required":["city"]}}}]`, toolValidationStrict, `function.parameters.required: "city" is not in properties`},
+		{"Nested items", `[{"type":"function","function":{"name":"a","parameters":{"type":"object","properties":{"tags":{"type":"array","items":{"type":"str"}}}}}}]`, toolValidationStrict, "function.parameters.properties.tags.items.type"},
+		{"Empty enum", `[{"type":"function","function":{"name":"a","parameters":{"type":"object","properties":{"unit":{"type":"string","enum":[]}}}}}]`, toolValidationStrict, "properties.unit.enum must be a non-empty array"},
+		{"Off", `[{"type":"retrieval"}]`, toolValidationOff, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tools any
+			assert.NoError(t, json.Unmarshal([]byte(tt.tools), &tools))
+			err := validateTools(tools, tt.mode)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/trace"
+	"github.com/gin-gonic/gin"
+)
+
+// traceIDHeader tells the client which trace file holds its exchange
+const traceIDHeader = "X-Trace-Id"
+
+// tracer decides which requests are traced and writes their records
+type tracer struct {
+	recorder   *trace.Recorder
+	sampleRate float64
+	header     string
+	clock      clock.Clock
+}
+
+// newTracer creates the tracer, returning nil if the trace directory cannot be used
+func newTracer(cfg config.TraceConfig, clk clock.Clock) *tracer {
+	dir, err := cfg.DirPath()
+	if err != nil {
+		slog.Error("Tracing disabled", "error", err)
+		return nil
+	}
+
+	recorder, err := trace.New(dir, cfg.Retention, clk)
+	if err != nil {
+		slog.Error("Tracing disabled", "error", err)
+		return nil
+	}
+	slog.Info("Tracing enabled", "dir", dir, "sample_rate", cfg.SampleRate, "header", cfg.Header, "retention", cfg.Retention)
+	return &tracer{recorder: recorder, sampleRate: cfg.SampleRate, header: cfg.Header, clock: clk}
+}
+
+// start returns a record for the request if it is selected for tracing, or nil
+func (t *tracer) start(c *gin.Context, model string, body []byte) *trace.Record {
+	reason := ""
+	switch {
+	case t.header != "" && c.GetHeader(t.header) != "":
+		reason = "header"
+	case t.sampleRate > 0 && mathrand.Float64() < t.sampleRate:
+		reason = "sampled"
+	default:
+		return nil
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	rec := &trace.Record{
+		ID:      hex.EncodeToString(id),
+		Time:    t.clock.Now(),
+		Reason:  reason,
+		Path:    c.Request.URL.Path,
+		Model:   model,
+		Request: append([]byte(nil), body...),
+	}
+	if p := principalFrom(c); p != nil {
+		rec.Client = p.Name
+	}
+	c.Header(traceIDHeader, rec.ID)
+	return rec
+}
+
+// finish completes the record's timing and response and writes it
+func (t *tracer) finish(rec *trace.Record, capture *traceCapture) {
+	if capture != nil {
+		rec.Response = string(capture.buf.Bytes())
+		rec.ResponseTruncated = capture.buf.truncated
+		if !capture.first.IsZero() {
+			rec.Timing.FirstByteMS = millis(capture.first.Sub(rec.Time))
+		}
+	}
+	rec.Timing.TotalMS = millis(t.clock.Since(rec.Time))
+
+	if err := t.recorder.Write(rec); err != nil {
+		slog.Error("Failed to write trace", "id", rec.ID, "error", err)
+		return
+	}
+	slog.Debug("Trace recorded", "id", rec.ID, "reason", rec.Reason)
+}
+
+// traceCapture records a traced response body and when its first byte arrived
+type traceCapture struct {
+	buf   captureBuffer
+	first time.Time
+	clock clock.Clock
+}
+
+// Write implements io.Writer
+func (tc *traceCapture) Write(p []byte) (int, error) {
+	if tc.first.IsZero() {
+		tc.first = tc.clock.Now()
+	}
+	return tc.buf.Write(p)
+}
+
+// millis converts a duration to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// contentTransform rewrites assistant message content on its way to the client
+type contentTransform interface {
+	// Apply rewrites the complete content of a non-streaming message
+	Apply(content string) string
+	// NewStream returns per-choice state for rewriting a streamed message
+	NewStream() streamTransform
+}
+
+// streamTransform rewrites streamed content incrementally
+type streamTransform interface {
+	// Push consumes a content delta and returns the text to forward now
+	Push(delta string) string
+	// Flush returns any text still held back once the message is complete
+	Flush() string
+}
+
+// transformChain applies transforms in order
+type transformChain []contentTransform
+
+// Apply runs every transform over a complete message
+func (tc transformChain) Apply(content string) string {
+	for _, t := range tc {
+		content = t.Apply(content)
+	}
+	return content
+}
+
+// NewStream creates chained per-choice stream state
+func (tc transformChain) NewStream() streamTransform {
+	stages := make([]streamTransform, len(tc))
+	for i, t := range tc {
+		stages[i] = t.NewStream()
+	}
+	return &chainStream{stages: stages}
+}
+
+// chainStream feeds each stage's output into the next stage
+type chainStream struct {
+	stages []streamTransform
+}
+
+// Push implements streamTransform
+func (cs *chainStream) Push(delta string) string {
+	for _, st := range cs.stages {
+		delta = st.Push(delta)
+	}
+	return delta
+}
+
+// Flush implements streamTransform; text flushed by one stage still passes through later stages
+func (cs *chainStream) Flush() string {
+	pending := ""
+	for _, st := range cs.stages {
+		pending = st.Push(pending) + st.Flush()
+	}
+	return pending
+}
+
+// contentTransforms returns the content rewrites that apply to this request's response,
+// setting any response headers they imply
+func (s *Server) contentTransforms(c *gin.Context, model string) transformChain {
+	var chain transformChain
+	for _, rule := range s.postRules {
+		if rule.Applies(c.Request.Header) {
+			chain = append(chain, ruleTransform{rule: rule})
+		}
+	}
+	// Links are checked after rules have rewritten them
+	if t := s.links.transform(c); t != nil {
+		chain = append(chain, t)
+	}
+	// Attribution runs last so rules cannot strip the trailer
+	if s.attribution != nil {
+		if t := s.attribution.apply(c, model); t != nil {
+			chain = append(chain, t)
+		}
+	}
+	return chain
+}
+
+// rewriteOptions selects the response rewrites applied to a successful upstream body
+type rewriteOptions struct {
+	chain     transformChain    // Content transforms
+	split     bool              // Deliver each delta channel as its own SSE event type
+	reasoning string            // Reasoning mode; "" or passthrough leaves reasoning alone
+	format    *jsonFormat       // Structured output the answer must satisfy
+	annotate  *annotation       // End streams with usage, cost and timing comments
+	metadata  map[string]string // Echoed on the response object and final stream chunks
+
+	// Plugin hook run on each outgoing chunk or response object; false drops a chunk
+	chunkHook func(chunk map[string]any, stream bool) (map[string]any, bool)
+}
+
+// active reports whether the body needs rewriting at all
+func (o rewriteOptions) active() bool {
+	return len(o.chain) > 0 || o.split || o.rewritesReasoning() || o.format != nil || o.annotate != nil || len(o.metadata) > 0 || o.chunkHook != nil
+}
+
+// rewritesReasoning reports whether reasoning is stripped or merged
+func (o rewriteOptions) rewritesReasoning() bool {
+	return o.reasoning == reasoningStrip || o.reasoning == reasoningMerge
+}
+
+// writeTransformed forwards an upstream body with the selected rewrites applied; SSE streams are
+// rewritten event by event, anything else is treated as a single chat completion object
+func writeTransformed(ctx context.Context, c *gin.Context, body io.Reader, streaming bool, opts rewriteOptions) error {
+	if streaming {
+		return streamTransformed(ctx, c, body, opts)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	var resp map[string]any
+	if err := json.Unmarshal(data, &resp); err != nil {
+		// Not a completion object; forward untouched
+		_, err := c.Writer.Write(data)
+		return err
+	}
+
+	choices, _ := resp["choices"].([]any)
+	for _, ch := range choices {
+		choice, _ := ch.(map[string]any)
+		msg, _ := choice["message"].(map[string]any)
+		if content, ok := msg["content"].(string); ok && content != "" && opts.format != nil {
+			if err := opts.format.check(content); err != nil {
+				// Nothing has been written yet, so the status can still become an error
+				handleError(c, api.ErrBadGateway("%v", err))
+				return nil
+			}
+		}
+		if content, ok := msg["content"].(string); ok {
+			msg["content"] = opts.chain.Apply(content)
+		}
+		if msg != nil && opts.rewritesReasoning() {
+			rewriteReasoningMessage(opts.reasoning, msg)
+		}
+	}
+
+	if len(opts.metadata) > 0 {
+		resp["metadata"] = opts.metadata
+	}
+	if opts.chunkHook != nil {
+		// A whole response cannot be dropped, only replaced
+		if hooked, ok := opts.chunkHook(resp, false); ok {
+			resp = hooked
+		}
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to encode transformed response: %w", err)
+	}
+	// Headers are still unsent, so the rewritten length can be announced
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	_, err = c.Writer.Write(out)
+	return err
+}
+
+// streamTransformed rewrites the content deltas of an OpenAI-style SSE stream. Text held back by
+// a transform is released on the chunk carrying finish_reason, or in a synthetic chunk before
+// [DONE] if the stream ends without one. Structured outputs are checked once the stream ends,
+// and an error chunk precedes [DONE] when an answer does not satisfy the format; annotation
+// comments come last.
+func streamTransformed(ctx context.Context, c *gin.Context, body io.Reader, opts rewriteOptions) error {
+	reader := sse.NewReader(body)
+	streams := make(map[int]streamTransform)
+	finished := make(map[int]bool)
+	thinking := make(map[int]bool) // Choices with an open <think> block
+	outputs := make(map[int]*strings.Builder)
+	var last map[string]any
+
+	write := func(ev sse.Event) error {
+		if err := sse.Write(c.Writer, ev); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	// writeChunk encodes a (rewritten) chunk into ev, splitting it by channel if requested
+	writeChunk := func(ev sse.Event, chunk map[string]any) error {
+		if opts.chunkHook != nil {
+			hooked, ok := opts.chunkHook(chunk, true)
+			if !ok {
+				return nil
+			}
+			chunk = hooked
+		}
+		if opts.split {
+			events, err := splitChunk(ev, chunk)
+			if err != nil {
+				return err
+			}
+			for _, e := range events {
+				if err := write(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		ev.Data = string(data)
+		return write(ev)
+	}
+
+	// flushPending emits a synthetic chunk with held-back text for unfinished choices
+	flushPending := func() error {
+		if last == nil {
+			return nil
+		}
+		indexes := make([]int, 0, len(streams))
+		for idx := range streams {
+			if !finished[idx] {
+				indexes = append(indexes, idx)
+			}
+		}
+		sort.Ints(indexes)
+
+		var choices []any
+		for _, idx := range indexes {
+			finished[idx] = true
+			text := streams[idx].Flush()
+			if thinking[idx] {
+				text = thinkClose + text
+				thinking[idx] = false
+			}
+			if text != "" {
+				choices = append(choices, map[string]any{"index": idx, "delta": map[string]any{"content": text}})
+			}
+		}
+		if len(choices) == 0 {
+			return nil
+		}
+
+		chunk := make(map[string]any, len(last))
+		for k, v := range last {
+			if k != "usage" {
+				chunk[k] = v
+			}
+		}
+		chunk["choices"] = choices
+		return writeChunk(sse.Event{}, chunk)
+	}
+
+	// checkOutputs sends an error chunk if an answer does not satisfy the requested format
+	checkOutputs := func() error {
+		if opts.format == nil {
+			return nil
+		}
+		indexes := slices.Sorted(maps.Keys(outputs))
+		for _, idx := range indexes {
+			if err := opts.format.check(outputs[idx].String()); err != nil {
+				data, _ := json.Marshal(map[string]any{
+					"error": map[string]any{
+						"message": err.Error(),
+						"type":    "server_error",
+						"code":    invalidJSONCode,
+					},
+				})
+				return write(sse.Event{Data: string(data)})
+			}
+		}
+		return nil
+	}
+
+	// finish runs once when the stream ends, before [DONE] if upstream sends one
+	ended := false
+	finish := func() error {
+		if ended {
+			return nil
+		}
+		ended = true
+		if err := flushPending(); err != nil {
+			return err
+		}
+		if err := checkOutputs(); err != nil {
+			return err
+		}
+		if opts.annotate != nil {
+			return write(opts.annotate.event())
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return finish()
+		}
+		if err != nil {
+			return err
+		}
+
+		if ev.IsDone() {
+			if err := finish(); err != nil {
+				return err
+			}
+			if err := write(ev); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var chunk map[string]any
+		if ev.Data == "" || json.Unmarshal([]byte(ev.Data), &chunk) != nil {
+			if err := write(ev); err != nil {
+				return err
+			}
+			continue
+		}
+		last = chunk
+		if opts.annotate != nil {
+			opts.annotate.observe(chunk)
+		}
+		if len(opts.metadata) > 0 && isFinalChunk(chunk) {
+			chunk["metadata"] = opts.metadata
+		}
+
+		choices, _ := chunk["choices"].([]any)
+		for _, ch := range choices {
+			choice, _ := ch.(map[string]any)
+			if choice == nil {
+				continue
+			}
+			idxFloat, _ := choice["index"].(float64)
+			idx := int(idxFloat)
+
+			st, ok := streams[idx]
+			if !ok {
+				st = opts.chain.NewStream()
+				streams[idx] = st
+			}
+
+			delta, _ := choice["delta"].(map[string]any)
+			if delta == nil {
+				delta = map[string]any{}
+				choice["delta"] = delta
+			}
+			text := ""
+			content, hasContent := delta["content"].(string)
+			if hasContent {
+				text = st.Push(content)
+				if content != "" {
+					if outputs[idx] == nil {
+						outputs[idx] = &strings.Builder{}
+					}
+					outputs[idx].WriteString(content)
+				}
+			}
+			if choice["finish_reason"] != nil && !finished[idx] {
+				finished[idx] = true
+				text += st.Flush()
+			}
+			if hasContent || text != "" {
+				delta["content"] = text
+			}
+			if opts.rewritesReasoning() {
+				open := thinking[idx]
+				rewriteReasoning(opts.reasoning, delta, &open, choice["finish_reason"] != nil)
+				thinking[idx] = open
+			}
+		}
+
+		// Chunks that only carried stripped reasoning are not worth sending
+		if opts.reasoning == reasoningStrip && emptyChunk(chunk) {
+			continue
+		}
+		if err := writeChunk(ev, chunk); err != nil {
+			return err
+		}
+	}
+}
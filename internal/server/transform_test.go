@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamedContent concatenates the content deltas of an SSE body
+func streamedContent(t *testing.T, body string) string {
+	t.Helper()
+	var b strings.Builder
+	r := sse.NewReader(strings.NewReader(body))
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			break
+		}
+		if ev.IsDone() {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &chunk))
+		for _, ch := range chunk.Choices {
+			b.WriteString(ch.Delta.Content)
+		}
+	}
+	return b.String()
+}
+
+func TestWriteTransformed(t *testing.T) {
+	chain := transformChain{appendTransform(" [ai]")}
+
+	tests := []struct {
+		name      string
+		streaming bool
+		body      string
+		expected  string
+	}{
+		{
+			name:      "Non-streaming",
+			streaming: false,
+			body:      `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}]}`,
+			expected:  "Hello [ai]",
+		},
+		{
+			name:      "Streaming with finish_reason",
+			streaming: true,
+			body: "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+				"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+				"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: [DONE]\n\n",
+			expected: "Hello [ai]",
+		},
+		{
+			name:      "Streaming without finish_reason",
+			streaming: true,
+			body: "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"data: [DONE]\n\n",
+			expected: "Hello [ai]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			err := writeTransformed(context.Background(), c, strings.NewReader(tt.body), tt.streaming, rewriteOptions{chain: chain})
+			require.NoError(t, err)
+
+			if tt.streaming {
+				assert.Equal(t, tt.expected, streamedContent(t, w.Body.String()))
+				assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+			} else {
+				var resp struct {
+					Choices []struct {
+						Message struct {
+							Content string `json:"content"`
+						} `json:"message"`
+					} `json:"choices"`
+				}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expected, resp.Choices[0].Message.Content)
+			}
+		})
+	}
+}
+
+func TestChatCompletions_Attribution(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"x = 1"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	cfg := &config.Config{
+		APIKey:  "test-key",
+		BaseURL: mockUpstream.URL,
+		Attribution: config.AttributionConfig{
+			Header:  true,
+			Trailer: "\n# generated via copilot-proxy/{{.Model}}",
+		},
+	}
+	s := NewServer(cfg, "127.0.0.1", 0)
+
+	reqBody := `{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "copilot-proxy/glm-4.7", w.Header().Get(generatedByHeader))
+	// The rewritten body's length replaces upstream's
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+	assert.Contains(t, w.Body.String(), `x = 1\n# generated via copilot-proxy/glm-4.7`)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// Transport defaults for unset values
+const (
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultKeepAlive             = 15 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second // Timeout only for headers; streams may run long
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultMaxIdleConnsPerHost   = 50 // Go's default of 2 is far too low for concurrent requests
+)
+
+// withTransportDefaults fills the unset values of a transport configuration
+func withTransportDefaults(cfg config.TransportConfig) config.TransportConfig {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	if cfg.ResponseHeaderTimeout <= 0 {
+		cfg.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	return cfg
+}
+
+// newTransport builds the upstream transport. There is no overall timeout: long streams end
+// through the request context, and each phase before the response has its own limit.
+func newTransport(cfg config.TransportConfig) *http.Transport {
+	cfg = withTransportDefaults(cfg)
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true, // A custom dialer otherwise turns HTTP/2 off
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+	}
+}
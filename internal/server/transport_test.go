@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	tr := newTransport(config.TransportConfig{})
+	assert.Equal(t, 10*time.Second, tr.TLSHandshakeTimeout)
+	assert.Equal(t, 30*time.Second, tr.ResponseHeaderTimeout)
+	assert.Equal(t, 90*time.Second, tr.IdleConnTimeout)
+	assert.Equal(t, 50, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, tr.MaxConnsPerHost)
+	assert.True(t, tr.ForceAttemptHTTP2)
+	assert.Nil(t, tr.Proxy)
+
+	tr = newTransport(config.TransportConfig{
+		TLSHandshakeTimeout:   2 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		IdleConnTimeout:       time.Minute,
+		MaxIdleConnsPerHost:   8,
+		MaxConnsPerHost:       16,
+	})
+	assert.Equal(t, 2*time.Second, tr.TLSHandshakeTimeout)
+	assert.Equal(t, 5*time.Second, tr.ResponseHeaderTimeout)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+	assert.Equal(t, 8, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 16, tr.MaxConnsPerHost)
+}
+
+func TestWithTransportDefaults(t *testing.T) {
+	cfg := withTransportDefaults(config.TransportConfig{})
+	assert.Equal(t, 10*time.Second, cfg.DialTimeout)
+	assert.Equal(t, 15*time.Second, cfg.KeepAlive)
+
+	// Negative keepalive disables probes and is kept
+	cfg = withTransportDefaults(config.TransportConfig{DialTimeout: 3 * time.Second, KeepAlive: -1})
+	assert.Equal(t, 3*time.Second, cfg.DialTimeout)
+	assert.Equal(t, time.Duration(-1), cfg.KeepAlive)
+}
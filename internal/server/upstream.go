@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/otel"
+	"github.com/chew-z/copilot-proxy/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamHeader lets authenticated clients send a request to a named upstream
+const upstreamHeader = "X-Upstream"
+
+// credential is an upstream API key that can be rotated while requests are in flight; requests
+// already sent keep the key they were sent with
+type credential struct {
+	key atomic.Pointer[string]
+}
+
+// newCredential holds key
+func newCredential(key string) *credential {
+	c := &credential{}
+	c.set(key)
+	return c
+}
+
+func (c *credential) get() string    { return *c.key.Load() }
+func (c *credential) set(key string) { c.key.Store(&key) }
+
+// upstream is an OpenAI-compatible chat completions API that requests can be sent to
+type upstream struct {
+	name         string // Empty for the default upstream
+	baseURL      string
+	endpoints    *endpoints        // Backup base URLs, nil when there are none
+	apiKey       *credential       // Shared with the default upstream when not configured separately
+	models       map[string]string // Canonical model -> model name sent to this upstream
+	signer       signing.Signer    // nil unless requests are signed for an egress gateway
+	clock        clock.Clock       // Time of request signatures
+	cacheControl bool              // Mark the system prompt as a prompt caching breakpoint
+}
+
+// newUpstreams builds the named upstreams, inheriting the default base URL, its backups and the
+// key when unset
+func newUpstreams(cfg *config.Config, defaultKey *credential, defaultEndpoints *endpoints, dialTimeout time.Duration, signer signing.Signer, clk clock.Clock) map[string]*upstream {
+	named := make(map[string]*upstream, len(cfg.Upstreams))
+	for name, uc := range cfg.Upstreams {
+		u := &upstream{name: name, baseURL: uc.BaseURL, apiKey: defaultKey, signer: signer, clock: clk, models: make(map[string]string, len(uc.Models))}
+		if u.baseURL == "" {
+			u.baseURL = cfg.BaseURL
+			u.endpoints = defaultEndpoints
+		} else {
+			u.endpoints = newEndpoints(uc.BackupBaseURLs, cfg.Endpoints.ReprobeInterval, dialTimeout)
+		}
+		if uc.APIKey != "" {
+			u.apiKey = newCredential(uc.APIKey)
+		}
+		for from, to := range uc.Models {
+			u.models[models.GetCanonicalModelName(from)] = to
+		}
+		named[strings.ToLower(name)] = u
+	}
+	return named
+}
+
+// newProviders builds the configured providers, keyed by each canonical model they serve
+func newProviders(cfg *config.Config, dialTimeout time.Duration) map[string]*upstream {
+	routes := make(map[string]*upstream)
+	for _, pc := range cfg.Providers {
+		u := &upstream{
+			name:         pc.Name,
+			baseURL:      pc.BaseURL,
+			endpoints:    newEndpoints(pc.BackupBaseURLs, cfg.Endpoints.ReprobeInterval, dialTimeout),
+			apiKey:       newCredential(pc.APIKey),
+			cacheControl: pc.CacheControl,
+		}
+		for _, model := range pc.Models {
+			routes[strings.ToLower(models.GetCanonicalModelName(model))] = u
+		}
+	}
+	return routes
+}
+
+// chatCompletionsPath is the path of the chat completions API under a base URL
+const chatCompletionsPath = "/chat/completions"
+
+// do sends a chat completions request with the extra headers
+func (u *upstream) do(ctx context.Context, client *http.Client, body []byte, extra http.Header) (*http.Response, error) {
+	return u.post(ctx, client, chatCompletionsPath, body, extra)
+}
+
+// post sends a request to the API path with the extra headers, moving on to the provider's
+// backup base URLs in order when a connection cannot be made. Requests that reached a server
+// are never sent again.
+func (u *upstream) post(ctx context.Context, client *http.Client, path string, body []byte, extra http.Header) (*http.Response, error) {
+	urls, idx := u.endpoints.order(u.baseURL)
+	var err error
+	for n, baseURL := range urls {
+		var req *http.Request
+		if req, err = u.newRequest(ctx, strings.TrimSuffix(baseURL, "/")+path, body); err != nil {
+			return nil, err
+		}
+		for name, values := range extra {
+			req.Header[name] = values
+		}
+
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			u.endpoints.use(idx[n], baseURL)
+			return resp, nil
+		}
+		if ctx.Err() != nil || !connectFailed(err) {
+			return nil, err
+		}
+		if n < len(urls)-1 {
+			slog.Warn("Upstream endpoint unreachable, trying the next", "endpoint", baseURL, "error", err)
+		}
+	}
+	return nil, err
+}
+
+// newRequest builds an authenticated, and if configured signed, API request
+func (u *upstream) newRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.Inject(ctx, req.Header)
+	if key := u.apiKey.get(); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if u.signer != nil {
+		u.signer.Sign(req, body, u.clock.Now())
+	}
+	return req, nil
+}
+
+// mapModel replaces the prepared body's model with this upstream's name for it, if it has one
+func (u *upstream) mapModel(bodyMap map[string]any) {
+	model, _ := bodyMap["model"].(string)
+	if mapped, ok := u.models[model]; ok {
+		bodyMap["model"] = mapped
+	}
+}
+
+// defaultUpstream is the configured base URL and the current default API key
+func (s *Server) defaultUpstream() *upstream {
+	return &upstream{baseURL: s.config.BaseURL, endpoints: s.endpoints, apiKey: s.apiKey, signer: s.signer, clock: s.clock}
+}
+
+// routeUpstream returns the provider serving a model, or the default upstream
+func (s *Server) routeUpstream(model string) *upstream {
+	if u, ok := s.providers[strings.ToLower(models.GetCanonicalModelName(model))]; ok {
+		return u
+	}
+	return s.defaultUpstream()
+}
+
+// namedUpstream returns the upstream or provider with the given name
+func (s *Server) namedUpstream(name string) (*upstream, bool) {
+	if u, ok := s.upstreams[strings.ToLower(name)]; ok {
+		return u, true
+	}
+	for _, u := range s.providers {
+		if strings.EqualFold(u.name, name) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// selectUpstream returns the upstream named by the X-Upstream header, or else the one routed
+// for the model. Only authenticated clients may choose.
+func (s *Server) selectUpstream(c *gin.Context, model string) (*upstream, error) {
+	name := c.GetHeader(upstreamHeader)
+	if name == "" {
+		return s.routeUpstream(model), nil
+	}
+	p := principalFrom(c)
+	if p == nil {
+		return nil, api.ErrForbidden("%s is only available to authenticated clients", upstreamHeader)
+	}
+	u, ok := s.upstreams[strings.ToLower(name)]
+	if !ok {
+		return nil, api.ErrBadRequest("unknown upstream '%s'", name)
+	}
+	return u, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/signing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamHeader(t *testing.T) {
+	// mockUpstream records which upstream was hit and the model and key it received
+	type hit struct {
+		name, model, auth string
+	}
+	var got hit
+	mockUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			got = hit{name: name, model: body["model"].(string), auth: r.Header.Get("Authorization")}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+		}))
+	}
+	main, alt := mockUpstream("main"), mockUpstream("alt")
+	defer main.Close()
+	defer alt.Close()
+
+	s := NewServer(&config.Config{
+		APIKey:  "main-key",
+		BaseURL: main.URL,
+		Auth:    config.AuthConfig{Keys: []config.ClientKey{{Name: "alice", Key: "alice-key"}}, Lockout: config.LockoutConfig{MaxFailures: 5, Base: 1}},
+		Upstreams: map[string]config.UpstreamConfig{
+			"b": {BaseURL: alt.URL, Models: map[string]string{"GLM-4.7": "glm-4.7-experimental"}},
+		},
+	}, "127.0.0.1", 0)
+
+	send := func(upstream string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer alice-key")
+		}
+		if upstream != "" {
+			req.Header.Set(upstreamHeader, upstream)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, hit{"main", "glm-4.7", "Bearer main-key"}, got)
+
+	// Model is mapped and the default key inherited
+	w = send("B", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, hit{"alt", "glm-4.7-experimental", "Bearer main-key"}, got)
+	assert.Equal(t, "b", w.Header().Get(upstreamHeader))
+
+	w = send("nope", true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown upstream 'nope'")
+}
+
+func TestUpstreamHeader_RequiresAuthentication(t *testing.T) {
+	s := NewServer(&config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"b": {BaseURL: "http://127.0.0.1:1"}},
+	}, "127.0.0.1", 0)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(upstreamHeader, "b")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestProviders(t *testing.T) {
+	type hit struct {
+		name, model, auth string
+	}
+	var got hit
+	mockUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			got = hit{name: name, model: body["model"].(string), auth: r.Header.Get("Authorization")}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+		}))
+	}
+	main, router := mockUpstream("main"), mockUpstream("openrouter")
+	defer main.Close()
+	defer router.Close()
+
+	s := NewServer(&config.Config{
+		APIKey:    "main-key",
+		BaseURL:   main.URL,
+		Providers: []config.ProviderConfig{{Name: "openrouter", BaseURL: router.URL, APIKey: "or-key", Models: []string{"GLM-4.6V"}}},
+	}, "127.0.0.1", 0)
+
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Listed models go to the provider with its own key, whatever case the client uses
+	w := send("glm-4.6v")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, hit{"openrouter", "glm-4.6v", "Bearer or-key"}, got)
+	assert.Equal(t, "openrouter", w.Header().Get(upstreamHeader))
+
+	w = send("GLM-4.7")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, hit{"main", "glm-4.7", "Bearer main-key"}, got)
+	assert.Empty(t, w.Header().Get(upstreamHeader))
+
+	// Server-side completions are routed the same way
+	_, err := s.complete(t.Context(), nil, map[string]any{"model": "glm-4.6v", "messages": []any{}})
+	assert.NoError(t, err)
+	assert.Equal(t, "openrouter", got.name)
+}
+
+func TestUpstreamSigning(t *testing.T) {
+	var auth, signature, timestamp string
+	var body []byte
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, signature, timestamp = r.Header.Get("Authorization"), r.Header.Get("X-Signature"), r.Header.Get(signing.TimestampHeader)
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer mockUpstream.Close()
+
+	s := NewServer(&config.Config{
+		BaseURL: mockUpstream.URL,
+		APIKey:  "provider-key",
+		Signing: config.SigningConfig{Scheme: "hmac", Secret: "gateway-secret"},
+	}, "127.0.0.1", 0)
+	s.clock = clock.NewFake(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "GLM-4.7", "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The gateway can verify the signature over exactly what it received; the bearer token is kept
+	assert.Equal(t, "Bearer provider-key", auth)
+	assert.Equal(t, "1792324800", timestamp)
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte("gateway-secret"))
+	mac.Write([]byte(timestamp + "\nPOST\n/chat/completions\n" + hex.EncodeToString(sum[:])))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), signature)
+}
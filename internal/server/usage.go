@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/chew-z/copilot-proxy/internal/models"
+	"github.com/chew-z/copilot-proxy/internal/requestlog"
+	"github.com/chew-z/copilot-proxy/internal/usage"
+	"github.com/gin-gonic/gin"
+)
+
+// anonymousClient labels requests made without client authentication
+const anonymousClient = "anonymous"
+
+// requestLabels are the labels shared by per-request metrics, so dashboards can slice every
+// panel the same way
+type requestLabels struct {
+	model   string
+	client  string // Authenticated client name, or anonymous
+	dialect string // openai or ollama
+}
+
+// requestLabelsFor returns the standard labels of a request served by model
+func requestLabelsFor(c *gin.Context, model string) requestLabels {
+	l := requestLabels{model: model, client: anonymousClient, dialect: dialectOf(c.Request.URL.Path)}
+	if p := principalFrom(c); p != nil {
+		l.client = p.Name
+	}
+	return l
+}
+
+// dialectOf names the API dialect of a request path
+func dialectOf(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/"):
+		return "ollama"
+	case path == anthropicMessagesPath:
+		return "anthropic"
+	}
+	return "openai"
+}
+
+// statusClass groups a status code as 2xx, 4xx, 5xx and so on
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// latencyBuckets are the upper bounds of the request duration histogram, from quick
+// completions to long reasoning streams
+var latencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// usageMetrics counts relayed chat completions and the tokens upstream reports for them
+type usageMetrics struct {
+	requests  *metrics.Counter
+	tokens    *metrics.Counter
+	bytes     *metrics.Counter
+	latency   *metrics.Histogram
+	invalid   *metrics.Counter // Upstream responses replaced by an error for being malformed
+	failed    *metrics.Counter // Upstream streams ended early for reporting an error or turning into garbage
+	estimated *metrics.Counter // Streams given an estimated usage chunk because upstream sent none
+	repaired  *metrics.Counter // Malformed stream events repaired or dropped, and missing [DONE]s added
+	cached    *metrics.Counter // Prompt tokens by whether the upstream prompt cache served them
+
+	// Stream throughput: rates divide bytes and tokens by generation seconds
+	streams       *metrics.Counter
+	streamBytes   *metrics.Counter
+	streamSeconds *metrics.Counter
+	streamTokens  *metrics.Counter
+	tokensPerSec  *metrics.Gauge
+	bytesPerSec   *metrics.Gauge
+}
+
+// newUsageMetrics registers the usage counters
+func newUsageMetrics(registry *metrics.Registry) *usageMetrics {
+	return &usageMetrics{
+		requests: registry.Counter("copilot_proxy_requests_total",
+			"Chat completions relayed upstream", "model", "client", "dialect", "status", "status_class"),
+		tokens: registry.Counter("copilot_proxy_tokens_total",
+			"Tokens reported by upstream", "model", "client", "dialect", "type"),
+		bytes: registry.Counter("copilot_proxy_bytes_total",
+			"Body bytes exchanged with upstream", "model", "client", "dialect", "direction"),
+		latency: registry.Histogram("copilot_proxy_request_duration_seconds",
+			"Time from sending a request upstream to the end of its response",
+			latencyBuckets, "model", "client", "dialect"),
+		invalid: registry.Counter("copilot_proxy_invalid_upstream_responses_total",
+			"Whole upstream responses replaced by an error for being malformed", "model", "reason"),
+		failed: registry.Counter("copilot_proxy_stream_errors_total",
+			"Upstream streams ended early with an error event", "model", "reason"),
+		estimated: registry.Counter("copilot_proxy_stream_usage_estimated_total",
+			"Streams requesting include_usage that upstream ended without usage, answered with an estimate", "model"),
+		repaired: registry.Counter("copilot_proxy_stream_repairs_total",
+			"Repairs made to upstream event streams: malformed chunks split, completed or dropped, tool call indexes and missing [DONE]s added", "model", "repair"),
+		cached: registry.Counter("copilot_proxy_prompt_cache_tokens_total",
+			"Prompt tokens upstream served from its prompt cache (hit) or processed (miss), where it reports them", "model", "result"),
+		streams: registry.Counter("copilot_proxy_streams_total",
+			"Successful streamed responses with a body", "model", "client", "dialect"),
+		streamBytes: registry.Counter("copilot_proxy_stream_bytes_total",
+			"Bytes of streamed responses received from upstream", "model", "client", "dialect"),
+		streamSeconds: registry.Counter("copilot_proxy_stream_generation_seconds_total",
+			"Time from the first to the last byte of streamed responses", "model", "client", "dialect"),
+		streamTokens: registry.Counter("copilot_proxy_stream_completion_tokens_total",
+			"Completion tokens of streamed responses", "model", "client", "dialect"),
+		tokensPerSec: registry.Gauge("copilot_proxy_stream_tokens_per_second",
+			"Completion tokens per second of the model's last stream", "model"),
+		bytesPerSec: registry.Gauge("copilot_proxy_stream_bytes_per_second",
+			"Bytes per second of the model's last stream", "model"),
+	}
+}
+
+// record counts a relayed request and its reported token usage
+func (u *usageMetrics) record(l requestLabels, status int, usage *tokenUsage) {
+	u.requests.Inc(l.model, l.client, l.dialect, strconv.Itoa(status), statusClass(status))
+	if usage == nil {
+		return
+	}
+	u.tokens.Add(float64(usage.PromptTokens), l.model, l.client, l.dialect, "prompt")
+	u.tokens.Add(float64(usage.CompletionTokens), l.model, l.client, l.dialect, "completion")
+	if cached, ok := usage.cachedTokens(); ok {
+		u.cached.Add(float64(cached), l.model, "hit")
+		u.cached.Add(float64(max(usage.PromptTokens-cached, 0)), l.model, "miss")
+	}
+}
+
+// recordTraffic adds the body bytes a request sent upstream and received back
+func (u *usageMetrics) recordTraffic(l requestLabels, t traffic) {
+	u.bytes.Add(float64(t.request), l.model, l.client, l.dialect, "request")
+	u.bytes.Add(float64(t.response), l.model, l.client, l.dialect, "response")
+}
+
+// recordLatency observes how long a request took, linking the observation to its trace or
+// request ID for exemplar-aware dashboards
+func (u *usageMetrics) recordLatency(l requestLabels, elapsed time.Duration, exemplar map[string]string) {
+	u.latency.ObserveExemplar(elapsed.Seconds(), exemplar, l.model, l.client, l.dialect)
+}
+
+// recordStream adds a stream's throughput
+func (u *usageMetrics) recordStream(l requestLabels, t *throughput, usage *tokenUsage) {
+	u.streams.Inc(l.model, l.client, l.dialect)
+	u.streamBytes.Add(float64(t.Bytes), l.model, l.client, l.dialect)
+	u.streamSeconds.Add(t.Duration.Seconds(), l.model, l.client, l.dialect)
+	u.bytesPerSec.Set(t.BytesPerSec, l.model)
+	if usage != nil {
+		u.streamTokens.Add(float64(usage.CompletionTokens), l.model, l.client, l.dialect)
+		u.tokensPerSec.Set(t.TokensPerSec, l.model)
+	}
+}
+
+// newUsageLedger creates the per-request usage ledger, returning nil if it cannot be initialized
+func newUsageLedger(cfg config.UsageConfig) *usage.Ledger {
+	dir, err := cfg.DirPath()
+	if err != nil {
+		slog.Error("Usage ledger disabled", "error", err)
+		return nil
+	}
+	ledger, err := usage.NewLedger(dir)
+	if err != nil {
+		slog.Error("Usage ledger disabled", "error", err)
+		return nil
+	}
+	slog.Info("Usage ledger enabled", "dir", dir)
+	return ledger
+}
+
+// newUsageExporter creates the scheduled usage report exporter, returning nil if it cannot be initialized
+func newUsageExporter(cfg config.UsageConfig, clk clock.Clock) *usage.Exporter {
+	ledgerDir, err := cfg.DirPath()
+	if err != nil {
+		slog.Error("Usage export disabled", "error", err)
+		return nil
+	}
+	outputDir, err := cfg.Export.DirPath()
+	if err != nil {
+		slog.Error("Usage export disabled", "error", err)
+		return nil
+	}
+	exporter, err := usage.NewExporter(cfg.Export, ledgerDir, outputDir, clk)
+	if err != nil {
+		slog.Error("Usage export disabled", "error", err)
+		return nil
+	}
+	return exporter
+}
+
+// recordLedger appends a chat request's usage to the ledger
+func (s *Server) recordLedger(c *gin.Context, model string, status int, tokens *tokenUsage, tp *throughput, t traffic, metadata map[string]string) {
+	rec := usage.Record{Time: s.clock.Now(), Model: model, Status: status, Metadata: metadata,
+		RequestBytes: t.request, ResponseBytes: t.response}
+	if p := principalFrom(c); p != nil {
+		rec.Client = p.Name
+	}
+	if tag := canaryFrom(c); tag != nil {
+		rec.RequestedModel, rec.Canary = tag.requested, tag.arm
+	}
+	if tokens != nil {
+		rec.PromptTokens = tokens.PromptTokens
+		rec.CompletionTokens = tokens.CompletionTokens
+		if m, ok := models.GetModel(model); ok {
+			rec.CostUSD = m.Cost(tokens.PromptTokens, tokens.CompletionTokens)
+		}
+	}
+	if tp != nil {
+		rec.Stream = true
+		rec.Bytes = tp.Bytes
+		rec.FirstByteMS = tp.FirstByte.Milliseconds()
+		rec.DurationMS = tp.Duration.Milliseconds()
+		rec.BytesPerSec = math.Round(tp.BytesPerSec)
+		rec.TokensPerSec = math.Round(tp.TokensPerSec*10) / 10
+	}
+	if err := s.ledger.Append(rec); err != nil {
+		slog.Error("Failed to record usage", "error", err)
+	}
+}
+
+// logRequest adds a relayed chat request to the request log. The prompt is kept only as a
+// truncated hash of its messages, enough to spot repeats.
+func (s *Server) logRequest(c *gin.Context, requestID, model string, status int, tokens *tokenUsage, stream bool, latency time.Duration, messages []any) {
+	rec := requestlog.Record{Time: s.clock.Now(), RequestID: requestID, Model: model, Status: status,
+		LatencyMS: latency.Milliseconds(), Stream: stream}
+	if p := principalFrom(c); p != nil {
+		rec.Client = p.Name
+	}
+	if tokens != nil {
+		rec.PromptTokens, rec.CompletionTokens = tokens.PromptTokens, tokens.CompletionTokens
+	}
+	if data, err := json.Marshal(messages); err == nil && len(messages) > 0 {
+		sum := sha256.Sum256(data)
+		rec.PromptHash = hex.EncodeToString(sum[:8])
+	}
+	s.requestLog.Append(rec)
+}
+
+// traffic is the size of a request's exchange with upstream, which egress is billed by
+type traffic struct {
+	request  int64 // Body bytes sent upstream
+	response int64 // Body bytes received from upstream
+}
+
+// tokenUsage is the usage object of a chat completion
+type tokenUsage struct {
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *promptTokensDetails `json:"prompt_tokens_details,omitempty"` // Reported by upstreams with prompt caching
+}
+
+// promptTokensDetails breaks down the prompt tokens of a usage object
+type promptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"` // Read from the upstream prompt cache
+}
+
+// cachedTokens returns the prompt tokens served from the upstream cache, and whether upstream
+// reported them
+func (u *tokenUsage) cachedTokens() (int, bool) {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0, false
+	}
+	return u.PromptTokensDetails.CachedTokens, true
+}
+
+// usageTap watches a forwarded response for its usage report. Streams are scanned line by
+// line for the chunk carrying usage; other bodies are captured and parsed once complete.
+type usageTap struct {
+	streaming bool
+	line      []byte
+	body      captureBuffer
+	usage     *tokenUsage
+}
+
+// Write implements io.Writer; it never fails so it cannot interrupt the response
+func (t *usageTap) Write(p []byte) (int, error) {
+	if !t.streaming {
+		return t.body.Write(p)
+	}
+
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			t.line = append(t.line, rest...)
+			break
+		}
+		t.line = append(t.line, rest[:i]...)
+		t.scanLine(t.line)
+		t.line = t.line[:0]
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
+
+// scanLine keeps the usage of an SSE data line that reports one
+func (t *usageTap) scanLine(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+	var chunk struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &chunk) == nil && chunk.Usage != nil {
+		t.usage = chunk.Usage
+	}
+}
+
+// Usage returns the reported usage, or nil if the response carried none
+func (t *usageTap) Usage() *tokenUsage {
+	if t.streaming || t.usage != nil {
+		return t.usage
+	}
+	var resp struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if data := t.body.Bytes(); data != nil && json.Unmarshal(data, &resp) == nil {
+		t.usage = resp.Usage
+	}
+	return t.usage
+}
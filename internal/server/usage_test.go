@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/requestlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageTap(t *testing.T) {
+	t.Run("Streaming", func(t *testing.T) {
+		tap := &usageTap{streaming: true}
+		stream := "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":3,\"total_tokens\":10}}\n\n" +
+			"data: [DONE]\n\n"
+		// Small writes split lines, as network reads do
+		for i := 0; i < len(stream); i += 7 {
+			tap.Write([]byte(stream[i:min(i+7, len(stream))]))
+		}
+		require.NotNil(t, tap.Usage())
+		assert.Equal(t, tokenUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10}, *tap.Usage())
+	})
+
+	t.Run("Non-streaming", func(t *testing.T) {
+		tap := &usageTap{}
+		tap.Write([]byte(`{"choices":[],"usage":{"prompt_tokens":4,`))
+		tap.Write([]byte(`"completion_tokens":1,"total_tokens":5}}`))
+		require.NotNil(t, tap.Usage())
+		assert.Equal(t, 5, tap.Usage().TotalTokens)
+	})
+
+	t.Run("No usage", func(t *testing.T) {
+		tap := &usageTap{}
+		tap.Write([]byte(`{"choices":[]}`))
+		assert.Nil(t, tap.Usage())
+	})
+}
+
+func TestRequestLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "requests.db")
+	s := NewServer(&config.Config{BaseURL: upstream.URL, RequestLog: config.RequestLogConfig{Enabled: true, Path: path}}, "127.0.0.1", 0)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": false, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, "req_logged")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+	require.NoError(t, s.requestLog.Close())
+
+	db, err := requestlog.Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	records, err := requestlog.Query(context.Background(), db, requestlog.Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, "req_logged", r.RequestID)
+	assert.Equal(t, "glm-4.7", r.Model)
+	assert.Equal(t, http.StatusOK, r.Status)
+	assert.Equal(t, 12, r.PromptTokens)
+	assert.Equal(t, 3, r.CompletionTokens)
+	assert.False(t, r.Stream)
+	assert.Len(t, r.PromptHash, 16)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chew-z/copilot-proxy/internal/api"
+)
+
+// snippetLength is how much of an invalid body is quoted in diagnostics
+const snippetLength = 160
+
+// checkCompletion reports why a whole (non-streaming) chat completion body cannot be relayed:
+// it was cut short, is not JSON, e.g. a gateway's HTML error page, or is JSON of the wrong shape.
+// Error responses only need to be JSON; their contents are the upstream's to choose. An empty
+// reason means the body is fine.
+func checkCompletion(status int, data []byte, readErr error) (reason, detail string) {
+	if readErr != nil {
+		return "truncated", fmt.Sprintf("body ended after %d bytes: %v", len(data), readErr)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		// JSON that was well-formed up to its last byte was cut short
+		var syntaxErr *json.SyntaxError
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(data)) {
+			return "truncated", fmt.Sprintf("JSON ends early after %d bytes", len(data))
+		}
+		return "not_json", fmt.Sprintf("body is not JSON (%v)", err)
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return "shape", "body is not a JSON object"
+	}
+	if status >= 300 {
+		return "", ""
+	}
+
+	choices, ok := obj["choices"].([]any)
+	if !ok {
+		if e, ok := obj["error"]; ok {
+			return "error", fmt.Sprintf("status %d carries an error: %s", status, snippet([]byte(errorText(e))))
+		}
+		return "shape", "no choices array"
+	}
+	for i, choice := range choices {
+		c, ok := choice.(map[string]any)
+		if !ok {
+			return "shape", fmt.Sprintf("choice %d is not an object", i)
+		}
+		if _, ok := c["message"].(map[string]any); !ok {
+			return "shape", fmt.Sprintf("choice %d has no message", i)
+		}
+	}
+	return "", ""
+}
+
+// snippet quotes the start of a body on one line
+func snippet(data []byte) string {
+	s := strings.Join(strings.Fields(strings.ToValidUTF8(string(data), "?")), " ")
+	if len(s) > snippetLength {
+		cut := snippetLength
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "..."
+	}
+	return s
+}
+
+// validateResponse reads a whole upstream response and checks it before anything is relayed,
+// so clients get a clean error with diagnostics instead of a payload they cannot parse.
+// Successful responses that fail become 502s; error responses keep their status. The body is
+// buffered in place for the relay.
+func (s *Server) validateResponse(ctx context.Context, resp *http.Response, requestID, servedBy string) error {
+	data, readErr := io.ReadAll(resp.Body)
+	if readErr != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(data), resp.Body}
+
+	reason, detail := checkCompletion(resp.StatusCode, data, readErr)
+	if reason == "" {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	s.usage.invalid.Inc(servedBy, reason)
+	slog.Warn("Invalid upstream response", "request_id", requestID, "model", servedBy, "status", resp.StatusCode,
+		"reason", reason, "detail", detail, "content_type", contentType, "bytes", len(data), "body", snippet(data))
+
+	status := http.StatusBadGateway
+	if resp.StatusCode >= 400 {
+		status = resp.StatusCode
+	}
+	return api.Errorf(status, "Upstream returned an invalid response (status %d, %s, %d bytes): %s; body starts: %s",
+		resp.StatusCode, cmp.Or(contentType, "no content type"), len(data), detail, snippet(data))
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		readErr error
+		want    string
+	}{
+		{"valid", 200, `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`, nil, ""},
+		{"no choices yet", 200, `{"choices":[]}`, nil, ""},
+		{"html page", 200, "<html><body>Bad gateway</body></html>", nil, "not_json"},
+		{"cut short", 200, `{"choices":[{"index":0,"mess`, nil, "truncated"},
+		{"connection dropped", 200, `{"choices":`, io.ErrUnexpectedEOF, "truncated"},
+		{"array", 200, `[1, 2]`, nil, "shape"},
+		{"no choices", 200, `{"id":"1"}`, nil, "shape"},
+		{"choice without message", 200, `{"choices":[{"index":0}]}`, nil, "shape"},
+		{"error on success", 200, `{"error":{"message":"quota exceeded"}}`, nil, "error"},
+		{"json error", 429, `{"error":{"message":"slow down"}}`, nil, ""},
+		{"html error", 503, "<html>Service Unavailable</html>", nil, "not_json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, detail := checkCompletion(tt.status, []byte(tt.body), tt.readErr)
+			assert.Equal(t, tt.want, reason, detail)
+		})
+	}
+}
+
+func TestInvalidUpstreamResponses(t *testing.T) {
+	var status int
+	var contentType, body string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL}, "127.0.0.1", 0)
+	send := func() (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": false, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		var got struct {
+			Error string `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got), w.Body.String())
+		return w, got.Error
+	}
+
+	t.Run("HTML page on success", func(t *testing.T) {
+		status, contentType, body = http.StatusOK, "text/html", "<html>\n  <body>Gateway maintenance</body>\n</html>"
+		w, msg := send()
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Contains(t, msg, "status 200, text/html")
+		assert.Contains(t, msg, "body starts: <html> <body>Gateway maintenance")
+	})
+
+	t.Run("HTML error page keeps its status", func(t *testing.T) {
+		status, contentType, body = http.StatusServiceUnavailable, "text/html", "<html>down</html>"
+		w, msg := send()
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, msg, "not JSON")
+	})
+
+	t.Run("JSON errors pass through", func(t *testing.T) {
+		status, contentType, body = http.StatusBadRequest, "application/json", `{"error":"bad model"}`
+		w, msg := send()
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "bad model", msg)
+	})
+
+	var out strings.Builder
+	s.metrics.WriteText(&out)
+	assert.Contains(t, out.String(), `copilot_proxy_invalid_upstream_responses_total{model="glm-4.7",reason="not_json"} 2`)
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Default caps on relayed upstream responses
+const (
+	defaultStreamMaxDuration = time.Hour
+	defaultStreamIdleTimeout = 10 * time.Minute
+)
+
+// trackedBody is an open upstream response body being relayed to a client
+type trackedBody struct {
+	io.ReadCloser
+	watchdog *streamWatchdog
+	id       string // Request ID
+	model    string
+	stream   bool
+	opened   time.Time
+	cancel   context.CancelFunc // Cancels the upstream request
+
+	lastRead atomic.Int64 // Unix nanoseconds of the last read that returned data
+	bytes    atomic.Int64
+	forced   atomic.Bool
+	once     sync.Once
+}
+
+// Read records activity for the idle cap
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.bytes.Add(int64(n))
+		b.lastRead.Store(b.watchdog.clock.Now().UnixNano())
+	}
+	return n, err
+}
+
+// Close closes the body and ends its accounting; later calls do nothing
+func (b *trackedBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		err = b.ReadCloser.Close()
+		b.watchdog.release(b)
+	})
+	return err
+}
+
+// streamWatchdog accounts for open upstream response bodies and the handlers relaying them,
+// and force-closes those that outlive the caps. A relay whose client went away without its
+// handler noticing, e.g. mid tool-call stream, would otherwise hold the upstream connection
+// and its goroutine forever.
+type streamWatchdog struct {
+	maxDuration time.Duration
+	idleTimeout time.Duration
+	clock       clock.Clock
+
+	open   *metrics.Gauge
+	forced *metrics.Counter
+	closed atomic.Int64 // Bodies force-closed since start
+
+	mu     sync.Mutex
+	bodies map[*trackedBody]struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// newStreamWatchdog creates a watchdog from configuration
+func newStreamWatchdog(cfg config.StreamsConfig, registry *metrics.Registry) *streamWatchdog {
+	return &streamWatchdog{
+		maxDuration: cmp.Or(cfg.MaxDuration, defaultStreamMaxDuration),
+		idleTimeout: cmp.Or(cfg.IdleTimeout, defaultStreamIdleTimeout),
+		clock:       clock.Real{},
+		open: registry.Gauge("copilot_proxy_open_upstream_bodies",
+			"Upstream response bodies being relayed", "kind"),
+		forced: registry.Counter("copilot_proxy_streams_force_closed_total",
+			"Upstream responses closed by the watchdog for outliving a cap", "reason"),
+		bodies: make(map[*trackedBody]struct{}),
+	}
+}
+
+// track accounts for an upstream response until its body is closed. cancel must abort the
+// upstream request.
+func (w *streamWatchdog) track(resp *http.Response, r *activeRequest, cancel context.CancelFunc) *trackedBody {
+	b := &trackedBody{
+		ReadCloser: resp.Body,
+		watchdog:   w,
+		id:         r.id,
+		model:      r.model,
+		stream:     isEventStream(resp),
+		opened:     w.clock.Now(),
+		cancel:     cancel,
+	}
+	b.lastRead.Store(b.opened.UnixNano())
+	w.mu.Lock()
+	w.bodies[b] = struct{}{}
+	w.mu.Unlock()
+	w.open.Add(1, bodyKind(b.stream))
+	resp.Body = b
+	return b
+}
+
+// release ends the accounting of a closed body
+func (w *streamWatchdog) release(b *trackedBody) {
+	w.mu.Lock()
+	delete(w.bodies, b)
+	w.mu.Unlock()
+	w.open.Add(-1, bodyKind(b.stream))
+}
+
+// bodyKind labels streamed and whole responses
+func bodyKind(stream bool) string {
+	if stream {
+		return "stream"
+	}
+	return "response"
+}
+
+// sweep force-closes the bodies past a cap and returns how many it closed
+func (w *streamWatchdog) sweep(now time.Time) int {
+	var expired []*trackedBody
+	var reasons []string
+	w.mu.Lock()
+	for b := range w.bodies {
+		switch {
+		case now.Sub(b.opened) >= w.maxDuration:
+			expired, reasons = append(expired, b), append(reasons, "max_duration")
+		case now.Sub(time.Unix(0, b.lastRead.Load())) >= w.idleTimeout:
+			expired, reasons = append(expired, b), append(reasons, "idle")
+		}
+	}
+	w.mu.Unlock()
+
+	closed := 0
+	for i, b := range expired {
+		if !b.forced.CompareAndSwap(false, true) {
+			continue
+		}
+		closed++
+		w.closed.Add(1)
+		w.forced.Inc(reasons[i])
+		slog.Warn("Force-closing leaked upstream response", "request_id", b.id, "model", b.model, "reason", reasons[i],
+			"age", now.Sub(b.opened).Round(time.Second), "bytes", b.bytes.Load())
+		// Cancelling unblocks a relay waiting on upstream; closing frees the connection
+		b.cancel()
+		b.Close()
+	}
+	return closed
+}
+
+// Start sweeps periodically until Stop
+func (w *streamWatchdog) Start() {
+	w.stop, w.done = make(chan struct{}), make(chan struct{})
+	interval := min(w.idleTimeout, w.maxDuration) / 10
+	go func() {
+		defer close(w.done)
+		ticker := w.clock.NewTicker(max(interval, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case now := <-ticker.C():
+				w.sweep(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic sweeps
+func (w *streamWatchdog) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
+
+// openBodyInfo describes an open upstream response for /admin/stats
+type openBodyInfo struct {
+	RequestID string `json:"request_id"`
+	Model     string `json:"model"`
+	Stream    bool   `json:"stream"`
+	AgeMS     int64  `json:"age_ms"`
+	IdleMS    int64  `json:"idle_ms"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// list describes the open bodies, oldest first
+func (w *streamWatchdog) list(now time.Time) []openBodyInfo {
+	w.mu.Lock()
+	infos := make([]openBodyInfo, 0, len(w.bodies))
+	for b := range w.bodies {
+		infos = append(infos, openBodyInfo{
+			RequestID: b.id,
+			Model:     b.model,
+			Stream:    b.stream,
+			AgeMS:     now.Sub(b.opened).Milliseconds(),
+			IdleMS:    now.Sub(time.Unix(0, b.lastRead.Load())).Milliseconds(),
+			Bytes:     b.bytes.Load(),
+		})
+	}
+	w.mu.Unlock()
+	slices.SortFunc(infos, func(x, y openBodyInfo) int { return cmp.Compare(y.AgeMS, x.AgeMS) })
+	return infos
+}
+
+// handleStats reports the process's goroutines and memory with the watchdog's accounting
+func (s *Server) handleStats(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	bodies := s.watchdog.list(s.watchdog.clock.Now())
+	streams := 0
+	for _, b := range bodies {
+		if b.Stream {
+			streams++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"goroutines":           runtime.NumGoroutine(),
+		"heap_bytes":           m.HeapAlloc,
+		"active_requests":      len(s.active.list(time.Now())),
+		"open_upstream_bodies": len(bodies),
+		"streaming_relays":     streams,
+		"force_closed":         s.watchdog.closed.Load(),
+		"stream_caps": gin.H{
+			"max_duration": s.watchdog.maxDuration.String(),
+			"idle_timeout": s.watchdog.idleTimeout.String(),
+		},
+		"bodies": bodies,
+	})
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamWatchdog(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	registry := metrics.NewRegistry()
+	w := newStreamWatchdog(config.StreamsConfig{MaxDuration: time.Hour, IdleTimeout: time.Minute}, registry)
+	w.clock = fake
+
+	// open tracks a stream that delivers data only when written to
+	open := func(id string) (*http.Response, *io.PipeWriter, *bool) {
+		pr, pw := io.Pipe()
+		resp := &http.Response{Body: pr, Header: http.Header{"Content-Type": {"text/event-stream"}}}
+		canceled := new(bool)
+		w.track(resp, &activeRequest{id: id, model: "glm-4.7"}, func() { *canceled = true })
+		return resp, pw, canceled
+	}
+
+	idle, _, idleCanceled := open("req_idle")
+	busy, busyWriter, busyCanceled := open("req_busy")
+	assert.Len(t, w.list(fake.Now()), 2)
+
+	// The busy stream keeps delivering, so only the idle one is closed
+	fake.Advance(50 * time.Second)
+	go busyWriter.Write([]byte("data: {}\n\n"))
+	buf := make([]byte, 64)
+	_, err := busy.Body.Read(buf)
+	require.NoError(t, err)
+	fake.Advance(20 * time.Second)
+
+	assert.Equal(t, 1, w.sweep(fake.Now()))
+	assert.True(t, *idleCanceled)
+	assert.False(t, *busyCanceled)
+	_, err = idle.Body.Read(buf)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	infos := w.list(fake.Now())
+	require.Len(t, infos, 1)
+	assert.Equal(t, "req_busy", infos[0].RequestID)
+	assert.Equal(t, int64(10), infos[0].Bytes)
+
+	// Even a busy stream is closed at the hard cap
+	for range 60 {
+		go busyWriter.Write([]byte("x"))
+		busy.Body.Read(buf)
+		fake.Advance(time.Minute - time.Second)
+	}
+	assert.Equal(t, 1, w.sweep(fake.Now()))
+	assert.True(t, *busyCanceled)
+	assert.Empty(t, w.list(fake.Now()))
+
+	// Closing again after the relay ends changes nothing
+	busy.Body.Close()
+	assert.Equal(t, 0, w.sweep(fake.Now()))
+
+	var out strings.Builder
+	registry.WriteText(&out)
+	assert.Contains(t, out.String(), `copilot_proxy_streams_force_closed_total{reason="idle"} 1`)
+	assert.Contains(t, out.String(), `copilot_proxy_streams_force_closed_total{reason="max_duration"} 1`)
+	assert.Contains(t, out.String(), `copilot_proxy_open_upstream_bodies{kind="stream"} 0`)
+}
+
+func TestAdminStats(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	s := NewServer(&config.Config{BaseURL: upstream.URL, Admin: config.AdminConfig{Token: testAdminToken}}, "127.0.0.1", 0)
+	stats := func() map[string]any {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, adminRequest("GET", "/admin/stats", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "glm-4.7", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(requestIDHeader, "req_stats")
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	assert.Eventually(t, func() bool { return stats()["streaming_relays"] == 1.0 }, 2*time.Second, 10*time.Millisecond)
+	got := stats()
+	assert.Equal(t, 1.0, got["open_upstream_bodies"])
+	assert.Equal(t, "req_stats", got["bodies"].([]any)[0].(map[string]any)["request_id"])
+	assert.Equal(t, "1h0m0s", got["stream_caps"].(map[string]any)["max_duration"])
+
+	close(release)
+	<-done
+	assert.Equal(t, 0.0, stats()["open_upstream_bodies"])
+}
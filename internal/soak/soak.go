@@ -0,0 +1,318 @@
+// Package soak drives long runs of synthetic traffic through the proxy while watching the
+// process's memory, goroutines and file descriptors, to catch leaks before a release.
+package soak
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind is a type of request in the traffic mix
+type Kind string
+
+const (
+	KindChat   Kind = "chat"   // Non-streaming completion
+	KindStream Kind = "stream" // Streamed completion read to the end
+	KindTools  Kind = "tools"  // Streamed completion with tools, answered by a tool call
+	KindVision Kind = "vision" // Non-streaming completion with an image
+	KindCancel Kind = "cancel" // Streamed completion abandoned by the client after the first chunk
+)
+
+// profiles weigh the request kinds of each traffic mix
+var profiles = map[string]map[Kind]int{
+	"mixed":  {KindStream: 40, KindChat: 25, KindTools: 20, KindCancel: 10, KindVision: 5},
+	"stream": {KindStream: 80, KindCancel: 20},
+	"chat":   {KindChat: 80, KindVision: 20},
+	"tools":  {KindTools: 80, KindCancel: 20},
+	"cancel": {KindCancel: 100},
+}
+
+// Profiles returns the names of the traffic mixes
+func Profiles() []string {
+	return slices.Sorted(maps.Keys(profiles))
+}
+
+// Sample is a snapshot of the process's resources
+type Sample struct {
+	Time       time.Time
+	Requests   int64
+	Errors     int64
+	HeapBytes  uint64 // Live heap after a collection
+	Goroutines int
+	FDs        int // Open file descriptors; -1 where they cannot be counted
+}
+
+// Runner sends synthetic traffic to a proxy and samples resources as it goes
+type Runner struct {
+	BaseURL     string // Proxy address, e.g. http://127.0.0.1:11434
+	APIKey      string // Client key, sent as a Bearer token when set
+	Profile     string
+	Concurrency int
+	Interval    time.Duration      // Time between samples
+	Warmup      time.Duration      // Traffic before the baseline sample, filling pools and caches
+	Settle      time.Duration      // Quiet time after traffic before the final sample
+	OnSample    func(s Sample)     // Called with each sample, e.g. to print progress
+	Client      *http.Client       // Defaults to a client with a one minute timeout
+	kinds       map[Kind]*counters // Per kind results
+}
+
+// counters are the results of one request kind
+type counters struct {
+	requests atomic.Int64
+	errors   atomic.Int64
+}
+
+// KindResult counts the requests of one kind
+type KindResult struct {
+	Requests int64
+	Errors   int64
+}
+
+// Report is the outcome of a soak run
+type Report struct {
+	Baseline Sample   // After warmup
+	Final    Sample   // After traffic stopped and the process settled
+	Samples  []Sample // Every sample, in order
+	Kinds    map[Kind]KindResult
+	Leaks    []string // Resources that grew past their allowance
+	Errors   []string // First few request errors
+}
+
+// Allowances for growth between the baseline and the final sample. Goroutines and descriptors
+// vary with pooled connections, and the heap with caches that fill slowly.
+const (
+	goroutineSlack = 25
+	fdSlack        = 16
+	heapSlack      = 32 << 20
+	maxErrors      = 5
+)
+
+// Run sends traffic for d, then lets the process settle and compares the final sample with the
+// one taken after warmup
+func (r *Runner) Run(ctx context.Context, d time.Duration) (*Report, error) {
+	weights, ok := profiles[r.Profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (use one of %s)", r.Profile, strings.Join(Profiles(), ", "))
+	}
+	if r.Client == nil {
+		r.Client = &http.Client{Timeout: time.Minute}
+	}
+	r.Concurrency = max(r.Concurrency, 1)
+	r.kinds = make(map[Kind]*counters)
+	for k := range weights {
+		r.kinds[k] = &counters{}
+	}
+
+	report := &Report{Kinds: make(map[Kind]KindResult)}
+	var errMu sync.Mutex
+	recordError := func(err error) {
+		errMu.Lock()
+		if len(report.Errors) < maxErrors {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		errMu.Unlock()
+	}
+
+	trafficCtx, stop := context.WithTimeout(ctx, d)
+	defer stop()
+	var wg sync.WaitGroup
+	for range r.Concurrency {
+		wg.Go(func() {
+			for trafficCtx.Err() == nil {
+				kind := pick(weights, rand.IntN)
+				c := r.kinds[kind]
+				c.requests.Add(1)
+				if err := r.send(trafficCtx, kind); err != nil && trafficCtx.Err() == nil {
+					c.errors.Add(1)
+					recordError(fmt.Errorf("%s: %w", kind, err))
+				}
+			}
+		})
+	}
+
+	sample := func() Sample {
+		s := r.sample()
+		report.Samples = append(report.Samples, s)
+		if r.OnSample != nil {
+			r.OnSample(s)
+		}
+		return s
+	}
+	warmup := time.After(min(r.Warmup, d))
+	interval := max(r.Interval, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	baselined := false
+loop:
+	for {
+		select {
+		case <-trafficCtx.Done():
+			break loop
+		case <-warmup:
+			report.Baseline = sample()
+			baselined = true
+			ticker.Reset(interval)
+		case <-ticker.C:
+			if baselined {
+				sample()
+			}
+		}
+	}
+	// Runs shorter than the warmup compare with the end of the traffic instead
+	if !baselined {
+		report.Baseline = sample()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Idle client connections would otherwise count as leaked goroutines and descriptors
+	r.Client.CloseIdleConnections()
+	select {
+	case <-time.After(r.Settle):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	report.Final = sample()
+	for k, c := range r.kinds {
+		report.Kinds[k] = KindResult{Requests: c.requests.Load(), Errors: c.errors.Load()}
+	}
+	report.Leaks = leaks(report.Baseline, report.Final)
+	return report, nil
+}
+
+// leaks lists the resources that grew past their allowance
+func leaks(base, final Sample) []string {
+	var found []string
+	if grew := final.Goroutines - base.Goroutines; grew > goroutineSlack {
+		found = append(found, fmt.Sprintf("goroutines grew by %d (%d -> %d)", grew, base.Goroutines, final.Goroutines))
+	}
+	if base.FDs >= 0 && final.FDs >= 0 {
+		if grew := final.FDs - base.FDs; grew > fdSlack {
+			found = append(found, fmt.Sprintf("file descriptors grew by %d (%d -> %d)", grew, base.FDs, final.FDs))
+		}
+	}
+	if final.HeapBytes > 2*base.HeapBytes && final.HeapBytes-base.HeapBytes > heapSlack {
+		found = append(found, fmt.Sprintf("heap grew from %d MiB to %d MiB", base.HeapBytes>>20, final.HeapBytes>>20))
+	}
+	return found
+}
+
+// pick chooses a request kind by weight
+func pick(weights map[Kind]int, intn func(int) int) Kind {
+	kinds := slices.Sorted(maps.Keys(weights))
+	total := 0
+	for _, k := range kinds {
+		total += weights[k]
+	}
+	n := intn(total)
+	for _, k := range kinds {
+		if n < weights[k] {
+			return k
+		}
+		n -= weights[k]
+	}
+	return kinds[len(kinds)-1]
+}
+
+// sample measures the process after a garbage collection
+func (r *Runner) sample() Sample {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	var requests, errors int64
+	for _, c := range r.kinds {
+		requests += c.requests.Load()
+		errors += c.errors.Load()
+	}
+	return Sample{
+		Time:       time.Now(),
+		Requests:   requests,
+		Errors:     errors,
+		HeapBytes:  m.HeapAlloc,
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        openFDs(),
+	}
+}
+
+// openFDs counts the process's open file descriptors, or returns -1 where that is not possible
+func openFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries)
+		}
+	}
+	return -1
+}
+
+// imageURL is a 1x1 PNG sent by vision requests
+const imageURL = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+// body builds the request of a kind
+func body(kind Kind) string {
+	switch kind {
+	case KindChat:
+		return `{"model":"glm-4.7","stream":false,"messages":[{"role":"user","content":"Say ok"}]}`
+	case KindVision:
+		return `{"model":"glm-4.6v","stream":false,"messages":[{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"` + imageURL + `"}}]}]}`
+	case KindTools:
+		return `{"model":"glm-4.7","stream":true,"messages":[{"role":"user","content":"Open main.go"}],"tools":[{"type":"function","function":{"name":"read_file","description":"Read a file","parameters":{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}}}]}`
+	default:
+		return `{"model":"glm-4.7","stream":true,"messages":[{"role":"user","content":"Count to eight"}]}`
+	}
+}
+
+// send makes one request and reads as much of the answer as its kind calls for
+func (r *Runner) send(ctx context.Context, kind Kind) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(r.BaseURL, "/")+"/v1/chat/completions", bytes.NewReader([]byte(body(kind))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	if kind == KindCancel {
+		// Hang up after the first event, as an editor does when the user stops generation
+		if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if kind != KindChat && kind != KindVision && !bytes.Contains(data, []byte("[DONE]")) {
+		return fmt.Errorf("stream ended without [DONE]")
+	}
+	return nil
+}
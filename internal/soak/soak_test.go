@@ -0,0 +1,88 @@
+package soak
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRun tests a short run of every request kind against the mock upstream
+func TestRun(t *testing.T) {
+	upstream := httptest.NewServer(NewUpstream(time.Millisecond))
+	defer upstream.Close()
+
+	var samples int
+	r := &Runner{
+		BaseURL:     upstream.URL,
+		Profile:     "mixed",
+		Concurrency: 4,
+		Interval:    time.Second,
+		Warmup:      200 * time.Millisecond,
+		Settle:      50 * time.Millisecond,
+		OnSample:    func(Sample) { samples++ },
+	}
+	report, err := r.Run(context.Background(), 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(report.Errors) > 0 {
+		t.Errorf("Run() request errors = %q", report.Errors)
+	}
+	for _, kind := range []Kind{KindChat, KindStream, KindTools, KindVision, KindCancel} {
+		if report.Kinds[kind].Requests == 0 {
+			t.Errorf("Run() sent no %s requests", kind)
+		}
+	}
+	if samples != len(report.Samples) || samples < 3 {
+		t.Errorf("OnSample called %d times for %d samples, want at least 3", samples, len(report.Samples))
+	}
+	if report.Final.Requests == 0 || report.Final.Goroutines == 0 {
+		t.Errorf("Final sample = %+v, want requests and goroutines", report.Final)
+	}
+}
+
+// TestRun_UnknownProfile tests that profiles are checked before any traffic is sent
+func TestRun_UnknownProfile(t *testing.T) {
+	r := &Runner{BaseURL: "http://127.0.0.1:1", Profile: "nope"}
+	if _, err := r.Run(context.Background(), time.Second); err == nil {
+		t.Error("Run() error = nil, want unknown profile")
+	}
+}
+
+// TestPick tests that kinds are chosen in proportion to their weights
+func TestPick(t *testing.T) {
+	weights := map[Kind]int{KindChat: 1, KindStream: 3}
+	counts := make(map[Kind]int)
+	for n := range 4 {
+		counts[pick(weights, func(int) int { return n })]++
+	}
+	if counts[KindChat] != 1 || counts[KindStream] != 3 {
+		t.Errorf("pick() counts = %v, want chat 1, stream 3", counts)
+	}
+}
+
+// TestLeaks tests the growth allowances
+func TestLeaks(t *testing.T) {
+	base := Sample{HeapBytes: 10 << 20, Goroutines: 50, FDs: 20}
+	tests := []struct {
+		name  string
+		final Sample
+		want  int
+	}{
+		{"steady", Sample{HeapBytes: 12 << 20, Goroutines: 60, FDs: 30}, 0},
+		{"goroutines", Sample{HeapBytes: 10 << 20, Goroutines: 100, FDs: 20}, 1},
+		{"descriptors", Sample{HeapBytes: 10 << 20, Goroutines: 50, FDs: 40}, 1},
+		{"heap", Sample{HeapBytes: 60 << 20, Goroutines: 50, FDs: 20}, 1},
+		{"uncounted descriptors", Sample{HeapBytes: 10 << 20, Goroutines: 50, FDs: -1}, 0},
+		{"everything", Sample{HeapBytes: 60 << 20, Goroutines: 100, FDs: 40}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leaks(base, tt.final); len(got) != tt.want {
+				t.Errorf("leaks() = %q, want %d findings", got, tt.want)
+			}
+		})
+	}
+}
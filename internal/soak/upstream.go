@@ -0,0 +1,142 @@
+package soak
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UpstreamPath is the chat completions path the mock upstream serves; proxies under soak use
+// the mock's URL with /v1 as their base URL
+const UpstreamPath = "/v1/chat/completions"
+
+// Upstream is a mock OpenAI-compatible chat completions API. It answers every request with a
+// short canned completion, streamed chunk by chunk when asked, and with a tool call when the
+// request offers tools.
+type Upstream struct {
+	ChunkDelay time.Duration // Pause between streamed chunks
+	Chunks     int           // Content chunks per streamed answer
+}
+
+// NewUpstream creates a mock upstream with the given pause between streamed chunks
+func NewUpstream(chunkDelay time.Duration) *Upstream {
+	return &Upstream{ChunkDelay: chunkDelay, Chunks: 8}
+}
+
+// ServeHTTP answers chat completion requests
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != UpstreamPath || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+		Tools  []any  `json:"tools"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Stream {
+		u.stream(w, r, req.Model, len(req.Tools) > 0)
+		return
+	}
+	message := map[string]any{"role": "assistant", "content": strings.Repeat("ok ", u.Chunks)}
+	finish := "stop"
+	if len(req.Tools) > 0 {
+		message = map[string]any{"role": "assistant", "content": "", "tool_calls": []any{toolCall(`{"path":"main.go"}`)}}
+		finish = "tool_calls"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      "soak",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []any{map[string]any{"index": 0, "message": message, "finish_reason": finish}},
+		"usage":   usage(u.Chunks),
+	})
+}
+
+// stream sends the answer as server-sent events, stopping when the client goes away
+func (u *Upstream) stream(w http.ResponseWriter, r *http.Request, model string, tools bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	send := func(delta map[string]any, finish any, extra map[string]any) bool {
+		chunk := map[string]any{
+			"id":      "soak",
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+		for k, v := range extra {
+			chunk[k] = v
+		}
+		data, _ := json.Marshal(chunk)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-time.After(u.ChunkDelay):
+			return true
+		}
+	}
+
+	if !send(map[string]any{"role": "assistant", "content": ""}, nil, nil) {
+		return
+	}
+	finish := "stop"
+	if tools {
+		// Arguments arrive in pieces, as with incremental tool streaming
+		call := toolCall("")
+		call["index"] = 0
+		if !send(map[string]any{"tool_calls": []any{call}}, nil, nil) {
+			return
+		}
+		for _, part := range []string{`{"path":`, `"main.go"}`} {
+			if !send(map[string]any{"tool_calls": []any{map[string]any{"index": 0, "function": map[string]any{"arguments": part}}}}, nil, nil) {
+				return
+			}
+		}
+		finish = "tool_calls"
+	} else {
+		for range u.Chunks {
+			if !send(map[string]any{"content": "ok "}, nil, nil) {
+				return
+			}
+		}
+	}
+	if !send(map[string]any{}, finish, map[string]any{"usage": usage(u.Chunks)}) {
+		return
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// toolCall is the tool call the mock answers with
+func toolCall(arguments string) map[string]any {
+	return map[string]any{
+		"id":       "call_soak",
+		"type":     "function",
+		"function": map[string]any{"name": "read_file", "arguments": arguments},
+	}
+}
+
+// usage is the token usage reported for an answer
+func usage(completion int) map[string]any {
+	return map[string]any{"prompt_tokens": 12, "completion_tokens": completion, "total_tokens": 12 + completion}
+}
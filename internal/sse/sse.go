@@ -0,0 +1,108 @@
+package sse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DoneData is the sentinel data payload that ends an OpenAI-style stream
+const DoneData = "[DONE]"
+
+// Event is a single server-sent event. Comment holds ": ..." lines, which carry no data.
+type Event struct {
+	Event   string
+	ID      string
+	Data    string
+	Comment string
+}
+
+// IsDone reports whether the event is the end-of-stream sentinel
+func (e Event) IsDone() bool {
+	return strings.TrimSpace(e.Data) == DoneData
+}
+
+// Reader parses a server-sent event stream
+type Reader struct {
+	scanner *bufio.Scanner
+}
+
+// NewReader creates a reader; single lines may be up to 4MB
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF at the end of the stream. A trailing event without
+// a terminating blank line is still returned.
+func (r *Reader) Next() (Event, error) {
+	var ev Event
+	var data []string
+	var comments []string
+	seen := false
+
+	for r.scanner.Scan() {
+		line := strings.TrimSuffix(r.scanner.Text(), "\r")
+		if line == "" {
+			if seen {
+				ev.Data = strings.Join(data, "\n")
+				ev.Comment = strings.Join(comments, "\n")
+				return ev, nil
+			}
+			continue
+		}
+		seen = true
+
+		if comment, ok := strings.CutPrefix(line, ":"); ok {
+			comments = append(comments, strings.TrimPrefix(comment, " "))
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			ev.Event = value
+		case "id":
+			ev.ID = value
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	if seen {
+		ev.Data = strings.Join(data, "\n")
+		ev.Comment = strings.Join(comments, "\n")
+		return ev, nil
+	}
+	return Event{}, io.EOF
+}
+
+// Write encodes an event in wire format, terminated by a blank line
+func Write(w io.Writer, ev Event) error {
+	var b strings.Builder
+	if ev.Comment != "" {
+		for _, line := range strings.Split(ev.Comment, "\n") {
+			fmt.Fprintf(&b, ": %s\n", line)
+		}
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", ev.Event)
+	}
+	if ev.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", ev.ID)
+	}
+	if ev.Data != "" || (ev.Comment == "" && ev.Event == "") {
+		for _, line := range strings.Split(ev.Data, "\n") {
+			fmt.Fprintf(&b, "data: %s\n", line)
+		}
+	}
+	b.WriteByte('\n')
+	_, err := io.WriteString(w, b.String())
+	return err
+}
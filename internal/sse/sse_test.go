@@ -0,0 +1,60 @@
+package sse
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestReader tests parsing of data, named, comment and trailing events
+func TestReader(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"data: {\"a\":1}\n\n" +
+		"event: ping\nid: 7\ndata: line1\ndata: line2\r\n\r\n" +
+		"data: [DONE]"
+
+	r := NewReader(strings.NewReader(stream))
+	expected := []Event{
+		{Comment: "keep-alive"},
+		{Data: `{"a":1}`},
+		{Event: "ping", ID: "7", Data: "line1\nline2"},
+		{Data: "[DONE]"},
+	}
+
+	for i, want := range expected {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("Event %d: unexpected error %v", i, err)
+		}
+		if got != want {
+			t.Errorf("Event %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+// TestWrite tests that written events parse back identically
+func TestWrite(t *testing.T) {
+	events := []Event{
+		{Data: `{"choices":[]}`},
+		{Event: "message", ID: "1", Data: "a\nb"},
+		{Comment: "latency 12ms"},
+	}
+
+	var b strings.Builder
+	for _, ev := range events {
+		if err := Write(&b, ev); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	r := NewReader(strings.NewReader(b.String()))
+	for i, want := range events {
+		got, err := r.Next()
+		if err != nil || got != want {
+			t.Errorf("Event %d = %+v (%v), want %+v", i, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// retryShared is how long a failed shared store is bypassed before it is tried again
+const retryShared = 10 * time.Second
+
+// Fallback uses a shared store and degrades to process-local state while the shared store is
+// unreachable, so an outage loosens limits to per-replica instead of failing requests
+type Fallback struct {
+	shared Store
+	local  *Memory
+
+	// OnChange, if set before first use, is called when the shared store goes down or recovers
+	OnChange func(up bool)
+
+	mu        sync.Mutex
+	down      bool
+	downUntil time.Time
+	clock     clock.Clock
+}
+
+// NewFallback wraps a shared store with a local fallback
+func NewFallback(shared Store) *Fallback {
+	return &Fallback{shared: shared, local: NewMemory(), clock: clock.Real{}}
+}
+
+// Up reports whether operations currently go to the shared store
+func (f *Fallback) Up() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.down
+}
+
+// Get implements Store
+func (f *Fallback) Get(ctx context.Context, key string) ([]byte, error) {
+	if f.useShared() {
+		v, err := f.shared.Get(ctx, key)
+		if f.ok(ctx, err) {
+			return v, err
+		}
+	}
+	return f.local.Get(ctx, key)
+}
+
+// Set implements Store
+func (f *Fallback) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if f.useShared() {
+		if err := f.shared.Set(ctx, key, value, ttl); f.ok(ctx, err) {
+			return err
+		}
+	}
+	return f.local.Set(ctx, key, value, ttl)
+}
+
+// Delete implements Store
+func (f *Fallback) Delete(ctx context.Context, key string) error {
+	if f.useShared() {
+		if err := f.shared.Delete(ctx, key); f.ok(ctx, err) {
+			return err
+		}
+	}
+	return f.local.Delete(ctx, key)
+}
+
+// IncrBy implements Store
+func (f *Fallback) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if f.useShared() {
+		n, err := f.shared.IncrBy(ctx, key, delta, ttl)
+		if f.ok(ctx, err) {
+			return n, err
+		}
+	}
+	return f.local.IncrBy(ctx, key, delta, ttl)
+}
+
+// Close implements Store
+func (f *Fallback) Close() error {
+	return f.shared.Close()
+}
+
+// useShared reports whether the shared store should be tried: always while it is up, and
+// again once the retry delay after a failure has passed
+func (f *Fallback) useShared() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.down || !f.clock.Now().Before(f.downUntil)
+}
+
+// ok records the outcome of a shared store call and reports whether it succeeded. A call
+// abandoned by its caller, such as a disconnected client, says nothing about the store: it is
+// not an outage and its error is returned as is.
+func (f *Fallback) ok(ctx context.Context, err error) bool {
+	if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)) {
+		return true
+	}
+	failed := err != nil && !errors.Is(err, ErrNotFound)
+
+	f.mu.Lock()
+	changed := f.down != failed
+	f.down = failed
+	if failed {
+		f.downUntil = f.clock.Now().Add(retryShared)
+	}
+	f.mu.Unlock()
+
+	if changed {
+		if failed {
+			slog.Warn("Shared storage unreachable, using local state", "retry_in", retryShared, "error", err)
+		} else {
+			slog.Info("Shared storage recovered")
+		}
+		if f.OnChange != nil {
+			f.OnChange(!failed)
+		}
+	}
+	return !failed
+}
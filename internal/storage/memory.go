@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// sweepEvery bounds how often expired keys are evicted
+const sweepEvery = time.Minute
+
+// entry is a stored value and its expiry (zero for none)
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// Memory is a process-local store, the default for a single replica
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+	clock     clock.Clock
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]entry), clock: clock.Real{}}
+}
+
+// Get implements Store
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.live(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+// Set implements Store
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep()
+	m.entries[key] = entry{value: append([]byte(nil), value...), expires: m.expiry(ttl)}
+	return nil
+}
+
+// Delete implements Store
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// IncrBy implements Store
+func (m *Memory) IncrBy(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep()
+	e, ok := m.live(key)
+	if !ok {
+		e = entry{expires: m.expiry(ttl)}
+	}
+	n, _ := strconv.ParseInt(string(e.value), 10, 64)
+	n += delta
+	e.value = strconv.AppendInt(nil, n, 10)
+	m.entries[key] = e
+	return n, nil
+}
+
+// Close implements Store
+func (m *Memory) Close() error {
+	return nil
+}
+
+// live returns an unexpired entry; callers hold m.mu
+func (m *Memory) live(key string) (entry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !e.expires.IsZero() && !m.clock.Now().Before(e.expires) {
+		delete(m.entries, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// expiry converts a ttl into an absolute time; callers hold m.mu
+func (m *Memory) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return m.clock.Now().Add(ttl)
+}
+
+// sweep evicts expired entries at most once a minute; callers hold m.mu
+func (m *Memory) sweep() {
+	now := m.clock.Now()
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for key, e := range m.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// maxIdleConns bounds the connections kept open between commands
+const maxIdleConns = 8
+
+// incrScript increments a counter and sets its expiry only when the call created it, atomically
+const incrScript = `local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) and tonumber(ARGV[2]) > 0 then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+return v`
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Redis is a store shared by every replica pointed at the same server, speaking the Redis
+// protocol (RESP2) directly over TCP
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	prefix   string // Namespaces keys so several deployments can share a server
+	timeout  time.Duration
+
+	idle chan *redisConn
+}
+
+// redisConn is one client connection
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewRedis creates a Redis store; connections are opened on first use
+func NewRedis(cfg config.RedisConfig) *Redis {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Redis{
+		addr:     cfg.Addr,
+		password: cfg.Password,
+		db:       cfg.DB,
+		prefix:   cfg.Prefix,
+		timeout:  timeout,
+		idle:     make(chan *redisConn, maxIdleConns),
+	}
+}
+
+// Get implements Store
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNotFound
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, nil
+}
+
+// Set implements Store
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", r.prefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Delete implements Store
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.prefix+key)
+	return err
+}
+
+// IncrBy implements Store
+func (r *Redis) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	reply, err := r.do(ctx, "EVAL", incrScript, "1", r.prefix+key,
+		strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCRBY reply %T", reply)
+	}
+	return n, nil
+}
+
+// Close implements Store
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do runs one command on a pooled connection. Connections that fail are discarded; error
+// replies leave the connection usable.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(ctx, r.timeout, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+// get takes an idle connection or dials a new one
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: r.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if r.password != "" {
+		if _, err := c.roundTrip(ctx, r.timeout, []string{"AUTH", r.password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.roundTrip(ctx, r.timeout, []string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put returns a connection to the pool, closing it if the pool is full
+func (r *Redis) put(c *redisConn) {
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// roundTrip writes a command and reads its reply
+func (c *redisConn) roundTrip(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, a := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readReply(c.r)
+}
+
+// readReply parses one RESP2 reply: simple strings, errors, integers, bulk strings and arrays
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer %q", body)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
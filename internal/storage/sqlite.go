@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kv (
+	key     TEXT PRIMARY KEY,
+	value   BLOB NOT NULL,
+	expires INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS kv_expires ON kv (expires) WHERE expires != 0;
+`
+
+// SQLite keeps state in a database file, so it survives restarts and is shared by proxies
+// on the same host
+type SQLite struct {
+	db        *sql.DB
+	clock     clock.Clock
+	mu        sync.Mutex // guards lastSweep
+	lastSweep time.Time
+}
+
+// NewSQLite opens the database at path, creating it and its directory if needed
+func NewSQLite(path string) (*SQLite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// WAL and the busy timeout let several processes share the file
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("storage %s: %w", path, err)
+	}
+	return &SQLite{db: db, clock: clock.Real{}}, nil
+}
+
+// Get implements Store
+func (s *SQLite) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key = ? AND (expires = 0 OR expires > ?)`,
+		key, s.now()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Set implements Store
+func (s *SQLite) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.sweep(ctx)
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO kv (key, value, expires) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires = excluded.expires`,
+		key, value, s.expiry(ttl))
+	return err
+}
+
+// Delete implements Store
+func (s *SQLite) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE key = ?`, key)
+	return err
+}
+
+// IncrBy implements Store. The single upsert is atomic across processes sharing the file; an
+// expired counter restarts from delta with a fresh expiry.
+func (s *SQLite) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.sweep(ctx)
+	now := s.now()
+	var n int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO kv (key, value, expires) VALUES (?1, ?2, ?3)
+		ON CONFLICT (key) DO UPDATE SET
+			value = CASE WHEN kv.expires != 0 AND kv.expires <= ?4 THEN ?2 ELSE CAST(kv.value AS INTEGER) + ?2 END,
+			expires = CASE WHEN kv.expires != 0 AND kv.expires <= ?4 THEN ?3 ELSE kv.expires END
+		RETURNING value`, key, delta, s.expiry(ttl), now).Scan(&n)
+	return n, err
+}
+
+// Close implements Store
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// now is the current time in the unit stored in the expires column
+func (s *SQLite) now() int64 {
+	return s.clock.Now().UnixMilli()
+}
+
+// expiry converts a ttl into the expires column, 0 for none
+func (s *SQLite) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return s.clock.Now().Add(ttl).UnixMilli()
+}
+
+// sweep deletes expired rows at most once a minute
+func (s *SQLite) sweep(ctx context.Context) {
+	s.mu.Lock()
+	now := s.clock.Now()
+	if now.Sub(s.lastSweep) < sweepEvery {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE expires != 0 AND expires <= ?`, now.UnixMilli()); err != nil {
+		slog.Warn("Failed to sweep expired storage keys", "error", err)
+	}
+}
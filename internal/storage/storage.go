@@ -0,0 +1,49 @@
+// Package storage abstracts the state that proxy replicas share, such as quota and rate-limit
+// counters, behind a small key-value interface with in-memory, SQLite and Redis backends
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// ErrNotFound is returned by Get for a missing or expired key
+var ErrNotFound = errors.New("storage: key not found")
+
+// Store is a key-value store with expiring keys and atomic counters
+type Store interface {
+	// Get returns the value of key or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key; a ttl of 0 keeps it until deleted
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// IncrBy adds delta to the counter at key and returns the new value. A counter created by
+	// the call expires after ttl (0 keeps it), so fixed windows need no cleanup.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Close releases the store's resources
+	Close() error
+}
+
+// Open creates the configured backend. A Redis store falls back to local state while the
+// server is unreachable.
+func Open(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "sqlite":
+		path, err := cfg.SQLite.DBPath()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLite(path)
+	case "redis":
+		return NewFallback(NewRedis(cfg.Redis)), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (use memory, sqlite or redis)", cfg.Backend)
+	}
+}
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+)
+
+// testStore runs the behaviour every backend must share
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.Set(ctx, "k", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "k"); err != nil || string(got) != "v1" {
+		t.Fatalf("Get(k) = %q, %v", got, err)
+	}
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete(missing) error = %v", err)
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := s.IncrBy(ctx, "counter", 1, time.Minute)
+		if err != nil || n != want {
+			t.Fatalf("IncrBy = %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, _ := s.IncrBy(ctx, "counter", 5, time.Minute); n != 8 {
+		t.Errorf("IncrBy(5) = %d, want 8", n)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestMemory_Expiry(t *testing.T) {
+	m := NewMemory()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	m.clock = clk
+	ctx := context.Background()
+
+	_ = m.Set(ctx, "short", []byte("x"), time.Second)
+	_ = m.Set(ctx, "forever", []byte("y"), 0)
+	_, _ = m.IncrBy(ctx, "window", 1, time.Minute)
+
+	clk.Advance(30 * time.Second)
+	if _, err := m.Get(ctx, "short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired key still readable: %v", err)
+	}
+	// Later increments keep the expiry set when the counter was created
+	if n, _ := m.IncrBy(ctx, "window", 1, time.Minute); n != 2 {
+		t.Errorf("IncrBy = %d, want 2", n)
+	}
+
+	clk.Advance(31 * time.Second)
+	if n, _ := m.IncrBy(ctx, "window", 1, time.Minute); n != 1 {
+		t.Errorf("IncrBy after window = %d, want 1", n)
+	}
+	if _, err := m.Get(ctx, "forever"); err != nil {
+		t.Errorf("Get(forever) error = %v", err)
+	}
+
+	// The sweep evicts expired keys nobody reads again
+	_ = m.Set(ctx, "stale", []byte("z"), time.Second)
+	clk.Advance(2 * time.Minute)
+	_ = m.Set(ctx, "other", []byte("z"), 0)
+	if _, ok := m.entries["stale"]; ok {
+		t.Error("expired key was not swept")
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
+
+func TestSQLite_Expiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.db")
+	s, err := NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.clock = clk
+	ctx := context.Background()
+
+	_ = s.Set(ctx, "short", []byte("x"), time.Second)
+	_ = s.Set(ctx, "forever", []byte("y"), 0)
+	_, _ = s.IncrBy(ctx, "window", 1, time.Minute)
+
+	clk.Advance(30 * time.Second)
+	if _, err := s.Get(ctx, "short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired key still readable: %v", err)
+	}
+	if n, _ := s.IncrBy(ctx, "window", 1, time.Minute); n != 2 {
+		t.Errorf("IncrBy = %d, want 2", n)
+	}
+
+	clk.Advance(31 * time.Second)
+	if n, _ := s.IncrBy(ctx, "window", 1, time.Minute); n != 1 {
+		t.Errorf("IncrBy after window = %d, want 1", n)
+	}
+
+	// State survives reopening the file
+	s.Close()
+	s, err = NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get(ctx, "forever"); err != nil || string(got) != "y" {
+		t.Errorf("Get(forever) after reopen = %q, %v", got, err)
+	}
+}
+
+// fakeRedis is a minimal RESP2 server supporting the commands the Redis store uses
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttls map[string]string // Last PX/PEXPIRE per key, in milliseconds
+	cmds []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{data: map[string]string{}, ttls: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn, password)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn, password string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, it := range items {
+			args[i] = string(it.([]byte))
+		}
+
+		f.mu.Lock()
+		f.cmds = append(f.cmds, args[0])
+		var out string
+		switch {
+		case args[0] == "AUTH":
+			if args[1] == password {
+				authed = true
+				out = "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "GET":
+			if v, ok := f.data[args[1]]; ok {
+				out = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				out = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.data[args[1]] = args[2]
+			if len(args) == 5 {
+				f.ttls[args[1]] = args[4]
+			}
+			out = "+OK\r\n"
+		case args[0] == "DEL":
+			delete(f.data, args[1])
+			out = ":1\r\n"
+		case args[0] == "EVAL":
+			key := args[3]
+			n, _ := strconv.ParseInt(f.data[key], 10, 64)
+			delta, _ := strconv.ParseInt(args[4], 10, 64)
+			n += delta
+			f.data[key] = strconv.FormatInt(n, 10)
+			if n == delta {
+				f.ttls[key] = args[5]
+			}
+			out = ":" + strconv.FormatInt(n, 10) + "\r\n"
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	f, addr := startFakeRedis(t, "secret")
+	r := NewRedis(config.RedisConfig{Addr: addr, Password: "secret", Prefix: "cp:", Timeout: time.Second})
+	defer r.Close()
+
+	testStore(t, r)
+
+	ctx := context.Background()
+	if err := r.Set(ctx, "session", []byte("data"), 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data["cp:session"] != "data" {
+		t.Errorf("keys are not prefixed: %v", f.data)
+	}
+	if f.ttls["cp:session"] != "90000" || f.ttls["cp:counter"] != "60000" {
+		t.Errorf("ttls = %v", f.ttls)
+	}
+	// Connections are reused, so AUTH runs once
+	auths := 0
+	for _, c := range f.cmds {
+		if c == "AUTH" {
+			auths++
+		}
+	}
+	if auths != 1 {
+		t.Errorf("AUTH sent %d times, want 1", auths)
+	}
+}
+
+func TestRedis_Errors(t *testing.T) {
+	_, addr := startFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	bad := NewRedis(config.RedisConfig{Addr: addr, Password: "wrong"})
+	if _, err := bad.Get(ctx, "k"); err == nil {
+		t.Error("expected an authentication error")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+	if _, err := NewRedis(config.RedisConfig{Addr: down}).IncrBy(ctx, "k", 1, 0); err == nil {
+		t.Error("expected a connection error")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open(config.StorageConfig{}); err != nil {
+		t.Errorf("Open(default) error = %v", err)
+	} else if _, ok := s.(*Memory); !ok {
+		t.Errorf("Open(default) = %T, want *Memory", s)
+	}
+	if s, _ := Open(config.StorageConfig{Backend: "redis"}); s == nil {
+		t.Error("Open(redis) returned nil")
+	} else if _, ok := s.(*Fallback); !ok {
+		t.Errorf("Open(redis) = %T, want *Fallback", s)
+	}
+	sqlitePath := filepath.Join(t.TempDir(), "storage.db")
+	if s, err := Open(config.StorageConfig{Backend: "sqlite", SQLite: config.SQLiteConfig{Path: sqlitePath}}); err != nil {
+		t.Errorf("Open(sqlite) error = %v", err)
+	} else if _, ok := s.(*SQLite); !ok {
+		t.Errorf("Open(sqlite) = %T, want *SQLite", s)
+	} else {
+		s.Close()
+	}
+	if _, err := Open(config.StorageConfig{Backend: "etcd"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+// flakyStore fails every call while down is set, and calls whose context is done
+type flakyStore struct {
+	Store
+	down bool
+}
+
+func (f *flakyStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if f.down {
+		return 0, errors.New("connection refused")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.Store.IncrBy(ctx, key, delta, ttl)
+}
+
+func TestFallback(t *testing.T) {
+	shared := &flakyStore{Store: NewMemory()}
+	f := NewFallback(shared)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	f.clock = clk
+	var changes []bool
+	f.OnChange = func(up bool) { changes = append(changes, up) }
+	ctx := context.Background()
+
+	testStore(t, NewFallback(NewMemory()))
+
+	if n, _ := f.IncrBy(ctx, "c", 1, 0); n != 1 {
+		t.Fatalf("IncrBy = %d, want 1", n)
+	}
+
+	// An outage switches to local counters without failing callers
+	shared.down = true
+	if n, err := f.IncrBy(ctx, "c", 1, 0); err != nil || n != 1 {
+		t.Fatalf("IncrBy during outage = %d, %v, want 1 from local state", n, err)
+	}
+	if f.Up() {
+		t.Error("Up() = true during outage")
+	}
+
+	// The shared store is not retried until the delay has passed
+	shared.down = false
+	if n, _ := f.IncrBy(ctx, "c", 1, 0); n != 2 {
+		t.Errorf("IncrBy before retry = %d, want 2 from local state", n)
+	}
+	clk.Advance(retryShared)
+	if n, _ := f.IncrBy(ctx, "c", 1, 0); n != 2 {
+		t.Errorf("IncrBy after recovery = %d, want 2 from shared state", n)
+	}
+	if !f.Up() {
+		t.Error("Up() = false after recovery")
+	}
+
+	if len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("OnChange calls = %v, want [false true]", changes)
+	}
+}
+
+func TestFallback_Canceled(t *testing.T) {
+	f := NewFallback(&flakyStore{Store: NewMemory()})
+	var changes []bool
+	f.OnChange = func(up bool) { changes = append(changes, up) }
+
+	// A caller giving up is not an outage, and gets its own error rather than local state
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.IncrBy(ctx, "c", 1, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("IncrBy with a canceled context error = %v, want context.Canceled", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := f.IncrBy(ctx, "c", 1, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("IncrBy past its deadline error = %v, want context.DeadlineExceeded", err)
+	}
+	if !f.Up() || len(changes) != 0 {
+		t.Errorf("Up() = %v, OnChange calls = %v after canceled calls, want up and none", f.Up(), changes)
+	}
+
+	if n, err := f.IncrBy(context.Background(), "c", 1, 0); err != nil || n != 1 {
+		t.Errorf("IncrBy = %d, %v, want 1 from shared state", n, err)
+	}
+}
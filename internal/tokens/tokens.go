@@ -0,0 +1,111 @@
+package tokens
+
+import (
+	"encoding/json"
+	"math"
+	"unicode"
+)
+
+// Heuristic constants; GLM's tokenizer is not public, so these approximate it from
+// observed usage rather than reproduce it
+const (
+	charsPerToken   = 4.0  // ASCII text
+	messageOverhead = 4    // Role and separators per message
+	replyPriming    = 3    // Tokens that prime the assistant reply
+	imageTokens     = 1000 // Per image at default detail
+	lowDetailImage  = 85   // Per image with detail "low"
+)
+
+// Text estimates the token count of a string. CJK characters count as one token each,
+// other non-ASCII characters as half a token and ASCII at about four characters per token.
+func Text(s string) int {
+	var ascii, cjk, other int
+	for _, r := range s {
+		switch {
+		case r < 128:
+			ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			cjk++
+		default:
+			other++
+		}
+	}
+	return int(math.Ceil(float64(ascii)/charsPerToken)) + cjk + (other+1)/2
+}
+
+// Messages estimates the prompt tokens of an OpenAI-style message list
+func Messages(messages []any) int {
+	total := replyPriming
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if msg == nil {
+			continue
+		}
+		total += messageOverhead
+		if role, ok := msg["role"].(string); ok {
+			total += Text(role)
+		}
+		if name, ok := msg["name"].(string); ok {
+			total += Text(name)
+		}
+		total += content(msg["content"])
+		if calls, ok := msg["tool_calls"]; ok {
+			total += JSON(calls)
+		}
+		if reasoning, ok := msg["reasoning_content"].(string); ok {
+			total += Text(reasoning)
+		}
+	}
+	return total
+}
+
+// content estimates a message's content, either a string or a list of parts
+func content(c any) int {
+	switch v := c.(type) {
+	case string:
+		return Text(v)
+	case []any:
+		total := 0
+		for _, p := range v {
+			part, _ := p.(map[string]any)
+			switch part["type"] {
+			case "text":
+				text, _ := part["text"].(string)
+				total += Text(text)
+			case "image_url":
+				image, _ := part["image_url"].(map[string]any)
+				if image["detail"] == "low" {
+					total += lowDetailImage
+				} else {
+					total += imageTokens
+				}
+			default:
+				total += JSON(part)
+			}
+		}
+		return total
+	case nil:
+		return 0
+	default:
+		return JSON(v)
+	}
+}
+
+// JSON estimates the tokens of a value's JSON encoding, e.g. tool definitions
+func JSON(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return Text(string(data))
+}
+
+// Request estimates the prompt tokens of a chat completion body (messages and tools)
+func Request(body map[string]any) int {
+	messages, _ := body["messages"].([]any)
+	total := Messages(messages)
+	if tools, ok := body["tools"].([]any); ok && len(tools) > 0 {
+		total += JSON(tools)
+	}
+	return total
+}
@@ -0,0 +1,47 @@
+package tokens
+
+import "testing"
+
+// TestText tests the per-script heuristics
+func TestText(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+	}{
+		{"Empty", "", 0},
+		{"ASCII", "Hello, world!", 4},
+		{"CJK", "你好世界", 4},
+		{"Mixed", "abcd é", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.input); got != tt.expected {
+				t.Errorf("Text(%q) = %d, want %d", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRequest tests message, image and tool accounting
+func TestRequest(t *testing.T) {
+	body := map[string]any{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "Be brief."},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "What is this?"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:...", "detail": "low"}},
+			}},
+		},
+	}
+
+	// priming 3 + system (4 + 2 + 3) + user (4 + 1 + 4 + 85)
+	if got := Request(body); got != 106 {
+		t.Errorf("Request() = %d, want 106", got)
+	}
+
+	body["tools"] = []any{map[string]any{"type": "function", "function": map[string]any{"name": "f"}}}
+	if got := Request(body); got <= 106 {
+		t.Errorf("Tools should add tokens, got %d", got)
+	}
+}
@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+)
+
+// pruneEvery bounds how often writes sweep the directory for expired traces
+const pruneEvery = time.Minute
+
+// Record is one traced exchange with the upstream API
+type Record struct {
+	ID                string              `json:"id"`
+	Time              time.Time           `json:"time"`
+	Reason            string              `json:"reason"` // "sampled" or "header"
+	Path              string              `json:"path"`
+	Client            string              `json:"client,omitempty"`
+	Model             string              `json:"model,omitempty"`
+	Metadata          map[string]string   `json:"metadata,omitempty"` // Client-supplied correlation metadata
+	Request           json.RawMessage     `json:"request"`            // Body as sent upstream, after the proxy's rewrites
+	Status            int                 `json:"status,omitempty"`
+	ResponseHeaders   map[string][]string `json:"response_headers,omitempty"`
+	Response          string              `json:"response,omitempty"` // Raw upstream body (JSON or SSE)
+	ResponseTruncated bool                `json:"response_truncated,omitempty"`
+	Error             string              `json:"error,omitempty"`
+	Timing            Timing              `json:"timing"`
+}
+
+// Timing holds durations in milliseconds, measured from when the request was sent upstream
+type Timing struct {
+	UpstreamHeadersMS float64 `json:"upstream_headers_ms"`
+	FirstByteMS       float64 `json:"first_byte_ms,omitempty"`
+	TotalMS           float64 `json:"total_ms"`
+}
+
+// Recorder writes each trace to its own JSON file and deletes traces older than the retention
+type Recorder struct {
+	dir       string
+	retention time.Duration
+	clock     clock.Clock
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// New creates a recorder writing to dir, creating it if needed and removing expired traces.
+// Traces expire by clk.
+func New(dir string, retention time.Duration, clk clock.Clock) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	r := &Recorder{dir: dir, retention: retention, clock: clk}
+	if _, err := r.Prune(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write saves a trace, pruning expired traces at most once per minute
+func (r *Recorder) Write(rec *Record) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	name := rec.Time.UTC().Format("20060102T150405") + "-" + rec.ID + ".json"
+	if err := os.WriteFile(filepath.Join(r.dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+
+	r.mu.Lock()
+	due := r.clock.Since(r.lastPrune) >= pruneEvery
+	r.mu.Unlock()
+	if due {
+		_, err = r.Prune()
+	}
+	return err
+}
+
+// Prune deletes traces older than the retention period and returns how many were removed
+func (r *Recorder) Prune() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastPrune = r.clock.Now()
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read trace directory: %w", err)
+	}
+
+	cutoff := r.lastPrune.Add(-r.retention)
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(r.dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	r, err := New(dir, time.Hour, clock.Real{})
+	require.NoError(t, err)
+
+	rec := &Record{
+		ID:      "abc123",
+		Time:    time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Reason:  "header",
+		Request: json.RawMessage(`{"model":"glm-4.7"}`),
+		Status:  200,
+	}
+	require.NoError(t, r.Write(rec))
+
+	data, err := os.ReadFile(filepath.Join(dir, "20261018T120000-abc123.json"))
+	require.NoError(t, err)
+	var got Record
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "abc123", got.ID)
+	assert.JSONEq(t, `{"model":"glm-4.7"}`, string(got.Request))
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.json")
+	fresh := filepath.Join(dir, "fresh.json")
+	other := filepath.Join(dir, "notes.txt")
+	for _, p := range []string{old, fresh, other} {
+		require.NoError(t, os.WriteFile(p, []byte("{}"), 0600))
+	}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(fresh, now, now))
+	require.NoError(t, os.Chtimes(old, past, past))
+	require.NoError(t, os.Chtimes(other, past, past))
+
+	// Expired traces are removed when the recorder starts
+	clk := clock.NewFake(now)
+	r, err := New(dir, time.Hour, clk)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, fresh)
+	assert.FileExists(t, other)
+
+	// and as the clock passes their retention
+	clk.Advance(time.Hour + time.Minute)
+	n, err := r.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, fresh)
+}
@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chew-z/copilot-proxy/internal/clock"
+	"github.com/chew-z/copilot-proxy/internal/config"
+	"github.com/chew-z/copilot-proxy/internal/s3"
+	"github.com/chew-z/copilot-proxy/internal/scheduler"
+)
+
+// AllTenants names the report covering every client when no tenants are configured
+const AllTenants = "all"
+
+// csvHeader lists the report columns
+var csvHeader = []string{"time", "client", "model", "status", "prompt_tokens", "completion_tokens", "cost_usd", "metadata", "requested_model", "canary",
+	"stream", "bytes", "first_byte_ms", "duration_ms", "bytes_per_sec", "tokens_per_sec",
+	"request_bytes", "response_bytes"}
+
+// WriteCSV writes records as a CSV report with a header row
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		metadata := ""
+		if len(r.Metadata) > 0 {
+			data, _ := json.Marshal(r.Metadata)
+			metadata = string(data)
+		}
+		row := []string{
+			r.Time.UTC().Format(time.RFC3339),
+			csvText(r.Client),
+			csvText(r.Model),
+			strconv.Itoa(r.Status),
+			strconv.Itoa(r.PromptTokens),
+			strconv.Itoa(r.CompletionTokens),
+			strconv.FormatFloat(r.CostUSD, 'f', 6, 64),
+			csvText(metadata),
+			csvText(r.RequestedModel),
+			csvText(r.Canary),
+			strconv.FormatBool(r.Stream),
+			strconv.FormatInt(r.Bytes, 10),
+			strconv.FormatInt(r.FirstByteMS, 10),
+			strconv.FormatInt(r.DurationMS, 10),
+			strconv.FormatFloat(r.BytesPerSec, 'f', 0, 64),
+			strconv.FormatFloat(r.TokensPerSec, 'f', 1, 64),
+			strconv.FormatInt(r.RequestBytes, 10),
+			strconv.FormatInt(r.ResponseBytes, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText neutralizes a text cell that a spreadsheet would run as a formula, such as a client
+// name or metadata value starting with "=", by prefixing it with a quote
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// tenant is one report's audience: the clients it covers and where it is uploaded
+type tenant struct {
+	name    string
+	clients []string // Empty covers every client
+	bucket  *s3.Client
+	prefix  string
+}
+
+// Exporter writes monthly usage reports per tenant on a cron schedule
+type Exporter struct {
+	ledgerDir string
+	outputDir string
+	schedule  *scheduler.Schedule
+	tenants   []tenant
+	clock     clock.Clock
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExporter validates the export configuration. Exports run on the schedule by clk.
+func NewExporter(cfg config.UsageExportConfig, ledgerDir, outputDir string, clk clock.Clock) (*Exporter, error) {
+	if cfg.Format != "" && cfg.Format != "csv" {
+		return nil, fmt.Errorf("unsupported format %q (only csv is available)", cfg.Format)
+	}
+	schedule, err := scheduler.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("schedule: %w", err)
+	}
+
+	e := &Exporter{ledgerDir: ledgerDir, outputDir: outputDir, schedule: schedule, clock: clk}
+	if len(cfg.Tenants) == 0 {
+		if err := checkS3(cfg.S3); err != nil {
+			return nil, err
+		}
+		e.tenants = []tenant{newTenant(AllTenants, nil, cfg.S3)}
+	}
+	for name, t := range cfg.Tenants {
+		if filepath.Base(name) != name || name == "." || name == ".." {
+			return nil, fmt.Errorf("tenant %q: name must be usable as a directory name", name)
+		}
+		if len(t.Clients) == 0 {
+			return nil, fmt.Errorf("tenant %q: clients are required", name)
+		}
+		bucket := cfg.S3.Merge(t.S3)
+		if err := checkS3(bucket); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", name, err)
+		}
+		e.tenants = append(e.tenants, newTenant(name, t.Clients, bucket))
+	}
+	slices.SortFunc(e.tenants, func(a, b tenant) int { return strings.Compare(a.name, b.name) })
+	return e, nil
+}
+
+// checkS3 requires an endpoint and credentials when a bucket is set
+func checkS3(cfg config.S3Config) error {
+	if cfg.Bucket != "" && (cfg.Endpoint == "" || cfg.AccessKey == "" || cfg.SecretKey == "") {
+		return fmt.Errorf("s3: endpoint, access_key and secret_key are required with a bucket")
+	}
+	return nil
+}
+
+// newTenant creates a tenant, uploading only when a bucket is configured
+func newTenant(name string, clients []string, cfg config.S3Config) tenant {
+	t := tenant{name: name, clients: clients, prefix: cfg.Prefix}
+	if cfg.Bucket != "" {
+		t.bucket = &s3.Client{
+			Endpoint:  cfg.Endpoint,
+			Region:    cfg.Region,
+			Bucket:    cfg.Bucket,
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+		}
+	}
+	return t
+}
+
+// Start exports the previous month at every activation of the schedule
+func (e *Exporter) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for {
+			next := e.schedule.Next(e.clock.Now())
+			if next.IsZero() {
+				slog.Warn("Usage export schedule never fires")
+				return
+			}
+			timer := e.clock.NewTimer(e.clock.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			month := time.Date(next.Year(), next.Month(), 0, 12, 0, 0, 0, time.UTC) // Last day of the previous month
+			if _, err := e.Export(ctx, month); err != nil {
+				slog.Error("Usage export failed", "error", err)
+			}
+		}
+	}()
+}
+
+// Stop cancels pending exports and waits for the export loop to exit
+func (e *Exporter) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	e.wg.Wait()
+}
+
+// Export writes the report of the UTC month containing month for every tenant, uploading
+// those with a bucket, and returns the files written
+func (e *Exporter) Export(ctx context.Context, month time.Time) ([]string, error) {
+	records, err := ReadMonth(e.ledgerDir, month)
+	if err != nil {
+		return nil, err
+	}
+	period := month.UTC().Format("2006-01")
+
+	var written []string
+	for _, t := range e.tenants {
+		var selected []Record
+		for _, r := range records {
+			if len(t.clients) == 0 || slices.Contains(t.clients, r.Client) {
+				selected = append(selected, r)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, selected); err != nil {
+			return written, fmt.Errorf("tenant %s: %w", t.name, err)
+		}
+
+		name := "usage-" + period + ".csv"
+		path := filepath.Join(e.outputDir, t.name, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return written, fmt.Errorf("tenant %s: %w", t.name, err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			return written, fmt.Errorf("tenant %s: %w", t.name, err)
+		}
+		written = append(written, path)
+
+		if t.bucket != nil {
+			key := t.prefix + t.name + "/" + name
+			if err := t.bucket.Put(ctx, key, buf.Bytes(), "text/csv"); err != nil {
+				return written, fmt.Errorf("tenant %s: %w", t.name, err)
+			}
+		}
+		slog.Info("Usage exported", "tenant", t.name, "period", period, "records", len(selected), "path", path, "uploaded", t.bucket != nil)
+	}
+	return written, nil
+}
@@ -0,0 +1,107 @@
+// Package usage keeps a per-request usage ledger and exports it as reports
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record is the usage of one chat request
+type Record struct {
+	Time             time.Time         `json:"time"`
+	Client           string            `json:"client,omitempty"` // Authenticated client name
+	Model            string            `json:"model"`
+	Status           int               `json:"status"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	CostUSD          float64           `json:"cost_usd"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	RequestedModel   string            `json:"requested_model,omitempty"` // Model the client asked for, when a canary applied
+	Canary           string            `json:"canary,omitempty"`          // "canary" or "control" for requests to a model under rollout
+	RequestBytes     int64             `json:"request_bytes,omitempty"`   // Body bytes sent upstream
+	ResponseBytes    int64             `json:"response_bytes,omitempty"`  // Body bytes received from upstream
+
+	// Throughput of streamed responses
+	Stream       bool    `json:"stream,omitempty"`
+	Bytes        int64   `json:"bytes,omitempty"`          // Response body bytes received from upstream
+	FirstByteMS  int64   `json:"first_byte_ms,omitempty"`  // From sending the request to the first body byte
+	DurationMS   int64   `json:"duration_ms,omitempty"`    // From the first body byte to the last
+	BytesPerSec  float64 `json:"bytes_per_sec,omitempty"`  // Bytes over the duration
+	TokensPerSec float64 `json:"tokens_per_sec,omitempty"` // Completion tokens over the duration
+}
+
+// Ledger appends records to one JSONL file per UTC month
+type Ledger struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewLedger creates a ledger writing to dir, creating it if needed
+func NewLedger(dir string) (*Ledger, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	return &Ledger{dir: dir}, nil
+}
+
+// Append writes a record to its month's file
+func (l *Ledger) Append(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(monthFile(l.dir, rec.Time), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// ReadMonth returns the records of the UTC month containing t; a month without a file has none
+func ReadMonth(dir string, t time.Time) ([]Record, error) {
+	f, err := os.Open(monthFile(dir, t))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A line torn by a crash should not block the report
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	return records, nil
+}
+
+// monthFile returns the ledger file for the UTC month containing t
+func monthFile(dir string, t time.Time) string {
+	return filepath.Join(dir, t.UTC().Format("2006-01")+".jsonl")
+}